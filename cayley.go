@@ -21,14 +21,18 @@ import (
 	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	client "net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"syscall"
 
 	"github.com/barakmich/glog"
 
@@ -39,6 +43,7 @@ import (
 	"github.com/google/cayley/quad"
 	"github.com/google/cayley/quad/cquads"
 	"github.com/google/cayley/quad/nquads"
+	"github.com/google/cayley/quad/tsv"
 
 	// Load all supported backends.
 	_ "github.com/google/cayley/graph/leveldb"
@@ -48,10 +53,15 @@ import (
 
 var (
 	tripleFile    = flag.String("triples", "", "Triple File to load before going to REPL.")
-	tripleType    = flag.String("format", "cquad", `Triple format to use for loading ("cquad" or "nquad").`)
+	tripleType    = flag.String("format", "cquad", `Triple format to use for loading ("cquad", "nquad" or "tsv").`)
 	cpuprofile    = flag.String("prof", "", "Output profiling file.")
 	queryLanguage = flag.String("query_lang", "gremlin", "Use this parser as the query language.")
 	configFile    = flag.String("config", "", "Path to an explicit configuration file.")
+	dumpFile      = flag.String("dump", "dbdump.nq", `Path to write a dump of the database to ("-" for stdout). A ".gz" extension will compress the dump.`)
+	dumpLevel     = flag.Int("dump_compression", gzip.DefaultCompression, "Gzip compression level to use when dumping to a \".gz\" file.")
+	importFrom    = flag.String("from", "", "Address of the Cayley server to import the graph of.")
+	importHeader  = flag.String("from_header", "", `Header to send to the server imported from, as "Name: value".`)
+	importResume  = flag.String("resume", "", "Token to resume a stopped import from.")
 )
 
 // Filled in by `go build ldflags="-X main.VERSION `ver`"`.
@@ -67,6 +77,9 @@ func Usage() {
 	fmt.Println("\nCommands:")
 	fmt.Println("  init      Create an empty database.")
 	fmt.Println("  load      Bulk-load a triple file into the database.")
+	fmt.Println("  dump      Write the contents of the database to a triple file.")
+	fmt.Println("  diff      Compare the database with a triple file.")
+	fmt.Println("  import    Load the graph of another Cayley server into the database.")
 	fmt.Println("  http      Serve an HTTP endpoint on the given host and port.")
 	fmt.Println("  repl      Drop into a REPL of the given query language.")
 	fmt.Println("  version   Version information.")
@@ -127,6 +140,7 @@ func main() {
 			if err != nil {
 				break
 			}
+			closeOnSignal(ts, cfg)
 			err = load(ts, cfg, *tripleFile, *tripleType)
 			if err != nil {
 				break
@@ -135,10 +149,15 @@ func main() {
 		}
 
 	case "load":
+		if cfg.ReadOnly {
+			err = graph.ErrReadOnly
+			break
+		}
 		ts, err = db.Open(cfg)
 		if err != nil {
 			break
 		}
+		closeOnSignal(ts, cfg)
 		err = load(ts, cfg, *tripleFile, *tripleType)
 		if err != nil {
 			break
@@ -146,6 +165,55 @@ func main() {
 
 		ts.Close()
 
+	case "dump":
+		ts, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		if !graph.IsPersistent(cfg.DatabaseType) {
+			err = load(ts, cfg, "", *tripleType)
+			if err != nil {
+				break
+			}
+		}
+
+		err = dump(ts, cfg, *dumpFile, *dumpLevel)
+
+		ts.Close()
+
+	case "import":
+		if cfg.ReadOnly {
+			err = graph.ErrReadOnly
+			break
+		}
+		ts, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		err = importGraph(ts, cfg, *importFrom, *importHeader, *importResume)
+
+		ts.Close()
+
+	case "diff":
+		ts, err = db.Open(cfg)
+		if err != nil {
+			break
+		}
+		if !graph.IsPersistent(cfg.DatabaseType) {
+			err = load(ts, cfg, "", *tripleType)
+			if err != nil {
+				break
+			}
+		}
+
+		var differ bool
+		differ, err = diff(ts, cfg, *tripleFile, *tripleType)
+
+		ts.Close()
+		if err == nil && differ {
+			os.Exit(1)
+		}
+
 	case "repl":
 		ts, err = db.Open(cfg)
 		if err != nil {
@@ -157,6 +225,9 @@ func main() {
 				break
 			}
 		}
+		if cfg.ReadOnly {
+			ts = graph.ReadOnly(ts)
+		}
 
 		err = db.Repl(ts, *queryLanguage, cfg)
 
@@ -167,12 +238,16 @@ func main() {
 		if err != nil {
 			break
 		}
+		closeOnSignal(ts, cfg)
 		if !graph.IsPersistent(cfg.DatabaseType) {
 			err = load(ts, cfg, "", *tripleType)
 			if err != nil {
 				break
 			}
 		}
+		if cfg.ReadOnly {
+			ts = graph.ReadOnly(ts)
+		}
 
 		http.Serve(ts, cfg)
 
@@ -182,13 +257,51 @@ func main() {
 		fmt.Println("No command", cmd)
 		flag.Usage()
 	}
+	if err == db.ErrShutdown {
+		// The store is closed, and the process exits, once the signal
+		// that stopped the load is handled.
+		select {}
+	}
 	if err != nil {
 		glog.Errorln(err)
 	}
 }
 
+// closeOnSignal stops the loads into ts when the process is sent SIGTERM or
+// an interrupt, waiting at most cfg.ShutdownTimeout for them to write the
+// triples they have buffered, then closes ts and exits.
+func closeOnSignal(ts graph.TripleStore, cfg *config.Config) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		glog.Infof("Received %v, writing buffered triples", sig)
+		if !db.Shutdown(cfg.ShutdownTimeout) {
+			glog.Errorf("Buffered triples not written within %v", cfg.ShutdownTimeout)
+		}
+		ts.Close()
+		glog.Flush()
+		os.Exit(1)
+	}()
+}
+
 func load(ts graph.TripleStore, cfg *config.Config, path, typ string) error {
-	var r io.Reader
+	dec, closer, err := openQuads(cfg, path, typ)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	return db.Load(ts, cfg, dec)
+}
+
+// openQuads opens the triple file or URL at path, or at the database path
+// if path is empty, for decoding in the format typ.
+func openQuads(cfg *config.Config, path, typ string) (quad.Unmarshaler, io.Closer, error) {
+	var (
+		r      io.Reader
+		closer io.Closer
+	)
 
 	if path == "" {
 		path = cfg.DatabasePath
@@ -202,22 +315,21 @@ func load(ts graph.TripleStore, cfg *config.Config, path, typ string) error {
 		}
 		f, err := os.Open(path)
 		if err != nil {
-			return fmt.Errorf("could not open file %q: %v", path, err)
+			return nil, nil, fmt.Errorf("could not open file %q: %v", path, err)
 		}
-		defer f.Close()
-		r = f
+		r, closer = f, f
 	} else {
 		res, err := client.Get(path)
 		if err != nil {
-			return fmt.Errorf("could not get resource <%s>: %v", u, err)
+			return nil, nil, fmt.Errorf("could not get resource <%s>: %v", u, err)
 		}
-		defer res.Body.Close()
-		r = res.Body
+		r, closer = res.Body, res.Body
 	}
 
 	r, err = decompressor(r)
 	if err != nil {
-		return err
+		closer.Close()
+		return nil, nil, err
 	}
 
 	var dec quad.Unmarshaler
@@ -226,11 +338,133 @@ func load(ts graph.TripleStore, cfg *config.Config, path, typ string) error {
 		dec = cquads.NewDecoder(r)
 	case "nquad":
 		dec = nquads.NewDecoder(r)
+	case "tsv":
+		dec = tsv.NewDecoder(r)
 	default:
-		return fmt.Errorf("unknown quad format %q", typ)
+		closer.Close()
+		return nil, nil, fmt.Errorf("unknown quad format %q", typ)
 	}
+	return dec, closer, nil
+}
 
-	return db.Load(ts, cfg, dec)
+// diff writes the triples of the database missing from the triple file at
+// path, marked "-", and those of the file missing from the database,
+// marked "+", returning whether there were any.
+func diff(ts graph.TripleStore, cfg *config.Config, path, typ string) (bool, error) {
+	if path == "" {
+		return false, errors.New("no triple file to compare the database with, give one with -triples")
+	}
+	dec, closer, err := openQuads(cfg, path, typ)
+	if err != nil {
+		return false, err
+	}
+	defer closer.Close()
+
+	added, removed, err := db.Diff(db.NewStoreDecoder(ts), dec)
+	if err != nil {
+		return false, err
+	}
+	var buf bytes.Buffer
+	enc := cquads.NewEncoder(&buf)
+	for _, change := range []struct {
+		mark  string
+		quads []quad.Quad
+	}{{"-", removed}, {"+", added}} {
+		for _, t := range change.quads {
+			buf.Reset()
+			if err := enc.Marshal(t); err != nil {
+				return false, err
+			}
+			fmt.Print(change.mark, " ", buf.String())
+		}
+	}
+	return len(added) != 0 || len(removed) != 0, nil
+}
+
+// importGraph loads the graph served at addr into ts, sending header with
+// each request if it is given, and logging the token to resume from if the
+// import stops.
+func importGraph(ts graph.TripleStore, cfg *config.Config, addr, header, resume string) error {
+	if addr == "" {
+		return errors.New("no server to import from, give one with -from")
+	}
+	remote := db.Remote{URL: addr, PageSize: cfg.LoadSize}
+	if header != "" {
+		kv := strings.SplitN(header, ":", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("bad -from_header %q, want \"Name: value\"", header)
+		}
+		remote.Header = client.Header{
+			client.CanonicalHeaderKey(strings.TrimSpace(kv[0])): {strings.TrimSpace(kv[1])},
+		}
+	}
+	resume, err := db.Import(ts, cfg, remote, resume)
+	if err != nil && resume != "" {
+		glog.Errorf("Import stopped, carry on with -resume=%s", resume)
+	}
+	return err
+}
+
+// flushWriter writes to its Writer, and flushes each of its Flushers in
+// turn, from the one written to outwards, so that what a buffer holds is
+// pushed through the gzip.Writer under it as well.
+type flushWriter struct {
+	io.Writer
+	flushers []db.Flusher
+}
+
+func (w flushWriter) Flush() error {
+	for _, f := range w.flushers {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createDump creates the file a dump is written to. It is replaced in
+// tests to fail as a full disk would.
+var createDump = func(path string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
+
+func dump(ts graph.TripleStore, cfg *config.Config, path string, level int) (err error) {
+	var w io.Writer
+	var flushers []db.Flusher
+	if path == "-" {
+		w = os.Stdout
+	} else {
+		var f io.WriteCloser
+		f, err = createDump(path)
+		if err != nil {
+			return fmt.Errorf("could not create file %q: %v", path, err)
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = f
+	}
+
+	if filepath.Ext(path) == ".gz" {
+		var gz *gzip.Writer
+		gz, err = gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := gz.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = gz
+		flushers = append(flushers, gz)
+	}
+
+	bw := bufio.NewWriter(w)
+	flushers = append([]db.Flusher{bw}, flushers...)
+	return db.Dump(ts, cfg, cquads.NewEncoder(bw), flushWriter{Writer: bw, flushers: flushers})
 }
 
 const (
@@ -250,6 +484,13 @@ func decompressor(r io.Reader) (io.Reader, error) {
 	case bytes.Compare(buf[:3], []byte(b2zipMagic)) == 0:
 		return bzip2.NewReader(br), nil
 	default:
+		// Hand back a seekable input, such as a file, unbuffered, so that
+		// a resumed load can seek to where it left off.
+		if s, ok := r.(io.Seeker); ok {
+			if _, err := s.Seek(-int64(br.Buffered()), 1); err == nil {
+				return r, nil
+			}
+		}
 		return br, nil
 	}
 }
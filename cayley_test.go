@@ -15,10 +15,19 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -27,6 +36,8 @@ import (
 	"github.com/google/cayley/config"
 	"github.com/google/cayley/db"
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/quad/cquads"
 	"github.com/google/cayley/query/gremlin"
 )
 
@@ -335,7 +346,7 @@ func TestQueries(t *testing.T) {
 			t.Fatalf("Failed to parse benchmark gremlin %s: %v", test.message, err)
 		}
 		c := make(chan interface{}, 5)
-		go ses.ExecInput(test.query, c, 100)
+		go ses.ExecInput(test.query, c, -1)
 		var (
 			got      [][]interface{}
 			timedOut bool
@@ -378,7 +389,7 @@ func runBench(n int, b *testing.B) {
 		// Do the parsing we know works.
 		ses.InputParses(benchmarkQueries[n].query)
 		b.StartTimer()
-		go ses.ExecInput(benchmarkQueries[n].query, c, 100)
+		go ses.ExecInput(benchmarkQueries[n].query, c, -1)
 		for _ = range c {
 		}
 		b.StopTimer()
@@ -501,3 +512,704 @@ func TestDecompressor(t *testing.T) {
 		}
 	}
 }
+
+var testDumpQuads = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"C", "follows", "B", ""},
+	{"Humphrey Bogart", "name", "/en/humphrey_bogart", ""},
+	{"B", "status", "cool", "status_graph"},
+	{"D", "says", `"hello world"`, "status_graph"},
+}
+
+func quadSet(ts graph.TripleStore) []string {
+	var set []string
+	it := ts.TriplesAllIterator()
+	defer it.Close()
+	for graph.Next(it) {
+		q := ts.Quad(it.Result())
+		if !q.IsValid() {
+			continue
+		}
+		set = append(set, fmt.Sprintf("%q", []string{q.Subject, q.Predicate, q.Object, q.Label}))
+	}
+	sort.Strings(set)
+	return set
+}
+
+func TestDumpRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_dump")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dump.nq.gz")
+
+	cfg := &config.Config{DatabaseType: "memstore", LoadSize: 2}
+
+	src, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open source store: %v", err)
+	}
+	defer src.Close()
+	src.AddTripleSet(testDumpQuads)
+
+	if err := dump(src, cfg, path, gzip.BestCompression); err != nil {
+		t.Fatalf("Failed to dump store: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open dump: %v", err)
+	}
+	magic := make([]byte, 2)
+	_, err = io.ReadFull(f, magic)
+	f.Close()
+	if err != nil || string(magic) != gzipMagic {
+		t.Errorf("Dump is not gzip compressed, got header:%q", magic)
+	}
+
+	dst, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open destination store: %v", err)
+	}
+	defer dst.Close()
+	if err := load(dst, cfg, path, "cquad"); err != nil {
+		t.Fatalf("Failed to load dump: %v", err)
+	}
+
+	got, expect := quadSet(dst), quadSet(src)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected round trip result, got:%v expect:%v", got, expect)
+	}
+}
+
+func TestDumpFlushesGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	bw := bufio.NewWriter(gz)
+	w := flushWriter{Writer: bw, flushers: []db.Flusher{bw, gz}}
+
+	cfg := &config.Config{LoadSize: 1}
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	ts.AddTripleSet(testDumpQuads)
+	if err := db.Dump(ts, cfg, cquads.NewEncoder(bw), w); err != nil {
+		t.Fatalf("Failed to dump store: %v", err)
+	}
+
+	// A dump that is never closed, as one that was stopped, still holds
+	// every triple flushed.
+	r, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to read flushed dump: %v", err)
+	}
+	got, _ := ioutil.ReadAll(r)
+	if lines := strings.Count(string(got), "\n"); lines != len(testDumpQuads) {
+		t.Errorf("Unexpected number of triples in flushed dump, got:%d expect:%d", lines, len(testDumpQuads))
+	}
+}
+
+// fullFile takes every write, but fails to close, as a file on a full disk
+// does once the last of its buffered writes cannot be synced.
+type fullFile struct {
+	bytes.Buffer
+}
+
+func (f *fullFile) Close() error { return errors.New("no space left on device") }
+
+func TestDumpCloseError(t *testing.T) {
+	defer func(c func(string) (io.WriteCloser, error)) { createDump = c }(createDump)
+	createDump = func(string) (io.WriteCloser, error) { return &fullFile{}, nil }
+
+	cfg := &config.Config{LoadSize: 2}
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	ts.AddTripleSet(testDumpQuads)
+	for _, path := range []string{"dump.nq", "dump.nq.gz"} {
+		if err := dump(ts, cfg, path, gzip.DefaultCompression); err == nil {
+			t.Errorf("Unexpected success of a dump to %s that failed to close", path)
+		}
+	}
+}
+
+func TestDumpOversized(t *testing.T) {
+	long := quad.Quad{"alice", "bio", strings.Repeat("é", 40), ""}
+	short := quad.Quad{"alice", "follows", "bob", ""}
+	const max = 40
+
+	tests := []struct {
+		mode   string
+		expect []quad.Quad
+		err    bool
+	}{
+		{mode: "", expect: []quad.Quad{short}},
+		{mode: db.OversizeSkip, expect: []quad.Quad{short}},
+		{mode: db.OversizeTruncate, expect: []quad.Quad{
+			short,
+			{"alice", "bio", strings.Repeat("é", 9) + db.TruncatedMarker, ""},
+		}},
+		{mode: db.OversizeFail, err: true},
+		{mode: "unknown", err: true},
+	}
+
+	for _, test := range tests {
+		cfg := &config.Config{DatabaseType: "memstore", DumpMaxSize: max, DumpOversize: test.mode}
+		ts, err := db.Open(cfg)
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		ts.AddTripleSet([]quad.Quad{long, short})
+
+		var buf bytes.Buffer
+		err = db.Dump(ts, cfg, cquads.NewEncoder(&buf), &buf)
+		ts.Close()
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected %q dump of an oversized triple to fail", test.mode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q dump: %v", test.mode, err)
+			continue
+		}
+
+		var got []string
+		dec := cquads.NewDecoder(&buf)
+		for {
+			q, err := dec.Unmarshal()
+			if err != nil {
+				if err != io.EOF {
+					t.Errorf("Failed to read %q dump: %v", test.mode, err)
+				}
+				break
+			}
+			if size := len(q.Subject) + len(q.Predicate) + len(q.Object) + len(q.Label); size > max {
+				t.Errorf("Unexpected %d byte triple in %q dump", size, test.mode)
+			}
+			got = append(got, fmt.Sprintf("%q", []string{q.Subject, q.Predicate, q.Object, q.Label}))
+		}
+		var expect []string
+		for _, q := range test.expect {
+			expect = append(expect, fmt.Sprintf("%q", []string{q.Subject, q.Predicate, q.Object, q.Label}))
+		}
+		sort.Strings(got)
+		sort.Strings(expect)
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected %q dump, got:%v expect:%v", test.mode, got, expect)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := []quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"bob", "follows", "carol", ""},
+		{"bob", "status", "cool", "status_graph"},
+	}
+	after := []quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"bob", "status", "cool", "status_graph"},
+		{"carol", "follows", "alice", ""},
+		{"alice", "status", "cool", "status_graph"},
+	}
+	expectAdded := []quad.Quad{
+		{"alice", "status", "cool", "status_graph"},
+		{"carol", "follows", "alice", ""},
+	}
+	expectRemoved := []quad.Quad{
+		{"bob", "follows", "carol", ""},
+	}
+
+	open := func(quads []quad.Quad) graph.TripleStore {
+		ts, err := db.Open(&config.Config{DatabaseType: "memstore"})
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		ts.AddTripleSet(quads)
+		return ts
+	}
+	a, b := open(before), open(after)
+	defer a.Close()
+	defer b.Close()
+
+	// A store against another, and against a file of its triples, read
+	// twice over.
+	var file bytes.Buffer
+	enc := cquads.NewEncoder(&file)
+	for _, q := range append(after, after...) {
+		enc.Marshal(q)
+	}
+	for _, test := range []struct {
+		message string
+		other   quad.Unmarshaler
+	}{
+		{message: "store", other: db.NewStoreDecoder(b)},
+		{message: "file", other: cquads.NewDecoder(&file)},
+	} {
+		added, removed, err := db.Diff(db.NewStoreDecoder(a), test.other)
+		if err != nil {
+			t.Fatalf("Unexpected error diffing with a %s: %v", test.message, err)
+		}
+		if !reflect.DeepEqual(added, expectAdded) {
+			t.Errorf("Unexpected added triples diffing with a %s, got:%v expect:%v", test.message, added, expectAdded)
+		}
+		if !reflect.DeepEqual(removed, expectRemoved) {
+			t.Errorf("Unexpected removed triples diffing with a %s, got:%v expect:%v", test.message, removed, expectRemoved)
+		}
+	}
+
+	added, removed, err := db.Diff(db.NewStoreDecoder(a), db.NewStoreDecoder(a))
+	if err != nil || added != nil || removed != nil {
+		t.Errorf("Unexpected diff of a store with itself, got:%v %v %v", added, removed, err)
+	}
+}
+
+func TestLoadLabel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_load")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "people.nt")
+	triples := `<alice> <follows> <bob> .
+<bob> <follows> <carol> .
+<carol> <status> "cool" <status_graph> .
+`
+	if err := ioutil.WriteFile(path, []byte(triples), 0644); err != nil {
+		t.Fatalf("Failed to write triples: %v", err)
+	}
+
+	cfg := &config.Config{DatabaseType: "memstore", LoadSize: 2, LoadLabel: "<people>"}
+	ts, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer ts.Close()
+	if err := load(ts, cfg, path, "nquad"); err != nil {
+		t.Fatalf("Failed to load triples: %v", err)
+	}
+
+	for _, test := range []struct {
+		label  string
+		expect []string
+	}{
+		{label: "<people>", expect: []string{"<alice> <follows> <bob>", "<bob> <follows> <carol>"}},
+		{label: "<status_graph>", expect: []string{`<carol> <status> "cool"`}},
+	} {
+		var got []string
+		it := ts.TripleIterator(quad.Label, ts.ValueOf(test.label))
+		for graph.Next(it) {
+			q := ts.Quad(it.Result())
+			got = append(got, strings.Join([]string{q.Subject, q.Predicate, q.Object}, " "))
+		}
+		it.Close()
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected triples labeled %s, got:%v expect:%v", test.label, got, test.expect)
+		}
+	}
+}
+
+// blockRecorder counts the times each quad is written to it, and sends
+// the size of each block written on blocks, if it is not nil.
+type blockRecorder struct {
+	graph.TripleStore
+	mu      sync.Mutex
+	written map[quad.Quad]int
+	blocks  chan int
+}
+
+func (ts *blockRecorder) AddTripleSet(set []quad.Quad) {
+	ts.mu.Lock()
+	for _, q := range set {
+		ts.written[q]++
+	}
+	ts.mu.Unlock()
+	ts.TripleStore.AddTripleSet(set)
+	if ts.blocks != nil {
+		ts.blocks <- len(set)
+	}
+}
+
+// killedDecoder yields the quads of dec until n have been read, then fails
+// as a load stopped part way through would.
+type killedDecoder struct {
+	dec quad.Unmarshaler
+	n   int
+}
+
+var errKilled = fmt.Errorf("load killed")
+
+func (d *killedDecoder) Unmarshal() (quad.Quad, error) {
+	if d.n == 0 {
+		return quad.Quad{}, errKilled
+	}
+	d.n--
+	return d.dec.Unmarshal()
+}
+
+// positionedKilledDecoder is a killedDecoder that reports the Positions of
+// its cquads decoder.
+type positionedKilledDecoder struct {
+	killedDecoder
+	pos quad.Positioner
+}
+
+func (d *positionedKilledDecoder) Position() quad.Position      { return d.pos.Position() }
+func (d *positionedKilledDecoder) SkipTo(p quad.Position) error { return d.pos.SkipTo(p) }
+
+func TestLoadCheckpoint(t *testing.T) {
+	var (
+		triples bytes.Buffer
+		quads   []quad.Quad
+		offset  int
+	)
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(&triples, "<n%d> <next> <n%d> .\n", i, i+1)
+		quads = append(quads, quad.Quad{Subject: fmt.Sprintf("n%d", i), Predicate: "next", Object: fmt.Sprintf("n%d", i+1)})
+		if i == 11 {
+			offset = triples.Len()
+		}
+	}
+	// decoder returns a decoder of the triples that is killed after n
+	// quads.
+	decoder := func(positions bool, n int) quad.Unmarshaler {
+		dec := cquads.NewDecoder(bytes.NewReader(triples.Bytes()))
+		if positions {
+			return &positionedKilledDecoder{killedDecoder{dec: dec, n: n}, dec}
+		}
+		return &killedDecoder{dec: dec, n: n}
+	}
+
+	cfg := &config.Config{DatabaseType: "memstore", LoadSize: 4}
+	clean, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer clean.Close()
+	if err := db.Load(clean, cfg, decoder(false, -1)); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	for _, test := range []struct {
+		message    string
+		positions  bool
+		checkpoint string
+	}{
+		{
+			message:    "decoder without positions",
+			checkpoint: "12 0 0\n",
+		},
+		{
+			message:    "decoder with positions",
+			positions:  true,
+			checkpoint: fmt.Sprintf("12 12 %d\n", offset),
+		},
+	} {
+		dir, err := ioutil.TempDir("", "cayley_load")
+		if err != nil {
+			t.Fatalf("Failed to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		checkpoint := filepath.Join(dir, "load.checkpoint")
+		cfg := &config.Config{DatabaseType: "memstore", LoadSize: 4, LoadCheckpoint: checkpoint}
+		mem, err := db.Open(cfg)
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		defer mem.Close()
+		ts := &blockRecorder{TripleStore: mem, written: make(map[quad.Quad]int)}
+
+		// The load dies after 14 quads, of which three blocks were written.
+		if err := db.Load(ts, cfg, decoder(test.positions, 14)); err != errKilled {
+			t.Fatalf("Unexpected error from killed load with %s, got:%v expect:%v", test.message, err, errKilled)
+		}
+		b, err := ioutil.ReadFile(checkpoint)
+		if err != nil || string(b) != test.checkpoint {
+			t.Fatalf("Unexpected checkpoint after killed load with %s, got:%q, %v expect:%q", test.message, b, err, test.checkpoint)
+		}
+		// Some of the next block was written before the load died.
+		mem.AddTripleSet(quads[12:14])
+
+		// The load is run again over the same quads.
+		if err := db.Load(ts, cfg, decoder(test.positions, -1)); err != nil {
+			t.Fatalf("Failed to resume load with %s: %v", test.message, err)
+		}
+		for i, q := range quads {
+			expect := 1
+			if i == 12 || i == 13 {
+				expect = 0
+			}
+			if n := ts.written[q]; n != expect {
+				t.Errorf("Unexpected writes of %v with %s, got:%d expect:%d", q, test.message, n, expect)
+			}
+		}
+		if mem.Size() != clean.Size() {
+			t.Errorf("Unexpected size of resumed load with %s, got:%d expect:%d", test.message, mem.Size(), clean.Size())
+		}
+		for _, q := range quads {
+			if ok, _ := mem.QuadExists(q); !ok {
+				t.Errorf("Quad %v missing from resumed load with %s", q, test.message)
+			}
+		}
+		if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+			t.Errorf("Checkpoint not removed after load with %s: %v", test.message, err)
+		}
+	}
+}
+
+// stalledDecoder yields the quads of dec until n have been read, then
+// waits until resume is closed before yielding the rest, as a slow stream
+// would. It closes stalled, if it is not nil, once it starts waiting.
+type stalledDecoder struct {
+	dec     quad.Unmarshaler
+	n       int
+	resume  chan struct{}
+	stalled chan struct{}
+}
+
+func (d *stalledDecoder) Unmarshal() (quad.Quad, error) {
+	if d.n == 0 {
+		if d.stalled != nil {
+			close(d.stalled)
+		}
+		<-d.resume
+	}
+	d.n--
+	return d.dec.Unmarshal()
+}
+
+func TestLoadFlushInterval(t *testing.T) {
+	cfg := &config.Config{DatabaseType: "memstore", LoadSize: 100, LoadFlush: 10 * time.Millisecond}
+	mem, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer mem.Close()
+	ts := &blockRecorder{TripleStore: mem, written: make(map[quad.Quad]int), blocks: make(chan int, 10)}
+	triples := "<a> <next> <b> .\n<b> <next> <c> .\n<c> <next> <d> .\n<d> <next> <e> .\n"
+	dec := &stalledDecoder{dec: cquads.NewDecoder(strings.NewReader(triples)), n: 3, resume: make(chan struct{})}
+
+	done := make(chan error)
+	go func() { done <- db.Load(ts, cfg, dec) }()
+	select {
+	case n := <-ts.blocks:
+		if n != 3 {
+			t.Errorf("Unexpected size of block flushed while the stream stalled, got:%d expect:3", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Block not flushed while the stream stalled")
+	}
+	close(dec.resume)
+	if err := <-done; err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if mem.Size() != 4 {
+		t.Errorf("Unexpected number of quads loaded, got:%d expect:4", mem.Size())
+	}
+}
+
+func TestLoadShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_load")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	checkpoint := filepath.Join(dir, "load.checkpoint")
+	cfg := &config.Config{DatabaseType: "memstore", LoadSize: 100, LoadCheckpoint: checkpoint}
+	ts, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer ts.Close()
+	triples := "<a> <next> <b> .\n<b> <next> <c> .\n<c> <next> <d> .\n<d> <next> <e> .\n"
+	stalled := make(chan struct{})
+	dec := &stalledDecoder{dec: cquads.NewDecoder(strings.NewReader(triples)), n: 3, resume: make(chan struct{}), stalled: stalled}
+	defer close(dec.resume)
+
+	// The process is asked to stop while the load has three quads of its
+	// first block buffered.
+	done := make(chan error)
+	go func() { done <- db.Load(ts, cfg, dec) }()
+	<-stalled
+	if !db.Shutdown(5 * time.Second) {
+		t.Fatal("Load not stopped before the shutdown timeout")
+	}
+	if err := <-done; err != db.ErrShutdown {
+		t.Errorf("Unexpected error from stopped load, got:%v expect:%v", err, db.ErrShutdown)
+	}
+	if ts.Size() != 3 {
+		t.Errorf("Unexpected number of buffered quads written, got:%d expect:3", ts.Size())
+	}
+	b, err := ioutil.ReadFile(checkpoint)
+	if err != nil || string(b) != "3 0 0\n" {
+		t.Errorf("Unexpected checkpoint after stopped load, got:%q, %v expect:%q", b, err, "3 0 0\n")
+	}
+
+	// Loads started after the shutdown are not stopped, so the load can
+	// be resumed.
+	if err := db.Load(ts, cfg, cquads.NewDecoder(strings.NewReader(triples))); err != nil {
+		t.Fatalf("Failed to resume load: %v", err)
+	}
+	if ts.Size() != 4 {
+		t.Errorf("Unexpected number of quads after resumed load, got:%d expect:4", ts.Size())
+	}
+}
+
+// endlessDecoder yields quads without end, as a stream that is never
+// closed would.
+type endlessDecoder struct {
+	n int
+}
+
+func (d *endlessDecoder) Unmarshal() (quad.Quad, error) {
+	d.n++
+	return quad.Quad{"a", "next", fmt.Sprint("b", d.n), ""}, nil
+}
+
+func TestLoadStopsReading(t *testing.T) {
+	// The checkpoint cannot be written, so the load fails after its first
+	// block, with quads still to read.
+	cfg := &config.Config{DatabaseType: "memstore", LoadSize: 2, LoadCheckpoint: filepath.Join(os.TempDir(), "cayley_missing", "load.checkpoint")}
+	ts, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer ts.Close()
+
+	before := runtime.NumGoroutine()
+	if err := db.Load(ts, cfg, &endlessDecoder{}); err == nil {
+		t.Fatal("Unexpected success of a load that cannot write its checkpoint")
+	}
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Load left its reader running, got:%d goroutines expect:%d", runtime.NumGoroutine(), before)
+		}
+	}
+}
+
+func TestLoadStableBlanks(t *testing.T) {
+	// The same structure, with its blank nodes labelled differently, as
+	// two exports of one document would be.
+	first := `_:a <name> "Alice" .
+_:a <knows> _:b .
+_:b <name> "Bob" .
+_:b <address> _:c .
+_:c <city> "Paris" .
+`
+	second := `_:x9 <address> _:x2 .
+_:x2 <city> "Paris" .
+_:x1 <knows> _:x9 .
+_:x9 <name> "Bob" .
+_:x1 <name> "Alice" .
+`
+	cfg := &config.Config{DatabaseType: "memstore", LoadSize: 2, LoadStableBlanks: true}
+	ts, err := db.Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer ts.Close()
+	nodes := func() int {
+		it := ts.NodesAllIterator()
+		defer it.Close()
+		var n int
+		for graph.Next(it) {
+			n++
+		}
+		return n
+	}
+
+	if err := db.Load(ts, cfg, cquads.NewDecoder(strings.NewReader(first))); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	size, n := ts.Size(), nodes()
+	for _, doc := range []string{first, second} {
+		if err := db.Load(ts, cfg, cquads.NewDecoder(strings.NewReader(doc))); err != nil {
+			t.Fatalf("Failed to load again: %v", err)
+		}
+		if ts.Size() != size || nodes() != n {
+			t.Errorf("Unexpected duplication on loading again, got:%d quads %d nodes expect:%d quads %d nodes", ts.Size(), nodes(), size, n)
+		}
+	}
+
+	// A different structure gives different blank nodes.
+	if err := db.Load(ts, cfg, cquads.NewDecoder(strings.NewReader(`_:a <name> "Alice" .`+"\n"))); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if ts.Size() != size+1 {
+		t.Errorf("Unexpected size after loading a different blank node, got:%d expect:%d", ts.Size(), size+1)
+	}
+}
+
+func TestCheckDuplicates(t *testing.T) {
+	triples := `<a> <follows> <b> .
+<b> <follows> <c> .
+# A comment.
+<a> <follows> <b> .
+<c> <follows> <a> .
+<b> <follows> <c> .
+<a> <follows> <b> .
+<c> <follows> <a> <l> .
+`
+	for _, test := range []struct {
+		max       int
+		expect    []db.Duplicate
+		unchecked int64
+	}{
+		{
+			max: 100,
+			expect: []db.Duplicate{
+				{Quad: quad.Quad{"a", "follows", "b", ""}, Where: 4, First: 1},
+				{Quad: quad.Quad{"b", "follows", "c", ""}, Where: 6, First: 2},
+				{Quad: quad.Quad{"a", "follows", "b", ""}, Where: 7, First: 1},
+			},
+		},
+		{
+			// Only the first two quads are remembered.
+			max: 2,
+			expect: []db.Duplicate{
+				{Quad: quad.Quad{"a", "follows", "b", ""}, Where: 4, First: 1},
+				{Quad: quad.Quad{"b", "follows", "c", ""}, Where: 6, First: 2},
+				{Quad: quad.Quad{"a", "follows", "b", ""}, Where: 7, First: 1},
+			},
+			unchecked: 2,
+		},
+		{
+			// The first quad takes the only place, so its duplicates
+			// are all that are found.
+			max: 1,
+			expect: []db.Duplicate{
+				{Quad: quad.Quad{"a", "follows", "b", ""}, Where: 4, First: 1},
+				{Quad: quad.Quad{"a", "follows", "b", ""}, Where: 7, First: 1},
+			},
+			unchecked: 4,
+		},
+	} {
+		var got []db.Duplicate
+		c := db.CheckDuplicates(cquads.NewDecoder(strings.NewReader(triples)), test.max, func(d db.Duplicate) {
+			got = append(got, d)
+		})
+		var n int
+		for {
+			_, err := c.Unmarshal()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			n++
+		}
+		if n != 7 || c.Read != 7 {
+			t.Errorf("Unexpected number of quads read remembering %d, got:%d counted:%d expect:7", test.max, n, c.Read)
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected duplicates remembering %d, got:%v expect:%v", test.max, got, test.expect)
+		}
+		if c.Found != int64(len(test.expect)) || c.Unchecked != test.unchecked {
+			t.Errorf("Unexpected summary remembering %d, got:%d found %d unchecked expect:%d found %d unchecked",
+				test.max, c.Found, c.Unchecked, len(test.expect), test.unchecked)
+		}
+	}
+}
@@ -26,25 +26,51 @@ import (
 )
 
 type Config struct {
-	DatabaseType    string
-	DatabasePath    string
-	DatabaseOptions map[string]interface{}
-	ListenHost      string
-	ListenPort      string
-	ReadOnly        bool
-	Timeout         time.Duration
-	LoadSize        int
+	DatabaseType        string
+	DatabasePath        string
+	DatabaseOptions     map[string]interface{}
+	ListenHost          string
+	ListenPort          string
+	ReadOnly            bool
+	Timeout             time.Duration
+	SlowQuery           time.Duration
+	LoadSize            int
+	LoadLabel           string
+	LoadStableBlanks    bool
+	LoadCheckDuplicates int
+	LoadFlush           time.Duration
+	LoadCheckpoint      string
+	ShutdownTimeout     time.Duration
+	MaxResults          int
+	PinnedNodes         []string
+	DumpMaxSize         int
+	DumpOversize        string
+	LabelACL            map[string][]string
+	ACLHeader           string
 }
 
 type config struct {
-	DatabaseType    string                 `json:"database"`
-	DatabasePath    string                 `json:"db_path"`
-	DatabaseOptions map[string]interface{} `json:"db_options"`
-	ListenHost      string                 `json:"listen_host"`
-	ListenPort      string                 `json:"listen_port"`
-	ReadOnly        bool                   `json:"read_only"`
-	Timeout         duration               `json:"timeout"`
-	LoadSize        int                    `json:"load_size"`
+	DatabaseType        string                 `json:"database"`
+	DatabasePath        string                 `json:"db_path"`
+	DatabaseOptions     map[string]interface{} `json:"db_options"`
+	ListenHost          string                 `json:"listen_host"`
+	ListenPort          string                 `json:"listen_port"`
+	ReadOnly            bool                   `json:"read_only"`
+	Timeout             duration               `json:"timeout"`
+	SlowQuery           duration               `json:"slow_query_threshold"`
+	LoadSize            int                    `json:"load_size"`
+	LoadLabel           string                 `json:"load_label"`
+	LoadStableBlanks    bool                   `json:"load_stable_blanks"`
+	LoadCheckDuplicates int                    `json:"load_check_duplicates"`
+	LoadFlush           duration               `json:"load_flush_interval"`
+	LoadCheckpoint      string                 `json:"load_checkpoint"`
+	ShutdownTimeout     duration               `json:"shutdown_timeout"`
+	MaxResults          int                    `json:"max_results"`
+	PinnedNodes         []string               `json:"pinned_nodes"`
+	DumpMaxSize         int                    `json:"dump_max_size"`
+	DumpOversize        string                 `json:"dump_oversize"`
+	LabelACL            map[string][]string    `json:"label_acl"`
+	ACLHeader           string                 `json:"acl_header"`
 }
 
 func (c *Config) UnmarshalJSON(data []byte) error {
@@ -54,28 +80,54 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	*c = Config{
-		DatabaseType:    t.DatabaseType,
-		DatabasePath:    t.DatabasePath,
-		DatabaseOptions: t.DatabaseOptions,
-		ListenHost:      t.ListenHost,
-		ListenPort:      t.ListenPort,
-		ReadOnly:        t.ReadOnly,
-		Timeout:         time.Duration(t.Timeout),
-		LoadSize:        t.LoadSize,
+		DatabaseType:        t.DatabaseType,
+		DatabasePath:        t.DatabasePath,
+		DatabaseOptions:     t.DatabaseOptions,
+		ListenHost:          t.ListenHost,
+		ListenPort:          t.ListenPort,
+		ReadOnly:            t.ReadOnly,
+		Timeout:             time.Duration(t.Timeout),
+		SlowQuery:           time.Duration(t.SlowQuery),
+		LoadSize:            t.LoadSize,
+		LoadLabel:           t.LoadLabel,
+		LoadStableBlanks:    t.LoadStableBlanks,
+		LoadCheckDuplicates: t.LoadCheckDuplicates,
+		LoadFlush:           time.Duration(t.LoadFlush),
+		LoadCheckpoint:      t.LoadCheckpoint,
+		ShutdownTimeout:     time.Duration(t.ShutdownTimeout),
+		MaxResults:          t.MaxResults,
+		PinnedNodes:         t.PinnedNodes,
+		DumpMaxSize:         t.DumpMaxSize,
+		DumpOversize:        t.DumpOversize,
+		LabelACL:            t.LabelACL,
+		ACLHeader:           t.ACLHeader,
 	}
 	return nil
 }
 
 func (c *Config) MarshalJSON() ([]byte, error) {
 	return json.Marshal(config{
-		DatabaseType:    c.DatabaseType,
-		DatabasePath:    c.DatabasePath,
-		DatabaseOptions: c.DatabaseOptions,
-		ListenHost:      c.ListenHost,
-		ListenPort:      c.ListenPort,
-		ReadOnly:        c.ReadOnly,
-		Timeout:         duration(c.Timeout),
-		LoadSize:        c.LoadSize,
+		DatabaseType:        c.DatabaseType,
+		DatabasePath:        c.DatabasePath,
+		DatabaseOptions:     c.DatabaseOptions,
+		ListenHost:          c.ListenHost,
+		ListenPort:          c.ListenPort,
+		ReadOnly:            c.ReadOnly,
+		Timeout:             duration(c.Timeout),
+		SlowQuery:           duration(c.SlowQuery),
+		LoadSize:            c.LoadSize,
+		LoadLabel:           c.LoadLabel,
+		LoadStableBlanks:    c.LoadStableBlanks,
+		LoadCheckDuplicates: c.LoadCheckDuplicates,
+		LoadFlush:           duration(c.LoadFlush),
+		LoadCheckpoint:      c.LoadCheckpoint,
+		ShutdownTimeout:     duration(c.ShutdownTimeout),
+		MaxResults:          c.MaxResults,
+		PinnedNodes:         c.PinnedNodes,
+		DumpMaxSize:         c.DumpMaxSize,
+		DumpOversize:        c.DumpOversize,
+		LabelACL:            c.LabelACL,
+		ACLHeader:           c.ACLHeader,
 	})
 }
 
@@ -84,9 +136,9 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 type duration time.Duration
 
 // UnmarshalJSON unmarshals a duration according to the following scheme:
-//  * If the element is absent the duration is zero.
-//  * If the element is parsable as a time.Duration, the parsed value is kept.
-//  * If the element is parsable as a number, that number of seconds is kept.
+//   - If the element is absent the duration is zero.
+//   - If the element is parsable as a time.Duration, the parsed value is kept.
+//   - If the element is parsable as a number, that number of seconds is kept.
 func (d *duration) UnmarshalJSON(data []byte) error {
 	if len(data) == 0 {
 		*d = 0
@@ -115,13 +167,23 @@ func (d *duration) MarshalJSON() ([]byte, error) {
 }
 
 var (
-	databasePath    = flag.String("dbpath", "/tmp/testdb", "Path to the database.")
-	databaseBackend = flag.String("db", "memstore", "Database Backend.")
-	host            = flag.String("host", "0.0.0.0", "Host to listen on (defaults to all).")
-	loadSize        = flag.Int("load_size", 10000, "Size of triplesets to load")
-	port            = flag.String("port", "64210", "Port to listen on.")
-	readOnly        = flag.Bool("read_only", false, "Disable writing via HTTP.")
-	timeout         = flag.Duration("timeout", 30*time.Second, "Elapsed time until an individual query times out.")
+	databasePath        = flag.String("dbpath", "/tmp/testdb", "Path to the database.")
+	databaseBackend     = flag.String("db", "memstore", "Database Backend.")
+	dumpMaxSize         = flag.Int("dump_max_size", 0, "Largest triple, in bytes, that a dump writes whole (0 for no limit).")
+	dumpOversize        = flag.String("dump_oversize", "skip", `What a dump does with larger triples: "skip", "truncate" or "fail".`)
+	host                = flag.String("host", "0.0.0.0", "Host to listen on (defaults to all).")
+	loadCheckpoint      = flag.String("load_checkpoint", "", "File recording the progress of a load, to resume it from.")
+	loadFlush           = flag.Duration("load_flush_interval", 0, "Longest time a load buffers triples before writing them (0 for no limit).")
+	loadLabel           = flag.String("load_label", "", "Label to give loaded quads that have none.")
+	loadCheckDuplicates = flag.Int("load_check_duplicates", 0, "Log the quads a load reads more than once, remembering at most this many quads (0 for no check).")
+	loadStableBlanks    = flag.Bool("load_stable_blanks", false, "Label loaded blank nodes by the quads around them, so that loading a document again merges its blank nodes.")
+	loadSize            = flag.Int("load_size", 10000, "Size of triplesets to load")
+	maxResults          = flag.Int("max_results", 0, "Maximum number of results an HTTP query returns (0 for no maximum).")
+	port                = flag.String("port", "64210", "Port to listen on.")
+	readOnly            = flag.Bool("read_only", false, "Disable writing via HTTP.")
+	shutdownTimeout     = flag.Duration("shutdown_timeout", 10*time.Second, "Longest time to wait on a signal to stop for loads to write the triples they have buffered.")
+	slowQuery           = flag.Duration("slow_query_threshold", 0, "Elapsed time after which a query is logged as slow (0 to log none).")
+	timeout             = flag.Duration("timeout", 30*time.Second, "Elapsed time until an individual query times out.")
 )
 
 func ParseConfigFromFile(filename string) *Config {
@@ -187,10 +249,48 @@ func ParseConfigFromFlagsAndFile(fileFlag string) *Config {
 		config.Timeout = *timeout
 	}
 
+	if config.SlowQuery == 0 {
+		config.SlowQuery = *slowQuery
+	}
+
 	if config.LoadSize == 0 {
 		config.LoadSize = *loadSize
 	}
 
+	if config.LoadLabel == "" {
+		config.LoadLabel = *loadLabel
+	}
+
+	if config.LoadFlush == 0 {
+		config.LoadFlush = *loadFlush
+	}
+
+	if config.LoadCheckpoint == "" {
+		config.LoadCheckpoint = *loadCheckpoint
+	}
+
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = *shutdownTimeout
+	}
+
+	if config.MaxResults == 0 {
+		config.MaxResults = *maxResults
+	}
+
+	if config.DumpMaxSize == 0 {
+		config.DumpMaxSize = *dumpMaxSize
+	}
+
+	if config.DumpOversize == "" {
+		config.DumpOversize = *dumpOversize
+	}
+
+	config.LoadStableBlanks = config.LoadStableBlanks || *loadStableBlanks
+
+	if config.LoadCheckDuplicates == 0 {
+		config.LoadCheckDuplicates = *loadCheckDuplicates
+	}
+
 	config.ReadOnly = config.ReadOnly || *readOnly
 
 	return config
@@ -0,0 +1,158 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/cayley/quad"
+)
+
+// stableBlanks gives the blank nodes of the quads of an Unmarshaler labels
+// made from the quads around them, rather than the labels of the document.
+type stableBlanks struct {
+	dec   quad.Unmarshaler
+	read  bool
+	quads []quad.Quad
+	err   error
+}
+
+// WithStableBlanks returns an Unmarshaler of the quads of dec, with each
+// blank node relabelled by a hash of the quads it is in, and, in turn, of
+// the hashes of the blank nodes they link it to. A document loaded twice,
+// or loaded again with its blank nodes labelled afresh, then gives its
+// blank nodes the same labels each time, so that the second load merges
+// with the first rather than adding to it. Blank nodes that no quad tells
+// apart, such as two with the same single quad, are merged into one.
+//
+// The whole of dec is read, and held, before the first quad is returned,
+// so that every quad of a blank node is known before it is labelled.
+func WithStableBlanks(dec quad.Unmarshaler) quad.Unmarshaler {
+	return &stableBlanks{dec: dec}
+}
+
+func (s *stableBlanks) Unmarshal() (quad.Quad, error) {
+	if !s.read {
+		s.read = true
+		for {
+			q, err := s.dec.Unmarshal()
+			if err != nil {
+				s.err = err
+				break
+			}
+			s.quads = append(s.quads, q)
+		}
+		if s.err != io.EOF {
+			s.quads = nil
+			return quad.Quad{}, s.err
+		}
+		relabel(s.quads, canonicalBlanks(s.quads))
+	}
+	if len(s.quads) == 0 {
+		return quad.Quad{}, s.err
+	}
+	q := s.quads[0]
+	s.quads = s.quads[1:]
+	return q, nil
+}
+
+// canonicalBlanks returns the stable label of each blank node of quads.
+// Each blank node is first hashed from the quads it is in, with the blank
+// nodes beside it left anonymous, and each round then hashes it again with
+// those nodes given the hashes of the round before, until a round tells no
+// more of them apart.
+func canonicalBlanks(quads []quad.Quad) map[string]string {
+	in := make(map[string][]int)
+	for i, q := range quads {
+		for d := quad.Subject; d <= quad.Label; d++ {
+			if t := q.Get(d); quad.KindOf(t) == quad.Blank {
+				in[t] = append(in[t], i)
+			}
+		}
+	}
+	if len(in) == 0 {
+		return nil
+	}
+	hashes := make(map[string]string, len(in))
+	for b := range in {
+		hashes[b] = ""
+	}
+	distinct := 1
+	for round := 0; round < len(in); round++ {
+		next := make(map[string]string, len(in))
+		seen := make(map[string]bool)
+		for b, idx := range in {
+			sigs := make([]string, 0, len(idx))
+			for _, i := range idx {
+				sigs = append(sigs, signature(quads[i], b, hashes))
+			}
+			sort.Strings(sigs)
+			h := sha1.New()
+			io.WriteString(h, hashes[b])
+			for _, sig := range sigs {
+				io.WriteString(h, "\n"+sig)
+			}
+			next[b] = hex.EncodeToString(h.Sum(nil))
+			seen[next[b]] = true
+		}
+		hashes = next
+		if len(seen) == distinct && round > 0 {
+			break
+		}
+		distinct = len(seen)
+	}
+	labels := make(map[string]string, len(hashes))
+	for b, h := range hashes {
+		labels[b] = "_:b" + h
+	}
+	return labels
+}
+
+// signature writes out q as seen from the blank node b, which is marked
+// as itself, with the other blank nodes of q standing for their hashes.
+func signature(q quad.Quad, b string, hashes map[string]string) string {
+	terms := make([]string, 0, 4)
+	for d := quad.Subject; d <= quad.Label; d++ {
+		t := q.Get(d)
+		switch {
+		case t == b:
+			t = "_:*"
+		case quad.KindOf(t) == quad.Blank:
+			t = "_:" + hashes[t]
+		}
+		terms = append(terms, strconv.Quote(t))
+	}
+	return strings.Join(terms, " ")
+}
+
+// relabel gives the blank nodes of quads their labels.
+func relabel(quads []quad.Quad, labels map[string]string) {
+	if labels == nil {
+		return
+	}
+	for i := range quads {
+		q := &quads[i]
+		for _, t := range []*string{&q.Subject, &q.Predicate, &q.Object, &q.Label} {
+			if l, ok := labels[*t]; ok {
+				*t = l
+			}
+		}
+	}
+}
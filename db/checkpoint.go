@@ -0,0 +1,71 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/cayley/quad"
+)
+
+// checkpoint is the progress of a load: the number of quads written, and
+// the Position of the decoder after them, if it has one.
+type checkpoint struct {
+	Quads int64
+	quad.Position
+}
+
+// readCheckpoint returns the progress recorded in the checkpoint file at
+// path, or no progress if there is no such file.
+func readCheckpoint(path string) (checkpoint, error) {
+	var cp checkpoint
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	_, err = fmt.Sscanf(string(b), "%d %d %d\n", &cp.Quads, &cp.Line, &cp.Offset)
+	if err != nil || cp.Quads < 0 || cp.Line < 0 || cp.Offset < 0 {
+		return checkpoint{}, fmt.Errorf("db: malformed load checkpoint %s: %q", path, b)
+	}
+	return cp, nil
+}
+
+// writeCheckpoint records cp in the checkpoint file at path. It is synced
+// to a file beside it, which then replaces the checkpoint, so that a crash
+// leaves either the old progress or the new.
+func writeCheckpoint(path string, cp checkpoint) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%d %d %d\n", cp.Quads, cp.Line, cp.Offset)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -18,6 +18,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"time"
+	"unicode/utf8"
 
 	"github.com/barakmich/glog"
 
@@ -38,7 +41,16 @@ func Init(cfg *config.Config) error {
 
 func Open(cfg *config.Config) (graph.TripleStore, error) {
 	glog.Infof("Opening database %q at %s", cfg.DatabaseType, cfg.DatabasePath)
-	ts, err := graph.NewTripleStore(cfg.DatabaseType, cfg.DatabasePath, cfg.DatabaseOptions)
+	opts := cfg.DatabaseOptions
+	if cfg.ReadOnly {
+		// Let the backend know, so that it may connect accordingly.
+		opts = make(graph.Options, len(cfg.DatabaseOptions)+1)
+		for k, v := range cfg.DatabaseOptions {
+			opts[k] = v
+		}
+		opts["read_only"] = true
+	}
+	ts, err := graph.NewTripleStore(cfg.DatabaseType, cfg.DatabasePath, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -46,9 +58,73 @@ func Open(cfg *config.Config) (graph.TripleStore, error) {
 	return ts, nil
 }
 
+// labeler gives the quads of an Unmarshaler that have no label a default
+// one.
+type labeler struct {
+	dec   quad.Unmarshaler
+	label string
+}
+
+func (l labeler) Unmarshal() (quad.Quad, error) {
+	q, err := l.dec.Unmarshal()
+	if err == nil && q.Label == "" {
+		q.Label = l.label
+	}
+	return q, err
+}
+
+// WithLabel returns an Unmarshaler of the quads of dec, with those that have
+// no label, such as the triples of an N-Triples file, given label. If label
+// is empty, dec is returned as it is.
+func WithLabel(dec quad.Unmarshaler, label string) quad.Unmarshaler {
+	if label == "" {
+		return dec
+	}
+	return labeler{dec: dec, label: label}
+}
+
+// Load writes the quads of dec to ts, giving those that have no label
+// cfg.LoadLabel, and, if cfg.LoadStableBlanks is set, giving blank nodes
+// the labels of WithStableBlanks. If cfg.LoadCheckDuplicates is set, the
+// quads of dec read more than once are logged with a summary, remembering
+// at most cfg.LoadCheckDuplicates quads, as CheckDuplicates does. Quads are
+// written in blocks of cfg.LoadSize, and, if cfg.LoadFlush is set, a block
+// is written once it has been buffered for that long, even if it is not
+// full.
+//
+// If cfg.LoadCheckpoint is set, the number of quads written, and the line
+// and byte offset of dec after them if it is a quad.Positioner, are
+// recorded in that file after each block. A load that finds the file
+// carries on where a load of the same quads that was stopped left off,
+// skipping dec to the recorded offset, or past the recorded number of quads
+// if it has no Position. The first block written then leaves out the quads
+// that ts already has, as some of them may have been written before the
+// stop. The file is removed once the load is done. Stores that bulk load
+// are then loaded block by block, as a bulk load cannot be resumed.
+//
+// A load stopped by Shutdown writes the block it has buffered, and records
+// it in the checkpoint, before returning ErrShutdown.
 func Load(ts graph.TripleStore, cfg *config.Config, dec quad.Unmarshaler) error {
+	if graph.IsReadOnly(ts) {
+		return graph.ErrReadOnly
+	}
+	g := startLoad()
+	defer g.wg.Done()
+	positioner, _ := dec.(quad.Positioner)
+	if cfg.LoadCheckDuplicates > 0 {
+		dups := CheckDuplicates(dec, cfg.LoadCheckDuplicates, logDuplicate)
+		defer logDuplicates(dups)
+		dec = dups
+	}
+	dec = WithLabel(dec, cfg.LoadLabel)
+	if cfg.LoadStableBlanks {
+		dec = WithStableBlanks(dec)
+		// The decoder has been read to the end before the first quad is
+		// written, so a resumed load counts its way past the quads.
+		positioner = nil
+	}
 	bulker, canBulk := ts.(graph.BulkLoader)
-	if canBulk {
+	if canBulk && cfg.LoadCheckpoint == "" {
 		switch err := bulker.BulkLoad(dec); err {
 		case nil:
 			return nil
@@ -59,22 +135,255 @@ func Load(ts graph.TripleStore, cfg *config.Config, dec quad.Unmarshaler) error
 		}
 	}
 
+	var (
+		done checkpoint
+		skip int64
+	)
+	if cfg.LoadCheckpoint != "" {
+		var err error
+		done, err = readCheckpoint(cfg.LoadCheckpoint)
+		if err != nil {
+			return err
+		}
+		skip = done.Quads
+		if positioner != nil && done.Offset > 0 {
+			glog.Infof("Resuming load after %d quads, at line %d", done.Quads, done.Line)
+			if err := positioner.SkipTo(done.Position); err != nil {
+				return err
+			}
+			skip = 0
+		} else if done.Quads > 0 {
+			glog.Infof("Resuming load after %d quads", done.Quads)
+		}
+	}
+	resumed := done.Quads > 0
+
+	quit := make(chan struct{})
+	defer close(quit)
+	quads, errc := readQuads(dec, positioner, skip, quit)
+	var flush <-chan time.Time
+	if cfg.LoadFlush > 0 {
+		ticker := time.NewTicker(cfg.LoadFlush)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
 	block := make([]quad.Quad, 0, cfg.LoadSize)
+	write := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		set := block
+		if resumed {
+			var err error
+			set, err = missing(ts, block)
+			if err != nil {
+				return err
+			}
+			resumed = false
+		}
+		ts.AddTripleSet(set)
+		done.Quads += int64(len(block))
+		block = block[:0]
+		if cfg.LoadCheckpoint == "" {
+			return nil
+		}
+		return writeCheckpoint(cfg.LoadCheckpoint, done)
+	}
 	for {
-		t, err := dec.Unmarshal()
+		select {
+		case t, ok := <-quads:
+			if !ok {
+				if err := <-errc; err != io.EOF {
+					return err
+				}
+				if err := write(); err != nil {
+					return err
+				}
+				if cfg.LoadCheckpoint != "" {
+					return os.Remove(cfg.LoadCheckpoint)
+				}
+				return nil
+			}
+			block = append(block, t.Quad)
+			done.Position = t.pos
+			if len(block) == cap(block) {
+				if err := write(); err != nil {
+					return err
+				}
+			}
+		case <-flush:
+			if err := write(); err != nil {
+				return err
+			}
+		case <-g.stop:
+			// The quad read last may be waiting to be taken.
+			select {
+			case t, ok := <-quads:
+				if ok {
+					block = append(block, t.Quad)
+					done.Position = t.pos
+				}
+			default:
+			}
+			if err := write(); err != nil {
+				return err
+			}
+			return ErrShutdown
+		}
+	}
+}
+
+// positioned is a quad read for loading, with the Position of its
+// decoder after it.
+type positioned struct {
+	quad.Quad
+	pos quad.Position
+}
+
+// readQuads sends the quads of dec after the first skip on the returned
+// channel, with the Positions of p after them if p is not nil. The channel
+// is closed at the end of dec or on its first error. The error, io.EOF at
+// the end, is then sent on the error channel. Reading stops once quit is
+// closed, so that a load that returns early leaves nothing waiting to send.
+func readQuads(dec quad.Unmarshaler, p quad.Positioner, skip int64, quit <-chan struct{}) (<-chan positioned, <-chan error) {
+	quads := make(chan positioned, 1)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(quads)
+		for n := int64(0); ; n++ {
+			t, err := dec.Unmarshal()
+			if err != nil {
+				errc <- err
+				return
+			}
+			if n < skip {
+				continue
+			}
+			q := positioned{Quad: t}
+			if p != nil {
+				q.pos = p.Position()
+			}
+			select {
+			case quads <- q:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return quads, errc
+}
+
+// missing returns the quads of set that ts does not have.
+func missing(ts graph.TripleStore, set []quad.Quad) ([]quad.Quad, error) {
+	var out []quad.Quad
+	for _, q := range set {
+		ok, err := ts.QuadExists(q)
 		if err != nil {
-			if err == io.EOF {
-				break
+			return nil, err
+		}
+		if !ok {
+			out = append(out, q)
+		}
+	}
+	return out, nil
+}
+
+// Flusher is implemented by writers that buffer their output, such as
+// bufio.Writer and gzip.Writer.
+type Flusher interface {
+	Flush() error
+}
+
+// What Dump does with a triple larger than cfg.DumpMaxSize.
+const (
+	// OversizeSkip leaves the triple out, with a warning.
+	OversizeSkip = "skip"
+
+	// OversizeTruncate cuts the triple's object short to fit, ending it
+	// with TruncatedMarker.
+	OversizeTruncate = "truncate"
+
+	// OversizeFail stops the dump with an error.
+	OversizeFail = "fail"
+)
+
+// TruncatedMarker ends the object of a triple that a dump cut short.
+const TruncatedMarker = "...[truncated]"
+
+// quadSize returns the size of t's nodes, in bytes.
+func quadSize(t quad.Quad) int {
+	return len(t.Subject) + len(t.Predicate) + len(t.Object) + len(t.Label)
+}
+
+// truncate cuts the object of t short, at a character boundary, so that t
+// with TruncatedMarker is at most max bytes. It returns false if the other
+// nodes of t leave no room for any of the object.
+func truncate(t quad.Quad, max int) (quad.Quad, bool) {
+	room := max - (quadSize(t) - len(t.Object)) - len(TruncatedMarker)
+	if room <= 0 {
+		return t, false
+	}
+	for room > 0 && !utf8.RuneStart(t.Object[room]) {
+		room--
+	}
+	t.Object = t.Object[:room] + TruncatedMarker
+	return t, true
+}
+
+// Dump writes every triple held by ts to enc, streaming them from the
+// triple store's all iterator. If w is a Flusher, it is flushed after each
+// cfg.LoadSize triples so that a partial dump is usable, which needs its
+// Flush to flush any gzip.Writer that enc writes through as well.
+func Dump(ts graph.TripleStore, cfg *config.Config, enc quad.Marshaler, w io.Writer) error {
+	switch cfg.DumpOversize {
+	case "", OversizeSkip, OversizeTruncate, OversizeFail:
+	default:
+		return fmt.Errorf("db: unknown dump_oversize %q", cfg.DumpOversize)
+	}
+
+	it := ts.TriplesAllIterator()
+	defer it.Close()
+
+	f, canFlush := w.(Flusher)
+	var n, skipped, truncated int
+	defer func() {
+		if skipped != 0 || truncated != 0 {
+			glog.Warningf("Dump skipped %d and truncated %d triples over %d bytes", skipped, truncated, cfg.DumpMaxSize)
+		}
+	}()
+	for graph.Next(it) {
+		t := ts.Quad(it.Result())
+		if !t.IsValid() {
+			// Removed triples may leave holes in the all iterator.
+			continue
+		}
+		if size := quadSize(t); cfg.DumpMaxSize > 0 && size > cfg.DumpMaxSize {
+			if cfg.DumpOversize == OversizeFail {
+				return fmt.Errorf("db: triple with subject %q is %d bytes, over the dump_max_size of %d", t.Subject, size, cfg.DumpMaxSize)
+			}
+			var ok bool
+			if cfg.DumpOversize == OversizeTruncate {
+				t, ok = truncate(t, cfg.DumpMaxSize)
+			}
+			if !ok {
+				glog.Warningf("Skipping triple with subject %q of %d bytes", t.Subject, size)
+				skipped++
+				continue
 			}
+			truncated++
+		}
+		if err := enc.Marshal(t); err != nil {
 			return err
 		}
-		block = append(block, t)
-		if len(block) == cap(block) {
-			ts.AddTripleSet(block)
-			block = block[:0]
+		n++
+		if canFlush && cfg.LoadSize > 0 && n%cfg.LoadSize == 0 {
+			if err := f.Flush(); err != nil {
+				return err
+			}
 		}
 	}
-	ts.AddTripleSet(block)
-
+	if canFlush {
+		return f.Flush()
+	}
 	return nil
 }
@@ -0,0 +1,103 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"io"
+	"sort"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// storeDecoder reads the triples of a store as a quad.Unmarshaler.
+type storeDecoder struct {
+	ts graph.TripleStore
+	it graph.Iterator
+}
+
+// NewStoreDecoder returns a quad.Unmarshaler reading every triple in ts,
+// in no particular order.
+func NewStoreDecoder(ts graph.TripleStore) quad.Unmarshaler {
+	return &storeDecoder{ts: ts, it: ts.TriplesAllIterator()}
+}
+
+func (d *storeDecoder) Unmarshal() (quad.Quad, error) {
+	for d.it != nil && graph.Next(d.it) {
+		t := d.ts.Quad(d.it.Result())
+		if t.IsValid() {
+			return t, nil
+		}
+		// Removed triples may leave holes in the all iterator.
+	}
+	if d.it != nil {
+		d.it.Close()
+		d.it = nil
+	}
+	return quad.Quad{}, io.EOF
+}
+
+// Diff returns the quads read from b that are not read from a, and those
+// read from a that are not read from b, each sorted. Neither need be in any
+// order: the quads of a are held in memory, while those of b are streamed
+// past them.
+func Diff(a, b quad.Unmarshaler) (added, removed []quad.Quad, err error) {
+	seen := make(map[quad.Quad]bool)
+	for {
+		t, err := a.Unmarshal()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		seen[t] = false
+	}
+	for {
+		t, err := b.Unmarshal()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := seen[t]; !ok {
+			added = append(added, t)
+		}
+		seen[t] = true
+	}
+	for t, inB := range seen {
+		if !inB {
+			removed = append(removed, t)
+		}
+	}
+	sort.Sort(byQuad(added))
+	sort.Sort(byQuad(removed))
+	return added, removed, nil
+}
+
+type byQuad []quad.Quad
+
+func (q byQuad) Len() int      { return len(q) }
+func (q byQuad) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q byQuad) Less(i, j int) bool {
+	for d := quad.Subject; d <= quad.Label; d++ {
+		if a, b := q[i].Get(d), q[j].Get(d); a != b {
+			return a < b
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"hash/fnv"
+	"io"
+
+	"github.com/barakmich/glog"
+
+	"github.com/google/cayley/quad"
+)
+
+// A Duplicate is a quad read again after it was first read. Where is the
+// line of the document it was read from, if the decoder has Positions, and
+// otherwise its number among the quads read, counting from one. First is
+// where it was first read.
+type Duplicate struct {
+	Quad  quad.Quad
+	Where int64
+	First int64
+}
+
+// A DuplicateCheck is an Unmarshaler of the quads of another that reports
+// each quad it has already yielded. It remembers a fingerprint of at most
+// a fixed number of quads, so that its memory is bounded however large the
+// document. Once that many are remembered, later quads are not, and their
+// duplicates go unreported. Duplicates are never dropped from the quads it
+// yields.
+type DuplicateCheck struct {
+	dec    quad.Unmarshaler
+	pos    quad.Positioner
+	max    int
+	seen   map[uint64]int64
+	report func(Duplicate)
+
+	// Read is the number of quads read, Found the number of them that
+	// were duplicates, and Unchecked the number read once no more could
+	// be remembered, whose duplicates would not be found.
+	Read      int64
+	Found     int64
+	Unchecked int64
+}
+
+// CheckDuplicates returns a DuplicateCheck of the quads of dec that
+// remembers at most max quads, and gives each duplicate it finds to report.
+func CheckDuplicates(dec quad.Unmarshaler, max int, report func(Duplicate)) *DuplicateCheck {
+	pos, _ := dec.(quad.Positioner)
+	return &DuplicateCheck{
+		dec:    dec,
+		pos:    pos,
+		max:    max,
+		seen:   make(map[uint64]int64),
+		report: report,
+	}
+}
+
+func (c *DuplicateCheck) Unmarshal() (quad.Quad, error) {
+	q, err := c.dec.Unmarshal()
+	if err != nil {
+		return q, err
+	}
+	c.Read++
+	where := c.Read
+	if c.pos != nil {
+		where = c.pos.Position().Line
+	}
+	key := fingerprint(q)
+	if first, ok := c.seen[key]; ok {
+		c.Found++
+		c.report(Duplicate{Quad: q, Where: where, First: first})
+	} else if len(c.seen) < c.max {
+		c.seen[key] = where
+	} else {
+		c.Unchecked++
+	}
+	return q, nil
+}
+
+// fingerprint returns a 64 bit hash of q. Two quads only share one by a
+// chance too small to matter for a report.
+func fingerprint(q quad.Quad) uint64 {
+	h := fnv.New64a()
+	for _, t := range []string{q.Subject, q.Predicate, q.Object, q.Label} {
+		io.WriteString(h, t)
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// logDuplicate logs a duplicate found during a load.
+func logDuplicate(d Duplicate) {
+	glog.Warningf("Duplicate quad at %d, first read at %d: %s", d.Where, d.First, d.Quad.NTriple())
+}
+
+// logDuplicates logs a summary of the duplicates c found.
+func logDuplicates(c *DuplicateCheck) {
+	glog.Infof("Found %d duplicate quads among %d read", c.Found, c.Read)
+	if c.Unchecked > 0 {
+		glog.Warningf("Duplicates of %d quads read after the first %d were not checked for", c.Unchecked, c.max)
+	}
+}
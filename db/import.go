@@ -0,0 +1,165 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/barakmich/glog"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/quad/cquads"
+)
+
+// ExportResumeHeader is the response header of a page of a server's export
+// that is not the last, holding the token to resume the export after it.
+const ExportResumeHeader = "X-Cayley-Resume"
+
+// A Remote is a Cayley server to import a graph from, through the export
+// of its HTTP API.
+type Remote struct {
+	// The address of the server, such as "http://localhost:64210".
+	URL string
+
+	// Headers sent with every request, such as Authorization, or the
+	// acl_header naming the client to a server with a label_acl.
+	Header http.Header
+
+	// The most triples asked for in a page, or 0 for the server's
+	// default.
+	PageSize int
+
+	// The client making the requests, or nil for http.DefaultClient.
+	Client *http.Client
+}
+
+// page returns a request for the page of the export of r after resume.
+func (r Remote) page(resume string) (*http.Request, error) {
+	params := url.Values{}
+	if r.PageSize > 0 {
+		params.Set("limit", strconv.Itoa(r.PageSize))
+	}
+	if resume != "" {
+		params.Set("resume", resume)
+	}
+	u := strings.TrimRight(r.URL, "/") + "/api/v1/export"
+	if len(params) != 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+// Import writes the triples of the graph served by remote to ts, a page of
+// its export at a time, starting after the page whose resume token is
+// resume, or from the first page if resume is empty. Triples are written in
+// blocks of cfg.LoadSize, keeping the labels they have on the server.
+//
+// If the import stops on an error, the token to resume it from is returned
+// with the error. The first block written on resuming leaves out the
+// triples that ts already has, as some of the page may have been written
+// before the stop.
+func Import(ts graph.TripleStore, cfg *config.Config, remote Remote, resume string) (string, error) {
+	if graph.IsReadOnly(ts) {
+		return resume, graph.ErrReadOnly
+	}
+	client := remote.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resumed := resume != ""
+	var n int
+	for {
+		req, err := remote.page(resume)
+		if err != nil {
+			return resume, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return resume, err
+		}
+		next := resp.Header.Get(ExportResumeHeader)
+		err = importPage(ts, cfg, resp, &resumed, &n)
+		resp.Body.Close()
+		if err != nil {
+			return resume, err
+		}
+		if next == "" {
+			glog.Infof("Imported %d triples from %s", n, remote.URL)
+			return "", nil
+		}
+		resume = next
+	}
+}
+
+// importPage writes the triples of a page of an export to ts, adding their
+// number to n. If resumed is set, the first block leaves out the triples
+// that ts has, and resumed is cleared.
+func importPage(ts graph.TripleStore, cfg *config.Config, resp *http.Response, resumed *bool, n *int) error {
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("db: export from %s failed: %s: %s", resp.Request.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	dec := cquads.NewDecoder(resp.Body)
+	block := make([]quad.Quad, 0, cfg.LoadSize)
+	write := func() error {
+		set := block
+		if *resumed {
+			var err error
+			set, err = missing(ts, block)
+			if err != nil {
+				return err
+			}
+			*resumed = false
+		}
+		ts.AddTripleSet(set)
+		*n += len(block)
+		block = block[:0]
+		return nil
+	}
+	for {
+		t, err := dec.Unmarshal()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("db: invalid quad in export after %d quads: %v", *n+len(block), err)
+		}
+		block = append(block, t)
+		if len(block) == cap(block) {
+			if err := write(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(block) == 0 {
+		return nil
+	}
+	return write()
+}
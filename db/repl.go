@@ -53,7 +53,7 @@ func Run(query string, ses query.Session) {
 	}()
 	fmt.Printf("\n")
 	c := make(chan interface{}, 5)
-	go ses.ExecInput(query, c, 100)
+	go ses.ExecInput(query, c, -1)
 	for res := range c {
 		fmt.Print(ses.ToText(res))
 		nResults++
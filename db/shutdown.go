@@ -0,0 +1,71 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrShutdown is returned by a load stopped by Shutdown, once it has
+// written the quads it had buffered.
+var ErrShutdown = errors.New("db: load stopped by shutdown")
+
+// loadGroup is the loads started since the last Shutdown.
+type loadGroup struct {
+	// stop is closed to stop the loads.
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+var (
+	loadsMu sync.Mutex
+	loads   = &loadGroup{stop: make(chan struct{})}
+)
+
+// startLoad registers a load with the loads in progress, returning their
+// group. The load must call Done on the group's wg when it returns.
+func startLoad() *loadGroup {
+	loadsMu.Lock()
+	defer loadsMu.Unlock()
+	loads.wg.Add(1)
+	return loads
+}
+
+// Shutdown stops the loads in progress and waits at most timeout for them
+// to write the quads they have buffered, returning whether they all did.
+// It is called when the process is asked to stop, so that the quads of a
+// partly filled block are not lost. Loads started after it are not
+// stopped.
+func Shutdown(timeout time.Duration) bool {
+	loadsMu.Lock()
+	g := loads
+	loads = &loadGroup{stop: make(chan struct{})}
+	loadsMu.Unlock()
+
+	close(g.stop)
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// IteratorAnalysis sets the size the planner estimated for an iterator of
+// an analyzed tree against the number of results it actually yielded.
+type IteratorAnalysis struct {
+	Type string `json:"type"`
+	UID  uint64 `json:"uid"`
+
+	// Estimated is the size given by the Stats of the iterator before the
+	// tree was run.
+	Estimated int64 `json:"estimated"`
+
+	// Actual is the number of results the iterator yielded to Next while
+	// the tree was run. An iterator only ever checked, as the later
+	// branches of an And are, yields none.
+	Actual int64 `json:"actual"`
+
+	SubIterators []IteratorAnalysis `json:"subiterators,omitempty"`
+}
+
+// An Analysis counts the results each iterator of a tree yields to Next
+// while the tree is run, from when it is made until it is stopped.
+// Iterators cloned from the tree as it runs are not counted.
+type Analysis struct {
+	root      Iterator
+	counts    map[uint64]*int64
+	estimates map[uint64]int64
+	stopped   bool
+}
+
+var (
+	// The number of analyses running, so that Next need only look for a
+	// counter while there are any.
+	analyzing int32
+
+	countersLock sync.RWMutex
+	counters     = make(map[uint64]*int64)
+)
+
+// Analyze starts counting the results of each iterator of the tree under
+// it, which should be optimized and not yet run.
+func Analyze(it Iterator) *Analysis {
+	a := &Analysis{
+		root:      it,
+		counts:    make(map[uint64]*int64),
+		estimates: make(map[uint64]int64),
+	}
+	a.add(it)
+	countersLock.Lock()
+	for uid, c := range a.counts {
+		counters[uid] = c
+	}
+	countersLock.Unlock()
+	atomic.AddInt32(&analyzing, 1)
+	return a
+}
+
+func (a *Analysis) add(it Iterator) {
+	a.counts[it.UID()] = new(int64)
+	a.estimates[it.UID()] = it.Stats().Size
+	for _, sub := range it.SubIterators() {
+		a.add(sub)
+	}
+}
+
+// Stop stops counting and returns the analysis of the tree.
+func (a *Analysis) Stop() IteratorAnalysis {
+	if !a.stopped {
+		a.stopped = true
+		countersLock.Lock()
+		for uid := range a.counts {
+			delete(counters, uid)
+		}
+		countersLock.Unlock()
+		atomic.AddInt32(&analyzing, -1)
+	}
+	return a.report(a.root)
+}
+
+func (a *Analysis) report(it Iterator) IteratorAnalysis {
+	r := IteratorAnalysis{
+		Type:      it.Type().String(),
+		UID:       it.UID(),
+		Estimated: a.estimates[it.UID()],
+	}
+	if c, ok := a.counts[it.UID()]; ok {
+		r.Actual = atomic.LoadInt64(c)
+	}
+	for _, sub := range it.SubIterators() {
+		r.SubIterators = append(r.SubIterators, a.report(sub))
+	}
+	return r
+}
+
+// countNext counts a result yielded by it, if it is being analyzed.
+func countNext(it Iterator) {
+	if atomic.LoadInt32(&analyzing) == 0 {
+		return
+	}
+	countersLock.RLock()
+	c := counters[it.UID()]
+	countersLock.RUnlock()
+	if c != nil {
+		atomic.AddInt64(c, 1)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Capabilities are the kinds of work that a TripleStore can do itself,
+// rather than leave to iterators over its triples.
+type Capabilities uint
+
+const (
+	// CapCount is the capability to count triples by group, as a
+	// PredicateCounter does.
+	CapCount Capabilities = 1 << iota
+
+	// CapDistinct is the capability to list the distinct nodes in a
+	// direction, as a DistinctLister does.
+	CapDistinct
+
+	// CapTextSearch is the capability to search the objects of triples
+	// for words, as a TextSearcher does.
+	CapTextSearch
+
+	// CapComplete is the capability to find the nodes whose names start
+	// with a prefix, as a Completer does.
+	CapComplete
+)
+
+// Has returns whether c includes every capability in want.
+func (c Capabilities) Has(want Capabilities) bool {
+	return c&want == want
+}
+
+// A Capable TripleStore says which of the work it can do is worth handing to
+// it. A store may implement an interface for some work but leave it out of
+// its Capabilities, for instance when it would be slower than the
+// fallback, and it is then not asked to do it.
+type Capable interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns the capabilities of ts. Stores that are not
+// Capable have the capabilities of the interfaces they implement.
+func CapabilitiesOf(ts TripleStore) Capabilities {
+	ts = unwrap(ts)
+	if c, ok := ts.(Capable); ok {
+		return c.Capabilities()
+	}
+	var c Capabilities
+	if _, ok := ts.(PredicateCounter); ok {
+		c |= CapCount
+	}
+	if _, ok := ts.(DistinctLister); ok {
+		c |= CapDistinct
+	}
+	if _, ok := ts.(TextSearcher); ok {
+		c |= CapTextSearch
+	}
+	if _, ok := ts.(Completer); ok {
+		c |= CapComplete
+	}
+	return c
+}
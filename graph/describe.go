@@ -0,0 +1,90 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"sort"
+
+	"github.com/google/cayley/quad"
+)
+
+// A Description is everything the store holds about a node: the objects of
+// the triples it is the subject of, and the subjects of those it is the
+// object of, each keyed by predicate and in order of name.
+type Description struct {
+	ID  string              `json:"id"`
+	Out map[string][]string `json:"out"`
+	In  map[string][]string `json:"in,omitempty"`
+}
+
+// A Describer can find the triples about a node itself, such as with a
+// single query of the backend.
+type Describer interface {
+	// DescribeTriples returns the triples with node as their subject, and,
+	// if withObject is set, those with it as their object.
+	DescribeTriples(node string, withObject bool) ([]quad.Quad, error)
+}
+
+// Describe returns the Description of node in ts, leaving out the triples
+// it is the object of unless withObject is set. A store that is not a
+// Describer has the triples of each direction iterated.
+func Describe(ts TripleStore, node string, withObject bool) (*Description, error) {
+	ts = unwrap(ts)
+	var triples []quad.Quad
+	if d, ok := ts.(Describer); ok {
+		var err error
+		triples, err = d.DescribeTriples(node, withObject)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dirs := []quad.Direction{quad.Subject}
+		if withObject {
+			dirs = append(dirs, quad.Object)
+		}
+		for _, d := range dirs {
+			it := ts.TripleIterator(d, ts.ValueOf(node))
+			for Next(it) {
+				t := ts.Quad(it.Result())
+				// A triple of the node to itself is found in both
+				// directions.
+				if d == quad.Object && t.Subject == node {
+					continue
+				}
+				triples = append(triples, t)
+			}
+			it.Close()
+		}
+	}
+
+	desc := &Description{ID: node, Out: make(map[string][]string)}
+	if withObject {
+		desc.In = make(map[string][]string)
+	}
+	for _, t := range triples {
+		if t.Subject == node {
+			desc.Out[t.Predicate] = append(desc.Out[t.Predicate], t.Object)
+		}
+		if withObject && t.Object == node {
+			desc.In[t.Predicate] = append(desc.In[t.Predicate], t.Subject)
+		}
+	}
+	for _, m := range []map[string][]string{desc.Out, desc.In} {
+		for _, nodes := range m {
+			sort.Strings(nodes)
+		}
+	}
+	return desc, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"crypto/sha1"
+	"sort"
+)
+
+// Digest returns a checksum of every result of it, including each result's
+// tags, as named by ts. Since values are resolved to names, the same query
+// over the same data gives the same digest whatever the backend.
+//
+// Each result is hashed on its own and the hashes are summed, so the digest
+// does not depend on the order results are produced in, and the result set
+// is never held in memory.
+func Digest(ts TripleStore, it Iterator) []byte {
+	var (
+		sum  [sha1.Size]byte
+		tags = make(map[string]Value)
+		keys []string
+		buf  []byte
+	)
+	add := func() {
+		for k := range tags {
+			delete(tags, k)
+		}
+		it.TagResults(tags)
+		keys = keys[:0]
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf = append(buf[:0], ts.NameOf(it.Result())...)
+		for _, k := range keys {
+			buf = append(buf, 0)
+			buf = append(buf, k...)
+			buf = append(buf, 0)
+			buf = append(buf, ts.NameOf(tags[k])...)
+		}
+		h := sha1.Sum(buf)
+
+		// Add h to sum, as big-endian integers modulo 2^160.
+		var carry uint
+		for i := len(sum) - 1; i >= 0; i-- {
+			s := uint(sum[i]) + uint(h[i]) + carry
+			sum[i] = byte(s)
+			carry = s >> 8
+		}
+	}
+
+	for Next(it) {
+		add()
+		for it.NextPath() {
+			add()
+		}
+	}
+	return sum[:]
+}
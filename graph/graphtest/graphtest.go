@@ -0,0 +1,482 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphtest checks that a backend keeps the graph.TripleStore and
+// graph.Iterator contracts.
+//
+// A backend registers itself from an init function in its package:
+//
+//	func init() {
+//		graph.RegisterTripleStore("mystore", true, newTripleStore, createNewMyStore)
+//	}
+//
+// where newTripleStore opens a store at a path with the given options, and
+// createNewMyStore creates an empty one there. Its tests then hand the
+// suite a way to get a new, empty store:
+//
+//	func TestBackend(t *testing.T) {
+//		graphtest.BackendTestSuite(t, func() graph.TripleStore {
+//			createNewMyStore(tmpDir(t), nil)
+//			ts, _ := newTripleStore(tmpDir(t), nil)
+//			return ts
+//		})
+//	}
+package graphtest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// This is a simple test graph.
+//
+//    +---+                        +---+
+//    | A |-------               ->| F |<--
+//    +---+       \------>+---+-/  +---+   \--+---+
+//                 ------>|#B#|      |        | E |
+//    +---+-------/      >+---+      |        +---+
+//    | C |             /            v
+//    +---+           -/           +---+
+//      ----    +---+/             |#G#|
+//          \-->|#D#|------------->+---+
+//              +---+
+//
+var simpleGraph = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"C", "follows", "B", ""},
+	{"C", "follows", "D", ""},
+	{"D", "follows", "B", ""},
+	{"B", "follows", "F", ""},
+	{"F", "follows", "G", ""},
+	{"D", "follows", "G", ""},
+	{"E", "follows", "F", ""},
+	{"B", "status", "cool", "status_graph"},
+	{"D", "status", "cool", "status_graph"},
+	{"G", "status", "cool", "status_graph"},
+}
+
+// BackendTestSuite runs the contract checks against the stores returned by
+// open, which must return a new, empty store each time it is called. Each
+// store is closed once its checks are done.
+func BackendTestSuite(t *testing.T, open func() graph.TripleStore) {
+	for _, check := range []struct {
+		name string
+		fn   func(tester, graph.TripleStore)
+	}{
+		{"add", checkAdd},
+		{"names", checkNames},
+		{"exists", checkExists},
+		{"triple iterators", checkTripleIterators},
+		{"all iterators", checkAllIterators},
+		{"contains", checkContains},
+		{"term kinds", checkTermKinds},
+		{"clone", checkClone},
+		{"reset", checkReset},
+		{"optimize", checkOptimize},
+		{"sort", checkSort},
+		{"remove", checkRemove},
+	} {
+		ts := open()
+		if ts == nil {
+			t.Fatalf("Failed to open a store for the %s check", check.name)
+		}
+		for _, q := range simpleGraph {
+			ts.AddTriple(q)
+		}
+		check.fn(&prefixed{T: t, prefix: check.name + ": "}, ts)
+		ts.Close()
+	}
+}
+
+// tester is the part of *testing.T used by the checks.
+type tester interface {
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// prefixed marks each failure with the check it came from.
+type prefixed struct {
+	*testing.T
+	prefix string
+}
+
+func (t *prefixed) Errorf(format string, args ...interface{}) {
+	t.T.Errorf(t.prefix+format, args...)
+}
+
+func (t *prefixed) Fatalf(format string, args ...interface{}) {
+	t.T.Fatalf(t.prefix+format, args...)
+}
+
+// expectQuads returns the triples of simpleGraph with the named node in
+// direction d, as sorted N-Quads.
+func expectQuads(d quad.Direction, name string) []string {
+	var out []string
+	for _, q := range simpleGraph {
+		if d == quad.Any || q.Get(d) == name {
+			out = append(out, q.NTriple())
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// quadsOf returns the triples yielded by it, as sorted N-Quads.
+func quadsOf(ts graph.TripleStore, it graph.Iterator) []string {
+	var out []string
+	for graph.Next(it) {
+		out = append(out, ts.Quad(it.Result()).NTriple())
+	}
+	sort.Strings(out)
+	return out
+}
+
+// namesOf returns the names of the nodes yielded by it, sorted.
+func namesOf(ts graph.TripleStore, it graph.Iterator) []string {
+	var out []string
+	for graph.Next(it) {
+		out = append(out, ts.NameOf(it.Result()))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// nodes returns the names of the nodes of simpleGraph, sorted.
+func nodes() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, q := range simpleGraph {
+		for d := quad.Subject; d <= quad.Label; d++ {
+			if n := q.Get(d); n != "" && !seen[n] {
+				seen[n] = true
+				out = append(out, n)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func checkAdd(t tester, ts graph.TripleStore) {
+	if size := ts.Size(); size != int64(len(simpleGraph)) {
+		t.Errorf("Unexpected size, got:%d expect:%d", size, len(simpleGraph))
+	}
+	// Adding a triple again changes nothing.
+	ts.AddTriple(simpleGraph[0])
+	ts.AddTripleSet(simpleGraph[:2])
+	if size := ts.Size(); size != int64(len(simpleGraph)) {
+		t.Errorf("Unexpected size after adding duplicates, got:%d expect:%d", size, len(simpleGraph))
+	}
+	if got, expect := quadsOf(ts, ts.TriplesAllIterator()), expectQuads(quad.Any, ""); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected triples after adding duplicates, got:%q expect:%q", got, expect)
+	}
+}
+
+func checkNames(t tester, ts graph.TripleStore) {
+	for _, n := range nodes() {
+		if got := ts.NameOf(ts.ValueOf(n)); got != n {
+			t.Errorf("Unexpected name of the value of %q, got:%q", n, got)
+		}
+	}
+}
+
+func checkExists(t tester, ts graph.TripleStore) {
+	for _, test := range []struct {
+		quad   quad.Quad
+		expect bool
+	}{
+		{quad.Quad{"C", "follows", "D", ""}, true},
+		{quad.Quad{"G", "status", "cool", "status_graph"}, true},
+		{quad.Quad{"D", "follows", "C", ""}, false},
+		{quad.Quad{"G", "status", "cool", "other_graph"}, false},
+		{quad.Quad{"G", "status", "cool", ""}, false},
+	} {
+		got, err := ts.QuadExists(test.quad)
+		if err != nil {
+			t.Errorf("Unexpected error checking %v exists: %v", test.quad, err)
+		}
+		if got != test.expect {
+			t.Errorf("Unexpected existence of %v, got:%t expect:%t", test.quad, got, test.expect)
+		}
+	}
+}
+
+func checkTripleIterators(t tester, ts graph.TripleStore) {
+	for _, n := range nodes() {
+		for d := quad.Subject; d <= quad.Label; d++ {
+			it := ts.TripleIterator(d, ts.ValueOf(n))
+			var got []string
+			for graph.Next(it) {
+				v := it.Result()
+				got = append(got, ts.Quad(v).NTriple())
+				if name := ts.NameOf(ts.TripleDirection(v, d)); name != n {
+					t.Errorf("Unexpected %s of a triple of %s %q, got:%q", d, d, n, name)
+				}
+			}
+			sort.Strings(got)
+			if expect := expectQuads(d, n); !reflect.DeepEqual(got, expect) {
+				t.Errorf("Unexpected triples with %s %q, got:%q expect:%q", d, n, got, expect)
+			}
+			it.Close()
+		}
+	}
+}
+
+func checkAllIterators(t tester, ts graph.TripleStore) {
+	if got, expect := namesOf(ts, ts.NodesAllIterator()), nodes(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected nodes, got:%q expect:%q", got, expect)
+	}
+	if got, expect := quadsOf(ts, ts.TriplesAllIterator()), expectQuads(quad.Any, ""); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected triples, got:%q expect:%q", got, expect)
+	}
+}
+
+func checkContains(t tester, ts graph.TripleStore) {
+	all := ts.TriplesAllIterator()
+	for graph.Next(all) {
+		v := all.Result()
+		q := ts.Quad(v)
+		for _, n := range []string{"B", "D"} {
+			it := ts.TripleIterator(quad.Subject, ts.ValueOf(n))
+			if got, expect := it.Contains(v), q.Subject == n; got != expect {
+				t.Errorf("Unexpected containment of %v in the triples of subject %q, got:%t expect:%t", q, n, got, expect)
+			}
+			it.Close()
+		}
+	}
+
+	nodeIt := ts.NodesAllIterator()
+	for _, n := range nodes() {
+		if !nodeIt.Contains(ts.ValueOf(n)) {
+			t.Errorf("Expected all nodes to contain %q", n)
+		}
+	}
+
+	fixed := ts.FixedIterator()
+	fixed.Add(ts.ValueOf("C"))
+	if !fixed.Contains(ts.ValueOf("C")) || fixed.Contains(ts.ValueOf("D")) {
+		t.Errorf("Unexpected containment in a fixed iterator of C")
+	}
+}
+
+// checkTermKinds checks that an IRI and a literal of the same text, as
+// N-Quads gives them, are different nodes. Nodes are plain strings, so it is
+// the brackets and quotes N-Quads keeps in their names that tell them apart.
+func checkTermKinds(t tester, ts graph.TripleStore) {
+	iri := quad.Quad{"<http://example/s>", "<http://example/p>", "<http://x>", ""}
+	lit := quad.Quad{"<http://example/s>", "<http://example/p>", `"http://x"`, ""}
+	ts.AddTriple(iri)
+	ts.AddTriple(lit)
+
+	triples := make(map[quad.Quad]graph.Value)
+	all := ts.TriplesAllIterator()
+	for graph.Next(all) {
+		triples[ts.Quad(all.Result())] = all.Result()
+	}
+	all.Close()
+	for _, test := range []struct {
+		node  string
+		match quad.Quad
+		other quad.Quad
+	}{
+		{node: iri.Object, match: iri, other: lit},
+		{node: lit.Object, match: lit, other: iri},
+	} {
+		it := ts.TripleIterator(quad.Object, ts.ValueOf(test.node))
+		if !it.Contains(triples[test.match]) {
+			t.Errorf("Expected the triples with object %s to contain %v", test.node, test.match)
+		}
+		if it.Contains(triples[test.other]) {
+			t.Errorf("Unexpected containment of %v in the triples with object %s", test.other, test.node)
+		}
+		it.Close()
+	}
+	if ts.ValueOf(iri.Object) == ts.ValueOf(lit.Object) {
+		t.Errorf("Unexpected single node for %s and %s", iri.Object, lit.Object)
+	}
+}
+
+func checkClone(t tester, ts graph.TripleStore) {
+	for _, it := range []graph.Iterator{
+		ts.TripleIterator(quad.Object, ts.ValueOf("B")),
+		ts.TriplesAllIterator(),
+	} {
+		it.Tagger().Add("tag")
+		c := it.Clone()
+		if tags := c.Tagger().Tags(); !reflect.DeepEqual(tags, []string{"tag"}) {
+			t.Errorf("Clone of %s did not keep its tags, got:%q", it.Type(), tags)
+		}
+		if got, expect := quadsOf(ts, c), quadsOf(ts, it); !reflect.DeepEqual(got, expect) {
+			t.Errorf("Clone of %s has unexpected triples, got:%q expect:%q", it.Type(), got, expect)
+		}
+		// A clone starts from the beginning, even when taken from a
+		// finished iterator.
+		if got, expect := quadsOf(ts, it.Clone()), quadsOf(ts, c.Clone()); !reflect.DeepEqual(got, expect) {
+			t.Errorf("Clone of a finished %s has unexpected triples, got:%q expect:%q", it.Type(), got, expect)
+		}
+	}
+}
+
+func checkReset(t tester, ts graph.TripleStore) {
+	it := ts.TripleIterator(quad.Subject, ts.ValueOf("D"))
+	first := quadsOf(ts, it)
+	it.Reset()
+	if second := quadsOf(ts, it); !reflect.DeepEqual(first, second) {
+		t.Errorf("Unexpected triples after reset, got:%q expect:%q", second, first)
+	}
+
+	// Reset part way through.
+	it.Reset()
+	graph.Next(it)
+	it.Reset()
+	if third := quadsOf(ts, it); !reflect.DeepEqual(first, third) {
+		t.Errorf("Unexpected triples after reset part way through, got:%q expect:%q", third, first)
+	}
+}
+
+func checkOptimize(t tester, ts graph.TripleStore) {
+	// Nodes that follow B, with and without optimization.
+	build := func() graph.Iterator {
+		fixed := ts.FixedIterator()
+		fixed.Add(ts.ValueOf("B"))
+		fixed.Tagger().Add("followed")
+		and := iterator.NewAnd()
+		and.AddSubIterator(iterator.NewLinksTo(ts, fixed, quad.Object))
+		pred := ts.FixedIterator()
+		pred.Add(ts.ValueOf("follows"))
+		and.AddSubIterator(iterator.NewLinksTo(ts, pred, quad.Predicate))
+		return iterator.NewHasA(ts, and, quad.Subject)
+	}
+	tagged := func(it graph.Iterator) []string {
+		var out []string
+		tags := make(map[string]graph.Value)
+		for graph.Next(it) {
+			it.TagResults(tags)
+			out = append(out, fmt.Sprintf("%s followed:%s", ts.NameOf(it.Result()), ts.NameOf(tags["followed"])))
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	expect := []string{"A followed:B", "C followed:B", "D followed:B"}
+	if got := tagged(build()); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected unoptimized results, got:%q expect:%q", got, expect)
+	}
+	it, _ := build().Optimize()
+	if got := tagged(it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected optimized results, got:%q expect:%q", got, expect)
+	}
+}
+
+func checkSort(t tester, ts graph.TripleStore) {
+	// Most triples tie on their predicate, and many on their subject or
+	// object, so the order of each is set by the names that break ties.
+	for _, test := range []struct {
+		dir    quad.Direction
+		expect []string
+	}{
+		{
+			dir: quad.Subject,
+			expect: []string{
+				"A follows B .", "B follows F .", "B status cool status_graph .",
+				"C follows B .", "C follows D .", "D follows B .", "D follows G .",
+				"D status cool status_graph .", "E follows F .", "F follows G .",
+				"G status cool status_graph .",
+			},
+		},
+		{
+			dir: quad.Predicate,
+			expect: []string{
+				"A follows B .", "B follows F .", "C follows B .", "C follows D .",
+				"D follows B .", "D follows G .", "E follows F .", "F follows G .",
+				"B status cool status_graph .", "D status cool status_graph .",
+				"G status cool status_graph .",
+			},
+		},
+		{
+			dir: quad.Object,
+			expect: []string{
+				"A follows B .", "C follows B .", "D follows B .", "C follows D .",
+				"B follows F .", "E follows F .", "D follows G .", "F follows G .",
+				"B status cool status_graph .", "D status cool status_graph .",
+				"G status cool status_graph .",
+			},
+		},
+		{
+			// Unlabeled triples have the empty label, which sorts first.
+			dir: quad.Label,
+			expect: []string{
+				"A follows B .", "B follows F .", "C follows B .", "C follows D .",
+				"D follows B .", "D follows G .", "E follows F .", "F follows G .",
+				"B status cool status_graph .", "D status cool status_graph .",
+				"G status cool status_graph .",
+			},
+		},
+	} {
+		it := iterator.NewSort(ts, ts.TriplesAllIterator(), test.dir)
+		var got []string
+		for graph.Next(it) {
+			got = append(got, ts.Quad(it.Result()).NTriple())
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected order sorted by %s, got:%q expect:%q", test.dir, got, test.expect)
+		}
+		// A second pass gives the same order.
+		it.Reset()
+		var again []string
+		for graph.Next(it) {
+			again = append(again, ts.Quad(it.Result()).NTriple())
+		}
+		if !reflect.DeepEqual(again, got) {
+			t.Errorf("Unexpected order sorted by %s after reset, got:%q expect:%q", test.dir, again, got)
+		}
+		it.Close()
+	}
+}
+
+func checkRemove(t tester, ts graph.TripleStore) {
+	removed := quad.Quad{"E", "follows", "F", ""}
+	ts.RemoveTriple(removed)
+	// Removing a triple that is not there changes nothing.
+	ts.RemoveTriple(removed)
+
+	if size := ts.Size(); size != int64(len(simpleGraph)-1) {
+		t.Errorf("Unexpected size after removal, got:%d expect:%d", size, len(simpleGraph)-1)
+	}
+	if ok, _ := ts.QuadExists(removed); ok {
+		t.Errorf("Removed triple %v still exists", removed)
+	}
+	var expect []string
+	for _, q := range expectQuads(quad.Any, "") {
+		if q != removed.NTriple() {
+			expect = append(expect, q)
+		}
+	}
+	if got := quadsOf(ts, ts.TriplesAllIterator()); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected triples after removal, got:%q expect:%q", got, expect)
+	}
+	if got := quadsOf(ts, ts.TripleIterator(quad.Subject, ts.ValueOf("E"))); got != nil {
+		t.Errorf("Unexpected triples of a removed subject, got:%q", got)
+	}
+	got := quadsOf(ts, ts.TripleIterator(quad.Object, ts.ValueOf("F")))
+	if expect := []string{"B follows F ."}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected triples of an object after removal, got:%q expect:%q", got, expect)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"errors"
+)
+
+// ErrUnavailable is the error of a query a store would not send to a
+// backend that keeps failing.
+var ErrUnavailable = errors.New("triplestore: backend unavailable")
+
+// Health tells how the backend of a store is faring.
+type Health struct {
+	// OK is whether the store is sending queries to its backend.
+	OK bool `json:"ok"`
+
+	// Breaker is the state of the circuit breaker of the store, if it
+	// has one: "closed" while queries are sent, "open" while they are
+	// refused, and "half-open" while one is let through to see whether
+	// the backend is back.
+	Breaker string `json:"breaker,omitempty"`
+
+	// Failures is the number of backend failures in a row.
+	Failures int `json:"failures"`
+
+	// RetryInSecs is the number of seconds until an open breaker lets a
+	// query through.
+	RetryInSecs float64 `json:"retry_in_secs,omitempty"`
+}
+
+// A HealthReporter knows how its backend is faring.
+type HealthReporter interface {
+	Health() Health
+}
+
+// HealthOf returns the Health of ts. A store that is not a HealthReporter
+// is taken to be healthy.
+func HealthOf(ts TripleStore) Health {
+	ts = unwrap(ts)
+	if hr, ok := ts.(HealthReporter); ok {
+		return hr.Health()
+	}
+	return Health{OK: true}
+}
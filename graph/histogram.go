@@ -0,0 +1,159 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/cayley/quad"
+)
+
+// A PredicateCount is the number of triples with a predicate.
+type PredicateCount struct {
+	Predicate string `json:"predicate"`
+	Count     int64  `json:"count"`
+}
+
+// A PredicateCounter can count the triples with each predicate itself, such
+// as by aggregating in the backend.
+type PredicateCounter interface {
+	// PredicateCounts returns the number of triples with each predicate,
+	// keyed by its name.
+	PredicateCounts() (map[string]int64, error)
+}
+
+// PredicateHistogram returns the number of triples in ts with each
+// predicate, most common first, and predicates with the same count in
+// order of name. A store that is not a PredicateCounter, or does not have
+// CapCount, has every triple read.
+func PredicateHistogram(ts TripleStore) ([]PredicateCount, error) {
+	ts = unwrap(ts)
+	var counts map[string]int64
+	if pc, ok := ts.(PredicateCounter); ok && CapabilitiesOf(ts).Has(CapCount) {
+		var err error
+		counts, err = pc.PredicateCounts()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		counts = make(map[string]int64)
+		it := ts.TriplesAllIterator()
+		for Next(it) {
+			counts[ts.Quad(it.Result()).Predicate]++
+		}
+		it.Close()
+	}
+
+	hist := make([]PredicateCount, 0, len(counts))
+	for p, n := range counts {
+		hist = append(hist, PredicateCount{Predicate: p, Count: n})
+	}
+	sort.Sort(byCount(hist))
+	return hist, nil
+}
+
+type byCount []PredicateCount
+
+func (h byCount) Len() int      { return len(h) }
+func (h byCount) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h byCount) Less(i, j int) bool {
+	if h[i].Count != h[j].Count {
+		return h[i].Count > h[j].Count
+	}
+	return h[i].Predicate < h[j].Predicate
+}
+
+// A FanOut picks out the nodes in one direction of the triples with a
+// predicate by how many of those triples each is in, such as the subjects
+// with more than five objects for "follows".
+type FanOut struct {
+	// The direction of the nodes counted, quad.Subject or quad.Object.
+	Direction quad.Direction
+	Predicate string
+
+	// Op compares the count of each node with N. It is one of "<", "<=",
+	// ">", ">=" or "=".
+	Op string
+	N  int64
+}
+
+// Check returns an error if f cannot be used to count nodes.
+func (f FanOut) Check() error {
+	if f.Direction != quad.Subject && f.Direction != quad.Object {
+		return fmt.Errorf("graph: cannot count the fan out of %v nodes", f.Direction)
+	}
+	switch f.Op {
+	case "<", "<=", ">", ">=", "=":
+		return nil
+	}
+	return fmt.Errorf("graph: unknown comparison %q", f.Op)
+}
+
+// Holds returns whether a node in count of the triples passes f.
+func (f FanOut) Holds(count int64) bool {
+	switch f.Op {
+	case "<":
+		return count < f.N
+	case "<=":
+		return count <= f.N
+	case ">":
+		return count > f.N
+	case ">=":
+		return count >= f.N
+	case "=":
+		return count == f.N
+	}
+	return false
+}
+
+// A FanOutCounter can find the nodes passing a FanOut itself, such as by
+// grouping triples in the backend.
+type FanOutCounter interface {
+	// FanOutNodes returns the nodes passing f, which has been checked.
+	FanOutNodes(f FanOut) ([]Value, error)
+}
+
+// FanOutNodes returns the nodes of ts passing f. Only the nodes in at least
+// one of the triples with the predicate are counted, so none has a count of
+// zero. A store that is not a FanOutCounter, or does not have CapCount, has
+// the triples with the predicate grouped in memory.
+func FanOutNodes(ts TripleStore, f FanOut) ([]Value, error) {
+	if err := f.Check(); err != nil {
+		return nil, err
+	}
+	ts = unwrap(ts)
+	if fc, ok := ts.(FanOutCounter); ok && CapabilitiesOf(ts).Has(CapCount) {
+		return fc.FanOutNodes(f)
+	}
+	var names []string
+	counts := make(map[string]int64)
+	it := ts.TripleIterator(quad.Predicate, ts.ValueOf(f.Predicate))
+	for Next(it) {
+		name := ts.Quad(it.Result()).Get(f.Direction)
+		if counts[name] == 0 {
+			names = append(names, name)
+		}
+		counts[name]++
+	}
+	it.Close()
+	var nodes []Value
+	for _, name := range names {
+		if f.Holds(counts[name]) {
+			nodes = append(nodes, ts.ValueOf(name))
+		}
+	}
+	return nodes, nil
+}
@@ -21,6 +21,8 @@ import (
 	"sync"
 
 	"github.com/barakmich/glog"
+
+	"github.com/google/cayley/quad"
 )
 
 type Tagger struct {
@@ -148,15 +150,141 @@ type Nexter interface {
 
 // Next is a convenience function that conditionally calls the Next method
 // of an Iterator if it is a Nexter. If the Iterator is not a Nexter, Next
-// returns false.
+// returns false. Each result is counted for any Analysis of the Iterator.
 func Next(it Iterator) bool {
 	if n, ok := it.(Nexter); ok {
-		return n.Next()
+		if !n.Next() {
+			return false
+		}
+		countNext(it)
+		return true
 	}
 	glog.Errorln("Nexting an un-nextable iterator")
 	return false
 }
 
+// A Sorter is an iterator over triples that can yield them in order of the
+// name of one of their directions, such as by having its backend sort them.
+type Sorter interface {
+	// SortBy orders the results by the name of direction d, returning
+	// whether it could. It must be called before the first Next.
+	SortBy(d quad.Direction) bool
+
+	Iterator
+}
+
+// A SortKey orders triples on the name of their node in direction Dir,
+// from the last to the first if Descending.
+type SortKey struct {
+	Dir        quad.Direction
+	Descending bool
+}
+
+// A KeySorter is an iterator over triples that can yield them in order of
+// several SortKeys at once, such as by having its backend sort them on a
+// compound key.
+type KeySorter interface {
+	// SortByKeys orders the results on keys, breaking ties as
+	// iterator.SortKeys does, returning whether it could. It must be
+	// called before the first Next.
+	SortByKeys(keys []SortKey) bool
+
+	Iterator
+}
+
+// A Sampler is an iterator that can yield a random sample of its results,
+// such as by having its backend draw them.
+type Sampler interface {
+	// SampleBy narrows the results to at most n of them, drawn at random,
+	// returning whether it could. It must be called before the first
+	// Next.
+	SampleBy(n int64) bool
+
+	Iterator
+}
+
+// A BatchContainer is an Iterator that can check many values at once more
+// cheaply than one at a time, such as a backend that can look them all up
+// in one query.
+type BatchContainer interface {
+	// BatchContains returns whether the iterator contains each of vals.
+	// Unlike Contains, it leaves the result and tags of the iterator as
+	// they were.
+	BatchContains(vals []Value) []bool
+
+	Iterator
+}
+
+// BatchContains returns whether it contains each of vals, checking them all
+// at once if it is a BatchContainer, and with Contains one at a time if it
+// is not.
+func BatchContains(it Iterator, vals []Value) []bool {
+	if bc, ok := it.(BatchContainer); ok {
+		return bc.BatchContains(vals)
+	}
+	out := make([]bool, len(vals))
+	for i, v := range vals {
+		out[i] = it.Contains(v)
+	}
+	return out
+}
+
+// A Rewinder is an Iterator that can be readied for more calls to Contains
+// more cheaply than by Reset, which also restarts its scan, for instance by
+// reissuing a query. Iterators that are only checked, such as the
+// subiterators of an And other than its primary, are rewound rather than
+// reset.
+type Rewinder interface {
+	// Rewind clears what the iterator holds from its last Contains, as
+	// Reset does, but leaves its scan where it is. Next must not be called
+	// after Rewind until the iterator is Reset.
+	Rewind()
+
+	Iterator
+}
+
+// Rewind readies it for more calls to Contains, rewinding it if it is a
+// Rewinder and resetting it if it is not.
+func Rewind(it Iterator) {
+	if r, ok := it.(Rewinder); ok {
+		r.Rewind()
+		return
+	}
+	it.Reset()
+}
+
+// A Source names the iterator of a TripleStore that an IteratorSpec is.
+type Source int
+
+const (
+	// NodesAll is the iterator of NodesAllIterator.
+	NodesAll Source = iota
+	// TriplesAll is the iterator of TriplesAllIterator.
+	TriplesAll
+	// Triples is the iterator of TripleIterator.
+	Triples
+)
+
+// An IteratorSpec says which of the iterators of a TripleStore an iterator
+// is, and for a Triples iterator, the direction and node it was made with.
+type IteratorSpec struct {
+	Source    Source
+	Direction quad.Direction
+	Value     Value
+}
+
+// A Specifier is an Iterator of a TripleStore that can say which of the
+// store's iterators it is, so that it can be made again, against the same
+// or another store, by one that knows nothing of the store's internals.
+type Specifier interface {
+	// Spec returns the spec of the iterator, or false if it holds other
+	// than the iterator of its store, as when its store has pushed more of
+	// a query into it.
+	Spec() (IteratorSpec, bool)
+
+	Iterator
+}
+
 // Height is a convienence function to measure the height of an iterator tree.
 func Height(it Iterator, until Type) int {
 	if it.Type() == until {
@@ -201,6 +329,15 @@ const (
 	Not
 	Optional
 	Materialize
+	Unique
+	Skip
+	Limit
+	Foreign
+	Save
+	Bound
+	LeftJoin
+	Pluck
+	LangMatch
 )
 
 var (
@@ -222,6 +359,15 @@ var (
 		"not",
 		"optional",
 		"materialize",
+		"unique",
+		"skip",
+		"limit",
+		"foreign",
+		"save",
+		"bound",
+		"leftjoin",
+		"pluck",
+		"langmatch",
 	}
 )
 
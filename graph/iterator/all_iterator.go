@@ -40,12 +40,13 @@ type Int64 struct {
 
 // Creates a new Int64 with the given range.
 func NewInt64(min, max int64) *Int64 {
-	return &Int64{
+	it := &Int64{
 		uid: NextUID(),
 		min: min,
 		max: max,
-		at:  min,
 	}
+	it.Reset()
+	return it
 }
 
 func (it *Int64) UID() uint64 {
@@ -55,6 +56,11 @@ func (it *Int64) UID() uint64 {
 // Start back at the beginning
 func (it *Int64) Reset() {
 	it.at = it.min
+	// A range with max below min, such as that of an empty store, is
+	// empty.
+	if it.max < it.min {
+		it.at = -1
+	}
 }
 
 func (it *Int64) Close() {}
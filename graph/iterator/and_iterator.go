@@ -32,8 +32,17 @@ type And struct {
 	primaryIt         graph.Iterator
 	checkList         []graph.Iterator
 	result            graph.Value
+
+	// Candidates read ahead from the primary iterator that passed the
+	// subiterators that check values in batches.
+	pending []graph.Value
 }
 
+// batchSize is the number of candidates an And reads ahead from its
+// primary iterator to check against subiterators that are
+// graph.BatchContainers.
+const batchSize = 100
+
 // Creates a new And iterator.
 func NewAnd() *And {
 	return &And{
@@ -46,13 +55,24 @@ func (it *And) UID() uint64 {
 	return it.uid
 }
 
-// Reset all internal iterators
+// Reset all internal iterators. Only the primary iterator is Nexted, so the
+// others are only rewound.
 func (it *And) Reset() {
 	it.primaryIt.Reset()
 	for _, sub := range it.internalIterators {
-		sub.Reset()
+		graph.Rewind(sub)
 	}
 	it.checkList = nil
+	it.pending = nil
+}
+
+// Rewind rewinds all internal iterators, as Contains checks each of them.
+func (it *And) Rewind() {
+	graph.Rewind(it.primaryIt)
+	for _, sub := range it.internalIterators {
+		graph.Rewind(sub)
+	}
+	it.pending = nil
 }
 
 func (it *And) Tagger() *graph.Tagger {
@@ -157,6 +177,9 @@ func (it *And) AddSubIterator(sub graph.Iterator) {
 // is therefore very important.
 func (it *And) Next() bool {
 	graph.NextLogIn(it)
+	if it.canBatch() {
+		return it.nextBatched()
+	}
 	for graph.Next(it.primaryIt) {
 		curr := it.primaryIt.Result()
 		if it.subItsContain(curr) {
@@ -167,6 +190,71 @@ func (it *And) Next() bool {
 	return graph.NextLogOut(it, nil, false)
 }
 
+// canBatch returns whether the And can read ahead from its primary iterator
+// to check candidates in batches. Some subiterator must be able to check a
+// batch, and the primary iterator must be a leaf without tags, so that
+// nothing depends on where it stands.
+func (it *And) canBatch() bool {
+	if len(it.primaryIt.SubIterators()) != 0 ||
+		len(it.primaryIt.Tagger().Tags()) != 0 ||
+		len(it.primaryIt.Tagger().Fixed()) != 0 {
+		return false
+	}
+	for _, sub := range it.internalIterators {
+		if _, ok := sub.(graph.BatchContainer); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// nextBatched advances the And to the next candidate that passes the batch
+// checks and then every subiterator. The subiterators are checked one value
+// at a time again, so that their results and tags are those of the result.
+func (it *And) nextBatched() bool {
+	for {
+		for len(it.pending) == 0 {
+			if !it.readBatch() {
+				return graph.NextLogOut(it, nil, false)
+			}
+		}
+		curr := it.pending[0]
+		it.pending = it.pending[1:]
+		if it.subItsContain(curr) {
+			it.result = curr
+			return graph.NextLogOut(it, curr, true)
+		}
+	}
+}
+
+// readBatch reads up to batchSize candidates from the primary iterator, and
+// keeps those that every graph.BatchContainer subiterator contains. It
+// returns false once the primary iterator is exhausted.
+func (it *And) readBatch() bool {
+	var batch []graph.Value
+	for len(batch) < batchSize && graph.Next(it.primaryIt) {
+		batch = append(batch, it.primaryIt.Result())
+	}
+	if len(batch) == 0 {
+		return false
+	}
+	for _, sub := range it.internalIterators {
+		bc, ok := sub.(graph.BatchContainer)
+		if !ok {
+			continue
+		}
+		kept := batch[:0]
+		for i, ok := range bc.BatchContains(batch) {
+			if ok {
+				kept = append(kept, batch[i])
+			}
+		}
+		batch = kept
+	}
+	it.pending = batch
+	return true
+}
+
 func (it *And) Result() graph.Value {
 	return it.result
 }
@@ -154,7 +154,7 @@ func optimizeOrder(its []graph.Iterator) []graph.Iterator {
 		rootStats := it.Stats()
 		cost := rootStats.NextCost
 		for _, f := range its {
-			if _, canNext := it.(graph.Nexter); !canNext {
+			if _, canNext := f.(graph.Nexter); !canNext {
 				continue
 			}
 			if f == it {
@@ -170,32 +170,68 @@ func optimizeOrder(its []graph.Iterator) []graph.Iterator {
 		}
 	}
 
-	// TODO(barakmich): Optimization of order need not stop here. Picking a smart
-	// Contains() order based on probability of getting a false Contains() first is
-	// useful (fail faster).
-
 	// Put the best iterator (the one we wish to Next()) at the front...
 	out = append(out, best)
 
-	// ... push everyone else after...
+	// ... push everyone else after, in the order that rejects candidates
+	// most cheaply...
+	var rest []graph.Iterator
 	for _, it := range its {
 		if _, canNext := it.(graph.Nexter); !canNext {
 			continue
 		}
 		if it != best {
-			out = append(out, it)
+			rest = append(rest, it)
 		}
 	}
+	out = append(out, probeOrder(rest, largestSize(its))...)
 
 	// ...and finally, the difficult children on the end.
 	return append(out, bad...)
 }
 
-type byCost []graph.Iterator
+// probeOrder sorts its into the order in which to check candidates against
+// them, so that candidates that will fail fail as cheaply as possible.
+//
+// Of n candidates, an iterator of size s passes about s/n, so each check of
+// it, at its ContainsCost c, rejects a candidate with probability 1-s/n.
+// Checking the iterators in increasing order of c/(1-s/n), the cost of each
+// rejection, minimises the expected cost of checking a candidate.
+func probeOrder(its []graph.Iterator, n int64) []graph.Iterator {
+	c := byRejectCost{its: its, cost: make([]float64, len(its))}
+	for i, it := range its {
+		stats := it.Stats()
+		// No iterator is larger than n, so each rejects some candidates.
+		pass := float64(stats.Size) / float64(n+1)
+		c.cost[i] = float64(stats.ContainsCost) / (1 - pass)
+	}
+	sort.Stable(c)
+	return its
+}
 
-func (c byCost) Len() int           { return len(c) }
-func (c byCost) Less(i, j int) bool { return c[i].Stats().ContainsCost < c[j].Stats().ContainsCost }
-func (c byCost) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+// largestSize returns the largest estimated size of its, to stand for the
+// number of candidates.
+func largestSize(its []graph.Iterator) int64 {
+	var n int64
+	for _, it := range its {
+		if size := it.Stats().Size; size > n {
+			n = size
+		}
+	}
+	return n
+}
+
+type byRejectCost struct {
+	its  []graph.Iterator
+	cost []float64
+}
+
+func (c byRejectCost) Len() int           { return len(c.its) }
+func (c byRejectCost) Less(i, j int) bool { return c.cost[i] < c.cost[j] }
+func (c byRejectCost) Swap(i, j int) {
+	c.its[i], c.its[j] = c.its[j], c.its[i]
+	c.cost[i], c.cost[j] = c.cost[j], c.cost[i]
+}
 
 // optimizeContains() creates an alternate check list, containing the same contents
 // but with a new ordering, however it wishes.
@@ -205,7 +241,7 @@ func (it *And) optimizeContains() {
 	// This involves providing GetSubIterators with a slice to fill.
 	// Generally this is a worthwhile thing to do in other places as well.
 	it.checkList = it.SubIterators()
-	sort.Sort(byCost(it.checkList))
+	probeOrder(it.checkList, largestSize(it.checkList))
 }
 
 // If we're replacing ourselves by a single iterator, we need to grab the
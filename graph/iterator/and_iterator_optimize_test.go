@@ -110,3 +110,56 @@ func TestAndStatistics(t *testing.T) {
 		t.Error("And didn't optimize. Next cost old ", stats1.NextCost, "and new ", stats2.NextCost)
 	}
 }
+
+// costed is a Fixed iterator that reports the statistics it is given.
+type costed struct {
+	*Fixed
+	stats graph.IteratorStats
+}
+
+func newCosted(name string, size, next, contains int64) *costed {
+	fix := newFixed()
+	fix.Add(name)
+	return &costed{Fixed: fix, stats: graph.IteratorStats{Size: size, NextCost: next, ContainsCost: contains}}
+}
+
+func (it *costed) Clone() graph.Iterator {
+	return &costed{Fixed: it.Fixed.Clone().(*Fixed), stats: it.stats}
+}
+
+func (it *costed) Optimize() (graph.Iterator, bool) { return it, false }
+
+func (it *costed) Stats() graph.IteratorStats { return it.stats }
+
+func TestAndCostOrder(t *testing.T) {
+	// scan is large, but cheap to next and contains. find is mid-sized
+	// and dear to next. narrow is the smallest, but by far the dearest to
+	// next, so find is nexted; narrow is checked first, as it rejects most
+	// of find's results, though scan is cheaper to check.
+	scan := newCosted("scan", 1000, 1, 1)
+	find := newCosted("find", 100, 50, 5)
+	narrow := newCosted("narrow", 10, 1000, 2)
+	a := NewAnd()
+	a.AddSubIterator(scan)
+	a.AddSubIterator(narrow)
+	a.AddSubIterator(find)
+
+	newIt, changed := a.Optimize()
+	if !changed {
+		t.Fatal("Didn't optimize")
+	}
+	names := func(its []graph.Iterator) []string {
+		var out []string
+		for _, it := range its {
+			out = append(out, it.(*costed).values[0].(string))
+		}
+		return out
+	}
+	and := newIt.(*And)
+	if got, expect := names(and.SubIterators()), []string{"find", "narrow", "scan"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected next plan, got:%v expect:%v", got, expect)
+	}
+	if got, expect := names(and.checkList), []string{"narrow", "find", "scan"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected contains plan, got:%v expect:%v", got, expect)
+	}
+}
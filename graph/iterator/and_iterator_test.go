@@ -15,6 +15,7 @@
 package iterator
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/google/cayley/graph"
@@ -140,3 +141,120 @@ func TestAllIterators(t *testing.T) {
 	}
 
 }
+
+// batchFixed is a Fixed iterator that checks values in batches, and counts the
+// batches it is asked to check.
+type batchFixed struct {
+	*Fixed
+	batches int
+}
+
+func (it *batchFixed) BatchContains(vals []graph.Value) []bool {
+	it.batches++
+	out := make([]bool, len(vals))
+	for i, v := range vals {
+		for _, x := range it.values {
+			if x == v {
+				out[i] = true
+			}
+		}
+	}
+	return out
+}
+
+// Make sure that an And checks a BatchContainer in batches, with the same
+// results and tags as one value at a time.
+func TestAndBatchContains(t *testing.T) {
+	run := func(batch bool) ([]graph.Value, []graph.Value, int) {
+		fix := newFixed()
+		for i := 0; i < 3*batchSize; i += 3 {
+			fix.Add(int64(i))
+		}
+		fix.Tagger().Add("fix")
+		var sub graph.Iterator = fix
+		bf := &batchFixed{Fixed: fix}
+		if batch {
+			sub = bf
+		}
+		and := NewAnd()
+		and.AddSubIterator(NewInt64(0, 2*batchSize))
+		and.AddSubIterator(sub)
+
+		var got, tagged []graph.Value
+		for graph.Next(and) {
+			got = append(got, and.Result())
+			tags := make(map[string]graph.Value)
+			and.TagResults(tags)
+			tagged = append(tagged, tags["fix"])
+		}
+		return got, tagged, bf.batches
+	}
+
+	want, wantTags, _ := run(false)
+	got, gotTags, batches := run(true)
+	if len(want) != 67 {
+		t.Errorf("Unexpected number of results, got %d", len(want))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Batched results differ, got:%v expect:%v", got, want)
+	}
+	if !reflect.DeepEqual(gotTags, wantTags) {
+		t.Errorf("Batched tags differ, got:%v expect:%v", gotTags, wantTags)
+	}
+	if batches != 3 {
+		t.Errorf("Unexpected number of batches, got %d", batches)
+	}
+}
+
+// rescanCounter is a Fixed iterator that counts how often its scan is
+// restarted and how often it is only rewound.
+type rescanCounter struct {
+	*Fixed
+	resets, rewinds int
+}
+
+func (it *rescanCounter) Reset() {
+	it.resets++
+	it.Fixed.Reset()
+}
+
+func (it *rescanCounter) Rewind() {
+	it.rewinds++
+}
+
+func TestAndResetRewindsSecondaries(t *testing.T) {
+	primary := newFixed()
+	for _, v := range []int{1, 2, 3, 4} {
+		primary.Add(v)
+	}
+	check := &rescanCounter{Fixed: newFixed()}
+	check.Add(2)
+	check.Add(4)
+	and := NewAnd()
+	and.AddSubIterator(primary)
+	and.AddSubIterator(check)
+
+	expect := []graph.Value{2, 4}
+	for pass := 0; pass < 3; pass++ {
+		var got []graph.Value
+		for graph.Next(and) {
+			got = append(got, and.Result())
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected results on pass %d, got:%v expect:%v", pass, got, expect)
+		}
+		and.Reset()
+	}
+	if check.resets != 0 || check.rewinds != 3 {
+		t.Errorf("Unexpected restarts of a checked iterator, got:%d resets, %d rewinds expect:0 resets, 3 rewinds", check.resets, check.rewinds)
+	}
+
+	// Iterators that cannot be rewound are reset.
+	fix := newFixed()
+	fix.Add(1)
+	graph.Next(fix)
+	graph.Rewind(fix)
+	if !graph.Next(fix) || fix.Result() != 1 {
+		t.Error("Iterator without Rewind was not reset")
+	}
+}
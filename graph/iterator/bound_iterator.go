@@ -0,0 +1,183 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the Bound iterator, which holds a path to a node it tagged before.
+//
+// A tag names the node a path was on when it passed the tag. To say that a
+// later step of the path must be on that same node, as in "people who
+// follow someone who follows them back", is to join the step with a Fixed
+// iterator holding the tagged node -- a different node for each path. So a
+// Bound checks each path of its subiterator against the node the path
+// tagged, and passes only those that agree.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+// A Bound iterator yields the results of its subiterator that are the node
+// tagged with its bound tag along the same path.
+type Bound struct {
+	uid   uint64
+	tags  graph.Tagger
+	subIt graph.Iterator
+	bound string
+}
+
+// NewBound returns an iterator over the paths of subIt whose result is the
+// node they tagged with bound.
+func NewBound(subIt graph.Iterator, bound string) *Bound {
+	return &Bound{
+		uid:   NextUID(),
+		subIt: subIt,
+		bound: bound,
+	}
+}
+
+func (it *Bound) UID() uint64 {
+	return it.uid
+}
+
+func (it *Bound) Reset() {
+	it.subIt.Reset()
+}
+
+func (it *Bound) Close() {
+	it.subIt.Close()
+}
+
+func (it *Bound) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Bound) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *Bound) Clone() graph.Iterator {
+	out := NewBound(it.subIt.Clone(), it.bound)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Bound) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// agrees returns whether the current path of the subiterator is on the node
+// it tagged with the bound tag.
+func (it *Bound) agrees() bool {
+	tags := make(map[string]graph.Value)
+	it.subIt.TagResults(tags)
+	v, ok := tags[it.bound]
+	return ok && v == it.subIt.Result()
+}
+
+// nextAgreeing moves the subiterator to its next path that agrees, if the
+// current one does not, returning whether there is one.
+func (it *Bound) nextAgreeing() bool {
+	if it.agrees() {
+		return true
+	}
+	return it.NextPath()
+}
+
+func (it *Bound) Next() bool {
+	graph.NextLogIn(it)
+	for graph.Next(it.subIt) {
+		if it.nextAgreeing() {
+			return graph.NextLogOut(it, it.Result(), true)
+		}
+	}
+	return graph.NextLogOut(it, nil, false)
+}
+
+// DEPRECATED
+func (it *Bound) ResultTree() *graph.ResultTree {
+	tree := graph.NewResultTree(it.Result())
+	tree.AddSubtree(it.subIt.ResultTree())
+	return tree
+}
+
+func (it *Bound) Result() graph.Value {
+	return it.subIt.Result()
+}
+
+func (it *Bound) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.subIt.Contains(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	return graph.ContainsLogOut(it, val, it.nextAgreeing())
+}
+
+// NextPath moves to the next path of the subiterator that agrees.
+func (it *Bound) NextPath() bool {
+	for it.subIt.NextPath() {
+		if it.agrees() {
+			return true
+		}
+	}
+	return false
+}
+
+// Optimize optimizes the subiterator, and replaces it if it can be. The
+// Bound itself stays, as nothing else would hold paths to their tags.
+func (it *Bound) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// Bound costs as much as its subiterator, with one more path checked for
+// each it passes over.
+func (it *Bound) Stats() graph.IteratorStats {
+	stats := it.subIt.Stats()
+	stats.NextCost *= 2
+	stats.ContainsCost *= 2
+	return stats
+}
+
+// Size returns the size of the subiterator, as the most that may agree.
+func (it *Bound) Size() (int64, bool) {
+	size, _ := it.subIt.Size()
+	return size, false
+}
+
+func (it *Bound) Type() graph.Type { return graph.Bound }
+
+func (it *Bound) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s tags:%s bound:%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.tags.Tags(),
+		it.bound,
+		it.subIt.DebugString(indent+4))
+}
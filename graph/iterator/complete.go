@@ -0,0 +1,50 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+// Complete returns an iterator over the nodes in ts whose names start with
+// prefix, in order of name, yielding at most limit of them unless limit is
+// negative, such as the suggestions for a search box as it is typed in. If
+// ts is a graph.Completer with graph.CapComplete, it is asked for the
+// iterator; otherwise every node is read and named to find them.
+func Complete(ts graph.TripleStore, prefix string, limit int) graph.Iterator {
+	if c, ok := graph.AsCompleter(ts); ok && graph.CapabilitiesOf(ts).Has(graph.CapComplete) {
+		return c.Complete(prefix, limit)
+	}
+	var names []string
+	it := ts.NodesAllIterator()
+	for graph.Next(it) {
+		if name := ts.NameOf(it.Result()); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	it.Close()
+	sort.Strings(names)
+	if limit >= 0 && len(names) > limit {
+		names = names[:limit]
+	}
+	fixed := ts.FixedIterator()
+	for _, name := range names {
+		fixed.Add(ts.ValueOf(name))
+	}
+	return fixed
+}
@@ -0,0 +1,51 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"github.com/google/cayley/graph"
+)
+
+// Count optimizes it and returns the number of its results, counting each
+// result once however many paths lead to it, and whether that number is
+// exact. Count consumes and closes it.
+//
+// An iterator with no subiterators, such as one over a backend query, is
+// asked for its size, which the backend may know without iterating; a
+// MongoDB query is counted by the server. If the size is not exact and
+// exact is true, the iterator is run to its end instead.
+//
+// The sizes of other iterators are only estimates, so they are run to
+// their end if exact is true. Otherwise their estimate is returned.
+func Count(it graph.Iterator, exact bool) (int64, bool) {
+	if newIt, changed := it.Optimize(); changed {
+		it = newIt
+	}
+	defer it.Close()
+	if len(it.SubIterators()) == 0 {
+		size, isExact := it.Size()
+		if isExact || !exact {
+			return size, isExact
+		}
+	} else if !exact {
+		return it.Stats().Size, false
+	}
+
+	var n int64
+	for graph.Next(it) {
+		n++
+	}
+	return n, true
+}
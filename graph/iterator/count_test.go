@@ -0,0 +1,90 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+// duplicated returns an iterator over 1, 2 and 3, with 1 and 3 twice.
+func duplicated() *Fixed {
+	f := newFixed()
+	for _, v := range []int{1, 1, 2, 3, 3} {
+		f.Add(v)
+	}
+	return f
+}
+
+var countTests = []struct {
+	message     string
+	it          func() graph.Iterator
+	exact       bool
+	expect      int64
+	expectExact bool
+}{
+	{
+		message:     "estimate an iterator that knows its size",
+		it:          func() graph.Iterator { return numbers(10) },
+		expect:      10,
+		expectExact: true,
+	},
+	{
+		message:     "count an iterator that knows its size",
+		it:          func() graph.Iterator { return numbers(10) },
+		exact:       true,
+		expect:      10,
+		expectExact: true,
+	},
+	{
+		message: "estimate duplicated results",
+		it: func() graph.Iterator {
+			return NewUnique(duplicated())
+		},
+		expect: 5,
+	},
+	{
+		message: "count duplicated results",
+		it: func() graph.Iterator {
+			return NewUnique(duplicated())
+		},
+		exact:       true,
+		expect:      3,
+		expectExact: true,
+	},
+	{
+		message: "estimate skipped results",
+		it:      func() graph.Iterator { return NewSkip(&store{}, numbers(10), 3) },
+		expect:  7,
+	},
+	{
+		message:     "count skipped results",
+		it:          func() graph.Iterator { return NewSkip(&store{}, numbers(10), 3) },
+		exact:       true,
+		expect:      7,
+		expectExact: true,
+	},
+}
+
+func TestCount(t *testing.T) {
+	for _, test := range countTests {
+		n, exact := Count(test.it(), test.exact)
+		if n != test.expect || exact != test.expectExact {
+			t.Errorf("Failed to %s, got:%d (exact %t) expect:%d (exact %t)",
+				test.message, n, exact, test.expect, test.expectExact)
+		}
+	}
+}
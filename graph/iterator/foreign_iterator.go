@@ -0,0 +1,203 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the Foreign iterator, which federates two triple stores.
+//
+// Each triple store has its own scheme for values: a memstore uses int64s,
+// while Mongo uses hashes of names. Values from one store mean nothing to
+// another, so the only thing two stores can agree on is the name of a node.
+//
+// A Foreign iterator runs an iterator over one store, the foreign store,
+// and presents its results as the values of nodes with the same names in
+// another, the local store. It can then be joined with iterators over the
+// local store with the And and Or iterators, as any other iterator can.
+// Checking whether it contains a local value goes the other way, by name,
+// to the foreign store.
+//
+// A node of the foreign store that has no namesake in the local store has
+// no local value, and so is passed over. A union of two stores thus holds
+// only the nodes that the local store knows.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+// A Foreign iterator yields the results of an iterator over another triple
+// store, as values of its own store.
+type Foreign struct {
+	uid    uint64
+	tags   graph.Tagger
+	ts     graph.TripleStore
+	from   graph.TripleStore
+	subIt  graph.Iterator
+	result graph.Value
+}
+
+// NewForeign returns an iterator over the values of ts for the nodes that
+// subIt, an iterator over from, yields.
+func NewForeign(ts, from graph.TripleStore, subIt graph.Iterator) *Foreign {
+	return &Foreign{
+		uid:   NextUID(),
+		ts:    ts,
+		from:  from,
+		subIt: subIt,
+	}
+}
+
+func (it *Foreign) UID() uint64 {
+	return it.uid
+}
+
+func (it *Foreign) Reset() {
+	it.subIt.Reset()
+	it.result = nil
+}
+
+func (it *Foreign) Close() {
+	it.subIt.Close()
+}
+
+func (it *Foreign) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// localOf returns the value of ts for the node that v, a value of from,
+// names, and whether ts has such a node.
+func (it *Foreign) localOf(v graph.Value) (graph.Value, bool) {
+	name := it.from.NameOf(v)
+	local := it.ts.ValueOf(name)
+	if local == nil || it.ts.NameOf(local) != name {
+		return nil, false
+	}
+	return local, true
+}
+
+// TagResults tags the result, and the results tagged by the subiterator
+// that the local store knows.
+func (it *Foreign) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	sub := make(map[string]graph.Value)
+	it.subIt.TagResults(sub)
+	for tag, value := range sub {
+		if local, ok := it.localOf(value); ok {
+			dst[tag] = local
+		}
+	}
+}
+
+func (it *Foreign) Clone() graph.Iterator {
+	out := NewForeign(it.ts, it.from, it.subIt.Clone())
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Foreign) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// Next advances the subiterator to its next result that the local store
+// knows.
+func (it *Foreign) Next() bool {
+	graph.NextLogIn(it)
+	for graph.Next(it.subIt) {
+		if local, ok := it.localOf(it.subIt.Result()); ok {
+			it.result = local
+			return graph.NextLogOut(it, it.result, true)
+		}
+	}
+	return graph.NextLogOut(it, nil, false)
+}
+
+// DEPRECATED
+func (it *Foreign) ResultTree() *graph.ResultTree {
+	tree := graph.NewResultTree(it.Result())
+	tree.AddSubtree(it.subIt.ResultTree())
+	return tree
+}
+
+func (it *Foreign) Result() graph.Value {
+	return it.result
+}
+
+// Contains checks whether the subiterator contains the node of the foreign
+// store with the name of val.
+func (it *Foreign) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	name := it.ts.NameOf(val)
+	foreign := it.from.ValueOf(name)
+	if foreign == nil || it.from.NameOf(foreign) != name {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	if it.subIt.Contains(foreign) {
+		it.result = val
+		return graph.ContainsLogOut(it, val, true)
+	}
+	return graph.ContainsLogOut(it, val, false)
+}
+
+func (it *Foreign) NextPath() bool {
+	return it.subIt.NextPath()
+}
+
+// Optimize optimizes the subiterator, which its own store may replace. The
+// local store has no say, as it cannot query the foreign one.
+func (it *Foreign) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// Foreign costs as much as its subiterator, and a lookup of each value in
+// either store.
+func (it *Foreign) Stats() graph.IteratorStats {
+	subStats := it.subIt.Stats()
+	return graph.IteratorStats{
+		ContainsCost: subStats.ContainsCost + 2,
+		NextCost:     subStats.NextCost + 2,
+		Size:         subStats.Size,
+	}
+}
+
+// Size returns the size of the subiterator, an upper bound as the local
+// store may not know every node.
+func (it *Foreign) Size() (int64, bool) {
+	size, _ := it.subIt.Size()
+	return size, false
+}
+
+func (it *Foreign) Type() graph.Type { return graph.Foreign }
+
+func (it *Foreign) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s tags:%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.tags.Tags(),
+		it.subIt.DebugString(indent+4))
+}
@@ -0,0 +1,107 @@
+// Defines the And iterator, one of the base iterators. And requires no
+// knowledge of the constituent TripleStore; its sole purpose is to act as an
+// intersection operator across the subiterators it is given. If one iterator
+// contains [1,3,5] and another [2,3,4] -- then And is an iterator that
+// 'contains' [3]
+//
+// It accomplishes this in one of two ways. If it is a Next()ed iterator (that
+// is, it is a top level iterator, or on the "Next() path", then it will Next()
+// it's primary iterator (helpfully, and.primary_it) and Contains() the resultant
+// value against it's other iterators. If it matches all of them, then it
+// returns that value. Otherwise, it repeats the process.
+//
+// If it's on a Contains() path, it merely Contains()s every iterator, and returns the
+// logical AND of each result.
+package iterator
+
+// Define the grouping stage, which turns the triples of an iterator into one
+// object per subject, for entity-oriented output.
+//
+// Grouping is exact when the triples come sorted by subject. Otherwise a
+// bounded number of subjects are held open, and a subject whose triples are
+// split further apart than that is given in more than one object.
+
+import (
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// A Grouper yields the triples of an iterator grouped by subject, with the
+// objects of each subject keyed by predicate.
+type Grouper struct {
+	ts  graph.TripleStore
+	it  graph.Iterator
+	max int
+
+	// The subjects held open in the order they were first seen, and the
+	// ones closed and yet to be yielded.
+	open   []*graph.Description
+	index  map[string]*graph.Description
+	ready  []*graph.Description
+	done   bool
+	result *graph.Description
+}
+
+// NewGrouper returns a Grouper over the triples of it, which must not have
+// been iterated. If it is a graph.Sorter, it is sorted by subject, and each
+// subject is yielded once. Otherwise up to buffer subjects are held open
+// while their triples are gathered.
+func NewGrouper(ts graph.TripleStore, it graph.Iterator, buffer int) *Grouper {
+	if s, ok := it.(graph.Sorter); ok && s.SortBy(quad.Subject) {
+		buffer = 1
+	}
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &Grouper{
+		ts:    ts,
+		it:    it,
+		max:   buffer,
+		index: make(map[string]*graph.Description),
+	}
+}
+
+// Next advances the Grouper to the next subject, returning false once there
+// are no more.
+func (g *Grouper) Next() bool {
+	for len(g.ready) == 0 && !g.done {
+		if !graph.Next(g.it) {
+			g.done = true
+			g.ready, g.open = g.open, nil
+			break
+		}
+		t := g.ts.Quad(g.it.Result())
+		desc, ok := g.index[t.Subject]
+		if !ok {
+			if len(g.open) == g.max {
+				// The subject seen longest ago is the least likely
+				// to have more triples to come.
+				oldest := g.open[0]
+				g.open = g.open[1:]
+				delete(g.index, oldest.ID)
+				g.ready = append(g.ready, oldest)
+			}
+			desc = &graph.Description{ID: t.Subject, Out: make(map[string][]string)}
+			g.open = append(g.open, desc)
+			g.index[t.Subject] = desc
+		}
+		desc.Out[t.Predicate] = append(desc.Out[t.Predicate], t.Object)
+	}
+	if len(g.ready) == 0 {
+		g.result = nil
+		return false
+	}
+	g.result, g.ready = g.ready[0], g.ready[1:]
+	return true
+}
+
+// Result returns the current subject, with the objects of its triples in
+// the order they were yielded.
+func (g *Grouper) Result() *graph.Description {
+	return g.result
+}
+
+// Close closes the iterator grouped.
+func (g *Grouper) Close() {
+	g.it.Close()
+}
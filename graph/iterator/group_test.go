@@ -0,0 +1,125 @@
+// Defines the And iterator, one of the base iterators. And requires no
+// knowledge of the constituent TripleStore; its sole purpose is to act as an
+// intersection operator across the subiterators it is given. If one iterator
+// contains [1,3,5] and another [2,3,4] -- then And is an iterator that
+// 'contains' [3]
+//
+// It accomplishes this in one of two ways. If it is a Next()ed iterator (that
+// is, it is a top level iterator, or on the "Next() path", then it will Next()
+// it's primary iterator (helpfully, and.primary_it) and Contains() the resultant
+// value against it's other iterators. If it matches all of them, then it
+// returns that value. Otherwise, it repeats the process.
+//
+// If it's on a Contains() path, it merely Contains()s every iterator, and returns the
+// logical AND of each result.
+package iterator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// tripleStore is a store holding triples, each the value of its index.
+type tripleStore struct {
+	store
+	triples []quad.Quad
+}
+
+func (qs *tripleStore) Quad(v graph.Value) quad.Quad { return qs.triples[v.(int)] }
+
+// sortedIterator is a fixed iterator over the triples of a tripleStore that
+// can sort them by subject, as a backend would.
+type sortedIterator struct {
+	*Fixed
+	qs *tripleStore
+}
+
+func (it sortedIterator) SortBy(d quad.Direction) bool {
+	if d != quad.Subject {
+		return false
+	}
+	sorted := NewFixedIteratorWithCompare(BasicEquality)
+	// Sort stably by subject.
+	for _, name := range []string{"alice", "bob", "charlie"} {
+		for _, v := range it.values {
+			if it.qs.triples[v.(int)].Subject == name {
+				sorted.Add(v)
+			}
+		}
+	}
+	it.Fixed.values = sorted.values
+	return true
+}
+
+var groupTriples = []quad.Quad{
+	{"alice", "follows", "bob", ""},
+	{"alice", "status", "cool", ""},
+	{"bob", "follows", "charlie", ""},
+	{"charlie", "status", "cool", ""},
+	{"alice", "follows", "charlie", ""},
+	{"bob", "status", "cool", ""},
+}
+
+func TestGrouper(t *testing.T) {
+	qs := &tripleStore{triples: groupTriples}
+	alice := &graph.Description{ID: "alice", Out: map[string][]string{"follows": {"bob", "charlie"}, "status": {"cool"}}}
+	bob := &graph.Description{ID: "bob", Out: map[string][]string{"follows": {"charlie"}, "status": {"cool"}}}
+	charlie := &graph.Description{ID: "charlie", Out: map[string][]string{"status": {"cool"}}}
+	for _, test := range []struct {
+		message string
+		sorted  bool
+		buffer  int
+		expect  []*graph.Description
+	}{
+		{
+			message: "group sorted triples",
+			sorted:  true,
+			expect:  []*graph.Description{alice, bob, charlie},
+		},
+		{
+			message: "group triples within the buffer",
+			buffer:  3,
+			expect:  []*graph.Description{alice, bob, charlie},
+		},
+		{
+			message: "group triples beyond the buffer",
+			buffer:  2,
+			expect: []*graph.Description{
+				{ID: "alice", Out: map[string][]string{"follows": {"bob"}, "status": {"cool"}}},
+				{ID: "bob", Out: map[string][]string{"follows": {"charlie"}}},
+				{ID: "charlie", Out: map[string][]string{"status": {"cool"}}},
+				{ID: "alice", Out: map[string][]string{"follows": {"charlie"}}},
+				{ID: "bob", Out: map[string][]string{"status": {"cool"}}},
+			},
+		},
+	} {
+		fixed := NewFixedIteratorWithCompare(BasicEquality)
+		for i := range groupTriples {
+			fixed.Add(i)
+		}
+		var it graph.Iterator = fixed
+		if test.sorted {
+			it = sortedIterator{Fixed: fixed, qs: qs}
+		}
+		g := NewGrouper(qs, it, test.buffer)
+		var got []*graph.Description
+		for g.Next() {
+			got = append(got, g.Result())
+		}
+		g.Close()
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got:%v expect:%v", test.message, describe(got), describe(test.expect))
+		}
+	}
+}
+
+func describe(descs []*graph.Description) []graph.Description {
+	var out []graph.Description
+	for _, d := range descs {
+		out = append(out, *d)
+	}
+	return out
+}
@@ -83,6 +83,15 @@ func (it *HasA) Reset() {
 	}
 }
 
+// Rewind drops the triples found by the last Contains. The primary iterator
+// is only checked against them, so it is rewound too.
+func (it *HasA) Rewind() {
+	graph.Rewind(it.primaryIt)
+	if it.resultIt != nil {
+		it.resultIt.Close()
+	}
+}
+
 func (it *HasA) Tagger() *graph.Tagger {
 	return &it.tags
 }
@@ -106,6 +115,12 @@ func (it *HasA) Optimize() (graph.Iterator, bool) {
 			return it.primaryIt, true
 		}
 	}
+	// Ask the triple store if we can be replaced, as a LinksTo does.
+	newReplacement, hasOne := it.ts.OptimizeIterator(it)
+	if hasOne {
+		it.Close()
+		return newReplacement, true
+	}
 	return it, false
 }
 
@@ -0,0 +1,269 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// A LabelFilter iterator passes only the triples of its subiterator that
+// have one of a set of labels. It enforces the labels a client may see, so
+// it checks them in Contains as well as in Next: a triple found by another
+// part of a query is still refused.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+type LabelFilter struct {
+	uid     uint64
+	tags    graph.Tagger
+	subIt   graph.Iterator
+	ts      graph.TripleStore
+	allowed map[string]struct{}
+	result  graph.Value
+}
+
+// NewLabelFilter returns an iterator over the triples of sub whose labels
+// are in allowed. The empty label is that of triples without one.
+func NewLabelFilter(sub graph.Iterator, ts graph.TripleStore, allowed []string) *LabelFilter {
+	it := &LabelFilter{
+		uid:     NextUID(),
+		subIt:   sub,
+		ts:      ts,
+		allowed: make(map[string]struct{}, len(allowed)),
+	}
+	for _, l := range allowed {
+		it.allowed[l] = struct{}{}
+	}
+	return it
+}
+
+func (it *LabelFilter) UID() uint64 {
+	return it.uid
+}
+
+func (it *LabelFilter) permitted(val graph.Value) bool {
+	_, ok := it.allowed[it.ts.NameOf(it.ts.TripleDirection(val, quad.Label))]
+	return ok
+}
+
+func (it *LabelFilter) labels() []string {
+	labels := make([]string, 0, len(it.allowed))
+	for l := range it.allowed {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func (it *LabelFilter) Close() {
+	it.subIt.Close()
+}
+
+func (it *LabelFilter) Reset() {
+	it.subIt.Reset()
+}
+
+func (it *LabelFilter) Rewind() {
+	graph.Rewind(it.subIt)
+}
+
+func (it *LabelFilter) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *LabelFilter) Clone() graph.Iterator {
+	out := NewLabelFilter(it.subIt.Clone(), it.ts, it.labels())
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *LabelFilter) Next() bool {
+	for graph.Next(it.subIt) {
+		val := it.subIt.Result()
+		if it.permitted(val) {
+			it.result = val
+			return true
+		}
+	}
+	return false
+}
+
+// DEPRECATED
+func (it *LabelFilter) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *LabelFilter) Result() graph.Value {
+	return it.result
+}
+
+func (it *LabelFilter) NextPath() bool {
+	for it.subIt.NextPath() {
+		if it.permitted(it.subIt.Result()) {
+			it.result = it.subIt.Result()
+			return true
+		}
+	}
+	return false
+}
+
+func (it *LabelFilter) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *LabelFilter) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.permitted(val) || !it.subIt.Contains(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *LabelFilter) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+var labelFilterType graph.Type
+
+func init() {
+	labelFilterType = graph.RegisterIterator("label_filter")
+}
+
+func (it *LabelFilter) Type() graph.Type { return labelFilterType }
+
+func (it *LabelFilter) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s %q\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(), it.labels(), it.subIt.DebugString(indent+4))
+}
+
+func (it *LabelFilter) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// The label of every triple given is named to check it, which is charged
+// at a name lookup each.
+func (it *LabelFilter) Stats() graph.IteratorStats {
+	stats := it.subIt.Stats()
+	stats.NextCost += 1
+	stats.ContainsCost += 1
+	return stats
+}
+
+// The size of the subiterator is an upper bound.
+func (it *LabelFilter) Size() (int64, bool) {
+	size, _ := it.subIt.Size()
+	return size, false
+}
+
+// RestrictLabels returns a read-only view of ts in which only the triples
+// with one of labels are found. The empty label is that of triples without
+// one. If ts is a graph.LabelRestricter, it makes the view itself;
+// otherwise every triple iterator of the view is filtered through a
+// LabelFilter, and the store is not given the view's iterators to
+// optimize, since it would replace them with its own. Its
+// NodesAllIterator lists only the nodes of the triples it finds.
+func RestrictLabels(ts graph.TripleStore, labels []string) graph.TripleStore {
+	if lr, ok := graph.AsLabelRestricter(ts); ok {
+		return lr.RestrictLabels(labels)
+	}
+	return graph.ReadOnly(&labelRestricted{TripleStore: ts, labels: labels})
+}
+
+// labelRestricted is the view of RestrictLabels over a store that cannot
+// make one.
+type labelRestricted struct {
+	graph.TripleStore
+	labels []string
+}
+
+func (ts *labelRestricted) TripleIterator(d quad.Direction, val graph.Value) graph.Iterator {
+	return NewLabelFilter(ts.TripleStore.TripleIterator(d, val), ts.TripleStore, ts.labels)
+}
+
+func (ts *labelRestricted) TriplesAllIterator() graph.Iterator {
+	return NewLabelFilter(ts.TripleStore.TriplesAllIterator(), ts.TripleStore, ts.labels)
+}
+
+// NodesAllIterator finds the nodes in every direction of the triples of
+// the view, which reads all of them.
+func (ts *labelRestricted) NodesAllIterator() graph.Iterator {
+	return RestrictedNodes(ts, ts.labels)
+}
+
+func (ts *labelRestricted) QuadExists(t quad.Quad) (bool, error) {
+	for _, l := range ts.labels {
+		if l == t.Label {
+			return ts.TripleStore.QuadExists(t)
+		}
+	}
+	return false, nil
+}
+
+// Size counts the triples of the view, which reads all of them.
+func (ts *labelRestricted) Size() int64 {
+	var n int64
+	it := ts.TriplesAllIterator()
+	defer it.Close()
+	for graph.Next(it) {
+		n++
+	}
+	return n
+}
+
+func (ts *labelRestricted) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return it, false
+}
+
+// RestrictedNodes returns an iterator over the nodes of view, a store
+// restricted to the triples of labels: those of its triples, and those of
+// labels that have any, yielding each node once.
+func RestrictedNodes(view graph.TripleStore, labels []string) graph.Iterator {
+	or := NewOr()
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object} {
+		or.AddSubIterator(Distinct(view, d))
+	}
+	fixed := view.FixedIterator()
+	for _, l := range labels {
+		if l == "" {
+			// Triples without a label have no label node.
+			continue
+		}
+		it := view.TripleIterator(quad.Label, view.ValueOf(l))
+		if graph.Next(it) {
+			fixed.Add(view.ValueOf(l))
+		}
+		it.Close()
+	}
+	or.AddSubIterator(fixed)
+	return NewUnique(or)
+}
@@ -0,0 +1,239 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// A LangMatch iterator filters triples on the language of their objects,
+// keeping, for each subject and predicate, those whose objects are in the
+// first of a list of languages that it has any in. The list is a chain of
+// fallbacks, so that
+//
+//	NewLangMatch(sub, []string{"en", "*"}, ts)
+//
+// finds the English labels of each subject, or all of its labels if it has
+// none in English. Stores that record the languages of their triples may
+// narrow the subiterator to the languages of the list, which leaves the
+// choice between them to the LangMatch.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// AnyLang is the language in a LangMatch list that any object is in,
+// including an object that is not a literal with a language tag.
+const AnyLang = "*"
+
+type LangMatch struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	langs  []string
+	ts     graph.TripleStore
+	result graph.Value
+
+	// A clone of the subiterator, for checking whether the other triples
+	// of a subject and predicate are in it.
+	check graph.Iterator
+}
+
+// NewLangMatch returns an iterator over the triples of sub whose objects
+// are in the first of langs that any triple of sub with the same subject
+// and predicate has its object in. A language of langs matches the
+// language tags it is a prefix of, as "en" does "en-GB", and "" matches
+// the objects with no language tag.
+func NewLangMatch(sub graph.Iterator, langs []string, ts graph.TripleStore) *LangMatch {
+	lower := make([]string, len(langs))
+	for i, l := range langs {
+		lower[i] = strings.ToLower(l)
+	}
+	return &LangMatch{
+		uid:   NextUID(),
+		subIt: sub,
+		langs: lower,
+		ts:    ts,
+	}
+}
+
+// Langs returns the languages the iterator prefers, most preferred first,
+// in lower case.
+func (it *LangMatch) Langs() []string {
+	return it.langs
+}
+
+func (it *LangMatch) UID() uint64 {
+	return it.uid
+}
+
+// rank returns the index in the list of the first language the object of
+// val is in, or -1 if it is in none.
+func (it *LangMatch) rank(val graph.Value) int {
+	lang := quad.LangOf(it.ts.NameOf(it.ts.TripleDirection(val, quad.Object)))
+	for i, want := range it.langs {
+		if want == AnyLang || lang == want || strings.HasPrefix(lang, want+"-") {
+			return i
+		}
+	}
+	return -1
+}
+
+// matches returns whether the object of val is in a language of the list,
+// and no other triple of the subiterator with the same subject and
+// predicate has its object in an earlier one. Only triples whose objects
+// fall back to a later language cost a look at the others.
+func (it *LangMatch) matches(val graph.Value) bool {
+	rank := it.rank(val)
+	if rank <= 0 {
+		return rank == 0
+	}
+	if it.check == nil {
+		it.check = it.subIt.Clone()
+	}
+	pred := it.ts.NameOf(it.ts.TripleDirection(val, quad.Predicate))
+	others := it.ts.TripleIterator(quad.Subject, it.ts.TripleDirection(val, quad.Subject))
+	defer others.Close()
+	for graph.Next(others) {
+		other := others.Result()
+		if it.ts.NameOf(it.ts.TripleDirection(other, quad.Predicate)) != pred {
+			continue
+		}
+		if r := it.rank(other); r >= 0 && r < rank && it.check.Contains(other) {
+			return false
+		}
+	}
+	return true
+}
+
+func (it *LangMatch) Close() {
+	it.subIt.Close()
+	if it.check != nil {
+		it.check.Close()
+	}
+}
+
+func (it *LangMatch) Reset() {
+	it.subIt.Reset()
+}
+
+func (it *LangMatch) Rewind() {
+	graph.Rewind(it.subIt)
+}
+
+func (it *LangMatch) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *LangMatch) Clone() graph.Iterator {
+	out := NewLangMatch(it.subIt.Clone(), it.langs, it.ts)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *LangMatch) Next() bool {
+	for graph.Next(it.subIt) {
+		val := it.subIt.Result()
+		if it.matches(val) {
+			it.result = val
+			return true
+		}
+	}
+	return false
+}
+
+// DEPRECATED
+func (it *LangMatch) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *LangMatch) Result() graph.Value {
+	return it.result
+}
+
+func (it *LangMatch) NextPath() bool {
+	for it.subIt.NextPath() {
+		if it.matches(it.subIt.Result()) {
+			it.result = it.subIt.Result()
+			return true
+		}
+	}
+	return false
+}
+
+func (it *LangMatch) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *LangMatch) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.subIt.Contains(val) || !it.matches(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *LangMatch) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *LangMatch) Type() graph.Type { return graph.LangMatch }
+
+func (it *LangMatch) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s %v\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(), it.langs, it.subIt.DebugString(indent+4))
+}
+
+// Optimize optimizes the subiterator, then lets the triple store narrow it
+// to the languages of the list.
+func (it *LangMatch) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	newReplacement, hasOne := it.ts.OptimizeIterator(it)
+	if hasOne {
+		return newReplacement, true
+	}
+	return it, false
+}
+
+// Every triple given is read, and its object named, to find those that
+// match, which is charged at a name lookup each. Those that fall back to a
+// later language also read the other triples of their subject, which is
+// not charged for.
+func (it *LangMatch) Stats() graph.IteratorStats {
+	stats := it.subIt.Stats()
+	stats.NextCost += 1
+	stats.ContainsCost += 1
+	return stats
+}
+
+// The size of the subiterator is an upper bound.
+func (it *LangMatch) Size() (int64, bool) {
+	size, _ := it.subIt.Size()
+	return size, false
+}
@@ -0,0 +1,193 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// A LeftJoin is an Optional that can be Nexted: it yields every result of
+// its primary iterator, whether or not the result is in its optional
+// branch, as a left join does the rows of its left table. The tags of the
+// branch are only set on the results it holds, and are absent from the
+// others.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+type LeftJoin struct {
+	uid      uint64
+	tags     graph.Tagger
+	ts       graph.TripleStore
+	primary  graph.Iterator
+	optional graph.Iterator
+	matched  bool
+	result   graph.Value
+}
+
+// NewLeftJoin returns an iterator over the results of primary, each tagged
+// with the results of optional as well if optional contains it.
+func NewLeftJoin(ts graph.TripleStore, primary, optional graph.Iterator) *LeftJoin {
+	return &LeftJoin{
+		uid:      NextUID(),
+		ts:       ts,
+		primary:  primary,
+		optional: optional,
+	}
+}
+
+func (it *LeftJoin) UID() uint64 {
+	return it.uid
+}
+
+func (it *LeftJoin) Reset() {
+	it.primary.Reset()
+	graph.Rewind(it.optional)
+	it.matched = false
+	it.result = nil
+}
+
+func (it *LeftJoin) Close() {
+	it.primary.Close()
+	it.optional.Close()
+}
+
+func (it *LeftJoin) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// TagResults tags the result, and the tags of the primary iterator, and
+// those of the optional branch if it holds the result.
+func (it *LeftJoin) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.primary.TagResults(dst)
+	if it.matched {
+		it.optional.TagResults(dst)
+	}
+}
+
+func (it *LeftJoin) Clone() graph.Iterator {
+	out := NewLeftJoin(it.ts, it.primary.Clone(), it.optional.Clone())
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *LeftJoin) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.primary, it.optional}
+}
+
+// Next yields the next result of the primary iterator, checking it against
+// the optional branch only for its tags.
+func (it *LeftJoin) Next() bool {
+	graph.NextLogIn(it)
+	if !graph.Next(it.primary) {
+		it.result = nil
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.result = it.primary.Result()
+	it.matched = it.optional.Contains(it.result)
+	return graph.NextLogOut(it, it.result, true)
+}
+
+// DEPRECATED
+func (it *LeftJoin) ResultTree() *graph.ResultTree {
+	tree := graph.NewResultTree(it.Result())
+	tree.AddSubtree(it.primary.ResultTree())
+	if it.matched {
+		tree.AddSubtree(it.optional.ResultTree())
+	}
+	return tree
+}
+
+func (it *LeftJoin) Result() graph.Value {
+	return it.result
+}
+
+// Contains checks val against the primary iterator alone.
+func (it *LeftJoin) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.primary.Contains(val) {
+		it.matched = false
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	it.matched = it.optional.Contains(val)
+	return graph.ContainsLogOut(it, val, true)
+}
+
+// NextPath yields the other paths to the result through the primary
+// iterator, then those through the optional branch, if it holds the result.
+func (it *LeftJoin) NextPath() bool {
+	if it.primary.NextPath() {
+		return true
+	}
+	return it.matched && it.optional.NextPath()
+}
+
+// Optimize optimizes the primary iterator and the optional branch, then
+// lets the triple store replace the LeftJoin, for instance by joining
+// within its own query.
+func (it *LeftJoin) Optimize() (graph.Iterator, bool) {
+	newPrimary, changed := it.primary.Optimize()
+	if changed {
+		it.primary.Close()
+		it.primary = newPrimary
+	}
+	newOptional, changed := it.optional.Optimize()
+	if changed {
+		it.optional.Close()
+		it.optional = newOptional
+	}
+	newReplacement, hasOne := it.ts.OptimizeIterator(it)
+	if hasOne {
+		return newReplacement, true
+	}
+	return it, false
+}
+
+// Every result of the primary iterator is checked against the optional
+// branch, once whether it is Nexted or checked itself.
+func (it *LeftJoin) Stats() graph.IteratorStats {
+	primary := it.primary.Stats()
+	optional := it.optional.Stats()
+	return graph.IteratorStats{
+		ContainsCost: primary.ContainsCost + optional.ContainsCost,
+		NextCost:     primary.NextCost + optional.ContainsCost,
+		Size:         primary.Size,
+	}
+}
+
+// The LeftJoin has as many results as its primary iterator.
+func (it *LeftJoin) Size() (int64, bool) {
+	return it.primary.Size()
+}
+
+func (it *LeftJoin) Type() graph.Type { return graph.LeftJoin }
+
+func (it *LeftJoin) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s tags:%s\n%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.tags.Tags(),
+		it.primary.DebugString(indent+4),
+		it.optional.DebugString(indent+4))
+}
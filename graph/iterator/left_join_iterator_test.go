@@ -0,0 +1,63 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestLeftJoin(t *testing.T) {
+	primary := numbers(5)
+	primary.Tagger().Add("id")
+	optional := newFixed()
+	optional.Add(2)
+	optional.Add(4)
+	optional.Tagger().Add("even")
+
+	it := NewLeftJoin(&store{}, primary, optional)
+	var got []map[string]int
+	for it.Next() {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		row := make(map[string]int)
+		for k, v := range tags {
+			row[k] = v.(int)
+		}
+		got = append(got, row)
+	}
+	expect := []map[string]int{
+		{"id": 1},
+		{"id": 2, "even": 2},
+		{"id": 3},
+		{"id": 4, "even": 4},
+		{"id": 5},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected left join results, got:%v expect:%v", got, expect)
+	}
+
+	if !it.Contains(3) {
+		t.Error("Failed to contain a result without the optional value")
+	}
+	if it.Contains(6) {
+		t.Error("Unexpectedly contained a result missing from the primary iterator")
+	}
+	if size, exact := it.Size(); size != 5 || !exact {
+		t.Errorf("Unexpected size, got:%d,%t expect:5,true", size, exact)
+	}
+}
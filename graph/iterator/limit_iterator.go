@@ -0,0 +1,176 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+// A Limit iterator yields at most the first n results of its subiterator.
+// See skip_iterator.go for how results are counted.
+type Limit struct {
+	uid    uint64
+	tags   graph.Tagger
+	ts     graph.TripleStore
+	subIt  graph.Iterator
+	n      int64
+	count  int64
+	result graph.Value
+}
+
+func NewLimit(ts graph.TripleStore, subIt graph.Iterator, n int64) *Limit {
+	if n < 0 {
+		n = 0
+	}
+	return &Limit{
+		uid:   NextUID(),
+		ts:    ts,
+		subIt: subIt,
+		n:     n,
+	}
+}
+
+func (it *Limit) UID() uint64 {
+	return it.uid
+}
+
+// Max returns the largest number of results the iterator yields.
+func (it *Limit) Max() int64 {
+	return it.n
+}
+
+func (it *Limit) Reset() {
+	it.subIt.Reset()
+	it.count = 0
+}
+
+func (it *Limit) Close() {
+	it.subIt.Close()
+}
+
+func (it *Limit) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Limit) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *Limit) Clone() graph.Iterator {
+	out := NewLimit(it.ts, it.subIt.Clone(), it.n)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Limit) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// Next advances the subiterator, unless n results have already been
+// yielded.
+func (it *Limit) Next() bool {
+	graph.NextLogIn(it)
+	if it.count >= it.n || !graph.Next(it.subIt) {
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.count++
+	it.result = it.subIt.Result()
+	return graph.NextLogOut(it, it.result, true)
+}
+
+// DEPRECATED
+func (it *Limit) ResultTree() *graph.ResultTree {
+	tree := graph.NewResultTree(it.Result())
+	tree.AddSubtree(it.subIt.ResultTree())
+	return tree
+}
+
+func (it *Limit) Result() graph.Value {
+	return it.result
+}
+
+// Contains checks whether val is one of the first n results, by walking a
+// clone of the iterator.
+func (it *Limit) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if windowContains(it, val) && it.subIt.Contains(val) {
+		it.result = val
+		return graph.ContainsLogOut(it, val, true)
+	}
+	return graph.ContainsLogOut(it, val, false)
+}
+
+func (it *Limit) NextPath() bool {
+	return it.subIt.NextPath()
+}
+
+// Optimize optimizes the subiterator, then lets the triple store replace
+// the Limit, for instance by limiting its own query.
+func (it *Limit) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	newReplacement, hasOne := it.ts.OptimizeIterator(it)
+	if hasOne {
+		return newReplacement, true
+	}
+	return it, false
+}
+
+// Limit costs as much as its subiterator to Next, but a Contains needs a
+// walk of the window.
+func (it *Limit) Stats() graph.IteratorStats {
+	subStats := it.subIt.Stats()
+	size, _ := it.Size()
+	return graph.IteratorStats{
+		ContainsCost: subStats.NextCost * size,
+		NextCost:     subStats.NextCost,
+		Size:         size,
+	}
+}
+
+// Size returns the size of the subiterator, up to n.
+func (it *Limit) Size() (int64, bool) {
+	size, exact := it.subIt.Size()
+	if size > it.n {
+		return it.n, exact
+	}
+	return size, exact
+}
+
+func (it *Limit) Type() graph.Type { return graph.Limit }
+
+func (it *Limit) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s %d tags:%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.n,
+		it.tags.Tags(),
+		it.subIt.DebugString(indent+4))
+}
@@ -74,6 +74,11 @@ func (it *LinksTo) Reset() {
 	it.nextIt = &Null{}
 }
 
+// Rewind rewinds the primary iterator, the only one Contains checks.
+func (it *LinksTo) Rewind() {
+	graph.Rewind(it.primaryIt)
+}
+
 func (it *LinksTo) Tagger() *graph.Tagger {
 	return &it.tags
 }
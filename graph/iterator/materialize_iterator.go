@@ -50,6 +50,14 @@ type Materialize struct {
 	subIt       graph.Iterator
 	hasRun      bool
 	aborted     bool
+
+	// Past spillAt results, they are moved to a list from newList, and
+	// read back a key at a time into values.
+	spillAt int
+	newList SpillListFunc
+	list    SpillList
+	cursor  SpillCursor
+	spilled int64
 }
 
 func NewMaterialize(sub graph.Iterator) *Materialize {
@@ -65,18 +73,60 @@ func (it *Materialize) UID() uint64 {
 	return it.uid
 }
 
+// SpillAt makes the iterator move the results it materializes into a
+// SpillList returned by f once there are more than n of them, rather than
+// give up on materializing them.
+func (it *Materialize) SpillAt(n int, f SpillListFunc) {
+	it.spillAt = n
+	it.newList = f
+}
+
 func (it *Materialize) Reset() {
 	it.subIt.Reset()
+	it.closeCursor()
+	it.index = -1
+}
+
+// Rewind keeps the materialized results, from which Contains answers,
+// without touching the subiterator.
+func (it *Materialize) Rewind() {
+	if it.aborted {
+		graph.Rewind(it.subIt)
+	}
+	it.closeCursor()
 	it.index = -1
 }
 
 func (it *Materialize) Close() {
 	it.subIt.Close()
+	it.closeCursor()
+	it.closeList()
 	it.containsMap = nil
 	it.values = nil
 	it.hasRun = false
 }
 
+func (it *Materialize) closeCursor() {
+	if it.cursor == nil {
+		return
+	}
+	if err := it.cursor.Close(); err != nil {
+		glog.Errorln("Error reading spilled results: ", err)
+	}
+	it.cursor = nil
+}
+
+func (it *Materialize) closeList() {
+	if it.list == nil {
+		return
+	}
+	if err := it.list.Close(); err != nil {
+		glog.Errorln("Error closing spill: ", err)
+	}
+	it.list = nil
+	it.spilled = 0
+}
+
 func (it *Materialize) Tagger() *graph.Tagger {
 	return &it.tags
 }
@@ -103,7 +153,10 @@ func (it *Materialize) TagResults(dst map[string]graph.Value) {
 func (it *Materialize) Clone() graph.Iterator {
 	out := NewMaterialize(it.subIt.Clone())
 	out.tags.CopyFrom(it)
-	if it.hasRun {
+	out.SpillAt(it.spillAt, it.newList)
+	// A spilled list is closed with the iterator that made it, so clones
+	// materialize their own.
+	if it.hasRun && it.list == nil {
 		out.hasRun = true
 		out.aborted = it.aborted
 		out.values = it.values
@@ -164,6 +217,10 @@ func (it *Materialize) Optimize() (graph.Iterator, bool) {
 // Size is the number of values stored, if we've got them all.
 // Otherwise, guess based on the size of the subiterator.
 func (it *Materialize) Size() (int64, bool) {
+	if it.list != nil {
+		// Only the results are counted, not the keys among them.
+		return it.spilled, false
+	}
 	if it.hasRun {
 		return int64(len(it.values)), true
 	}
@@ -191,6 +248,9 @@ func (it *Materialize) Next() bool {
 	if it.aborted {
 		return graph.Next(it.subIt)
 	}
+	if it.list != nil {
+		return it.nextSpilled()
+	}
 
 	it.index++
 	it.subindex = 0
@@ -212,6 +272,17 @@ func (it *Materialize) Contains(v graph.Value) bool {
 	if h, ok := v.(Keyer); ok {
 		key = h.Key()
 	}
+	if it.list != nil {
+		group, err := it.list.Find(key)
+		if err != nil {
+			glog.Errorln("Error reading spilled results: ", err)
+		}
+		if len(group) == 0 {
+			return graph.ContainsLogOut(it, v, false)
+		}
+		it.readGroup(group)
+		return graph.ContainsLogOut(it, v, true)
+	}
 	if i, ok := it.containsMap[key]; ok {
 		it.index = i
 		it.subindex = 0
@@ -237,15 +308,90 @@ func (it *Materialize) NextPath() bool {
 	return true
 }
 
+// nextSpilled reads the results under the next key of the spilled list.
+func (it *Materialize) nextSpilled() bool {
+	if it.cursor == nil {
+		cursor, err := it.list.Results()
+		if err != nil {
+			glog.Errorln("Error reading spilled results: ", err)
+			return graph.NextLogOut(it, nil, false)
+		}
+		it.cursor = cursor
+	}
+	var group []SpilledResult
+	if !it.cursor.Next(&group) {
+		it.values = nil
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.readGroup(group)
+	return graph.NextLogOut(it, it.Result(), true)
+}
+
+// readGroup makes group, the spilled results under a key, the only values
+// held, and the current one the first of them.
+func (it *Materialize) readGroup(group []SpilledResult) {
+	values := make([]result, len(group))
+	for i, r := range group {
+		values[i] = result{id: r.Result, tags: r.Tags}
+	}
+	it.values = [][]result{values}
+	it.index = 0
+	it.subindex = 0
+}
+
+// spill moves the values materialized so far into a new SpillList, and
+// makes the iterator add the rest to it.
+func (it *Materialize) spill() error {
+	list, err := it.newList()
+	if err != nil {
+		return err
+	}
+	it.list = list
+	for _, values := range it.values {
+		for _, r := range values {
+			if err := it.spillResult(r.id, r.tags); err != nil {
+				return err
+			}
+		}
+	}
+	it.values = nil
+	it.containsMap = nil
+	return nil
+}
+
+func (it *Materialize) spillResult(id graph.Value, tags map[string]graph.Value) error {
+	key := id
+	if h, ok := id.(Keyer); ok {
+		key = h.Key()
+	}
+	it.spilled++
+	return it.list.Append(key, SpilledResult{Result: id, Tags: tags})
+}
+
 func (it *Materialize) materializeSet() {
 	i := 0
 	for graph.Next(it.subIt) {
 		i++
-		if i > abortMaterializeAt {
+		if it.newList == nil && i > abortMaterializeAt {
 			it.aborted = true
 			break
 		}
+		if it.newList != nil && it.list == nil && i > it.spillAt {
+			if err := it.spill(); err != nil {
+				glog.Errorln("Error spilling materialized results: ", err)
+				it.aborted = true
+				break
+			}
+		}
 		id := it.subIt.Result()
+		if it.list != nil {
+			if err := it.materializeSpilled(id); err != nil {
+				glog.Errorln("Error spilling materialized results: ", err)
+				it.aborted = true
+				break
+			}
+			continue
+		}
 		val := id
 		if h, ok := id.(Keyer); ok {
 			val = h.Key()
@@ -265,6 +411,7 @@ func (it *Materialize) materializeSet() {
 		}
 	}
 	if it.aborted {
+		it.closeList()
 		it.values = nil
 		it.containsMap = nil
 		it.subIt.Reset()
@@ -272,3 +419,18 @@ func (it *Materialize) materializeSet() {
 	glog.Infof("Materialization List %d: %#v", it.values)
 	it.hasRun = true
 }
+
+// materializeSpilled adds id to the spilled list, with the tags of each of
+// its paths.
+func (it *Materialize) materializeSpilled(id graph.Value) error {
+	for {
+		tags := make(map[string]graph.Value)
+		it.subIt.TagResults(tags)
+		if err := it.spillResult(id, tags); err != nil {
+			return err
+		}
+		if !it.subIt.NextPath() {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// A Not yields the results of its primary iterator that are not in its
+// forbidden branch, as NOT EXISTS does in SQL. The branch is usually a
+// traversal back to its start, such as the nodes with an email, so that
+// the Not holds the nodes for which the traversal finds nothing: here, the
+// nodes with no email. The branch is only ever checked, never Nexted, and
+// its tags are never set, as it holds none of the results.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+type Not struct {
+	uid       uint64
+	tags      graph.Tagger
+	ts        graph.TripleStore
+	primary   graph.Iterator
+	forbidden graph.Iterator
+	result    graph.Value
+}
+
+// NewNot returns an iterator over the results of primary that forbidden
+// does not contain.
+func NewNot(ts graph.TripleStore, primary, forbidden graph.Iterator) *Not {
+	return &Not{
+		uid:       NextUID(),
+		ts:        ts,
+		primary:   primary,
+		forbidden: forbidden,
+	}
+}
+
+func (it *Not) UID() uint64 {
+	return it.uid
+}
+
+func (it *Not) Reset() {
+	it.primary.Reset()
+	graph.Rewind(it.forbidden)
+	it.result = nil
+}
+
+func (it *Not) Close() {
+	it.primary.Close()
+	it.forbidden.Close()
+}
+
+func (it *Not) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// TagResults tags the result, and the tags of the primary iterator.
+func (it *Not) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.primary.TagResults(dst)
+}
+
+func (it *Not) Clone() graph.Iterator {
+	out := NewNot(it.ts, it.primary.Clone(), it.forbidden.Clone())
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Not) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.primary, it.forbidden}
+}
+
+// Next advances the primary iterator to its next result that the forbidden
+// branch does not contain.
+func (it *Not) Next() bool {
+	graph.NextLogIn(it)
+	for graph.Next(it.primary) {
+		v := it.primary.Result()
+		if !it.forbidden.Contains(v) {
+			it.result = v
+			return graph.NextLogOut(it, v, true)
+		}
+	}
+	it.result = nil
+	return graph.NextLogOut(it, nil, false)
+}
+
+// DEPRECATED
+func (it *Not) ResultTree() *graph.ResultTree {
+	tree := graph.NewResultTree(it.Result())
+	tree.AddSubtree(it.primary.ResultTree())
+	return tree
+}
+
+func (it *Not) Result() graph.Value {
+	return it.result
+}
+
+// Contains checks that the forbidden branch does not contain val, and that
+// the primary iterator does.
+func (it *Not) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if it.forbidden.Contains(val) || !it.primary.Contains(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+// NextPath yields the other paths to the result through the primary
+// iterator. The forbidden branch has none.
+func (it *Not) NextPath() bool {
+	return it.primary.NextPath()
+}
+
+// Optimize optimizes the primary iterator and the forbidden branch, then
+// lets the triple store replace the Not, for instance by gathering the
+// branch with one query rather than checking it for each result.
+func (it *Not) Optimize() (graph.Iterator, bool) {
+	newPrimary, changed := it.primary.Optimize()
+	if changed {
+		it.primary.Close()
+		it.primary = newPrimary
+	}
+	newForbidden, changed := it.forbidden.Optimize()
+	if changed {
+		it.forbidden.Close()
+		it.forbidden = newForbidden
+	}
+	newReplacement, hasOne := it.ts.OptimizeIterator(it)
+	if hasOne {
+		return newReplacement, true
+	}
+	return it, false
+}
+
+// Every result of the primary iterator is checked against the forbidden
+// branch, whether it is Nexted or checked itself.
+func (it *Not) Stats() graph.IteratorStats {
+	primary := it.primary.Stats()
+	forbidden := it.forbidden.Stats()
+	return graph.IteratorStats{
+		ContainsCost: primary.ContainsCost + forbidden.ContainsCost,
+		NextCost:     primary.NextCost + forbidden.ContainsCost,
+		Size:         primary.Size,
+	}
+}
+
+// The Not has at most as many results as its primary iterator.
+func (it *Not) Size() (int64, bool) {
+	size, _ := it.primary.Size()
+	return size, false
+}
+
+func (it *Not) Type() graph.Type { return graph.Not }
+
+func (it *Not) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s tags:%s\n%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.tags.Tags(),
+		it.primary.DebugString(indent+4),
+		it.forbidden.DebugString(indent+4))
+}
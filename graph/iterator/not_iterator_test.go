@@ -0,0 +1,78 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestNot(t *testing.T) {
+	primary := numbers(5)
+	primary.Tagger().Add("id")
+	forbidden := newFixed()
+	forbidden.Add(2)
+	forbidden.Add(4)
+	forbidden.Add(6)
+	forbidden.Tagger().Add("even")
+
+	it := NewNot(&store{}, primary, forbidden)
+	var got []map[string]int
+	for it.Next() {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		row := make(map[string]int)
+		for k, v := range tags {
+			row[k] = v.(int)
+		}
+		got = append(got, row)
+	}
+	expect := []map[string]int{{"id": 1}, {"id": 3}, {"id": 5}}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected results, got:%v expect:%v", got, expect)
+	}
+
+	for _, test := range []struct {
+		val    int
+		expect bool
+	}{
+		{val: 3, expect: true},
+		{val: 4},
+		{val: 6},
+		{val: 7},
+	} {
+		if got := it.Contains(test.val); got != test.expect {
+			t.Errorf("Unexpected containment of %d, got:%t expect:%t", test.val, got, test.expect)
+		}
+	}
+
+	it.Reset()
+	if !it.Next() || it.Result() != 1 {
+		t.Errorf("Unexpected first result after reset, got:%v", it.Result())
+	}
+	if got := drain(it.Clone()); !reflect.DeepEqual(got, []int{1, 3, 5}) {
+		t.Errorf("Unexpected results of a clone, got:%v", got)
+	}
+}
+
+func drain(it graph.Iterator) []int {
+	var out []int
+	for graph.Next(it) {
+		out = append(out, it.Result().(int))
+	}
+	return out
+}
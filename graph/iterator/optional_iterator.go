@@ -55,8 +55,13 @@ func (it *Optional) UID() uint64 {
 	return it.uid
 }
 
+// An Optional is never Nexted, so resetting it only rewinds it.
 func (it *Optional) Reset() {
-	it.subIt.Reset()
+	it.Rewind()
+}
+
+func (it *Optional) Rewind() {
+	graph.Rewind(it.subIt)
 	it.lastCheck = false
 }
 
@@ -67,6 +67,13 @@ func (it *Or) Reset() {
 	it.currentIterator = -1
 }
 
+func (it *Or) Rewind() {
+	for _, sub := range it.internalIterators {
+		graph.Rewind(sub)
+	}
+	it.currentIterator = -1
+}
+
 func (it *Or) Tagger() *graph.Tagger {
 	return &it.tags
 }
@@ -148,3 +148,30 @@ func TestShortCircuitingOrBasics(t *testing.T) {
 		t.Errorf("Failed to iterate optimized Or correctly, got:%v expect:%v", got, expect)
 	}
 }
+
+func TestUnion(t *testing.T) {
+	f1 := newFixed()
+	f1.Add(1)
+	f1.Add(2)
+	f1.Add(3)
+	f2 := newFixed()
+	f2.Add(3)
+	f2.Add(9)
+	f2.Add(2)
+	union := NewUnion(&store{}, f1, f2)
+
+	expect := []int{1, 2, 3, 9}
+	for i := 0; i < 2; i++ {
+		if got := iterated(union); !reflect.DeepEqual(got, expect) {
+			t.Errorf("Failed to iterate Union correctly on repeat %d, got:%v expect:%v", i, got, expect)
+		}
+		union.Reset()
+	}
+	if got := iterated(union.Clone()); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate cloned Union correctly, got:%v expect:%v", got, expect)
+	}
+	optUnion, _ := union.Optimize()
+	if got := iterated(optUnion); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate optimized Union correctly, got:%v expect:%v", got, expect)
+	}
+}
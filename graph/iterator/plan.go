@@ -0,0 +1,256 @@
+// Defines the And iterator, one of the base iterators. And requires no
+// knowledge of the constituent TripleStore; its sole purpose is to act as an
+// intersection operator across the subiterators it is given. If one iterator
+// contains [1,3,5] and another [2,3,4] -- then And is an iterator that
+// 'contains' [3]
+//
+// It accomplishes this in one of two ways. If it is a Next()ed iterator (that
+// is, it is a top level iterator, or on the "Next() path", then it will Next()
+// it's primary iterator (helpfully, and.primary_it) and Contains() the resultant
+// value against it's other iterators. If it matches all of them, then it
+// returns that value. Otherwise, it repeats the process.
+//
+// If it's on a Contains() path, it merely Contains()s every iterator, and returns the
+// logical AND of each result.
+package iterator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// A Plan is a machine-readable form of an iterator tree, such as the
+// optimized tree of a query, that can be saved and built again against a
+// store, to capture and replay the tree of a bug report.
+type Plan struct {
+	Type      string            `json:"type"`
+	Tags      []string          `json:"tags,omitempty"`
+	FixedTags map[string]string `json:"fixed_tags,omitempty"`
+	Size      int64             `json:"size"`
+	Exact     bool              `json:"exact"`
+
+	// For the iterators of a store, which of them it is: "nodes",
+	// "triples", or "links" for the triples with Values[0] in Direction.
+	Source string `json:"source,omitempty"`
+
+	// The direction of a HasA, LinksTo, Save or store iterator.
+	Direction string `json:"direction,omitempty"`
+
+	// The names of the nodes of a Fixed, the node of a store iterator, or
+	// the labels allowed by a LabelFilter.
+	Values []string `json:"values,omitempty"`
+
+	// The count of a Skip or Limit, the tag of a Bound, the tags saved by
+	// a Save, and whether an Or is short circuiting.
+	N            int64    `json:"n,omitempty"`
+	Bound        string   `json:"bound,omitempty"`
+	SaveTags     []string `json:"save_tags,omitempty"`
+	ShortCircuit bool     `json:"short_circuit,omitempty"`
+
+	SubIterators []*Plan `json:"subiterators,omitempty"`
+}
+
+var sources = map[graph.Source]string{
+	graph.NodesAll:   "nodes",
+	graph.TriplesAll: "triples",
+	graph.Triples:    "links",
+}
+
+// NewPlan returns the plan of the iterator tree it of ts. Iterators are
+// described by what they were made with, so the plan of a tree that has
+// been run is that of the tree before it was run. It returns an error if
+// the tree holds an iterator that cannot be made again from a plan, such
+// as an iterator of ts that holds more than a plain iterator of its store.
+func NewPlan(it graph.Iterator, ts graph.TripleStore) (*Plan, error) {
+	p := &Plan{Type: it.Type().String()}
+	p.Size, p.Exact = it.Size()
+	p.Tags = append(p.Tags, it.Tagger().Tags()...)
+	if fixed := it.Tagger().Fixed(); len(fixed) != 0 {
+		p.FixedTags = make(map[string]string)
+		for tag, v := range fixed {
+			p.FixedTags[tag] = ts.NameOf(v)
+		}
+	}
+
+	subs := it.SubIterators()
+	switch it := it.(type) {
+	case *And, *Optional, *Materialize, *Null:
+	case *Or:
+		p.ShortCircuit = it.isShortCircuiting
+	case *Union:
+		subs = it.or.SubIterators()
+	case *Unique:
+		if it.key != nil {
+			return nil, fmt.Errorf("iterator: cannot plan a unique iterator with a key")
+		}
+	case *HasA:
+		p.Direction = it.dir.String()
+	case *LinksTo:
+		p.Direction = it.dir.String()
+	case *Save:
+		p.Direction = it.dir.String()
+		p.SaveTags = it.saveTags
+		subs = []graph.Iterator{it.subIt}
+	case *Bound:
+		p.Bound = it.bound
+		subs = []graph.Iterator{it.subIt}
+	case *Skip:
+		p.N = it.n
+	case *Limit:
+		p.N = it.n
+	case *LabelFilter:
+		for label := range it.allowed {
+			p.Values = append(p.Values, label)
+		}
+		sort.Strings(p.Values)
+	case *Fixed:
+		for _, v := range it.values {
+			p.Values = append(p.Values, ts.NameOf(v))
+		}
+	case graph.Specifier:
+		spec, ok := it.Spec()
+		if !ok {
+			return nil, fmt.Errorf("iterator: cannot plan a %s iterator holding more than its store's iterator", it.Type())
+		}
+		p.Source = sources[spec.Source]
+		if spec.Source == graph.Triples {
+			p.Direction = spec.Direction.String()
+			p.Values = []string{ts.NameOf(spec.Value)}
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("iterator: cannot plan a %s iterator", it.Type())
+	}
+	for _, sub := range subs {
+		sp, err := NewPlan(sub, ts)
+		if err != nil {
+			return nil, err
+		}
+		p.SubIterators = append(p.SubIterators, sp)
+	}
+	return p, nil
+}
+
+// Build returns an iterator tree like the one p was made from, against ts.
+// The tree is built as planned, so it should be run without optimizing it
+// again to replay the tree that was planned.
+func (p *Plan) Build(ts graph.TripleStore) (graph.Iterator, error) {
+	var subs []graph.Iterator
+	for _, sp := range p.SubIterators {
+		sub, err := sp.Build(ts)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	d, err := directionNamed(p.Direction)
+	if err != nil {
+		return nil, err
+	}
+	one := func() (graph.Iterator, error) {
+		if len(subs) != 1 {
+			return nil, fmt.Errorf("iterator: %s plan has %d subiterators, not 1", p.Type, len(subs))
+		}
+		return subs[0], nil
+	}
+
+	var it graph.Iterator
+	if p.Source != "" {
+		switch p.Source {
+		case "nodes":
+			it = ts.NodesAllIterator()
+		case "triples":
+			it = ts.TriplesAllIterator()
+		case "links":
+			if len(p.Values) != 1 {
+				return nil, fmt.Errorf("iterator: links plan has %d values, not 1", len(p.Values))
+			}
+			it = ts.TripleIterator(d, ts.ValueOf(p.Values[0]))
+		default:
+			return nil, fmt.Errorf("iterator: unknown plan source %q", p.Source)
+		}
+	} else {
+		switch p.Type {
+		case "and":
+			and := NewAnd()
+			for _, sub := range subs {
+				and.AddSubIterator(sub)
+			}
+			it = and
+		case "or":
+			or := NewOr()
+			if p.ShortCircuit {
+				or = NewShortCircuitOr()
+			}
+			for _, sub := range subs {
+				or.AddSubIterator(sub)
+			}
+			it = or
+		case "union":
+			it = NewUnion(ts, subs...)
+		case "null":
+			it = NewNull()
+		case "fixed":
+			fixed := ts.FixedIterator()
+			for _, name := range p.Values {
+				fixed.Add(ts.ValueOf(name))
+			}
+			it = fixed
+		case "label_filter":
+			sub, err := one()
+			if err != nil {
+				return nil, err
+			}
+			it = NewLabelFilter(sub, ts, p.Values)
+		default:
+			sub, err := one()
+			if err != nil {
+				return nil, err
+			}
+			switch p.Type {
+			case "hasa":
+				it = NewHasA(ts, sub, d)
+			case "linksto":
+				it = NewLinksTo(ts, sub, d)
+			case "optional":
+				it = NewOptional(sub)
+			case "materialize":
+				it = NewMaterialize(sub)
+			case "unique":
+				it = NewUnique(sub)
+			case "skip":
+				it = NewSkip(ts, sub, p.N)
+			case "limit":
+				it = NewLimit(ts, sub, p.N)
+			case "save":
+				it = NewSave(ts, sub, d, p.SaveTags...)
+			case "bound":
+				it = NewBound(sub, p.Bound)
+			default:
+				return nil, fmt.Errorf("iterator: cannot build a %s iterator from a plan", p.Type)
+			}
+		}
+	}
+	for _, tag := range p.Tags {
+		it.Tagger().Add(tag)
+	}
+	for tag, name := range p.FixedTags {
+		it.Tagger().AddFixed(tag, ts.ValueOf(name))
+	}
+	return it, nil
+}
+
+func directionNamed(name string) (quad.Direction, error) {
+	if name == "" {
+		return quad.Any, nil
+	}
+	for d := quad.Any; d <= quad.Label; d++ {
+		if d.String() == name {
+			return d, nil
+		}
+	}
+	return quad.Any, fmt.Errorf("iterator: unknown direction %q", name)
+}
@@ -0,0 +1,92 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// A Pluck yields the node in one direction of each triple of its
+// subiterator, as a HasA does, for a scan of the triples that wants only
+// those nodes, such as
+//
+//	g.V().Has("type", "city").Out("name")
+//
+// wants only the names. Where a HasA looks up the whole of each triple it
+// reads, a Pluck takes the node from the value of the triple, and tells the
+// backend that the nodes are all that is read from the triples, so that it
+// may read only them, and their names along with them.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+type Pluck struct {
+	*HasA
+}
+
+// NewPluck returns an iterator over the nodes in direction d of the triples
+// of subIt.
+func NewPluck(ts graph.TripleStore, subIt graph.Iterator, d quad.Direction) *Pluck {
+	return &Pluck{NewHasA(ts, subIt, d)}
+}
+
+func (it *Pluck) Clone() graph.Iterator {
+	out := NewPluck(it.ts, it.primaryIt.Clone(), it.dir)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// Optimize optimizes the subiterator, then asks the triple store if it can
+// read the nodes itself.
+func (it *Pluck) Optimize() (graph.Iterator, bool) {
+	newPrimary, changed := it.primaryIt.Optimize()
+	if changed {
+		it.primaryIt = newPrimary
+		if it.primaryIt.Type() == graph.Null {
+			return it.primaryIt, true
+		}
+	}
+	newReplacement, hasOne := it.ts.OptimizeIterator(it)
+	if hasOne {
+		return newReplacement, true
+	}
+	return it, false
+}
+
+// Next yields the node of the next triple of the subiterator.
+func (it *Pluck) Next() bool {
+	graph.NextLogIn(it)
+	if it.resultIt != nil {
+		it.resultIt.Close()
+	}
+	it.resultIt = &Null{}
+
+	if !graph.Next(it.primaryIt) {
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.result = it.ts.TripleDirection(it.primaryIt.Result(), it.dir)
+	return graph.NextLogOut(it, it.result, true)
+}
+
+func (it *Pluck) Type() graph.Type { return graph.Pluck }
+
+func (it *Pluck) DebugString(indent int) string {
+	var tags string
+	for _, k := range it.tags.Tags() {
+		tags += fmt.Sprintf("%s;", k)
+	}
+	return fmt.Sprintf("%s(%s %d tags:%s direction:%s\n%s)", strings.Repeat(" ", indent), it.Type(), it.UID(), tags, it.dir, it.primaryIt.DebugString(indent+4))
+}
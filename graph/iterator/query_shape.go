@@ -107,6 +107,14 @@ func (qs *queryShape) StealNode(left *Node, right *Node) {
 }
 
 func (qs *queryShape) MakeNode(it graph.Iterator) *Node {
+	if save, ok := it.(*Save); ok {
+		// A Save only tags the triples of its subiterator.
+		return qs.MakeNode(save.subIt)
+	}
+	if bound, ok := it.(*Bound); ok {
+		// A Bound only filters the paths of its subiterator.
+		return qs.MakeNode(bound.subIt)
+	}
 	n := Node{Id: qs.nodeId}
 	for _, tag := range it.Tagger().Tags() {
 		n.Tags = append(n.Tags, tag)
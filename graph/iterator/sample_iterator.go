@@ -0,0 +1,290 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// A Sample iterator yields a random sample of the results of its
+// subiterator: at most n of them, each as likely to be chosen as any
+// other, or each result with a given probability. Backends that can draw
+// a sample are asked to; otherwise it is drawn here by reservoir sampling,
+// reading every result. The sample is drawn once, and given again after a
+// Reset, so that checking it agrees with iterating it.
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+type Sample struct {
+	uid      uint64
+	tags     graph.Tagger
+	ts       graph.TripleStore
+	subIt    graph.Iterator
+	n        int64
+	fraction float64
+
+	// The results drawn, once they have been, with the index of each, and
+	// the one being given.
+	drawn   bool
+	results []result
+	indexOf map[graph.Value]int
+	index   int
+	current int
+}
+
+// NewSample returns an iterator over at most n of the results of sub,
+// drawn at random.
+func NewSample(ts graph.TripleStore, sub graph.Iterator, n int64) *Sample {
+	if n < 0 {
+		n = 0
+	}
+	return &Sample{
+		uid:     NextUID(),
+		ts:      ts,
+		subIt:   sub,
+		n:       n,
+		index:   -1,
+		current: -1,
+	}
+}
+
+// NewSampleFraction returns an iterator over the results of sub, each
+// drawn with probability fraction.
+func NewSampleFraction(ts graph.TripleStore, sub graph.Iterator, fraction float64) *Sample {
+	if fraction < 0 {
+		fraction = 0
+	}
+	return &Sample{
+		uid:      NextUID(),
+		ts:       ts,
+		subIt:    sub,
+		fraction: fraction,
+		index:    -1,
+		current:  -1,
+	}
+}
+
+func (it *Sample) UID() uint64 {
+	return it.uid
+}
+
+// draw draws the sample, asking the subiterator to draw it if it can.
+func (it *Sample) draw() {
+	it.drawn = true
+	it.indexOf = make(map[graph.Value]int)
+	if it.n == 0 && it.fraction == 0 {
+		return
+	}
+	pushed := it.push()
+	var seen int64
+	for graph.Next(it.subIt) {
+		seen++
+		i := len(it.results)
+		switch {
+		case pushed:
+		case it.n == 0:
+			if rand.Float64() >= it.fraction {
+				continue
+			}
+		case int64(len(it.results)) >= it.n:
+			// Each result read so far stays in the sample with
+			// probability n/seen.
+			j := rand.Int63n(seen)
+			if j >= it.n {
+				continue
+			}
+			i = int(j)
+		}
+		r := result{id: it.subIt.Result(), tags: make(map[string]graph.Value)}
+		it.subIt.TagResults(r.tags)
+		if i == len(it.results) {
+			it.results = append(it.results, r)
+		} else {
+			it.results[i] = r
+		}
+	}
+	for i, r := range it.results {
+		it.indexOf[r.id] = i
+	}
+}
+
+// push asks the subiterator to draw the sample, of the fraction of its
+// results if it knows exactly how many it has.
+func (it *Sample) push() bool {
+	s, ok := it.subIt.(graph.Sampler)
+	if !ok {
+		return false
+	}
+	n := it.n
+	if n == 0 {
+		size, exact := it.subIt.Size()
+		if !exact || it.fraction >= 1 {
+			return false
+		}
+		n = int64(math.Ceil(it.fraction * float64(size)))
+	}
+	return n > 0 && s.SampleBy(n)
+}
+
+// Reset gives the sample drawn again.
+func (it *Sample) Reset() {
+	it.index = -1
+	it.current = -1
+}
+
+func (it *Sample) Close() {
+	it.subIt.Close()
+}
+
+func (it *Sample) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// Clone returns a Sample over a clone of the subiterator, giving the same
+// sample if it has been drawn.
+func (it *Sample) Clone() graph.Iterator {
+	out := NewSample(it.ts, it.subIt.Clone(), it.n)
+	out.fraction = it.fraction
+	out.drawn, out.results, out.indexOf = it.drawn, it.results, it.indexOf
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Sample) Next() bool {
+	graph.NextLogIn(it)
+	if !it.drawn {
+		it.draw()
+	}
+	it.index++
+	if it.index >= len(it.results) {
+		it.index = len(it.results)
+		it.current = -1
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.current = it.index
+	return graph.NextLogOut(it, it.Result(), true)
+}
+
+// DEPRECATED
+func (it *Sample) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *Sample) Result() graph.Value {
+	if it.current < 0 {
+		return nil
+	}
+	return it.results[it.current].id
+}
+
+// NextPath gives no other paths, as the sample keeps only the first path
+// to each result.
+func (it *Sample) NextPath() bool {
+	return false
+}
+
+func (it *Sample) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// Contains checks whether val was drawn, drawing the sample if it has not
+// been.
+func (it *Sample) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.drawn {
+		it.draw()
+	}
+	i, ok := it.indexOf[val]
+	if !ok {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.current = i
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *Sample) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	if it.current < 0 {
+		return
+	}
+	for tag, value := range it.results[it.current].tags {
+		dst[tag] = value
+	}
+}
+
+var sampleType graph.Type
+
+func init() {
+	sampleType = graph.RegisterIterator("sample")
+}
+
+func (it *Sample) Type() graph.Type { return sampleType }
+
+func (it *Sample) DebugString(indent int) string {
+	size := fmt.Sprint(it.n)
+	if it.n == 0 {
+		size = fmt.Sprint(it.fraction)
+	}
+	return fmt.Sprintf("%s(%s %s tags:%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(), size, it.tags.Tags(), it.subIt.DebugString(indent+4))
+}
+
+func (it *Sample) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// Drawing the sample reads every result of the subiterator before the
+// first is given; checking it is then a lookup.
+func (it *Sample) Stats() graph.IteratorStats {
+	stats := it.subIt.Stats()
+	stats.ContainsCost = 1
+	stats.Size, _ = it.Size()
+	return stats
+}
+
+// Size returns the size of the sample, as estimated from the size of the
+// subiterator until it is drawn.
+func (it *Sample) Size() (int64, bool) {
+	if it.drawn {
+		return int64(len(it.results)), true
+	}
+	size, exact := it.subIt.Size()
+	if it.n == 0 {
+		if it.fraction >= 1 {
+			return size, exact
+		}
+		return int64(math.Ceil(it.fraction * float64(size))), false
+	}
+	if size > it.n {
+		return it.n, exact
+	}
+	return size, exact
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func fixedRange(n int) *Fixed {
+	f := newFixed()
+	for i := 0; i < n; i++ {
+		f.Add(i)
+	}
+	return f
+}
+
+func TestSample(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		it      *Sample
+		min     int
+		max     int
+	}{
+		{message: "draw fewer than there are", it: NewSample(nil, fixedRange(100), 10), min: 10, max: 10},
+		{message: "draw more than there are", it: NewSample(nil, fixedRange(100), 200), min: 100, max: 100},
+		{message: "draw none", it: NewSample(nil, fixedRange(100), 0)},
+		{message: "draw a fraction", it: NewSampleFraction(nil, fixedRange(1000), 0.5), min: 350, max: 650},
+	} {
+		got := iterated(test.it)
+		if len(got) < test.min || len(got) > test.max {
+			t.Errorf("Unexpected size of sample to %s, got:%d expect:%d-%d", test.message, len(got), test.min, test.max)
+		}
+		drawn := make(map[int]bool)
+		for _, v := range got {
+			if v < 0 || v >= 1000 || drawn[v] {
+				t.Errorf("Unexpected result of sample to %s: %d", test.message, v)
+			}
+			drawn[v] = true
+		}
+
+		// The sample is drawn once, and checking it agrees.
+		test.it.Reset()
+		if again := iterated(test.it); !reflect.DeepEqual(again, got) {
+			t.Errorf("Unexpected sample after reset to %s, got:%v expect:%v", test.message, again, got)
+		}
+		for v := 0; v < 1000; v++ {
+			if test.it.Contains(v) != drawn[v] {
+				t.Errorf("Unexpected check of %d in sample to %s, got:%t expect:%t", v, test.message, !drawn[v], drawn[v])
+			}
+		}
+	}
+}
+
+// samplingFixed draws a sample of its values itself, keeping the first n,
+// as a graph.Sampler does.
+type samplingFixed struct {
+	*Fixed
+	n int64
+}
+
+func (f *samplingFixed) SampleBy(n int64) bool {
+	f.n = n
+	f.values = f.values[:n]
+	return true
+}
+
+func TestSamplePush(t *testing.T) {
+	var _ graph.Sampler = &samplingFixed{}
+	for _, test := range []struct {
+		message string
+		sample  func(graph.Iterator) *Sample
+		expect  int64
+	}{
+		{
+			message: "push a size",
+			sample:  func(sub graph.Iterator) *Sample { return NewSample(nil, sub, 5) },
+			expect:  5,
+		},
+		{
+			message: "push a fraction of an exact size",
+			sample:  func(sub graph.Iterator) *Sample { return NewSampleFraction(nil, sub, 0.25) },
+			expect:  25,
+		},
+	} {
+		sub := &samplingFixed{Fixed: fixedRange(100)}
+		got := iterated(test.sample(sub))
+		if sub.n != test.expect {
+			t.Errorf("Unexpected sample size pushed to %s, got:%d expect:%d", test.message, sub.n, test.expect)
+		}
+		if int64(len(got)) != test.expect {
+			t.Errorf("Unexpected size of pushed sample to %s, got:%d expect:%d", test.message, len(got), test.expect)
+		}
+	}
+}
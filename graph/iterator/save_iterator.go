@@ -0,0 +1,166 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the Save iterator, which tags a node of each triple it passes.
+//
+// Tagging a node of a triple would otherwise take a LinksTo from an
+// iterator over every node, tagged, joined with the triples; the LinksTo
+// costs a lookup of the node for each triple. A Save reads the node from the
+// triple itself, with TripleDirection, so that a traversal that crosses any
+// predicate can say which one it crossed for no more than it costs to cross
+// it.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// A Save iterator yields the triples of its subiterator, tagging the node
+// of each in one direction with its save tags.
+type Save struct {
+	uid      uint64
+	tags     graph.Tagger
+	ts       graph.TripleStore
+	subIt    graph.Iterator
+	dir      quad.Direction
+	saveTags []string
+}
+
+// NewSave returns an iterator over the triples of subIt that tags the node
+// of each in direction d with saveTags.
+func NewSave(ts graph.TripleStore, subIt graph.Iterator, d quad.Direction, saveTags ...string) *Save {
+	return &Save{
+		uid:      NextUID(),
+		ts:       ts,
+		subIt:    subIt,
+		dir:      d,
+		saveTags: saveTags,
+	}
+}
+
+func (it *Save) UID() uint64 {
+	return it.uid
+}
+
+func (it *Save) Reset() {
+	it.subIt.Reset()
+}
+
+func (it *Save) Rewind() {
+	graph.Rewind(it.subIt)
+}
+
+func (it *Save) Close() {
+	it.subIt.Close()
+}
+
+func (it *Save) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// TagResults tags the result, its node in the saved direction, and the
+// results tagged by the subiterator.
+func (it *Save) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	node := it.ts.TripleDirection(it.Result(), it.dir)
+	for _, tag := range it.saveTags {
+		dst[tag] = node
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *Save) Clone() graph.Iterator {
+	out := NewSave(it.ts, it.subIt.Clone(), it.dir, it.saveTags...)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Save) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Save) Next() bool {
+	graph.NextLogIn(it)
+	if graph.Next(it.subIt) {
+		return graph.NextLogOut(it, it.Result(), true)
+	}
+	return graph.NextLogOut(it, nil, false)
+}
+
+// DEPRECATED
+func (it *Save) ResultTree() *graph.ResultTree {
+	tree := graph.NewResultTree(it.Result())
+	tree.AddSubtree(it.subIt.ResultTree())
+	return tree
+}
+
+func (it *Save) Result() graph.Value {
+	return it.subIt.Result()
+}
+
+func (it *Save) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	return graph.ContainsLogOut(it, val, it.subIt.Contains(val))
+}
+
+func (it *Save) NextPath() bool {
+	return it.subIt.NextPath()
+}
+
+// Optimize optimizes the subiterator, and replaces it if it can be. The
+// Save itself stays, as nothing else would tag its nodes.
+func (it *Save) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// Save costs as much as its subiterator. Reading the node of a triple costs
+// nothing more that the triple store did not already pay to yield it.
+func (it *Save) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
+
+func (it *Save) Size() (int64, bool) {
+	return it.subIt.Size()
+}
+
+func (it *Save) Type() graph.Type { return graph.Save }
+
+func (it *Save) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s %s tags:%s save:%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.dir,
+		it.tags.Tags(),
+		it.saveTags,
+		it.subIt.DebugString(indent+4))
+}
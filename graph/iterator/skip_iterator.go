@@ -0,0 +1,215 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the Skip and Limit iterators, which together cut a window out of
+// the results of their subiterator.
+//
+// Both count the results of Next() only. The paths of a result, as found by
+// NextPath(), belong to that result and are passed along with it, so
+// Skip(n) drops the first n results with all of their paths, and Limit(n)
+// yields every path of each of the first n results.
+//
+// A Skip over a Limit, or a Limit over a Skip, applies its window to the
+// results of the one below it, so Limit(m) over Skip(n) yields results
+// n+1 to n+m, while Skip(n) over Limit(m) yields results n+1 to m. Stores
+// that push a window down to their own queries must keep this order.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+// A Skip iterator drops the first n results of its subiterator.
+type Skip struct {
+	uid     uint64
+	tags    graph.Tagger
+	ts      graph.TripleStore
+	subIt   graph.Iterator
+	n       int64
+	skipped int64
+	result  graph.Value
+}
+
+func NewSkip(ts graph.TripleStore, subIt graph.Iterator, n int64) *Skip {
+	if n < 0 {
+		n = 0
+	}
+	return &Skip{
+		uid:   NextUID(),
+		ts:    ts,
+		subIt: subIt,
+		n:     n,
+	}
+}
+
+func (it *Skip) UID() uint64 {
+	return it.uid
+}
+
+// Offset returns the number of results the iterator drops.
+func (it *Skip) Offset() int64 {
+	return it.n
+}
+
+func (it *Skip) Reset() {
+	it.subIt.Reset()
+	it.skipped = 0
+}
+
+func (it *Skip) Close() {
+	it.subIt.Close()
+}
+
+func (it *Skip) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Skip) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *Skip) Clone() graph.Iterator {
+	out := NewSkip(it.ts, it.subIt.Clone(), it.n)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Skip) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// Next drops any results that remain to be skipped, then advances the
+// subiterator.
+func (it *Skip) Next() bool {
+	graph.NextLogIn(it)
+	for ; it.skipped < it.n; it.skipped++ {
+		if !graph.Next(it.subIt) {
+			return graph.NextLogOut(it, nil, false)
+		}
+	}
+	if !graph.Next(it.subIt) {
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.result = it.subIt.Result()
+	return graph.NextLogOut(it, it.result, true)
+}
+
+// DEPRECATED
+func (it *Skip) ResultTree() *graph.ResultTree {
+	tree := graph.NewResultTree(it.Result())
+	tree.AddSubtree(it.subIt.ResultTree())
+	return tree
+}
+
+func (it *Skip) Result() graph.Value {
+	return it.result
+}
+
+// Contains checks whether val is one of the results after the skipped ones.
+// Where a result falls is only known by iterating, so this walks a clone
+// of the iterator.
+func (it *Skip) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if windowContains(it, val) && it.subIt.Contains(val) {
+		it.result = val
+		return graph.ContainsLogOut(it, val, true)
+	}
+	return graph.ContainsLogOut(it, val, false)
+}
+
+// windowContains returns whether a clone of it yields val.
+func windowContains(it graph.Iterator, val graph.Value) bool {
+	key := val
+	if k, ok := val.(Keyer); ok {
+		key = k.Key()
+	}
+	c := it.Clone()
+	defer c.Close()
+	for graph.Next(c) {
+		curr := c.Result()
+		if k, ok := curr.(Keyer); ok {
+			if k.Key() == key {
+				return true
+			}
+		} else if curr == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *Skip) NextPath() bool {
+	return it.subIt.NextPath()
+}
+
+// Optimize optimizes the subiterator, then lets the triple store replace
+// the Skip, for instance by skipping within its own query.
+func (it *Skip) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	newReplacement, hasOne := it.ts.OptimizeIterator(it)
+	if hasOne {
+		return newReplacement, true
+	}
+	return it, false
+}
+
+// Skip costs as much as its subiterator to Next, plus the results it drops,
+// but a Contains needs a walk of the window.
+func (it *Skip) Stats() graph.IteratorStats {
+	subStats := it.subIt.Stats()
+	size, _ := it.Size()
+	return graph.IteratorStats{
+		ContainsCost: subStats.NextCost * subStats.Size,
+		NextCost:     subStats.NextCost,
+		Size:         size,
+	}
+}
+
+// Size returns the size of the subiterator less the skipped results.
+func (it *Skip) Size() (int64, bool) {
+	size, exact := it.subIt.Size()
+	size -= it.n
+	if size < 0 {
+		size = 0
+	}
+	return size, exact
+}
+
+func (it *Skip) Type() graph.Type { return graph.Skip }
+
+func (it *Skip) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s %d tags:%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.n,
+		it.tags.Tags(),
+		it.subIt.DebugString(indent+4))
+}
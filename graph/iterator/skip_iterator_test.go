@@ -0,0 +1,103 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func numbers(n int) *Fixed {
+	f := newFixed()
+	for i := 1; i <= n; i++ {
+		f.Add(i)
+	}
+	return f
+}
+
+var windowTests = []struct {
+	message string
+	window  func(graph.Iterator) graph.Iterator
+	expect  []int
+}{
+	{
+		message: "skip some results",
+		window: func(it graph.Iterator) graph.Iterator {
+			return NewSkip(&store{}, it, 3)
+		},
+		expect: []int{4, 5, 6, 7, 8, 9, 10},
+	},
+	{
+		message: "limit the results",
+		window: func(it graph.Iterator) graph.Iterator {
+			return NewLimit(&store{}, it, 3)
+		},
+		expect: []int{1, 2, 3},
+	},
+	{
+		message: "limit skipped results",
+		window: func(it graph.Iterator) graph.Iterator {
+			return NewLimit(&store{}, NewSkip(&store{}, it, 2), 5)
+		},
+		expect: []int{3, 4, 5, 6, 7},
+	},
+	{
+		message: "skip limited results",
+		window: func(it graph.Iterator) graph.Iterator {
+			return NewSkip(&store{}, NewLimit(&store{}, it, 5), 2)
+		},
+		expect: []int{3, 4, 5},
+	},
+	{
+		message: "skip past the end",
+		window: func(it graph.Iterator) graph.Iterator {
+			return NewSkip(&store{}, it, 20)
+		},
+		expect: nil,
+	},
+	{
+		message: "limit to nothing",
+		window: func(it graph.Iterator) graph.Iterator {
+			return NewLimit(&store{}, it, 0)
+		},
+		expect: nil,
+	},
+}
+
+func TestWindowIterators(t *testing.T) {
+	for _, test := range windowTests {
+		it := test.window(numbers(10))
+		for i := 0; i < 2; i++ {
+			if got := iterated(it); !reflect.DeepEqual(got, test.expect) {
+				t.Errorf("Failed to %s on repeat %d, got:%v expect:%v", test.message, i, got, test.expect)
+			}
+			it.Reset()
+		}
+		if size, _ := it.Size(); size != int64(len(test.expect)) {
+			t.Errorf("Failed to %s, unexpected size, got:%d expect:%d", test.message, size, len(test.expect))
+		}
+		for v := 0; v <= 11; v++ {
+			expect := false
+			for _, e := range test.expect {
+				expect = expect || e == v
+			}
+			if got := it.Contains(v); got != expect {
+				t.Errorf("Failed to %s, unexpected Contains(%d), got:%t expect:%t", test.message, v, got, expect)
+			}
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// A Sort iterator yields the triples of its subiterator in order of the
+// names of one or more directions, each ascending or descending, breaking
+// ties on the names of the others, so that every backend gives tied
+// triples in the same order. Backends that can sort are asked to;
+// otherwise the triples are gathered and sorted here.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// SortOrder returns the directions triples sorted by d are ordered on: d,
+// then the others as subject, predicate, object and label. Names are
+// compared by their bytes, and two triples are never tied on all four.
+func SortOrder(d quad.Direction) []quad.Direction {
+	order := []quad.Direction{d}
+	for o := quad.Subject; o <= quad.Label; o++ {
+		if o != d {
+			order = append(order, o)
+		}
+	}
+	return order
+}
+
+// SortKeys returns the keys triples sorted on keys are ordered on: keys,
+// then each direction they leave out, ascending, as subject, predicate,
+// object and label, as SortOrder gives them.
+func SortKeys(keys []graph.SortKey) []graph.SortKey {
+	var keyed [quad.Label + 1]bool
+	order := append([]graph.SortKey(nil), keys...)
+	for _, k := range keys {
+		if k.Dir >= quad.Subject && k.Dir <= quad.Label {
+			keyed[k.Dir] = true
+		}
+	}
+	for d := quad.Subject; d <= quad.Label; d++ {
+		if !keyed[d] {
+			order = append(order, graph.SortKey{Dir: d})
+		}
+	}
+	return order
+}
+
+type Sort struct {
+	uid   uint64
+	tags  graph.Tagger
+	ts    graph.TripleStore
+	subIt graph.Iterator
+	keys  []graph.SortKey
+
+	// Whether the subiterator sorts its own results, which it is asked
+	// to do before it is first iterated, and otherwise the results it
+	// gave, sorted.
+	started bool
+	pushed  bool
+	results []result
+	index   int
+}
+
+// NewSort returns an iterator over the triples of sub in the order given
+// by SortOrder(d).
+func NewSort(ts graph.TripleStore, sub graph.Iterator, d quad.Direction) *Sort {
+	return NewSortByKeys(ts, sub, []graph.SortKey{{Dir: d}})
+}
+
+// NewSortByKeys returns an iterator over the triples of sub in the order
+// given by SortKeys(keys), such as by last name then by first name.
+func NewSortByKeys(ts graph.TripleStore, sub graph.Iterator, keys []graph.SortKey) *Sort {
+	return &Sort{
+		uid:   NextUID(),
+		ts:    ts,
+		subIt: sub,
+		keys:  keys,
+		index: -1,
+	}
+}
+
+func (it *Sort) UID() uint64 {
+	return it.uid
+}
+
+// start asks the subiterator to sort its results, and, if it cannot, reads
+// and sorts them.
+func (it *Sort) start() {
+	it.started = true
+	if it.push() {
+		it.pushed = true
+		return
+	}
+	s := byOrder{order: SortKeys(it.keys)}
+	for graph.Next(it.subIt) {
+		r := result{id: it.subIt.Result(), tags: make(map[string]graph.Value)}
+		it.subIt.TagResults(r.tags)
+		s.results = append(s.results, r)
+		s.quads = append(s.quads, it.ts.Quad(r.id))
+	}
+	sort.Sort(s)
+	it.results = s.results
+}
+
+// push asks the subiterator to sort its own results, on every key at once
+// if it can, or else on a single ascending key.
+func (it *Sort) push() bool {
+	if s, ok := it.subIt.(graph.KeySorter); ok && s.SortByKeys(it.keys) {
+		return true
+	}
+	if len(it.keys) != 1 || it.keys[0].Descending {
+		return false
+	}
+	s, ok := it.subIt.(graph.Sorter)
+	return ok && s.SortBy(it.keys[0].Dir)
+}
+
+// byOrder sorts results by their triples, in order of the names of the
+// directions of the keys of order.
+type byOrder struct {
+	results []result
+	quads   []quad.Quad
+	order   []graph.SortKey
+}
+
+func (s byOrder) Len() int { return len(s.results) }
+func (s byOrder) Less(i, j int) bool {
+	for _, k := range s.order {
+		a, b := s.quads[i].Get(k.Dir), s.quads[j].Get(k.Dir)
+		if a != b {
+			return a < b != k.Descending
+		}
+	}
+	return false
+}
+func (s byOrder) Swap(i, j int) {
+	s.results[i], s.results[j] = s.results[j], s.results[i]
+	s.quads[i], s.quads[j] = s.quads[j], s.quads[i]
+}
+
+// Reset reads the subiterator afresh, sorting it again unless it sorts
+// itself.
+func (it *Sort) Reset() {
+	it.subIt.Reset()
+	it.started = it.pushed
+	it.results = nil
+	it.index = -1
+}
+
+func (it *Sort) Rewind() {
+	graph.Rewind(it.subIt)
+}
+
+func (it *Sort) Close() {
+	it.subIt.Close()
+}
+
+func (it *Sort) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// Clone returns a Sort over a clone of the subiterator, which has not
+// been asked to sort itself.
+func (it *Sort) Clone() graph.Iterator {
+	out := NewSortByKeys(it.ts, it.subIt.Clone(), it.keys)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Sort) Next() bool {
+	graph.NextLogIn(it)
+	if !it.started {
+		it.start()
+	}
+	if it.pushed {
+		if !graph.Next(it.subIt) {
+			return graph.NextLogOut(it, nil, false)
+		}
+		return graph.NextLogOut(it, it.subIt.Result(), true)
+	}
+	it.index++
+	if it.index >= len(it.results) {
+		it.index = len(it.results)
+		return graph.NextLogOut(it, nil, false)
+	}
+	return graph.NextLogOut(it, it.Result(), true)
+}
+
+// DEPRECATED
+func (it *Sort) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *Sort) Result() graph.Value {
+	if it.pushed {
+		return it.subIt.Result()
+	}
+	if it.index < 0 || it.index >= len(it.results) {
+		return nil
+	}
+	return it.results[it.index].id
+}
+
+// NextPath gives the other paths of a sorting subiterator. The sorted
+// results keep only the first path to each.
+func (it *Sort) NextPath() bool {
+	if it.pushed {
+		return it.subIt.NextPath()
+	}
+	return false
+}
+
+func (it *Sort) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// Contains checks the subiterator, which the order does not change.
+func (it *Sort) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.subIt.Contains(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *Sort) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	if it.pushed || it.index < 0 || it.index >= len(it.results) {
+		it.subIt.TagResults(dst)
+		return
+	}
+	for tag, value := range it.results[it.index].tags {
+		dst[tag] = value
+	}
+}
+
+var sortType graph.Type
+
+func init() {
+	sortType = graph.RegisterIterator("sort")
+}
+
+func (it *Sort) Type() graph.Type { return sortType }
+
+func (it *Sort) DebugString(indent int) string {
+	keys := make([]string, len(it.keys))
+	for i, k := range it.keys {
+		keys[i] = k.Dir.String()
+		if k.Descending {
+			keys[i] = "-" + keys[i]
+		}
+	}
+	return fmt.Sprintf("%s(%s %s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(), strings.Join(keys, ","), it.subIt.DebugString(indent+4))
+}
+
+func (it *Sort) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// Sorting here reads every triple before the first is given, and names
+// each, which is charged at a name lookup each.
+func (it *Sort) Stats() graph.IteratorStats {
+	stats := it.subIt.Stats()
+	stats.NextCost += 1
+	return stats
+}
+
+func (it *Sort) Size() (int64, bool) {
+	return it.subIt.Size()
+}
@@ -0,0 +1,117 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Unique and Materialize iterators hold what they have seen in memory. A
+// store that can hold it elsewhere is a Spiller, and the iterators of a
+// query spill to it once they have seen more than it allows.
+
+import (
+	"github.com/google/cayley/graph"
+)
+
+// A Spill holds a set of keys outside of memory. The keys are results, or
+// for results that are Keyers, their Key.
+type Spill interface {
+	// Add adds key to the set, returning whether it was not already
+	// there. It is a single write, which fails for a key already held.
+	Add(key interface{}) (bool, error)
+
+	// AddAll adds keys, which are distinct and none of which are in the
+	// set, writing them in batches.
+	AddAll(keys []interface{}) error
+
+	// Close discards the set.
+	Close() error
+}
+
+// A SpillFunc returns a new, empty Spill.
+type SpillFunc func() (Spill, error)
+
+// A SpilledResult is a result held in a SpillList, with the tags of its
+// path.
+type SpilledResult struct {
+	Result graph.Value
+	Tags   map[string]graph.Value
+}
+
+// A SpillList holds the results of an iterator outside of memory, each
+// under a key that tells it apart from results that are not equal to it.
+type SpillList interface {
+	// Append adds r under key. Results may be held back, to be written
+	// in batches, until they are read.
+	Append(key interface{}, r SpilledResult) error
+
+	// Results returns a cursor over the results, those under each key
+	// read together in the order they were appended.
+	Results() (SpillCursor, error)
+
+	// Find returns the results under key, in the order they were
+	// appended, or none if there are none.
+	Find(key interface{}) ([]SpilledResult, error)
+
+	// Close discards the results.
+	Close() error
+}
+
+// A SpillListFunc returns a new, empty SpillList.
+type SpillListFunc func() (SpillList, error)
+
+// A SpillCursor reads the results of a SpillList, one key at a time.
+type SpillCursor interface {
+	// Next reads the results under the next key into group, returning
+	// false when there are no more keys or on error.
+	Next(group *[]SpilledResult) bool
+
+	// Close closes the cursor, returning the error that stopped it, if
+	// any.
+	Close() error
+}
+
+// A Spiller is a TripleStore that can hold the sets of Unique and
+// Materialize iterators outside of memory.
+type Spiller interface {
+	// SpillAt returns the number of results an iterator may hold in
+	// memory before it spills them, or 0 if iterators never spill.
+	SpillAt() int
+
+	NewSpill() (Spill, error)
+	NewSpillList() (SpillList, error)
+}
+
+// UseSpill makes every Unique and Materialize iterator in the tree of it
+// spill to ts, once it holds more results than ts allows, if ts is a
+// Spiller that spills. It is called on the optimized tree of a query.
+func UseSpill(ts graph.TripleStore, it graph.Iterator) {
+	s, ok := ts.(Spiller)
+	if !ok || s.SpillAt() <= 0 {
+		return
+	}
+	useSpill(s, it)
+}
+
+func useSpill(s Spiller, it graph.Iterator) {
+	switch it := it.(type) {
+	case *Unique:
+		it.SpillAt(s.SpillAt(), s.NewSpill)
+	case *Union:
+		it.SpillAt(s.SpillAt(), s.NewSpill)
+	case *Materialize:
+		it.SpillAt(s.SpillAt(), s.NewSpillList)
+	}
+	for _, sub := range it.SubIterators() {
+		useSpill(s, sub)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// A TextMatch iterator filters triples on the name of their objects, finding
+// those that contain any of the words searched for. It is the fallback for
+// stores that cannot search text themselves, and reads every name it is
+// given, so stores that can should do so.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// TextPattern returns a regular expression matching any of the words of
+// text, as whole words and ignoring case, or "" if text has no words. The
+// expression is in the syntax shared by Go and MongoDB.
+func TextPattern(text string) string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return ""
+	}
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	// Words may start or end with punctuation, which \b would not
+	// separate from the punctuation beside it.
+	return `(?i)(^|\W)(` + strings.Join(words, "|") + `)(\W|$)`
+}
+
+// TextSearch returns an iterator over the triples in ts whose objects match
+// any of the words of text. If ts is a graph.TextSearcher with
+// graph.CapTextSearch, it is asked for the iterator, which may rank its
+// results and tag them with their scores under scoreTag. Otherwise every
+// triple is filtered through a TextMatch iterator, in the order of the
+// store and without scores.
+func TextSearch(ts graph.TripleStore, text, scoreTag string) graph.Iterator {
+	if s, ok := ts.(graph.TextSearcher); ok && graph.CapabilitiesOf(ts).Has(graph.CapTextSearch) {
+		return s.TextSearch(text, scoreTag)
+	}
+	pattern := TextPattern(text)
+	if pattern == "" {
+		return NewNull()
+	}
+	return NewTextMatch(ts.TriplesAllIterator(), regexp.MustCompile(pattern), ts)
+}
+
+type TextMatch struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	re     *regexp.Regexp
+	ts     graph.TripleStore
+	result graph.Value
+}
+
+// NewTextMatch returns an iterator over the triples of sub whose objects
+// are matched by re.
+func NewTextMatch(sub graph.Iterator, re *regexp.Regexp, ts graph.TripleStore) *TextMatch {
+	return &TextMatch{
+		uid:   NextUID(),
+		subIt: sub,
+		re:    re,
+		ts:    ts,
+	}
+}
+
+func (it *TextMatch) UID() uint64 {
+	return it.uid
+}
+
+func (it *TextMatch) matches(val graph.Value) bool {
+	return it.re.MatchString(it.ts.NameOf(it.ts.TripleDirection(val, quad.Object)))
+}
+
+func (it *TextMatch) Close() {
+	it.subIt.Close()
+}
+
+func (it *TextMatch) Reset() {
+	it.subIt.Reset()
+}
+
+func (it *TextMatch) Rewind() {
+	graph.Rewind(it.subIt)
+}
+
+func (it *TextMatch) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *TextMatch) Clone() graph.Iterator {
+	out := NewTextMatch(it.subIt.Clone(), it.re, it.ts)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *TextMatch) Next() bool {
+	for graph.Next(it.subIt) {
+		val := it.subIt.Result()
+		if it.matches(val) {
+			it.result = val
+			return true
+		}
+	}
+	return false
+}
+
+// DEPRECATED
+func (it *TextMatch) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *TextMatch) Result() graph.Value {
+	return it.result
+}
+
+func (it *TextMatch) NextPath() bool {
+	for it.subIt.NextPath() {
+		if it.matches(it.subIt.Result()) {
+			it.result = it.subIt.Result()
+			return true
+		}
+	}
+	return false
+}
+
+func (it *TextMatch) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *TextMatch) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if !it.matches(val) || !it.subIt.Contains(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *TextMatch) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+var textMatchType graph.Type
+
+func init() {
+	textMatchType = graph.RegisterIterator("text_match")
+}
+
+func (it *TextMatch) Type() graph.Type { return textMatchType }
+
+func (it *TextMatch) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s %q\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(), it.re, it.subIt.DebugString(indent+4))
+}
+
+func (it *TextMatch) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// Every triple given is read, and its object named, to find those that
+// match, which is charged at a name lookup each.
+func (it *TextMatch) Stats() graph.IteratorStats {
+	stats := it.subIt.Stats()
+	stats.NextCost += 1
+	stats.ContainsCost += 1
+	return stats
+}
+
+// The size of the subiterator is an upper bound.
+func (it *TextMatch) Size() (int64, bool) {
+	size, _ := it.subIt.Size()
+	return size, false
+}
@@ -0,0 +1,82 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Defines the Union iterator, which yields each result of any of its
+// subiterators once.
+//
+// A Union is a Unique over an Or of its subiterators until it is optimized.
+// The Or of its optimized subiterators is then offered to its triple store,
+// which may find some or all of their results with one query of its own,
+// before the Union gives way to a Unique over whichever Or results.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+type Union struct {
+	*Unique
+	ts graph.TripleStore
+	or *Or
+}
+
+func NewUnion(ts graph.TripleStore, its ...graph.Iterator) *Union {
+	or := NewOr()
+	for _, sub := range its {
+		or.AddSubIterator(sub)
+	}
+	return &Union{Unique: NewUnique(or), ts: ts, or: or}
+}
+
+func (it *Union) Clone() graph.Iterator {
+	subs := it.or.SubIterators()
+	clones := make([]graph.Iterator, len(subs))
+	for i, sub := range subs {
+		clones[i] = sub.Clone()
+	}
+	out := NewUnion(it.ts, clones...)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Union) Optimize() (graph.Iterator, bool) {
+	var or graph.Iterator
+	or, _ = it.or.Optimize()
+	if newOr, ok := it.ts.OptimizeIterator(or); ok {
+		or = newOr
+	}
+	out := NewUnique(or)
+	out.tags.CopyFrom(it)
+	return out, true
+}
+
+var unionType graph.Type
+
+func init() {
+	unionType = graph.RegisterIterator("union")
+}
+
+func (it *Union) Type() graph.Type { return unionType }
+
+func (it *Union) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s tags:%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.tags.Tags(),
+		it.or.DebugString(indent+4))
+}
@@ -0,0 +1,332 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// A Unique iterator passes along each distinct result of its subiterator
+// the first time it is seen, and skips it thereafter. It remembers every
+// result it has passed along, so it costs memory in proportion to the
+// number of distinct results, unless it is allowed to spill them elsewhere.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/barakmich/glog"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// A UniqueKey returns the key that a Unique iterator tells results apart
+// by, given a result and the subiterator that yielded it, as it stands on
+// that result. Keys must be comparable.
+type UniqueKey func(result graph.Value, subIt graph.Iterator) interface{}
+
+// resultKey keys results by themselves, or by their Key if they are
+// Keyers.
+func resultKey(result graph.Value) interface{} {
+	if k, ok := result.(Keyer); ok {
+		return k.Key()
+	}
+	return result
+}
+
+// A TaggedKey is the key of a result told apart by the value of a tag
+// beneath it, as well as by itself.
+type TaggedKey struct {
+	Result interface{}
+	Tagged interface{}
+}
+
+// TagKey returns a UniqueKey that keys results by themselves and the value
+// the subiterator tags with tag, so that results reached through different
+// values of the tag are each passed along. Results without the tag are
+// keyed by themselves and nil.
+func TagKey(tag string) UniqueKey {
+	return func(result graph.Value, subIt graph.Iterator) interface{} {
+		tags := make(map[string]graph.Value)
+		subIt.TagResults(tags)
+		var tagged interface{}
+		if v, ok := tags[tag]; ok {
+			tagged = resultKey(v)
+		}
+		return TaggedKey{Result: resultKey(result), Tagged: tagged}
+	}
+}
+
+// A CompositeKey is the key of a result told apart by the values of
+// several tags beneath it, rather than by itself. It holds the value of
+// the first tag, and the CompositeKey of the rest, or nil after the last.
+type CompositeKey struct {
+	Tagged interface{}
+	Rest   interface{}
+}
+
+// TagsKey returns a UniqueKey that keys results by the values the
+// subiterator tags with each of tags, so that a row whose identity spans
+// several bindings, such as a (person, company) pair, is passed along once
+// whatever node it ends on. Missing tags are keyed by nil.
+func TagsKey(tags ...string) UniqueKey {
+	return func(result graph.Value, subIt graph.Iterator) interface{} {
+		values := make(map[string]graph.Value)
+		subIt.TagResults(values)
+		var key interface{}
+		for i := len(tags) - 1; i >= 0; i-- {
+			var tagged interface{}
+			if v, ok := values[tags[i]]; ok {
+				tagged = resultKey(v)
+			}
+			key = CompositeKey{Tagged: tagged, Rest: key}
+		}
+		return key
+	}
+}
+
+type Unique struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	key    UniqueKey
+	result graph.Value
+	seen   map[interface{}]struct{}
+
+	spillAt  int
+	newSpill SpillFunc
+	spill    Spill
+	err      error
+}
+
+func NewUnique(subIt graph.Iterator) *Unique {
+	return &Unique{
+		uid:   NextUID(),
+		subIt: subIt,
+		seen:  make(map[interface{}]struct{}),
+	}
+}
+
+// NewUniqueBy returns a Unique iterator that tells the results of subIt
+// apart by key rather than by the results themselves.
+func NewUniqueBy(subIt graph.Iterator, key UniqueKey) *Unique {
+	it := NewUnique(subIt)
+	it.key = key
+	return it
+}
+
+// Distinct returns an iterator over every node that is in direction d of
+// some triple in ts, yielding each node once. If ts is a
+// graph.DistinctLister with graph.CapDistinct, it is asked for the
+// iterator; otherwise the nodes of all triples are filtered through a
+// Unique iterator.
+func Distinct(ts graph.TripleStore, d quad.Direction) graph.Iterator {
+	if dl, ok := ts.(graph.DistinctLister); ok && graph.CapabilitiesOf(ts).Has(graph.CapDistinct) {
+		return dl.DistinctIterator(d)
+	}
+	return NewUnique(NewHasA(ts, ts.TriplesAllIterator(), d))
+}
+
+func (it *Unique) UID() uint64 {
+	return it.uid
+}
+
+// SpillAt makes the iterator move the results it has seen into a Spill
+// returned by f once there are more than n of them.
+func (it *Unique) SpillAt(n int, f SpillFunc) {
+	it.spillAt = n
+	it.newSpill = f
+}
+
+func (it *Unique) Reset() {
+	it.subIt.Reset()
+	it.closeSpill()
+	it.seen = make(map[interface{}]struct{})
+	it.err = nil
+}
+
+// Rewind keeps the results seen, which only matter to Next.
+func (it *Unique) Rewind() {
+	graph.Rewind(it.subIt)
+}
+
+func (it *Unique) Close() {
+	it.subIt.Close()
+	it.closeSpill()
+	it.seen = nil
+}
+
+func (it *Unique) closeSpill() {
+	if it.spill == nil {
+		return
+	}
+	if err := it.spill.Close(); err != nil {
+		glog.Errorln("Error closing spill: ", err)
+	}
+	it.spill = nil
+}
+
+func (it *Unique) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Unique) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *Unique) Clone() graph.Iterator {
+	out := NewUniqueBy(it.subIt.Clone(), it.key)
+	out.tags.CopyFrom(it)
+	out.SpillAt(it.spillAt, it.newSpill)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *Unique) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// Next advances the subiterator until it yields a result that has not been
+// seen before. It stops early if the results seen cannot be spilled; see
+// Err.
+func (it *Unique) Next() bool {
+	graph.NextLogIn(it)
+	if it.err != nil {
+		return graph.NextLogOut(it, nil, false)
+	}
+	for graph.Next(it.subIt) {
+		curr := it.subIt.Result()
+		var key interface{}
+		if it.key != nil {
+			key = it.key(curr, it.subIt)
+		} else {
+			key = resultKey(curr)
+		}
+		added, err := it.add(key)
+		if err != nil {
+			it.err = err
+			break
+		}
+		if !added {
+			continue
+		}
+		it.result = curr
+		return graph.NextLogOut(it, curr, true)
+	}
+	return graph.NextLogOut(it, nil, false)
+}
+
+// Err returns the error that stopped the iterator, if any, until it is
+// reset.
+func (it *Unique) Err() error {
+	return it.err
+}
+
+// add records key as seen, returning whether it had not been seen before.
+func (it *Unique) add(key interface{}) (bool, error) {
+	if it.spill != nil {
+		return it.spill.Add(key)
+	}
+	if _, ok := it.seen[key]; ok {
+		return false, nil
+	}
+	it.seen[key] = struct{}{}
+	if it.newSpill == nil || len(it.seen) <= it.spillAt {
+		return true, nil
+	}
+
+	spill, err := it.newSpill()
+	if err != nil {
+		return false, err
+	}
+	keys := make([]interface{}, 0, len(it.seen))
+	for k := range it.seen {
+		keys = append(keys, k)
+	}
+	if err := spill.AddAll(keys); err != nil {
+		spill.Close()
+		return false, err
+	}
+	it.spill = spill
+	it.seen = make(map[interface{}]struct{})
+	return true, nil
+}
+
+// DEPRECATED
+func (it *Unique) ResultTree() *graph.ResultTree {
+	tree := graph.NewResultTree(it.Result())
+	tree.AddSubtree(it.subIt.ResultTree())
+	return tree
+}
+
+func (it *Unique) Result() graph.Value {
+	return it.result
+}
+
+// Contains checks the subiterator, since removing duplicates does not change
+// which values are in the set.
+func (it *Unique) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	if it.subIt.Contains(val) {
+		it.result = val
+		return graph.ContainsLogOut(it, val, true)
+	}
+	return graph.ContainsLogOut(it, val, false)
+}
+
+// NextPath returns false, as further paths would repeat the current result.
+func (it *Unique) NextPath() bool {
+	return false
+}
+
+func (it *Unique) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// Unique is as costly as its subiterator, and at most as large.
+func (it *Unique) Stats() graph.IteratorStats {
+	subStats := it.subIt.Stats()
+	return graph.IteratorStats{
+		ContainsCost: subStats.ContainsCost,
+		NextCost:     subStats.NextCost,
+		Size:         subStats.Size,
+	}
+}
+
+// Size returns the size of the subiterator, which is an upper bound.
+func (it *Unique) Size() (int64, bool) {
+	size, _ := it.subIt.Size()
+	return size, false
+}
+
+func (it *Unique) Type() graph.Type { return graph.Unique }
+
+func (it *Unique) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s tags:%s\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.tags.Tags(),
+		it.subIt.DebugString(indent+4))
+}
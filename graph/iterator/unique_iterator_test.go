@@ -0,0 +1,218 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestUniqueIteratorBasics(t *testing.T) {
+	f := newFixed()
+	for _, v := range []int{1, 2, 2, 3, 1, 4, 3} {
+		f.Add(v)
+	}
+	u := NewUnique(f)
+
+	expect := []int{1, 2, 3, 4}
+	for i := 0; i < 2; i++ {
+		if got := iterated(u); !reflect.DeepEqual(got, expect) {
+			t.Errorf("Failed to iterate Unique correctly on repeat %d, got:%v expect:%v", i, got, expect)
+		}
+		u.Reset()
+	}
+
+	for _, v := range []int{1, 4} {
+		if !u.Contains(v) {
+			t.Errorf("Failed to correctly check %d as true", v)
+		}
+	}
+	for _, v := range []int{0, 5} {
+		if u.Contains(v) {
+			t.Errorf("Failed to correctly check %d as false", v)
+		}
+	}
+}
+
+type testSpill struct {
+	keys    map[interface{}]bool
+	batches int
+	closed  bool
+}
+
+func (s *testSpill) Add(key interface{}) (bool, error) {
+	if s.keys[key] {
+		return false, nil
+	}
+	s.keys[key] = true
+	return true, nil
+}
+
+func (s *testSpill) AddAll(keys []interface{}) error {
+	s.batches++
+	for _, key := range keys {
+		s.keys[key] = true
+	}
+	return nil
+}
+
+func (s *testSpill) Close() error { s.closed = true; return nil }
+
+func TestUniqueIteratorSpill(t *testing.T) {
+	f := newFixed()
+	for _, v := range []int{1, 2, 2, 3, 1, 4, 3, 5, 4} {
+		f.Add(v)
+	}
+	u := NewUnique(f)
+
+	var spills []*testSpill
+	u.SpillAt(2, func() (Spill, error) {
+		s := &testSpill{keys: make(map[interface{}]bool)}
+		spills = append(spills, s)
+		return s, nil
+	})
+
+	expect := []int{1, 2, 3, 4, 5}
+	if got := iterated(u); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate spilled Unique correctly, got:%v expect:%v", got, expect)
+	}
+	if len(spills) != 1 {
+		t.Fatalf("Unexpected number of spills, got:%d expect:1", len(spills))
+	}
+	if spills[0].batches != 1 {
+		t.Errorf("Unexpected number of batches moving results to the spill, got:%d expect:1", spills[0].batches)
+	}
+	if len(spills[0].keys) != len(expect) {
+		t.Errorf("Unexpected number of spilled results, got:%d expect:%d", len(spills[0].keys), len(expect))
+	}
+	if len(u.seen) != 0 {
+		t.Errorf("Spilled results still held in memory, got:%d", len(u.seen))
+	}
+
+	u.Reset()
+	if !spills[0].closed {
+		t.Error("Spill was not discarded on Reset")
+	}
+	if got := iterated(u); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate spilled Unique correctly after Reset, got:%v expect:%v", got, expect)
+	}
+	u.Close()
+	if len(spills) != 2 || !spills[1].closed {
+		t.Error("Spill was not discarded on Close")
+	}
+
+	// A spill that cannot be made stops the iterator, with its error.
+	failed := errors.New("no spill")
+	f = newFixed()
+	for _, v := range []int{1, 2, 2, 3, 1} {
+		f.Add(v)
+	}
+	u = NewUnique(f)
+	u.SpillAt(2, func() (Spill, error) { return nil, failed })
+	if got := iterated(u); !reflect.DeepEqual(got, []int{1, 2}) || u.Err() != failed {
+		t.Errorf("Unexpected results of Unique that cannot spill, got:%v %v expect:[1 2] %v", got, u.Err(), failed)
+	}
+	u.Reset()
+	if u.Err() != nil {
+		t.Errorf("Unexpected error after Reset, got:%v", u.Err())
+	}
+}
+
+// labeled is a Fixed iterator that tags each of its values with the label
+// at the same place in labels.
+type labeled struct {
+	*Fixed
+	labels []graph.Value
+}
+
+func (it *labeled) TagResults(dst map[string]graph.Value) {
+	if l := it.labels[it.lastIndex-1]; l != nil {
+		dst["label"] = l
+	}
+}
+
+func TestUniqueByTag(t *testing.T) {
+	sub := &labeled{Fixed: newFixed()}
+	for _, v := range []struct {
+		node  int
+		label graph.Value
+	}{
+		{1, "a"}, {1, "b"}, {1, "a"}, {2, nil}, {2, nil}, {2, "a"},
+	} {
+		sub.Add(v.node)
+		sub.labels = append(sub.labels, v.label)
+	}
+
+	u := NewUniqueBy(sub, TagKey("label"))
+	if got, expect := iterated(u), []int{1, 1, 2, 2}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate Unique by label, got:%v expect:%v", got, expect)
+	}
+	u.Reset()
+	u.key = nil
+	if got, expect := iterated(u), []int{1, 2}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate Unique by node, got:%v expect:%v", got, expect)
+	}
+}
+
+// rows is a Fixed iterator that tags each of its values with the tags at
+// the same place in tags.
+type rows struct {
+	*Fixed
+	tags []map[string]graph.Value
+}
+
+func (it *rows) TagResults(dst map[string]graph.Value) {
+	for k, v := range it.tags[it.lastIndex-1] {
+		dst[k] = v
+	}
+}
+
+func TestUniqueByTags(t *testing.T) {
+	sub := &rows{Fixed: newFixed()}
+	for _, v := range []struct {
+		node    int
+		person  graph.Value
+		company graph.Value
+	}{
+		{1, "alice", "acme"},
+		{1, "alice", "initech"},
+		{2, "alice", "acme"},
+		{1, "bob", "acme"},
+		{3, "bob", "acme"},
+		{3, "bob", nil},
+	} {
+		sub.Add(v.node)
+		tags := map[string]graph.Value{"person": v.person}
+		if v.company != nil {
+			tags["company"] = v.company
+		}
+		sub.tags = append(sub.tags, tags)
+	}
+
+	// Rows on the same node with different companies are both kept, while
+	// a pair already seen is skipped whichever node it ends on.
+	u := NewUniqueBy(sub, TagsKey("person", "company"))
+	if got, expect := iterated(u), []int{1, 1, 1, 3}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate Unique by person and company, got:%v expect:%v", got, expect)
+	}
+	u.Reset()
+	u.key = TagsKey("person")
+	if got, expect := iterated(u), []int{1, 1}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate Unique by person, got:%v expect:%v", got, expect)
+	}
+}
@@ -117,6 +117,10 @@ func (it *Comparison) Reset() {
 	it.subIt.Reset()
 }
 
+func (it *Comparison) Rewind() {
+	graph.Rewind(it.subIt)
+}
+
 func (it *Comparison) Tagger() *graph.Tagger {
 	return &it.tags
 }
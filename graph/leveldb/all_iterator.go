@@ -101,6 +101,15 @@ func (it *AllIterator) Clone() graph.Iterator {
 	return out
 }
 
+// Spec says which store iterator it is by its direction: the iterator of
+// nodes is made without one.
+func (it *AllIterator) Spec() (graph.IteratorSpec, bool) {
+	if it.dir == quad.Any {
+		return graph.IteratorSpec{Source: graph.NodesAll}, true
+	}
+	return graph.IteratorSpec{Source: graph.TriplesAll}, true
+}
+
 func (it *AllIterator) Next() bool {
 	if !it.open {
 		it.result = nil
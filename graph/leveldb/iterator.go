@@ -90,6 +90,10 @@ func (it *Iterator) Reset() {
 	}
 }
 
+// Rewind does nothing, as Contains is answered from the value checked
+// rather than from the position of the iterator.
+func (it *Iterator) Rewind() {}
+
 func (it *Iterator) Tagger() *graph.Tagger {
 	return &it.tags
 }
@@ -110,6 +114,10 @@ func (it *Iterator) Clone() graph.Iterator {
 	return out
 }
 
+func (it *Iterator) Spec() (graph.IteratorSpec, bool) {
+	return graph.IteratorSpec{Source: graph.Triples, Direction: it.dir, Value: Token(it.checkId)}, true
+}
+
 func (it *Iterator) Close() {
 	if it.open {
 		it.iter.Release()
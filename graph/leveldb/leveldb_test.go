@@ -24,6 +24,8 @@ import (
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
+
+	_ "github.com/google/cayley/graph/memstore"
 )
 
 func makeTripleSet() []quad.Quad {
@@ -436,3 +438,121 @@ func TestOptimize(t *testing.T) {
 		t.Errorf("Discordant tag results, new:%v old:%v", newResults, oldResults)
 	}
 }
+
+func TestDigest(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir(os.TempDir(), "cayley_test")
+	t.Log(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	err := createNewLevelDB(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create working directory")
+	}
+
+	qs, err := newTripleStore(tmpDir, nil)
+	if qs == nil || err != nil {
+		t.Fatal("Failed to create leveldb TripleStore.")
+	}
+	defer qs.Close()
+	qs.AddTripleSet(makeTripleSet())
+
+	ms, err := graph.NewTripleStore("memstore", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to create memstore TripleStore: %v", err)
+	}
+	defer ms.Close()
+	ms.AddTripleSet(makeTripleSet())
+
+	// Everything that follows something cool, tagged with what it follows.
+	query := func(ts graph.TripleStore) graph.Iterator {
+		fixed := ts.FixedIterator()
+		fixed.Add(ts.ValueOf("cool"))
+		cool := iterator.NewHasA(ts, iterator.NewLinksTo(ts, fixed, quad.Object), quad.Subject)
+		cool.Tagger().Add("followed")
+		return iterator.NewHasA(ts, iterator.NewLinksTo(ts, cool, quad.Object), quad.Subject)
+	}
+
+	got, expect := graph.Digest(qs, query(qs)), graph.Digest(ms, query(ms))
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Digests differ between backends, got:%x expect:%x", got, expect)
+	}
+}
+
+var quadExistsTests = []struct {
+	message string
+	quad    quad.Quad
+	expect  bool
+}{
+	{
+		message: "find a present triple",
+		quad:    quad.Quad{"C", "follows", "D", ""},
+		expect:  true,
+	},
+	{
+		message: "find a present labeled triple",
+		quad:    quad.Quad{"G", "status", "cool", "status_graph"},
+		expect:  true,
+	},
+	{
+		message: "not find an absent triple",
+		quad:    quad.Quad{"D", "follows", "C", ""},
+		expect:  false,
+	},
+	{
+		message: "not find a triple with a differing label",
+		quad:    quad.Quad{"G", "status", "cool", "other_graph"},
+		expect:  false,
+	},
+	{
+		message: "not find an unlabeled version of a labeled triple",
+		quad:    quad.Quad{"G", "status", "cool", ""},
+		expect:  false,
+	},
+}
+
+func TestQuadExists(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir(os.TempDir(), "cayley_test")
+	defer os.RemoveAll(tmpDir)
+	err := createNewLevelDB(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create working directory")
+	}
+
+	ts, err := newTripleStore(tmpDir, nil)
+	if ts == nil || err != nil {
+		t.Fatal("Failed to create leveldb TripleStore.")
+	}
+	defer ts.Close()
+	ts.AddTripleSet(makeTripleSet())
+
+	for _, test := range quadExistsTests {
+		got, err := ts.QuadExists(test.quad)
+		if err != nil {
+			t.Errorf("Failed to %s, unexpected error: %v", test.message, err)
+		}
+		if got != test.expect {
+			t.Errorf("Failed to %s, got:%t expect:%t", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestDistinctSubjects(t *testing.T) {
+	tmpDir, _ := ioutil.TempDir(os.TempDir(), "cayley_test")
+	defer os.RemoveAll(tmpDir)
+	err := createNewLevelDB(tmpDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to create working directory")
+	}
+
+	qs, err := newTripleStore(tmpDir, nil)
+	if qs == nil || err != nil {
+		t.Fatal("Failed to create leveldb TripleStore.")
+	}
+	defer qs.Close()
+	qs.AddTripleSet(makeTripleSet())
+
+	got := iteratedNames(qs, iterator.Distinct(qs, quad.Subject))
+	expect := []string{"A", "B", "C", "D", "E", "F", "G"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected distinct subjects, got:%q expect:%q", got, expect)
+	}
+}
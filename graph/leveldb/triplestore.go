@@ -298,20 +298,31 @@ func (qs *TripleStore) AddTripleSet(t_s []quad.Quad) {
 }
 
 func (qs *TripleStore) Close() {
-	buf := new(bytes.Buffer)
-	err := binary.Write(buf, binary.LittleEndian, qs.size)
-	if err == nil {
-		werr := qs.db.Put([]byte("__size"), buf.Bytes(), qs.writeopts)
-		if werr != nil {
-			glog.Error("Couldn't write size before closing!")
-		}
-	} else {
-		glog.Errorf("Couldn't convert size before closing!")
+	if err := qs.writeSize(qs.writeopts); err != nil {
+		glog.Errorf("Couldn't write size before closing! %v", err)
 	}
 	qs.db.Close()
 	qs.open = false
 }
 
+// writeSize writes the number of triples, which is otherwise only written
+// on closing.
+func (qs *TripleStore) writeSize(wo *opt.WriteOptions) error {
+	buf := new(bytes.Buffer)
+	err := binary.Write(buf, binary.LittleEndian, qs.size)
+	if err != nil {
+		return err
+	}
+	return qs.db.Put([]byte("__size"), buf.Bytes(), wo)
+}
+
+// Flush writes the number of triples with a synced write, which syncs the
+// journal holding every write before it. Writes are otherwise left for the
+// operating system to write back.
+func (qs *TripleStore) Flush() error {
+	return qs.writeSize(&opt.WriteOptions{Sync: true})
+}
+
 func (qs *TripleStore) Quad(k graph.Value) quad.Quad {
 	var triple quad.Quad
 	b, err := qs.db.Get(k.(Token), qs.readopts)
@@ -331,6 +342,23 @@ func (qs *TripleStore) Quad(k graph.Value) quad.Quad {
 	return triple
 }
 
+func (qs *TripleStore) QuadExists(t quad.Quad) (bool, error) {
+	b, err := qs.db.Get(qs.createKeyFor(spo, t), qs.readopts)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// The spo key does not include the label, so check the stored triple.
+	var triple quad.Quad
+	err = json.Unmarshal(b, &triple)
+	if err != nil {
+		return false, err
+	}
+	return triple == t, nil
+}
+
 func (qs *TripleStore) convertStringToByteHash(s string) []byte {
 	qs.hasher.Reset()
 	key := make([]byte, 0, qs.hasher.Size())
@@ -36,6 +36,20 @@ func (it *AllIterator) SubIterators() []graph.Iterator {
 	return nil
 }
 
+// Clone and Optimize must return an AllIterator rather than the Int64 it
+// embeds, which would yield removed nodes.
+func (it *AllIterator) Clone() graph.Iterator {
+	out := NewMemstoreAllIterator(it.ts)
+	out.Tagger().CopyFrom(it)
+	return out
+}
+
+func (it *AllIterator) Optimize() (graph.Iterator, bool) { return it, false }
+
+func (it *AllIterator) Spec() (graph.IteratorSpec, bool) {
+	return graph.IteratorSpec{Source: graph.NodesAll}, true
+}
+
 func (it *AllIterator) Next() bool {
 	if !it.Int64.Next() {
 		return false
@@ -46,3 +60,62 @@ func (it *AllIterator) Next() bool {
 	}
 	return true
 }
+
+// Size counts the nodes themselves, as removed nodes leave holes in the
+// range of ids.
+func (it *AllIterator) Size() (int64, bool) {
+	return int64(len(it.ts.revIdMap)), true
+}
+
+// A TripleAllIterator iterates over every triple in the store, passing
+// over the sentinel triple and the holes left by removed triples.
+type TripleAllIterator struct {
+	iterator.Int64
+	ts *TripleStore
+}
+
+func NewMemstoreTripleAllIterator(ts *TripleStore) *TripleAllIterator {
+	var out TripleAllIterator
+	// Removed triples leave holes, so the range must cover every triple
+	// ever added rather than the current size.
+	out.Int64 = *iterator.NewInt64(1, int64(len(ts.triples)-1))
+	out.ts = ts
+	return &out
+}
+
+// No subiterators.
+func (it *TripleAllIterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+func (it *TripleAllIterator) Clone() graph.Iterator {
+	out := NewMemstoreTripleAllIterator(it.ts)
+	out.Tagger().CopyFrom(it)
+	return out
+}
+
+func (it *TripleAllIterator) Optimize() (graph.Iterator, bool) { return it, false }
+
+func (it *TripleAllIterator) Spec() (graph.IteratorSpec, bool) {
+	return graph.IteratorSpec{Source: graph.TriplesAll}, true
+}
+
+func (it *TripleAllIterator) Next() bool {
+	for it.Int64.Next() {
+		if it.ts.triples[it.Int64.Result().(int64)].IsValid() {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *TripleAllIterator) Size() (int64, bool) {
+	return it.ts.Size(), true
+}
+
+func (it *TripleAllIterator) Contains(v graph.Value) bool {
+	if !it.Int64.Contains(v) {
+		return false
+	}
+	return it.ts.triples[v.(int64)].IsValid()
+}
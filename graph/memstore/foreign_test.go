@@ -0,0 +1,109 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memstore
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// User data, to be joined with reference data kept in another store.
+var userGraph = []quad.Quad{
+	{"alice", "follows", "bob", ""},
+	{"bob", "follows", "carol", ""},
+	{"carol", "follows", "dave", ""},
+}
+
+// Reference data, loaded in an order that gives its nodes different values
+// from their namesakes in the user store.
+var referenceGraph = []quad.Quad{
+	{"zoe", "lives_in", "paris", ""},
+	{"dave", "lives_in", "paris", ""},
+	{"bob", "lives_in", "london", ""},
+	{"alice", "lives_in", "paris", ""},
+}
+
+// linked returns an iterator over the nodes of ts in direction d of the
+// triples with node in direction via.
+func linked(ts graph.TripleStore, node string, via, d quad.Direction) graph.Iterator {
+	fixed := ts.FixedIterator()
+	fixed.Add(ts.ValueOf(node))
+	return iterator.NewHasA(ts, iterator.NewLinksTo(ts, fixed, via), d)
+}
+
+func TestForeign(t *testing.T) {
+	users, _ := makeTestStore(userGraph)
+	reference, _ := makeTestStore(referenceGraph)
+	if users.ValueOf("dave") == reference.ValueOf("dave") {
+		t.Fatal("Test stores share values, so federation is not tested.")
+	}
+
+	for _, test := range []struct {
+		message string
+		join    func(followed, parisians graph.Iterator) graph.Iterator
+		expect  []string
+	}{
+		{
+			message: "join foreign results to local ones",
+			join: func(followed, parisians graph.Iterator) graph.Iterator {
+				and := iterator.NewAnd()
+				and.AddSubIterator(followed)
+				and.AddSubIterator(parisians)
+				return and
+			},
+			expect: []string{"dave"},
+		},
+		{
+			message: "join local results to foreign ones",
+			join: func(followed, parisians graph.Iterator) graph.Iterator {
+				and := iterator.NewAnd()
+				and.AddSubIterator(parisians)
+				and.AddSubIterator(followed)
+				return and
+			},
+			expect: []string{"dave"},
+		},
+		{
+			message: "unite foreign results with local ones",
+			join: func(followed, parisians graph.Iterator) graph.Iterator {
+				or := iterator.NewOr()
+				or.AddSubIterator(followed)
+				or.AddSubIterator(parisians)
+				return iterator.NewUnique(or)
+			},
+			// Zoe is not known to the user store.
+			expect: []string{"alice", "bob", "carol", "dave"},
+		},
+	} {
+		followed := linked(users, "follows", quad.Predicate, quad.Object)
+		parisians := iterator.NewForeign(users, reference,
+			linked(reference, "paris", quad.Object, quad.Subject))
+		it := test.join(followed, parisians)
+
+		var got []string
+		for graph.Next(it) {
+			got = append(got, users.NameOf(it.Result()))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got:%v expect:%v", test.message, got, test.expect)
+		}
+	}
+}
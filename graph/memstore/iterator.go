@@ -23,6 +23,7 @@ import (
 
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
 )
 
 type Iterator struct {
@@ -33,6 +34,11 @@ type Iterator struct {
 	isRunning bool
 	iterLast  Int64
 	result    graph.Value
+
+	// The direction and node the triples of the iterator were indexed by,
+	// if it was made by TripleIterator.
+	dir   quad.Direction
+	value graph.Value
 }
 
 type Int64 int64
@@ -69,6 +75,7 @@ func (it *Iterator) UID() uint64 {
 
 func (it *Iterator) Reset() {
 	it.iterLast = Int64(-1)
+	it.result = nil
 }
 
 func (it *Iterator) Tagger() *graph.Tagger {
@@ -87,6 +94,7 @@ func (it *Iterator) TagResults(dst map[string]graph.Value) {
 
 func (it *Iterator) Clone() graph.Iterator {
 	m := NewLlrbIterator(it.tree, it.data)
+	m.dir, m.value = it.dir, it.value
 	m.tags.CopyFrom(it)
 	return m
 }
@@ -133,6 +141,14 @@ func (it *Iterator) Contains(v graph.Value) bool {
 	return graph.ContainsLogOut(it, v, false)
 }
 
+func (it *Iterator) BatchContains(vals []graph.Value) []bool {
+	out := make([]bool, len(vals))
+	for i, v := range vals {
+		out[i] = it.tree.Has(Int64(v.(int64)))
+	}
+	return out
+}
+
 func (it *Iterator) DebugString(indent int) string {
 	size, _ := it.Size()
 	return fmt.Sprintf("%s(%s tags:%s size:%d %s)", strings.Repeat(" ", indent), it.Type(), it.tags.Tags(), size, it.data)
@@ -150,6 +166,10 @@ func (it *Iterator) Type() graph.Type { return memType }
 
 func (it *Iterator) Sorted() bool { return true }
 
+func (it *Iterator) Spec() (graph.IteratorSpec, bool) {
+	return graph.IteratorSpec{Source: graph.Triples, Direction: it.dir, Value: it.value}, it.value != nil
+}
+
 func (it *Iterator) Optimize() (graph.Iterator, bool) {
 	return it, false
 }
@@ -16,6 +16,7 @@ package memstore
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/barakmich/glog"
 	"github.com/google/cayley/graph"
@@ -225,11 +226,18 @@ func (ts *TripleStore) Quad(index graph.Value) quad.Quad {
 	return ts.triples[index.(int64)]
 }
 
+func (ts *TripleStore) QuadExists(t quad.Quad) (bool, error) {
+	exists, _ := ts.tripleExists(t)
+	return exists, nil
+}
+
 func (ts *TripleStore) TripleIterator(d quad.Direction, value graph.Value) graph.Iterator {
 	index, ok := ts.index.Get(d, value.(int64))
 	data := fmt.Sprintf("dir:%s val:%d", d, value.(int64))
 	if ok {
-		return NewLlrbIterator(index, data)
+		it := NewLlrbIterator(index, data)
+		it.dir, it.value = d, value
+		return it
 	}
 	return &iterator.Null{}
 }
@@ -256,7 +264,7 @@ func (ts *TripleStore) NameOf(id graph.Value) string {
 }
 
 func (ts *TripleStore) TriplesAllIterator() graph.Iterator {
-	return iterator.NewInt64(0, ts.Size())
+	return NewMemstoreTripleAllIterator(ts)
 }
 
 func (ts *TripleStore) FixedIterator() graph.FixedIterator {
@@ -268,6 +276,27 @@ func (ts *TripleStore) TripleDirection(val graph.Value, d quad.Direction) graph.
 	return ts.ValueOf(name)
 }
 
+func (ts *TripleStore) DistinctIterator(d quad.Direction) graph.Iterator {
+	var ids []int64
+	for id, tree := range ts.index.GetForDir(d) {
+		if tree.Len() != 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(byID(ids))
+	fixed := ts.FixedIterator()
+	for _, id := range ids {
+		fixed.Add(id)
+	}
+	return fixed
+}
+
+type byID []int64
+
+func (o byID) Len() int           { return len(o) }
+func (o byID) Less(i, j int) bool { return o[i] < o[j] }
+func (o byID) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+
 func (ts *TripleStore) NodesAllIterator() graph.Iterator {
 	return NewMemstoreAllIterator(ts)
 }
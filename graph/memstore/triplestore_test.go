@@ -15,11 +15,14 @@
 package memstore
 
 import (
+	"encoding/json"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/graphtest"
 	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
 )
@@ -94,6 +97,10 @@ func TestMemstore(t *testing.T) {
 	}
 }
 
+func TestBackend(t *testing.T) {
+	graphtest.BackendTestSuite(t, func() graph.TripleStore { return newTripleStore() })
+}
+
 func TestIteratorsAndNextResultOrderA(t *testing.T) {
 	ts, _ := makeTestStore(simpleGraph)
 
@@ -193,3 +200,848 @@ func TestRemoveTriple(t *testing.T) {
 		t.Error("E should not have any followers.")
 	}
 }
+
+func TestCountAfterRemove(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	ts.RemoveTriple(quad.Quad{"E", "follows", "F", ""})
+	ts.RemoveTriple(quad.Quad{"F", "follows", "G", ""})
+
+	var nodes int64
+	for it := ts.NodesAllIterator(); graph.Next(it); {
+		nodes++
+	}
+	if n, exact := iterator.Count(ts.NodesAllIterator(), false); n != nodes || !exact {
+		t.Errorf("Unexpected node estimate, got:%d (exact %t) expect:%d (exact true)", n, exact, nodes)
+	}
+	if n, exact := iterator.Count(ts.TriplesAllIterator(), false); n != ts.Size() || !exact {
+		t.Errorf("Unexpected triple estimate, got:%d (exact %t) expect:%d (exact true)", n, exact, ts.Size())
+	}
+}
+
+// TestTriplesAllAfterRemove checks that removing triples, which leaves
+// holes where they were, does not hide the triples at the end.
+func TestTriplesAllAfterRemove(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	ts.RemoveTriple(simpleGraph[0])
+	ts.RemoveTriple(simpleGraph[1])
+
+	var got []quad.Quad
+	for it := ts.TriplesAllIterator(); graph.Next(it); {
+		if q := ts.Quad(it.Result()); q.IsValid() {
+			got = append(got, q)
+		}
+	}
+	if expect := simpleGraph[2:]; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected triples after removal, got:%v expect:%v", got, expect)
+	}
+}
+
+func TestBatchContains(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	it := ts.TripleIterator(quad.Object, ts.ValueOf("F"))
+
+	var vals []graph.Value
+	for all := ts.TriplesAllIterator(); graph.Next(all); {
+		vals = append(vals, all.Result())
+	}
+	got := it.(graph.BatchContainer).BatchContains(vals)
+	for i, v := range vals {
+		if want := it.Contains(v); got[i] != want {
+			t.Errorf("Unexpected batch check of %s, got:%t expect:%t", ts.Quad(v), got[i], want)
+		}
+	}
+}
+
+func TestSavePredicate(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	fixed := ts.FixedIterator()
+	fixed.Add(ts.ValueOf("D"))
+	and := iterator.NewAnd()
+	and.AddSubIterator(iterator.NewLinksTo(ts, fixed, quad.Subject))
+	it := iterator.NewHasA(ts, iterator.NewSave(ts, and, quad.Predicate, "pred"), quad.Object)
+	it.Tagger().Add("id")
+
+	var got []string
+	for graph.Next(it) {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		got = append(got, ts.NameOf(tags["id"])+" "+ts.NameOf(tags["pred"]))
+	}
+	sort.Strings(got)
+	expect := []string{"B follows", "G follows", "cool status"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected predicates saved, got:%v expect:%v", got, expect)
+	}
+}
+
+func TestPluck(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	it := iterator.NewPluck(ts, ts.TripleIterator(quad.Predicate, ts.ValueOf("follows")), quad.Object)
+
+	var got []string
+	for graph.Next(it) {
+		got = append(got, ts.NameOf(it.Result()))
+	}
+	sort.Strings(got)
+	var expect []string
+	for _, q := range simpleGraph {
+		if q.Predicate == "follows" {
+			expect = append(expect, q.Object)
+		}
+	}
+	sort.Strings(expect)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected plucked objects, got:%v expect:%v", got, expect)
+	}
+
+	if !it.Contains(ts.ValueOf("G")) {
+		t.Error("Failed to contain a followed node")
+	}
+	if it.Contains(ts.ValueOf("A")) {
+		t.Error("Unexpectedly contained a node no one follows")
+	}
+}
+
+func TestLangMatch(t *testing.T) {
+	ts, _ := makeTestStore([]quad.Quad{
+		{"alice", "label", `"Alice"@en`, ""},
+		{"alice", "label", `"Alicia"@es`, ""},
+		{"bob", "label", `"Roberto"@es`, ""},
+		{"bob", "label", `"Robert"@fr`, ""},
+		{"carol", "label", `"Carol"@en-GB`, ""},
+		{"carol", "label", `"Caroline"@fr`, ""},
+		{"carol", "name", `"Caroline"@fr`, ""},
+		{"dan", "label", `"Dan"`, ""},
+	})
+	for _, test := range []struct {
+		langs  []string
+		expect []string
+	}{
+		{
+			langs:  []string{"en", iterator.AnyLang},
+			expect: []string{`alice "Alice"@en`, `bob "Robert"@fr`, `bob "Roberto"@es`, `carol "Carol"@en-GB`, `dan "Dan"`},
+		},
+		{
+			langs:  []string{"EN", "fr"},
+			expect: []string{`alice "Alice"@en`, `bob "Robert"@fr`, `carol "Carol"@en-GB`},
+		},
+		{
+			langs:  []string{"es"},
+			expect: []string{`alice "Alicia"@es`, `bob "Roberto"@es`},
+		},
+	} {
+		it := iterator.NewLangMatch(ts.TripleIterator(quad.Predicate, ts.ValueOf("label")), test.langs, ts)
+		var got []string
+		for graph.Next(it) {
+			q := ts.Quad(it.Result())
+			got = append(got, q.Subject+" "+q.Object)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected labels in %v, got:%v expect:%v", test.langs, got, test.expect)
+		}
+	}
+
+	// The French name of carol does not count against her French label.
+	it := iterator.NewLangMatch(ts.TripleIterator(quad.Predicate, ts.ValueOf("label")), []string{"fr", "en"}, ts)
+	for _, test := range []struct {
+		q      quad.Quad
+		expect bool
+	}{
+		{q: quad.Quad{"carol", "label", `"Caroline"@fr`, ""}, expect: true},
+		{q: quad.Quad{"carol", "label", `"Carol"@en-GB`, ""}},
+		{q: quad.Quad{"alice", "label", `"Alice"@en`, ""}, expect: true},
+	} {
+		_, id := ts.tripleExists(test.q)
+		if got := it.Contains(id); got != test.expect {
+			t.Errorf("Unexpected result checking %v, got:%t expect:%t", test.q, got, test.expect)
+		}
+	}
+}
+
+func TestBoundTag(t *testing.T) {
+	ts, _ := makeTestStore([]quad.Quad{
+		{"A", "follows", "B", ""},
+		{"B", "follows", "A", ""},
+		{"B", "follows", "C", ""},
+		{"C", "follows", "B", ""},
+		{"C", "follows", "D", ""},
+		{"D", "follows", "E", ""},
+	})
+	out := func(from graph.Iterator) graph.Iterator {
+		fixed := ts.FixedIterator()
+		fixed.Add(ts.ValueOf("follows"))
+		and := iterator.NewAnd()
+		and.AddSubIterator(iterator.NewLinksTo(ts, fixed, quad.Predicate))
+		and.AddSubIterator(iterator.NewLinksTo(ts, from, quad.Subject))
+		return iterator.NewHasA(ts, and, quad.Object)
+	}
+	// People who follow someone who follows them back.
+	people := ts.NodesAllIterator()
+	people.Tagger().Add("person")
+	friends := out(people)
+	friends.Tagger().Add("friend")
+	it := iterator.NewBound(out(friends), "person")
+
+	var got []string
+	for graph.Next(it) {
+		for {
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			got = append(got, ts.NameOf(tags["person"])+" "+ts.NameOf(tags["friend"]))
+			if !it.NextPath() {
+				break
+			}
+		}
+	}
+	sort.Strings(got)
+	expect := []string{"A B", "B A", "B C", "C B"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected mutual follows, got:%v expect:%v", got, expect)
+	}
+
+	for _, test := range []struct {
+		name   string
+		expect bool
+	}{
+		{"A", true},
+		{"C", true},
+		{"D", false},
+		{"E", false},
+	} {
+		c := it.Clone()
+		if got := c.Contains(ts.ValueOf(test.name)); got != test.expect {
+			t.Errorf("Unexpected result checking %s, got:%t expect:%t", test.name, got, test.expect)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	ts.RemoveTriple(quad.Quad{"E", "follows", "F", ""})
+
+	got, err := graph.Summarize(ts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// E is the subject of no triple left, and F still the object of one.
+	expect := graph.Summary{Triples: 10, Subjects: 6, Predicates: 2, Objects: 5, Labels: 1}
+	if got != expect {
+		t.Errorf("Unexpected summary, got:%+v expect:%+v", got, expect)
+	}
+}
+
+func TestPredicateHistogram(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	ts.RemoveTriple(quad.Quad{"E", "follows", "F", ""})
+
+	want := make(map[string]int64)
+	for _, q := range simpleGraph {
+		want[q.Predicate]++
+	}
+	want["follows"]--
+
+	hist, err := graph.PredicateHistogram(ts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := make(map[string]int64)
+	for i, c := range hist {
+		if i > 0 && hist[i-1].Count < c.Count {
+			t.Errorf("Histogram not sorted by count at %d: %v", i, hist)
+		}
+		got[c.Predicate] = c.Count
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected histogram, got:%v expect:%v", got, want)
+	}
+}
+
+func TestFanOutNodes(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	for _, test := range []struct {
+		fanOut graph.FanOut
+		expect []string
+	}{
+		{fanOut: graph.FanOut{Direction: quad.Subject, Predicate: "follows", Op: ">", N: 1}, expect: []string{"C", "D"}},
+		{fanOut: graph.FanOut{Direction: quad.Subject, Predicate: "follows", Op: "=", N: 1}, expect: []string{"A", "B", "E", "F"}},
+		{fanOut: graph.FanOut{Direction: quad.Object, Predicate: "follows", Op: ">=", N: 2}, expect: []string{"B", "F", "G"}},
+		{fanOut: graph.FanOut{Direction: quad.Subject, Predicate: "status", Op: ">", N: 1}},
+		{fanOut: graph.FanOut{Direction: quad.Subject, Predicate: "missing", Op: "<", N: 5}},
+	} {
+		nodes, err := graph.FanOutNodes(ts, test.fanOut)
+		if err != nil {
+			t.Fatalf("Unexpected error counting %+v: %v", test.fanOut, err)
+		}
+		var got []string
+		for _, v := range nodes {
+			got = append(got, ts.NameOf(v))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected nodes for %+v, got:%v expect:%v", test.fanOut, got, test.expect)
+		}
+	}
+	for _, f := range []graph.FanOut{
+		{Direction: quad.Predicate, Predicate: "follows", Op: ">", N: 1},
+		{Direction: quad.Subject, Predicate: "follows", Op: "!=", N: 1},
+	} {
+		if _, err := graph.FanOutNodes(ts, f); err == nil {
+			t.Errorf("Expected an error counting %+v", f)
+		}
+	}
+}
+
+func TestMergeNodes(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+
+	// C follows B and D, and D follows B and G, so merging D into C
+	// makes "C follows B" a duplicate.
+	if err := graph.MergeNodes(ts, "D", "C"); err != nil {
+		t.Fatalf("Failed to merge nodes: %v", err)
+	}
+
+	var got []string
+	it := ts.TriplesAllIterator()
+	for graph.Next(it) {
+		q := ts.Quad(it.Result())
+		if q.IsValid() {
+			got = append(got, q.NTriple())
+		}
+	}
+	sort.Strings(got)
+	expect := []string{
+		"A follows B .",
+		"B follows F .",
+		"B status cool status_graph .",
+		"C follows B .",
+		"C follows C .",
+		"C follows G .",
+		"C status cool status_graph .",
+		"E follows F .",
+		"F follows G .",
+		"G status cool status_graph .",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected triples after merge, got:%q expect:%q", got, expect)
+	}
+	if size := ts.Size(); size != int64(len(expect)) {
+		t.Errorf("Unexpected store size after merge, got:%d expect:%d", size, len(expect))
+	}
+	if _, ok := ts.idMap["D"]; ok {
+		t.Error("Merged node D should have been removed")
+	}
+	if err := graph.MergeNodes(ts, "C", ""); err != graph.ErrMergeEmpty {
+		t.Errorf("Unexpected error merging into the empty node, got:%v expect:%v", err, graph.ErrMergeEmpty)
+	}
+	if err := graph.MergeNodes(graph.ReadOnly(ts), "C", "B"); err != graph.ErrReadOnly {
+		t.Errorf("Unexpected error merging in a read-only store, got:%v expect:%v", err, graph.ErrReadOnly)
+	}
+}
+
+func TestDeleteBy(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+
+	n, err := graph.DeleteBy(ts, quad.Predicate, "status", false)
+	if err != nil {
+		t.Fatalf("Unexpected error deleting by predicate: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Unexpected number of triples deleted, got:%d expect:3", n)
+	}
+	if size := ts.Size(); size != 8 {
+		t.Errorf("Unexpected store size after delete, got:%d expect:8", size)
+	}
+	for _, name := range []string{"status", "cool", "status_graph"} {
+		if _, ok := ts.idMap[name]; ok {
+			t.Errorf("Node %s of only deleted triples should have been removed", name)
+		}
+	}
+	if _, ok := ts.idMap["G"]; !ok {
+		t.Error("Node G of remaining triples should have been kept")
+	}
+
+	// What is left all follows, so deleting it needs confirmation.
+	for _, d := range []quad.Direction{quad.Predicate, quad.Any} {
+		if _, err := graph.DeleteBy(ts, d, "follows", false); err != graph.ErrDeleteAll {
+			t.Errorf("Unexpected error deleting everything by %v, got:%v expect:%v", d, err, graph.ErrDeleteAll)
+		}
+	}
+	if size := ts.Size(); size != 8 {
+		t.Errorf("Unexpected store size after refused delete, got:%d expect:8", size)
+	}
+	if n, err := graph.DeleteBy(ts, quad.Any, "", true); err != nil || n != 8 || ts.Size() != 0 {
+		t.Errorf("Unexpected confirmed delete of everything, got:%d %v, size:%d", n, err, ts.Size())
+	}
+	if _, err := graph.DeleteBy(graph.ReadOnly(ts), quad.Predicate, "follows", false); err != graph.ErrReadOnly {
+		t.Errorf("Unexpected error deleting from a read-only store, got:%v expect:%v", err, graph.ErrReadOnly)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ms, _ := makeTestStore(simpleGraph)
+	ts := graph.ReadOnly(ms)
+	if !graph.IsReadOnly(ts) {
+		t.Fatal("Wrapped store should be read-only")
+	}
+
+	ts.AddTriple(quad.Quad{"A", "follows", "E", ""})
+	ts.AddTripleSet([]quad.Quad{{"E", "follows", "A", ""}})
+	ts.RemoveTriple(quad.Quad{"E", "follows", "F", ""})
+	if size := ts.Size(); size != int64(len(simpleGraph)) {
+		t.Errorf("Read-only store was written to, got size:%d expected %d", size, len(simpleGraph))
+	}
+
+	fixed := ts.FixedIterator()
+	fixed.Add(ts.ValueOf("E"))
+	hasa := iterator.NewHasA(ts, iterator.NewLinksTo(ts, fixed, quad.Subject), quad.Object)
+	var got []string
+	for graph.Next(hasa) {
+		got = append(got, ts.NameOf(hasa.Result()))
+	}
+	if expect := []string{"F"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected read result, got:%q expect:%q", got, expect)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+
+	followed := func(ts graph.TripleStore, names ...string) graph.Iterator {
+		fixed := ts.FixedIterator()
+		for _, n := range names {
+			fixed.Add(ts.ValueOf(n))
+		}
+		fixed.Tagger().Add("follower")
+		return iterator.NewHasA(ts, iterator.NewLinksTo(ts, fixed, quad.Subject), quad.Object)
+	}
+
+	a := graph.Digest(ts, followed(ts, "C", "D", "E"))
+	b := graph.Digest(ts, followed(ts, "E", "D", "C"))
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("Digest depends on result order, got:%x and %x", a, b)
+	}
+
+	c := graph.Digest(ts, followed(ts, "C", "D"))
+	if reflect.DeepEqual(a, c) {
+		t.Errorf("Digest did not change with results, got:%x for both", a)
+	}
+
+	ts.RemoveTriple(quad.Quad{"E", "follows", "F", ""})
+	ts.AddTriple(quad.Quad{"E", "follows", "G", ""})
+	d := graph.Digest(ts, followed(ts, "C", "D", "E"))
+	if reflect.DeepEqual(a, d) {
+		t.Errorf("Digest did not change with data, got:%x for both", a)
+	}
+}
+
+var quadExistsTests = []struct {
+	message string
+	quad    quad.Quad
+	expect  bool
+}{
+	{
+		message: "find a present triple",
+		quad:    quad.Quad{"C", "follows", "D", ""},
+		expect:  true,
+	},
+	{
+		message: "find a present labeled triple",
+		quad:    quad.Quad{"G", "status", "cool", "status_graph"},
+		expect:  true,
+	},
+	{
+		message: "not find an absent triple",
+		quad:    quad.Quad{"D", "follows", "C", ""},
+		expect:  false,
+	},
+	{
+		message: "not find a triple with a differing label",
+		quad:    quad.Quad{"G", "status", "cool", "other_graph"},
+		expect:  false,
+	},
+	{
+		message: "not find an unlabeled version of a labeled triple",
+		quad:    quad.Quad{"G", "status", "cool", ""},
+		expect:  false,
+	},
+}
+
+func TestQuadExists(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	for _, test := range quadExistsTests {
+		got, err := ts.QuadExists(test.quad)
+		if err != nil {
+			t.Errorf("Failed to %s, unexpected error: %v", test.message, err)
+		}
+		if got != test.expect {
+			t.Errorf("Failed to %s, got:%t expect:%t", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestDistinctSubjects(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	// Check that removed triples do not leave their subject behind.
+	ts.RemoveTriple(quad.Quad{"E", "follows", "F", ""})
+
+	var got []string
+	it := iterator.Distinct(ts, quad.Subject)
+	for graph.Next(it) {
+		got = append(got, ts.NameOf(it.Result()))
+	}
+	sort.Strings(got)
+	expect := []string{"A", "B", "C", "D", "F", "G"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected distinct subjects, got:%q expect:%q", got, expect)
+	}
+}
+
+// incapable is a store that implements graph.DistinctLister and
+// graph.PredicateCounter, but advertises neither capability.
+type incapable struct {
+	*TripleStore
+	counted bool
+}
+
+func (ts *incapable) Capabilities() graph.Capabilities { return 0 }
+
+func (ts *incapable) PredicateCounts() (map[string]int64, error) {
+	ts.counted = true
+	return nil, nil
+}
+
+func TestCapabilityFallbacks(t *testing.T) {
+	mem, _ := makeTestStore(simpleGraph)
+	if c := graph.CapabilitiesOf(mem); !c.Has(graph.CapDistinct) || c.Has(graph.CapCount) {
+		t.Errorf("Unexpected memstore capabilities, got:%b", c)
+	}
+
+	ts := &incapable{TripleStore: mem}
+	if typ := iterator.Distinct(ts, quad.Subject).Type(); typ != graph.Unique {
+		t.Errorf("Unexpected distinct iterator without the capability, got:%v expect:%v", typ, graph.Unique)
+	}
+	hist, err := graph.PredicateHistogram(ts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ts.counted {
+		t.Error("Predicates counted by a store without the capability")
+	}
+	if len(hist) != 2 || hist[0] != (graph.PredicateCount{"follows", 8}) {
+		t.Errorf("Unexpected histogram from scanning, got:%v", hist)
+	}
+}
+
+var textGraph = []quad.Quad{
+	{"book:1", "title", `"The Go Programming Language"`, ""},
+	{"book:1", "summary", `"A book about programming in Go, with many examples"`, ""},
+	{"book:2", "title", `"Gone with the Wind"`, ""},
+	{"book:2", "summary", `"A novel of the American South"`, ""},
+	{"book:3", "title", `"Structure and Interpretation of Computer Programs"`, ""},
+	{"book:3", "summary", `"Programming in Scheme"`, ""},
+	{"book:4", "title", `"GO: a Board Game Primer"`, ""},
+}
+
+func TestTextSearch(t *testing.T) {
+	ts, _ := makeTestStore(textGraph)
+	for _, test := range []struct {
+		text   string
+		expect []string
+	}{
+		{
+			// Whole words match in any case, not words they start.
+			text:   "go",
+			expect: []string{"book:1 summary", "book:1 title", "book:4 title"},
+		},
+		{
+			text:   "scheme  NOVEL",
+			expect: []string{"book:2 summary", "book:3 summary"},
+		},
+		{
+			// Words are matched literally.
+			text:   "Go,",
+			expect: []string{"book:1 summary"},
+		},
+		{text: "fortran"},
+		{text: " "},
+	} {
+		var got []string
+		it := iterator.TextSearch(ts, test.text, "score")
+		for graph.Next(it) {
+			q := ts.Quad(it.Result())
+			got = append(got, q.Subject+" "+q.Predicate)
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			if _, ok := tags["score"]; ok {
+				t.Errorf("Unexpected score from an unranked search for %q", test.text)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected matches for %q, got:%q expect:%q", test.text, got, test.expect)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	ts, _ := makeTestStore(textGraph)
+	for _, test := range []struct {
+		prefix string
+		limit  int
+		expect []string
+	}{
+		{prefix: "book:", limit: -1, expect: []string{"book:1", "book:2", "book:3", "book:4"}},
+		{prefix: "book:", limit: 2, expect: []string{"book:1", "book:2"}},
+		{prefix: `"G`, limit: 10, expect: []string{`"GO: a Board Game Primer"`, `"Gone with the Wind"`}},
+		{prefix: "s", limit: 10, expect: []string{"summary"}},
+		{prefix: "x", limit: 10},
+	} {
+		var got []string
+		it := iterator.Complete(ts, test.prefix, test.limit)
+		for graph.Next(it) {
+			got = append(got, ts.NameOf(it.Result()))
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected completions of %q up to %d, got:%q expect:%q", test.prefix, test.limit, got, test.expect)
+		}
+	}
+}
+
+var tenantGraph = []quad.Quad{
+	{"alice", "owns", "doc:1", "tenant:a"},
+	{"alice", "owns", "doc:2", "tenant:b"},
+	{"bob", "owns", "doc:3", "tenant:b"},
+	{"carol", "owns", "doc:4", ""},
+}
+
+func TestRestrictLabels(t *testing.T) {
+	ts, _ := makeTestStore(tenantGraph)
+	view := iterator.RestrictLabels(ts, []string{"tenant:a", ""})
+	if !graph.IsReadOnly(view) {
+		t.Error("Restricted view is writable")
+	}
+
+	owned := func(it graph.Iterator) []string {
+		var got []string
+		for graph.Next(it) {
+			got = append(got, view.NameOf(view.TripleDirection(it.Result(), quad.Object)))
+		}
+		sort.Strings(got)
+		return got
+	}
+	expect := []string{"doc:1", "doc:4"}
+	if got := owned(view.TriplesAllIterator()); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected triples of a broad query, got:%q expect:%q", got, expect)
+	}
+	it, _ := view.TriplesAllIterator().Optimize()
+	it, _ = view.OptimizeIterator(it)
+	if got := owned(it); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected triples of an optimized broad query, got:%q expect:%q", got, expect)
+	}
+	if got := owned(view.TripleIterator(quad.Subject, view.ValueOf("alice"))); !reflect.DeepEqual(got, []string{"doc:1"}) {
+		t.Errorf("Unexpected triples of alice, got:%q", got)
+	}
+
+	// Triples found by an unrestricted iterator are refused when checked.
+	and := iterator.NewAnd()
+	and.AddSubIterator(ts.TriplesAllIterator())
+	and.AddSubIterator(view.TripleIterator(quad.Predicate, view.ValueOf("owns")))
+	if got := owned(and); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected triples checked against the view, got:%q expect:%q", got, expect)
+	}
+
+	if ok, _ := view.QuadExists(quad.Quad{"bob", "owns", "doc:3", "tenant:b"}); ok {
+		t.Error("Unexpected triple of a label outside the view")
+	}
+	if ok, _ := view.QuadExists(tenantGraph[0]); !ok {
+		t.Error("Triple of a label in the view not found")
+	}
+	if n := view.Size(); n != 2 {
+		t.Errorf("Unexpected size of the view, got:%d expect:2", n)
+	}
+
+	var nodes []string
+	for it := view.NodesAllIterator(); graph.Next(it); {
+		nodes = append(nodes, view.NameOf(it.Result()))
+	}
+	sort.Strings(nodes)
+	expect = []string{"alice", "carol", "doc:1", "doc:4", "owns", "tenant:a"}
+	if !reflect.DeepEqual(nodes, expect) {
+		t.Errorf("Unexpected nodes of the view, got:%q expect:%q", nodes, expect)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	ts, _ := makeTestStore(append([]quad.Quad{{"B", "likes", "B", ""}}, simpleGraph...))
+	for _, test := range []struct {
+		message    string
+		node       string
+		withObject bool
+		expect     *graph.Description
+	}{
+		{
+			message: "describe a node",
+			node:    "D",
+			expect: &graph.Description{
+				ID:  "D",
+				Out: map[string][]string{"follows": {"B", "G"}, "status": {"cool"}},
+			},
+		},
+		{
+			message:    "describe a node and the triples it is the object of",
+			node:       "B",
+			withObject: true,
+			expect: &graph.Description{
+				ID:  "B",
+				Out: map[string][]string{"follows": {"F"}, "likes": {"B"}, "status": {"cool"}},
+				In:  map[string][]string{"follows": {"A", "C", "D"}, "likes": {"B"}},
+			},
+		},
+		{
+			message:    "describe a node that is in no triple",
+			node:       "Z",
+			withObject: true,
+			expect: &graph.Description{
+				ID:  "Z",
+				Out: map[string][]string{},
+				In:  map[string][]string{},
+			},
+		},
+	} {
+		got, err := graph.Describe(graph.ReadOnly(ts), test.node, test.withObject)
+		if err != nil {
+			t.Errorf("Failed to %s: %v", test.message, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got:%+v expect:%+v", test.message, got, test.expect)
+		}
+	}
+}
+
+// pathsOf returns each path of it as its tags, by name.
+func pathsOf(ts graph.TripleStore, it graph.Iterator) []string {
+	var got []string
+	for graph.Next(it) {
+		for {
+			tags := make(map[string]graph.Value)
+			it.TagResults(tags)
+			got = append(got, ts.NameOf(tags["person"])+" "+ts.NameOf(tags["friend"]))
+			if !it.NextPath() {
+				break
+			}
+		}
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestPlan(t *testing.T) {
+	ts, _ := makeTestStore(simpleGraph)
+	out := func(from graph.Iterator, pred string) graph.Iterator {
+		fixed := ts.FixedIterator()
+		fixed.Add(ts.ValueOf(pred))
+		and := iterator.NewAnd()
+		and.AddSubIterator(iterator.NewLinksTo(ts, fixed, quad.Predicate))
+		and.AddSubIterator(iterator.NewLinksTo(ts, from, quad.Subject))
+		return iterator.NewHasA(ts, and, quad.Object)
+	}
+	people := ts.NodesAllIterator()
+	people.Tagger().Add("person")
+	friends := iterator.NewUnion(ts, out(people, "follows"), out(people.Clone(), "status"))
+	friends.Tagger().Add("friend")
+	it, _ := iterator.NewLimit(ts, out(friends, "follows"), 10).Optimize()
+
+	plan, err := iterator.NewPlan(it, ts)
+	if err != nil {
+		t.Fatalf("Failed to plan iterator tree: %v", err)
+	}
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("Failed to marshal plan: %v", err)
+	}
+	if !strings.Contains(string(b), `"source":"links"`) {
+		t.Errorf("Expected the optimized tree to hold store iterators, got:%s", b)
+	}
+	expect := pathsOf(ts, it)
+	if len(expect) == 0 {
+		t.Fatal("Expected paths from the planned tree")
+	}
+
+	// The plan is replayed against another store holding the same graph.
+	other, _ := makeTestStore(simpleGraph)
+	var loaded iterator.Plan
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		t.Fatalf("Failed to unmarshal plan: %v", err)
+	}
+	replay, err := loaded.Build(other)
+	if err != nil {
+		t.Fatalf("Failed to build plan: %v", err)
+	}
+	if got := pathsOf(other, replay); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected results of replayed plan, got:%v expect:%v", got, expect)
+	}
+	if again, err := iterator.NewPlan(replay, other); err != nil || !reflect.DeepEqual(again, plan) {
+		t.Errorf("Unexpected plan of replayed tree, got:%+v (%v) expect:%+v", again, err, plan)
+	}
+}
+
+var peopleGraph = []quad.Quad{
+	{"alice", "is", "person", ""},
+	{"bob", "is", "person", ""},
+	{"carol", "is", "person", ""},
+	{"dave", "is", "person", ""},
+	{"alice", "email", "alice@example.org", ""},
+	{"alice", "email", "alice@example.com", ""},
+	{"carol", "email", "carol@example.org", ""},
+	{"dave", "phone", "555-0100", ""},
+	{"acme", "email", "info@acme.example", ""},
+}
+
+func TestNot(t *testing.T) {
+	ts, _ := makeTestStore(peopleGraph)
+
+	// has returns the subjects of the triples with predicate p, and with
+	// object o if it is not empty.
+	has := func(p, o string) graph.Iterator {
+		pred := ts.FixedIterator()
+		pred.Add(ts.ValueOf(p))
+		and := iterator.NewAnd()
+		and.AddSubIterator(iterator.NewLinksTo(ts, pred, quad.Predicate))
+		if o != "" {
+			obj := ts.FixedIterator()
+			obj.Add(ts.ValueOf(o))
+			and.AddSubIterator(iterator.NewLinksTo(ts, obj, quad.Object))
+		}
+		return iterator.NewHasA(ts, and, quad.Subject)
+	}
+
+	for _, optimize := range []bool{false, true} {
+		// People with no email.
+		var it graph.Iterator = iterator.NewNot(ts, has("is", "person"), has("email", ""))
+		if optimize {
+			it, _ = it.Optimize()
+		}
+		var got []string
+		for graph.Next(it) {
+			got = append(got, ts.NameOf(it.Result()))
+		}
+		sort.Strings(got)
+		if expect := []string{"bob", "dave"}; !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected people with no email (optimized %t), got:%q expect:%q", optimize, got, expect)
+		}
+		for _, test := range []struct {
+			name   string
+			expect bool
+		}{
+			{name: "bob", expect: true},
+			{name: "alice"},
+			{name: "acme"},
+		} {
+			if got := it.Contains(ts.ValueOf(test.name)); got != test.expect {
+				t.Errorf("Unexpected containment of %q (optimized %t), got:%t expect:%t", test.name, optimize, got, test.expect)
+			}
+		}
+	}
+}
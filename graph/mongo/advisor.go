@@ -0,0 +1,227 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+// Rather than an index on every direction, a store may be opened with an
+// index advisor, which records the directions each query of the triples
+// collection is constrained on, and suggests the indexes that would serve
+// them. Once it has seen enough queries it may create them itself.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+// indexedFields are the fields of triple documents an index may be
+// suggested on, in the order they are keyed.
+var indexedFields = []string{"Subject", "Predicate", "Object", "Label"}
+
+// DefaultIndexWarmup is the number of queries an index advisor creating
+// indexes observes before it does.
+const DefaultIndexWarmup = 1000
+
+// indexAdvisorFrom returns the index advisor given by the index_advisor
+// option, or nil if there is none. It is one of "suggest", which only
+// suggests indexes, or "create", which also creates them once it has
+// observed index_advisor_warmup queries.
+func indexAdvisorFrom(options graph.Options) (*indexAdvisor, error) {
+	mode, ok := options.StringKey("index_advisor")
+	if !ok || mode == "" {
+		return nil, nil
+	}
+	a := &indexAdvisor{warmup: DefaultIndexWarmup, patterns: make(map[string]int)}
+	switch mode {
+	case "suggest":
+	case "create":
+		a.create = true
+	default:
+		return nil, fmt.Errorf("mongo: unknown index_advisor %q", mode)
+	}
+	if n, ok := options.IntKey("index_advisor_warmup"); ok && n > 0 {
+		a.warmup = n
+	}
+	return a, nil
+}
+
+// ensureIndex creates index on the triples collection.
+var ensureIndex = func(db *mgo.Database, index mgo.Index) error {
+	return db.C("triples").EnsureIndex(index)
+}
+
+// An indexAdvisor counts the queries made with each pattern of constrained
+// fields. It is shared by a store and its views.
+type indexAdvisor struct {
+	mu     sync.Mutex
+	create bool
+	warmup int
+	seen   int
+
+	// Counts of queries by the fields they constrain, joined by commas.
+	patterns map[string]int
+
+	// Keys of the indexes the collection has.
+	existing [][]string
+}
+
+// fieldsOf returns the fields of triple documents constraint matches on, in
+// index key order.
+func fieldsOf(constraint bson.M) []string {
+	var fields []string
+	for _, f := range indexedFields {
+		if _, ok := constraint[f]; ok {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// observe counts a query of the triples collection, returning whether the
+// suggested indexes are due to be created.
+func (a *indexAdvisor) observe(constraint bson.M) bool {
+	fields := fieldsOf(constraint)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(fields) != 0 {
+		a.patterns[strings.Join(fields, ",")]++
+	}
+	a.seen++
+	return a.create && a.seen == a.warmup
+}
+
+// served returns whether an index with one of keys serves queries
+// constrained on fields, which it does if they lead its keys.
+func served(fields []string, keys [][]string) bool {
+	for _, k := range keys {
+		if isPrefix(fields, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrefix(fields, keys []string) bool {
+	if len(fields) > len(keys) {
+		return false
+	}
+	for i, f := range fields {
+		if keys[i] != f {
+			return false
+		}
+	}
+	return true
+}
+
+type byPatternLength [][]string
+
+func (s byPatternLength) Len() int { return len(s) }
+func (s byPatternLength) Less(i, j int) bool {
+	if len(s[i]) != len(s[j]) {
+		return len(s[i]) > len(s[j])
+	}
+	return strings.Join(s[i], ",") < strings.Join(s[j], ",")
+}
+func (s byPatternLength) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+type byQueries []graph.IndexSuggestion
+
+func (s byQueries) Len() int { return len(s) }
+func (s byQueries) Less(i, j int) bool {
+	if s[i].Queries != s[j].Queries {
+		return s[i].Queries > s[j].Queries
+	}
+	return strings.Join(s[i].Keys, ",") < strings.Join(s[j].Keys, ",")
+}
+func (s byQueries) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// suggestions returns the fewest indexes that serve every pattern seen that
+// no existing index serves, most used first. Patterns that lead a longer
+// one are served by its index, so only the longest are suggested.
+func (a *indexAdvisor) suggestions() []graph.IndexSuggestion {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var patterns [][]string
+	for p := range a.patterns {
+		fields := strings.Split(p, ",")
+		if !served(fields, a.existing) {
+			patterns = append(patterns, fields)
+		}
+	}
+	sort.Sort(byPatternLength(patterns))
+	var chosen [][]string
+	for _, fields := range patterns {
+		if !served(fields, chosen) {
+			chosen = append(chosen, fields)
+		}
+	}
+	suggested := make([]graph.IndexSuggestion, len(chosen))
+	for i, keys := range chosen {
+		suggested[i].Keys = keys
+	}
+	for _, fields := range patterns {
+		for i, keys := range chosen {
+			if isPrefix(fields, keys) {
+				suggested[i].Queries += a.patterns[strings.Join(fields, ",")]
+				break
+			}
+		}
+	}
+	sort.Sort(byQueries(suggested))
+	return suggested
+}
+
+// SuggestIndexes returns the indexes on the triples collection that would
+// serve the queries the store has made, that it does not have. Stores
+// opened without the index_advisor option suggest none.
+func (qs *TripleStore) SuggestIndexes() []graph.IndexSuggestion {
+	if qs.advisor == nil {
+		return nil
+	}
+	return qs.advisor.suggestions()
+}
+
+// observe counts a query of collection with the index advisor, if there is
+// one, creating the indexes it suggests once it has seen enough of them.
+func (qs *TripleStore) observe(collection string, constraint bson.M) {
+	if qs.advisor == nil || collection != "triples" {
+		return
+	}
+	if qs.advisor.observe(constraint) {
+		qs.createSuggestedIndexes()
+	}
+}
+
+// createSuggestedIndexes creates the indexes the advisor suggests, in the
+// background on the server.
+func (qs *TripleStore) createSuggestedIndexes() {
+	for _, s := range qs.SuggestIndexes() {
+		index := mgo.Index{Key: s.Keys, Background: true, Sparse: true}
+		if err := ensureIndex(qs.db, index); err != nil {
+			glog.Errorf("Error creating suggested index on %v: %v", s.Keys, err)
+			continue
+		}
+		glog.Infof("Created suggested index on %v, for %d queries", s.Keys, s.Queries)
+		qs.advisor.mu.Lock()
+		qs.advisor.existing = append(qs.advisor.existing, s.Keys)
+		qs.advisor.mu.Unlock()
+	}
+}
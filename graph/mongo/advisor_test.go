@@ -0,0 +1,81 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestIndexAdvisor(t *testing.T) {
+	defer func(e func(*mgo.Database, mgo.Index) error) { ensureIndex = e }(ensureIndex)
+	var created [][]string
+	ensureIndex = func(db *mgo.Database, index mgo.Index) error {
+		created = append(created, index.Key)
+		return nil
+	}
+
+	advisor, err := indexAdvisorFrom(graph.Options{"index_advisor": "create", "index_advisor_warmup": 6.0})
+	if err != nil {
+		t.Fatalf("Failed to make index advisor: %v", err)
+	}
+	advisor.existing = [][]string{{"_id"}, {"Label"}}
+	qs := &TripleStore{advisor: advisor, softDelete: true}
+
+	// The queries of the iterators of a path from a node over a predicate,
+	// of a predicate's triples and of a label's triples.
+	subject := qs.live(qs.constraintFor(quad.Subject, "alice", "h"))
+	bySubjectPredicate := qs.live(bson.M{"Subject": "alice", "Predicate": "follows"})
+	predicate := qs.live(qs.constraintFor(quad.Predicate, "follows", "h"))
+	label := qs.live(qs.constraintFor(quad.Label, "people", "h"))
+	for _, c := range []bson.M{subject, bySubjectPredicate, bySubjectPredicate, predicate, label} {
+		qs.observe("triples", c)
+	}
+	qs.observe("nodes", bson.M{"_id": "h"})
+
+	// The index on Subject and Predicate serves queries on Subject alone as
+	// well, and Label already has one.
+	want := []graph.IndexSuggestion{
+		{Keys: []string{"Subject", "Predicate"}, Queries: 3},
+		{Keys: []string{"Predicate"}, Queries: 1},
+	}
+	if got := graph.SuggestIndexes(graph.ReadOnly(qs)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected suggestions, got:%v expect:%v", got, want)
+	}
+	if created != nil {
+		t.Errorf("Unexpected indexes created during warm-up: %v", created)
+	}
+
+	qs.observe("triples", predicate)
+	if expect := [][]string{{"Subject", "Predicate"}, {"Predicate"}}; !reflect.DeepEqual(created, expect) {
+		t.Errorf("Unexpected indexes created after warm-up, got:%v expect:%v", created, expect)
+	}
+	if got := qs.SuggestIndexes(); len(got) != 0 {
+		t.Errorf("Unexpected suggestions once created: %v", got)
+	}
+
+	if _, err := indexAdvisorFrom(graph.Options{"index_advisor": "always"}); err == nil {
+		t.Error("Expected error for unknown index_advisor")
+	}
+	if a, _ := indexAdvisorFrom(graph.Options{}); a != nil {
+		t.Error("Unexpected index advisor without the option")
+	}
+}
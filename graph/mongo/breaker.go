@@ -0,0 +1,163 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+// When the server keeps failing, every query retrying on its own only adds
+// to its load. A store can be given a circuit breaker, shared by its views,
+// that counts the failures of the cursors of its iterators in a row. Once
+// there are breaker_threshold of them, the breaker opens, and iterators
+// fail at once with graph.ErrUnavailable, without going to the server, for
+// breaker_cooldown_secs. The breaker then half-opens: the next iterator is
+// let through, and the breaker closes if its cursor reads a document or
+// finishes cleanly, or opens again if it fails.
+
+import (
+	"sync"
+	"time"
+
+	"github.com/barakmich/glog"
+
+	"github.com/google/cayley/graph"
+)
+
+// defaultBreakerCooldown is how long a breaker stays open if
+// breaker_cooldown_secs is not given.
+const defaultBreakerCooldown = 30 * time.Second
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// A breaker stops queries being sent to a server that keeps failing.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	// When the breaker last opened, or let a probe through.
+	since time.Time
+}
+
+// breakerFrom returns the breaker given by the breaker_threshold and
+// breaker_cooldown_secs options, or nil if there is no threshold.
+func breakerFrom(options graph.Options) *breaker {
+	n, ok := options.IntKey("breaker_threshold")
+	if !ok || n <= 0 {
+		return nil
+	}
+	b := &breaker{threshold: n, cooldown: defaultBreakerCooldown}
+	if secs, ok := options.IntKey("breaker_cooldown_secs"); ok && secs > 0 {
+		b.cooldown = time.Duration(secs) * time.Second
+	}
+	return b
+}
+
+// allow returns whether a query may be sent to the server. An open breaker
+// that has cooled down half-opens and lets one query through; so does a
+// half-open one whose probe has not been heard from for a cool-down, in
+// case it was never read.
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerClosed {
+		return true
+	}
+	if now().Sub(b.since) < b.cooldown {
+		return false
+	}
+	b.state = breakerHalfOpen
+	b.since = now()
+	return true
+}
+
+// report records how a cursor fared: err is nil for one that read a
+// document or finished cleanly. Cancelled queries and those the breaker
+// refused tell nothing of the server.
+func (b *breaker) report(err error) {
+	if b == nil || err == graph.ErrQueryCancelled || err == graph.ErrUnavailable {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.state != breakerClosed {
+			glog.Infoln("Mongo is answering again, closing the circuit breaker")
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.state == breakerClosed && b.failures >= b.threshold {
+		glog.Warningf("Opening the circuit breaker for %v after %d failures in a row: %v", b.cooldown, b.failures, err)
+		b.state = breakerOpen
+		b.since = now()
+	}
+}
+
+// health returns the state of the breaker. An open breaker that has
+// cooled down is given as half-open, as the next query would be let
+// through.
+func (b *breaker) health() graph.Health {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h := graph.Health{OK: true, Breaker: b.state.String(), Failures: b.failures}
+	if b.state == breakerOpen {
+		if left := b.cooldown - now().Sub(b.since); left > 0 {
+			h.OK = false
+			h.RetryInSecs = left.Seconds()
+		} else {
+			h.Breaker = breakerHalfOpen.String()
+		}
+	}
+	return h
+}
+
+// Health returns the state of the store's circuit breaker, if it has one.
+func (qs *TripleStore) Health() graph.Health {
+	if qs.breaker == nil {
+		return graph.Health{OK: true}
+	}
+	return qs.breaker.health()
+}
+
+// refused stands in for the cursor of an iterator the breaker did not let
+// through.
+type refused struct{}
+
+func (refused) Next(result interface{}) bool { return false }
+func (refused) Err() error                   { return graph.ErrUnavailable }
+func (refused) Close() error                 { return nil }
@@ -0,0 +1,99 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestBreaker(t *testing.T) {
+	defer func(o func(*Iterator) cursor) { openCursor = o }(openCursor)
+	defer func() { now = time.Now }()
+	clock := time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	if b := breakerFrom(graph.Options{}); b != nil {
+		t.Errorf("Unexpected breaker without a threshold: %+v", b)
+	}
+	if h := (&TripleStore{}).Health(); !h.OK || h.Breaker != "" {
+		t.Errorf("Unexpected health of a store without a breaker: %+v", h)
+	}
+
+	// The server is down until fail is cleared.
+	var (
+		fail   error = &mgo.QueryError{Code: 6, Message: "host unreachable"}
+		opened int
+	)
+	openCursor = func(*Iterator) cursor {
+		opened++
+		if fail != nil {
+			return &failingCursor{err: fail}
+		}
+		return &failingCursor{ids: []string{"a"}, n: 1}
+	}
+	qs := &TripleStore{breaker: breakerFrom(graph.Options{
+		"breaker_threshold":     3.0,
+		"breaker_cooldown_secs": 30.0,
+	})}
+	query := func() error {
+		it := &Iterator{qs: qs, collection: "nodes", limit: -1}
+		it.open()
+		for it.Next() {
+		}
+		return it.Err()
+	}
+	check := func(when string, ok bool, state string, queries int) {
+		h := qs.Health()
+		if h.OK != ok || h.Breaker != state {
+			t.Errorf("Unexpected health %s, got:%+v expect ok:%t breaker:%s", when, h, ok, state)
+		}
+		if opened != queries {
+			t.Errorf("Unexpected number of queries sent %s, got:%d expect:%d", when, opened, queries)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		query()
+	}
+	check("under the threshold", true, "closed", 2)
+	query()
+	check("at the threshold", false, "open", 3)
+	if err := query(); err != graph.ErrUnavailable {
+		t.Errorf("Unexpected error of a query while open, got:%v expect:%v", err, graph.ErrUnavailable)
+	}
+	check("while open", false, "open", 3)
+
+	clock = clock.Add(31 * time.Second)
+	check("after the cool-down", true, "half-open", 3)
+	query()
+	check("after a failed probe", false, "open", 4)
+	query()
+	check("after a failed probe", false, "open", 4)
+
+	clock = clock.Add(31 * time.Second)
+	fail = nil
+	if err := query(); err != nil {
+		t.Errorf("Unexpected error of a probe, got:%v", err)
+	}
+	check("after a good probe", true, "closed", 5)
+	if h := qs.Health(); h.Failures != 0 {
+		t.Errorf("Unexpected failures after a good probe, got:%d", h.Failures)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// orphanPipeline returns the aggregation over the nodes collection that
+// finds the nodes no live triple names in any direction. Each node looks
+// for at most one such triple, so a node of many triples costs no more
+// than one of few. It needs MongoDB 3.6 or later.
+func (qs *TripleStore) orphanPipeline() []bson.M {
+	var refs []interface{}
+	for _, field := range []string{"Subject", "Predicate", "Object", "Label"} {
+		refs = append(refs, bson.M{"$eq": []interface{}{"$" + field, "$$name"}})
+	}
+	match := qs.live(bson.M{"$expr": bson.M{"$or": refs}})
+	return []bson.M{
+		{"$lookup": bson.M{
+			"from": "triples",
+			"let":  bson.M{"name": "$Name"},
+			"pipeline": []bson.M{
+				{"$match": match},
+				{"$limit": 1},
+				{"$project": bson.M{"_id": 1}},
+			},
+			"as": "refs",
+		}},
+		{"$match": bson.M{"refs": bson.M{"$size": 0}}},
+		{"$project": bson.M{"_id": 1, "Name": 1, "Size": 1}},
+	}
+}
+
+// orphanedNodes returns the nodes that no live triple names, found with an
+// aggregation over the nodes collection.
+var orphanedNodes = func(qs *TripleStore) ([]MongoNode, error) {
+	var nodes []MongoNode
+	err := qs.db.C("nodes").Pipe(qs.orphanPipeline()).AllowDiskUse().All(&nodes)
+	return nodes, err
+}
+
+// removeUnchanged removes node if its size is still as it was read,
+// returning whether it did, so that a node named again since it was read
+// is kept.
+var removeUnchanged = func(qs *TripleStore, node MongoNode) (bool, error) {
+	err := qs.db.C("nodes").Remove(bson.M{"_id": node.Id, "Size": node.Size})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CompactNodes removes the nodes that no live triple names, such as those
+// left behind by deletes whose counts went astray, and returns how many it
+// removed.
+//
+// It may be run while the store is in use. A node whose size changes once
+// it is found, as it does when a triple naming it is written, is kept; a
+// node removed just before such a write has yet to count its triple is
+// written back by the write.
+func (qs *TripleStore) CompactNodes() (int, error) {
+	nodes, err := orphanedNodes(qs)
+	if err != nil {
+		return 0, err
+	}
+	var removed int
+	for _, node := range nodes {
+		ok, err := removeUnchanged(qs, node)
+		if err != nil {
+			return removed, err
+		}
+		if !ok {
+			glog.V(2).Infof("Keeping node %q, which changed during compaction", node.Name)
+			continue
+		}
+		qs.forgetName(node.Id)
+		removed++
+	}
+	glog.Infof("Compacted %d of %d orphaned nodes", removed, len(nodes))
+	return removed, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/quad"
+)
+
+// fakeNodes simulates the collections that node compaction reads, matching
+// triples as the lookup of orphanPipeline would.
+type fakeNodes struct {
+	qs      *TripleStore
+	triples []bson.M
+	nodes   map[string]MongoNode
+}
+
+func (f *fakeNodes) orphans(qs *TripleStore) ([]MongoNode, error) {
+	lookup := qs.orphanPipeline()[0]["$lookup"].(bson.M)
+	match := lookup["pipeline"].([]bson.M)[0]["$match"].(bson.M)
+	var orphans []MongoNode
+	for _, node := range f.nodes {
+		named := false
+		for _, doc := range f.triples {
+			if f.matches(match, doc, node.Name) {
+				named = true
+				break
+			}
+		}
+		if !named {
+			orphans = append(orphans, node)
+		}
+	}
+	return orphans, nil
+}
+
+// matches evaluates the parts of a lookup's $match that orphanPipeline
+// uses.
+func (f *fakeNodes) matches(match bson.M, doc bson.M, name string) bool {
+	for k, v := range match {
+		switch k {
+		case "$expr":
+			any := false
+			for _, ref := range v.(bson.M)["$or"].([]interface{}) {
+				eq := ref.(bson.M)["$eq"].([]interface{})
+				if eq[1] != "$$name" {
+					return false
+				}
+				if doc[strings.TrimPrefix(eq[0].(string), "$")] == name {
+					any = true
+				}
+			}
+			if !any {
+				return false
+			}
+		case deletedField:
+			if deleted, _ := doc[deletedField].(bool); deleted == v.(bson.M)["$ne"] {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeNodes) remove(qs *TripleStore, node MongoNode) (bool, error) {
+	if cur, ok := f.nodes[node.Id]; !ok || cur.Size != node.Size {
+		return false, nil
+	}
+	delete(f.nodes, node.Id)
+	return true, nil
+}
+
+func (f *fakeNodes) add(t quad.Quad) {
+	doc := f.qs.docFor(t)
+	f.triples = append(f.triples, doc)
+	for _, name := range []string{t.Subject, t.Predicate, t.Object, t.Label} {
+		if name == "" {
+			continue
+		}
+		id := f.qs.ConvertStringToByteHash(name)
+		node := f.nodes[id]
+		node.Id, node.Name = id, name
+		node.Size++
+		f.nodes[id] = node
+	}
+}
+
+// delete removes t, leaving its nodes as a delete whose counts went astray
+// does.
+func (f *fakeNodes) delete(t quad.Quad) {
+	id := f.qs.getIdForTriple(t)
+	for i, doc := range f.triples {
+		if doc["_id"] == id {
+			if f.qs.softDelete {
+				doc[deletedField] = true
+			} else {
+				f.triples = append(f.triples[:i], f.triples[i+1:]...)
+			}
+			return
+		}
+	}
+}
+
+func (f *fakeNodes) names() []string {
+	var names []string
+	for _, node := range f.nodes {
+		names = append(names, node.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCompactNodes(t *testing.T) {
+	defer func(r func(*TripleStore, MongoNode) (bool, error)) { removeUnchanged = r }(removeUnchanged)
+	defer func(o func(*TripleStore) ([]MongoNode, error)) { orphanedNodes = o }(orphanedNodes)
+
+	for _, softDelete := range []bool{false, true} {
+		qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, softDelete: softDelete}
+		f := &fakeNodes{qs: qs, nodes: make(map[string]MongoNode)}
+		orphanedNodes, removeUnchanged = f.orphans, f.remove
+
+		for _, q := range []quad.Quad{
+			{"A", "follows", "B", ""},
+			{"C", "follows", "B", ""},
+			{"B", "status", "cool", "status_graph"},
+			{"D", "status", "cool", "status_graph"},
+		} {
+			f.add(q)
+		}
+		f.delete(quad.Quad{"C", "follows", "B", ""})
+		f.delete(quad.Quad{"D", "status", "cool", "status_graph"})
+
+		n, err := qs.CompactNodes()
+		if err != nil {
+			t.Fatalf("Unexpected error compacting nodes: %v", err)
+		}
+		if n != 2 {
+			t.Errorf("Unexpected number of nodes compacted with soft_delete %t, got:%d expect:2", softDelete, n)
+		}
+		expect := []string{"A", "B", "cool", "follows", "status", "status_graph"}
+		if got := f.names(); !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected nodes after compaction with soft_delete %t, got:%v expect:%v", softDelete, got, expect)
+		}
+	}
+}
+
+// TestCompactNodesOnline simulates a triple written for an orphaned node
+// while compaction runs.
+func TestCompactNodesOnline(t *testing.T) {
+	defer func(r func(*TripleStore, MongoNode) (bool, error)) { removeUnchanged = r }(removeUnchanged)
+	defer func(o func(*TripleStore) ([]MongoNode, error)) { orphanedNodes = o }(orphanedNodes)
+
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs}
+	f := &fakeNodes{qs: qs, nodes: make(map[string]MongoNode)}
+	f.add(quad.Quad{"A", "follows", "B", ""})
+	f.delete(quad.Quad{"A", "follows", "B", ""})
+	orphanedNodes = func(qs *TripleStore) ([]MongoNode, error) {
+		orphans, err := f.orphans(qs)
+		// A is written again once the orphans are found.
+		f.add(quad.Quad{"A", "likes", "C", ""})
+		return orphans, err
+	}
+	removeUnchanged = f.remove
+
+	n, err := qs.CompactNodes()
+	if err != nil {
+		t.Fatalf("Unexpected error compacting nodes: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Unexpected number of nodes compacted, got:%d expect:2", n)
+	}
+	expect := []string{"A", "C", "likes"}
+	if got := f.names(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected nodes after compaction, got:%v expect:%v", got, expect)
+	}
+}
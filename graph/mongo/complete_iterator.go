@@ -0,0 +1,266 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+)
+
+// nameIndex is the index on the names of nodes, made by cayley init with
+// the name_index option, which lets completions be read from it in order.
+var nameIndex = mgo.Index{Key: []string{"Name"}, Background: true}
+
+// CompleteIterator yields the nodes whose names start with a prefix, in
+// order of name, up to a limit.
+type CompleteIterator struct {
+	uid    uint64
+	tags   graph.Tagger
+	qs     *TripleStore
+	prefix string
+	limit  int
+	iter   cursor
+	size   int64
+	result graph.Value
+}
+
+// completeNodes returns a cursor over the names of the nodes the iterator
+// completes its prefix with, in order of name and up to its limit.
+var completeNodes = func(it *CompleteIterator) cursor {
+	q := it.qs.db.C("nodes").Find(it.constraint()).Select(bson.M{"Name": 1}).Sort("Name")
+	if it.limit >= 0 {
+		q = q.Limit(it.limit)
+	}
+	return q.Iter()
+}
+
+// countCompletions returns the number of nodes the iterator completes its
+// prefix with, before its limit.
+var countCompletions = func(it *CompleteIterator) (int, error) {
+	return it.qs.db.C("nodes").Find(it.constraint()).Count()
+}
+
+// NewCompleteIterator returns an iterator over the nodes whose names start
+// with prefix, in order of name, yielding at most limit of them unless
+// limit is negative. Names are compared by their bytes, as the server
+// compares strings. Names kept in GridFS are not completed. It returns the
+// error met sizing the iterator, if any.
+func NewCompleteIterator(qs *TripleStore, prefix string, limit int) (*CompleteIterator, error) {
+	it := &CompleteIterator{
+		uid:    iterator.NextUID(),
+		qs:     qs,
+		prefix: prefix,
+		limit:  limit,
+	}
+	size, err := countCompletions(it)
+	if err != nil {
+		return nil, err
+	}
+	if limit >= 0 && size > limit {
+		size = limit
+	}
+	it.size = int64(size)
+	it.open()
+	return it, nil
+}
+
+// constraint returns the query constraint selecting the nodes whose names
+// start with the prefix. They are those from the prefix up to it followed
+// by 0xff, which is in no UTF-8 string, so that an index on the names is
+// read over that range alone.
+func (it *CompleteIterator) constraint() bson.M {
+	ops := bson.M{"$gte": it.prefix, "$lt": it.prefix + "\xff"}
+	if strings.HasPrefix(literalPrefix, it.prefix) {
+		// The stand-ins for names kept in GridFS are not names.
+		ops["$not"] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(literalPrefix)}
+	}
+	return bson.M{"Name": ops}
+}
+
+func (it *CompleteIterator) open() {
+	it.qs.roundTrip()
+	it.iter = completeNodes(it)
+}
+
+func (it *CompleteIterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *CompleteIterator) Reset() {
+	it.iter.Close()
+	it.open()
+}
+
+// Rewind does nothing, as Contains walks a clone of its own.
+func (it *CompleteIterator) Rewind() {}
+
+func (it *CompleteIterator) Close() {
+	it.iter.Close()
+}
+
+func (it *CompleteIterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *CompleteIterator) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+}
+
+func (it *CompleteIterator) Clone() graph.Iterator {
+	m, err := NewCompleteIterator(it.qs, it.prefix, it.limit)
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return iterator.NewNull()
+	}
+	m.tags.CopyFrom(it)
+	return m
+}
+
+// nameDoc is a node document with only its name selected.
+type nameDoc struct {
+	Id   string `bson:"_id"`
+	Name string `bson:"Name"`
+}
+
+func (it *CompleteIterator) Next() bool {
+	var result nameDoc
+	if it.qs.cancelled() {
+		it.iter.Close()
+		return false
+	}
+	if !it.iter.Next(&result) {
+		err := it.iter.Err()
+		if err != nil {
+			glog.Errorln("Error Nexting Iterator: ", err)
+		}
+		return false
+	}
+	// We already know the name, so spare NameOf the lookup.
+	it.qs.idCache.Put(result.Id, result.Name)
+	it.result = result.Id
+	return true
+}
+
+func (it *CompleteIterator) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *CompleteIterator) Result() graph.Value {
+	return it.result
+}
+
+func (it *CompleteIterator) NextPath() bool {
+	return false
+}
+
+// No subiterators.
+func (it *CompleteIterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+// Contains checks the name of v against the prefix. With a limit, whether
+// the node is among the first completions is only known by walking them.
+func (it *CompleteIterator) Contains(v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	hash, err := literal(v)
+	if err != nil {
+		glog.Errorf("Error: %v for value %v", err, v)
+		return graph.ContainsLogOut(it, v, false)
+	}
+	if name := it.qs.NameOf(hash); name == "" || !strings.HasPrefix(name, it.prefix) {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	if it.limit >= 0 {
+		c := it.Clone()
+		defer c.Close()
+		for graph.Next(c) {
+			if c.Result() == hash {
+				it.result = hash
+				return graph.ContainsLogOut(it, v, true)
+			}
+		}
+		return graph.ContainsLogOut(it, v, false)
+	}
+	it.result = hash
+	return graph.ContainsLogOut(it, v, true)
+}
+
+func (it *CompleteIterator) Size() (int64, bool) {
+	return it.size, true
+}
+
+var mongoCompleteType graph.Type
+
+func init() {
+	mongoCompleteType = graph.RegisterIterator("mongo_complete")
+}
+
+func (it *CompleteIterator) Type() graph.Type { return mongoCompleteType }
+
+func (it *CompleteIterator) Optimize() (graph.Iterator, bool) { return it, false }
+
+func (it *CompleteIterator) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s size:%d %q limit:%d)", strings.Repeat(" ", indent), it.Type(), it.size, it.prefix, it.limit)
+}
+
+// Without an index on names, the server reads every node to find the
+// completions.
+func (it *CompleteIterator) Stats() graph.IteratorStats {
+	next := int64(indexCost)
+	if !it.qs.nameIndexed {
+		next = queryCost
+	}
+	return graph.IteratorStats{
+		ContainsCost: queryCost,
+		NextCost:     next,
+		Size:         it.size,
+	}
+}
+
+// nameIndexed returns whether any of indexes is on the names of nodes
+// alone, or led by them.
+func nameIndexed(indexes []mgo.Index) bool {
+	for _, index := range indexes {
+		if len(index.Key) != 0 && index.Key[0] == nameIndex.Key[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// Complete returns an iterator over the nodes whose names start with
+// prefix, found by the server. See NewCompleteIterator.
+func (qs *TripleStore) Complete(prefix string, limit int) graph.Iterator {
+	it, err := NewCompleteIterator(qs, prefix, limit)
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return iterator.NewNull()
+	}
+	return it
+}
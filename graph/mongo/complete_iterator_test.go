@@ -0,0 +1,160 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"errors"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+// nameCursor yields the given node documents.
+type nameCursor struct {
+	docs []nameDoc
+}
+
+func (c *nameCursor) Next(result interface{}) bool {
+	if len(c.docs) == 0 {
+		return false
+	}
+	*result.(*nameDoc) = c.docs[0]
+	c.docs = c.docs[1:]
+	return true
+}
+
+func (c *nameCursor) Err() error   { return nil }
+func (c *nameCursor) Close() error { return nil }
+
+// matchName returns whether name is matched by the operators of a
+// constraint on the Name field, as the server would match it.
+func matchName(name string, ops bson.M) bool {
+	for op, v := range ops {
+		switch op {
+		case "$gte":
+			if name < v.(string) {
+				return false
+			}
+		case "$lt":
+			if name >= v.(string) {
+				return false
+			}
+		case "$not":
+			if regexp.MustCompile(v.(bson.RegEx).Pattern).MatchString(name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var nameFixture = []string{
+	"alice", "alan", "albert", "al", "bob", "Alice", "alé", "zoe",
+	// The stand-in for a name kept in GridFS.
+	literalPrefix + "0123",
+}
+
+func TestComplete(t *testing.T) {
+	defer func(c func(*CompleteIterator) cursor, n func(*CompleteIterator) (int, error)) {
+		completeNodes, countCompletions = c, n
+	}(completeNodes, countCompletions)
+	qs := &TripleStore{hasher: sha1.New(), idCache: NewIDLru(100)}
+	// Every name is cached, as there is no nodes collection to look them
+	// up in.
+	for _, name := range nameFixture {
+		qs.idCache.Put(qs.ValueOf(name).(string), name)
+	}
+
+	// The fake server selects, sorts and limits the nodes as the query
+	// asks.
+	matching := func(it *CompleteIterator) []string {
+		ops := it.constraint()["Name"].(bson.M)
+		var names []string
+		for _, name := range nameFixture {
+			if matchName(name, ops) {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	countCompletions = func(it *CompleteIterator) (int, error) {
+		return len(matching(it)), nil
+	}
+	completeNodes = func(it *CompleteIterator) cursor {
+		names := matching(it)
+		sort.Strings(names)
+		if it.limit >= 0 && len(names) > it.limit {
+			names = names[:it.limit]
+		}
+		c := &nameCursor{}
+		for _, name := range names {
+			c.docs = append(c.docs, nameDoc{Id: qs.ValueOf(name).(string), Name: name})
+		}
+		return c
+	}
+
+	for _, test := range []struct {
+		prefix string
+		limit  int
+		expect []string
+	}{
+		{prefix: "al", limit: -1, expect: []string{"al", "alan", "albert", "alice", "alé"}},
+		{prefix: "al", limit: 2, expect: []string{"al", "alan"}},
+		{prefix: "ali", limit: 10, expect: []string{"alice"}},
+		{prefix: "A", limit: 10, expect: []string{"Alice"}},
+		{prefix: "x", limit: 10},
+		{prefix: "", limit: 3, expect: []string{"Alice", "al", "alan"}},
+	} {
+		it, err := NewCompleteIterator(qs, test.prefix, test.limit)
+		if err != nil {
+			t.Fatalf("Failed to complete %q: %v", test.prefix, err)
+		}
+		var got []string
+		for graph.Next(it) {
+			got = append(got, qs.NameOf(it.Result()))
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected completions of %q up to %d, got:%q expect:%q", test.prefix, test.limit, got, test.expect)
+		}
+	}
+
+	it, err := NewCompleteIterator(qs, "al", 2)
+	if err != nil {
+		t.Fatalf("Failed to complete \"al\": %v", err)
+	}
+	for _, test := range []struct {
+		name   string
+		expect bool
+	}{
+		{name: "alan", expect: true},
+		// Past the limit.
+		{name: "alice"},
+		{name: "bob"},
+	} {
+		if got := it.Contains(qs.ValueOf(test.name)); got != test.expect {
+			t.Errorf("Unexpected check of %q among the first completions of \"al\", got:%t expect:%t", test.name, got, test.expect)
+		}
+	}
+	countCompletions = func(*CompleteIterator) (int, error) { return 0, errors.New("no server") }
+	if it := qs.Complete("al", 2); it.Type() != graph.Null {
+		t.Errorf("Unexpected completions without a count, got:%s", it.DebugString(0))
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+// compressedCollections are the collections whose block compression may be
+// chosen when they are created.
+var compressedCollections = []string{"triples", "nodes"}
+
+// blockCompressors are the WiredTiger block compressors, by the names the
+// options give them.
+var blockCompressors = map[string]bool{
+	"none":   true,
+	"snappy": true,
+	"zlib":   true,
+	"zstd":   true,
+}
+
+// compressorsFrom returns the block compressor the options choose for each
+// compressed collection that has one: the <collection>_block_compressor
+// option, or else the block_compressor option.
+func compressorsFrom(options graph.Options) (map[string]string, error) {
+	all, _ := options.StringKey("block_compressor")
+	compressors := make(map[string]string)
+	for _, c := range compressedCollections {
+		name, ok := options.StringKey(c + "_block_compressor")
+		if !ok {
+			name = all
+		}
+		if name == "" {
+			continue
+		}
+		if !blockCompressors[name] {
+			return nil, fmt.Errorf("mongo: unknown block compressor %q for %s", name, c)
+		}
+		compressors[c] = name
+	}
+	return compressors, nil
+}
+
+// createCommand returns the command creating collection with its blocks
+// compressed by compressor.
+func createCommand(collection, compressor string) bson.D {
+	return bson.D{
+		{"create", collection},
+		{"storageEngine", bson.M{
+			"wiredTiger": bson.M{"configString": "block_compressor=" + compressor},
+		}},
+	}
+}
+
+// createCollection runs the create command cmd against db.
+var createCollection = func(db *mgo.Database, cmd bson.D) error {
+	return db.Run(cmd, nil)
+}
+
+// createCompressed creates the collections given compressors, before
+// anything is written to them, as their compression is fixed when they are
+// created. Collections that already exist keep theirs.
+func createCompressed(db *mgo.Database, compressors map[string]string) error {
+	for _, c := range compressedCollections {
+		compressor, ok := compressors[c]
+		if !ok {
+			continue
+		}
+		err := createCollection(db, createCommand(c, compressor))
+		if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == 48 {
+			glog.Warningf("Collection %s already exists, so its blocks are not compressed with %s", c, compressor)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("mongo: could not create %s collection: %v", c, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestCompressorsFrom(t *testing.T) {
+	for _, test := range []struct {
+		options graph.Options
+		expect  map[string]string
+		err     bool
+	}{
+		{options: graph.Options{}, expect: map[string]string{}},
+		{
+			options: graph.Options{"block_compressor": "zstd"},
+			expect:  map[string]string{"triples": "zstd", "nodes": "zstd"},
+		},
+		{
+			options: graph.Options{"block_compressor": "zlib", "nodes_block_compressor": "snappy"},
+			expect:  map[string]string{"triples": "zlib", "nodes": "snappy"},
+		},
+		{
+			options: graph.Options{"triples_block_compressor": "none"},
+			expect:  map[string]string{"triples": "none"},
+		},
+		{options: graph.Options{"block_compressor": "lz4"}, err: true},
+	} {
+		got, err := compressorsFrom(test.options)
+		if (err != nil) != test.err {
+			t.Errorf("Unexpected error for %v: %v", test.options, err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected compressors for %v, got:%v expect:%v", test.options, got, test.expect)
+		}
+	}
+}
+
+func TestCreateCompressed(t *testing.T) {
+	defer func(c func(*mgo.Database, bson.D) error) { createCollection = c }(createCollection)
+	var cmds []bson.D
+	createCollection = func(_ *mgo.Database, cmd bson.D) error {
+		cmds = append(cmds, cmd)
+		if cmd[0].Value == "nodes" {
+			return &mgo.QueryError{Code: 48, Message: "collection already exists"}
+		}
+		return nil
+	}
+
+	err := createCompressed(nil, map[string]string{"triples": "zstd", "nodes": "snappy"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating an existing collection: %v", err)
+	}
+	expect := []bson.D{
+		{{"create", "triples"}, {"storageEngine", bson.M{"wiredTiger": bson.M{"configString": "block_compressor=zstd"}}}},
+		{{"create", "nodes"}, {"storageEngine", bson.M{"wiredTiger": bson.M{"configString": "block_compressor=snappy"}}}},
+	}
+	if !reflect.DeepEqual(cmds, expect) {
+		t.Errorf("Unexpected create commands, got:%v expect:%v", cmds, expect)
+	}
+
+	cmds = nil
+	if err := createCompressed(nil, map[string]string{}); err != nil || cmds != nil {
+		t.Errorf("Unexpected create commands without compression, got:%v err:%v", cmds, err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+// Builds query constraints from values that come from outside the store.
+//
+// A value in a constraint that is itself a document is read by the server
+// as operators, not matched: {"Subject": {"$where": "..."}} runs a script.
+// Values that reach a query from a client, such as the node an iterator is
+// constrained to, are therefore made plain strings before they are put in
+// one, and constraints are only given operators by the code building them.
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+// ErrNotLiteral is returned for a value that cannot be matched literally,
+// such as a document that the server would read as query operators.
+var ErrNotLiteral = errors.New("mongo: value cannot be matched literally")
+
+// literal returns v as a string to be matched exactly. Strings, including
+// those that look like operators, are kept as they are, and numbers and
+// booleans are coerced to their string form, since every field a
+// constraint matches holds a name or hash. Documents, maps, slices and
+// anything else are rejected with ErrNotLiteral.
+func literal(v graph.Value) (string, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(rv.Interface()), nil
+	}
+	return "", ErrNotLiteral
+}
+
+// literals returns each of vals as a literal string, or ErrNotLiteral if
+// any of them cannot be one.
+func literals(vals []graph.Value) ([]string, error) {
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		s, err := literal(v)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+// A constraint builds a query constraint. The fields it matches exactly are
+// given as strings, so they can only be matched literally; operators are
+// added explicitly, with op.
+type constraint struct {
+	m bson.M
+}
+
+func newConstraint() *constraint {
+	return &constraint{m: bson.M{}}
+}
+
+// eq constrains field to hold exactly v.
+func (c *constraint) eq(field, v string) *constraint {
+	c.m[field] = v
+	return c
+}
+
+// in constrains field to hold exactly one of vs.
+func (c *constraint) in(field string, vs []string) *constraint {
+	return c.op(field, "$in", vs)
+}
+
+// op constrains field with the operator op and its operand v. The operand
+// is passed to the server as it is, so it must be made by the store, or be
+// made of literals.
+func (c *constraint) op(field, op string, v interface{}) *constraint {
+	c.m[field] = bson.M{op: v}
+	return c
+}
+
+// ops constrains field with each of the operators in ops, as op does with
+// one.
+func (c *constraint) ops(field string, ops bson.M) *constraint {
+	c.m[field] = ops
+	return c
+}
+
+// M returns the constraint as a document.
+func (c *constraint) M() bson.M {
+	return c.m
+}
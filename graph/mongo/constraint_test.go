@@ -0,0 +1,76 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestLiteral(t *testing.T) {
+	for _, test := range []struct {
+		value  graph.Value
+		expect string
+		err    error
+	}{
+		{value: "alice", expect: "alice"},
+		{value: "$where", expect: "$where"},
+		{value: `{"$gt": ""}`, expect: `{"$gt": ""}`},
+		{value: 42, expect: "42"},
+		{value: true, expect: "true"},
+		{value: bson.M{"$where": "sleep(1000)"}, err: ErrNotLiteral},
+		{value: map[string]interface{}{"$ne": ""}, err: ErrNotLiteral},
+		{value: bson.D{{"$gt", ""}}, err: ErrNotLiteral},
+		{value: []interface{}{"a", "b"}, err: ErrNotLiteral},
+		{value: nil, err: ErrNotLiteral},
+	} {
+		got, err := literal(test.value)
+		if err != test.err {
+			t.Errorf("Unexpected error for %#v, got:%v expect:%v", test.value, err, test.err)
+		}
+		if got != test.expect {
+			t.Errorf("Unexpected literal for %#v, got:%q expect:%q", test.value, got, test.expect)
+		}
+	}
+}
+
+func TestConstraintLiterals(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Subject}
+
+	// A name that looks like an operator is matched as a string.
+	c := qs.constraintFor(quad.Subject, "$where", "$gt")
+	expect := bson.M{"Subject": "$where", shardKeyField: "$gt"}
+	if !reflect.DeepEqual(c, expect) {
+		t.Errorf("Unexpected constraint, got:%v expect:%v", c, expect)
+	}
+
+	// Values that would be read as operators never reach a query.
+	if it := NewIterator(qs, "triples", quad.Subject, bson.M{"$where": "true"}); it != nil {
+		t.Errorf("Expected no iterator for an operator value, got:%v", it)
+	}
+	labels := []graph.Value{qs.ConvertStringToByteHash("2014"), bson.M{"$ne": ""}}
+	if it, err := NewLabelsIterator(qs, labels); it != nil || err != ErrNotLiteral {
+		t.Errorf("Expected no iterator for an operator label, got:%v %v expect:nil %v", it, err, ErrNotLiteral)
+	}
+	if _, err := literals(labels); err != ErrNotLiteral {
+		t.Errorf("Unexpected error for operator label, got:%v expect:%v", err, ErrNotLiteral)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+// The server closes cursors that have been idle for ten minutes, so a scan
+// that is consumed slowly, such as a dump of a large graph, can die part way
+// through. Either the timeout can be turned off for the session, or each
+// iterator can reopen its cursor periodically, carrying on from the last
+// document it read.
+//
+// A cursor waiting on a server that does not reply would hold up its query
+// for good, so each read from a cursor can also be given a deadline.
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+// now is replaced by tests to simulate long scans.
+var now = time.Now
+
+// cursorOptionsFrom returns whether the cursor_no_timeout option is set, and
+// the period given by the cursor_refresh_secs option after which iterators
+// reopen their cursors, or zero if they never do.
+func cursorOptionsFrom(options graph.Options) (noTimeout bool, refresh time.Duration) {
+	noTimeout, _ = options.BoolKey("cursor_no_timeout")
+	if secs, ok := options.IntKey("cursor_refresh_secs"); ok && secs > 0 {
+		refresh = time.Duration(secs) * time.Second
+	}
+	return noTimeout, refresh
+}
+
+// nextTimeoutFrom returns the deadline given by the next_timeout_secs
+// option for each read from a cursor, or zero if there is none.
+func nextTimeoutFrom(options graph.Options) time.Duration {
+	if secs, ok := options.IntKey("next_timeout_secs"); ok && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+// cursorRetriesFrom returns the number of times the cursor_retries option
+// lets an iterator reissue its query after a transient error.
+func cursorRetriesFrom(options graph.Options) int {
+	if n, ok := options.IntKey("cursor_retries"); ok && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// ErrNextTimeout is the error of an iterator that gave up waiting for its
+// next result.
+var ErrNextTimeout = errors.New("mongo: timed out waiting for the next result")
+
+// A cursor reads the documents a query selects. It is satisfied by
+// *mgo.Iter.
+type cursor interface {
+	Next(result interface{}) bool
+	Err() error
+	Close() error
+}
+
+// abandoned stands in for a cursor whose read timed out, which may never
+// be done with.
+type abandoned struct{}
+
+func (abandoned) Next(result interface{}) bool { return false }
+func (abandoned) Err() error                   { return ErrNextTimeout }
+func (abandoned) Close() error                 { return nil }
+
+// next reads the next document from the iterator's cursor into doc. If the
+// read takes longer than the store's next timeout, the cursor is abandoned,
+// to be closed whenever the read returns, and the iterator reports
+// ErrNextTimeout until it is reset. A read is given up in the same way when
+// the query the store is scoped to is cancelled.
+func (it *Iterator) next(doc *tripleDoc) bool {
+	if it.qs.nextTimeout <= 0 && it.qs.scope == nil {
+		return it.iter.Next(doc)
+	}
+	var timeout <-chan time.Time
+	if it.qs.nextTimeout > 0 {
+		timeout = time.After(it.qs.nextTimeout)
+	}
+	type reply struct {
+		doc   tripleDoc
+		found bool
+	}
+	c := make(chan reply, 1)
+	iter := it.iter
+	go func() {
+		var r reply
+		r.found = iter.Next(&r.doc)
+		c <- r
+	}()
+	select {
+	case r := <-c:
+		*doc = r.doc
+		return r.found
+	case <-timeout:
+		go func() {
+			<-c
+			iter.Close()
+		}()
+		it.iter = abandoned{}
+		return false
+	case <-it.qs.done():
+		go func() {
+			<-c
+			iter.Close()
+		}()
+		it.iter = stopped{}
+		return false
+	}
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *Iterator) Err() error {
+	return it.iter.Err()
+}
+
+// needsRefresh returns whether the iterator's cursor is due to be reopened.
+func (it *Iterator) needsRefresh() bool {
+	return it.resumable() && it.qs.cursorRefresh > 0 && it.lastID != "" && now().Sub(it.opened) >= it.qs.cursorRefresh
+}
+
+// resumable returns whether the iterator's query can carry on from the
+// last document read. Iterators sorted on anything but _id cannot, nor can
+// sampled iterators, which would draw another sample.
+func (it *Iterator) resumable() bool {
+	if it.sample > 0 {
+		return false
+	}
+	return it.sort == nil || len(it.sort) == 1 && it.sort[0] == "-_id"
+}
+
+// transientCodes are the codes of server errors a query may succeed after
+// trying again, such as those of a replica set electing a new primary.
+var transientCodes = map[int]bool{
+	6:     true, // HostUnreachable
+	7:     true, // HostNotFound
+	43:    true, // CursorNotFound
+	89:    true, // NetworkTimeout
+	91:    true, // ShutdownInProgress
+	189:   true, // PrimarySteppedDown
+	9001:  true, // SocketException
+	10107: true, // NotMaster
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotMasterNoSlaveOk
+	13436: true, // NotMasterOrSecondary
+}
+
+// transient returns whether err, from a cursor, may pass if the query is
+// reissued: a lost connection, a lost cursor, or a server that is not, or
+// is no longer, the primary. A timed out read is not retried.
+func transient(err error) bool {
+	switch err := err.(type) {
+	case nil:
+		return false
+	case net.Error:
+		return true
+	case *mgo.QueryError:
+		if transientCodes[err.Code] {
+			return true
+		}
+		msg := err.Message
+		return strings.Contains(msg, "not master") || strings.Contains(msg, "node is recovering")
+	}
+	return err == io.EOF || err == mgo.ErrCursor
+}
+
+// reissue returns a new cursor carrying on from the last document the
+// iterator read, once the session has let go of the connection that
+// failed.
+var reissue = func(it *Iterator) cursor {
+	it.qs.session.Refresh()
+	it.qs.roundTrip()
+	if it.lastID == "" {
+		return it.query().Iter()
+	}
+	return it.resumeQuery().Iter()
+}
+
+// retry replaces a cursor stopped by a transient error with a reissued
+// query, returning whether it did. Each iterator retries at most
+// cursor_retries times, and only if its query can be resumed.
+func (it *Iterator) retry() bool {
+	err := it.Err()
+	if !transient(err) || it.retries >= it.qs.cursorRetries || !it.resumable() {
+		return false
+	}
+	it.retries++
+	glog.Warningf("Retrying query after %d documents (attempt %d of %d): %v", it.read, it.retries, it.qs.cursorRetries, err)
+	it.iter.Close()
+	it.setCursor(reissue(it))
+	it.opened = now()
+	return true
+}
+
+// resumeQuery returns the query for the documents the iterator has yet to
+// read. Refreshed queries are sorted on _id, descending for descending
+// iterators, so these are the documents after the last one read, less any
+// already counted against the limit.
+func (it *Iterator) resumeQuery() *mgo.Query {
+	sort := it.sort
+	if sort == nil {
+		sort = []string{"_id"}
+	}
+	q := it.qs.find(it.collection, it.dir, it.resumeConstraint()).Sort(sort...)
+	if limit := it.resumeLimit(); limit > 0 {
+		q = q.Limit(int(limit))
+	}
+	return q
+}
+
+// resumeConstraint returns the constraint of the iterator narrowed to the
+// documents after the last one read, in the order of its _ids.
+func (it *Iterator) resumeConstraint() bson.M {
+	after := "$gt"
+	if it.sort != nil {
+		after = "$lt"
+	}
+	constraint := bson.M{"_id": bson.M{after: it.lastID}}
+	for k, v := range it.constraint {
+		constraint[k] = v
+	}
+	return constraint
+}
+
+// resumeLimit returns the limit on the documents left to read, or a
+// negative number if there is none.
+func (it *Iterator) resumeLimit() int64 {
+	if it.limit < 0 {
+		return -1
+	}
+	return it.limit - it.read
+}
+
+// refresh replaces the iterator's cursor with one that carries on from the
+// last document read.
+func (it *Iterator) refresh() {
+	it.iter.Close()
+	it.qs.roundTrip()
+	it.setCursor(it.resumeQuery().Iter())
+	it.opened = now()
+}
@@ -0,0 +1,251 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestCursorOptions(t *testing.T) {
+	noTimeout, refresh := cursorOptionsFrom(graph.Options{})
+	if noTimeout || refresh != 0 {
+		t.Errorf("Unexpected default cursor options, got:%t %v", noTimeout, refresh)
+	}
+	noTimeout, refresh = cursorOptionsFrom(graph.Options{
+		"cursor_no_timeout":   true,
+		"cursor_refresh_secs": 300.0,
+	})
+	if !noTimeout || refresh != 5*time.Minute {
+		t.Errorf("Unexpected cursor options, got:%t %v", noTimeout, refresh)
+	}
+	if got := cursorRetriesFrom(graph.Options{"cursor_retries": 3.0}); got != 3 {
+		t.Errorf("Unexpected cursor retries, got:%d expect:3", got)
+	}
+}
+
+// TestCursorRefresh simulates a scan that runs for longer than the server's
+// ten minute cursor timeout.
+func TestCursorRefresh(t *testing.T) {
+	defer func() { now = time.Now }()
+	start := time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC)
+	clock := start
+	now = func() time.Time { return clock }
+
+	qs := &TripleStore{cursorRefresh: 5 * time.Minute}
+	it := &Iterator{qs: qs, collection: "triples", limit: 10, opened: now()}
+	if it.needsRefresh() {
+		t.Error("Unexpected refresh before any document is read")
+	}
+
+	// Read a document every minute, for longer than the cursor timeout.
+	var refreshes int
+	for i := 0; i < 12; i++ {
+		clock = clock.Add(time.Minute)
+		if it.needsRefresh() {
+			refreshes++
+			if got := it.resumeLimit(); got != 10-it.read {
+				t.Errorf("Unexpected limit of resumed cursor, got:%d expect:%d", got, 10-it.read)
+			}
+			it.opened = now()
+		}
+		if idle := now().Sub(it.opened); idle >= 10*time.Minute {
+			t.Fatalf("Cursor left open for %v after %v", idle, now().Sub(start))
+		}
+		it.lastID = string(rune('a' + i))
+		it.read++
+	}
+	if refreshes != 2 {
+		t.Errorf("Unexpected number of refreshes, got:%d expect:2", refreshes)
+	}
+
+	it.limit = -1
+	if got := it.resumeLimit(); got >= 0 {
+		t.Errorf("Unexpected limit of resumed unlimited cursor, got:%d", got)
+	}
+	qs.cursorRefresh = 0
+	clock = clock.Add(time.Hour)
+	if it.needsRefresh() {
+		t.Error("Unexpected refresh without cursor_refresh_secs")
+	}
+}
+
+// slowCursor yields documents with the given _ids, taking delay over each,
+// as a slow server would.
+type slowCursor struct {
+	ids   []string
+	delay time.Duration
+}
+
+func (c *slowCursor) Next(result interface{}) bool {
+	time.Sleep(c.delay)
+	if len(c.ids) == 0 {
+		return false
+	}
+	result.(*tripleDoc).Id, c.ids = c.ids[0], c.ids[1:]
+	return true
+}
+
+func (c *slowCursor) Err() error   { return nil }
+func (c *slowCursor) Close() error { return nil }
+
+func TestNextTimeout(t *testing.T) {
+	if got := nextTimeoutFrom(graph.Options{"next_timeout_secs": 30.0}); got != 30*time.Second {
+		t.Errorf("Unexpected next timeout, got:%v expect:%v", got, 30*time.Second)
+	}
+
+	qs := &TripleStore{nextTimeout: 50 * time.Millisecond}
+	it := &Iterator{qs: qs, collection: "nodes", limit: -1, iter: &slowCursor{ids: []string{"a", "b"}, delay: time.Millisecond}}
+	if !it.Next() || it.Result() != "a" {
+		t.Fatalf("Unexpected first result from a prompt cursor, got:%v", it.Result())
+	}
+
+	// The server stops replying.
+	it.iter.(*slowCursor).delay = time.Hour
+	start := time.Now()
+	if it.Next() {
+		t.Error("Unexpected result from a hung cursor")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Next waited too long on a hung cursor: %v", d)
+	}
+	if err := it.Err(); err != ErrNextTimeout {
+		t.Errorf("Unexpected error, got:%v expect:%v", err, ErrNextTimeout)
+	}
+	if it.Next() {
+		t.Error("Unexpected result after a timeout")
+	}
+}
+
+// failingCursor yields documents with the given _ids, failing with err
+// once it has yielded n of them, as a cursor on a primary that steps down
+// would.
+type failingCursor struct {
+	ids []string
+	n   int
+	err error
+}
+
+func (c *failingCursor) Next(result interface{}) bool {
+	if c.n == 0 && c.err != nil || len(c.ids) == 0 {
+		return false
+	}
+	c.n--
+	result.(*tripleDoc).Id, c.ids = c.ids[0], c.ids[1:]
+	return true
+}
+
+func (c *failingCursor) Err() error {
+	if c.n == 0 {
+		return c.err
+	}
+	return nil
+}
+
+func (c *failingCursor) Close() error { return nil }
+
+func TestCursorRetry(t *testing.T) {
+	defer func(r func(*Iterator) cursor) { reissue = r }(reissue)
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	notMaster := &mgo.QueryError{Code: 10107, Message: "not master"}
+
+	for _, test := range []struct {
+		message string
+		retries int
+		errs    []error
+		expect  []string
+		err     error
+	}{
+		{
+			message: "failover mid-scan",
+			retries: 3,
+			errs:    []error{notMaster, io.EOF, nil},
+			expect:  ids,
+		},
+		{
+			message: "failover after the budget",
+			retries: 1,
+			errs:    []error{notMaster, io.EOF, nil},
+			expect:  ids[:6],
+			err:     io.EOF,
+		},
+		{
+			message: "fatal error",
+			retries: 3,
+			errs:    []error{&mgo.QueryError{Code: 2, Message: "bad value"}, nil},
+			expect:  ids[:3],
+			err:     &mgo.QueryError{Code: 2, Message: "bad value"},
+		},
+		{
+			message: "failover without retries",
+			errs:    []error{notMaster, nil},
+			expect:  ids[:3],
+			err:     notMaster,
+		},
+	} {
+		// Each cursor fails after three documents, with the next error.
+		errs := test.errs
+		open := func(after string) cursor {
+			var rest []string
+			for _, id := range ids {
+				if id > after {
+					rest = append(rest, id)
+				}
+			}
+			c := &failingCursor{ids: rest, n: 3, err: errs[0]}
+			errs = errs[1:]
+			return c
+		}
+		reissue = func(it *Iterator) cursor { return open(it.lastID) }
+
+		qs := &TripleStore{cursorRetries: test.retries}
+		it := &Iterator{qs: qs, collection: "nodes", limit: -1, iter: open("")}
+		var got []string
+		for it.Next() {
+			got = append(got, it.Result().(string))
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected results after %s, got:%v expect:%v", test.message, got, test.expect)
+		}
+		if err := it.Err(); !reflect.DeepEqual(err, test.err) {
+			t.Errorf("Unexpected error after %s, got:%v expect:%v", test.message, err, test.err)
+		}
+	}
+}
+
+func TestTransient(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		expect bool
+	}{
+		{err: nil},
+		{err: io.EOF, expect: true},
+		{err: mgo.ErrCursor, expect: true},
+		{err: &mgo.QueryError{Code: 13435, Message: "not master and slaveOk=false"}, expect: true},
+		{err: &mgo.QueryError{Message: "node is recovering"}, expect: true},
+		{err: &mgo.QueryError{Code: 2, Message: "bad value"}},
+		{err: ErrNextTimeout},
+	} {
+		if got := transient(test.err); got != test.expect {
+			t.Errorf("Unexpected classification of %v, got:%t expect:%t", test.err, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// deletePipeline returns the aggregation counting the triples each node is
+// in, among those matching constraint. Each triple is unwound into its
+// nodes, leaving out the empty label of triples without one.
+func deletePipeline(constraint bson.M) []bson.M {
+	pipeline := []bson.M{
+		{"$project": bson.M{"node": []string{"$Subject", "$Predicate", "$Object", "$Label"}}},
+		{"$unwind": "$node"},
+		{"$match": bson.M{"node": bson.M{"$ne": ""}}},
+		{"$group": bson.M{"_id": "$node", "count": bson.M{"$sum": 1}}},
+	}
+	if constraint != nil {
+		pipeline = append([]bson.M{{"$match": constraint}}, pipeline...)
+	}
+	return pipeline
+}
+
+// DeleteBy removes the live triples with the node name in direction d, or
+// all of them if d is quad.Any, with a single delete on the server. The
+// nodes of the triples are counted by an aggregation over them first, so
+// that each node's size is lowered by the number of its triples removed.
+func (qs *TripleStore) DeleteBy(d quad.Direction, name string, all bool) (int64, error) {
+	var constraint bson.M
+	if d != quad.Any {
+		constraint = qs.constraintFor(d, name, qs.ConvertStringToByteHash(name))
+	}
+	constraint = qs.live(constraint)
+	qs.roundTrip()
+	n, err := qs.db.C("triples").Find(constraint).Count()
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if !all && int64(n) == qs.Size() {
+		return 0, graph.ErrDeleteAll
+	}
+
+	qs.roundTrip()
+	it := qs.db.C("triples").Pipe(deletePipeline(constraint)).AllowDiskUse().Iter()
+	counts := make(map[string]int)
+	var group struct {
+		Name  string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	for it.Next(&group) {
+		counts[group.Name] = group.Count
+	}
+	if err := it.Close(); err != nil {
+		return 0, err
+	}
+
+	// Triples matching the constraint that are written between the count
+	// and the delete are removed without their nodes being counted down.
+	var removed int
+	if qs.softDelete {
+		set := bson.M{deletedField: true}
+		if qs.timestamps {
+			set[deletedAtField] = now()
+		}
+		info, err := qs.db.C("triples").UpdateAll(constraint, bson.M{"$set": set})
+		if err != nil {
+			return 0, err
+		}
+		removed = info.Updated
+	} else {
+		info, err := qs.db.C("triples").RemoveAll(constraint)
+		if err != nil {
+			return 0, err
+		}
+		removed = info.Removed
+	}
+	qs.writes.wrote()
+	for stored, count := range counts {
+		qs.updateNodeBy(qs.resolveName(stored), -count)
+	}
+	return int64(removed), nil
+}
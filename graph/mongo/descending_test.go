@@ -0,0 +1,141 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestDescendingSort(t *testing.T) {
+	for _, test := range []struct {
+		collection string
+		timestamps bool
+		expect     []string
+	}{
+		{collection: "triples", timestamps: true, expect: []string{"-CreatedAt", "-_id"}},
+		{collection: "triples", expect: []string{"-_id"}},
+		{collection: "nodes", timestamps: true, expect: []string{"-_id"}},
+	} {
+		qs := &TripleStore{timestamps: test.timestamps}
+		if got := descendingSort(qs, test.collection); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected sort of %s with timestamps %t, got:%v expect:%v", test.collection, test.timestamps, got, test.expect)
+		}
+	}
+}
+
+// byKeys sorts docs on keys as the server would, missing fields sorting
+// before any time or string.
+type byKeys struct {
+	docs []bson.M
+	keys []string
+}
+
+func (s byKeys) Len() int      { return len(s.docs) }
+func (s byKeys) Swap(i, j int) { s.docs[i], s.docs[j] = s.docs[j], s.docs[i] }
+
+func (s byKeys) Less(i, j int) bool {
+	for _, key := range s.keys {
+		field := strings.TrimPrefix(key, "-")
+		a, b := s.docs[i][field], s.docs[j][field]
+		if key != field {
+			a, b = b, a
+		}
+		if before(a, b) {
+			return true
+		}
+		if before(b, a) {
+			return false
+		}
+	}
+	return false
+}
+
+func before(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil:
+		return b != nil
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.Before(b)
+	case string:
+		b, ok := b.(string)
+		return ok && a < b
+	case int64:
+		b, ok := b.(int64)
+		return ok && a < b
+	}
+	return false
+}
+
+// TestDescendingOrder checks that the sort and window a descending scan
+// gives its query select the newest triples, newest first.
+func TestDescendingOrder(t *testing.T) {
+	start := time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC)
+	var docs []bson.M
+	// Triples written before timestamps were kept, then one a minute.
+	for _, id := range []string{"m", "z"} {
+		docs = append(docs, bson.M{"_id": id})
+	}
+	for i, id := range []string{"q", "c", "x", "a", "k"} {
+		docs = append(docs, bson.M{"_id": id, createdField: start.Add(time.Duration(i) * time.Minute)})
+	}
+	// Two written in the same instant, ordered on their _ids.
+	docs = append(docs, bson.M{"_id": "b", createdField: start.Add(4 * time.Minute)})
+
+	qs := &TripleStore{timestamps: true}
+	it := &Iterator{qs: qs, collection: "triples", isAll: true, limit: -1, sort: descendingSort(qs, "triples")}
+	sort.Stable(byKeys{docs, it.sort})
+	var all []string
+	for _, doc := range docs {
+		all = append(all, doc["_id"].(string))
+	}
+	if expect := []string{"k", "b", "a", "x", "c", "q", "z", "m"}; !reflect.DeepEqual(all, expect) {
+		t.Errorf("Unexpected descending order, got:%v expect:%v", all, expect)
+	}
+
+	it.limitTo(3)
+	if got := all[:it.limit]; !reflect.DeepEqual(got, []string{"k", "b", "a"}) {
+		t.Errorf("Unexpected latest triples, got:%v expect:%v", got, []string{"k", "b", "a"})
+	}
+}
+
+func TestDescendingRefresh(t *testing.T) {
+	defer func() { now = time.Now }()
+	clock := time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	qs := &TripleStore{cursorRefresh: 5 * time.Minute}
+	it := &Iterator{qs: qs, collection: "nodes", isAll: true, limit: -1, sort: descendingSort(qs, "nodes"), opened: now(), lastID: "m"}
+	clock = clock.Add(10 * time.Minute)
+	if !it.needsRefresh() {
+		t.Error("Expected refresh of a scan sorted on _id")
+	}
+	expect := bson.M{"_id": bson.M{"$lt": "m"}}
+	if got := it.resumeConstraint(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected resumed constraint, got:%v expect:%v", got, expect)
+	}
+
+	qs.timestamps = true
+	it.collection, it.sort = "triples", descendingSort(qs, "triples")
+	if it.needsRefresh() {
+		t.Error("Unexpected refresh of a scan sorted on time")
+	}
+}
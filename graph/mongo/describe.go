@@ -0,0 +1,59 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/quad"
+)
+
+// describeSelector selects the names of a triple document.
+var describeSelector = bson.M{"Subject": 1, "Predicate": 1, "Object": 1, "Label": 1}
+
+// DescribeTriples returns the triples with node as their subject, and, if
+// withObject is set, those with it as their object, found with a single
+// $or query. The names of their nodes are read from the documents, rather
+// than looked up.
+func (qs *TripleStore) DescribeTriples(node string, withObject bool) ([]quad.Quad, error) {
+	var triples []quad.Quad
+	qs.roundTrip()
+	it := qs.db.C("triples").Find(qs.live(qs.describeConstraint(node, withObject))).Select(describeSelector).Iter()
+	var doc struct {
+		Subject   string `bson:"Subject"`
+		Predicate string `bson:"Predicate"`
+		Object    string `bson:"Object"`
+		Label     string `bson:"Label"`
+	}
+	for it.Next(&doc) {
+		triples = append(triples, qs.quadOf(doc.Subject, doc.Predicate, doc.Object, doc.Label))
+	}
+	if err := it.Close(); err != nil {
+		return nil, err
+	}
+	return triples, nil
+}
+
+// describeConstraint returns the query constraint selecting the triples
+// with node as their subject, or, if withObject is set, as either their
+// subject or their object.
+func (qs *TripleStore) describeConstraint(node string, withObject bool) bson.M {
+	hash := qs.ConvertStringToByteHash(node)
+	c := qs.constraintFor(quad.Subject, node, hash)
+	if !withObject {
+		return c
+	}
+	return bson.M{"$or": []bson.M{c, qs.constraintFor(quad.Object, node, hash)}}
+}
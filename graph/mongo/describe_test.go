@@ -0,0 +1,44 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/quad"
+)
+
+func TestDescribeConstraint(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any}
+	if got, expect := qs.describeConstraint("alice", false), (bson.M{"Subject": "alice"}); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected constraint of the triples of a subject, got:%v expect:%v", got, expect)
+	}
+	expect := bson.M{"$or": []bson.M{{"Subject": "alice"}, {"Object": "alice"}}}
+	if got := qs.describeConstraint("alice", true); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected constraint of the triples of a node, got:%v expect:%v", got, expect)
+	}
+
+	// The shard holding a subject's triples is named.
+	qs.shardKey = quad.Subject
+	hash := qs.ConvertStringToByteHash("alice")
+	expect = bson.M{"$or": []bson.M{{"Subject": "alice", shardKeyField: hash}, {"Object": "alice"}}}
+	if got := qs.describeConstraint("alice", true); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected constraint of the triples of a node on a sharded store, got:%v expect:%v", got, expect)
+	}
+}
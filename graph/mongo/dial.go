@@ -0,0 +1,293 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/google/cayley/graph"
+)
+
+// The defaults of mgo.Dial, which the store used before these could be set.
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultSocketTimeout  = time.Minute
+)
+
+// A connection is how to reach MongoDB, and how to use the session once it
+// is reached, as a connection URI and the store's options give them.
+type connection struct {
+	info          *mgo.DialInfo
+	socketTimeout time.Duration
+
+	// The read preference, if one is given.
+	mode    mgo.Mode
+	setMode bool
+
+	// The write concern of writers.
+	safe *mgo.Safe
+
+	// The TLS configuration, if connections are encrypted.
+	tls *tls.Config
+}
+
+// readPreferences are the modes of the readPreference option.
+var readPreferences = map[string]mgo.Mode{
+	"primary":            mgo.Primary,
+	"primarypreferred":   mgo.PrimaryPreferred,
+	"secondary":          mgo.Secondary,
+	"secondarypreferred": mgo.SecondaryPreferred,
+	"nearest":            mgo.Nearest,
+}
+
+// parseURI parses a MongoDB connection URI of the standard form
+//
+//	mongodb://[username:password@]host1[:port1][,host2[:port2],...][/[database][?options]]
+//
+// or a bare list of hosts. The database is the one authenticated against
+// unless authSource is given. Option names are not case sensitive, and
+// options that are not supported are an error rather than ignored.
+func parseURI(uri string) (*connection, error) {
+	c := &connection{info: &mgo.DialInfo{}, safe: &mgo.Safe{}}
+	s := strings.TrimPrefix(uri, "mongodb://")
+	var query string
+	if i := strings.Index(s, "?"); i >= 0 {
+		s, query = s[:i], s[i+1:]
+	}
+	if i := strings.Index(s, "/"); i >= 0 {
+		s, c.info.Database = s[:i], s[i+1:]
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		var user string
+		user, s = s[:i], s[i+1:]
+		var password string
+		if j := strings.Index(user, ":"); j >= 0 {
+			user, password = user[:j], user[j+1:]
+		}
+		var err error
+		if c.info.Username, err = url.QueryUnescape(user); err != nil {
+			return nil, fmt.Errorf("mongo: bad username in connection URI: %v", err)
+		}
+		if c.info.Password, err = url.QueryUnescape(password); err != nil {
+			return nil, fmt.Errorf("mongo: bad password in connection URI: %v", err)
+		}
+	}
+	if s == "" {
+		return nil, errors.New("mongo: no host in connection URI")
+	}
+	c.info.Addrs = strings.Split(s, ",")
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("mongo: bad options in connection URI: %v", err)
+	}
+	for key, vals := range values {
+		if err := c.set(strings.ToLower(key), vals[len(vals)-1]); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// set applies the connection URI option key, in lower case, with value v.
+func (c *connection) set(key, v string) error {
+	switch key {
+	case "authsource":
+		c.info.Source = v
+	case "authmechanism":
+		c.info.Mechanism = v
+	case "gssapiservicename":
+		c.info.Service = v
+	case "authmechanismproperties":
+		for _, prop := range strings.Split(v, ",") {
+			kv := strings.SplitN(prop, ":", 2)
+			if len(kv) != 2 || kv[0] != "SERVICE_NAME" {
+				return fmt.Errorf("mongo: unsupported authMechanismProperties %q", prop)
+			}
+			c.info.Service = kv[1]
+		}
+	case "replicaset":
+		c.info.ReplicaSetName = v
+	case "connect":
+		switch v {
+		case "direct":
+			c.info.Direct = true
+		case "replicaSet":
+			c.info.Direct = false
+		default:
+			return fmt.Errorf("mongo: unknown connect option %q", v)
+		}
+	case "connecttimeoutms":
+		d, err := millis(key, v)
+		if err != nil {
+			return err
+		}
+		c.info.Timeout = d
+	case "sockettimeoutms":
+		d, err := millis(key, v)
+		if err != nil {
+			return err
+		}
+		c.socketTimeout = d
+	case "maxpoolsize":
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("mongo: maxPoolSize must be a positive number, not %q", v)
+		}
+		c.info.PoolLimit = n
+	case "readpreference":
+		mode, ok := readPreferences[strings.ToLower(v)]
+		if !ok {
+			return fmt.Errorf("mongo: unknown readPreference %q", v)
+		}
+		c.mode, c.setMode = mode, true
+	case "w":
+		if n, err := strconv.Atoi(v); err == nil {
+			c.safe.W = n
+		} else {
+			c.safe.WMode = v
+		}
+	case "wtimeoutms":
+		d, err := millis(key, v)
+		if err != nil {
+			return err
+		}
+		c.safe.WTimeout = int(d / time.Millisecond)
+	case "journal":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("mongo: journal must be true or false, not %q", v)
+		}
+		c.safe.J = b
+	case "ssl", "tls":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("mongo: %s must be true or false, not %q", key, v)
+		}
+		if b {
+			c.tlsConfig()
+		}
+	case "tlsinsecure", "tlsallowinvalidcertificates":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("mongo: %s must be true or false, not %q", key, v)
+		}
+		c.tlsConfig().InsecureSkipVerify = b
+	case "tlscafile":
+		pem, err := ioutil.ReadFile(v)
+		if err != nil {
+			return fmt.Errorf("mongo: could not read tlsCAFile: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("mongo: no certificates in tlsCAFile %s", v)
+		}
+		c.tlsConfig().RootCAs = pool
+	case "tlscertificatekeyfile":
+		cert, err := tls.LoadX509KeyPair(v, v)
+		if err != nil {
+			return fmt.Errorf("mongo: could not read tlsCertificateKeyFile: %v", err)
+		}
+		c.tlsConfig().Certificates = []tls.Certificate{cert}
+	default:
+		return fmt.Errorf("mongo: unsupported connection URI option %q", key)
+	}
+	return nil
+}
+
+// millis returns the duration of the option key given in milliseconds.
+func millis(key, v string) (time.Duration, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("mongo: %s must be a number of milliseconds, not %q", key, v)
+	}
+	return time.Duration(n) * time.Millisecond, nil
+}
+
+// tlsConfig returns the TLS configuration of the connection, encrypting it
+// if it was not already.
+func (c *connection) tlsConfig() *tls.Config {
+	if c.tls == nil {
+		c.tls = &tls.Config{}
+	}
+	return c.tls
+}
+
+// dial connects to the server at addr, a connection URI, with the
+// pool_limit, connect_timeout_secs and socket_timeout_secs options applied
+// over those of the URI. The session has the read preference and write
+// concern the URI gives.
+func dial(addr string, options graph.Options) (*mgo.Session, error) {
+	c, err := parseURI(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyDialOptions(c, options); err != nil {
+		return nil, err
+	}
+	if c.tls != nil {
+		timeout := c.info.Timeout
+		config := c.tls
+		c.info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr.String(), config)
+		}
+	}
+	conn, err := mgo.DialWithInfo(c.info)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetSocketTimeout(c.socketTimeout)
+	if c.setMode {
+		conn.SetMode(c.mode, true)
+	}
+	conn.SetSafe(c.safe)
+	return conn, nil
+}
+
+// applyDialOptions sets the pool limit and timeouts of c from options,
+// where they are given, and to the defaults of mgo.Dial where neither the
+// options nor the connection URI give them.
+func applyDialOptions(c *connection, options graph.Options) error {
+	if n, ok := options.IntKey("pool_limit"); ok {
+		if n <= 0 {
+			return errors.New("mongo: pool_limit must be positive")
+		}
+		// Operations that find the pool full wait for a connection to
+		// be freed, rather than failing.
+		c.info.PoolLimit = n
+	}
+	if secs, ok := options.IntKey("connect_timeout_secs"); ok && secs > 0 {
+		c.info.Timeout = time.Duration(secs) * time.Second
+	} else if c.info.Timeout == 0 {
+		c.info.Timeout = defaultConnectTimeout
+	}
+	if secs, ok := options.IntKey("socket_timeout_secs"); ok && secs > 0 {
+		c.socketTimeout = time.Duration(secs) * time.Second
+	} else if c.socketTimeout == 0 {
+		c.socketTimeout = defaultSocketTimeout
+	}
+	return nil
+}
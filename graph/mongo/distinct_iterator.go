@@ -0,0 +1,286 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// DistinctIterator yields each node found in one direction of the triples
+// collection once, by grouping the triples on that direction's field. A
+// ranged iterator yields only the nodes whose names fall in its range, in
+// order of name.
+type DistinctIterator struct {
+	uid    uint64
+	tags   graph.Tagger
+	qs     *TripleStore
+	dir    quad.Direction
+	field  string
+	iter   *mgo.Iter
+	size   int64
+	result graph.Value
+
+	// The range of names of a ranged iterator, from lo up to but not
+	// including hi, or without end if hi is empty.
+	ranged bool
+	lo, hi string
+
+	// The number of misses checked again on the primary.
+	rechecks int
+}
+
+// NewDistinctIterator returns an iterator over each node in direction d of
+// the triples, or the error met sizing it.
+func NewDistinctIterator(qs *TripleStore, d quad.Direction) (*DistinctIterator, error) {
+	// The nodes collection holds every node in any direction, so its size
+	// is an upper bound.
+	size, err := countQuery(qs, "nodes", nil)
+	if err != nil {
+		return nil, err
+	}
+	it := &DistinctIterator{
+		uid:   iterator.NextUID(),
+		qs:    qs,
+		dir:   d,
+		field: strings.Title(d.String()),
+		size:  int64(size),
+	}
+	it.iter = it.pipe().Iter()
+	return it, nil
+}
+
+// NewRangeIterator returns an iterator over each node in direction d of the
+// triples whose name is at least lo and, unless hi is empty, less than hi,
+// in order of name, such as a page of nodes for browsing them
+// alphabetically. Names are compared by their bytes, as the server
+// compares strings. It returns the error met sizing the iterator, if any.
+func NewRangeIterator(qs *TripleStore, d quad.Direction, lo, hi string) (*DistinctIterator, error) {
+	it := &DistinctIterator{
+		uid:    iterator.NextUID(),
+		qs:     qs,
+		dir:    d,
+		field:  strings.Title(d.String()),
+		ranged: true,
+		lo:     lo,
+		hi:     hi,
+	}
+	// The nodes with names in the range bound those of its direction.
+	size, err := countQuery(qs, "nodes", bson.M{"Name": it.nameRange()})
+	if err != nil {
+		return nil, err
+	}
+	it.size = int64(size)
+	it.iter = it.pipe().Iter()
+	return it, nil
+}
+
+// nameRange returns the operators matching the names in the range of a
+// ranged iterator.
+func (it *DistinctIterator) nameRange() bson.M {
+	r := bson.M{"$gte": it.lo}
+	if it.hi != "" {
+		r["$lt"] = it.hi
+	}
+	return r
+}
+
+// inRange returns whether name is in the range of the iterator.
+func (it *DistinctIterator) inRange(name string) bool {
+	return !it.ranged || name >= it.lo && (it.hi == "" || name < it.hi)
+}
+
+func (it *DistinctIterator) pipeline() []bson.M {
+	pipeline := []bson.M{
+		{"$group": bson.M{"_id": "$" + it.field}},
+	}
+	var m bson.M
+	ops := bson.M{}
+	if it.ranged {
+		ops = it.nameRange()
+	}
+	if it.dir == quad.Label {
+		// Unlabeled triples have an empty label, which is not a node.
+		ops["$ne"] = ""
+	}
+	if len(ops) != 0 {
+		m = newConstraint().ops(it.field, ops).M()
+	}
+	if m = it.qs.live(m); m != nil {
+		pipeline = append([]bson.M{{"$match": m}}, pipeline...)
+	}
+	if it.ranged {
+		pipeline = append(pipeline, bson.M{"$sort": bson.M{"_id": 1}})
+	}
+	return pipeline
+}
+
+func (it *DistinctIterator) pipe() *mgo.Pipe {
+	it.qs.roundTrip()
+	return it.qs.db.C("triples").Pipe(it.pipeline()).AllowDiskUse()
+}
+
+func (it *DistinctIterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *DistinctIterator) Reset() {
+	it.iter.Close()
+	it.iter = it.pipe().Iter()
+}
+
+// Rewind does nothing, as Contains makes a query of its own.
+func (it *DistinctIterator) Rewind() {}
+
+func (it *DistinctIterator) Close() {
+	it.iter.Close()
+}
+
+func (it *DistinctIterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *DistinctIterator) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+}
+
+func (it *DistinctIterator) Clone() graph.Iterator {
+	var (
+		m   *DistinctIterator
+		err error
+	)
+	if it.ranged {
+		m, err = NewRangeIterator(it.qs, it.dir, it.lo, it.hi)
+	} else {
+		m, err = NewDistinctIterator(it.qs, it.dir)
+	}
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return iterator.NewNull()
+	}
+	m.tags.CopyFrom(it)
+	return m
+}
+
+func (it *DistinctIterator) Next() bool {
+	var result struct {
+		Name string `bson:"_id"`
+	}
+	if it.qs.cancelled() {
+		it.iter.Close()
+		return false
+	}
+	found := it.iter.Next(&result)
+	if !found {
+		err := it.iter.Err()
+		if err != nil {
+			glog.Errorln("Error Nexting Iterator: ", err)
+		}
+		return false
+	}
+	// We already know the name, so spare NameOf the lookup.
+	val := it.qs.hashOfStored(result.Name)
+	it.qs.idCache.Put(val, result.Name)
+	it.result = val
+	return true
+}
+
+func (it *DistinctIterator) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *DistinctIterator) Result() graph.Value {
+	return it.result
+}
+
+func (it *DistinctIterator) NextPath() bool {
+	return false
+}
+
+// No subiterators.
+func (it *DistinctIterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+func (it *DistinctIterator) Contains(v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	hash, err := literal(v)
+	if err != nil {
+		glog.Errorf("Error: %v for value %v", err, v)
+		return graph.ContainsLogOut(it, v, false)
+	}
+	name := it.qs.NameOf(hash)
+	if !it.inRange(name) {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	constraint := newConstraint().eq(it.field, name).M()
+	found, err := it.qs.exists(constraint, &it.rechecks)
+	if err != nil {
+		glog.Errorln("Error checking iterator: ", err)
+		return graph.ContainsLogOut(it, v, false)
+	}
+	if !found {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	it.result = v
+	return graph.ContainsLogOut(it, v, true)
+}
+
+// Size returns the number of nodes in the store, or of those in the range
+// of a ranged iterator, which is an upper bound.
+func (it *DistinctIterator) Size() (int64, bool) {
+	return it.size, false
+}
+
+var mongoDistinctType graph.Type
+
+func init() {
+	mongoDistinctType = graph.RegisterIterator("mongo_distinct")
+}
+
+func (it *DistinctIterator) Type() graph.Type { return mongoDistinctType }
+
+func (it *DistinctIterator) Optimize() (graph.Iterator, bool) { return it, false }
+
+func (it *DistinctIterator) DebugString(indent int) string {
+	size, _ := it.Size()
+	if it.ranged {
+		return fmt.Sprintf("%s(%s size:%d %s range:[%q,%q))", strings.Repeat(" ", indent), it.Type(), size, it.dir, it.lo, it.hi)
+	}
+	return fmt.Sprintf("%s(%s size:%d %s)", strings.Repeat(" ", indent), it.Type(), size, it.dir)
+}
+
+func (it *DistinctIterator) Stats() graph.IteratorStats {
+	size, _ := it.Size()
+	return graph.IteratorStats{
+		ContainsCost: 5,
+		NextCost:     5,
+		Size:         size,
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// runPipeline runs the $match, $group and $sort stages of a distinct
+// iterator's pipeline over docs, as the server would.
+func runPipeline(docs []bson.M, pipeline []bson.M) []string {
+	var (
+		names   []string
+		grouped bool
+	)
+	for _, stage := range pipeline {
+		switch {
+		case stage["$match"] != nil:
+			var kept []bson.M
+			for _, doc := range docs {
+				if matches(doc, stage["$match"].(bson.M)) {
+					kept = append(kept, doc)
+				}
+			}
+			docs = kept
+			if grouped {
+				names = nil
+				for _, doc := range docs {
+					names = append(names, doc["_id"].(string))
+				}
+			}
+		case stage["$group"] != nil:
+			field := stage["$group"].(bson.M)["_id"].(string)[1:]
+			counts := make(map[string]int64)
+			for _, doc := range docs {
+				name := doc[field].(string)
+				if counts[name] == 0 {
+					names = append(names, name)
+				}
+				counts[name]++
+			}
+			// Each group becomes a document of its name and count.
+			docs = nil
+			for _, name := range names {
+				docs = append(docs, bson.M{"_id": name, "count": counts[name]})
+			}
+			grouped = true
+		case stage["$sort"] != nil:
+			sort.Strings(names)
+		}
+	}
+	return names
+}
+
+func TestRangeIterator(t *testing.T) {
+	qs := &TripleStore{hasher: hasherFor("sha1", ""), shardKey: quad.Any}
+	var docs []bson.M
+	for _, q := range []quad.Quad{
+		{"zoe", "follows", "bob", ""},
+		{"alice", "follows", "carol", "2014"},
+		{"bob", "follows", "alice", ""},
+		{"carol", "follows", "bob", "2013"},
+		{"dave", "follows", "carol", ""},
+		{"bob", "likes", "dave", ""},
+	} {
+		docs = append(docs, qs.docFor(q))
+	}
+	for _, test := range []struct {
+		dir    quad.Direction
+		lo, hi string
+		expect []string
+	}{
+		{dir: quad.Subject, lo: "b", hi: "d", expect: []string{"bob", "carol"}},
+		{dir: quad.Subject, lo: "bob", hi: "dave", expect: []string{"bob", "carol"}},
+		{dir: quad.Subject, lo: "c", expect: []string{"carol", "dave", "zoe"}},
+		{dir: quad.Object, lo: "", hi: "c", expect: []string{"alice", "bob"}},
+		{dir: quad.Object, lo: "e", hi: "z"},
+		// The empty label of unlabeled triples is not a node.
+		{dir: quad.Label, lo: "", expect: []string{"2013", "2014"}},
+	} {
+		it := &DistinctIterator{qs: qs, dir: test.dir, field: strings.Title(test.dir.String()), ranged: true, lo: test.lo, hi: test.hi}
+		got := runPipeline(docs, it.pipeline())
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected %s nodes in [%q, %q), got:%v expect:%v", test.dir, test.lo, test.hi, got, test.expect)
+		}
+		for _, doc := range docs {
+			name := doc[it.field].(string)
+			in := name >= test.lo && (test.hi == "" || name < test.hi)
+			if got := it.inRange(name); got != in {
+				t.Errorf("Unexpected range check of %q in [%q, %q), got:%t", name, test.lo, test.hi, got)
+			}
+		}
+	}
+}
+
+func TestDistinctIteratorError(t *testing.T) {
+	defer func(c func(*TripleStore, string, bson.M) (int, error)) { countQuery = c }(countQuery)
+	failed := errors.New("no server")
+	countQuery = func(*TripleStore, string, bson.M) (int, error) { return 0, failed }
+
+	qs := &TripleStore{hasher: hasherFor("sha1", ""), shardKey: quad.Any}
+	if it, err := NewDistinctIterator(qs, quad.Subject); it != nil || err != failed {
+		t.Errorf("Unexpected distinct iterator without a count, got:%v %v expect:nil %v", it, err, failed)
+	}
+	if it := qs.DistinctIterator(quad.Subject); it.Type() != graph.Null {
+		t.Errorf("Unexpected distinct iterator of the store without a count, got:%s", it.DebugString(0))
+	}
+	if it, err := NewRangeIterator(qs, quad.Subject, "b", "d"); it != nil || err != failed {
+		t.Errorf("Unexpected range iterator without a count, got:%v %v expect:nil %v", it, err, failed)
+	}
+	if it := qs.RangeIterator(quad.Subject, "b", "d"); it.Type() != graph.Null {
+		t.Errorf("Unexpected range iterator of the store without a count, got:%s", it.DebugString(0))
+	}
+}
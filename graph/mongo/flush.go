@@ -0,0 +1,51 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+// flushJournalFrom returns whether the flush_journal option asks for
+// flushes to commit the journal rather than fsync the data files.
+func flushJournalFrom(options graph.Options) bool {
+	journal, _ := options.BoolKey("flush_journal")
+	return journal
+}
+
+// flushCommand returns the command that makes the writes so far durable:
+// an fsync of the data files, or, where snapshots take the journal with
+// the data files, a commit of the journal alone, which costs less.
+func (qs *TripleStore) flushCommand() bson.D {
+	if qs.flushJournal {
+		return bson.D{{"getLastError", 1}, {"j", true}}
+	}
+	return bson.D{{"fsync", 1}}
+}
+
+// runCommand runs cmd against the admin database.
+var runCommand = func(qs *TripleStore, cmd bson.D) error {
+	var result bson.M
+	return qs.session.Run(cmd, &result)
+}
+
+// Flush returns once the server has made the writes made before it
+// durable, as a consistent snapshot of its disks needs.
+func (qs *TripleStore) Flush() error {
+	qs.roundTrip()
+	return runCommand(qs, qs.flushCommand())
+}
@@ -0,0 +1,50 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestFlush(t *testing.T) {
+	defer func(r func(*TripleStore, bson.D) error) { runCommand = r }(runCommand)
+	var ran []bson.D
+	runCommand = func(_ *TripleStore, cmd bson.D) error {
+		ran = append(ran, cmd)
+		return nil
+	}
+
+	for _, test := range []struct {
+		options graph.Options
+		expect  bson.D
+	}{
+		{expect: bson.D{{"fsync", 1}}},
+		{options: graph.Options{"flush_journal": true}, expect: bson.D{{"getLastError", 1}, {"j", true}}},
+	} {
+		ran = nil
+		qs := &TripleStore{flushJournal: flushJournalFrom(test.options)}
+		if err := graph.Flush(graph.ReadOnly(qs)); err != nil {
+			t.Errorf("Unexpected error flushing with %v: %v", test.options, err)
+		}
+		if !reflect.DeepEqual(ran, []bson.D{test.expect}) {
+			t.Errorf("Unexpected commands flushing with %v, got:%v expect:%v", test.options, ran, []bson.D{test.expect})
+		}
+	}
+}
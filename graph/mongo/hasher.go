@@ -0,0 +1,138 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/barakmich/glog"
+	"github.com/google/cayley/graph"
+)
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+func hashAlgorithmFrom(options graph.Options) (string, error) {
+	name, ok := options.StringKey("hash_algorithm")
+	if !ok {
+		return "sha1", nil
+	}
+	if _, ok := hashAlgorithms[name]; !ok {
+		return "", fmt.Errorf("mongo: unknown hash_algorithm %q", name)
+	}
+	return name, nil
+}
+
+// hasherFor returns the hash of node names for a store with the given
+// algorithm and salt. Salted stores key an HMAC with it, so that no two
+// salts give the same hashes however the salt and name run together;
+// unsalted SHA-1 stores keep the plain hashes of earlier versions.
+func hasherFor(algorithm, salt string) hash.Hash {
+	newHash := hashAlgorithms[algorithm]
+	if salt == "" {
+		return newHash()
+	}
+	return hmac.New(newHash, []byte(salt))
+}
+
+// hasherDoc is kept in the metadata collection to record the hasher the
+// node hashes of a store were made with. The salt itself is not kept, only
+// the hash of a fixed probe name, which differs for every salt.
+type hasherDoc struct {
+	Id        string `bson:"_id"`
+	Algorithm string `bson:"Algorithm"`
+	Salted    bool   `bson:"Salted"`
+	Probe     string `bson:"Probe"`
+}
+
+const (
+	hasherDocID = "hasher"
+	hashProbe   = "cayley"
+)
+
+func newHasherDoc(algorithm, salt string) hasherDoc {
+	qs := TripleStore{hasher: hasherFor(algorithm, salt)}
+	return hasherDoc{
+		Id:        hasherDocID,
+		Algorithm: algorithm,
+		Salted:    salt != "",
+		Probe:     qs.ConvertStringToByteHash(hashProbe),
+	}
+}
+
+// checkHasher returns an error saying how the hasher a store was written
+// with differs from the configured one, if it does. Every hash would be
+// looked up under the wrong _id, so no query would find anything.
+func checkHasher(written, configured hasherDoc) error {
+	switch {
+	case written.Algorithm != configured.Algorithm:
+		return fmt.Errorf("mongo: database was written with hash_algorithm %q, but %q is configured", written.Algorithm, configured.Algorithm)
+	case written.Salted && !configured.Salted:
+		return fmt.Errorf("mongo: database was written with a hash_salt, but none is configured")
+	case !written.Salted && configured.Salted:
+		return fmt.Errorf("mongo: database was written without a hash_salt, but one is configured")
+	case written.Probe != configured.Probe:
+		return fmt.Errorf("mongo: database was written with a different hash_salt than the one configured")
+	}
+	return nil
+}
+
+// checkNodeHash returns an error if the _id of a node written before the
+// hasher was recorded is not the hash of its name under the configured
+// hasher.
+func (qs *TripleStore) checkNodeHash(node MongoNode) error {
+	if qs.hashOfStored(node.Name) != node.Id {
+		return fmt.Errorf("mongo: node hashes in the database were not made with the configured hash_algorithm and hash_salt")
+	}
+	return nil
+}
+
+// verifyHasher checks the hasher of the store against the one recorded in
+// its metadata collection. Stores written before it was recorded are
+// checked against one of their nodes instead, and the hasher is recorded
+// for them unless ro is set.
+func (qs *TripleStore) verifyHasher(configured hasherDoc, ro bool) error {
+	var written hasherDoc
+	err := qs.db.C("metadata").FindId(hasherDocID).One(&written)
+	if err == nil {
+		return checkHasher(written, configured)
+	}
+	if err != mgo.ErrNotFound {
+		return err
+	}
+	var node MongoNode
+	err = qs.db.C("nodes").Find(nil).One(&node)
+	if err == nil {
+		if err := qs.checkNodeHash(node); err != nil {
+			return err
+		}
+	} else if err != mgo.ErrNotFound {
+		return err
+	}
+	if ro {
+		return nil
+	}
+	glog.Infof("Recording hash_algorithm %q in the metadata collection", configured.Algorithm)
+	_, err = qs.db.C("metadata").UpsertId(hasherDocID, configured)
+	return err
+}
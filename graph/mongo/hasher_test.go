@@ -0,0 +1,94 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestHashAlgorithm(t *testing.T) {
+	if got, err := hashAlgorithmFrom(graph.Options{}); got != "sha1" || err != nil {
+		t.Errorf("Unexpected default hash_algorithm, got:%q (%v) expect:sha1", got, err)
+	}
+	if _, err := hashAlgorithmFrom(graph.Options{"hash_algorithm": "md5"}); err == nil {
+		t.Error("Expected an error for an unknown hash_algorithm")
+	}
+
+	qs := &TripleStore{hasher: hasherFor("sha256", "")}
+	if n := len(qs.ValueOf("alice").(string)); n != 2*sha256.Size {
+		t.Errorf("Unexpected sha256 hash length, got:%d expect:%d", n, 2*sha256.Size)
+	}
+	// The width of composite _ids follows the hash.
+	q := quad.Quad{"alice", "follows", "bob", ""}
+	if h, ok := qs.splitID(qs.getIdForTriple(q)); !ok || h != qs.hashesFor(q) {
+		t.Errorf("Lossy sha256 _id, got:%v (ok %t) expect:%v", h, ok, qs.hashesFor(q))
+	}
+}
+
+func TestHasherMismatch(t *testing.T) {
+	written := newHasherDoc("sha1", "graph-a")
+	if err := checkHasher(written, newHasherDoc("sha1", "graph-a")); err != nil {
+		t.Errorf("Unexpected error opening with the same hasher: %v", err)
+	}
+	for _, test := range []struct {
+		message    string
+		configured hasherDoc
+		expect     string
+	}{
+		{
+			message:    "another algorithm",
+			configured: newHasherDoc("sha256", "graph-a"),
+			expect:     `written with hash_algorithm "sha1", but "sha256" is configured`,
+		},
+		{
+			message:    "no salt",
+			configured: newHasherDoc("sha1", ""),
+			expect:     "written with a hash_salt, but none is configured",
+		},
+		{
+			message:    "another salt",
+			configured: newHasherDoc("sha1", "graph-b"),
+			expect:     "written with a different hash_salt",
+		},
+	} {
+		err := checkHasher(written, test.configured)
+		if err == nil || !strings.Contains(err.Error(), test.expect) {
+			t.Errorf("Unexpected error opening with %s, got:%v expect:%q", test.message, err, test.expect)
+		}
+	}
+	if err := checkHasher(newHasherDoc("sha1", ""), written); err == nil || !strings.Contains(err.Error(), "without a hash_salt") {
+		t.Errorf("Unexpected error opening an unsalted store with a salt, got:%v", err)
+	}
+
+	// Stores written before the hasher was recorded are checked by a node.
+	old := &TripleStore{hasher: hasherFor("sha1", "")}
+	node := MongoNode{Id: old.ConvertStringToByteHash("alice"), Name: "alice"}
+	if err := old.checkNodeHash(node); err != nil {
+		t.Errorf("Unexpected error checking a node with its own hasher: %v", err)
+	}
+	for _, qs := range []*TripleStore{
+		{hasher: hasherFor("sha256", "")},
+		{hasher: hasherFor("sha1", "graph-a")},
+	} {
+		if err := qs.checkNodeHash(node); err == nil {
+			t.Error("Expected an error checking a node with another hasher")
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// hintsFrom returns the index keys to hint for queries constrained on
+// each direction, indexed by quad.Direction. With the index_hints option
+// set, each direction is hinted to use its own index. The index for a
+// direction may be chosen with an index_hint_<direction> option, such as
+// index_hint_subject, giving the index keys separated by commas.
+func hintsFrom(options graph.Options) [quad.Label + 1][]string {
+	var hints [quad.Label + 1][]string
+	on, _ := options.BoolKey("index_hints")
+	for d := quad.Subject; d <= quad.Label; d++ {
+		if key, ok := options.StringKey("index_hint_" + d.String()); ok {
+			if key != "" {
+				hints[d] = strings.Split(key, ",")
+			}
+			continue
+		}
+		if on {
+			hints[d] = []string{strings.Title(d.String())}
+		}
+	}
+	return hints
+}
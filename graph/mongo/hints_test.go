@@ -0,0 +1,73 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+var hintTests = []struct {
+	message string
+	options graph.Options
+	expect  [quad.Label + 1][]string
+}{
+	{
+		message: "not hint by default",
+		options: graph.Options{},
+	},
+	{
+		message: "hint each direction's index",
+		options: graph.Options{"index_hints": true},
+		expect: [quad.Label + 1][]string{
+			quad.Subject:   {"Subject"},
+			quad.Predicate: {"Predicate"},
+			quad.Object:    {"Object"},
+			quad.Label:     {"Label"},
+		},
+	},
+	{
+		message: "override and disable hints",
+		options: graph.Options{
+			"index_hints":          true,
+			"index_hint_subject":   "Subject,Predicate",
+			"index_hint_predicate": "",
+		},
+		expect: [quad.Label + 1][]string{
+			quad.Subject: {"Subject", "Predicate"},
+			quad.Object:  {"Object"},
+			quad.Label:   {"Label"},
+		},
+	},
+	{
+		message: "hint only an overridden direction",
+		options: graph.Options{"index_hint_object": "Object"},
+		expect: [quad.Label + 1][]string{
+			quad.Object: {"Object"},
+		},
+	},
+}
+
+func TestHints(t *testing.T) {
+	for _, test := range hintTests {
+		got := hintsFrom(test.options)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got:%q expect:%q", test.message, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// PredicateCounts returns the number of live triples with each predicate,
+// grouping them on the server. Triple documents hold the names of their
+// nodes, so the predicates need no lookup.
+func (qs *TripleStore) PredicateCounts() (map[string]int64, error) {
+	pipeline := []bson.M{
+		{"$group": bson.M{"_id": "$Predicate", "count": bson.M{"$sum": 1}}},
+	}
+	if match := qs.live(nil); match != nil {
+		pipeline = append([]bson.M{{"$match": match}}, pipeline...)
+	}
+	it := qs.db.C("triples").Pipe(pipeline).AllowDiskUse().Iter()
+	counts := make(map[string]int64)
+	var group struct {
+		Predicate string `bson:"_id"`
+		Count     int64  `bson:"count"`
+	}
+	for it.Next(&group) {
+		counts[group.Predicate] = group.Count
+	}
+	if err := it.Close(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// fanOutOps are the aggregation operators of the comparisons of a FanOut.
+var fanOutOps = map[string]string{
+	"<":  "$lt",
+	"<=": "$lte",
+	">":  "$gt",
+	">=": "$gte",
+	"=":  "$eq",
+}
+
+// fanOutPipeline returns the aggregation finding the nodes passing f: the
+// live triples with its predicate are grouped by the node in its direction,
+// and the groups matched on their counts.
+func (qs *TripleStore) fanOutPipeline(f graph.FanOut) []bson.M {
+	field := "$Subject"
+	if f.Direction == quad.Object {
+		field = "$Object"
+	}
+	return []bson.M{
+		{"$match": qs.live(qs.constraintFor(quad.Predicate, f.Predicate, qs.ConvertStringToByteHash(f.Predicate)))},
+		{"$group": bson.M{"_id": field, "count": bson.M{"$sum": 1}}},
+		{"$match": bson.M{"count": bson.M{fanOutOps[f.Op]: f.N}}},
+	}
+}
+
+// FanOutNodes returns the nodes passing f, grouping and counting their
+// triples on the server. Triple documents hold the names of their nodes,
+// so the nodes found are named without a lookup.
+func (qs *TripleStore) FanOutNodes(f graph.FanOut) ([]graph.Value, error) {
+	qs.roundTrip()
+	it := qs.db.C("triples").Pipe(qs.fanOutPipeline(f)).AllowDiskUse().Iter()
+	var (
+		nodes []graph.Value
+		group struct {
+			Name string `bson:"_id"`
+		}
+	)
+	for it.Next(&group) {
+		hash := qs.hashOfStored(group.Name)
+		qs.idCache.Put(hash, group.Name)
+		nodes = append(nodes, hash)
+	}
+	if err := it.Close(); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
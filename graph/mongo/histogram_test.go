@@ -0,0 +1,59 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestFanOutPipeline(t *testing.T) {
+	qs := &TripleStore{hasher: hasherFor("sha1", ""), shardKey: quad.Any}
+	var docs []bson.M
+	// alice follows three, bob two and carol one.
+	for _, q := range []quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"alice", "follows", "carol", ""},
+		{"alice", "follows", "dave", ""},
+		{"bob", "follows", "alice", ""},
+		{"bob", "follows", "carol", ""},
+		{"carol", "follows", "alice", ""},
+		{"carol", "likes", "bob", ""},
+		{"carol", "likes", "dave", ""},
+	} {
+		docs = append(docs, qs.docFor(q))
+	}
+	for _, test := range []struct {
+		fanOut graph.FanOut
+		expect []string
+	}{
+		{fanOut: graph.FanOut{Direction: quad.Subject, Predicate: "follows", Op: ">", N: 1}, expect: []string{"alice", "bob"}},
+		{fanOut: graph.FanOut{Direction: quad.Subject, Predicate: "follows", Op: ">=", N: 3}, expect: []string{"alice"}},
+		{fanOut: graph.FanOut{Direction: quad.Subject, Predicate: "follows", Op: "=", N: 1}, expect: []string{"carol"}},
+		{fanOut: graph.FanOut{Direction: quad.Subject, Predicate: "follows", Op: ">", N: 3}},
+		{fanOut: graph.FanOut{Direction: quad.Object, Predicate: "follows", Op: ">", N: 1}, expect: []string{"carol", "alice"}},
+		{fanOut: graph.FanOut{Direction: quad.Subject, Predicate: "likes", Op: "<", N: 3}, expect: []string{"carol"}},
+	} {
+		got := runPipeline(docs, qs.fanOutPipeline(test.fanOut))
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected nodes for %+v, got:%v expect:%v", test.fanOut, got, test.expect)
+		}
+	}
+}
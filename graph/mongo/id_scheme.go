@@ -0,0 +1,272 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// An idScheme determines how the _id of a triple document is formed.
+type idScheme int
+
+const (
+	// compositeIDs concatenates the node hashes of a triple to form its _id.
+	compositeIDs idScheme = iota
+
+	// hashedIDs hashes the node hashes of a triple to form its _id, and
+	// stores each node hash in its own field of the document.
+	hashedIDs
+)
+
+var idSchemes = map[string]idScheme{
+	"composite": compositeIDs,
+	"hashed":    hashedIDs,
+}
+
+func (s idScheme) String() string {
+	for name, scheme := range idSchemes {
+		if scheme == s {
+			return name
+		}
+	}
+	return fmt.Sprintf("idScheme(%d)", int(s))
+}
+
+func idSchemeFrom(options graph.Options) (idScheme, error) {
+	name, ok := options.StringKey("id_scheme")
+	if !ok {
+		return compositeIDs, nil
+	}
+	scheme, ok := idSchemes[name]
+	if !ok {
+		return 0, fmt.Errorf("mongo: unknown id_scheme %q", name)
+	}
+	return scheme, nil
+}
+
+// Field names of the node hashes held by a hashedIDs document, indexed by
+// quad.Direction.
+var hashFields = [...]string{
+	quad.Subject:   "SubjectHash",
+	quad.Predicate: "PredicateHash",
+	quad.Object:    "ObjectHash",
+	quad.Label:     "LabelHash",
+}
+
+// Field names of the node names held by a triple document, indexed by
+// quad.Direction.
+var nameFields = [...]string{
+	quad.Subject:   "Subject",
+	quad.Predicate: "Predicate",
+	quad.Object:    "Object",
+	quad.Label:     "Label",
+}
+
+// tripleValue is the graph.Value of a triple in the store.
+type tripleValue struct {
+	id string
+
+	// Node hashes of the triple, indexed by quad.Direction.
+	hashes [quad.Label + 1]string
+}
+
+// tripleDoc is the part of a triple document needed to make its
+// tripleValue, and the name of its predicate, so that tagging the predicate
+// crossed by a traversal needs no lookup of the name. The names of the
+// other nodes are only read for a pluck.
+type tripleDoc struct {
+	Id            string `bson:"_id"`
+	Subject       string `bson:"Subject"`
+	Predicate     string `bson:"Predicate"`
+	Object        string `bson:"Object"`
+	Label         string `bson:"Label"`
+	SubjectHash   string `bson:"SubjectHash"`
+	PredicateHash string `bson:"PredicateHash"`
+	ObjectHash    string `bson:"ObjectHash"`
+	LabelHash     string `bson:"LabelHash"`
+	Source        string `bson:"Source"`
+}
+
+// tripleSelector selects the fields of a tripleDoc.
+var tripleSelector = bson.M{
+	"_id":           1,
+	"Predicate":     1,
+	"SubjectHash":   1,
+	"PredicateHash": 1,
+	"ObjectHash":    1,
+	"LabelHash":     1,
+	"Source":        1,
+}
+
+func (qs *TripleStore) hashesFor(t quad.Quad) [quad.Label + 1]string {
+	var h [quad.Label + 1]string
+	for d := quad.Subject; d <= quad.Label; d++ {
+		h[d] = qs.ConvertStringToByteHash(t.Get(d))
+	}
+	return h
+}
+
+// idFor returns the _id of the triple with the node hashes h. A composite
+// _id needs no delimiter: every hash has the same width and only hex
+// digits, whatever the node names hold, so splitID recovers them exactly
+// and triples whose names run together alike still have distinct _ids.
+func (qs *TripleStore) idFor(h [quad.Label + 1]string) string {
+	id := h[quad.Subject] + h[quad.Predicate] + h[quad.Object] + h[quad.Label]
+	if qs.ids == hashedIDs {
+		id = qs.ConvertStringToByteHash(id)
+	}
+	return id
+}
+
+func (qs *TripleStore) valueFor(doc tripleDoc) tripleValue {
+	v := tripleValue{id: doc.Id}
+	switch qs.ids {
+	case compositeIDs:
+		h, ok := qs.splitID(doc.Id)
+		if !ok {
+			glog.Errorf("Error: malformed composite _id %q", doc.Id)
+		}
+		v.hashes = h
+	case hashedIDs:
+		v.hashes[quad.Subject] = doc.SubjectHash
+		v.hashes[quad.Predicate] = doc.PredicateHash
+		v.hashes[quad.Object] = doc.ObjectHash
+		v.hashes[quad.Label] = doc.LabelHash
+	}
+	if doc.Predicate != "" {
+		qs.idCache.Put(v.hashes[quad.Predicate], doc.Predicate)
+	}
+	return v
+}
+
+// splitID returns the node hashes that make up a composite _id, indexed by
+// quad.Direction, so that the nodes of a triple are known without reading
+// any more of its document. It returns false if id is not four hashes long.
+func (qs *TripleStore) splitID(id string) ([quad.Label + 1]string, bool) {
+	var h [quad.Label + 1]string
+	// Hashes are hex encoded.
+	n := 2 * qs.hasher.Size()
+	if len(id) != 4*n {
+		return h, false
+	}
+	for d := quad.Subject; d <= quad.Label; d++ {
+		off := int(d-quad.Subject) * n
+		h[d] = id[off : off+n]
+	}
+	return h, true
+}
+
+func (qs *TripleStore) docFor(t quad.Quad) bson.M {
+	h := qs.hashesFor(t)
+	doc := bson.M{
+		"_id":       qs.idFor(h),
+		"Subject":   qs.storedName(t.Subject),
+		"Predicate": qs.storedName(t.Predicate),
+		"Object":    qs.storedName(t.Object),
+		"Label":     qs.storedName(t.Label),
+	}
+	if qs.ids == hashedIDs {
+		for d := quad.Subject; d <= quad.Label; d++ {
+			doc[hashFields[d]] = h[d]
+		}
+	}
+	if qs.shardKey != quad.Any {
+		doc[shardKeyField] = h[qs.shardKey]
+	}
+	qs.docLang(doc, t)
+	return doc
+}
+
+// MigrateIDScheme rewrites every triple document in the store to use the
+// named _id scheme, either "composite" or "hashed", and the store's shard
+// key. Once it returns, the store must be opened with the id_scheme option
+// set to the new scheme.
+//
+// The documents are copied to a new collection which then replaces the
+// triples collection, so the store must not be written to during the
+// migration.
+func (qs *TripleStore) MigrateIDScheme(name string) error {
+	to, ok := idSchemes[name]
+	if !ok {
+		return fmt.Errorf("mongo: unknown id_scheme %q", name)
+	}
+	const tmp = "triples_migration"
+	qs.db.C(tmp).DropCollection()
+
+	dst := *qs
+	dst.ids = to
+	// Deleted triples are left behind.
+	it := qs.db.C("triples").Find(qs.live(nil)).Iter()
+	var (
+		doc bson.M
+		n   int
+	)
+	for it.Next(&doc) {
+		t := qs.quadOf(
+			doc["Subject"].(string),
+			doc["Predicate"].(string),
+			doc["Object"].(string),
+			doc["Label"].(string),
+		)
+		newDoc := dst.docFor(t)
+		if created, ok := doc[createdField]; ok {
+			newDoc[createdField] = created
+		}
+		err := qs.db.C(tmp).Insert(newDoc)
+		if err != nil {
+			it.Close()
+			return fmt.Errorf("mongo: could not migrate triple %v: %v", t, err)
+		}
+		n++
+	}
+	if err := it.Close(); err != nil {
+		return err
+	}
+
+	err := qs.session.Run(bson.D{
+		{"renameCollection", qs.db.Name + "." + tmp},
+		{"to", qs.db.Name + ".triples"},
+		{"dropTarget", true},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("mongo: could not replace triples collection: %v", err)
+	}
+	ensureTripleIndexes(qs.db)
+	qs.ids = to
+	glog.Infof("Migrated %d triples to the %s id scheme", n, to)
+	return nil
+}
+
+// tripleIndexes are the indexes of the triples collection, one for the field
+// of each direction.
+var tripleIndexes = []mgo.Index{
+	{Key: []string{"Subject"}, Background: true, Sparse: true},
+	{Key: []string{"Predicate"}, Background: true, Sparse: true},
+	{Key: []string{"Object"}, Background: true, Sparse: true},
+	{Key: []string{"Label"}, Background: true, Sparse: true},
+}
+
+func ensureTripleIndexes(db *mgo.Database) {
+	for _, index := range tripleIndexes {
+		db.C("triples").EnsureIndex(index)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/quad"
+)
+
+var idSchemeTests = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"B", "status", "cool", "status_graph"},
+}
+
+// docValue returns the value an iterator would produce for doc.
+func docValue(qs *TripleStore, doc bson.M) tripleValue {
+	var td tripleDoc
+	td.Id = doc["_id"].(string)
+	td.SubjectHash, _ = doc["SubjectHash"].(string)
+	td.PredicateHash, _ = doc["PredicateHash"].(string)
+	td.ObjectHash, _ = doc["ObjectHash"].(string)
+	td.LabelHash, _ = doc["LabelHash"].(string)
+	return qs.valueFor(td)
+}
+
+func TestIDSchemes(t *testing.T) {
+	composite := &TripleStore{hasher: sha1.New(), ids: compositeIDs}
+	hashed := &TripleStore{hasher: sha1.New(), ids: hashedIDs}
+
+	for _, q := range idSchemeTests {
+		cv := docValue(composite, composite.docFor(q))
+		hv := docValue(hashed, hashed.docFor(q))
+
+		if cv.id != composite.getIdForTriple(q) {
+			t.Errorf("Unexpected composite _id for %v, got:%s expect:%s", q, cv.id, composite.getIdForTriple(q))
+		}
+		if hv.id != hashed.getIdForTriple(q) {
+			t.Errorf("Unexpected hashed _id for %v, got:%s expect:%s", q, hv.id, hashed.getIdForTriple(q))
+		}
+		if len(hv.id) != 2*sha1.Size {
+			t.Errorf("Unexpected hashed _id length for %v, got:%d expect:%d", q, len(hv.id), 2*sha1.Size)
+		}
+
+		for d := quad.Subject; d <= quad.Label; d++ {
+			expect := composite.ValueOf(q.Get(d))
+			if got := composite.TripleDirection(cv, d); got != expect {
+				t.Errorf("Unexpected composite %s for %v, got:%v expect:%v", d, q, got, expect)
+			}
+			if got := hashed.TripleDirection(hv, d); got != expect {
+				t.Errorf("Unexpected hashed %s for %v, got:%v expect:%v", d, q, got, expect)
+			}
+		}
+	}
+}
+
+func TestValueForNamesPredicate(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(10)}
+	q := idSchemeTests[1]
+	v := qs.valueFor(tripleDoc{Id: qs.getIdForTriple(q), Predicate: q.Predicate})
+	// Without a server, the name can only come from the cache.
+	if got := qs.NameOf(qs.TripleDirection(v, quad.Predicate)); got != q.Predicate {
+		t.Errorf("Unexpected predicate, got:%q expect:%q", got, q.Predicate)
+	}
+}
+
+func TestSplitID(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs}
+	for _, q := range idSchemeTests {
+		h := qs.hashesFor(q)
+		got, ok := qs.splitID(qs.idFor(h))
+		if !ok || got != h {
+			t.Errorf("Unexpected hashes from _id of %v, got:%v (ok %t) expect:%v", q, got, ok, h)
+		}
+	}
+	for _, id := range []string{"", "abc", qs.getIdForTriple(idSchemeTests[0]) + "0"} {
+		if _, ok := qs.splitID(id); ok {
+			t.Errorf("Expected malformed _id %q to be rejected", id)
+		}
+	}
+}
+
+func TestCompositeIDCollisions(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs}
+	// Names holding likely delimiters, and names that read the same when
+	// run together.
+	quads := []quad.Quad{
+		{"a|b", "c", "d", ""},
+		{"a", "b|c", "d", ""},
+		{"ab", "c", "d", ""},
+		{"a", "bc", "d", ""},
+		{"a\x00b", "c\x00", "d", "\x00"},
+		{"a", "\x00b\x00c", "d", ""},
+		{qs.ConvertStringToByteHash("a"), "b", "c", ""},
+	}
+	seen := make(map[string]quad.Quad)
+	for _, q := range quads {
+		id := qs.getIdForTriple(q)
+		if other, ok := seen[id]; ok {
+			t.Errorf("Colliding _id for %q and %q", q, other)
+		}
+		seen[id] = q
+		got, ok := qs.splitID(id)
+		if !ok || got != qs.hashesFor(q) {
+			t.Errorf("Lossy _id for %q, got:%v (ok %t) expect:%v", q, got, ok, qs.hashesFor(q))
+		}
+	}
+}
+
+func TestHashSalt(t *testing.T) {
+	unsalted := &TripleStore{hasher: hasherFor("sha1", "")}
+	if got, expect := unsalted.ValueOf("alice"), (&TripleStore{hasher: sha1.New()}).ValueOf("alice"); got != expect {
+		t.Errorf("Unexpected unsalted hash, got:%v expect:%v", got, expect)
+	}
+
+	a := &TripleStore{hasher: hasherFor("sha1", "graph-a")}
+	b := &TripleStore{hasher: hasherFor("sha1", "graph-b")}
+	if a.ValueOf("alice") == b.ValueOf("alice") {
+		t.Error("Unexpected equal hashes of the same name under two salts")
+	}
+	if a.ValueOf("alice") != a.ValueOf("alice") {
+		t.Error("Unexpected unequal hashes of the same name under one salt")
+	}
+	if a.ValueOf("alice") == unsalted.ValueOf("alice") {
+		t.Error("Unexpected equal salted and unsalted hashes")
+	}
+
+	// A salt that is a prefix of another must not collide with it.
+	short := &TripleStore{hasher: hasherFor("sha1", "ab")}
+	long := &TripleStore{hasher: hasherFor("sha1", "abc")}
+	if short.ValueOf("cd") == long.ValueOf("d") {
+		t.Error("Unexpected collision of salts that run together with names")
+	}
+	if n := len(a.ValueOf("alice").(string)); n != 2*sha1.Size {
+		t.Errorf("Unexpected salted hash length, got:%d expect:%d", n, 2*sha1.Size)
+	}
+}
@@ -17,6 +17,7 @@ package mongo
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/barakmich/glog"
 	"gopkg.in/mgo.v2"
@@ -32,85 +33,450 @@ type Iterator struct {
 	tags       graph.Tagger
 	qs         *TripleStore
 	dir        quad.Direction
-	iter       *mgo.Iter
+	iter       cursor
 	hash       string
 	name       string
+	labels     []string
 	size       int64
+	total      int64
 	isAll      bool
 	constraint bson.M
 	collection string
 	result     graph.Value
+
+	// The window of results pushed down from Skip and Limit iterators.
+	// A negative limit means no limit.
+	skip  int64
+	limit int64
+
+	// When the cursor was opened, the _id of the last document read from
+	// it, and the number of documents read, for refreshing the cursor.
+	opened time.Time
+	lastID string
+	read   int64
+
+	// The number of misses checked again on the primary.
+	rechecks int
+
+	// The keys the results are sorted on, as given to mgo's Sort, if the
+	// iterator is sorted other than for refreshing its cursor.
+	sort []string
+
+	// The number of times the query was reissued after a transient error.
+	retries int
+
+	// Whether the iterator has been closed and given back to the pool.
+	released bool
+
+	// Whether the iterator has been optimized. Its parent closes it then,
+	// whether or not it was replaced, and may close it again, so it is
+	// never given back to the pool, where another query could take it
+	// before the last of those closes.
+	optimized bool
+
+	// The constraints of the iterators united by an $or query, if the
+	// iterator makes one.
+	branches []branch
+
+	// The source of the current triple, if the store tags sources.
+	source sourceName
+
+	// Whether the iterator reads the whole collection, checking each
+	// triple against its constraint in memory, rather than querying on
+	// its constraint.
+	scan bool
+
+	// The only direction whose node is read from each triple, along with
+	// its name, if the triples are plucked for their nodes in it.
+	pluck quad.Direction
+
+	// The languages the objects of the triples are narrowed to, if any.
+	langs []string
+
+	// The number of triples drawn at random with a $sample stage, if the
+	// iterator is sampled.
+	sample int64
+
+	// Stops the cursor being closed when the query is cancelled, once it
+	// is replaced or closed.
+	unwatch func()
 }
 
 func NewIterator(qs *TripleStore, collection string, d quad.Direction, val graph.Value) *Iterator {
-	name := qs.NameOf(val)
-
-	var constraint bson.M
-	switch d {
-	case quad.Subject:
-		constraint = bson.M{"Subject": name}
-	case quad.Predicate:
-		constraint = bson.M{"Predicate": name}
-	case quad.Object:
-		constraint = bson.M{"Object": name}
-	case quad.Label:
-		constraint = bson.M{"Label": name}
-	}
-
-	size, err := qs.db.C(collection).Find(constraint).Count()
+	hash, err := literal(val)
 	if err != nil {
-		// FIXME(kortschak) This should be passed back rather than just logging.
-		glog.Errorln("Trouble getting size for iterator! ", err)
+		glog.Errorf("Error: %v for iterator value %v", err, val)
 		return nil
 	}
+	name := qs.NameOf(hash)
+	constraint := qs.live(qs.constraintFor(d, name, hash))
+
+	// The triples of a predicate may have been counted in the background.
+	var size int64
+	var cached bool
+	if collection == "triples" && d == quad.Predicate {
+		size, cached = qs.cachedPredicateSize(qs.storedName(name))
+	}
+	if !cached {
+		n, err := countQuery(qs, collection, constraint)
+		if err != nil {
+			// FIXME(kortschak) This should be passed back rather than just logging.
+			glog.Errorln("Trouble getting size for iterator! ", err)
+			return nil
+		}
+		size = int64(n)
+	}
+
+	// Without an index, the server reads the whole collection for the
+	// iterator's results, so its size is needed to estimate the cost. It
+	// is also needed to choose whether to scan the collection instead.
+	var total int64
+	if !qs.indexedOn(d) || qs.scanPercent > 0 {
+		if total, cached = qs.cachedSize(collection, false); !cached {
+			n, err := countQuery(qs, collection, nil)
+			if err != nil {
+				glog.Errorln("Trouble getting size for iterator! ", err)
+				return nil
+			}
+			total = int64(n)
+		}
+	}
 
-	return &Iterator{
+	it := qs.allocIterator()
+	*it = Iterator{
 		uid:        iterator.NextUID(),
 		name:       name,
+		total:      total,
 		constraint: constraint,
 		collection: collection,
 		qs:         qs,
 		dir:        d,
-		iter:       qs.db.C(collection).Find(constraint).Iter(),
-		size:       int64(size),
-		hash:       val.(string),
+		size:       size,
+		hash:       hash,
 		isAll:      false,
+		limit:      -1,
 	}
+	it.open()
+	return it
 }
 
-func NewAllIterator(qs *TripleStore, collection string) *Iterator {
-	size, err := qs.db.C(collection).Count()
+// NewLabelsIterator returns an iterator over the triples with any of the
+// given labels, found with a single query. It returns ErrNotLiteral for
+// labels that are not literals, or the error met sizing the iterator.
+func NewLabelsIterator(qs *TripleStore, labels []graph.Value) (*Iterator, error) {
+	hashes, err := literals(labels)
 	if err != nil {
-		// FIXME(kortschak) This should be passed back rather than just logging.
-		glog.Errorln("Trouble getting size for iterator! ", err)
-		return nil
+		return nil, err
+	}
+	names := make([]string, len(hashes))
+	for i, h := range hashes {
+		names[i] = qs.NameOf(h)
+	}
+	constraint := qs.live(qs.labelsConstraint(names, hashes))
+
+	size, err := countQuery(qs, "triples", constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	it := qs.allocIterator()
+	*it = Iterator{
+		uid:        iterator.NextUID(),
+		name:       strings.Join(names, ","),
+		labels:     hashes,
+		constraint: constraint,
+		collection: "triples",
+		qs:         qs,
+		dir:        quad.Label,
+		size:       int64(size),
+		limit:      -1,
+	}
+	it.open()
+	return it, nil
+}
+
+// labelsConstraint returns the query constraint selecting the triples that
+// have any of the named labels, whose hashes are given.
+func (qs *TripleStore) labelsConstraint(names, hashes []string) bson.M {
+	c := newConstraint().in("Label", names)
+	if qs.shardKey == quad.Label {
+		c.in(shardKeyField, hashes)
+	}
+	return c.M()
+}
+
+func NewAllIterator(qs *TripleStore, collection string) *Iterator {
+	var constraint bson.M
+	if collection == "triples" {
+		constraint = qs.live(nil)
+	}
+	size, cached := qs.cachedSize(collection, true)
+	if !cached {
+		n, err := countQuery(qs, collection, constraint)
+		if err != nil {
+			// FIXME(kortschak) This should be passed back rather than just logging.
+			glog.Errorln("Trouble getting size for iterator! ", err)
+			return nil
+		}
+		size = int64(n)
 	}
 
-	return &Iterator{
+	it := qs.allocIterator()
+	*it = Iterator{
 		uid:        iterator.NextUID(),
 		qs:         qs,
 		dir:        quad.Any,
-		constraint: nil,
+		constraint: constraint,
 		collection: collection,
-		iter:       qs.db.C(collection).Find(nil).Iter(),
-		size:       int64(size),
+		size:       size,
 		hash:       "",
 		isAll:      true,
+		limit:      -1,
 	}
+	it.open()
+	return it
+}
+
+// NewDescendingAllIterator returns an iterator over everything in the
+// collection in descending order, for scans of the newest first. With the
+// timestamps option, triples are sorted newest first on when they were
+// written, those written before the option was set coming last. Otherwise
+// they and nodes are sorted on their _ids, which are made from hashes and
+// so give the reverse of the usual order, not the newest first.
+func NewDescendingAllIterator(qs *TripleStore, collection string) *Iterator {
+	it := NewAllIterator(qs, collection)
+	if it == nil {
+		return nil
+	}
+	it.sort = descendingSort(qs, collection)
+	it.Reset()
+	return it
+}
+
+// descendingSort returns the sort keys of a descending scan of collection.
+func descendingSort(qs *TripleStore, collection string) []string {
+	if collection == "triples" && qs.timestamps {
+		return []string{"-" + createdField, "-_id"}
+	}
+	return []string{"-_id"}
+}
+
+// SortBy orders the triples of the iterator by the name of direction d,
+// breaking ties on the names of the others in the order of
+// iterator.SortOrder, and then by _id, reopening its cursor. Iterators over
+// nodes, or already sorted, cannot be sorted.
+func (it *Iterator) SortBy(d quad.Direction) bool {
+	if it.collection != "triples" || it.sort != nil {
+		return false
+	}
+	sort := sortKeys(d)
+	if sort == nil {
+		return false
+	}
+	it.sort = sort
+	it.Reset()
+	return true
+}
+
+// SortByKeys orders the triples of the iterator on keys, breaking ties as
+// iterator.SortKeys does and then by _id, with a compound sort on the name
+// fields of the keys. It cannot sort on keys that are not each a different
+// direction of triples, and, as with SortBy, cannot sort nodes or an
+// iterator already sorted.
+func (it *Iterator) SortByKeys(keys []graph.SortKey) bool {
+	if it.collection != "triples" || it.sort != nil {
+		return false
+	}
+	sort := sortFields(keys)
+	if sort == nil {
+		return false
+	}
+	it.sort = sort
+	it.Reset()
+	return true
+}
+
+// SampleBy narrows the triples of the iterator to n drawn at random by the
+// server, with a $sample stage after a match on its constraint, reopening
+// its cursor. Iterators over nodes, or already windowed, sorted, scanning
+// or plucking, cannot be sampled. Contains still checks the constraint, so
+// an iterator.Sample holds the triples drawn to check them.
+func (it *Iterator) SampleBy(n int64) bool {
+	if it.collection != "triples" || it.sample > 0 || n <= 0 {
+		return false
+	}
+	if it.windowed() || it.sort != nil || it.scan || it.pluck != quad.Any {
+		return false
+	}
+	it.sample = n
+	it.Reset()
+	return true
+}
+
+// samplePipeline returns the aggregation that draws the triples of a
+// sampled iterator.
+func (it *Iterator) samplePipeline() []bson.M {
+	it.qs.observe(it.collection, it.constraint)
+	return []bson.M{
+		{"$match": it.constraint},
+		{"$sample": bson.M{"size": it.sample}},
+		{"$project": tripleSelector},
+	}
+}
+
+// sortKeys returns the keys that sort triples by direction d as a
+// iterator.Sort does, or nil if d is not a direction of triples. Names
+// kept in GridFS sort by their stand-ins.
+func sortKeys(d quad.Direction) []string {
+	return sortFields([]graph.SortKey{{Dir: d}})
+}
+
+// sortFields returns the keys that sort triples on keys as a iterator.Sort
+// does, each descending key prefixed with "-" for mgo's Sort, or nil if a
+// key is not a direction of triples or a direction is keyed twice.
+func sortFields(keys []graph.SortKey) []string {
+	var keyed [quad.Label + 1]bool
+	for _, k := range keys {
+		if k.Dir < quad.Subject || k.Dir > quad.Label || keyed[k.Dir] {
+			return nil
+		}
+		keyed[k.Dir] = true
+	}
+	var fields []string
+	for _, k := range iterator.SortKeys(keys) {
+		field := nameFields[k.Dir]
+		if k.Descending {
+			field = "-" + field
+		}
+		fields = append(fields, field)
+	}
+	return append(fields, "_id")
+}
+
+// allocIterator returns an Iterator to be filled in whole, taken from the
+// pool if the store pools iterators. Filling it in whole leaves nothing of
+// the query it was last used for.
+func (qs *TripleStore) allocIterator() *Iterator {
+	if !qs.poolIterators {
+		return new(Iterator)
+	}
+	return getIterator()
 }
 
 func (it *Iterator) UID() uint64 {
 	return it.uid
 }
 
+// openCursor returns a cursor over the results of the iterator's query, or
+// of its $sample aggregation if it is sampled.
+var openCursor = func(it *Iterator) cursor {
+	if it.sample > 0 {
+		return aggregate(it.qs, it.samplePipeline())
+	}
+	return it.query().Iter()
+}
+
+// open opens the iterator's cursor, unless the store's breaker is open.
+func (it *Iterator) open() {
+	if !it.qs.breaker.allow() {
+		it.setCursor(refused{})
+		return
+	}
+	it.qs.roundTrip()
+	it.setCursor(openCursor(it))
+	it.opened = now()
+}
+
+// setCursor makes c the iterator's cursor, to be closed as soon as the
+// query is cancelled, and forgets the cursor it replaces.
+func (it *Iterator) setCursor(c cursor) {
+	if it.unwatch != nil {
+		it.unwatch()
+	}
+	it.iter = c
+	it.unwatch = it.qs.watch(c)
+}
+
+// query returns the iterator's query, with its window applied.
+func (it *Iterator) query() *mgo.Query {
+	var q *mgo.Query
+	if it.scan {
+		q = it.qs.find(it.collection, quad.Any, it.qs.live(nil))
+	} else {
+		q = it.qs.find(it.collection, it.dir, it.constraint)
+	}
+	if it.pluck != quad.Any {
+		q = q.Select(it.qs.pluckSelector(it.pluck))
+	}
+	if it.skip > 0 {
+		q = q.Skip(int(it.skip))
+	}
+	if it.limit > 0 {
+		q = q.Limit(int(it.limit))
+	}
+	if it.sort != nil {
+		q = q.Sort(it.sort...)
+	} else if it.qs.cursorRefresh > 0 || it.qs.cursorRetries > 0 {
+		// A refreshed or reissued cursor carries on from the last _id read.
+		q = q.Sort("_id")
+	}
+	return q
+}
+
+// skipBy narrows the window of the iterator as a Skip(n) over it would.
+func (it *Iterator) skipBy(n int64) {
+	it.skip += n
+	if it.limit >= 0 {
+		it.limit -= n
+		if it.limit < 0 {
+			it.limit = 0
+		}
+	}
+}
+
+// limitTo narrows the window of the iterator as a Limit(n) over it would.
+func (it *Iterator) limitTo(n int64) {
+	if it.limit < 0 || n < it.limit {
+		it.limit = n
+	}
+}
+
+func (it *Iterator) windowed() bool {
+	return it.skip > 0 || it.limit >= 0
+}
+
+// Reset reissues the query. With soft deletes, its constraint selects only
+// live triples, so those deleted during the last pass are not seen again.
 func (it *Iterator) Reset() {
 	it.iter.Close()
-	it.iter = it.qs.db.C(it.collection).Find(it.constraint).Iter()
-
+	it.open()
+	it.lastID = ""
+	it.read = 0
+	it.retries = 0
 }
 
+// Rewind does nothing, as Contains is answered from the value checked, or
+// with a query of its own, rather than from the cursor.
+func (it *Iterator) Rewind() {}
+
+// Close closes the iterator's cursor. If the store pools iterators, the
+// iterator is then given back to be reused, unless it has been optimized,
+// so it must not be used again.
 func (it *Iterator) Close() {
+	if it.released {
+		return
+	}
 	it.iter.Close()
+	if it.unwatch != nil {
+		it.unwatch()
+		it.unwatch = nil
+	}
+	if it.qs.poolIterators {
+		it.released = true
+		if !it.optimized {
+			putIterator(it)
+		}
+	}
 }
 
 func (it *Iterator) Tagger() *graph.Tagger {
@@ -125,36 +491,99 @@ func (it *Iterator) TagResults(dst map[string]graph.Value) {
 	for tag, value := range it.tags.Fixed() {
 		dst[tag] = value
 	}
+
+	if it.collection == "triples" && it.qs.sourceTag != "" {
+		dst[it.qs.sourceTag] = it.source
+	}
 }
 
+// Clone returns an iterator over the same triples or nodes, made from the
+// same view of the store, so that it is stopped along with the iterator if
+// their query is cancelled.
 func (it *Iterator) Clone() graph.Iterator {
 	var m *Iterator
 	if it.isAll {
 		m = NewAllIterator(it.qs, it.collection)
+	} else if it.branches != nil {
+		var err error
+		if m, err = newOrIterator(it.qs, it.branches); err != nil {
+			glog.Errorln("Trouble getting size for iterator! ", err)
+			return iterator.NewNull()
+		}
+	} else if it.labels != nil {
+		labels := make([]graph.Value, len(it.labels))
+		for i, l := range it.labels {
+			labels[i] = l
+		}
+		var err error
+		if m, err = NewLabelsIterator(it.qs, labels); err != nil {
+			glog.Errorf("Error: %v for labels %v", err, labels)
+			return iterator.NewNull()
+		}
 	} else {
 		m = NewIterator(it.qs, it.collection, it.dir, it.hash)
 	}
 	m.tags.CopyFrom(it)
+	if it.langs != nil {
+		m.narrowLangs(it.langs)
+	}
+	if it.windowed() || it.sort != nil || it.scan || it.pluck != quad.Any || it.langs != nil || it.sample > 0 {
+		m.skip, m.limit = it.skip, it.limit
+		m.sort = it.sort
+		m.scan = it.scan
+		m.pluck = it.pluck
+		m.sample = it.sample
+		m.Reset()
+	}
 	return m
 }
 
 func (it *Iterator) Next() bool {
-	var result struct {
-		Id string "_id"
-		//Sub string "Sub"
-		//Pred string "Pred"
-		//Obj string "Obj"
-	}
-	found := it.iter.Next(&result)
-	if !found {
-		err := it.iter.Err()
-		if err != nil {
-			glog.Errorln("Error Nexting Iterator: ", err)
-		}
+	if it.limit == 0 {
+		// Mongo takes a limit of zero to mean no limit.
 		return false
 	}
-	it.result = result.Id
-	return true
+	if it.stop() {
+		return false
+	}
+	if it.needsRefresh() {
+		it.refresh()
+	}
+	for {
+		var result tripleDoc
+		found := it.next(&result)
+		for !found && it.retry() {
+			found = it.next(&result)
+		}
+		if !found {
+			err := it.Err()
+			it.qs.breaker.report(err)
+			if err != nil && err != graph.ErrQueryCancelled && err != graph.ErrUnavailable {
+				glog.Errorln("Error Nexting Iterator: ", err)
+			}
+			return false
+		}
+		it.lastID = result.Id
+		it.read++
+		if it.read == 1 {
+			// The server is answering.
+			it.qs.breaker.report(nil)
+		}
+		if it.collection == "nodes" {
+			it.result = result.Id
+			return true
+		}
+		v := it.qs.valueFor(result)
+		if it.scan && !it.matches(v) {
+			continue
+		}
+		if it.pluck != quad.Any {
+			it.qs.plucked(v, result, it.pluck)
+		}
+		it.result = v
+		it.source = sourceName(result.Source)
+		return true
+	}
 }
 
 func (it *Iterator) ResultTree() *graph.ResultTree {
@@ -176,31 +605,123 @@ func (it *Iterator) SubIterators() []graph.Iterator {
 
 func (it *Iterator) Contains(v graph.Value) bool {
 	graph.ContainsLogIn(it, v)
+	if it.windowed() {
+		// Where a document falls in the window is only known by walking it.
+		c := it.Clone()
+		defer c.Close()
+		for graph.Next(c) {
+			if c.Result() == v {
+				it.result = v
+				return graph.ContainsLogOut(it, v, true)
+			}
+		}
+		return graph.ContainsLogOut(it, v, false)
+	}
+	if !it.couldContain(v) {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	if it.collection == "triples" && it.qs.softDelete {
+		// The triple may have been deleted since it was read, perhaps by
+		// another part of the same query.
+		live, err := it.qs.exists(bson.M{"_id": v.(tripleValue).id}, &it.rechecks)
+		if err != nil {
+			glog.Errorln("Error checking iterator: ", err)
+		}
+		if !live {
+			return graph.ContainsLogOut(it, v, false)
+		}
+	}
+	if it.collection == "triples" && it.qs.sourceTag != "" {
+		it.source = it.qs.sourceOf(v.(tripleValue).id)
+	}
+	it.result = v
+	return graph.ContainsLogOut(it, v, true)
+}
+
+// couldContain returns whether v matches the iterator's constraint, as far
+// as can be told without asking the server.
+func (it *Iterator) couldContain(v graph.Value) bool {
+	if it.collection == "triples" && it.qs.labelHashes != nil {
+		if t, ok := v.(tripleValue); !ok || !it.qs.permits(t) {
+			return false
+		}
+	}
 	if it.isAll {
-		it.result = v
-		return graph.ContainsLogOut(it, v, true)
-	}
-	var offset int
-	switch it.dir {
-	case quad.Subject:
-		offset = 0
-	case quad.Predicate:
-		offset = (it.qs.hasher.Size() * 2)
-	case quad.Object:
-		offset = (it.qs.hasher.Size() * 2) * 2
-	case quad.Label:
-		offset = (it.qs.hasher.Size() * 2) * 3
-	}
-	val := v.(string)[offset : it.qs.hasher.Size()*2+offset]
-	if val == it.hash {
-		it.result = v
-		return graph.ContainsLogOut(it, v, true)
+		// Unlabeled triples still carry the hash of the empty label in
+		// their _id, but no node is ever written for it.
+		return it.collection != "nodes" || v != it.qs.ValueOf("")
+	}
+	return it.matches(v.(tripleValue))
+}
+
+// BatchContains checks vals as Contains does, but makes at most one query
+// for all of them: a walk of the window, or a lookup of which of the
+// triples are live.
+func (it *Iterator) BatchContains(vals []graph.Value) []bool {
+	out := make([]bool, len(vals))
+	if it.windowed() {
+		want := make(map[graph.Value][]int)
+		for i, v := range vals {
+			want[v] = append(want[v], i)
+		}
+		c := it.Clone()
+		defer c.Close()
+		for graph.Next(c) {
+			for _, i := range want[c.Result()] {
+				out[i] = true
+			}
+		}
+		return out
+	}
+	var ids []string
+	for i, v := range vals {
+		out[i] = it.couldContain(v)
+		if out[i] && it.collection == "triples" && it.qs.softDelete {
+			ids = append(ids, v.(tripleValue).id)
+		}
+	}
+	if ids == nil {
+		return out
+	}
+	live, err := it.qs.liveIDs(ids)
+	if err != nil {
+		glog.Errorln("Error checking iterator: ", err)
+	}
+	for i, v := range vals {
+		if out[i] {
+			out[i] = live[v.(tripleValue).id]
+		}
 	}
-	return graph.ContainsLogOut(it, v, false)
+	return out
+}
+
+// matches returns whether the node of t in the iterator's direction is the
+// one, or one of those, the iterator is constrained to, or, for an $or
+// query, whether t matches any of the iterators it unites.
+func (it *Iterator) matches(t tripleValue) bool {
+	if it.branches != nil {
+		for _, b := range it.branches {
+			if b.matches(t) {
+				return true
+			}
+		}
+		return false
+	}
+	return it.branch().matches(t)
 }
 
 func (it *Iterator) Size() (int64, bool) {
-	return it.size, true
+	size := it.size - it.skip
+	if size < 0 {
+		size = 0
+	}
+	if it.limit >= 0 && size > it.limit {
+		size = it.limit
+	}
+	if it.sample > 0 && size > it.sample {
+		size = it.sample
+	}
+	return size, true
 }
 
 var mongoType graph.Type
@@ -212,25 +733,66 @@ func init() {
 func Type() graph.Type { return mongoType }
 
 func (it *Iterator) Type() graph.Type {
-	if it.isAll {
+	// A windowed or sampled iterator over everything no longer holds
+	// everything, so must not be optimized away as an All.
+	if it.isAll && !it.windowed() && it.sample == 0 {
 		return graph.All
 	}
 	return mongoType
 }
 
-func (it *Iterator) Sorted() bool                     { return true }
-func (it *Iterator) Optimize() (graph.Iterator, bool) { return it, false }
+// Spec says which store iterator it is, unless the store has pushed a
+// window, sort, or union of other iterators into its query.
+func (it *Iterator) Spec() (graph.IteratorSpec, bool) {
+	if it.windowed() || it.sort != nil || it.branches != nil || it.labels != nil || it.sample > 0 {
+		return graph.IteratorSpec{}, false
+	}
+	switch {
+	case it.isAll && it.collection == "nodes":
+		return graph.IteratorSpec{Source: graph.NodesAll}, true
+	case it.isAll:
+		return graph.IteratorSpec{Source: graph.TriplesAll}, true
+	}
+	return graph.IteratorSpec{Source: graph.Triples, Direction: it.dir, Value: it.hash}, true
+}
+
+func (it *Iterator) Sorted() bool { return true }
+
+// Optimize replaces an iterator that selects all of its collection with an
+// iterator over everything, and one that selects much of it with one that
+// scans the whole collection, checking each triple in memory.
+func (it *Iterator) Optimize() (graph.Iterator, bool) {
+	it.optimized = true
+	if it.coversAll() {
+		if all := NewAllIterator(it.qs, it.collection); all != nil {
+			it.Close()
+			return all, true
+		}
+	}
+	if !it.prefersScan() {
+		return it, false
+	}
+	newIt := it.Clone().(*Iterator)
+	newIt.scan = true
+	newIt.Reset()
+	it.Close()
+	return newIt, true
+}
 
 func (it *Iterator) DebugString(indent int) string {
 	size, _ := it.Size()
+	if it.sort != nil {
+		return fmt.Sprintf("%s(%s size:%d %s %s skip:%d limit:%d sort:%s)", strings.Repeat(" ", indent), it.Type(), size, it.hash, it.name, it.skip, it.limit, strings.Join(it.sort, ","))
+	}
+	if it.windowed() {
+		return fmt.Sprintf("%s(%s size:%d %s %s skip:%d limit:%d)", strings.Repeat(" ", indent), it.Type(), size, it.hash, it.name, it.skip, it.limit)
+	}
+	if it.scan {
+		return fmt.Sprintf("%s(%s size:%d %s %s scan)", strings.Repeat(" ", indent), it.Type(), size, it.hash, it.name)
+	}
+	if it.sample > 0 {
+		return fmt.Sprintf("%s(%s size:%d %s %s sample:%d)", strings.Repeat(" ", indent), it.Type(), size, it.hash, it.name, it.sample)
+	}
 	return fmt.Sprintf("%s(%s size:%d %s %s)", strings.Repeat(" ", indent), it.Type(), size, it.hash, it.name)
 }
 
-func (it *Iterator) Stats() graph.IteratorStats {
-	size, _ := it.Size()
-	return graph.IteratorStats{
-		ContainsCost: 1,
-		NextCost:     5,
-		Size:         size,
-	}
-}
@@ -0,0 +1,350 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// maxJoinStarts is the most nodes a join starts from. From more, the list
+// sent with its query grows dear, and walking the triples of each node one
+// by one costs less in comparison.
+const maxJoinStarts = 100
+
+// A JoinIterator follows two fixed predicates out from a few fixed nodes,
+// as
+//
+//	g.V("alice").Out("knows").Out("name")
+//
+// does, yielding the objects of the second hop. Nested HasA and LinksTo
+// iterators make a query for the first hop and another for each of its
+// objects; a JoinIterator has the server follow both hops with a $lookup,
+// in one aggregation. It needs MongoDB 3.4 or later.
+//
+// As nested iterators do, it yields each object once, with one more path
+// for each other way of reaching it.
+type JoinIterator struct {
+	uid    uint64
+	tags   graph.Tagger
+	qs     *TripleStore
+	starts []string
+	first  string
+	second string
+	size   int64
+	iter   cursor
+	result graph.Value
+	paths  int
+}
+
+// joinDoc is an object reached by a join, and the number of ways it was.
+type joinDoc struct {
+	Name  string `bson:"_id"`
+	Paths int    `bson:"paths"`
+}
+
+// NewJoinIterator returns an iterator over the objects of the triples with
+// the predicate second whose subjects are the objects of the triples with
+// the predicate first and one of the subjects starts. The size of the
+// first hop, an estimate of the size of the iterator, is size.
+func NewJoinIterator(qs *TripleStore, starts []string, first, second string, size int64) *JoinIterator {
+	return &JoinIterator{
+		uid:    iterator.NextUID(),
+		qs:     qs,
+		starts: starts,
+		first:  first,
+		second: second,
+		size:   size,
+	}
+}
+
+// aggregate returns a cursor over the results of pipeline on the triples
+// collection, which may spill to disk on the server.
+var aggregate = func(qs *TripleStore, pipeline []bson.M) cursor {
+	return qs.db.C("triples").Pipe(pipeline).AllowDiskUse().Iter()
+}
+
+// pipeline returns the aggregation that follows both hops, yielding the
+// objects of the second hop that match the object constraint, which may
+// be nil.
+func (it *JoinIterator) pipeline(object bson.M) []bson.M {
+	second := newConstraint().eq("Predicate", it.second).M()
+	for k, v := range object {
+		second[k] = v
+	}
+	return []bson.M{
+		{"$match": it.qs.live(newConstraint().in("Subject", it.starts).eq("Predicate", it.first).M())},
+		{"$project": bson.M{"Object": 1}},
+		{"$lookup": bson.M{
+			"from":         "triples",
+			"localField":   "Object",
+			"foreignField": "Subject",
+			"as":           "hop",
+		}},
+		{"$unwind": "$hop"},
+		{"$replaceRoot": bson.M{"newRoot": "$hop"}},
+		{"$match": it.qs.live(second)},
+		{"$group": bson.M{"_id": "$Object", "paths": bson.M{"$sum": 1}}},
+	}
+}
+
+func (it *JoinIterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *JoinIterator) Reset() {
+	it.Close()
+	it.iter = nil
+	it.result = nil
+	it.paths = 0
+}
+
+func (it *JoinIterator) Close() {
+	if it.iter != nil {
+		it.iter.Close()
+	}
+}
+
+func (it *JoinIterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *JoinIterator) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+}
+
+func (it *JoinIterator) Clone() graph.Iterator {
+	m := NewJoinIterator(it.qs, it.starts, it.first, it.second, it.size)
+	m.tags.CopyFrom(it)
+	return m
+}
+
+func (it *JoinIterator) Next() bool {
+	graph.NextLogIn(it)
+	if it.qs.cancelled() {
+		if it.iter != nil {
+			it.iter.Close()
+			it.iter = stopped{}
+		}
+		return graph.NextLogOut(it, nil, false)
+	}
+	if it.iter == nil {
+		it.qs.roundTrip()
+		it.iter = aggregate(it.qs, it.pipeline(nil))
+	}
+	var doc joinDoc
+	if !it.iter.Next(&doc) {
+		if err := it.iter.Err(); err != nil {
+			glog.Errorln("Error Nexting JoinIterator: ", err)
+		}
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.found(doc)
+	return graph.NextLogOut(it, it.result, true)
+}
+
+// found makes the object of doc the result, keeping its name, which the
+// join has already read.
+func (it *JoinIterator) found(doc joinDoc) {
+	hash := it.qs.hashOfStored(doc.Name)
+	it.qs.idCache.Put(hash, doc.Name)
+	it.result = hash
+	it.paths = doc.Paths - 1
+}
+
+func (it *JoinIterator) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *JoinIterator) Result() graph.Value {
+	return it.result
+}
+
+// NextPath yields the result again for each other way the join reached it.
+func (it *JoinIterator) NextPath() bool {
+	if it.paths <= 0 {
+		return false
+	}
+	it.paths--
+	return true
+}
+
+func (it *JoinIterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+// Contains checks whether val is reached by the join, with the same
+// aggregation narrowed to triples with val as their object.
+func (it *JoinIterator) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	hash, err := literal(val)
+	if err != nil {
+		glog.Errorf("Error: %v for value %v", err, val)
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.qs.roundTrip()
+	c := aggregate(it.qs, it.pipeline(newConstraint().eq("Object", it.qs.NameOf(hash)).M()))
+	var doc joinDoc
+	found := c.Next(&doc)
+	if err := c.Close(); err != nil {
+		glog.Errorln("Error checking JoinIterator: ", err)
+		return graph.ContainsLogOut(it, val, false)
+	}
+	if !found {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.found(doc)
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *JoinIterator) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
+
+// Size returns the size of the first hop, an estimate as each of its
+// objects may have any number of triples in the second.
+func (it *JoinIterator) Size() (int64, bool) {
+	return it.size, false
+}
+
+// Stats estimates the costs of the iterator: each result is read from the
+// same cursor, and each check is an aggregation of its own.
+func (it *JoinIterator) Stats() graph.IteratorStats {
+	return graph.IteratorStats{
+		ContainsCost: queryCost,
+		NextCost:     indexCost,
+		Size:         it.size,
+	}
+}
+
+var mongoJoinType graph.Type
+
+func init() {
+	mongoJoinType = graph.RegisterIterator("mongo_join")
+}
+
+func (it *JoinIterator) Type() graph.Type {
+	return mongoJoinType
+}
+
+func (it *JoinIterator) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s size:%d %v -%s-> -%s->)", strings.Repeat(" ", indent), it.Type(), it.size, it.starts, it.first, it.second)
+}
+
+// optimizeHasA replaces the nested iterators of a two hop traversal over
+// fixed predicates, from a few fixed nodes and with no tags or label scope
+// along the way, with a JoinIterator.
+func (qs *TripleStore) optimizeHasA(it *iterator.HasA) (graph.Iterator, bool) {
+	if it.Direction() != quad.Object {
+		return it, false
+	}
+	second, hop, _, ok := fixedPredicateAnd(it.SubIterators()[0])
+	if !ok {
+		return it, false
+	}
+	lto, ok := hop.(*iterator.LinksTo)
+	if !ok || lto.Direction() != quad.Subject || tagged(lto) {
+		return it, false
+	}
+	inner, ok := lto.SubIterators()[0].(*iterator.HasA)
+	if !ok || inner.Direction() != quad.Object || tagged(inner) {
+		return it, false
+	}
+	first, start, size, ok := fixedPredicateAnd(inner.SubIterators()[0])
+	if !ok {
+		return it, false
+	}
+	starts, ok := qs.startNames(start)
+	if !ok {
+		return it, false
+	}
+	newIt := NewJoinIterator(qs, starts, first, second, size)
+	newIt.tags.CopyFrom(it)
+	it.Close()
+	return newIt, true
+}
+
+// fixedPredicateAnd splits an untagged And of two iterators, one of which
+// is over the triples with a fixed predicate, into the name of the
+// predicate, the other iterator, and the number of triples with the
+// predicate.
+func fixedPredicateAnd(it graph.Iterator) (string, graph.Iterator, int64, bool) {
+	and, ok := it.(*iterator.And)
+	if !ok || tagged(and) {
+		return "", nil, 0, false
+	}
+	subs := and.SubIterators()
+	if len(subs) != 2 {
+		return "", nil, 0, false
+	}
+	for i, sub := range subs {
+		if m, ok := sub.(*Iterator); ok && m.fixedOn(quad.Predicate) {
+			return m.name, subs[1-i], m.size, true
+		}
+	}
+	return "", nil, 0, false
+}
+
+// startNames returns the names of the nodes a join starts from: the nodes
+// of an untagged iterator over the subjects of triples with fixed
+// subjects, so long as there are few enough of them.
+func (qs *TripleStore) startNames(it graph.Iterator) ([]string, bool) {
+	switch it := it.(type) {
+	case *Iterator:
+		if it.fixedOn(quad.Subject) {
+			return []string{it.name}, true
+		}
+	case *iterator.LinksTo:
+		primary := it.SubIterators()[0]
+		if it.Direction() != quad.Subject || tagged(it) || primary.Type() != graph.Fixed || tagged(primary) {
+			return nil, false
+		}
+		if size, _ := primary.Size(); size > maxJoinStarts {
+			return nil, false
+		}
+		var names []string
+		f := primary.Clone()
+		defer f.Close()
+		for graph.Next(f) {
+			names = append(names, qs.NameOf(f.Result()))
+		}
+		return names, true
+	}
+	return nil, false
+}
+
+// fixedOn returns whether the iterator is over the triples with one node in
+// direction d, and nothing more.
+func (it *Iterator) fixedOn(d quad.Direction) bool {
+	return it.collection == "triples" && it.dir == d && !it.isAll && it.labels == nil && !it.windowed() && !tagged(it)
+}
+
+// tagged returns whether it has any tags to be kept.
+func tagged(it graph.Iterator) bool {
+	return len(it.Tagger().Tags()) != 0 || len(it.Tagger().Fixed()) != 0
+}
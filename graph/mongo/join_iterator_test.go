@@ -0,0 +1,417 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	_ "github.com/google/cayley/graph/memstore"
+	"github.com/google/cayley/quad"
+)
+
+// fakeTriples simulates the triples collection, running the stages of an
+// aggregation that JoinIterator uses. Each aggregation waits for delay, as
+// a round trip to a server would.
+type fakeTriples struct {
+	qs      *TripleStore
+	triples []bson.M
+	delay   time.Duration
+	queries int
+}
+
+func newFakeTriples(qs *TripleStore, quads []quad.Quad) *fakeTriples {
+	f := &fakeTriples{qs: qs}
+	for _, q := range quads {
+		f.triples = append(f.triples, qs.docFor(q))
+		for _, name := range []string{q.Subject, q.Predicate, q.Object, q.Label} {
+			qs.idCache.Put(qs.ConvertStringToByteHash(name), name)
+		}
+	}
+	return f
+}
+
+func (f *fakeTriples) aggregate(qs *TripleStore, pipeline []bson.M) cursor {
+	f.queries++
+	time.Sleep(f.delay)
+	docs := f.triples
+	for _, stage := range pipeline {
+		for op, arg := range stage {
+			switch op {
+			case "$match":
+				docs = f.match(arg.(bson.M), docs)
+			case "$lookup":
+				lookup := arg.(bson.M)
+				var joined []bson.M
+				for _, doc := range docs {
+					hop := f.match(bson.M{lookup["foreignField"].(string): doc[lookup["localField"].(string)]}, f.triples)
+					joined = append(joined, bson.M{lookup["as"].(string): hop})
+				}
+				docs = joined
+			case "$unwind":
+				var unwound []bson.M
+				for _, doc := range docs {
+					for _, hop := range doc[arg.(string)[1:]].([]bson.M) {
+						unwound = append(unwound, bson.M{arg.(string)[1:]: hop})
+					}
+				}
+				docs = unwound
+			case "$replaceRoot":
+				for i, doc := range docs {
+					docs[i] = doc[arg.(bson.M)["newRoot"].(string)[1:]].(bson.M)
+				}
+			case "$group":
+				var grouped []bson.M
+				index := make(map[interface{}]int)
+				for _, doc := range docs {
+					key := doc[arg.(bson.M)["_id"].(string)[1:]]
+					i, ok := index[key]
+					if !ok {
+						i = len(grouped)
+						index[key] = i
+						grouped = append(grouped, bson.M{"_id": key, "paths": 0})
+					}
+					grouped[i]["paths"] = grouped[i]["paths"].(int) + 1
+				}
+				docs = grouped
+			case "$project":
+			default:
+				panic("unexpected stage " + op)
+			}
+		}
+	}
+	c := &fakeCursor{}
+	for _, doc := range docs {
+		c.docs = append(c.docs, joinDoc{Name: doc["_id"].(string), Paths: doc["paths"].(int)})
+	}
+	return c
+}
+
+// match returns the docs matching the kinds of constraint the store makes.
+func (f *fakeTriples) match(m bson.M, docs []bson.M) []bson.M {
+	var matched []bson.M
+next:
+	for _, doc := range docs {
+		for k, v := range m {
+			switch v := v.(type) {
+			case bson.M:
+				if in, ok := v["$in"]; ok {
+					found := false
+					for _, s := range in.([]string) {
+						found = found || doc[k] == s
+					}
+					if !found {
+						continue next
+					}
+				}
+				if ne, ok := v["$ne"]; ok && doc[k] == ne {
+					continue next
+				}
+			default:
+				if doc[k] != v {
+					continue next
+				}
+			}
+		}
+		matched = append(matched, doc)
+	}
+	return matched
+}
+
+type fakeCursor struct {
+	docs []joinDoc
+}
+
+func (c *fakeCursor) Next(result interface{}) bool {
+	if len(c.docs) == 0 {
+		return false
+	}
+	*result.(*joinDoc) = c.docs[0]
+	c.docs = c.docs[1:]
+	return true
+}
+
+func (c *fakeCursor) Err() error   { return nil }
+func (c *fakeCursor) Close() error { return nil }
+
+var joinQuads = []quad.Quad{
+	{"alice", "knows", "bob", ""},
+	{"alice", "knows", "carol", ""},
+	{"alice", "knows", "dan", "work"},
+	{"alice", "name", "Alice", ""},
+	{"bob", "name", "Bob", ""},
+	{"bob", "name", "Robert", ""},
+	{"carol", "name", "Carol", ""},
+	{"carol", "knows", "alice", ""},
+	{"dan", "likes", "carol", ""},
+	{"erin", "knows", "bob", ""},
+	{"frank", "knows", "carol", ""},
+}
+
+// nested returns the names that nested iterators over a memstore find
+// from starts through the predicates first and second, as Gremlin's
+// Out(first).Out(second) builds them.
+func nested(starts []string, first, second string) []string {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	ts.AddTripleSet(joinQuads)
+	out := func(from graph.Iterator, pred string) graph.Iterator {
+		fixed := ts.FixedIterator()
+		fixed.Add(ts.ValueOf(pred))
+		and := iterator.NewAnd()
+		and.AddSubIterator(iterator.NewLinksTo(ts, fixed, quad.Predicate))
+		and.AddSubIterator(iterator.NewLinksTo(ts, from, quad.Subject))
+		return iterator.NewHasA(ts, and, quad.Object)
+	}
+	fixed := ts.FixedIterator()
+	for _, s := range starts {
+		fixed.Add(ts.ValueOf(s))
+	}
+	return allNames(ts, out(out(fixed, first), second))
+}
+
+func allNames(ts graph.TripleStore, it graph.Iterator) []string {
+	var names []string
+	for graph.Next(it) {
+		names = append(names, ts.NameOf(it.Result()))
+		for it.NextPath() {
+			names = append(names, ts.NameOf(it.Result()))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestJoinIterator(t *testing.T) {
+	defer func(a func(*TripleStore, []bson.M) cursor) { aggregate = a }(aggregate)
+
+	for _, test := range []struct {
+		starts        []string
+		first, second string
+	}{
+		{starts: []string{"alice"}, first: "knows", second: "name"},
+		{starts: []string{"alice", "erin"}, first: "knows", second: "name"},
+		{starts: []string{"alice", "frank"}, first: "knows", second: "knows"},
+		{starts: []string{"bob"}, first: "knows", second: "name"},
+	} {
+		qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(100)}
+		f := newFakeTriples(qs, joinQuads)
+		aggregate = f.aggregate
+		qs.idCache = NewIDLru(100)
+
+		it := NewJoinIterator(qs, test.starts, test.first, test.second, 0)
+		got := allNames(qs, it)
+		expect := nested(test.starts, test.first, test.second)
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected join of %v -%s-> -%s->, got:%v expect:%v", test.starts, test.first, test.second, got, expect)
+		}
+		if f.queries != 1 {
+			t.Errorf("Unexpected number of aggregations for %v, got:%d expect:1", test.starts, f.queries)
+		}
+
+		it.Reset()
+		if again := allNames(qs, it); !reflect.DeepEqual(again, got) {
+			t.Errorf("Unexpected join after reset, got:%v expect:%v", again, got)
+		}
+	}
+}
+
+func TestJoinIteratorContains(t *testing.T) {
+	defer func(a func(*TripleStore, []bson.M) cursor) { aggregate = a }(aggregate)
+
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(100)}
+	aggregate = newFakeTriples(qs, joinQuads).aggregate
+	it := NewJoinIterator(qs, []string{"alice"}, "knows", "name", 0)
+	for _, test := range []struct {
+		name   string
+		expect bool
+	}{
+		{"Bob", true},
+		{"Robert", true},
+		{"Carol", true},
+		{"Alice", false},
+		{"carol", false},
+	} {
+		if got := it.Contains(qs.ValueOf(test.name)); got != test.expect {
+			t.Errorf("Unexpected result checking %q, got:%t expect:%t", test.name, got, test.expect)
+		}
+	}
+}
+
+func TestJoinIteratorSoftDelete(t *testing.T) {
+	defer func(a func(*TripleStore, []bson.M) cursor) { aggregate = a }(aggregate)
+
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(100), softDelete: true}
+	f := newFakeTriples(qs, joinQuads)
+	aggregate = f.aggregate
+	for _, doc := range f.triples {
+		if doc["Object"] == "Robert" || doc["Object"] == "carol" {
+			doc[deletedField] = true
+		}
+	}
+	got := allNames(qs, NewJoinIterator(qs, []string{"alice"}, "knows", "name", 0))
+	if expect := []string{"Bob"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected join over deleted triples, got:%v expect:%v", got, expect)
+	}
+}
+
+// fixedOn builds a mongo iterator over the triples with the named node in
+// direction d, without asking a server for its size.
+func fixedOn(qs *TripleStore, d quad.Direction, name string) *Iterator {
+	return &Iterator{
+		uid:        iterator.NextUID(),
+		qs:         qs,
+		dir:        d,
+		name:       name,
+		hash:       qs.ConvertStringToByteHash(name),
+		collection: "triples",
+		size:       3,
+		limit:      -1,
+		iter:       &fakeCursor{},
+	}
+}
+
+func TestOptimizeJoin(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(100)}
+	for _, name := range []string{"alice", "erin"} {
+		qs.idCache.Put(qs.ConvertStringToByteHash(name), name)
+	}
+	// A from iterator over triples is taken as the triples the hop
+	// follows, as an optimized LinksTo from a single node is.
+	out := func(from graph.Iterator, pred string) *iterator.HasA {
+		if _, ok := from.(*Iterator); !ok {
+			from = iterator.NewLinksTo(qs, from, quad.Subject)
+		}
+		and := iterator.NewAnd()
+		and.AddSubIterator(fixedOn(qs, quad.Predicate, pred))
+		and.AddSubIterator(from)
+		return iterator.NewHasA(qs, and, quad.Object)
+	}
+	starts := func(names ...string) graph.Iterator {
+		fixed := qs.FixedIterator()
+		for _, name := range names {
+			fixed.Add(qs.ConvertStringToByteHash(name))
+		}
+		return fixed
+	}
+	tag := func(it graph.Iterator) graph.Iterator {
+		it.Tagger().Add("x")
+		return it
+	}
+	many := make([]string, maxJoinStarts+1)
+	for i := range many {
+		many[i] = fmt.Sprint(i)
+	}
+
+	for _, test := range []struct {
+		message string
+		it      *iterator.HasA
+		starts  []string
+	}{
+		{
+			message: "join from one start",
+			it:      out(out(fixedOn(qs, quad.Subject, "alice"), "knows"), "name"),
+			starts:  []string{"alice"},
+		},
+		{
+			message: "join from fixed starts",
+			it:      out(out(starts("alice", "erin"), "knows"), "name"),
+			starts:  []string{"alice", "erin"},
+		},
+		{
+			message: "not join one hop",
+			it:      out(starts("alice"), "knows"),
+		},
+		{
+			message: "not join from tagged starts",
+			it:      out(out(tag(starts("alice")), "knows"), "name"),
+		},
+		{
+			message: "not join through a tagged hop",
+			it:      out(tag(out(starts("alice"), "knows")), "name"),
+		},
+		{
+			message: "not join from too many starts",
+			it:      out(out(starts(many...), "knows"), "name"),
+		},
+	} {
+		got, ok := qs.optimizeHasA(test.it)
+		if ok != (test.starts != nil) {
+			t.Errorf("Unexpected optimization to %s, got:%t expect:%t", test.message, ok, test.starts != nil)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		join, isJoin := got.(*JoinIterator)
+		if !isJoin {
+			t.Errorf("Unexpected iterator to %s, got:%T", test.message, got)
+			continue
+		}
+		if !reflect.DeepEqual(join.starts, test.starts) || join.first != "knows" || join.second != "name" {
+			t.Errorf("Unexpected join to %s, got:%v -%s-> -%s->", test.message, join.starts, join.first, join.second)
+		}
+	}
+}
+
+// The join benchmarks follow knows then name from 50 nodes known to the
+// start, waiting 100µs for each round trip to the store. The nested
+// benchmark makes the queries that nested iterators would: one for the
+// first hop, then one for each node it reaches.
+func joinBenchmarkStore() (*TripleStore, *fakeTriples) {
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(1000)}
+	var quads []quad.Quad
+	for i := 0; i < 50; i++ {
+		friend := fmt.Sprint("friend", i)
+		quads = append(quads,
+			quad.Quad{"alice", "knows", friend, ""},
+			quad.Quad{friend, "name", fmt.Sprint("Friend ", i), ""},
+		)
+	}
+	f := newFakeTriples(qs, quads)
+	f.delay = 100 * time.Microsecond
+	return qs, f
+}
+
+func BenchmarkJoinIterator(b *testing.B) {
+	defer func(a func(*TripleStore, []bson.M) cursor) { aggregate = a }(aggregate)
+	qs, f := joinBenchmarkStore()
+	aggregate = f.aggregate
+	for i := 0; i < b.N; i++ {
+		it := NewJoinIterator(qs, []string{"alice"}, "knows", "name", 50)
+		for graph.Next(it) {
+		}
+	}
+}
+
+func BenchmarkJoinNested(b *testing.B) {
+	qs, f := joinBenchmarkStore()
+	find := func(m bson.M) []bson.M {
+		time.Sleep(f.delay)
+		return f.match(qs.live(m), f.triples)
+	}
+	for i := 0; i < b.N; i++ {
+		for _, hop := range find(bson.M{"Subject": "alice", "Predicate": "knows"}) {
+			find(bson.M{"Subject": hop["Object"], "Predicate": "name"})
+		}
+	}
+}
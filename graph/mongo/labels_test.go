@@ -0,0 +1,87 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+func TestLabelsIterator(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any}
+	names := []string{"2012", "2014"}
+	var hashes []string
+	for _, n := range names {
+		hashes = append(hashes, qs.ConvertStringToByteHash(n))
+	}
+
+	expect := bson.M{"Label": bson.M{"$in": names}}
+	if got := qs.labelsConstraint(names, hashes); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected labels constraint, got:%v expect:%v", got, expect)
+	}
+	qs.shardKey = quad.Label
+	expect[shardKeyField] = bson.M{"$in": hashes}
+	if got := qs.labelsConstraint(names, hashes); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected targeted labels constraint, got:%v expect:%v", got, expect)
+	}
+	qs.shardKey = quad.Any
+
+	// Triples split across three labels, of which the iterator has two.
+	it := &Iterator{qs: qs, collection: "triples", dir: quad.Label, labels: hashes, limit: -1}
+	for _, test := range []struct {
+		quad   quad.Quad
+		expect bool
+	}{
+		{quad.Quad{"A", "follows", "B", "2012"}, true},
+		{quad.Quad{"A", "follows", "C", "2013"}, false},
+		{quad.Quad{"A", "follows", "D", "2014"}, true},
+		{quad.Quad{"C", "follows", "D", ""}, false},
+	} {
+		h := qs.hashesFor(test.quad)
+		v := tripleValue{id: qs.idFor(h), hashes: h}
+		if got := it.Contains(v); got != test.expect {
+			t.Errorf("Unexpected containment of %v, got:%t expect:%t", test.quad, got, test.expect)
+		}
+	}
+}
+
+func TestOptimizeLabelsError(t *testing.T) {
+	defer func(c func(*TripleStore, string, bson.M) (int, error)) { countQuery = c }(countQuery)
+	countQuery = func(*TripleStore, string, bson.M) (int, error) { return 0, errors.New("no server") }
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any, idCache: NewIDLru(10)}
+	fixed := iterator.NewFixedIteratorWithCompare(iterator.BasicEquality)
+	for _, name := range []string{"2012", "2014"} {
+		h := qs.ValueOf(name)
+		qs.idCache.Put(h.(string), name)
+		fixed.Add(h)
+	}
+
+	// Labels that cannot be counted are left to the LinksTo, unread.
+	lto := iterator.NewLinksTo(qs, fixed, quad.Label)
+	if got, ok := qs.optimizeLinksTo(lto); ok || got != lto {
+		t.Errorf("Unexpected optimization of labels that cannot be counted, got:%v", got)
+	}
+	if !graph.Next(fixed) || fixed.Result() != qs.ValueOf("2012") {
+		t.Error("Failed to reset the labels of an unoptimized LinksTo")
+	}
+}
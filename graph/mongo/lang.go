@@ -0,0 +1,89 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// langField holds the language tag of the object of a triple document, in
+// lower case, if the store records languages and the object has one.
+const langField = "Lang"
+
+// langPattern returns a regular expression matching the language tags that
+// any of langs is a prefix of, as a LangMatch matches them.
+func langPattern(langs []string) string {
+	quoted := make([]string, len(langs))
+	for i, l := range langs {
+		quoted[i] = regexp.QuoteMeta(l)
+	}
+	return `^(` + strings.Join(quoted, "|") + `)(-|$)`
+}
+
+// narrowLangs narrows the iterator to the triples whose objects are in any
+// of langs, on the language recorded in each document.
+func (it *Iterator) narrowLangs(langs []string) {
+	c := newConstraint().op(langField, "$regex", langPattern(langs)).M()
+	for k, v := range it.constraint {
+		c[k] = v
+	}
+	it.constraint = c
+	it.langs = langs
+}
+
+// optimizeLangMatch narrows a single Mongo iterator over triples beneath a
+// LangMatch to the languages of its list, so that the server only returns
+// the triples the LangMatch chooses between. Languages are only recorded
+// with the record_langs option, and not at all for objects without one, so
+// a list that takes such objects is left to the LangMatch alone.
+func (qs *TripleStore) optimizeLangMatch(it *iterator.LangMatch) (graph.Iterator, bool) {
+	if !qs.recordLangs {
+		return it, false
+	}
+	for _, l := range it.Langs() {
+		if l == "" || l == iterator.AnyLang {
+			return it, false
+		}
+	}
+	m, ok := it.SubIterators()[0].(*Iterator)
+	if !ok || m.collection != "triples" || m.scan || m.langs != nil {
+		return it, false
+	}
+	sub := m.Clone().(*Iterator)
+	sub.narrowLangs(it.Langs())
+	sub.Reset()
+	newIt := iterator.NewLangMatch(sub, it.Langs(), qs)
+	newIt.Tagger().CopyFrom(it)
+	it.Close()
+	return newIt, true
+}
+
+// docLang records the language of the object of t in doc, if it has one
+// and the store records languages.
+func (qs *TripleStore) docLang(doc bson.M, t quad.Quad) {
+	if !qs.recordLangs {
+		return
+	}
+	if lang := quad.LangOf(t.Object); lang != "" {
+		doc[langField] = lang
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+func TestDocLang(t *testing.T) {
+	q := quad.Quad{"carol", "label", `"Carol"@en-GB`, ""}
+	qs := &TripleStore{hasher: sha1.New()}
+	if _, ok := qs.docFor(q)[langField]; ok {
+		t.Error("Unexpected language recorded without record_langs")
+	}
+	qs.recordLangs = true
+	if got := qs.docFor(q)[langField]; got != "en-gb" {
+		t.Errorf("Unexpected language recorded, got:%v expect:en-gb", got)
+	}
+	if _, ok := qs.docFor(quad.Quad{"dan", "label", `"Dan"`, ""})[langField]; ok {
+		t.Error("Unexpected language recorded for an untagged literal")
+	}
+}
+
+func TestLangPattern(t *testing.T) {
+	re := regexp.MustCompile(langPattern([]string{"en", "zh-hant"}))
+	for _, test := range []struct {
+		lang   string
+		expect bool
+	}{
+		{lang: "en", expect: true},
+		{lang: "en-gb", expect: true},
+		{lang: "zh-hant-tw", expect: true},
+		{lang: "eng"},
+		{lang: "zh"},
+		{lang: "fr"},
+	} {
+		if got := re.MatchString(test.lang); got != test.expect {
+			t.Errorf("Unexpected match of %q, got:%t expect:%t", test.lang, got, test.expect)
+		}
+	}
+}
+
+func TestOptimizeLangMatch(t *testing.T) {
+	defer func(o func(*Iterator) cursor, c func(*TripleStore, string, bson.M) (int, error)) {
+		openCursor, countQuery = o, c
+	}(openCursor, countQuery)
+	openCursor = func(*Iterator) cursor { return &fakeCursor{} }
+	countQuery = func(*TripleStore, string, bson.M) (int, error) { return 3, nil }
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(100), recordLangs: true}
+	qs.idCache.Put(qs.ConvertStringToByteHash("label"), "label")
+
+	for _, test := range []struct {
+		message string
+		record  bool
+		langs   []string
+		expect  bool
+	}{
+		{message: "narrow to languages", record: true, langs: []string{"en", "fr"}, expect: true},
+		{message: "not narrow to any language", record: true, langs: []string{"en", iterator.AnyLang}},
+		{message: "not narrow to untagged objects", record: true, langs: []string{"en", ""}},
+		{message: "not narrow without recorded languages", langs: []string{"en"}},
+	} {
+		qs.recordLangs = test.record
+		it := iterator.NewLangMatch(fixedOn(qs, quad.Predicate, "label"), test.langs, qs)
+		it.Tagger().Add("label")
+		got, ok := qs.optimizeLangMatch(it)
+		if ok != test.expect {
+			t.Errorf("Unexpected optimization to %s, got:%t expect:%t", test.message, ok, test.expect)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		sub, isMongo := got.SubIterators()[0].(*Iterator)
+		if got.Type() != graph.LangMatch || !isMongo {
+			t.Errorf("Unexpected iterator to %s, got:%s", test.message, got.DebugString(0))
+			continue
+		}
+		expect := bson.M{"$regex": langPattern(test.langs)}
+		if !reflect.DeepEqual(sub.constraint[langField], expect) || sub.constraint["Predicate"] != "label" {
+			t.Errorf("Unexpected constraint to %s, got:%v", test.message, sub.constraint)
+		}
+		if clone := sub.Clone().(*Iterator); !reflect.DeepEqual(clone.constraint, sub.constraint) {
+			t.Errorf("Unexpected constraint of clone to %s, got:%v expect:%v", test.message, clone.constraint, sub.constraint)
+		}
+		if tags := got.Tagger().Tags(); !reflect.DeepEqual(tags, []string{"label"}) {
+			t.Errorf("Unexpected tags to %s, got:%v", test.message, tags)
+		}
+	}
+}
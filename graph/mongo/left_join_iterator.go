@@ -0,0 +1,326 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// A LeftJoinIterator yields every node, each with the nodes it is linked
+// to by a fixed predicate, if it has any, as
+//
+//	[{"id": null, "name": null}]
+//
+// does in MQL. An iterator.LeftJoin checks each node against its optional
+// branch with queries of its own; a LeftJoinIterator has the server look
+// up the values of every node with a $lookup, in one aggregation. It needs
+// MongoDB 3.6 or later.
+//
+// Each node is yielded once, with one more path for each of its values
+// after the first. The value tags are absent from nodes with no values.
+type LeftJoinIterator struct {
+	uid       uint64
+	tags      graph.Tagger
+	valueTags graph.Tagger
+	qs        *TripleStore
+	dir       quad.Direction
+	predicate string
+	size      int64
+	iter      cursor
+	result    graph.Value
+	values    []string
+	index     int
+}
+
+// leftJoinDoc is a node and the stored names of its values.
+type leftJoinDoc struct {
+	Id     string   `bson:"_id"`
+	Name   string   `bson:"Name"`
+	Values []string `bson:"values"`
+}
+
+// NewLeftJoinIterator returns an iterator over all nodes, with the values
+// of each: the nodes in the direction opposite d of the triples with the
+// predicate and the node in direction d, which is either the subject or
+// the object. The number of nodes is size.
+func NewLeftJoinIterator(qs *TripleStore, d quad.Direction, predicate string, size int64) *LeftJoinIterator {
+	return &LeftJoinIterator{
+		uid:       iterator.NextUID(),
+		qs:        qs,
+		dir:       d,
+		predicate: predicate,
+		size:      size,
+	}
+}
+
+// lookupNodes returns a cursor over the results of pipeline on the nodes
+// collection, which may spill to disk on the server.
+var lookupNodes = func(qs *TripleStore, pipeline []bson.M) cursor {
+	return qs.db.C("nodes").Pipe(pipeline).AllowDiskUse().Iter()
+}
+
+// pipeline returns the aggregation that looks up the values of the nodes
+// matching the node constraint, which may be nil.
+func (it *LeftJoinIterator) pipeline(node bson.M) []bson.M {
+	field, other := "Subject", "Object"
+	if it.dir == quad.Object {
+		field, other = other, field
+	}
+	values := it.qs.constraintFor(quad.Predicate, it.predicate, it.qs.ConvertStringToByteHash(it.predicate))
+	values["$expr"] = bson.M{"$eq": []interface{}{"$" + field, "$$node"}}
+	var stages []bson.M
+	if node != nil {
+		stages = append(stages, bson.M{"$match": node})
+	}
+	return append(stages,
+		bson.M{"$lookup": bson.M{
+			"from": "triples",
+			"let":  bson.M{"node": "$Name"},
+			"pipeline": []bson.M{
+				{"$match": it.qs.live(values)},
+				{"$project": bson.M{"value": "$" + other}},
+			},
+			"as": "values",
+		}},
+		bson.M{"$project": bson.M{"Name": 1, "values": "$values.value"}},
+	)
+}
+
+func (it *LeftJoinIterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *LeftJoinIterator) Reset() {
+	it.Close()
+	it.iter = nil
+	it.result = nil
+	it.values = nil
+	it.index = 0
+}
+
+func (it *LeftJoinIterator) Close() {
+	if it.iter != nil {
+		it.iter.Close()
+	}
+}
+
+func (it *LeftJoinIterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+// TagResults tags the node, and its current value, if it has any.
+func (it *LeftJoinIterator) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	if it.index >= len(it.values) {
+		return
+	}
+	value := it.qs.hashOfStored(it.values[it.index])
+	for _, tag := range it.valueTags.Tags() {
+		dst[tag] = value
+	}
+
+	for tag, value := range it.valueTags.Fixed() {
+		dst[tag] = value
+	}
+}
+
+func (it *LeftJoinIterator) Clone() graph.Iterator {
+	m := NewLeftJoinIterator(it.qs, it.dir, it.predicate, it.size)
+	m.tags.CopyFrom(it)
+	for _, tag := range it.valueTags.Tags() {
+		m.valueTags.Add(tag)
+	}
+	for k, v := range it.valueTags.Fixed() {
+		m.valueTags.AddFixed(k, v)
+	}
+	return m
+}
+
+func (it *LeftJoinIterator) Next() bool {
+	graph.NextLogIn(it)
+	if it.qs.cancelled() {
+		if it.iter != nil {
+			it.iter.Close()
+			it.iter = stopped{}
+		}
+		return graph.NextLogOut(it, nil, false)
+	}
+	if it.iter == nil {
+		it.qs.roundTrip()
+		it.iter = lookupNodes(it.qs, it.pipeline(nil))
+	}
+	var doc leftJoinDoc
+	if !it.iter.Next(&doc) {
+		if err := it.iter.Err(); err != nil {
+			glog.Errorln("Error Nexting LeftJoinIterator: ", err)
+		}
+		return graph.NextLogOut(it, nil, false)
+	}
+	it.found(doc)
+	return graph.NextLogOut(it, it.result, true)
+}
+
+// found makes the node of doc the result, keeping its name and the names
+// of its values, which the lookup has already read.
+func (it *LeftJoinIterator) found(doc leftJoinDoc) {
+	it.qs.idCache.Put(doc.Id, doc.Name)
+	for _, v := range doc.Values {
+		it.qs.idCache.Put(it.qs.hashOfStored(v), v)
+	}
+	it.result = doc.Id
+	it.values = doc.Values
+	it.index = 0
+}
+
+func (it *LeftJoinIterator) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *LeftJoinIterator) Result() graph.Value {
+	return it.result
+}
+
+// NextPath yields the node again for each of its other values.
+func (it *LeftJoinIterator) NextPath() bool {
+	if it.index+1 >= len(it.values) {
+		return false
+	}
+	it.index++
+	return true
+}
+
+func (it *LeftJoinIterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+// Contains checks whether val is a node, looking up its values with the
+// same aggregation narrowed to it.
+func (it *LeftJoinIterator) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	hash, err := literal(val)
+	if err != nil {
+		glog.Errorf("Error: %v for value %v", err, val)
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.qs.roundTrip()
+	c := lookupNodes(it.qs, it.pipeline(bson.M{"_id": hash}))
+	var doc leftJoinDoc
+	found := c.Next(&doc)
+	if err := c.Close(); err != nil {
+		glog.Errorln("Error checking LeftJoinIterator: ", err)
+		return graph.ContainsLogOut(it, val, false)
+	}
+	if !found {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.found(doc)
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *LeftJoinIterator) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
+
+// Size returns the number of nodes, each of which is yielded.
+func (it *LeftJoinIterator) Size() (int64, bool) {
+	return it.size, true
+}
+
+// Stats estimates the costs of the iterator: each result is read from the
+// same cursor, and each check is an aggregation of its own.
+func (it *LeftJoinIterator) Stats() graph.IteratorStats {
+	return graph.IteratorStats{
+		ContainsCost: queryCost,
+		NextCost:     indexCost,
+		Size:         it.size,
+	}
+}
+
+var mongoLeftJoinType graph.Type
+
+func init() {
+	mongoLeftJoinType = graph.RegisterIterator("mongo_left_join")
+}
+
+func (it *LeftJoinIterator) Type() graph.Type {
+	return mongoLeftJoinType
+}
+
+func (it *LeftJoinIterator) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s size:%d %s ?-%s->)", strings.Repeat(" ", indent), it.Type(), it.size, it.dir, it.predicate)
+}
+
+// optimizeLeftJoin replaces a left join of all nodes with the nodes each
+// is linked to by a fixed predicate, with no tags or label scope along the
+// way but on those nodes, with a LeftJoinIterator.
+func (qs *TripleStore) optimizeLeftJoin(it *iterator.LeftJoin) (graph.Iterator, bool) {
+	subs := it.SubIterators()
+	primary, ok := subs[0].(*Iterator)
+	if !ok || !primary.allNodes() {
+		return it, false
+	}
+	hasa, ok := subs[1].(*iterator.HasA)
+	if !ok || tagged(hasa) {
+		return it, false
+	}
+	var other quad.Direction
+	switch hasa.Direction() {
+	case quad.Subject:
+		other = quad.Object
+	case quad.Object:
+		other = quad.Subject
+	default:
+		return it, false
+	}
+	pred, hop, _, ok := fixedPredicateAnd(hasa.SubIterators()[0])
+	if !ok {
+		return it, false
+	}
+	lto, ok := hop.(*iterator.LinksTo)
+	if !ok || lto.Direction() != other || tagged(lto) {
+		return it, false
+	}
+	values, ok := lto.SubIterators()[0].(*Iterator)
+	if !ok || !values.allNodes() {
+		return it, false
+	}
+	size, _ := primary.Size()
+	newIt := NewLeftJoinIterator(qs, hasa.Direction(), pred, size)
+	newIt.tags.CopyFrom(it)
+	newIt.tags.CopyFrom(primary)
+	newIt.valueTags.CopyFrom(values)
+	it.Close()
+	return newIt, true
+}
+
+// allNodes returns whether the iterator is over every node.
+func (it *Iterator) allNodes() bool {
+	return it.collection == "nodes" && it.isAll && !it.windowed() && !it.scan
+}
@@ -0,0 +1,251 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"sort"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// lookupNodes simulates the nodes collection of the triples of f, running
+// the stages of an aggregation that LeftJoinIterator uses.
+func (f *fakeTriples) lookupNodes(qs *TripleStore, pipeline []bson.M) cursor {
+	f.queries++
+	var nodes []bson.M
+	seen := make(map[string]bool)
+	for _, doc := range f.triples {
+		for _, k := range []string{"Subject", "Predicate", "Object", "Label"} {
+			name, _ := doc[k].(string)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			nodes = append(nodes, bson.M{"_id": qs.ConvertStringToByteHash(name), "Name": name})
+		}
+	}
+	c := &leftJoinCursor{}
+	for _, stage := range pipeline {
+		for op, arg := range stage {
+			switch op {
+			case "$match":
+				nodes = f.match(arg.(bson.M), nodes)
+			case "$lookup":
+				inner := arg.(bson.M)["pipeline"].([]bson.M)
+				field := inner[0]["$match"].(bson.M)["$expr"].(bson.M)["$eq"].([]interface{})[0].(string)[1:]
+				other := inner[1]["$project"].(bson.M)["value"].(string)[1:]
+				for _, node := range nodes {
+					m := bson.M{field: node["Name"]}
+					for k, v := range inner[0]["$match"].(bson.M) {
+						if k != "$expr" {
+							m[k] = v
+						}
+					}
+					doc := leftJoinDoc{Id: node["_id"].(string), Name: node["Name"].(string)}
+					for _, t := range f.match(m, f.triples) {
+						doc.Values = append(doc.Values, t[other].(string))
+					}
+					c.docs = append(c.docs, doc)
+				}
+			case "$project":
+			default:
+				panic("unexpected stage " + op)
+			}
+		}
+	}
+	return c
+}
+
+type leftJoinCursor struct {
+	docs []leftJoinDoc
+}
+
+func (c *leftJoinCursor) Next(result interface{}) bool {
+	if len(c.docs) == 0 {
+		return false
+	}
+	*result.(*leftJoinDoc) = c.docs[0]
+	c.docs = c.docs[1:]
+	return true
+}
+
+func (c *leftJoinCursor) Err() error   { return nil }
+func (c *leftJoinCursor) Close() error { return nil }
+
+// leftJoinRows returns the rows of it, each the names of its tags joined
+// with its node, sorted.
+func leftJoinRows(ts graph.TripleStore, it graph.Iterator) []string {
+	var rows []string
+	row := func() {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		var keys []string
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		r := ts.NameOf(it.Result())
+		for _, k := range keys {
+			r += " " + k + "=" + ts.NameOf(tags[k])
+		}
+		rows = append(rows, r)
+	}
+	for graph.Next(it) {
+		row()
+		for it.NextPath() {
+			row()
+		}
+	}
+	sort.Strings(rows)
+	return rows
+}
+
+// nestedLeftJoin returns the rows a left join of all nodes with the nodes
+// each names through pred in direction d finds over a memstore.
+func nestedLeftJoin(d quad.Direction, pred string) []string {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	ts.AddTripleSet(joinQuads)
+	fixed := ts.FixedIterator()
+	fixed.Add(ts.ValueOf(pred))
+	values := ts.NodesAllIterator()
+	values.Tagger().Add("value")
+	and := iterator.NewAnd()
+	and.AddSubIterator(iterator.NewLinksTo(ts, fixed, quad.Predicate))
+	and.AddSubIterator(iterator.NewLinksTo(ts, values, opposite(d)))
+	it := iterator.NewLeftJoin(ts, ts.NodesAllIterator(), iterator.NewHasA(ts, and, d))
+	it.Tagger().Add("id")
+	return leftJoinRows(ts, it)
+}
+
+func opposite(d quad.Direction) quad.Direction {
+	if d == quad.Subject {
+		return quad.Object
+	}
+	return quad.Subject
+}
+
+func TestLeftJoinIterator(t *testing.T) {
+	defer func(l func(*TripleStore, []bson.M) cursor) { lookupNodes = l }(lookupNodes)
+
+	for _, test := range []struct {
+		dir  quad.Direction
+		pred string
+	}{
+		{dir: quad.Subject, pred: "name"},
+		{dir: quad.Subject, pred: "knows"},
+		{dir: quad.Object, pred: "knows"},
+	} {
+		qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(100)}
+		f := newFakeTriples(qs, joinQuads)
+		lookupNodes = f.lookupNodes
+
+		it := NewLeftJoinIterator(qs, test.dir, test.pred, 0)
+		it.tags.Add("id")
+		it.valueTags.Add("value")
+		got := leftJoinRows(qs, it)
+		expect := nestedLeftJoin(test.dir, test.pred)
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected left join of %s %s, got:%v expect:%v", test.dir, test.pred, got, expect)
+		}
+		if test.pred == "name" {
+			// Alice has one name, Bob two and Dan none.
+			for _, row := range []string{"alice id=alice value=Alice", "bob id=bob value=Robert", "dan id=dan"} {
+				if sort.SearchStrings(got, row) == len(got) || got[sort.SearchStrings(got, row)] != row {
+					t.Errorf("Missing row %q from left join, got:%v", row, got)
+				}
+			}
+		}
+		if f.queries != 1 {
+			t.Errorf("Unexpected number of aggregations for %s %s, got:%d expect:1", test.dir, test.pred, f.queries)
+		}
+
+		for _, node := range []string{"dan", "bob"} {
+			if !it.Contains(qs.ValueOf(node)) {
+				t.Errorf("Failed to contain %q", node)
+			}
+		}
+		if it.Contains(qs.ValueOf("zoe")) {
+			t.Error("Unexpectedly contained a missing node")
+		}
+	}
+}
+
+func TestOptimizeLeftJoin(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(100)}
+	nodes := func(tags ...string) *Iterator {
+		it := &Iterator{uid: iterator.NextUID(), qs: qs, collection: "nodes", isAll: true, size: 8, limit: -1, iter: &fakeCursor{}}
+		for _, tag := range tags {
+			it.tags.Add(tag)
+		}
+		return it
+	}
+	optional := func(d quad.Direction, values graph.Iterator) graph.Iterator {
+		and := iterator.NewAnd()
+		and.AddSubIterator(fixedOn(qs, quad.Predicate, "name"))
+		and.AddSubIterator(iterator.NewLinksTo(qs, values, opposite(d)))
+		return iterator.NewHasA(qs, and, d)
+	}
+	windowed := nodes()
+	windowed.limit = 3
+
+	for _, test := range []struct {
+		message string
+		it      *iterator.LeftJoin
+		expect  bool
+	}{
+		{
+			message: "join all nodes",
+			it:      iterator.NewLeftJoin(qs, nodes(), optional(quad.Subject, nodes("name"))),
+			expect:  true,
+		},
+		{
+			message: "join all nodes to their subjects",
+			it:      iterator.NewLeftJoin(qs, nodes(), optional(quad.Object, nodes("name"))),
+			expect:  true,
+		},
+		{
+			message: "not join a window of nodes",
+			it:      iterator.NewLeftJoin(qs, windowed, optional(quad.Subject, nodes("name"))),
+		},
+		{
+			message: "not join to fixed values",
+			it:      iterator.NewLeftJoin(qs, nodes(), optional(quad.Subject, qs.FixedIterator())),
+		},
+	} {
+		got, ok := qs.optimizeLeftJoin(test.it)
+		if ok != test.expect {
+			t.Errorf("Unexpected optimization to %s, got:%t expect:%t", test.message, ok, test.expect)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		join, isJoin := got.(*LeftJoinIterator)
+		if !isJoin {
+			t.Errorf("Unexpected iterator to %s, got:%T", test.message, got)
+			continue
+		}
+		if join.predicate != "name" || !reflect.DeepEqual(join.valueTags.Tags(), []string{"name"}) {
+			t.Errorf("Unexpected left join to %s, got:%s tags:%v", test.message, join.predicate, join.valueTags.Tags())
+		}
+	}
+}
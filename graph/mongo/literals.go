@@ -0,0 +1,169 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// literalPrefix begins the stored name of a node whose name is kept in
+// GridFS, followed by the node's hash, which is the _id of its file.
+const literalPrefix = "\x00gridfs:"
+
+// externalLiteralsFrom returns the length over which names are kept in
+// GridFS, or 0 if none are.
+func externalLiteralsFrom(options graph.Options) int {
+	if n, ok := options.IntKey("external_literal_bytes"); ok && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// A literalFS holds the names too large to be kept in documents, by the
+// hash of each.
+type literalFS interface {
+	put(id string, name string) error
+	get(id string) (string, error)
+	remove(id string) error
+}
+
+// literalsOf returns the literals of the store, kept in its GridFS.
+var literalsOf = func(qs *TripleStore) literalFS {
+	return gridLiterals{qs.db.GridFS("literals")}
+}
+
+type gridLiterals struct {
+	fs *mgo.GridFS
+}
+
+func (g gridLiterals) put(id string, name string) error {
+	f, err := g.fs.Create("")
+	if err != nil {
+		return err
+	}
+	f.SetId(id)
+	if _, err := f.Write([]byte(name)); err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if mgo.IsDup(err) {
+		// The name is already held.
+		return nil
+	}
+	return err
+}
+
+func (g gridLiterals) get(id string) (string, error) {
+	f, err := g.fs.OpenId(id)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	return string(b), err
+}
+
+func (g gridLiterals) remove(id string) error {
+	return g.fs.RemoveId(id)
+}
+
+// external returns whether name is too long to be kept in documents.
+func (qs *TripleStore) external(name string) bool {
+	return qs.externalAt > 0 && len(name) > qs.externalAt
+}
+
+// storedName returns the name written to documents for a node named name:
+// the name itself, or a reference to it in GridFS if it is too long.
+func (qs *TripleStore) storedName(name string) string {
+	if !qs.external(name) {
+		return name
+	}
+	return literalPrefix + qs.ConvertStringToByteHash(name)
+}
+
+// hashOfStored returns the hash of the node whose name is stored as stored,
+// without reading a name kept in GridFS.
+func (qs *TripleStore) hashOfStored(stored string) string {
+	if strings.HasPrefix(stored, literalPrefix) {
+		return stored[len(literalPrefix):]
+	}
+	return qs.ConvertStringToByteHash(stored)
+}
+
+// resolveName returns the name stored as stored, reading it from GridFS if
+// it is kept there. Names so read are not cached, as they are large.
+func (qs *TripleStore) resolveName(stored string) string {
+	if !strings.HasPrefix(stored, literalPrefix) {
+		return stored
+	}
+	qs.roundTrip()
+	name, err := literalsOf(qs).get(stored[len(literalPrefix):])
+	if err != nil {
+		glog.Errorf("Error: Couldn't retrieve literal %s %v", stored[len(literalPrefix):], err)
+	}
+	return name
+}
+
+// resolveNames resolves each of names in place, and returns them.
+func (qs *TripleStore) resolveNames(names []string) []string {
+	for i, name := range names {
+		names[i] = qs.resolveName(name)
+	}
+	return names
+}
+
+// putLiterals writes the names of t that are too long to be kept in
+// documents to GridFS.
+func (qs *TripleStore) putLiterals(t quad.Quad) error {
+	for d := quad.Subject; d <= quad.Label; d++ {
+		name := t.Get(d)
+		if !qs.external(name) {
+			continue
+		}
+		if err := literalsOf(qs).put(qs.ConvertStringToByteHash(name), name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeLiteral removes the name of a node that is no longer used from
+// GridFS, if it is kept there.
+func (qs *TripleStore) removeLiteral(name string) {
+	if !qs.external(name) {
+		return
+	}
+	if err := literalsOf(qs).remove(qs.ConvertStringToByteHash(name)); err != nil && err != mgo.ErrNotFound {
+		glog.Errorf("Error: %v while removing literal of node %s", err, qs.ConvertStringToByteHash(name))
+	}
+}
+
+// quadOf returns the triple whose names are stored as given.
+func (qs *TripleStore) quadOf(subject, predicate, object, label string) quad.Quad {
+	return quad.Quad{
+		qs.resolveName(subject),
+		qs.resolveName(predicate),
+		qs.resolveName(object),
+		qs.resolveName(label),
+	}
+}
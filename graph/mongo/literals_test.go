@@ -0,0 +1,115 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// memLiterals holds literals in memory, counting reads, as GridFS would.
+type memLiterals struct {
+	files map[string]string
+	reads int
+}
+
+func (m *memLiterals) put(id string, name string) error {
+	m.files[id] = name
+	return nil
+}
+
+func (m *memLiterals) get(id string) (string, error) {
+	m.reads++
+	name, ok := m.files[id]
+	if !ok {
+		return "", mgo.ErrNotFound
+	}
+	return name, nil
+}
+
+func (m *memLiterals) remove(id string) error {
+	if _, ok := m.files[id]; !ok {
+		return mgo.ErrNotFound
+	}
+	delete(m.files, id)
+	return nil
+}
+
+func TestExternalLiterals(t *testing.T) {
+	defer func(l func(*TripleStore) literalFS) { literalsOf = l }(literalsOf)
+	fs := &memLiterals{files: make(map[string]string)}
+	literalsOf = func(*TripleStore) literalFS { return fs }
+
+	if got := externalLiteralsFrom(graph.Options{"external_literal_bytes": 1024.0}); got != 1024 {
+		t.Errorf("Unexpected external literal threshold, got:%d expect:1024", got)
+	}
+
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any, idCache: NewIDLru(10), externalAt: 1 << 20}
+	big := strings.Repeat("a long literal ", 4<<20/15)
+	q := quad.Quad{"alice", "wrote", big, ""}
+
+	// The triple document holds a reference in place of the literal.
+	if err := qs.putLiterals(q); err != nil {
+		t.Fatalf("Failed to write literals: %v", err)
+	}
+	doc := qs.docFor(q)
+	stored := doc["Object"].(string)
+	if len(stored) > 100 || doc["Subject"] != "alice" {
+		t.Errorf("Unexpected names in triple document, got:%q %q", doc["Subject"], stored)
+	}
+	hash := qs.ConvertStringToByteHash(big)
+	if len(fs.files) != 1 || fs.files[hash] != big {
+		t.Errorf("Unexpected literals in GridFS, got:%d", len(fs.files))
+	}
+	if got := qs.hashOfStored(stored); got != hash {
+		t.Errorf("Unexpected hash of stored literal, got:%s expect:%s", got, hash)
+	}
+	if got := qs.constraintFor(quad.Object, big, hash); got["Object"] != stored {
+		t.Errorf("Unexpected constraint on literal, got:%v", got)
+	}
+	if fs.reads != 0 {
+		t.Errorf("Unexpected reads of literals before a name is needed, got:%d", fs.reads)
+	}
+
+	// The literal is read back only when its name is needed.
+	if got := qs.quadOf(doc["Subject"].(string), doc["Predicate"].(string), stored, doc["Label"].(string)); got != q {
+		t.Errorf("Unexpected triple read back, got object of %d bytes expect:%d", len(got.Object), len(big))
+	}
+	qs.idCache.Put(hash, stored)
+	if got := qs.NameOf(hash); got != big {
+		t.Errorf("Unexpected name of literal, got %d bytes expect:%d", len(got), len(big))
+	}
+	if cached, _ := qs.idCache.Get(hash); cached != stored {
+		t.Errorf("Unexpected cached name of literal, got %d bytes", len(cached))
+	}
+	if fs.reads != 2 {
+		t.Errorf("Unexpected reads of literals, got:%d expect:2", fs.reads)
+	}
+
+	qs.removeLiteral(big)
+	if len(fs.files) != 0 {
+		t.Errorf("Unexpected literals after removal, got:%d", len(fs.files))
+	}
+	qs.externalAt = 0
+	if got := qs.storedName(big); got != big {
+		t.Errorf("Unexpected stored name without a threshold, got %d bytes", len(got))
+	}
+}
@@ -22,6 +22,9 @@ type IDLru struct {
 	cache    map[string]*list.Element
 	priority *list.List
 	maxSize  int
+
+	// Entries that are never evicted, and do not count towards maxSize.
+	pinned map[string]string
 }
 
 type KV struct {
@@ -34,6 +37,7 @@ func NewIDLru(size int) *IDLru {
 	lru.maxSize = size
 	lru.priority = list.New()
 	lru.cache = make(map[string]*list.Element)
+	lru.pinned = make(map[string]string)
 	return &lru
 }
 
@@ -49,6 +53,9 @@ func (lru *IDLru) Put(key string, value string) {
 }
 
 func (lru *IDLru) Get(key string) (string, bool) {
+	if value, ok := lru.pinned[key]; ok {
+		return value, true
+	}
 	if element, ok := lru.cache[key]; ok {
 		lru.priority.MoveToFront(element)
 		return element.Value.(KV).value, true
@@ -56,6 +63,15 @@ func (lru *IDLru) Get(key string) (string, bool) {
 	return "", false
 }
 
+// Pin puts key in the cache for good, out of reach of eviction.
+func (lru *IDLru) Pin(key string, value string) {
+	if element, ok := lru.cache[key]; ok {
+		lru.priority.Remove(element)
+		delete(lru.cache, key)
+	}
+	lru.pinned[key] = value
+}
+
 func (lru *IDLru) removeOldest() {
 	last := lru.priority.Remove(lru.priority.Back())
 	delete(lru.cache, last.(KV).key)
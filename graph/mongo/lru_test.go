@@ -0,0 +1,49 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPinnedSurviveEviction(t *testing.T) {
+	lru := NewIDLru(10)
+	lru.Put("hot", "Hot")
+	lru.Pin("hot", "Hot")
+	lru.Pin("hotter", "Hotter")
+	lru.Put("cold", "Cold")
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		lru.Put(key, key)
+	}
+
+	for key, name := range map[string]string{"hot": "Hot", "hotter": "Hotter"} {
+		if got, ok := lru.Get(key); !ok || got != name {
+			t.Errorf("Pinned %q evicted, got:%q (found %t) expect:%q", key, got, ok, name)
+		}
+	}
+	if _, ok := lru.Get("cold"); ok {
+		t.Error("Unpinned entry survived eviction")
+	}
+	if len(lru.cache) != 10 {
+		t.Errorf("Pinned entries counted towards size, got:%d expect:10", len(lru.cache))
+	}
+	// Putting a pinned key leaves it pinned.
+	lru.Put("hot", "Hot")
+	if _, ok := lru.cache["hot"]; ok {
+		t.Error("Pinned entry put back under eviction")
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/barakmich/glog"
+	"github.com/boltdb/bolt"
+
+	"github.com/google/cayley/graph"
+)
+
+// defaultNameCacheSize is the most names kept on disk, unless
+// name_cache_size says otherwise.
+const defaultNameCacheSize = 1 << 20
+
+// nameBucket holds the names of nodes, keyed by their hashes.
+var nameBucket = []byte("names")
+
+// A diskNames holds the names of nodes in a Bolt file, beneath the IDLru,
+// so that a store opened again, perhaps by a new process, need not look
+// each name up again from MongoDB. A nil *diskNames holds nothing.
+type diskNames struct {
+	db  *bolt.DB
+	max int
+
+	// The number of names held, which Bolt can only count by reading
+	// them all.
+	n int
+}
+
+// diskNamesFrom opens the cache at the path given by the name_cache_path
+// option, holding at most name_cache_size names, or returns nil if there is
+// no path.
+func diskNamesFrom(options graph.Options) (*diskNames, error) {
+	path, ok := options.StringKey("name_cache_path")
+	if !ok || path == "" {
+		return nil, nil
+	}
+	max := defaultNameCacheSize
+	if n, ok := options.IntKey("name_cache_size"); ok && n > 0 {
+		max = n
+	}
+	return openDiskNames(path, max)
+}
+
+func openDiskNames(path string, max int) (*diskNames, error) {
+	// Only one process may hold the file at a time. Another store waits for
+	// it a little, rather than for good.
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("mongo: could not open name cache %q: %v", path, err)
+	}
+	c := &diskNames{db: db, max: max}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(nameBucket)
+		if err != nil {
+			return err
+		}
+		c.n = b.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("mongo: could not open name cache %q: %v", path, err)
+	}
+	return c, nil
+}
+
+// get returns the name of the node with the given hash, if it is held.
+func (c *diskNames) get(id string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	var name []byte
+	err := c.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(nameBucket).Get([]byte(id)); v != nil {
+			// Bolt's values are only valid during the transaction.
+			name = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		glog.Errorln("Error reading name cache: ", err)
+	}
+	return string(name), name != nil
+}
+
+// put holds the names of nodes, keyed by hash, with a single write. Once
+// the cache is full, any names may make way for them; the keys are hashes,
+// so the first are as good as any.
+func (c *diskNames) put(names map[string]string) {
+	if c == nil || len(names) == 0 {
+		return
+	}
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(nameBucket)
+		var added int
+		for id := range names {
+			if b.Get([]byte(id)) == nil {
+				added++
+			}
+		}
+		if over := c.n + added - c.max; over > 0 {
+			var old [][]byte
+			cur := b.Cursor()
+			for k, _ := cur.First(); k != nil && len(old) < over; k, _ = cur.Next() {
+				if _, ok := names[string(k)]; !ok {
+					old = append(old, append([]byte{}, k...))
+				}
+			}
+			for _, k := range old {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			added -= len(old)
+		}
+		for id, name := range names {
+			if err := b.Put([]byte(id), []byte(name)); err != nil {
+				return err
+			}
+		}
+		c.n += added
+		return nil
+	})
+	if err != nil {
+		glog.Errorln("Error writing name cache: ", err)
+	}
+}
+
+// remove forgets the name of the node with the given hash, which has been
+// removed from the store.
+func (c *diskNames) remove(id string) {
+	if c == nil {
+		return
+	}
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(nameBucket)
+		if b.Get([]byte(id)) == nil {
+			return nil
+		}
+		c.n--
+		return b.Delete([]byte(id))
+	})
+	if err != nil {
+		glog.Errorln("Error writing name cache: ", err)
+	}
+}
+
+func (c *diskNames) close() {
+	if c == nil {
+		return
+	}
+	if err := c.db.Close(); err != nil {
+		glog.Errorln("Error closing name cache: ", err)
+	}
+}
+
+// cacheName caches the name of the node with the given hash, as found in
+// the nodes collection.
+func (qs *TripleStore) cacheName(id, name string) {
+	qs.idCache.Put(id, name)
+	if name != "" {
+		qs.names.put(map[string]string{id: name})
+	}
+}
+
+// forgetName drops the name of the removed node with the given hash from
+// the disk cache, so that names of nodes long gone are not carried from one
+// process to the next. As before, the IDLru may keep it until it is
+// evicted.
+func (qs *TripleStore) forgetName(id string) {
+	qs.names.remove(id)
+}
@@ -0,0 +1,100 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/cayley/graph"
+)
+
+// TestNameCacheRestart simulates a process that resolves a name, exits and
+// is started again.
+func TestNameCacheRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_names")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	options := graph.Options{"name_cache_path": filepath.Join(dir, "names.bolt")}
+
+	open := func() *TripleStore {
+		names, err := diskNamesFrom(options)
+		if err != nil {
+			t.Fatalf("Failed to open name cache: %v", err)
+		}
+		return &TripleStore{idCache: NewIDLru(10), names: names}
+	}
+
+	qs := open()
+	qs.cacheName("alice-hash", "alice")
+	qs.cacheName("bob-hash", "bob")
+	qs.names.close()
+
+	// Without a server, a name can only come from the cache.
+	qs = open()
+	if got := qs.NameOf("alice-hash"); got != "alice" {
+		t.Errorf("Unexpected name after restart, got:%q expect:%q", got, "alice")
+	}
+	names, err := qs.NamesOf([]graph.Value{"bob-hash", "alice-hash"})
+	if err != nil || names[0] != "bob" || names[1] != "alice" {
+		t.Errorf("Unexpected names after restart, got:%q (%v)", names, err)
+	}
+
+	qs.forgetName("bob-hash")
+	qs.names.close()
+
+	qs = open()
+	defer qs.names.close()
+	if name, ok := qs.names.get("bob-hash"); ok {
+		t.Errorf("Unexpected name of removed node after restart, got:%q", name)
+	}
+	if _, ok := qs.names.get("alice-hash"); !ok {
+		t.Error("Failed to keep name of node that was not removed")
+	}
+}
+
+func TestNameCacheSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_names")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := openDiskNames(filepath.Join(dir, "names.bolt"), 2)
+	if err != nil {
+		t.Fatalf("Failed to open name cache: %v", err)
+	}
+	defer c.close()
+	c.put(map[string]string{"a": "A", "b": "B"})
+	c.put(map[string]string{"b": "B"})
+	if c.n != 2 {
+		t.Errorf("Unexpected size after putting a held name, got:%d expect:2", c.n)
+	}
+	c.put(map[string]string{"c": "C"})
+	if c.n != 2 {
+		t.Errorf("Unexpected size of full cache, got:%d expect:2", c.n)
+	}
+	if name, ok := c.get("c"); !ok || name != "C" {
+		t.Errorf("Failed to hold newest name, got:%q", name)
+	}
+
+	if got, err := diskNamesFrom(graph.Options{}); got != nil || err != nil {
+		t.Errorf("Unexpected name cache without a path, got:%v %v", got, err)
+	}
+}
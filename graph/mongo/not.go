@@ -0,0 +1,104 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"github.com/barakmich/glog"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// maxNotIn is the most triples the forbidden branch of a Not may cover for
+// its nodes to be gathered ahead of the query.
+const maxNotIn = 10000
+
+// distinctValues returns the hashes of the distinct nodes in direction d of
+// the triples of m, as the server lists them.
+var distinctValues = func(m *Iterator, d quad.Direction) ([]string, error) {
+	qs := m.qs
+	qs.roundTrip()
+	var stored []string
+	err := qs.find("triples", d, m.constraint).Distinct(nameFields[d], &stored)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(stored))
+	for i, s := range stored {
+		hashes[i] = qs.hashOfStored(s)
+	}
+	return hashes, nil
+}
+
+// optimizeNot gathers the nodes of a forbidden branch over a single fixed
+// predicate, such as the subjects with an email, with one distinct query,
+// so that checking a result of the primary against the branch needs no
+// round trip to the server.
+func (qs *TripleStore) optimizeNot(it *iterator.Not) (graph.Iterator, bool) {
+	subs := it.SubIterators()
+	primary, forbidden := subs[0], subs[1]
+	hasa, ok := forbidden.(*iterator.HasA)
+	if !ok || tagged(hasa) {
+		return it, false
+	}
+	d := hasa.Direction()
+	if d != quad.Subject && d != quad.Object {
+		return it, false
+	}
+	m, ok := singlePredicate(hasa.SubIterators()[0])
+	if !ok || m.size > maxNotIn {
+		return it, false
+	}
+	hashes, err := distinctValues(m, d)
+	if err != nil {
+		glog.Errorln("Error gathering the nodes of a negated branch: ", err)
+		return it, false
+	}
+	fixed := qs.FixedIterator()
+	for _, h := range hashes {
+		fixed.Add(h)
+	}
+	newIt := iterator.NewNot(qs, primary, fixed)
+	newIt.Tagger().CopyFrom(it)
+	forbidden.Close()
+	return newIt, true
+}
+
+// singlePredicate returns the iterator over the triples with a fixed
+// predicate that it is, or that it narrows only to triples with any node
+// in another direction, so long as nothing along the way is tagged.
+func singlePredicate(it graph.Iterator) (*Iterator, bool) {
+	if m, ok := it.(*Iterator); ok && m.fixedOn(quad.Predicate) {
+		return m, true
+	}
+	_, other, _, ok := fixedPredicateAnd(it)
+	if !ok {
+		return nil, false
+	}
+	lto, ok := other.(*iterator.LinksTo)
+	if !ok || lto.Direction() == quad.Label || tagged(lto) {
+		return nil, false
+	}
+	if all, ok := lto.SubIterators()[0].(*Iterator); !ok || !all.allNodes() || tagged(all) {
+		return nil, false
+	}
+	for _, sub := range it.SubIterators() {
+		if m, ok := sub.(*Iterator); ok && m.fixedOn(quad.Predicate) {
+			return m, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,126 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+func TestOptimizeNot(t *testing.T) {
+	defer func(v func(*Iterator, quad.Direction) ([]string, error)) { distinctValues = v }(distinctValues)
+	var queries int
+	distinctValues = func(m *Iterator, d quad.Direction) ([]string, error) {
+		queries++
+		if m.name == "fails" {
+			return nil, errors.New("no server")
+		}
+		seen := make(map[string]bool)
+		var hashes []string
+		for _, q := range joinQuads {
+			if h := m.qs.ConvertStringToByteHash(q.Get(d)); q.Predicate == m.name && !seen[h] {
+				seen[h] = true
+				hashes = append(hashes, h)
+			}
+		}
+		return hashes, nil
+	}
+
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(100)}
+	people := []string{"alice", "bob", "carol", "dan", "erin", "frank"}
+	for _, name := range people {
+		qs.idCache.Put(qs.ConvertStringToByteHash(name), name)
+	}
+	nodes := func() *Iterator {
+		var ids []string
+		for _, name := range people {
+			ids = append(ids, qs.ConvertStringToByteHash(name))
+		}
+		return &Iterator{uid: iterator.NextUID(), qs: qs, collection: "nodes", isAll: true, size: int64(len(ids)), limit: -1, iter: &slowCursor{ids: ids}}
+	}
+	has := func(pred string) *iterator.HasA {
+		and := iterator.NewAnd()
+		and.AddSubIterator(fixedOn(qs, quad.Predicate, pred))
+		and.AddSubIterator(iterator.NewLinksTo(qs, nodes(), quad.Object))
+		return iterator.NewHasA(qs, and, quad.Subject)
+	}
+	tagged := has("name")
+	tagged.Tagger().Add("x")
+	large := fixedOn(qs, quad.Predicate, "name")
+	large.size = maxNotIn + 1
+
+	for _, test := range []struct {
+		message   string
+		forbidden graph.Iterator
+		expect    []string
+	}{
+		{
+			message:   "negate the subjects with a name",
+			forbidden: has("name"),
+			expect:    []string{"dan", "erin", "frank"},
+		},
+		{
+			message:   "negate the subjects of a bare predicate",
+			forbidden: iterator.NewHasA(qs, fixedOn(qs, quad.Predicate, "likes"), quad.Subject),
+			expect:    []string{"alice", "bob", "carol", "erin", "frank"},
+		},
+		{
+			message:   "not negate a tagged branch",
+			forbidden: tagged,
+		},
+		{
+			message:   "not negate a branch over too many triples",
+			forbidden: iterator.NewHasA(qs, large, quad.Subject),
+		},
+		{
+			message:   "not negate a branch that fails to gather",
+			forbidden: has("fails"),
+		},
+	} {
+		queries = 0
+		not := iterator.NewNot(qs, nodes(), test.forbidden)
+		not.Tagger().Add("id")
+		got, ok := qs.optimizeNot(not)
+		if ok != (test.expect != nil) {
+			t.Errorf("Unexpected optimization to %s, got:%t expect:%t", test.message, ok, test.expect != nil)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if queries != 1 {
+			t.Errorf("Unexpected number of distinct queries to %s, got:%d expect:1", test.message, queries)
+		}
+		if forbidden := got.SubIterators()[1]; forbidden.Type() != graph.Fixed {
+			t.Errorf("Unexpected forbidden branch to %s, got:%v", test.message, forbidden.Type())
+		}
+		if !reflect.DeepEqual(got.Tagger().Tags(), []string{"id"}) {
+			t.Errorf("Unexpected tags to %s, got:%v", test.message, got.Tagger().Tags())
+		}
+		var names []string
+		for graph.Next(got) {
+			names = append(names, qs.NameOf(got.Result()))
+		}
+		if !reflect.DeepEqual(names, test.expect) {
+			t.Errorf("Unexpected results to %s, got:%v expect:%v", test.message, names, test.expect)
+		}
+	}
+}
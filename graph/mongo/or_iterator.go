@@ -0,0 +1,145 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"strings"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// branch is the constraint of an iterator over triples with a node, or
+// one of a set of labels, in a direction.
+type branch struct {
+	dir        quad.Direction
+	hash       string
+	name       string
+	labels     []string
+	constraint bson.M
+}
+
+func (it *Iterator) branch() branch {
+	return branch{dir: it.dir, hash: it.hash, name: it.name, labels: it.labels, constraint: it.constraint}
+}
+
+// matches returns whether the node of t in the branch's direction is the
+// one, or one of those, the branch is constrained to.
+func (b branch) matches(t tripleValue) bool {
+	if b.labels == nil {
+		return t.hashes[b.dir] == b.hash
+	}
+	for _, l := range b.labels {
+		if t.hashes[quad.Label] == l {
+			return true
+		}
+	}
+	return false
+}
+
+// orBranches returns the branches of its, if every one of them is an
+// untagged Mongo iterator over some of the triples, with no window or
+// sort, that an $or query can stand in for.
+func orBranches(its []graph.Iterator) ([]branch, bool) {
+	branches := make([]branch, len(its))
+	for i, sub := range its {
+		m, ok := sub.(*Iterator)
+		if !ok || m.collection != "triples" || m.isAll || m.windowed() || m.sort != nil || m.branches != nil || tagged(m) {
+			return nil, false
+		}
+		branches[i] = m.branch()
+	}
+	return branches, true
+}
+
+// newOrIterator returns an iterator over the triples matching any of the
+// branches, found with a single $or query, or the error met sizing it.
+func newOrIterator(qs *TripleStore, branches []branch) (*Iterator, error) {
+	ors := make([]bson.M, len(branches))
+	names := make([]string, len(branches))
+	for i, b := range branches {
+		ors[i] = b.constraint
+		names[i] = b.name
+	}
+	constraint := bson.M{"$or": ors}
+
+	size, err := countQuery(qs, "triples", constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	it := qs.allocIterator()
+	*it = Iterator{
+		uid:        iterator.NextUID(),
+		name:       strings.Join(names, "|"),
+		branches:   branches,
+		constraint: constraint,
+		collection: "triples",
+		qs:         qs,
+		dir:        quad.Any,
+		size:       int64(size),
+		limit:      -1,
+	}
+	it.open()
+	return it, nil
+}
+
+// optimizeOr replaces an Or of Mongo iterators over triples with one
+// making a single $or query, and an Or of HasAs in the same direction over
+// such iterators with a HasA over one. Or iterators are offered to the
+// store only by a Union, which yields each result once, so that the
+// results the branches share, which the $or query finds only once, are not
+// missed.
+func (ts *TripleStore) optimizeOr(it *iterator.Or) (graph.Iterator, bool) {
+	subs := it.SubIterators()
+	if len(subs) < 2 || tagged(it) {
+		return it, false
+	}
+	if branches, ok := orBranches(subs); ok {
+		newIt, err := newOrIterator(ts, branches)
+		if err != nil {
+			glog.Errorln("Trouble getting size for iterator! ", err)
+			return it, false
+		}
+		it.Close()
+		return newIt, true
+	}
+
+	d := quad.Any
+	inner := make([]graph.Iterator, len(subs))
+	for i, sub := range subs {
+		h, ok := sub.(*iterator.HasA)
+		if !ok || tagged(h) || (d != quad.Any && h.Direction() != d) {
+			return it, false
+		}
+		d = h.Direction()
+		inner[i] = h.SubIterators()[0]
+	}
+	branches, ok := orBranches(inner)
+	if !ok {
+		return it, false
+	}
+	newIt, err := newOrIterator(ts, branches)
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return it, false
+	}
+	it.Close()
+	return iterator.NewHasA(ts, newIt, d), true
+}
@@ -0,0 +1,118 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"errors"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+func TestOrBranches(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any}
+	single := func(name string) *Iterator {
+		hash := qs.ConvertStringToByteHash(name)
+		return &Iterator{
+			qs:         qs,
+			collection: "triples",
+			dir:        quad.Predicate,
+			hash:       hash,
+			name:       name,
+			constraint: bson.M{"Predicate": name},
+			limit:      -1,
+		}
+	}
+
+	friend, colleague := single("friend"), single("colleague")
+	branches, ok := orBranches([]graph.Iterator{friend, colleague})
+	if !ok || len(branches) != 2 {
+		t.Fatalf("Failed to unite single constraints, got:%v", branches)
+	}
+	it := &Iterator{qs: qs, collection: "triples", dir: quad.Any, branches: branches, limit: -1}
+	for _, test := range []struct {
+		quad   quad.Quad
+		expect bool
+	}{
+		{quad.Quad{"alice", "friend", "bob", ""}, true},
+		{quad.Quad{"alice", "colleague", "carol", ""}, true},
+		{quad.Quad{"alice", "follows", "dave", ""}, false},
+	} {
+		h := qs.hashesFor(test.quad)
+		v := tripleValue{id: qs.idFor(h), hashes: h}
+		if got := it.Contains(v); got != test.expect {
+			t.Errorf("Unexpected containment of %v in the union, got:%t expect:%t", test.quad, got, test.expect)
+		}
+	}
+
+	tagged := single("follows")
+	tagged.Tagger().Add("how")
+	windowed := single("follows")
+	windowed.limitTo(10)
+	for _, test := range []struct {
+		message string
+		its     []graph.Iterator
+	}{
+		{"a tagged iterator", []graph.Iterator{friend, tagged}},
+		{"a windowed iterator", []graph.Iterator{friend, windowed}},
+		{"an iterator over every triple", []graph.Iterator{friend, &Iterator{collection: "triples", isAll: true, limit: -1}}},
+		{"an iterator over nodes", []graph.Iterator{friend, &Iterator{collection: "nodes", dir: quad.Subject, limit: -1}}},
+		{"another iterator", []graph.Iterator{friend, iterator.NewNull()}},
+	} {
+		if _, ok := orBranches(test.its); ok {
+			t.Errorf("Unexpected union of %s", test.message)
+		}
+	}
+}
+
+func TestOptimizeOrUnchanged(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any}
+	m := &Iterator{qs: qs, collection: "triples", dir: quad.Predicate, name: "friend", limit: -1}
+	for _, test := range []struct {
+		message string
+		subs    []graph.Iterator
+	}{
+		{"a single branch", []graph.Iterator{m}},
+		{"a branch that is not a Mongo iterator", []graph.Iterator{m, iterator.NewNull()}},
+		{"HasAs in different directions", []graph.Iterator{
+			iterator.NewHasA(qs, m, quad.Subject),
+			iterator.NewHasA(qs, m, quad.Object),
+		}},
+	} {
+		or := iterator.NewOr()
+		for _, sub := range test.subs {
+			or.AddSubIterator(sub)
+		}
+		if got, ok := qs.optimizeOr(or); ok || got != or {
+			t.Errorf("Unexpected optimization of an Or of %s, got:%v", test.message, got)
+		}
+	}
+
+	// Branches whose union cannot be counted are left as they are.
+	defer func(c func(*TripleStore, string, bson.M) (int, error)) { countQuery = c }(countQuery)
+	countQuery = func(*TripleStore, string, bson.M) (int, error) { return 0, errors.New("no server") }
+	colleague := &Iterator{qs: qs, collection: "triples", dir: quad.Predicate, name: "colleague", limit: -1}
+	or := iterator.NewOr()
+	or.AddSubIterator(m)
+	or.AddSubIterator(colleague)
+	if got, ok := qs.optimizeOr(or); ok || got != or {
+		t.Errorf("Unexpected optimization of an Or that cannot be counted, got:%v", got)
+	}
+}
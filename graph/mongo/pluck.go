@@ -0,0 +1,74 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// pluckSelector selects the fields of a triple document that a pluck in
+// direction d reads: its _id, the name in d, and, if the _id does not hold
+// it, the hash in d.
+func (qs *TripleStore) pluckSelector(d quad.Direction) bson.M {
+	sel := bson.M{"_id": 1, nameFields[d]: 1}
+	if qs.ids == hashedIDs {
+		sel[hashFields[d]] = 1
+	}
+	if qs.sourceTag != "" {
+		sel["Source"] = 1
+	}
+	return sel
+}
+
+// plucked keeps the name in direction d of the triple read as doc, whose
+// value is v, so that naming the plucked node needs no lookup.
+func (qs *TripleStore) plucked(v tripleValue, doc tripleDoc, d quad.Direction) {
+	var name string
+	switch d {
+	case quad.Subject:
+		name = doc.Subject
+	case quad.Predicate:
+		name = doc.Predicate
+	case quad.Object:
+		name = doc.Object
+	case quad.Label:
+		name = doc.Label
+	}
+	if name != "" {
+		qs.idCache.Put(v.hashes[d], name)
+	}
+}
+
+// optimizePluck has a single untagged Mongo iterator over triples read
+// only the plucked node of each, and its name. The values of the triples
+// then lack the nodes in other directions, so the iterator must be read
+// by the Pluck alone.
+func (qs *TripleStore) optimizePluck(it *iterator.Pluck) (graph.Iterator, bool) {
+	m, ok := it.SubIterators()[0].(*Iterator)
+	if !ok || m.collection != "triples" || m.scan || m.pluck != quad.Any || tagged(m) {
+		return it, false
+	}
+	sub := m.Clone().(*Iterator)
+	sub.pluck = it.Direction()
+	sub.Reset()
+	newIt := iterator.NewPluck(qs, sub, it.Direction())
+	newIt.Tagger().CopyFrom(it)
+	it.Close()
+	return newIt, true
+}
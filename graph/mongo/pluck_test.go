@@ -0,0 +1,144 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"sort"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// docCursor yields the given triple documents.
+type docCursor struct {
+	docs []tripleDoc
+}
+
+func (c *docCursor) Next(result interface{}) bool {
+	if len(c.docs) == 0 {
+		return false
+	}
+	*result.(*tripleDoc) = c.docs[0]
+	c.docs = c.docs[1:]
+	return true
+}
+
+func (c *docCursor) Err() error   { return nil }
+func (c *docCursor) Close() error { return nil }
+
+func TestPluck(t *testing.T) {
+	for _, ids := range []idScheme{compositeIDs, hashedIDs} {
+		qs := &TripleStore{hasher: sha1.New(), ids: ids, idCache: NewIDLru(100)}
+
+		// The documents hold only the fields a pluck of objects selects.
+		sel := qs.pluckSelector(quad.Object)
+		var docs []tripleDoc
+		var expect []string
+		for _, q := range joinQuads {
+			if q.Predicate != "knows" {
+				continue
+			}
+			doc := qs.docFor(q)
+			plucked := tripleDoc{Id: doc["_id"].(string), Object: doc["Object"].(string)}
+			if _, ok := sel["ObjectHash"]; ok {
+				plucked.ObjectHash = doc["ObjectHash"].(string)
+			}
+			docs = append(docs, plucked)
+			expect = append(expect, q.Object)
+		}
+		sort.Strings(expect)
+
+		sub := &Iterator{uid: iterator.NextUID(), qs: qs, collection: "triples", dir: quad.Predicate, limit: -1, pluck: quad.Object, iter: &docCursor{docs: docs}}
+		it := iterator.NewPluck(qs, sub, quad.Object)
+		var got []string
+		for graph.Next(it) {
+			name, ok := qs.idCache.Get(it.Result().(string))
+			if !ok {
+				t.Errorf("Name of plucked node %v not kept with %v ids", it.Result(), ids)
+			}
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected plucked objects with %v ids, got:%v expect:%v", ids, got, expect)
+		}
+	}
+}
+
+func TestPluckSelector(t *testing.T) {
+	for _, test := range []struct {
+		qs     *TripleStore
+		expect bson.M
+	}{
+		{
+			qs:     &TripleStore{},
+			expect: bson.M{"_id": 1, "Object": 1},
+		},
+		{
+			qs:     &TripleStore{ids: hashedIDs, sourceTag: "source"},
+			expect: bson.M{"_id": 1, "Object": 1, "ObjectHash": 1, "Source": 1},
+		},
+	} {
+		if got := test.qs.pluckSelector(quad.Object); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected pluck selector, got:%v expect:%v", got, test.expect)
+		}
+	}
+}
+
+func TestOptimizePluck(t *testing.T) {
+	defer func(o func(*Iterator) cursor, c func(*TripleStore, string, bson.M) (int, error)) {
+		openCursor, countQuery = o, c
+	}(openCursor, countQuery)
+	openCursor = func(*Iterator) cursor { return &fakeCursor{} }
+	countQuery = func(*TripleStore, string, bson.M) (int, error) { return 3, nil }
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, idCache: NewIDLru(100)}
+	qs.idCache.Put(qs.ConvertStringToByteHash("knows"), "knows")
+	tagged := fixedOn(qs, quad.Predicate, "knows")
+	tagged.tags.Add("triple")
+
+	for _, test := range []struct {
+		message string
+		sub     graph.Iterator
+		expect  bool
+	}{
+		{message: "pluck from triples", sub: fixedOn(qs, quad.Predicate, "knows"), expect: true},
+		{message: "not pluck from tagged triples", sub: tagged},
+		{message: "not pluck from other iterators", sub: qs.FixedIterator()},
+	} {
+		it := iterator.NewPluck(qs, test.sub, quad.Object)
+		it.Tagger().Add("id")
+		got, ok := qs.optimizePluck(it)
+		if ok != test.expect {
+			t.Errorf("Unexpected optimization to %s, got:%t expect:%t", test.message, ok, test.expect)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		sub, isMongo := got.SubIterators()[0].(*Iterator)
+		if got.Type() != graph.Pluck || !isMongo || sub.pluck != quad.Object {
+			t.Errorf("Unexpected iterator to %s, got:%s", test.message, got.DebugString(0))
+		}
+		if tags := got.Tagger().Tags(); !reflect.DeepEqual(tags, []string{"id"}) {
+			t.Errorf("Unexpected tags to %s, got:%v", test.message, tags)
+		}
+	}
+}
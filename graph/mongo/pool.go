@@ -0,0 +1,35 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build go1.3
+
+package mongo
+
+// Iterators are pooled with sync.Pool where it is available.
+
+import (
+	"sync"
+)
+
+var iterators = sync.Pool{
+	New: func() interface{} { return new(Iterator) },
+}
+
+func getIterator() *Iterator {
+	return iterators.Get().(*Iterator)
+}
+
+func putIterator(it *Iterator) {
+	iterators.Put(it)
+}
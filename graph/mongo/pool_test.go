@@ -0,0 +1,184 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// pooledQuery tags a pooled iterator over ids, as a query would, and reads
+// it to the end.
+func pooledQuery(qs *TripleStore, tag string, ids []string) (*Iterator, []string) {
+	it := qs.allocIterator()
+	*it = Iterator{qs: qs, collection: "nodes", limit: -1, iter: &slowCursor{ids: ids}}
+	it.Tagger().Add(tag)
+	var got []string
+	for it.Next() {
+		got = append(got, it.Result().(string))
+	}
+	return it, got
+}
+
+func TestIteratorPool(t *testing.T) {
+	qs := &TripleStore{poolIterators: true}
+	it, _ := pooledQuery(qs, "first", []string{"a", "b"})
+	it.Tagger().AddFixed("fixed", "a")
+	it.Close()
+	// Closing again must not hand it out twice.
+	it.Close()
+
+	for i := 0; i < 10; i++ {
+		reused := qs.allocIterator()
+		*reused = Iterator{qs: qs, collection: "nodes", limit: -1, iter: &slowCursor{}}
+		if reused.Result() != nil || len(reused.Tagger().Tags()) != 0 || len(reused.Tagger().Fixed()) != 0 || reused.released {
+			t.Errorf("Reused iterator kept the state of its last query: %+v", reused)
+		}
+		dst := make(map[string]graph.Value)
+		reused.TagResults(dst)
+		if len(dst) != 0 {
+			t.Errorf("Reused iterator tagged results of its last query: %v", dst)
+		}
+	}
+}
+
+// TestIteratorPoolRace runs queries over pooled iterators at once, each with
+// its own tag and results. Run it with -race.
+func TestIteratorPoolRace(t *testing.T) {
+	qs := &TripleStore{poolIterators: true}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			tag := string(rune('a' + g))
+			ids := []string{tag + "1", tag + "2", tag + "3"}
+			for i := 0; i < 500; i++ {
+				it, got := pooledQuery(qs, tag, ids)
+				if !reflect.DeepEqual(got, ids) || !reflect.DeepEqual(it.Tagger().Tags(), []string{tag}) {
+					t.Errorf("Query %s got results of another, got:%v tags:%v", tag, got, it.Tagger().Tags())
+					return
+				}
+				it.Close()
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// mongoIterators returns the Iterators in the tree of it.
+func mongoIterators(it graph.Iterator) []*Iterator {
+	if m, ok := it.(*Iterator); ok {
+		return []*Iterator{m}
+	}
+	var its []*Iterator
+	for _, sub := range it.SubIterators() {
+		its = append(its, mongoIterators(sub)...)
+	}
+	return its
+}
+
+// TestIteratorPoolOptimize optimizes an And of two iterators that are both
+// replaced, each closing itself before the And closes it again, so that the
+// first is back in the pool when the second's replacement is made.
+func TestIteratorPoolOptimize(t *testing.T) {
+	defer func(o func(*Iterator) cursor, c func(*TripleStore, string, bson.M) (int, error)) {
+		openCursor, countQuery = o, c
+	}(openCursor, countQuery)
+
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any, poolIterators: true}
+	var ids []string
+	for i := 0; i < 10; i++ {
+		ids = append(ids, qs.getIdForTriple(quad.Quad{fmt.Sprint("n", i), "follows", fmt.Sprint("n", i+1), ""}))
+	}
+	openCursor = func(*Iterator) cursor { return &slowCursor{ids: ids} }
+	countQuery = func(_ *TripleStore, collection string, _ bson.M) (int, error) {
+		if collection != "triples" {
+			t.Errorf("Unexpected count of %s", collection)
+		}
+		return len(ids), nil
+	}
+	follows := func() *Iterator {
+		it := qs.allocIterator()
+		*it = Iterator{qs: qs, collection: "triples", dir: quad.Predicate, hash: qs.ValueOf("follows").(string), name: "follows", size: 10, total: 10, limit: -1, iter: &slowCursor{ids: ids}}
+		return it
+	}
+
+	and := iterator.NewAnd()
+	and.AddSubIterator(follows())
+	and.AddSubIterator(follows())
+	newIt, _ := and.Optimize()
+	live := mongoIterators(newIt)
+	if len(live) == 0 {
+		t.Fatalf("Unexpected optimization of the And, got:%s", newIt.DebugString(0))
+	}
+	for _, m := range live {
+		if m.released {
+			t.Errorf("Optimized iterator was closed by the And it replaced: %s", m.DebugString(0))
+		}
+	}
+	for i := 0; i < 10; i++ {
+		reused := qs.allocIterator()
+		for _, m := range live {
+			if reused == m {
+				t.Fatalf("Pool handed out an iterator still in use: %s", m.DebugString(0))
+			}
+		}
+	}
+
+	var n int
+	for graph.Next(newIt) {
+		n++
+	}
+	if n != len(ids) {
+		t.Errorf("Unexpected number of results of the optimized And, got:%d expect:%d", n, len(ids))
+	}
+	newIt.Close()
+}
+
+// emptyCursor has no documents.
+type emptyCursor struct{}
+
+func (emptyCursor) Next(result interface{}) bool { return false }
+func (emptyCursor) Err() error                   { return nil }
+func (emptyCursor) Close() error                 { return nil }
+
+func benchmarkIterators(b *testing.B, pool bool) {
+	qs := &TripleStore{poolIterators: pool}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		it := qs.allocIterator()
+		*it = Iterator{qs: qs, collection: "nodes", limit: -1, iter: emptyCursor{}}
+		it.Next()
+		it.Close()
+	}
+}
+
+func BenchmarkIteratorsPooled(b *testing.B) {
+	benchmarkIterators(b, true)
+}
+
+func BenchmarkIteratorsUnpooled(b *testing.B) {
+	benchmarkIterators(b, false)
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+// A triple document written through a view with a source records it, so
+// that the triples of a collaborative dataset can be told apart by who
+// wrote them. A triple written again from another source keeps the source
+// it was first written from.
+
+import (
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+// sourceField holds the source a triple document was written from.
+const sourceField = "Source"
+
+// A sourceName is the source of a triple. It is the value of a source tag,
+// and is named by the store as itself, though it is not a node.
+type sourceName string
+
+// WithSource returns a view of the store that records source as the source
+// of the triples written through it.
+func (qs *TripleStore) WithSource(source string) graph.TripleStore {
+	view := *qs
+	view.source = source
+	view.isView = true
+	return &view
+}
+
+// BySource returns a read-only view of the store in which only the triples
+// written from source are found, if source is not empty, and whose
+// iterators over triples tag the source of each with tag, if tag is not
+// empty. Triples read are checked without asking the server for their
+// source again, as every triple found by a query through the view was
+// found in the triples of the source.
+func (qs *TripleStore) BySource(source, tag string) graph.TripleStore {
+	view := *qs
+	view.sourceFilter = source
+	view.sourceTag = tag
+	view.isView = true
+	return graph.ReadOnly(&view)
+}
+
+// sourced returns constraint narrowed to the triples of the source the
+// view finds, if it finds only those of one.
+func (qs *TripleStore) sourced(constraint bson.M) bson.M {
+	if qs.sourceFilter == "" {
+		return constraint
+	}
+	source := bson.M{sourceField: qs.sourceFilter}
+	if constraint == nil {
+		return source
+	}
+	return bson.M{"$and": []bson.M{constraint, source}}
+}
+
+// sourceOf returns the source the triple document with the given id was
+// written from, or the source the view finds, if there is one.
+func (qs *TripleStore) sourceOf(id string) sourceName {
+	if qs.sourceFilter != "" {
+		return sourceName(qs.sourceFilter)
+	}
+	var doc struct {
+		Source string `bson:"Source"`
+	}
+	qs.roundTrip()
+	err := qs.db.C("triples").FindId(id).Select(bson.M{sourceField: 1}).One(&doc)
+	if err != nil {
+		glog.Errorf("Error: Couldn't retrieve the source of triple %s %v", id, err)
+	}
+	return sourceName(doc.Source)
+}
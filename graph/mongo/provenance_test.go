@@ -0,0 +1,80 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestProvenance(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any, idCache: NewIDLru(10)}
+	q := quad.Quad{"alice", "owns", "doc:1", ""}
+	if _, ok := qs.writtenDoc(q)[sourceField]; ok {
+		t.Error("Unexpected source of a triple written without one")
+	}
+	for _, source := range []string{"alice", "bob"} {
+		w := qs.WithSource(source)
+		if graph.IsReadOnly(w) {
+			t.Errorf("Unexpected read-only view writing from %s", source)
+		}
+		if got := w.(*TripleStore).writtenDoc(q)[sourceField]; got != source {
+			t.Errorf("Unexpected source of a triple written from %s, got:%v", source, got)
+		}
+	}
+	if qs.source != "" {
+		t.Error("Writing from a source changed the store")
+	}
+
+	// The triples of one source are found.
+	ro := qs.BySource("alice", "")
+	if !graph.IsReadOnly(ro) {
+		t.Error("View of a source is writable")
+	}
+	view := *qs
+	view.sourceFilter = "alice"
+	if got, expect := view.live(nil), (bson.M{sourceField: "alice"}); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected constraint of a broad query, got:%v expect:%v", got, expect)
+	}
+	c := bson.M{"Predicate": "owns"}
+	expect := bson.M{"$and": []bson.M{c, {sourceField: "alice"}}}
+	if got := view.live(c); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected constraint of a predicate query, got:%v expect:%v", got, expect)
+	}
+	if got := qs.live(c); !reflect.DeepEqual(got, c) {
+		t.Errorf("Unexpected constraint of a query of every source, got:%v expect:%v", got, c)
+	}
+
+	// Sources are tagged, and named as themselves.
+	view.sourceTag = "by"
+	it := &Iterator{qs: &view, collection: "triples", source: "alice", limit: -1}
+	tags := make(map[string]graph.Value)
+	it.TagResults(tags)
+	if got := tags["by"]; got != sourceName("alice") {
+		t.Errorf("Unexpected source tag, got:%v expect:%v", got, "alice")
+	}
+	if got := view.NameOf(tags["by"]); got != "alice" {
+		t.Errorf("Unexpected name of a source, got:%q expect:%q", got, "alice")
+	}
+	if got := view.sourceOf("any"); got != "alice" {
+		t.Errorf("Unexpected source of a triple found by source, got:%q expect:%q", got, "alice")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+// defaultMaxRechecks is the number of times an iterator may ask the
+// primary about a miss, unless max_primary_rechecks says otherwise.
+const defaultMaxRechecks = 100
+
+// recheckOptionsFrom returns the time after a write for which a miss on a
+// secondary is checked again on the primary, given by the
+// primary_recheck_secs option, or zero if misses are never checked again,
+// and the most checks each iterator may make, given by
+// max_primary_rechecks.
+func recheckOptionsFrom(options graph.Options) (window time.Duration, max int) {
+	if secs, ok := options.IntKey("primary_recheck_secs"); ok && secs > 0 {
+		window = time.Duration(secs) * time.Second
+	}
+	max = defaultMaxRechecks
+	if n, ok := options.IntKey("max_primary_rechecks"); ok && n >= 0 {
+		max = n
+	}
+	return window, max
+}
+
+// writeClock records when a store last wrote. It is shared by the views
+// of the store.
+type writeClock struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (c *writeClock) wrote() {
+	c.mu.Lock()
+	c.last = now()
+	c.mu.Unlock()
+}
+
+func (c *writeClock) lastWrite() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// anyIn returns whether any triple document in db matches constraint,
+// asking whichever member of the replica set db reads from.
+var anyIn = func(db *mgo.Database, constraint bson.M) (bool, error) {
+	n, err := db.C("triples").Find(constraint).Limit(1).Count()
+	return n > 0, err
+}
+
+// exists returns whether any live triple document matches constraint.
+// When reads go to secondaries, a document written by the store a moment
+// ago may not have reached them yet, so a miss within the recheck window
+// of the last write is checked again on the primary, as long as rechecks,
+// the count of such checks already made, is below the limit. A nil
+// rechecks never checks again.
+func (qs *TripleStore) exists(constraint bson.M, rechecks *int) (bool, error) {
+	constraint = qs.live(constraint)
+	qs.roundTrip()
+	found, err := anyIn(qs.db, constraint)
+	if err != nil || found || !qs.mayRecheck(rechecks) {
+		return found, err
+	}
+	*rechecks++
+	qs.roundTrip()
+	return anyIn(qs.primary, constraint)
+}
+
+// mayRecheck returns whether a miss may be checked again on the primary.
+func (qs *TripleStore) mayRecheck(rechecks *int) bool {
+	if qs.primary == nil || rechecks == nil || *rechecks >= qs.maxRechecks {
+		return false
+	}
+	return now().Sub(qs.writes.lastWrite()) < qs.recheckWindow
+}
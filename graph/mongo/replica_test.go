@@ -0,0 +1,99 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestRecheckOptions(t *testing.T) {
+	window, max := recheckOptionsFrom(graph.Options{})
+	if window != 0 || max != defaultMaxRechecks {
+		t.Errorf("Unexpected default recheck options, got:%v %d", window, max)
+	}
+	window, max = recheckOptionsFrom(graph.Options{
+		"primary_recheck_secs": 5.0,
+		"max_primary_rechecks": 2.0,
+	})
+	if window != 5*time.Second || max != 2 {
+		t.Errorf("Unexpected recheck options, got:%v %d", window, max)
+	}
+}
+
+// TestPrimaryRecheck simulates a secondary that has not yet seen a triple
+// just written to the primary.
+func TestPrimaryRecheck(t *testing.T) {
+	defer func(f func(*mgo.Database, bson.M) (bool, error)) { anyIn = f }(anyIn)
+	defer func() { now = time.Now }()
+	clock := time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	secondary, primary := &mgo.Database{Name: "secondary"}, &mgo.Database{Name: "primary"}
+	var reads []string
+	anyIn = func(db *mgo.Database, constraint bson.M) (bool, error) {
+		reads = append(reads, db.Name)
+		return db == primary, nil
+	}
+
+	qs := &TripleStore{
+		db:            secondary,
+		primary:       primary,
+		softDelete:    true,
+		recheckWindow: time.Minute,
+		maxRechecks:   2,
+		writes:        &writeClock{},
+	}
+	newIt := func() *Iterator {
+		return &Iterator{qs: qs, collection: "triples", isAll: true, limit: -1}
+	}
+	v := tripleValue{id: "just-written"}
+
+	it := newIt()
+	if it.Contains(v) {
+		t.Error("Unexpected recheck with no recent write")
+	}
+
+	qs.writes.wrote()
+	clock = clock.Add(30 * time.Second)
+	for i := 0; i < 2; i++ {
+		if !it.Contains(v) {
+			t.Errorf("Failed to find triple on the primary after %d rechecks", i)
+		}
+	}
+	if it.Contains(v) {
+		t.Error("Unexpected recheck beyond max_primary_rechecks")
+	}
+	expect := []string{"secondary", "secondary", "primary", "secondary", "primary", "secondary"}
+	if len(reads) != len(expect) {
+		t.Fatalf("Unexpected reads, got:%v expect:%v", reads, expect)
+	}
+	for i := range reads {
+		if reads[i] != expect[i] {
+			t.Fatalf("Unexpected reads, got:%v expect:%v", reads, expect)
+		}
+	}
+
+	it = newIt()
+	clock = clock.Add(time.Minute)
+	if it.Contains(v) {
+		t.Error("Unexpected recheck after the recheck window")
+	}
+}
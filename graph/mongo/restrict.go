@@ -0,0 +1,57 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// RestrictLabels returns a read-only view of the store in which only the
+// triples with one of labels are found. Every query of the triples made
+// by the view carries the labels, so the server returns no others, and
+// checks of triples already read compare their labels, so that none found
+// through another view or store is let in.
+func (qs *TripleStore) RestrictLabels(labels []string) graph.TripleStore {
+	view := *qs
+	view.labels = append([]string{}, labels...)
+	view.isView = true
+	view.labelHashes = make(map[string]bool, len(labels))
+	for _, l := range labels {
+		view.labelHashes[qs.ConvertStringToByteHash(l)] = true
+	}
+	return graph.ReadOnly(&view)
+}
+
+// permitted returns constraint narrowed to the triples of the labels the
+// view is restricted to, if it is. The labels are matched in a clause of
+// their own, so that they never replace a constraint on the label.
+func (qs *TripleStore) permitted(constraint bson.M) bson.M {
+	if qs.labelHashes == nil {
+		return constraint
+	}
+	labels := newConstraint().in("Label", qs.labels).M()
+	if constraint == nil {
+		return labels
+	}
+	return bson.M{"$and": []bson.M{constraint, labels}}
+}
+
+// permits returns whether the view finds t.
+func (qs *TripleStore) permits(t tripleValue) bool {
+	return qs.labelHashes == nil || qs.labelHashes[t.hashes[quad.Label]]
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestRestrictLabels(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any}
+	if got := qs.live(nil); got != nil {
+		t.Errorf("Unexpected constraint of an unrestricted store, got:%v", got)
+	}
+	ro := qs.RestrictLabels([]string{"tenant:a", ""})
+	if !graph.IsReadOnly(ro) {
+		t.Error("Restricted view is writable")
+	}
+	if qs.labels != nil {
+		t.Error("Restricting a view changed the store")
+	}
+	view := *qs
+	view.labels = []string{"tenant:a", ""}
+	view.labelHashes = map[string]bool{qs.ConvertStringToByteHash("tenant:a"): true, qs.ConvertStringToByteHash(""): true}
+
+	allowed := bson.M{"Label": bson.M{"$in": []string{"tenant:a", ""}}}
+	if got := view.live(nil); !reflect.DeepEqual(got, allowed) {
+		t.Errorf("Unexpected constraint of a broad query, got:%v expect:%v", got, allowed)
+	}
+	// A constraint on the label is kept beside the allowed labels.
+	label := bson.M{"Label": "tenant:b"}
+	expect := bson.M{"$and": []bson.M{label, allowed}}
+	if got := view.live(label); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected constraint of a label query, got:%v expect:%v", got, expect)
+	}
+
+	// An iterator over every triple refuses those of other labels when
+	// checked, however they were found.
+	it := &Iterator{qs: &view, collection: "triples", isAll: true, limit: -1}
+	for _, test := range []struct {
+		quad   quad.Quad
+		expect bool
+	}{
+		{quad.Quad{"alice", "owns", "doc:1", "tenant:a"}, true},
+		{quad.Quad{"alice", "owns", "doc:2", "tenant:b"}, false},
+		{quad.Quad{"carol", "owns", "doc:4", ""}, true},
+	} {
+		h := qs.hashesFor(test.quad)
+		v := tripleValue{id: qs.idFor(h), hashes: h}
+		if got := it.Contains(v); got != test.expect {
+			t.Errorf("Unexpected containment of %v, got:%t expect:%t", test.quad, got, test.expect)
+		}
+		if got := it.BatchContains([]graph.Value{v}); got[0] != test.expect {
+			t.Errorf("Unexpected batch containment of %v, got:%t expect:%t", test.quad, got[0], test.expect)
+		}
+	}
+}
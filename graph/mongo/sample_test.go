@@ -0,0 +1,88 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+func TestSampleBy(t *testing.T) {
+	defer func(a func(*TripleStore, []bson.M) cursor) { aggregate = a }(aggregate)
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, shardKey: quad.Any}
+	var ids []string
+	for _, q := range joinQuads {
+		ids = append(ids, qs.getIdForTriple(q))
+	}
+	// The server draws the second and the fourth triples.
+	var pipeline []bson.M
+	aggregate = func(_ *TripleStore, p []bson.M) cursor {
+		pipeline = p
+		return &slowCursor{ids: []string{ids[1], ids[3]}}
+	}
+
+	m := fixedOn(qs, quad.Predicate, "follows")
+	m.constraint = bson.M{"Predicate": "follows"}
+	m.size = int64(len(ids))
+	sample := iterator.NewSample(qs, m, 2)
+	var got []string
+	for graph.Next(sample) {
+		got = append(got, sample.Result().(tripleValue).id)
+	}
+	if expect := []string{ids[1], ids[3]}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected sample, got:%v expect:%v", got, expect)
+	}
+	expect := []bson.M{
+		{"$match": bson.M{"Predicate": "follows"}},
+		{"$sample": bson.M{"size": int64(2)}},
+		{"$project": tripleSelector},
+	}
+	if !reflect.DeepEqual(pipeline, expect) {
+		t.Errorf("Unexpected sample pipeline, got:%v expect:%v", pipeline, expect)
+	}
+	if size, _ := m.Size(); size != 2 {
+		t.Errorf("Unexpected size of sampled iterator, got:%d expect:2", size)
+	}
+	for i, id := range ids {
+		if got := sample.Contains(qs.valueFor(tripleDoc{Id: id})); got != (i == 1 || i == 3) {
+			t.Errorf("Unexpected check of %v in sample, got:%t", joinQuads[i], got)
+		}
+	}
+
+	// A sampled iterator over everything no longer holds everything.
+	all := &Iterator{qs: qs, collection: "triples", isAll: true, limit: -1, iter: &fakeCursor{}}
+	if !all.SampleBy(2) || all.Type() == graph.All {
+		t.Errorf("Unexpected type of sampled iterator over all triples: %v", all.Type())
+	}
+	for _, test := range []struct {
+		message string
+		it      *Iterator
+	}{
+		{message: "nodes", it: &Iterator{qs: qs, collection: "nodes", isAll: true, limit: -1, iter: &fakeCursor{}}},
+		{message: "a window", it: &Iterator{qs: qs, collection: "triples", isAll: true, limit: 5, iter: &fakeCursor{}}},
+		{message: "a sample", it: all},
+	} {
+		if test.it.SampleBy(2) {
+			t.Errorf("Unexpected sample of %s", test.message)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+// A view of the store can be bound to the scope of a single query, so that
+// the round trips the query makes are counted, and its cursors are closed
+// as soon as it is cancelled, rather than when they are next read from.
+// Iterators keep the view they were made from, and clones are made from
+// the same view, so the cursors of clones are closed along with the rest.
+
+import (
+	"github.com/google/cayley/graph"
+)
+
+// Scope returns a view of the store bound to s.
+func (qs *TripleStore) Scope(s *graph.QueryScope) graph.TripleStore {
+	view := *qs
+	view.scope = s
+	view.isView = true
+	return &view
+}
+
+// roundTrip counts a round trip to the server against the query the store
+// is scoped to, if any.
+func (qs *TripleStore) roundTrip() {
+	if qs.scope != nil {
+		qs.scope.RoundTrip()
+	}
+}
+
+// cancelled returns whether the query the store is scoped to has been
+// cancelled.
+func (qs *TripleStore) cancelled() bool {
+	return qs.scope != nil && qs.scope.Cancelled()
+}
+
+// done returns a channel that is closed once the query the store is scoped
+// to is cancelled, or nil, which is never ready, if it is not scoped.
+func (qs *TripleStore) done() <-chan struct{} {
+	if qs.scope == nil {
+		return nil
+	}
+	return qs.scope.Done()
+}
+
+// watch arranges for c to be closed as soon as the query the store is
+// scoped to is cancelled, returning the function that stops it being. The
+// cursor may be in use by its iterator when it is closed, which mgo allows.
+func (qs *TripleStore) watch(c cursor) func() {
+	if qs.scope == nil {
+		return func() {}
+	}
+	return qs.scope.OnCancel(func() { c.Close() })
+}
+
+// stopped stands in for the cursor of an iterator whose query was
+// cancelled.
+type stopped struct{}
+
+func (stopped) Next(result interface{}) bool { return false }
+func (stopped) Err() error                   { return graph.ErrQueryCancelled }
+func (stopped) Close() error                 { return nil }
+
+// stop closes the iterator's cursor once its query is cancelled, returning
+// whether it was.
+func (it *Iterator) stop() bool {
+	if !it.qs.cancelled() {
+		return false
+	}
+	if _, ok := it.iter.(stopped); !ok {
+		it.iter.Close()
+		it.iter = stopped{}
+	}
+	return true
+}
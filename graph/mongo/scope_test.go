@@ -0,0 +1,177 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+// closeRecorder records whether its cursor was closed.
+type closeRecorder struct {
+	cursor
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return c.cursor.Close()
+}
+
+func TestScopeCancel(t *testing.T) {
+	qs := &TripleStore{}
+	s := graph.NewQueryScope()
+	view := qs.Scope(s).(*TripleStore)
+	view.roundTrip()
+	qs.roundTrip()
+	if got := s.RoundTrips(); got != 1 {
+		t.Errorf("Unexpected round trips, got:%d expect:1", got)
+	}
+
+	slow := &slowCursor{ids: []string{"a", "b"}, delay: time.Millisecond}
+	it := &Iterator{qs: view, collection: "nodes", limit: -1, iter: slow}
+	if !it.Next() || it.Result() != "a" {
+		t.Fatalf("Unexpected first result, got:%v", it.Result())
+	}
+
+	// The query is cancelled while the server has yet to reply.
+	slow.delay = time.Hour
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.Cancel()
+	}()
+	start := time.Now()
+	if it.Next() {
+		t.Error("Unexpected result from a cancelled query")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Next waited too long after the query was cancelled: %v", d)
+	}
+	if err := it.Err(); err != graph.ErrQueryCancelled {
+		t.Errorf("Unexpected error, got:%v expect:%v", err, graph.ErrQueryCancelled)
+	}
+
+	// Iterators of a cancelled query close their cursors without reading
+	// from them.
+	c := &closeRecorder{cursor: &slowCursor{ids: []string{"a"}, delay: time.Hour}}
+	it = &Iterator{qs: view, collection: "nodes", limit: -1, iter: c}
+	if it.Next() {
+		t.Error("Unexpected result from a cancelled query")
+	}
+	if !c.closed {
+		t.Error("Cursor of a cancelled query left open")
+	}
+
+	// Views share the session of their store.
+	view.Close()
+}
+
+// blockingCursor blocks each read until it is closed, as a cursor waiting
+// on a slow server does until the server is told to kill it.
+type blockingCursor struct {
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newBlockingCursor() *blockingCursor {
+	return &blockingCursor{closed: make(chan struct{})}
+}
+
+func (c *blockingCursor) Next(result interface{}) bool {
+	<-c.closed
+	return false
+}
+
+func (c *blockingCursor) Err() error { return nil }
+
+func (c *blockingCursor) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// TestCancelClone checks that cancelling a query closes the cursors of the
+// clones of its iterators, both one blocked on a read and one idle.
+func TestCancelClone(t *testing.T) {
+	defer func(o func(*Iterator) cursor, c func(*TripleStore, string, bson.M) (int, error)) {
+		openCursor, countQuery = o, c
+	}(openCursor, countQuery)
+	countQuery = func(_ *TripleStore, collection string, _ bson.M) (int, error) {
+		if collection != "triples" {
+			t.Errorf("Unexpected count of %s", collection)
+		}
+		return 2, nil
+	}
+	var mu sync.Mutex
+	var cursors []*blockingCursor
+	openCursor = func(*Iterator) cursor {
+		mu.Lock()
+		defer mu.Unlock()
+		c := newBlockingCursor()
+		cursors = append(cursors, c)
+		return c
+	}
+
+	s := graph.NewQueryScope()
+	view := (&TripleStore{}).Scope(s).(*TripleStore)
+	root := NewAllIterator(view, "triples")
+	probe := root.Clone().(*Iterator)
+	idle := probe.Clone()
+	if len(cursors) != 3 {
+		t.Fatalf("Unexpected number of cursors opened, got:%d expect:3", len(cursors))
+	}
+
+	// The probe is blocked on the server when the query is cancelled.
+	done := make(chan bool)
+	go func() { done <- probe.Next() }()
+	time.Sleep(10 * time.Millisecond)
+	s.Cancel()
+	select {
+	case found := <-done:
+		if found {
+			t.Error("Unexpected result from a cancelled clone")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Clone still reading after its query was cancelled")
+	}
+	if err := probe.Err(); err != graph.ErrQueryCancelled {
+		t.Errorf("Unexpected error of a cancelled clone, got:%v expect:%v", err, graph.ErrQueryCancelled)
+	}
+	for i, c := range cursors {
+		select {
+		case <-c.closed:
+		case <-time.After(time.Second):
+			t.Errorf("Cursor %d left open after its query was cancelled", i)
+		}
+	}
+
+	// Closed iterators are forgotten by the scope, and those opened once
+	// the query is cancelled are closed at once.
+	idle.Close()
+	root.Close()
+	late := NewAllIterator(view, "triples")
+	if late.Next() {
+		t.Error("Unexpected result from an iterator of a cancelled query")
+	}
+	select {
+	case <-cursors[3].closed:
+	default:
+		t.Error("Cursor opened after the query was cancelled left open")
+	}
+}
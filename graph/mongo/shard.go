@@ -0,0 +1,94 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// shardKeyField holds the node hash of a triple's shard key direction,
+// when one is configured.
+const shardKeyField = "ShardKey"
+
+// shardKeyFrom returns the direction named by the shard_key option, or
+// quad.Any if there is none.
+func shardKeyFrom(options graph.Options) (quad.Direction, error) {
+	name, ok := options.StringKey("shard_key")
+	if !ok || name == "" {
+		return quad.Any, nil
+	}
+	for d := quad.Subject; d <= quad.Label; d++ {
+		if d.String() == name {
+			return d, nil
+		}
+	}
+	return quad.Any, fmt.Errorf("mongo: unknown shard_key direction %q", name)
+}
+
+// shardTriples shards the triples collection on a hash of the shard key
+// field. The server must be a mongos router.
+func shardTriples(session *mgo.Session, db *mgo.Database) error {
+	err := db.C("triples").EnsureIndexKey("$hashed:" + shardKeyField)
+	if err != nil {
+		return err
+	}
+	err = session.Run(bson.D{{"enableSharding", db.Name}}, nil)
+	if err != nil {
+		// Sharding may already have been enabled for the database.
+		if qerr, ok := err.(*mgo.QueryError); !ok || qerr.Code != 23 {
+			return fmt.Errorf("mongo: could not enable sharding: %v", err)
+		}
+	}
+	err = session.Run(bson.D{
+		{"shardCollection", db.Name + ".triples"},
+		{"key", bson.M{shardKeyField: "hashed"}},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("mongo: could not shard triples collection: %v", err)
+	}
+	return nil
+}
+
+// constraintFor returns the query constraint selecting the triples that
+// have the node with the given name and hash in direction d. If d is the
+// shard key direction, the constraint includes the shard key so that the
+// query is sent only to the shard holding those triples. All other queries
+// are sent to every shard.
+func (qs *TripleStore) constraintFor(d quad.Direction, name, hash string) bson.M {
+	var field string
+	switch d {
+	case quad.Subject:
+		field = "Subject"
+	case quad.Predicate:
+		field = "Predicate"
+	case quad.Object:
+		field = "Object"
+	case quad.Label:
+		field = "Label"
+	default:
+		return nil
+	}
+	c := newConstraint().eq(field, qs.storedName(name))
+	if d == qs.shardKey {
+		c.eq(shardKeyField, hash)
+	}
+	return c.M()
+}
@@ -0,0 +1,79 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestShardKeyOption(t *testing.T) {
+	for _, test := range []struct {
+		option interface{}
+		expect quad.Direction
+		err    bool
+	}{
+		{option: nil, expect: quad.Any},
+		{option: "subject", expect: quad.Subject},
+		{option: "label", expect: quad.Label},
+		{option: "none", err: true},
+	} {
+		opts := graph.Options{}
+		if test.option != nil {
+			opts["shard_key"] = test.option
+		}
+		got, err := shardKeyFrom(opts)
+		if (err != nil) != test.err {
+			t.Errorf("Unexpected error for shard_key %v, got:%v", test.option, err)
+		}
+		if got != test.expect {
+			t.Errorf("Unexpected shard key for shard_key %v, got:%s expect:%s", test.option, got, test.expect)
+		}
+	}
+}
+
+func TestShardTargeting(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Subject}
+	q := quad.Quad{"A", "follows", "B", ""}
+
+	doc := qs.docFor(q)
+	hash := qs.ConvertStringToByteHash("A")
+	if doc[shardKeyField] != hash {
+		t.Errorf("Unexpected shard key for %v, got:%v expect:%s", q, doc[shardKeyField], hash)
+	}
+
+	// A query on the shard key direction is targeted.
+	c := qs.constraintFor(quad.Subject, "A", hash)
+	if c[shardKeyField] != hash || c["Subject"] != "A" {
+		t.Errorf("Expected targeted subject query, got:%v", c)
+	}
+	// Other queries are broadcast.
+	c = qs.constraintFor(quad.Object, "B", qs.ConvertStringToByteHash("B"))
+	if _, ok := c[shardKeyField]; ok || c["Object"] != "B" {
+		t.Errorf("Expected broadcast object query, got:%v", c)
+	}
+
+	// Without a shard key, nothing is targeted or stored.
+	qs.shardKey = quad.Any
+	if _, ok := qs.docFor(q)[shardKeyField]; ok {
+		t.Errorf("Unexpected shard key without shard_key option for %v", q)
+	}
+	if _, ok := qs.constraintFor(quad.Subject, "A", hash)[shardKeyField]; ok {
+		t.Error("Unexpected targeted query without shard_key option")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"sort"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// tiedQuads tie on every direction but one, in pairs, so their order is
+// set by the names that break ties.
+var tiedQuads = []quad.Quad{
+	{"bob", "follows", "alice", ""},
+	{"alice", "follows", "bob", ""},
+	{"alice", "follows", "bob", "2014"},
+	{"alice", "follows", "alice", "2014"},
+	{"carol", "likes", "bob", "2013"},
+	{"alice", "likes", "bob", ""},
+}
+
+// TestSortTies checks that the server, sorting on the keys SortBy gives
+// it, orders tied triples as an iterator.Sort does over a memstore.
+func TestSortTies(t *testing.T) {
+	mem, _ := graph.NewTripleStore("memstore", "", nil)
+	for _, q := range tiedQuads {
+		mem.AddTriple(q)
+	}
+	for _, ids := range []idScheme{compositeIDs, hashedIDs} {
+		qs := &TripleStore{hasher: sha1.New(), ids: ids, shardKey: quad.Any}
+		for d := quad.Subject; d <= quad.Label; d++ {
+			var docs []bson.M
+			byID := make(map[string]quad.Quad)
+			for _, q := range tiedQuads {
+				doc := qs.docFor(q)
+				docs = append(docs, doc)
+				byID[doc["_id"].(string)] = q
+			}
+			sort.Sort(byKeys{docs, sortKeys(d)})
+			var got []string
+			for _, doc := range docs {
+				got = append(got, byID[doc["_id"].(string)].NTriple())
+			}
+
+			var expect []string
+			it := iterator.NewSort(mem, mem.TriplesAllIterator(), d)
+			for graph.Next(it) {
+				expect = append(expect, mem.Quad(it.Result()).NTriple())
+			}
+			if !reflect.DeepEqual(got, expect) {
+				t.Errorf("Unexpected server order sorted by %s, got:%q expect:%q", d, got, expect)
+			}
+		}
+	}
+}
+
+// TestSortByKeys checks that the server, sorting on the compound keys
+// SortByKeys gives it, orders triples as an iterator.Sort does in Go over
+// a memstore.
+func TestSortByKeys(t *testing.T) {
+	mem, _ := graph.NewTripleStore("memstore", "", nil)
+	for _, q := range tiedQuads {
+		mem.AddTriple(q)
+	}
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs, shardKey: quad.Any}
+	for _, keys := range [][]graph.SortKey{
+		{{Dir: quad.Predicate}, {Dir: quad.Subject}},
+		{{Dir: quad.Predicate}, {Dir: quad.Object, Descending: true}},
+		{{Dir: quad.Label, Descending: true}, {Dir: quad.Subject, Descending: true}},
+		{{Dir: quad.Object, Descending: true}},
+	} {
+		var docs []bson.M
+		byID := make(map[string]quad.Quad)
+		for _, q := range tiedQuads {
+			doc := qs.docFor(q)
+			docs = append(docs, doc)
+			byID[doc["_id"].(string)] = q
+		}
+		sort.Sort(byKeys{docs, sortFields(keys)})
+		var got []string
+		for _, doc := range docs {
+			got = append(got, byID[doc["_id"].(string)].NTriple())
+		}
+
+		var expect []string
+		it := iterator.NewSortByKeys(mem, mem.TriplesAllIterator(), keys)
+		for graph.Next(it) {
+			expect = append(expect, mem.Quad(it.Result()).NTriple())
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected server order sorted on %v, got:%q expect:%q", keys, got, expect)
+		}
+	}
+}
+
+func TestSortPushDown(t *testing.T) {
+	defer func(o func(*Iterator) cursor) { openCursor = o }(openCursor)
+	// The fake server records the sort of the query it is sent.
+	var opened []string
+	openCursor = func(it *Iterator) cursor {
+		opened = it.sort
+		return &docCursor{}
+	}
+	qs := &TripleStore{hasher: sha1.New(), idCache: NewIDLru(100)}
+	it := &Iterator{uid: iterator.NextUID(), qs: qs, collection: "triples", isAll: true, limit: -1, iter: &docCursor{}}
+	sorted := iterator.NewSort(qs, it, quad.Object)
+	graph.Next(sorted)
+	if expect := []string{"Object", "Subject", "Predicate", "Label", "_id"}; !reflect.DeepEqual(it.sort, expect) || !reflect.DeepEqual(opened, expect) {
+		t.Errorf("Unexpected sort pushed down, got:%v sent:%v expect:%v", it.sort, opened, expect)
+	}
+	if sortKeys(quad.Any) != nil {
+		t.Error("Unexpected sort keys for no direction")
+	}
+
+	it = &Iterator{uid: iterator.NextUID(), qs: qs, collection: "triples", isAll: true, limit: -1, iter: &docCursor{}}
+	sorted = iterator.NewSortByKeys(qs, it, []graph.SortKey{{Dir: quad.Predicate}, {Dir: quad.Subject, Descending: true}})
+	graph.Next(sorted)
+	if expect := []string{"Predicate", "-Subject", "Object", "Label", "_id"}; !reflect.DeepEqual(it.sort, expect) || !reflect.DeepEqual(opened, expect) {
+		t.Errorf("Unexpected compound sort pushed down, got:%v sent:%v expect:%v", it.sort, opened, expect)
+	}
+	if sortFields([]graph.SortKey{{Dir: quad.Subject}, {Dir: quad.Subject, Descending: true}}) != nil {
+		t.Error("Unexpected sort keys for a direction keyed twice")
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+)
+
+// spillBatch is the number of documents written to a spill in one round
+// trip.
+const spillBatch = 1000
+
+// spillAtFrom returns the number of results given by the spill_at option
+// over which iterators spill them to temporary collections, or 0 if they
+// never do.
+func spillAtFrom(options graph.Options) int {
+	if n, ok := options.IntKey("spill_at"); ok && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// SpillAt returns the number of results over which the Unique and
+// Materialize iterators of a query spill them to temporary collections, or
+// 0 if they never do.
+func (qs *TripleStore) SpillAt() int {
+	return qs.spillAt
+}
+
+// A spillCollection is the temporary collection a spill is held in.
+type spillCollection interface {
+	// insert inserts doc, returning false if there already is a
+	// document with its _id.
+	insert(doc interface{}) (bool, error)
+
+	// insertAll inserts docs in a single round trip.
+	insertAll(docs []interface{}) error
+
+	// find returns a cursor over the documents that match query, in
+	// order of their key and then of their _id.
+	find(query bson.M) cursor
+
+	// drop drops the collection.
+	drop() error
+}
+
+// newSpillCollection returns a new temporary collection for a spill, with
+// an index on the keys of its documents if keyed.
+var newSpillCollection = func(qs *TripleStore, keyed bool) (spillCollection, error) {
+	c := qs.db.C("spill_" + bson.NewObjectId().Hex())
+	if keyed {
+		if err := c.EnsureIndexKey("k", "_id"); err != nil {
+			return nil, err
+		}
+	}
+	return spillColl{c}, nil
+}
+
+type spillColl struct {
+	c *mgo.Collection
+}
+
+func (s spillColl) insert(doc interface{}) (bool, error) {
+	err := s.c.Insert(doc)
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s spillColl) insertAll(docs []interface{}) error {
+	b := s.c.Bulk()
+	b.Unordered()
+	b.Insert(docs...)
+	_, err := b.Run()
+	return err
+}
+
+func (s spillColl) find(query bson.M) cursor {
+	return s.c.Find(query).Sort("k", "_id").Iter()
+}
+
+func (s spillColl) drop() error {
+	return s.c.DropCollection()
+}
+
+// insertBatches inserts docs into c, spillBatch at a time.
+func insertBatches(c spillCollection, docs []interface{}) error {
+	for len(docs) > 0 {
+		n := len(docs)
+		if n > spillBatch {
+			n = spillBatch
+		}
+		if err := c.insertAll(docs[:n]); err != nil {
+			return err
+		}
+		docs = docs[n:]
+	}
+	return nil
+}
+
+// NewSpill returns an iterator.Spill held in a new temporary collection,
+// which is dropped when the Spill is closed. It may be used by iterators
+// over any backend, to hold sets that are too large for memory.
+func (qs *TripleStore) NewSpill() (iterator.Spill, error) {
+	c, err := newSpillCollection(qs, false)
+	if err != nil {
+		return nil, err
+	}
+	return &spillSet{c: c}, nil
+}
+
+// A spillSet holds each key as the _id of a document, so that adding a key
+// already held fails on the _id index.
+type spillSet struct {
+	c spillCollection
+}
+
+// spillKey returns key in a form that can be stored as an _id.
+func spillKey(key interface{}) interface{} {
+	switch key := key.(type) {
+	case tripleValue:
+		return key.id
+	case iterator.TaggedKey:
+		// An ordered document, so that equal keys are equal _ids.
+		return bson.D{{"Result", spillKey(key.Result)}, {"Tagged", spillKey(key.Tagged)}}
+	case iterator.CompositeKey:
+		return bson.D{{"Tagged", spillKey(key.Tagged)}, {"Rest", spillKey(key.Rest)}}
+	}
+	return key
+}
+
+func (s *spillSet) Add(key interface{}) (bool, error) {
+	return s.c.insert(bson.M{"_id": spillKey(key)})
+}
+
+func (s *spillSet) AddAll(keys []interface{}) error {
+	docs := make([]interface{}, len(keys))
+	for i, key := range keys {
+		docs[i] = bson.M{"_id": spillKey(key)}
+	}
+	return insertBatches(s.c, docs)
+}
+
+func (s *spillSet) Close() error {
+	return s.c.drop()
+}
+
+// NewSpillList returns an iterator.SpillList held in a new temporary
+// collection, which is dropped when the list is closed. Only the values of
+// the store can be held in it.
+func (qs *TripleStore) NewSpillList() (iterator.SpillList, error) {
+	c, err := newSpillCollection(qs, true)
+	if err != nil {
+		return nil, err
+	}
+	return &spillList{c: c}, nil
+}
+
+// A spilledValue is a node or triple of the store as it is held in a
+// spill.
+type spilledValue struct {
+	Node   string   `bson:"n,omitempty"`
+	Triple string   `bson:"t,omitempty"`
+	Hashes []string `bson:"h,omitempty"`
+}
+
+func spillValue(v graph.Value) (spilledValue, error) {
+	switch v := v.(type) {
+	case string:
+		return spilledValue{Node: v}, nil
+	case tripleValue:
+		return spilledValue{Triple: v.id, Hashes: v.hashes[:]}, nil
+	}
+	return spilledValue{}, fmt.Errorf("mongo: cannot spill a value of type %T", v)
+}
+
+func (v spilledValue) value() graph.Value {
+	if v.Triple == "" {
+		return v.Node
+	}
+	t := tripleValue{id: v.Triple}
+	copy(t.hashes[:], v.Hashes)
+	return t
+}
+
+type spilledTag struct {
+	Name  string       `bson:"n"`
+	Value spilledValue `bson:"v"`
+}
+
+// A spillDoc is a result held in a spillList, numbered in the order it was
+// appended.
+type spillDoc struct {
+	Id    int64        `bson:"_id"`
+	Key   interface{}  `bson:"k"`
+	Value spilledValue `bson:"v"`
+	Tags  []spilledTag `bson:"t,omitempty"`
+}
+
+func (d *spillDoc) result() iterator.SpilledResult {
+	r := iterator.SpilledResult{Result: d.Value.value(), Tags: make(map[string]graph.Value, len(d.Tags))}
+	for _, t := range d.Tags {
+		r.Tags[t.Name] = t.Value.value()
+	}
+	return r
+}
+
+type spillList struct {
+	c       spillCollection
+	pending []interface{}
+	n       int64
+}
+
+func (l *spillList) Append(key interface{}, r iterator.SpilledResult) error {
+	v, err := spillValue(r.Result)
+	if err != nil {
+		return err
+	}
+	doc := spillDoc{Id: l.n, Key: spillKey(key), Value: v}
+	for name, tagged := range r.Tags {
+		if tagged == nil {
+			continue
+		}
+		v, err := spillValue(tagged)
+		if err != nil {
+			return err
+		}
+		doc.Tags = append(doc.Tags, spilledTag{Name: name, Value: v})
+	}
+	l.n++
+	l.pending = append(l.pending, doc)
+	if len(l.pending) < spillBatch {
+		return nil
+	}
+	return l.flush()
+}
+
+// flush writes the results held back by Append.
+func (l *spillList) flush() error {
+	err := insertBatches(l.c, l.pending)
+	l.pending = nil
+	return err
+}
+
+func (l *spillList) Results() (iterator.SpillCursor, error) {
+	if err := l.flush(); err != nil {
+		return nil, err
+	}
+	return &spillCursor{c: l.c.find(nil)}, nil
+}
+
+func (l *spillList) Find(key interface{}) ([]iterator.SpilledResult, error) {
+	if err := l.flush(); err != nil {
+		return nil, err
+	}
+	c := l.c.find(bson.M{"k": spillKey(key)})
+	var group []iterator.SpilledResult
+	var doc spillDoc
+	for c.Next(&doc) {
+		group = append(group, doc.result())
+		doc = spillDoc{}
+	}
+	return group, c.Close()
+}
+
+func (l *spillList) Close() error {
+	l.pending = nil
+	return l.c.drop()
+}
+
+// A spillCursor reads the results of a spillList in order of their keys,
+// reading ahead to the first result of the next key.
+type spillCursor struct {
+	c    cursor
+	next *spillDoc
+}
+
+func (c *spillCursor) Next(group *[]iterator.SpilledResult) bool {
+	*group = (*group)[:0]
+	if c.next == nil {
+		var doc spillDoc
+		if !c.c.Next(&doc) {
+			return false
+		}
+		c.next = &doc
+	}
+	first := c.next
+	*group = append(*group, first.result())
+	for {
+		var doc spillDoc
+		if !c.c.Next(&doc) {
+			c.next = nil
+			return true
+		}
+		if !reflect.DeepEqual(doc.Key, first.Key) {
+			c.next = &doc
+			return true
+		}
+		*group = append(*group, doc.result())
+	}
+}
+
+func (c *spillCursor) Close() error {
+	return c.c.Close()
+}
@@ -0,0 +1,199 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// fakeSpill is a temporary collection held in memory, which tallies the
+// round trips made to it.
+type fakeSpill struct {
+	ids     map[string]bool
+	docs    []spillDoc
+	batches []int
+	inserts int
+	dropped bool
+}
+
+func (s *fakeSpill) insert(doc interface{}) (bool, error) {
+	s.inserts++
+	id := fmt.Sprint(doc.(bson.M)["_id"])
+	if s.ids[id] {
+		return false, nil
+	}
+	s.ids[id] = true
+	return true, nil
+}
+
+func (s *fakeSpill) insertAll(docs []interface{}) error {
+	s.batches = append(s.batches, len(docs))
+	for _, doc := range docs {
+		switch doc := doc.(type) {
+		case bson.M:
+			s.ids[fmt.Sprint(doc["_id"])] = true
+		case spillDoc:
+			s.docs = append(s.docs, doc)
+		}
+	}
+	return nil
+}
+
+func (s *fakeSpill) find(query bson.M) cursor {
+	var docs []spillDoc
+	for _, doc := range s.docs {
+		if key, ok := query["k"]; !ok || reflect.DeepEqual(doc.Key, key) {
+			docs = append(docs, doc)
+		}
+	}
+	sort.Sort(byKey(docs))
+	return &spillDocCursor{docs: docs}
+}
+
+func (s *fakeSpill) drop() error {
+	s.dropped = true
+	return nil
+}
+
+type byKey []spillDoc
+
+func (s byKey) Len() int      { return len(s) }
+func (s byKey) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byKey) Less(i, j int) bool {
+	if ki, kj := fmt.Sprint(s[i].Key), fmt.Sprint(s[j].Key); ki != kj {
+		return ki < kj
+	}
+	return s[i].Id < s[j].Id
+}
+
+type spillDocCursor struct {
+	docs []spillDoc
+}
+
+func (c *spillDocCursor) Next(result interface{}) bool {
+	if len(c.docs) == 0 {
+		return false
+	}
+	*result.(*spillDoc) = c.docs[0]
+	c.docs = c.docs[1:]
+	return true
+}
+
+func (c *spillDocCursor) Err() error   { return nil }
+func (c *spillDocCursor) Close() error { return nil }
+
+func TestSpill(t *testing.T) {
+	defer func(n func(*TripleStore, bool) (spillCollection, error)) { newSpillCollection = n }(newSpillCollection)
+	var spills []*fakeSpill
+	newSpillCollection = func(*TripleStore, bool) (spillCollection, error) {
+		s := &fakeSpill{ids: make(map[string]bool)}
+		spills = append(spills, s)
+		return s, nil
+	}
+
+	if got := spillAtFrom(graph.Options{"spill_at": 2.0}); got != 2 {
+		t.Errorf("Unexpected spill_at, got:%d expect:2", got)
+	}
+	qs := &TripleStore{hasher: sha1.New(), spillAt: spillAtFrom(graph.Options{"spill_at": 2.0})}
+	var nodes []graph.Value
+	for _, name := range []string{"alice", "bob", "charlie", "dani"} {
+		nodes = append(nodes, qs.ValueOf(name))
+	}
+	follows := qs.valueFor(tripleDoc{Id: qs.getIdForTriple(quad.Quad{"alice", "follows", "bob", ""})})
+
+	// The set of a Unique is moved to the spill in one batch, after which
+	// each result costs a single insert.
+	fixed := iterator.NewFixedIteratorWithCompare(iterator.BasicEquality)
+	for _, v := range []graph.Value{nodes[0], nodes[1], nodes[0], nodes[2], nodes[1], nodes[3], follows, follows} {
+		fixed.Add(v)
+	}
+	u := iterator.NewUnique(fixed)
+	iterator.UseSpill(qs, u)
+	var got []graph.Value
+	for graph.Next(u) {
+		got = append(got, u.Result())
+	}
+	if expect := append(nodes[:4:4], follows); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected results of a spilled Unique, got:%v expect:%v", got, expect)
+	}
+	if len(spills) != 1 {
+		t.Fatalf("Unexpected number of spills, got:%d expect:1", len(spills))
+	}
+	if s := spills[0]; !reflect.DeepEqual(s.batches, []int{3}) || s.inserts != 4 || len(s.ids) != 5 {
+		t.Errorf("Unexpected writes to the spill, got batches:%v inserts:%d ids:%d", s.batches, s.inserts, len(s.ids))
+	}
+	u.Close()
+	if !spills[0].dropped {
+		t.Error("Spill of a Unique was not dropped on Close")
+	}
+
+	// A Materialize is read back from the spill, a node at a time, with
+	// the tags of each of its paths.
+	spills = nil
+	fixed = iterator.NewFixedIteratorWithCompare(iterator.BasicEquality)
+	for _, v := range []graph.Value{nodes[2], follows, nodes[0], nodes[2]} {
+		fixed.Add(v)
+	}
+	fixed.Tagger().Add("x")
+	m := iterator.NewMaterialize(fixed)
+	iterator.UseSpill(qs, m)
+	got = nil
+	for graph.Next(m) {
+		for {
+			tags := make(map[string]graph.Value)
+			m.TagResults(tags)
+			if tags["x"] != m.Result() {
+				t.Errorf("Unexpected tags of spilled result %v, got:%v", m.Result(), tags)
+			}
+			got = append(got, m.Result())
+			if !m.NextPath() {
+				break
+			}
+		}
+	}
+	if len(spills) != 1 {
+		t.Fatalf("Unexpected number of spills, got:%d expect:1", len(spills))
+	}
+	if s := spills[0]; !reflect.DeepEqual(s.batches, []int{4}) {
+		t.Errorf("Unexpected writes to the spill, got batches:%v expect:[4]", s.batches)
+	}
+	var expect []graph.Value
+	for _, doc := range spills[0].find(nil).(*spillDocCursor).docs {
+		expect = append(expect, doc.Value.value())
+	}
+	if len(got) != 4 || !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected results of a spilled Materialize, got:%v expect:%v", got, expect)
+	}
+	if !m.Contains(follows) || m.Result() != follows {
+		t.Errorf("Failed to find %v in the spill", follows)
+	}
+	if m.Contains(nodes[3]) {
+		t.Errorf("Unexpected %v found in the spill", nodes[3])
+	}
+	m.Close()
+	if !spills[0].dropped {
+		t.Error("Spill of a Materialize was not dropped on Close")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"strings"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// The relative costs of the work an iterator does, from which its Stats are
+// estimated.
+const (
+	// Checking a document already in memory.
+	memoryCost = 1
+
+	// Reading the next document from a cursor over an index, which also
+	// fetches the document.
+	indexCost = 2
+
+	// Making a query and waiting for its reply.
+	queryCost = 10
+)
+
+// indexedDirections returns whether any of indexes is led by the field of
+// each direction, so that queries on that direction can use it.
+func indexedDirections(indexes []mgo.Index) [quad.Label + 1]bool {
+	var indexed [quad.Label + 1]bool
+	for _, index := range indexes {
+		if len(index.Key) == 0 {
+			continue
+		}
+		for d := quad.Subject; d <= quad.Label; d++ {
+			if index.Key[0] == strings.Title(d.String()) {
+				indexed[d] = true
+			}
+		}
+	}
+	return indexed
+}
+
+// scanPercentFrom returns the percentage of a collection given by the
+// scan_percent option at which iterators scan the whole collection rather
+// than query on their constraint, or 0 if they never do.
+func scanPercentFrom(options graph.Options) int {
+	if n, ok := options.IntKey("scan_percent"); ok && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// prefersScan returns whether the iterator selects enough of its collection
+// that reading the whole of it, in order, beats seeking each of its
+// triples through an index.
+func (it *Iterator) prefersScan() bool {
+	if it.qs.scanPercent <= 0 || it.scan || it.isAll || it.collection != "triples" || it.total == 0 {
+		return false
+	}
+	if it.windowed() || it.sort != nil || it.branches != nil || it.labels != nil {
+		return false
+	}
+	return it.size*100 >= it.total*int64(it.qs.scanPercent)
+}
+
+// coversAll returns whether the iterator's constraint selects every live
+// triple, as that of a predicate on every triple does, so that it can be
+// replaced by an iterator over all of them, which contains any triple
+// without checking it.
+//
+// The counts the iterator was made with may be stale, so the triples are
+// counted again unless those counts already show that some are not
+// selected.
+func (it *Iterator) coversAll() bool {
+	if it.isAll || it.scan || it.collection != "triples" || it.pluck != quad.Any || it.langs != nil {
+		return false
+	}
+	if it.windowed() || it.sort != nil || it.branches != nil || it.labels != nil {
+		return false
+	}
+	// An And drops iterators over everything, and would lose their tags.
+	if len(it.tags.Tags()) != 0 || len(it.tags.Fixed()) != 0 {
+		return false
+	}
+	if it.size == 0 {
+		return false
+	}
+	total, cached := it.qs.cachedSize("triples", true)
+	if !cached && it.total != 0 {
+		total, cached = it.total, true
+	}
+	if cached && total != it.size {
+		return false
+	}
+	n, err := countQuery(it.qs, "triples", it.qs.live(nil))
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return false
+	}
+	if int64(n) != it.size {
+		return false
+	}
+	n, err = countQuery(it.qs, "triples", it.constraint)
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return false
+	}
+	return int64(n) == it.size
+}
+
+// indexedOn returns whether queries for the triples of a node in direction d
+// can use an index. Those on the shard key direction use the shard key's.
+func (qs *TripleStore) indexedOn(d quad.Direction) bool {
+	if d < quad.Subject || d > quad.Label {
+		return false
+	}
+	return qs.indexed[d] || d == qs.shardKey
+}
+
+// Stats estimates the costs of the iterator from how its query is answered.
+//
+// Iterating over a whole collection reads its documents in order, and is
+// the cheapest per result. A query on an indexed field walks the index and
+// fetches each document it finds. A query on a field without an index has
+// the server scan the collection, reading every document for each one it
+// returns, so the fewer of the collection it selects the dearer each is. An
+// iterator that scans the collection itself costs the same.
+//
+// Contains is done in memory, unless tombstones must be checked with a
+// query, or the iterator is windowed and must walk its window.
+func (it *Iterator) Stats() graph.IteratorStats {
+	size, _ := it.Size()
+	next := int64(memoryCost)
+	switch {
+	case it.isAll:
+	case it.qs.indexedOn(it.dir) && !it.scan:
+		next = indexCost
+	case it.size > 0:
+		next = memoryCost * (it.total + it.size - 1) / it.size
+	default:
+		next = memoryCost * it.total
+	}
+	if next < memoryCost {
+		next = memoryCost
+	}
+	contains := int64(memoryCost)
+	switch {
+	case it.windowed():
+		contains = queryCost + next*size
+	case it.collection == "triples" && it.qs.softDelete:
+		contains = queryCost
+	}
+	return graph.IteratorStats{
+		ContainsCost: contains,
+		NextCost:     next,
+		Size:         size,
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+var ErrNoStatsCache = errors.New("mongo: counts are not cached without stats_refresh_secs")
+
+// countQuery returns the number of documents of the collection of qs that
+// match constraint, counted by the server.
+var countQuery = func(qs *TripleStore, collection string, constraint bson.M) (int, error) {
+	return qs.db.C(collection).Find(constraint).Count()
+}
+
+// predicateCounts returns the number of live triples with each predicate
+// in qs, as the stats cache refreshes them.
+var predicateCounts = (*TripleStore).PredicateCounts
+
+// statsRefreshFrom returns how often counts are refreshed in the background
+// given the stats_refresh_secs option, or 0 if iterators count for
+// themselves.
+func statsRefreshFrom(options graph.Options) time.Duration {
+	if secs, ok := options.IntKey("stats_refresh_secs"); ok && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+// A statsCache holds the sizes of the collections, and the number of live
+// triples with each predicate, as they were when last counted. Iterators
+// over a whole collection or a predicate are sized from it rather than
+// with a count of their own, which may be stale by as much as the time
+// between refreshes.
+type statsCache struct {
+	mu          sync.RWMutex
+	refreshed   time.Time
+	collections map[string]int64
+	live        int64
+	predicates  map[string]int64
+
+	stop chan struct{}
+}
+
+// startStatsRefresh counts the store's stats, and keeps counting them
+// every interval until the store is closed.
+func (qs *TripleStore) startStatsRefresh(every time.Duration) error {
+	qs.stats = &statsCache{stop: make(chan struct{})}
+	if err := qs.RefreshStats(); err != nil {
+		return err
+	}
+	go func(stats *statsCache) {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := qs.RefreshStats(); err != nil {
+					glog.Errorf("Error: %v while refreshing stats", err)
+				}
+			case <-stats.stop:
+				return
+			}
+		}
+	}(qs.stats)
+	return nil
+}
+
+// stopStatsRefresh stops the background refresh, if there is one.
+func (qs *TripleStore) stopStatsRefresh() {
+	if qs.stats != nil {
+		close(qs.stats.stop)
+	}
+}
+
+// RefreshStats counts the collections of the store, and the triples with
+// each predicate, now rather than waiting for the next refresh. It returns
+// ErrNoStatsCache if the store does not cache them.
+func (qs *TripleStore) RefreshStats() error {
+	if qs.stats == nil {
+		return ErrNoStatsCache
+	}
+	collections := make(map[string]int64)
+	for _, c := range []string{"triples", "nodes"} {
+		n, err := countQuery(qs, c, nil)
+		if err != nil {
+			return err
+		}
+		collections[c] = int64(n)
+	}
+	live := collections["triples"]
+	if constraint := qs.live(nil); constraint != nil {
+		n, err := countQuery(qs, "triples", constraint)
+		if err != nil {
+			return err
+		}
+		live = int64(n)
+	}
+	predicates, err := predicateCounts(qs)
+	if err != nil {
+		return err
+	}
+
+	qs.stats.mu.Lock()
+	defer qs.stats.mu.Unlock()
+	qs.stats.refreshed = now()
+	qs.stats.collections = collections
+	qs.stats.live = live
+	qs.stats.predicates = predicates
+	return nil
+}
+
+// StatsAge returns how long ago the cached counts were refreshed, or
+// ErrNoStatsCache if the store does not cache them.
+func (qs *TripleStore) StatsAge() (time.Duration, error) {
+	if qs.stats == nil {
+		return 0, ErrNoStatsCache
+	}
+	qs.stats.mu.RLock()
+	defer qs.stats.mu.RUnlock()
+	return now().Sub(qs.stats.refreshed), nil
+}
+
+// cachedStats returns the cache, unless the store has none or is a view,
+// whose triples the cache does not count.
+func (qs *TripleStore) cachedStats() *statsCache {
+	if qs.isView {
+		return nil
+	}
+	return qs.stats
+}
+
+// cachedSize returns the number of documents in collection, or of live
+// triples if live is true, when they were last counted.
+func (qs *TripleStore) cachedSize(collection string, live bool) (int64, bool) {
+	stats := qs.cachedStats()
+	if stats == nil {
+		return 0, false
+	}
+	stats.mu.RLock()
+	defer stats.mu.RUnlock()
+	if live && collection == "triples" {
+		return stats.live, true
+	}
+	n, ok := stats.collections[collection]
+	return n, ok
+}
+
+// cachedPredicateSize returns the number of live triples with the
+// predicate stored under name when they were last counted. Predicates
+// first written since are counted afresh.
+func (qs *TripleStore) cachedPredicateSize(name string) (int64, bool) {
+	stats := qs.cachedStats()
+	if stats == nil {
+		return 0, false
+	}
+	stats.mu.RLock()
+	defer stats.mu.RUnlock()
+	n, ok := stats.predicates[name]
+	return n, ok
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestStatsCache(t *testing.T) {
+	defer func(o func(*Iterator) cursor, c func(*TripleStore, string, bson.M) (int, error), p func(*TripleStore) (map[string]int64, error)) {
+		openCursor, countQuery, predicateCounts = o, c, p
+		now = time.Now
+	}(openCursor, countQuery, predicateCounts)
+	clock := time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	openCursor = func(*Iterator) cursor { return &slowCursor{} }
+	var counts int
+	countQuery = func(*TripleStore, string, bson.M) (int, error) {
+		counts++
+		return 7, nil
+	}
+	predicateCounts = func(*TripleStore) (map[string]int64, error) {
+		return map[string]int64{"follows": 3}, nil
+	}
+
+	if got := statsRefreshFrom(graph.Options{"stats_refresh_secs": 60.0}); got != time.Minute {
+		t.Errorf("Unexpected stats refresh, got:%v expect:%v", got, time.Minute)
+	}
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any, idCache: NewIDLru(16)}
+	if err := qs.RefreshStats(); err != ErrNoStatsCache {
+		t.Errorf("Unexpected error refreshing without a cache, got:%v expect:%v", err, ErrNoStatsCache)
+	}
+	qs.stats = &statsCache{}
+	follows, likes := qs.ConvertStringToByteHash("follows"), qs.ConvertStringToByteHash("likes")
+	qs.idCache.Put(follows, "follows")
+	qs.idCache.Put(likes, "likes")
+
+	// Before the first refresh, iterators count for themselves: their
+	// triples, and the collection for the cost of a query without an index.
+	NewIterator(qs, "triples", quad.Predicate, follows)
+	if counts != 2 {
+		t.Errorf("Unexpected counts before a refresh, got:%d expect:2", counts)
+	}
+
+	if err := qs.RefreshStats(); err != nil {
+		t.Fatalf("Failed to refresh stats: %v", err)
+	}
+	counts = 0
+	it := NewIterator(qs, "triples", quad.Predicate, follows)
+	if counts != 0 {
+		t.Errorf("Unexpected counts for a cached predicate, got:%d expect:0", counts)
+	}
+	if it.size != 3 || it.total != 7 {
+		t.Errorf("Unexpected cached sizes, got size:%d total:%d expect size:3 total:7", it.size, it.total)
+	}
+	if it := NewAllIterator(qs, "nodes"); counts != 0 || it.size != 7 {
+		t.Errorf("Unexpected size of the nodes, got:%d with %d counts", it.size, counts)
+	}
+
+	// A predicate written since the refresh is counted afresh, as is
+	// everything in a view.
+	if it := NewIterator(qs, "triples", quad.Predicate, likes); counts != 1 || it.size != 7 {
+		t.Errorf("Unexpected size of an uncached predicate, got:%d with %d counts", it.size, counts)
+	}
+	view := *qs
+	view.isView = true
+	counts = 0
+	NewIterator(&view, "triples", quad.Predicate, follows)
+	if counts != 2 {
+		t.Errorf("Unexpected counts in a view, got:%d expect:2", counts)
+	}
+
+	clock = clock.Add(time.Minute)
+	if age, err := qs.StatsAge(); err != nil || age != time.Minute {
+		t.Errorf("Unexpected stats age, got:%v %v expect:%v", age, err, time.Minute)
+	}
+}
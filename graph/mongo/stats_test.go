@@ -0,0 +1,260 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestIndexedDirections(t *testing.T) {
+	indexed := indexedDirections([]mgo.Index{
+		{Key: []string{"_id"}},
+		{Key: []string{"Subject", "Predicate"}},
+		{Key: []string{"Label", "Object"}},
+	})
+	expect := [quad.Label + 1]bool{quad.Subject: true, quad.Label: true}
+	if indexed != expect {
+		t.Errorf("Unexpected indexed directions, got:%v expect:%v", indexed, expect)
+	}
+	if indexedDirections(tripleIndexes) != [quad.Label + 1]bool{false, true, true, true, true} {
+		t.Error("Expected every direction indexed by the init indexes")
+	}
+}
+
+func TestIteratorStats(t *testing.T) {
+	qs := &TripleStore{shardKey: quad.Any}
+	qs.indexed[quad.Subject] = true
+	for _, test := range []struct {
+		message string
+		it      *Iterator
+		expect  graph.IteratorStats
+	}{
+		{
+			message: "scan all triples",
+			it:      &Iterator{qs: qs, collection: "triples", isAll: true, size: 1000, limit: -1},
+			expect:  graph.IteratorStats{ContainsCost: 1, NextCost: 1, Size: 1000},
+		},
+		{
+			message: "find on an index",
+			it:      &Iterator{qs: qs, collection: "triples", dir: quad.Subject, size: 10, total: 1000, limit: -1},
+			expect:  graph.IteratorStats{ContainsCost: 1, NextCost: 2, Size: 10},
+		},
+		{
+			message: "find without an index",
+			it:      &Iterator{qs: qs, collection: "triples", dir: quad.Object, size: 10, total: 1000, limit: -1},
+			expect:  graph.IteratorStats{ContainsCost: 1, NextCost: 100, Size: 10},
+		},
+		{
+			message: "find without an index selecting nothing",
+			it:      &Iterator{qs: qs, collection: "triples", dir: quad.Object, total: 1000, limit: -1},
+			expect:  graph.IteratorStats{ContainsCost: 1, NextCost: 1000, Size: 0},
+		},
+		{
+			message: "windowed find on an index",
+			it:      &Iterator{qs: qs, collection: "triples", dir: quad.Subject, size: 10, limit: 5},
+			expect:  graph.IteratorStats{ContainsCost: 20, NextCost: 2, Size: 5},
+		},
+	} {
+		if got := test.it.Stats(); got != test.expect {
+			t.Errorf("Unexpected stats to %s, got:%+v expect:%+v", test.message, got, test.expect)
+		}
+	}
+
+	qs.softDelete = true
+	it := &Iterator{qs: qs, collection: "triples", isAll: true, size: 1000, limit: -1}
+	if got := it.Stats().ContainsCost; got != queryCost {
+		t.Errorf("Unexpected contains cost with tombstones, got:%d expect:%d", got, queryCost)
+	}
+}
+
+func TestScanSelection(t *testing.T) {
+	if got := scanPercentFrom(graph.Options{"scan_percent": 30.0}); got != 30 {
+		t.Errorf("Unexpected scan percentage, got:%d expect:30", got)
+	}
+
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any, scanPercent: 50}
+	qs.indexed[quad.Predicate] = true
+	for _, test := range []struct {
+		message string
+		it      *Iterator
+		expect  bool
+	}{
+		{
+			message: "scan for most of the triples",
+			it:      &Iterator{qs: qs, collection: "triples", dir: quad.Predicate, size: 700, total: 1000, limit: -1},
+			expect:  true,
+		},
+		{
+			message: "query for few of the triples",
+			it:      &Iterator{qs: qs, collection: "triples", dir: quad.Predicate, size: 100, total: 1000, limit: -1},
+		},
+		{
+			message: "query a window of the triples",
+			it:      &Iterator{qs: qs, collection: "triples", dir: quad.Predicate, size: 700, total: 1000, limit: 10},
+		},
+		{
+			message: "query all the nodes",
+			it:      &Iterator{qs: qs, collection: "nodes", isAll: true, size: 700, total: 1000, limit: -1},
+		},
+	} {
+		if got := test.it.prefersScan(); got != test.expect {
+			t.Errorf("Unexpected choice to %s, got:%t expect:%t", test.message, got, test.expect)
+		}
+	}
+
+	// Most triples have the same predicate, so scanning them all and
+	// checking each beats seeking them through the index.
+	var ids, expect []string
+	var triples []quad.Quad
+	for i := 0; i < 10; i++ {
+		p := "follows"
+		if i%4 == 0 {
+			p = "status"
+		}
+		q := quad.Quad{fmt.Sprint("n", i), p, fmt.Sprint("n", i+1), ""}
+		triples = append(triples, q)
+		id := qs.getIdForTriple(q)
+		ids = append(ids, id)
+		if p == "follows" {
+			expect = append(expect, id)
+		}
+	}
+	hash := qs.ValueOf("follows").(string)
+	it := &Iterator{qs: qs, collection: "triples", dir: quad.Predicate, hash: hash, name: "follows", size: int64(len(expect)), total: int64(len(ids)), limit: -1}
+	if !it.prefersScan() {
+		t.Fatal("Expected a scan of low selectivity triples")
+	}
+	index := it.Stats().NextCost
+	it.scan = true
+	if scan := it.Stats().NextCost; scan > index {
+		t.Errorf("Unexpected next cost of scan over index, got index:%d scan:%d", index, scan)
+	}
+
+	it.iter = &slowCursor{ids: ids}
+	var got []string
+	for it.Next() {
+		got = append(got, it.Result().(tripleValue).id)
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected results of scan, got:%v expect:%v", got, expect)
+	}
+	for i, q := range triples {
+		if got := it.Contains(qs.valueFor(tripleDoc{Id: ids[i]})); got != (q.Predicate == "follows") {
+			t.Errorf("Unexpected containment of %v by scan, got:%t", q, got)
+		}
+	}
+}
+
+func TestCoversAll(t *testing.T) {
+	defer func(o func(*Iterator) cursor, c func(*TripleStore, string, bson.M) (int, error)) {
+		openCursor, countQuery = o, c
+	}(openCursor, countQuery)
+
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any}
+	var triples []quad.Quad
+	var ids []string
+	for i := 0; i < 10; i++ {
+		q := quad.Quad{fmt.Sprint("n", i), "follows", fmt.Sprint("n", i+1), ""}
+		triples = append(triples, q)
+		ids = append(ids, qs.getIdForTriple(q))
+	}
+	openCursor = func(*Iterator) cursor { return &slowCursor{ids: ids} }
+	hash := qs.ValueOf("follows").(string)
+	follows := func(size, total int64) *Iterator {
+		return &Iterator{qs: qs, collection: "triples", dir: quad.Predicate, hash: hash, name: "follows", size: size, total: total, limit: -1, iter: &slowCursor{ids: ids}}
+	}
+	tagged := follows(10, 10)
+	tagged.Tagger().Add("x")
+	windowed := follows(10, 10)
+	windowed.limit = 5
+
+	for _, test := range []struct {
+		message string
+		it      *Iterator
+		counts  []int
+		expect  bool
+	}{
+		{
+			message: "collapse a predicate on every triple",
+			it:      follows(10, 10),
+			counts:  []int{10, 10},
+			expect:  true,
+		},
+		{
+			message: "collapse a predicate on every triple without a total",
+			it:      follows(10, 0),
+			counts:  []int{10, 10},
+			expect:  true,
+		},
+		{
+			message: "keep a predicate on some of the triples",
+			it:      follows(7, 10),
+		},
+		{
+			message: "keep a predicate whose count is stale",
+			it:      follows(10, 10),
+			counts:  []int{10, 9},
+		},
+		{
+			message: "keep a tagged predicate",
+			it:      tagged,
+		},
+		{
+			message: "keep a window of a predicate",
+			it:      windowed,
+		},
+	} {
+		counts := test.counts
+		countQuery = func(_ *TripleStore, collection string, _ bson.M) (int, error) {
+			if len(counts) == 0 || collection != "triples" {
+				t.Fatalf("Unexpected count of %s to %s", collection, test.message)
+			}
+			n := counts[0]
+			counts = counts[1:]
+			return n, nil
+		}
+		if got := test.it.coversAll(); got != test.expect {
+			t.Errorf("Unexpected choice to %s, got:%t expect:%t", test.message, got, test.expect)
+		}
+	}
+
+	// The collapsed iterator holds every triple without checking it.
+	countQuery = func(*TripleStore, string, bson.M) (int, error) { return len(ids), nil }
+	it, changed := follows(10, 10).Optimize()
+	if !changed || it.Type() != graph.All {
+		t.Fatalf("Unexpected optimization of a predicate on every triple, got:%s", it.DebugString(0))
+	}
+	for i, q := range triples {
+		if !it.Contains(qs.valueFor(tripleDoc{Id: ids[i]})) {
+			t.Errorf("Unexpected miss of %v by the collapsed iterator", q)
+		}
+	}
+	var n int
+	for graph.Next(it) {
+		n++
+	}
+	if n != len(ids) {
+		t.Errorf("Unexpected number of results of the collapsed iterator, got:%d expect:%d", n, len(ids))
+	}
+}
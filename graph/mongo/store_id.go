@@ -0,0 +1,88 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"strings"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+)
+
+// storeDoc is kept in the metadata collection to record the identifier of a
+// store, so that every server opening it gives the same one.
+type storeDoc struct {
+	Id      string `bson:"_id"`
+	StoreID string `bson:"StoreID"`
+}
+
+const storeDocID = "store"
+
+// readStoreDoc and writeStoreDoc read and write the store document in the
+// metadata collection.
+var (
+	readStoreDoc = func(qs *TripleStore) (storeDoc, error) {
+		var doc storeDoc
+		err := qs.db.C("metadata").FindId(storeDocID).One(&doc)
+		return doc, err
+	}
+	writeStoreDoc = func(qs *TripleStore, doc storeDoc) error {
+		_, err := qs.db.C("metadata").UpsertId(storeDocID, doc)
+		return err
+	}
+)
+
+// derivedStoreID returns the identifier of a store that has none given or
+// recorded: the hosts of the connection address addr, without credentials
+// or options, and the database.
+func derivedStoreID(addr, dbName string) string {
+	hosts := addr
+	if c, err := parseURI(addr); err == nil {
+		hosts = strings.Join(c.info.Addrs, ",")
+	}
+	return hosts + "/" + dbName
+}
+
+// loadStoreID sets the identifier of the store to the configured one, or,
+// if none is configured, to the one recorded in its metadata collection,
+// or else to derived. Unless ro is set, an identifier not yet recorded is
+// recorded, replacing any recorded before it.
+func (qs *TripleStore) loadStoreID(configured, derived string, ro bool) error {
+	doc, err := readStoreDoc(qs)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	recorded := err == nil && doc.StoreID != ""
+	switch {
+	case configured != "":
+		qs.storeID = configured
+	case recorded:
+		qs.storeID = doc.StoreID
+	default:
+		qs.storeID = derived
+	}
+	if ro || recorded && doc.StoreID == qs.storeID {
+		return nil
+	}
+	glog.Infof("Recording store_id %q in the metadata collection", qs.storeID)
+	return writeStoreDoc(qs, storeDoc{Id: storeDocID, StoreID: qs.storeID})
+}
+
+// StoreID returns the identifier of the store, given by the store_id
+// option, recorded by an earlier server, or made from the address of the
+// database.
+func (qs *TripleStore) StoreID() string {
+	return qs.storeID
+}
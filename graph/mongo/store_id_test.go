@@ -0,0 +1,81 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2"
+)
+
+func TestLoadStoreID(t *testing.T) {
+	defer func(r func(*TripleStore) (storeDoc, error), w func(*TripleStore, storeDoc) error) {
+		readStoreDoc, writeStoreDoc = r, w
+	}(readStoreDoc, writeStoreDoc)
+
+	for _, test := range []struct {
+		message    string
+		recorded   string
+		configured string
+		ro         bool
+		expect     string
+		written    string
+	}{
+		{message: "a new store", expect: "derived", written: "derived"},
+		{message: "a new read-only store", ro: true, expect: "derived"},
+		{message: "a recorded store", recorded: "recorded", expect: "recorded"},
+		{message: "a configured store", configured: "configured", expect: "configured", written: "configured"},
+		{message: "a configured recorded store", recorded: "recorded", configured: "configured", expect: "configured", written: "configured"},
+		{message: "a configured read-only store", recorded: "recorded", configured: "configured", ro: true, expect: "configured"},
+		{message: "an unchanged store", recorded: "configured", configured: "configured", expect: "configured"},
+	} {
+		var written string
+		readStoreDoc = func(*TripleStore) (storeDoc, error) {
+			if test.recorded == "" {
+				return storeDoc{}, mgo.ErrNotFound
+			}
+			return storeDoc{Id: storeDocID, StoreID: test.recorded}, nil
+		}
+		writeStoreDoc = func(_ *TripleStore, doc storeDoc) error {
+			written = doc.StoreID
+			return nil
+		}
+
+		qs := &TripleStore{}
+		if err := qs.loadStoreID(test.configured, "derived", test.ro); err != nil {
+			t.Fatalf("Unexpected error loading %s: %v", test.message, err)
+		}
+		if got := qs.StoreID(); got != test.expect {
+			t.Errorf("Unexpected store_id of %s, got:%q expect:%q", test.message, got, test.expect)
+		}
+		if written != test.written {
+			t.Errorf("Unexpected store_id recorded for %s, got:%q expect:%q", test.message, written, test.written)
+		}
+	}
+}
+
+func TestDerivedStoreID(t *testing.T) {
+	for _, test := range []struct {
+		addr   string
+		expect string
+	}{
+		{addr: "localhost:27017", expect: "localhost:27017/cayley"},
+		{addr: "mongodb://user:secret@a:27017,b:27017/?replicaSet=rs0", expect: "a:27017,b:27017/cayley"},
+	} {
+		if got := derivedStoreID(test.addr, "cayley"); got != test.expect {
+			t.Errorf("Unexpected store_id derived from %q, got:%q expect:%q", test.addr, got, test.expect)
+		}
+	}
+}
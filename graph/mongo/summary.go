@@ -0,0 +1,127 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// defaultSummaryTTL is how long a summary is kept without the
+// summary_ttl_secs option.
+const defaultSummaryTTL = time.Minute
+
+// summaryTTLFrom returns how long a summary is kept given the
+// summary_ttl_secs option. A negative value keeps none.
+func summaryTTLFrom(options graph.Options) time.Duration {
+	if secs, ok := options.IntKey("summary_ttl_secs"); ok {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	return defaultSummaryTTL
+}
+
+// A summaryCache holds the last summary of the store, so that a dashboard
+// polling it does not have the triples grouped for each poll.
+type summaryCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	made    time.Time
+	summary *graph.Summary
+}
+
+// aggregateCount returns the number of documents the pipeline over the
+// triples collection yields, grouped into a single count on the server.
+var aggregateCount = func(qs *TripleStore, pipeline []bson.M) (int64, error) {
+	pipeline = append(pipeline, bson.M{"$group": bson.M{"_id": nil, "n": bson.M{"$sum": 1}}})
+	var result struct {
+		N int64 `bson:"n"`
+	}
+	err := qs.db.C("triples").Pipe(pipeline).AllowDiskUse().One(&result)
+	if err == mgo.ErrNotFound {
+		// No documents make no group.
+		return 0, nil
+	}
+	return result.N, err
+}
+
+// dbSize returns the bytes the database takes on disk, for its data and
+// its indexes, as dbStats reports them.
+var dbSize = func(qs *TripleStore) (int64, error) {
+	var result struct {
+		StorageSize float64 `bson:"storageSize"`
+		IndexSize   float64 `bson:"indexSize"`
+	}
+	err := qs.db.Run(bson.D{{"dbStats", 1}}, &result)
+	return int64(result.StorageSize + result.IndexSize), err
+}
+
+// Summarize counts the live triples, and the distinct nodes in each
+// direction by grouping them on the server, and asks the server the size of
+// the database. The summary is kept for summary_ttl_secs. Views count
+// their own triples afresh, and leave out the size of the database, which
+// holds more than they find.
+func (qs *TripleStore) Summarize() (graph.Summary, error) {
+	cache := qs.summary
+	if qs.isView {
+		cache = nil
+	}
+	if cache != nil {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		if cache.summary != nil && now().Sub(cache.made) < cache.ttl {
+			return *cache.summary, nil
+		}
+	}
+
+	var sum graph.Summary
+	n, err := countQuery(qs, "triples", qs.live(nil))
+	if err != nil {
+		return graph.Summary{}, err
+	}
+	sum.Triples = int64(n)
+	counts := map[quad.Direction]*int64{
+		quad.Subject:   &sum.Subjects,
+		quad.Predicate: &sum.Predicates,
+		quad.Object:    &sum.Objects,
+		quad.Label:     &sum.Labels,
+	}
+	for d := quad.Subject; d <= quad.Label; d++ {
+		it := &DistinctIterator{qs: qs, dir: d, field: strings.Title(d.String())}
+		if *counts[d], err = aggregateCount(qs, it.pipeline()); err != nil {
+			return graph.Summary{}, err
+		}
+	}
+	if !qs.isView {
+		if sum.DiskSize, err = dbSize(qs); err != nil {
+			return graph.Summary{}, err
+		}
+	}
+
+	if cache != nil && cache.ttl > 0 {
+		cache.summary = &sum
+		cache.made = now()
+	}
+	return sum, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+func TestSummaryTTL(t *testing.T) {
+	for _, test := range []struct {
+		options graph.Options
+		expect  time.Duration
+	}{
+		{options: graph.Options{}, expect: defaultSummaryTTL},
+		{options: graph.Options{"summary_ttl_secs": 5.0}, expect: 5 * time.Second},
+		{options: graph.Options{"summary_ttl_secs": -1.0}, expect: 0},
+	} {
+		if got := summaryTTLFrom(test.options); got != test.expect {
+			t.Errorf("Unexpected summary TTL for %v, got:%v expect:%v", test.options, got, test.expect)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	defer func(c func(*TripleStore, string, bson.M) (int, error), a func(*TripleStore, []bson.M) (int64, error), s func(*TripleStore) (int64, error)) {
+		countQuery, aggregateCount, dbSize = c, a, s
+	}(countQuery, aggregateCount, dbSize)
+	defer func() { now = time.Now }()
+	clock := time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any, summary: &summaryCache{ttl: time.Minute}}
+	var docs []bson.M
+	for _, q := range tiedQuads {
+		docs = append(docs, qs.docFor(q))
+	}
+
+	// The fake server counts the documents and the groups of the
+	// pipelines, and tallies the queries that reach it.
+	var queries int
+	countQuery = func(_ *TripleStore, collection string, _ bson.M) (int, error) {
+		if collection != "triples" {
+			t.Errorf("Unexpected count of %s", collection)
+		}
+		queries++
+		return len(docs), nil
+	}
+	aggregateCount = func(_ *TripleStore, pipeline []bson.M) (int64, error) {
+		queries++
+		return int64(len(runPipeline(docs, pipeline))), nil
+	}
+	dbSize = func(*TripleStore) (int64, error) {
+		queries++
+		return 4096, nil
+	}
+
+	expect := graph.Summary{Triples: 6, Subjects: 3, Predicates: 2, Objects: 2, Labels: 2, DiskSize: 4096}
+	for i, step := range []struct {
+		wait    time.Duration
+		queries int
+	}{
+		{queries: 6},
+		// Kept for a minute.
+		{wait: 30 * time.Second, queries: 6},
+		{wait: 31 * time.Second, queries: 12},
+	} {
+		clock = clock.Add(step.wait)
+		got, err := qs.Summarize()
+		if err != nil {
+			t.Fatalf("Unexpected error summarizing: %v", err)
+		}
+		if got != expect {
+			t.Errorf("Unexpected summary, got:%+v expect:%+v", got, expect)
+		}
+		if queries != step.queries {
+			t.Errorf("Unexpected number of queries after summary %d, got:%d expect:%d", i, queries, step.queries)
+		}
+	}
+
+	// A view is counted afresh each time, without the size of the
+	// database.
+	view := *qs
+	view.isView = true
+	queries = 0
+	got, _ := view.Summarize()
+	if expect.DiskSize = 0; got != expect || queries != 5 {
+		t.Errorf("Unexpected summary of a view, got:%+v expect:%+v after %d queries", got, expect, queries)
+	}
+}
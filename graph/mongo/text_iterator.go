@@ -0,0 +1,279 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// textIndex is the text index on the objects of triples, made by cayley
+// init with the text_index option.
+var textIndex = mgo.Index{Key: []string{"$text:Object"}, Background: true}
+
+// textIndexed returns whether any of indexes is a text index on the objects
+// of triples.
+func textIndexed(indexes []mgo.Index) bool {
+	for _, index := range indexes {
+		for _, k := range index.Key {
+			if k == textIndex.Key[0] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A textScore is the score the server gave a text match. It is the value
+// of a score tag, and is named by the store as its decimal form, though it
+// is not a node.
+type textScore float64
+
+func (s textScore) String() string {
+	return strconv.FormatFloat(float64(s), 'g', -1, 64)
+}
+
+// textConstraint returns the query constraint selecting the triples whose
+// objects match any of the words of text. With a text index, the server's
+// text search is used, which stems words and leaves out stop words;
+// without one, each object is matched against the words in full, which
+// the server does by reading every triple.
+func textConstraint(text string, indexed bool) bson.M {
+	if indexed {
+		return bson.M{"$text": bson.M{"$search": text}}
+	}
+	return newConstraint().op("Object", "$regex", iterator.TextPattern(text)).M()
+}
+
+// TextIterator yields the triples whose objects match a text search. With
+// a text index they are ranked, the best matches first, and may be tagged
+// with their scores.
+type TextIterator struct {
+	uid        uint64
+	tags       graph.Tagger
+	qs         *TripleStore
+	text       string
+	scoreTag   string
+	ranked     bool
+	constraint bson.M
+	iter       *mgo.Iter
+	size       int64
+	result     graph.Value
+	score      textScore
+
+	// The number of misses checked again on the primary.
+	rechecks int
+}
+
+// NewTextIterator returns an iterator over the triples whose objects match
+// any of the words of text. If scoreTag is not empty and the triples
+// collection has a text index, each result is tagged with its score
+// under scoreTag. It returns the error met sizing the iterator, if any.
+func NewTextIterator(qs *TripleStore, text, scoreTag string) (*TextIterator, error) {
+	constraint := textConstraint(text, qs.textIndexed)
+	size, err := countQuery(qs, "triples", qs.live(constraint))
+	if err != nil {
+		return nil, err
+	}
+	it := &TextIterator{
+		uid:        iterator.NextUID(),
+		qs:         qs,
+		text:       text,
+		scoreTag:   scoreTag,
+		ranked:     qs.textIndexed,
+		constraint: constraint,
+		size:       int64(size),
+	}
+	it.open()
+	return it, nil
+}
+
+// textDoc is a tripleDoc with the score of its match.
+type textDoc struct {
+	tripleDoc `bson:",inline"`
+	Score     float64 `bson:"score"`
+}
+
+func (it *TextIterator) open() {
+	q := it.qs.find("triples", quad.Any, it.qs.live(it.constraint))
+	if it.ranked {
+		selector := bson.M{"score": bson.M{"$meta": "textScore"}}
+		for k, v := range tripleSelector {
+			selector[k] = v
+		}
+		q = q.Select(selector).Sort("$textScore:score")
+	}
+	it.qs.roundTrip()
+	it.iter = q.Iter()
+}
+
+func (it *TextIterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *TextIterator) Reset() {
+	it.iter.Close()
+	it.open()
+}
+
+// Rewind does nothing, as Contains makes a query of its own.
+func (it *TextIterator) Rewind() {}
+
+func (it *TextIterator) Close() {
+	it.iter.Close()
+}
+
+func (it *TextIterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *TextIterator) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	if it.scoreTag != "" && it.ranked {
+		dst[it.scoreTag] = it.score
+	}
+}
+
+func (it *TextIterator) Clone() graph.Iterator {
+	m, err := NewTextIterator(it.qs, it.text, it.scoreTag)
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return iterator.NewNull()
+	}
+	m.tags.CopyFrom(it)
+	return m
+}
+
+func (it *TextIterator) Next() bool {
+	var result textDoc
+	if it.qs.cancelled() {
+		it.iter.Close()
+		return false
+	}
+	if !it.iter.Next(&result) {
+		err := it.iter.Err()
+		if err != nil {
+			glog.Errorln("Error Nexting Iterator: ", err)
+		}
+		return false
+	}
+	it.result = it.qs.valueFor(result.tripleDoc)
+	it.score = textScore(result.Score)
+	return true
+}
+
+func (it *TextIterator) ResultTree() *graph.ResultTree {
+	return graph.NewResultTree(it.Result())
+}
+
+func (it *TextIterator) Result() graph.Value {
+	return it.result
+}
+
+func (it *TextIterator) NextPath() bool {
+	return false
+}
+
+// No subiterators.
+func (it *TextIterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+// Contains asks the server whether the triple matches. A triple found this
+// way has no score, as the server only gives one to the results of a
+// search sorted on it.
+func (it *TextIterator) Contains(v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	t, ok := v.(tripleValue)
+	if !ok {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	constraint := bson.M{"_id": t.id}
+	for k, c := range it.constraint {
+		constraint[k] = c
+	}
+	found, err := it.qs.exists(constraint, &it.rechecks)
+	if err != nil {
+		glog.Errorln("Error checking iterator: ", err)
+		return graph.ContainsLogOut(it, v, false)
+	}
+	if !found {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	it.result = v
+	it.score = 0
+	return graph.ContainsLogOut(it, v, true)
+}
+
+func (it *TextIterator) Size() (int64, bool) {
+	return it.size, true
+}
+
+var mongoTextType graph.Type
+
+func init() {
+	mongoTextType = graph.RegisterIterator("mongo_text")
+}
+
+func (it *TextIterator) Type() graph.Type { return mongoTextType }
+
+func (it *TextIterator) Optimize() (graph.Iterator, bool) { return it, false }
+
+func (it *TextIterator) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s size:%d %q)", strings.Repeat(" ", indent), it.Type(), it.size, it.text)
+}
+
+// Without a text index, the server reads every triple to find the matches.
+func (it *TextIterator) Stats() graph.IteratorStats {
+	next := int64(indexCost)
+	if !it.ranked {
+		next = queryCost
+	}
+	return graph.IteratorStats{
+		ContainsCost: queryCost,
+		NextCost:     next,
+		Size:         it.size,
+	}
+}
+
+// TextSearch returns an iterator over the triples whose objects match any
+// of the words of text, found by the server. See NewTextIterator.
+func (qs *TripleStore) TextSearch(text, scoreTag string) graph.Iterator {
+	if iterator.TextPattern(text) == "" {
+		return iterator.NewNull()
+	}
+	it, err := NewTextIterator(qs, text, scoreTag)
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return iterator.NewNull()
+	}
+	return it
+}
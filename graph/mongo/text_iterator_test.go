@@ -0,0 +1,89 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+func TestTextIndexed(t *testing.T) {
+	if textIndexed(tripleIndexes) {
+		t.Error("Unexpected text index among the default indexes")
+	}
+	if !textIndexed(append(tripleIndexes, textIndex)) {
+		t.Error("Text index not found")
+	}
+	// The server lists a compound text index with its other keys.
+	if !textIndexed([]mgo.Index{{Key: []string{"Label", "$text:Object"}}}) {
+		t.Error("Compound text index not found")
+	}
+}
+
+func TestTextConstraint(t *testing.T) {
+	for _, test := range []struct {
+		indexed bool
+		expect  bson.M
+	}{
+		{
+			indexed: true,
+			expect:  bson.M{"$text": bson.M{"$search": "go (programming"}},
+		},
+		{
+			expect: bson.M{"Object": bson.M{"$regex": `(?i)(^|\W)(go|\(programming)(\W|$)`}},
+		},
+	} {
+		if got := textConstraint("go (programming", test.indexed); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected constraint with text index %t, got:%v expect:%v", test.indexed, got, test.expect)
+		}
+	}
+}
+
+func TestTextScoreTag(t *testing.T) {
+	qs := &TripleStore{idCache: NewIDLru(10)}
+	it := &TextIterator{qs: qs, scoreTag: "score", ranked: true, score: 1.25}
+	tags := make(map[string]graph.Value)
+	it.TagResults(tags)
+	if name := qs.NameOf(tags["score"]); name != "1.25" {
+		t.Errorf("Unexpected name of score, got:%q expect:%q", name, "1.25")
+	}
+	names, err := qs.NamesOf([]graph.Value{tags["score"]})
+	if err != nil || !reflect.DeepEqual(names, []string{"1.25"}) {
+		t.Errorf("Unexpected names of score, got:%q, %v", names, err)
+	}
+
+	// Without a text index there is no score to give.
+	it.ranked = false
+	tags = make(map[string]graph.Value)
+	it.TagResults(tags)
+	if _, ok := tags["score"]; ok {
+		t.Error("Unexpected score from an unranked search")
+	}
+}
+
+func TestTextSearchError(t *testing.T) {
+	defer func(c func(*TripleStore, string, bson.M) (int, error)) { countQuery = c }(countQuery)
+	countQuery = func(*TripleStore, string, bson.M) (int, error) { return 0, errors.New("no server") }
+	qs := &TripleStore{}
+	if it := qs.TextSearch("alice", "score"); it.Type() != graph.Null {
+		t.Errorf("Unexpected text search without a count, got:%s", it.DebugString(0))
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// sleep waits for the writes a throttle holds back.
+var sleep = time.Sleep
+
+// writeLimitFrom returns the write limit given by the write_quads_per_sec
+// and write_bytes_per_sec options.
+func writeLimitFrom(options graph.Options) graph.WriteLimit {
+	var limit graph.WriteLimit
+	if n, ok := options.IntKey("write_quads_per_sec"); ok && n > 0 {
+		limit.QuadsPerSec = int64(n)
+	}
+	if n, ok := options.IntKey("write_bytes_per_sec"); ok && n > 0 {
+		limit.BytesPerSec = int64(n)
+	}
+	return limit
+}
+
+// A bucket is a token bucket filled at rate tokens a second, holding at
+// most a tenth of a second's worth, so that writes are spread evenly
+// rather than sent in bursts. Takes beyond what it holds are lent, and
+// the taker waits until the bucket has filled to repay them, so a write
+// larger than the bucket still goes through in its turn.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+const bucketSecs = 0.1
+
+func (b *bucket) fill(t time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += t.Sub(b.last).Seconds() * b.rate
+	}
+	if max := b.rate * bucketSecs; b.tokens > max {
+		b.tokens = max
+	}
+	b.last = t
+}
+
+// take takes n tokens at t, returning how long the taker must wait for
+// them.
+func (b *bucket) take(n float64, t time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.fill(t)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// A writeThrottle holds writes to a graph.WriteLimit. It is shared by the
+// views of a store.
+type writeThrottle struct {
+	mu    sync.Mutex
+	limit graph.WriteLimit
+	quads bucket
+	bytes bucket
+}
+
+func newWriteThrottle(limit graph.WriteLimit) *writeThrottle {
+	t := &writeThrottle{}
+	t.set(limit)
+	return t
+}
+
+func (t *writeThrottle) set(limit graph.WriteLimit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := now()
+	// What was filled at the old rate is kept.
+	t.quads.fill(now)
+	t.bytes.fill(now)
+	t.limit = limit
+	t.quads.rate = float64(limit.QuadsPerSec)
+	t.bytes.rate = float64(limit.BytesPerSec)
+}
+
+func (t *writeThrottle) get() graph.WriteLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// wait holds the writing of q until the limit allows it.
+func (t *writeThrottle) wait(q quad.Quad) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	now := now()
+	d := t.quads.take(1, now)
+	size := len(q.Subject) + len(q.Predicate) + len(q.Object) + len(q.Label)
+	if bd := t.bytes.take(float64(size), now); bd > d {
+		d = bd
+	}
+	t.mu.Unlock()
+	if d > 0 {
+		sleep(d)
+	}
+}
+
+func (qs *TripleStore) WriteLimit() graph.WriteLimit {
+	return qs.throttle.get()
+}
+
+func (qs *TripleStore) SetWriteLimit(limit graph.WriteLimit) {
+	qs.throttle.set(limit)
+}
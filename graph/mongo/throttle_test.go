@@ -0,0 +1,95 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+)
+
+// mostInWindow returns the most of times that fall in any window of length
+// w.
+func mostInWindow(times []time.Time, w time.Duration) int {
+	var most, start int
+	for i, t := range times {
+		for t.Sub(times[start]) >= w {
+			start++
+		}
+		if n := i - start + 1; n > most {
+			most = n
+		}
+	}
+	return most
+}
+
+func TestWriteLimit(t *testing.T) {
+	defer func() { now, sleep = time.Now, time.Sleep }()
+	clock := time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	sleep = func(d time.Duration) { clock = clock.Add(d) }
+
+	limit := writeLimitFrom(graph.Options{"write_quads_per_sec": 100.0})
+	if limit != (graph.WriteLimit{QuadsPerSec: 100}) {
+		t.Fatalf("Unexpected write limit, got:%+v", limit)
+	}
+	qs := &TripleStore{throttle: newWriteThrottle(limit)}
+	q := quad.Quad{"alice", "follows", "bob", ""}
+
+	// A runaway load writes as fast as it is let.
+	write := func(d time.Duration) []time.Time {
+		var times []time.Time
+		for end := clock.Add(d); clock.Before(end); {
+			qs.throttle.wait(q)
+			times = append(times, clock)
+		}
+		return times
+	}
+	for _, test := range []struct {
+		limit graph.WriteLimit
+		rate  int
+	}{
+		{limit: graph.WriteLimit{QuadsPerSec: 100}, rate: 100},
+		// The limit is lowered while the load runs.
+		{limit: graph.WriteLimit{QuadsPerSec: 20}, rate: 20},
+		// Each quad is 15 bytes of names.
+		{limit: graph.WriteLimit{QuadsPerSec: 100, BytesPerSec: 150}, rate: 10},
+	} {
+		qs.SetWriteLimit(test.limit)
+		if got := qs.WriteLimit(); got != test.limit {
+			t.Errorf("Unexpected write limit, got:%+v expect:%+v", got, test.limit)
+		}
+		times := write(10 * time.Second)
+		// The bucket lets a tenth of a second's writes through at once.
+		burst := test.rate/10 + 1
+		if got, most := mostInWindow(times, time.Second), test.rate+burst; got > most {
+			t.Errorf("Unexpected writes in a second under %+v, got:%d expect at most:%d", test.limit, got, most)
+		}
+		if got, least := len(times), 10*test.rate-burst; got < least || got > 10*test.rate+burst {
+			t.Errorf("Unexpected writes in ten seconds under %+v, got:%d expect about:%d", test.limit, got, 10*test.rate)
+		}
+	}
+
+	qs.SetWriteLimit(graph.WriteLimit{})
+	start := clock
+	for i := 0; i < 1000; i++ {
+		qs.throttle.wait(q)
+	}
+	if clock != start {
+		t.Errorf("Unexpected wait without a write limit: %v", clock.Sub(start))
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+// With the timestamps option set, each triple document records when it was
+// written, and, with soft deletes, when it was deleted. A view of the store
+// as of a time then holds the triples that had been written and not yet
+// deleted by that time.
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/graph"
+)
+
+const (
+	// createdField holds the time a triple document was written.
+	createdField = "CreatedAt"
+
+	// deletedAtField holds the time a triple document was tombstoned.
+	deletedAtField = "DeletedAt"
+)
+
+// AsOf returns a read-only view of the store as it was at t. Triples written
+// without timestamps are taken to have always been there, and triples
+// removed without soft deletes are gone from every view. The nodes of the
+// view are those of the store now.
+func (qs *TripleStore) AsOf(t time.Time) graph.TripleStore {
+	view := *qs
+	view.asOf = t
+	view.isView = true
+	return graph.ReadOnly(&view)
+}
+
+// asOfConstraint returns constraint narrowed to the triples there were at
+// the time of the view.
+func (qs *TripleStore) asOfConstraint(constraint bson.M) bson.M {
+	c := bson.M{"$and": []bson.M{
+		{"$or": []bson.M{
+			{createdField: bson.M{"$lte": qs.asOf}},
+			{createdField: bson.M{"$exists": false}},
+		}},
+		{"$or": []bson.M{
+			{deletedField: bson.M{"$ne": true}},
+			{deletedAtField: bson.M{"$gt": qs.asOf}},
+		}},
+	}}
+	for k, v := range constraint {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,132 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/quad"
+)
+
+// matches reports whether doc matches constraint, for the few query
+// operators that views as of a time and ranges use.
+func matches(doc, constraint bson.M) bool {
+	for k, v := range constraint {
+		switch k {
+		case "$and":
+			for _, c := range v.([]bson.M) {
+				if !matches(doc, c) {
+					return false
+				}
+			}
+			continue
+		case "$or":
+			any := false
+			for _, c := range v.([]bson.M) {
+				any = any || matches(doc, c)
+			}
+			if !any {
+				return false
+			}
+			continue
+		}
+		field, has := doc[k]
+		ops, ok := v.(bson.M)
+		if !ok {
+			if field != v {
+				return false
+			}
+			continue
+		}
+		for op, arg := range ops {
+			var ok bool
+			switch op {
+			case "$eq":
+				ok = has && field == arg
+			case "$ne":
+				ok = field != arg
+			case "$exists":
+				ok = has == arg.(bool)
+			case "$lte":
+				ok = has && !before(arg, field)
+			case "$gt":
+				ok = has && before(arg, field)
+			case "$gte":
+				ok = has && !before(field, arg)
+			case "$lt":
+				ok = has && before(field, arg)
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestAsOf(t *testing.T) {
+	base := time.Date(2014, 8, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return base.Add(time.Duration(hours) * time.Hour) }
+
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any, softDelete: true, timestamps: true}
+	// Written before timestamps were kept.
+	old := qs.docFor(quad.Quad{"A", "follows", "B", ""})
+	// Written as writeTriple would, at hours 1 and 2, and tombstoned, as
+	// tombstone would, at hour 3.
+	write := func(q quad.Quad, hours int) bson.M {
+		doc := qs.docFor(q)
+		doc[createdField] = at(hours)
+		return doc
+	}
+	first := write(quad.Quad{"B", "follows", "C", ""}, 1)
+	second := write(quad.Quad{"C", "follows", "D", ""}, 2)
+	first[deletedField] = true
+	first[deletedAtField] = at(3)
+	docs := map[string]bson.M{"old": old, "first": first, "second": second}
+
+	for _, test := range []struct {
+		hours  int
+		expect []string
+	}{
+		{hours: 0, expect: []string{"old"}},
+		{hours: 1, expect: []string{"first", "old"}},
+		{hours: 2, expect: []string{"first", "old", "second"}},
+		{hours: 3, expect: []string{"old", "second"}},
+	} {
+		view := *qs
+		view.asOf = at(test.hours)
+		constraint := view.live(bson.M{"Predicate": "follows"})
+		var got []string
+		for name, doc := range docs {
+			if matches(doc, constraint) {
+				got = append(got, name)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Unexpected triples as of hour %d, got:%v expect:%v", test.hours, got, test.expect)
+		}
+	}
+
+	if got := qs.live(nil); !reflect.DeepEqual(got, bson.M{deletedField: bson.M{"$ne": true}}) {
+		t.Errorf("Unexpected constraint for now, got:%v", got)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// deletedField marks a triple document as deleted, when the soft_delete
+// option is set. Such a tombstoned document stays in the collection, but
+// is no longer a triple of the store.
+const deletedField = "Deleted"
+
+// live returns constraint narrowed to the triples that have not been
+// deleted, or, in a view as of a time, to the triples there were then.
+// Otherwise, without soft deletes, every document is live and constraint is
+// returned as it is. In a view restricted to some labels, it is narrowed to
+// their triples as well.
+func (qs *TripleStore) live(constraint bson.M) bson.M {
+	return qs.permitted(qs.sourced(qs.current(constraint)))
+}
+
+// current returns constraint narrowed as live does, but for the labels of a
+// restricted view.
+func (qs *TripleStore) current(constraint bson.M) bson.M {
+	if !qs.asOf.IsZero() {
+		return qs.asOfConstraint(constraint)
+	}
+	if !qs.softDelete {
+		return constraint
+	}
+	c := bson.M{deletedField: bson.M{"$ne": true}}
+	for k, v := range constraint {
+		c[k] = v
+	}
+	return c
+}
+
+// isLive returns whether the triple document with the given id exists and
+// has not been deleted.
+func (qs *TripleStore) isLive(id string) (bool, error) {
+	return qs.exists(bson.M{"_id": id}, nil)
+}
+
+// liveIDs returns which of the triple documents with the given ids exist
+// and have not been deleted, with one query.
+func (qs *TripleStore) liveIDs(ids []string) (map[string]bool, error) {
+	live := make(map[string]bool)
+	it := qs.db.C("triples").Find(qs.live(bson.M{"_id": bson.M{"$in": ids}})).Select(bson.M{"_id": 1}).Iter()
+	var doc struct {
+		ID string `bson:"_id"`
+	}
+	for it.Next(&doc) {
+		live[doc.ID] = true
+	}
+	return live, it.Close()
+}
+
+// tombstone marks the live triple document with the given id as deleted,
+// and when, if timestamps are kept. It returns mgo.ErrNotFound if there is
+// no such document.
+func (qs *TripleStore) tombstone(id string) error {
+	set := bson.M{deletedField: true}
+	if qs.timestamps {
+		set[deletedAtField] = now()
+	}
+	return qs.db.C("triples").Update(
+		qs.live(bson.M{"_id": id}),
+		bson.M{"$set": set},
+	)
+}
+
+// revive brings back the deleted triple document with the given id,
+// returning whether there was one. If timestamps are kept, it is as if the
+// triple were written anew, so views from before it was deleted no longer
+// hold it.
+func (qs *TripleStore) revive(id string) (bool, error) {
+	update := bson.M{"$unset": bson.M{deletedField: "", deletedAtField: ""}}
+	if qs.timestamps {
+		update["$set"] = bson.M{createdField: now()}
+	}
+	err := qs.db.C("triples").Update(
+		bson.M{"_id": id, deletedField: true},
+		update,
+	)
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
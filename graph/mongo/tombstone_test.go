@@ -0,0 +1,85 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/quad"
+)
+
+func TestLiveConstraint(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any}
+	hash := qs.ConvertStringToByteHash("A")
+
+	// Without soft deletes, constraints are left alone.
+	c := qs.constraintFor(quad.Subject, "A", hash)
+	if got := qs.live(c); !reflect.DeepEqual(got, bson.M{"Subject": "A"}) {
+		t.Errorf("Unexpected constraint without soft_delete, got:%v", got)
+	}
+	if got := qs.live(nil); got != nil {
+		t.Errorf("Unexpected all triples constraint without soft_delete, got:%v", got)
+	}
+
+	qs.softDelete = true
+	expect := bson.M{"Subject": "A", deletedField: bson.M{"$ne": true}}
+	if got := qs.live(c); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected constraint with soft_delete, got:%v expect:%v", got, expect)
+	}
+	if _, ok := c[deletedField]; ok {
+		t.Error("Narrowing a constraint changed the original")
+	}
+	expect = bson.M{deletedField: bson.M{"$ne": true}}
+	if got := qs.live(nil); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected all triples constraint with soft_delete, got:%v expect:%v", got, expect)
+	}
+}
+
+func TestQuadExists(t *testing.T) {
+	defer func(f func(*mgo.Database, bson.M) (bool, error)) { anyIn = f }(anyIn)
+	docs := []bson.M{
+		{"Subject": "alice", "Predicate": "follows", "Object": "bob", "Label": ""},
+		{"Subject": "alice", "Predicate": "follows", "Object": "carol", "Label": "", deletedField: true},
+	}
+	anyIn = func(db *mgo.Database, constraint bson.M) (bool, error) {
+		for _, doc := range docs {
+			if matches(doc, constraint) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	qs := &TripleStore{hasher: sha1.New(), shardKey: quad.Any, softDelete: true}
+	for _, test := range []struct {
+		message string
+		quad    quad.Quad
+		expect  bool
+	}{
+		{message: "find a live triple", quad: quad.Quad{"alice", "follows", "bob", ""}, expect: true},
+		{message: "miss a deleted triple", quad: quad.Quad{"alice", "follows", "carol", ""}},
+		{message: "miss an absent triple", quad: quad.Quad{"alice", "follows", "dave", ""}},
+	} {
+		got, err := qs.QuadExists(test.quad)
+		if err != nil || got != test.expect {
+			t.Errorf("Failed to %s, got:%t err:%v expect:%t", test.message, got, err, test.expect)
+		}
+	}
+}
@@ -12,13 +12,22 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Package mongo is a backend that keeps its triples and nodes in MongoDB.
+//
+// The calls that reach the server are made through package variables,
+// such as countQuery and openCursor, rather than through the session
+// directly. Tests set them to fakes for the length of the test, so that
+// the queries the store makes and what it does with their results can be
+// checked without a server.
 package mongo
 
 import (
-	"crypto/sha1"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"hash"
 	"io"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -33,8 +42,34 @@ func init() {
 	graph.RegisterTripleStore("mongo", true, newTripleStore, createNewMongoGraph)
 }
 
-// Guarantee we satisfy graph.Bulkloader.
-var _ graph.BulkLoader = (*TripleStore)(nil)
+// Guarantee we satisfy graph.Bulkloader, graph.DistinctLister,
+// graph.BulkNamer, graph.NamePinner, graph.TimeTraveler,
+// graph.PredicateCounter, graph.FanOutCounter, graph.Scoper,
+// graph.IndexAdvisor, graph.TextSearcher, graph.LabelRestricter,
+// graph.WriteLimiter, graph.RangeLister, graph.ConstraintDeleter,
+// graph.Flusher, graph.Identified, graph.Completer, graph.Summarizer and
+// graph.Capable.
+var (
+	_ graph.BulkLoader        = (*TripleStore)(nil)
+	_ graph.DistinctLister    = (*TripleStore)(nil)
+	_ graph.BulkNamer         = (*TripleStore)(nil)
+	_ graph.NamePinner        = (*TripleStore)(nil)
+	_ graph.TimeTraveler      = (*TripleStore)(nil)
+	_ graph.PredicateCounter  = (*TripleStore)(nil)
+	_ graph.FanOutCounter     = (*TripleStore)(nil)
+	_ graph.Scoper            = (*TripleStore)(nil)
+	_ graph.IndexAdvisor      = (*TripleStore)(nil)
+	_ graph.TextSearcher      = (*TripleStore)(nil)
+	_ graph.LabelRestricter   = (*TripleStore)(nil)
+	_ graph.WriteLimiter      = (*TripleStore)(nil)
+	_ graph.RangeLister       = (*TripleStore)(nil)
+	_ graph.ConstraintDeleter = (*TripleStore)(nil)
+	_ graph.Flusher           = (*TripleStore)(nil)
+	_ graph.Identified        = (*TripleStore)(nil)
+	_ graph.Completer         = (*TripleStore)(nil)
+	_ graph.Summarizer        = (*TripleStore)(nil)
+	_ graph.Capable           = (*TripleStore)(nil)
+)
 
 const DefaultDBName = "cayley"
 
@@ -43,60 +78,308 @@ type TripleStore struct {
 	db      *mgo.Database
 	hasher  hash.Hash
 	idCache *IDLru
+	ids     idScheme
+
+	// Direction of the node used as the shard key, or quad.Any.
+	shardKey quad.Direction
+
+	// Index keys to hint for queries on each direction.
+	hints [quad.Label + 1][]string
+
+	// Whether the triples collection has an index led by each direction's
+	// field, for estimating the cost of queries.
+	indexed [quad.Label + 1]bool
+
+	// Whether the triples collection has a text index on objects, for
+	// searching them.
+	textIndexed bool
+
+	// Whether the nodes collection has an index on names, for completing
+	// them.
+	nameIndexed bool
+
+	// Whether removed triples are kept as tombstones.
+	softDelete bool
+
+	// How long iterators keep a cursor open before reopening it, or zero.
+	cursorRefresh time.Duration
+
+	// How long iterators wait for each document from a cursor, or zero
+	// for as long as it takes.
+	nextTimeout time.Duration
+
+	// How many times each iterator reissues its query after a transient
+	// cursor error.
+	cursorRetries int
+
+	// Stops queries being sent to a failing server, or nil. Views share
+	// the breaker of their store.
+	breaker *breaker
+
+	// Whether triple documents record when they were written and
+	// deleted.
+	timestamps bool
+
+	// The time the store is viewed as of, or zero for now.
+	asOf time.Time
+
+	// The query the store is viewed for, or nil.
+	scope *graph.QueryScope
+
+	// The names and hashes of the only labels whose triples the view
+	// finds, if it is restricted to some.
+	labels      []string
+	labelHashes map[string]bool
+
+	// Suggests indexes for the queries made, or nil.
+	advisor *indexAdvisor
+
+	// Whether closed iterators are kept to be reused.
+	poolIterators bool
+
+	// The database on the primary, if reads go to secondaries and misses
+	// are checked again there for recheckWindow after the last write, at
+	// most maxRechecks times by each iterator.
+	primary       *mgo.Database
+	recheckWindow time.Duration
+	maxRechecks   int
+	writes        *writeClock
+	throttle      *writeThrottle
+
+	// Names of nodes kept on disk beneath idCache, or nil.
+	names *diskNames
+
+	// The length over which names are kept in GridFS rather than in
+	// documents, or 0.
+	externalAt int
+
+	// The percentage of the triples that an iterator must select to scan
+	// them all instead of querying, or 0.
+	scanPercent int
+
+	// The number of results over which Unique and Materialize iterators
+	// spill them to temporary collections, or 0.
+	spillAt int
+
+	// Counts refreshed in the background for sizing iterators, or nil.
+	stats *statsCache
+
+	// The last summary of the store.
+	summary *summaryCache
+
+	// Whether flushes commit the journal rather than fsync the data
+	// files.
+	flushJournal bool
+
+	// Whether triple documents record the languages of their objects.
+	recordLangs bool
+
+	// The identifier of the store.
+	storeID string
+
+	// The source recorded for the triples written, the only source whose
+	// triples the view finds, and the tag iterators tag the source of
+	// each triple with, if any.
+	source       string
+	sourceFilter string
+	sourceTag    string
+
+	// Whether the store is a view of another, sharing its session.
+	isView bool
 }
 
 func createNewMongoGraph(addr string, options graph.Options) error {
-	conn, err := mgo.Dial(addr)
+	conn, err := dial(addr, options)
 	if err != nil {
 		return err
 	}
-	conn.SetSafe(&mgo.Safe{})
 	dbName := DefaultDBName
 	if val, ok := options.StringKey("database_name"); ok {
 		dbName = val
 	}
-	db := conn.DB(dbName)
-	indexOpts := mgo.Index{
-		Key:        []string{"Sub"},
-		Unique:     false,
-		DropDups:   false,
-		Background: true,
-		Sparse:     true,
-	}
-	db.C("triples").EnsureIndex(indexOpts)
-	indexOpts.Key = []string{"Pred"}
-	db.C("triples").EnsureIndex(indexOpts)
-	indexOpts.Key = []string{"Obj"}
-	db.C("triples").EnsureIndex(indexOpts)
-	indexOpts.Key = []string{"Label"}
-	db.C("triples").EnsureIndex(indexOpts)
+	if _, err := idSchemeFrom(options); err != nil {
+		return err
+	}
+	shardKey, err := shardKeyFrom(options)
+	if err != nil {
+		return err
+	}
+	advisor, err := indexAdvisorFrom(options)
+	if err != nil {
+		return err
+	}
+	algorithm, err := hashAlgorithmFrom(options)
+	if err != nil {
+		return err
+	}
+	compressors, err := compressorsFrom(options)
+	if err != nil {
+		return err
+	}
+	salt, _ := options.StringKey("hash_salt")
+	qs := TripleStore{db: conn.DB(dbName), hasher: hasherFor(algorithm, salt)}
+	if err := qs.verifyHasher(newHasherDoc(algorithm, salt), false); err != nil {
+		return err
+	}
+	// Collections are created with their compression before the indexes
+	// create them without it.
+	if err := createCompressed(conn.DB(dbName), compressors); err != nil {
+		return err
+	}
+	if advisor == nil {
+		// Stores with an advisor are only given the indexes their
+		// queries need.
+		ensureTripleIndexes(conn.DB(dbName))
+	}
+	if text, _ := options.BoolKey("text_index"); text {
+		conn.DB(dbName).C("triples").EnsureIndex(textIndex)
+	}
+	if name, _ := options.BoolKey("name_index"); name {
+		conn.DB(dbName).C("nodes").EnsureIndex(nameIndex)
+	}
+	if shardKey != quad.Any {
+		return shardTriples(conn, conn.DB(dbName))
+	}
 	return nil
 }
 
 func newTripleStore(addr string, options graph.Options) (graph.TripleStore, error) {
 	var qs TripleStore
-	conn, err := mgo.Dial(addr)
+	conn, err := dial(addr, options)
 	if err != nil {
 		return nil, err
 	}
-	conn.SetSafe(&mgo.Safe{})
+	ro, _ := options.BoolKey("read_only")
+	secondaries, _ := options.BoolKey("secondary_reads")
+	if (ro || secondaries) && conn.Mode() == mgo.Strong {
+		// Nothing will be written, or stale reads are accepted, so reads
+		// may be spread to secondaries, unless the connection URI gives
+		// a read preference of its own.
+		conn.SetMode(mgo.SecondaryPreferred, true)
+	}
 	dbName := DefaultDBName
 	if val, ok := options.StringKey("database_name"); ok {
 		dbName = val
 	}
+	qs.writes = &writeClock{}
+	qs.throttle = newWriteThrottle(writeLimitFrom(options))
+	qs.externalAt = externalLiteralsFrom(options)
+	qs.scanPercent = scanPercentFrom(options)
+	qs.spillAt = spillAtFrom(options)
+	if ro && qs.spillAt > 0 {
+		return nil, errors.New("mongo: spill_at cannot write temporary collections in a read_only database")
+	}
+	qs.recheckWindow, qs.maxRechecks = recheckOptionsFrom(options)
+	if secondaries && !ro && qs.recheckWindow > 0 {
+		// Writes go to the primary, so it always knows of them.
+		primary := conn.Copy()
+		primary.SetMode(mgo.Primary, true)
+		qs.primary = primary.DB(dbName)
+	}
+	qs.ids, err = idSchemeFrom(options)
+	if err != nil {
+		return nil, err
+	}
+	qs.shardKey, err = shardKeyFrom(options)
+	if err != nil {
+		return nil, err
+	}
+	qs.hints = hintsFrom(options)
+	qs.softDelete, _ = options.BoolKey("soft_delete")
+	qs.timestamps, _ = options.BoolKey("timestamps")
+	qs.recordLangs, _ = options.BoolKey("record_langs")
+	var noTimeout bool
+	noTimeout, qs.cursorRefresh = cursorOptionsFrom(options)
+	qs.nextTimeout = nextTimeoutFrom(options)
+	qs.cursorRetries = cursorRetriesFrom(options)
+	qs.breaker = breakerFrom(options)
+	qs.poolIterators, _ = options.BoolKey("pool_iterators")
+	qs.flushJournal = flushJournalFrom(options)
+	qs.summary = &summaryCache{ttl: summaryTTLFrom(options)}
+	if noTimeout {
+		// Idle cursors are left open until they are exhausted or closed.
+		conn.SetCursorTimeout(0)
+	}
 	qs.db = conn.DB(dbName)
 	qs.session = conn
-	qs.hasher = sha1.New()
+	indexes, err := qs.db.C("triples").Indexes()
+	if err != nil {
+		// cayley init creates an index for every direction.
+		glog.Warningln("Could not list triple indexes, assuming all directions are indexed: ", err)
+		indexes = tripleIndexes
+	}
+	qs.indexed = indexedDirections(indexes)
+	qs.textIndexed = textIndexed(indexes)
+	if indexes, err := qs.db.C("nodes").Indexes(); err != nil {
+		glog.Warningln("Could not list node indexes, assuming names are not indexed: ", err)
+	} else {
+		qs.nameIndexed = nameIndexed(indexes)
+	}
+	qs.advisor, err = indexAdvisorFrom(options)
+	if err != nil {
+		return nil, err
+	}
+	if qs.advisor != nil {
+		if ro && qs.advisor.create {
+			return nil, errors.New("mongo: index_advisor cannot create indexes in a read_only database")
+		}
+		for _, index := range indexes {
+			qs.advisor.existing = append(qs.advisor.existing, index.Key)
+		}
+	}
+	algorithm, err := hashAlgorithmFrom(options)
+	if err != nil {
+		return nil, err
+	}
+	salt, _ := options.StringKey("hash_salt")
+	qs.hasher = hasherFor(algorithm, salt)
 	qs.idCache = NewIDLru(1 << 16)
+	qs.names, err = diskNamesFrom(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := qs.verifyHasher(newHasherDoc(algorithm, salt), ro); err != nil {
+		return nil, err
+	}
+	storeID, _ := options.StringKey("store_id")
+	if err := qs.loadStoreID(storeID, derivedStoreID(addr, dbName), ro); err != nil {
+		return nil, err
+	}
+	if err := qs.restoreNodes(ro); err != nil {
+		return nil, err
+	}
+	if every := statsRefreshFrom(options); every > 0 {
+		if err := qs.startStatsRefresh(every); err != nil {
+			return nil, err
+		}
+	}
 	return &qs, nil
 }
 
+// rebuildNodes rebuilds the nodes collection of qs from its triples.
+var rebuildNodes = (*TripleStore).RebuildNodes
+
+// restoreNodes rebuilds the nodes collection if it is empty while there are
+// triples, since without it no node can be named and queries quietly
+// return nothing. A read-only store cannot rebuild it, and is refused.
+func (qs *TripleStore) restoreNodes(ro bool) error {
+	nodes, err := countQuery(qs, "nodes", nil)
+	if err != nil || nodes != 0 {
+		return err
+	}
+	triples, err := countQuery(qs, "triples", qs.live(nil))
+	if err != nil || triples == 0 {
+		return err
+	}
+	if ro {
+		return errors.New("mongo: nodes collection is missing; open the database without read_only to rebuild it")
+	}
+	glog.Warningln("Nodes collection is missing, rebuilding it from triples")
+	return rebuildNodes(qs)
+}
+
 func (qs *TripleStore) getIdForTriple(t quad.Quad) string {
-	id := qs.ConvertStringToByteHash(t.Subject)
-	id += qs.ConvertStringToByteHash(t.Predicate)
-	id += qs.ConvertStringToByteHash(t.Object)
-	id += qs.ConvertStringToByteHash(t.Label)
-	return id
+	return qs.idFor(qs.hashesFor(t))
 }
 
 func (qs *TripleStore) ConvertStringToByteHash(s string) string {
@@ -121,7 +404,7 @@ func (qs *TripleStore) updateNodeBy(node_name string, inc int) {
 		if err.Error() == "not found" {
 			// Not found. Okay.
 			size.Id = node.(string)
-			size.Name = node_name
+			size.Name = qs.storedName(node_name)
 			size.Size = inc
 		} else {
 			glog.Errorf("Error: %v", err)
@@ -129,7 +412,7 @@ func (qs *TripleStore) updateNodeBy(node_name string, inc int) {
 		}
 	} else {
 		size.Id = node.(string)
-		size.Name = node_name
+		size.Name = qs.storedName(node_name)
 		size.Size += inc
 	}
 
@@ -141,6 +424,8 @@ func (qs *TripleStore) updateNodeBy(node_name string, inc int) {
 				glog.Errorf("Error: %v while removing node %s", err, node_name)
 				return
 			}
+			qs.forgetName(node.(string))
+			qs.removeLiteral(node_name)
 		}
 	}
 
@@ -150,23 +435,46 @@ func (qs *TripleStore) updateNodeBy(node_name string, inc int) {
 	}
 }
 
+// writtenDoc returns the document written for t, recording when and from
+// what source it was written, if the store records them.
+func (qs *TripleStore) writtenDoc(t quad.Quad) bson.M {
+	doc := qs.docFor(t)
+	if qs.timestamps {
+		doc[createdField] = now()
+	}
+	if qs.source != "" {
+		doc[sourceField] = qs.source
+	}
+	return doc
+}
+
 func (qs *TripleStore) writeTriple(t quad.Quad) bool {
-	tripledoc := bson.M{
-		"_id":       qs.getIdForTriple(t),
-		"Subject":   t.Subject,
-		"Predicate": t.Predicate,
-		"Object":    t.Object,
-		"Label":     t.Label,
-	}
-	err := qs.db.C("triples").Insert(tripledoc)
+	qs.throttle.wait(t)
+	if err := qs.putLiterals(t); err != nil {
+		glog.Errorf("Error: %v while writing literals of triple %v", err, t)
+		return false
+	}
+	err := qs.db.C("triples").Insert(qs.writtenDoc(t))
 	if err != nil {
 		// Among the reasons I hate MongoDB. "Errors don't happen! Right guys?"
 		if err.(*mgo.LastError).Code == 11000 {
-			return false
+			if !qs.softDelete {
+				return false
+			}
+			// The triple may have been deleted, leaving its tombstone.
+			revived, err := qs.revive(qs.getIdForTriple(t))
+			if err != nil {
+				glog.Errorf("Error: %v while restoring triple %v", err, t)
+			}
+			if revived {
+				qs.writes.wrote()
+			}
+			return revived
 		}
 		glog.Errorf("Error: %v", err)
 		return false
 	}
+	qs.writes.wrote()
 	return true
 }
 
@@ -181,6 +489,7 @@ func (qs *TripleStore) AddTriple(t quad.Quad) {
 }
 
 func (qs *TripleStore) AddTripleSet(in []quad.Quad) {
+	safe := qs.session.Safe()
 	qs.session.SetSafe(nil)
 	ids := make(map[string]int)
 	for _, t := range in {
@@ -197,17 +506,24 @@ func (qs *TripleStore) AddTripleSet(in []quad.Quad) {
 	for k, v := range ids {
 		qs.updateNodeBy(k, v)
 	}
-	qs.session.SetSafe(&mgo.Safe{})
+	qs.session.SetSafe(safe)
 }
 
 func (qs *TripleStore) RemoveTriple(t quad.Quad) {
-	err := qs.db.C("triples").RemoveId(qs.getIdForTriple(t))
+	qs.throttle.wait(t)
+	var err error
+	if qs.softDelete {
+		err = qs.tombstone(qs.getIdForTriple(t))
+	} else {
+		err = qs.db.C("triples").RemoveId(qs.getIdForTriple(t))
+	}
 	if err == mgo.ErrNotFound {
 		return
 	} else if err != nil {
 		glog.Errorf("Error: %v while removing triple %v", err, t)
 		return
 	}
+	qs.writes.wrote()
 	qs.updateNodeBy(t.Subject, -1)
 	qs.updateNodeBy(t.Predicate, -1)
 	qs.updateNodeBy(t.Object, -1)
@@ -218,23 +534,94 @@ func (qs *TripleStore) RemoveTriple(t quad.Quad) {
 
 func (qs *TripleStore) Quad(val graph.Value) quad.Quad {
 	var bsonDoc bson.M
-	err := qs.db.C("triples").FindId(val.(string)).One(&bsonDoc)
+	qs.roundTrip()
+	err := qs.db.C("triples").FindId(val.(tripleValue).id).One(&bsonDoc)
 	if err != nil {
 		glog.Errorf("Error: Couldn't retrieve triple %s %v", val, err)
 	}
-	return quad.Quad{
+	return qs.quadOf(
 		bsonDoc["Subject"].(string),
 		bsonDoc["Predicate"].(string),
 		bsonDoc["Object"].(string),
 		bsonDoc["Label"].(string),
+	)
+}
+
+// QuadKey returns the _id of the triple v.
+func (qs *TripleStore) QuadKey(v graph.Value) string {
+	return v.(tripleValue).id
+}
+
+// QuadOfKey returns the live triple with the _id key.
+func (qs *TripleStore) QuadOfKey(key string) (quad.Quad, error) {
+	var doc bson.M
+	qs.roundTrip()
+	if err := qs.db.C("triples").Find(qs.live(bson.M{"_id": key})).One(&doc); err != nil {
+		return quad.Quad{}, err
 	}
+	return qs.quadOf(
+		doc["Subject"].(string),
+		doc["Predicate"].(string),
+		doc["Object"].(string),
+		doc["Label"].(string),
+	), nil
+}
+
+func (qs *TripleStore) QuadExists(t quad.Quad) (bool, error) {
+	constraint := newConstraint().
+		eq("Subject", qs.storedName(t.Subject)).
+		eq("Predicate", qs.storedName(t.Predicate)).
+		eq("Object", qs.storedName(t.Object)).
+		eq("Label", qs.storedName(t.Label)).
+		M()
+	return qs.exists(constraint, nil)
+}
+
+// find returns a query over the given collection, selecting only the
+// fields needed to make the values of its documents. Queries on triples
+// constrained in direction d use the index hinted for d, if any.
+func (qs *TripleStore) find(collection string, d quad.Direction, constraint bson.M) *mgo.Query {
+	qs.observe(collection, constraint)
+	q := qs.db.C(collection).Find(constraint)
+	if collection == "triples" {
+		q = q.Select(tripleSelector)
+		if hint := qs.hints[d]; hint != nil {
+			q = q.Hint(hint...)
+		}
+	}
+	return q
 }
 
 func (qs *TripleStore) TripleIterator(d quad.Direction, val graph.Value) graph.Iterator {
 	return NewIterator(qs, "triples", d, val)
 }
 
+func (qs *TripleStore) DistinctIterator(d quad.Direction) graph.Iterator {
+	it, err := NewDistinctIterator(qs, d)
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return iterator.NewNull()
+	}
+	return it
+}
+
+func (qs *TripleStore) RangeIterator(d quad.Direction, lo, hi string) graph.Iterator {
+	it, err := NewRangeIterator(qs, d, lo, hi)
+	if err != nil {
+		glog.Errorln("Trouble getting size for iterator! ", err)
+		return iterator.NewNull()
+	}
+	return it
+}
+
+// NodesAllIterator returns an iterator over the nodes collection, or, in a
+// view restricted to some labels or to a source, over the nodes of their
+// triples. The labels of a source's triples are not among them unless the
+// view is also restricted to labels.
 func (qs *TripleStore) NodesAllIterator() graph.Iterator {
+	if qs.labelHashes != nil || qs.sourceFilter != "" {
+		return iterator.RestrictedNodes(qs, qs.labels)
+	}
 	return NewAllIterator(qs, "nodes")
 }
 
@@ -246,22 +633,121 @@ func (qs *TripleStore) ValueOf(s string) graph.Value {
 	return qs.ConvertStringToByteHash(s)
 }
 
+// findNode returns the document of the node with the given id.
+var findNode = func(qs *TripleStore, id string) (MongoNode, error) {
+	var node MongoNode
+	err := qs.db.C("nodes").FindId(id).One(&node)
+	return node, err
+}
+
 func (qs *TripleStore) NameOf(v graph.Value) string {
+	if s, ok := v.(textScore); ok {
+		return s.String()
+	}
+	if s, ok := v.(sourceName); ok {
+		return string(s)
+	}
 	val, ok := qs.idCache.Get(v.(string))
 	if ok {
-		return val
+		return qs.resolveName(val)
 	}
-	var node MongoNode
-	err := qs.db.C("nodes").FindId(v.(string)).One(&node)
+	if name, ok := qs.names.get(v.(string)); ok {
+		qs.idCache.Put(v.(string), name)
+		return qs.resolveName(name)
+	}
+	qs.roundTrip()
+	node, err := findNode(qs, v.(string))
 	if err != nil {
 		glog.Errorf("Error: Couldn't retrieve node %s %v", v, err)
 	}
-	qs.idCache.Put(v.(string), node.Name)
-	return node.Name
+	qs.cacheName(v.(string), node.Name)
+	return qs.resolveName(node.Name)
+}
+
+// NamesOf returns the names of vals, finding all of those that are not
+// cached with a single query.
+func (qs *TripleStore) NamesOf(vals []graph.Value) ([]string, error) {
+	names := make([]string, len(vals))
+	var missing []string
+	wanted := make(map[string][]int)
+	for i, v := range vals {
+		if s, ok := v.(textScore); ok {
+			names[i] = s.String()
+			continue
+		}
+		if s, ok := v.(sourceName); ok {
+			names[i] = string(s)
+			continue
+		}
+		id := v.(string)
+		if name, ok := qs.idCache.Get(id); ok {
+			names[i] = name
+			continue
+		}
+		if name, ok := qs.names.get(id); ok {
+			qs.idCache.Put(id, name)
+			names[i] = name
+			continue
+		}
+		if _, ok := wanted[id]; !ok {
+			missing = append(missing, id)
+		}
+		wanted[id] = append(wanted[id], i)
+	}
+	if len(missing) == 0 {
+		return qs.resolveNames(names), nil
+	}
+
+	var node MongoNode
+	found := make(map[string]string)
+	qs.roundTrip()
+	it := qs.db.C("nodes").Find(bson.M{"_id": bson.M{"$in": missing}}).Iter()
+	for it.Next(&node) {
+		qs.idCache.Put(node.Id, node.Name)
+		found[node.Id] = node.Name
+		for _, i := range wanted[node.Id] {
+			names[i] = node.Name
+		}
+	}
+	if err := it.Close(); err != nil {
+		return nil, err
+	}
+	// All the names found are written to disk at once.
+	qs.names.put(found)
+	return qs.resolveNames(names), nil
+}
+
+// PinNames looks up the names of vals, as NamesOf does, and keeps them in
+// the cache for as long as the store is open.
+func (qs *TripleStore) PinNames(vals []graph.Value) error {
+	names, err := qs.NamesOf(vals)
+	if err != nil {
+		return err
+	}
+	for i, v := range vals {
+		// Values without a node have no name to keep.
+		if names[i] != "" {
+			qs.idCache.Pin(v.(string), names[i])
+		}
+	}
+	return nil
+}
+
+// Capabilities returns the work the server does for the store: grouping
+// and counting triples, and listing distinct nodes, by aggregation, and
+// searching the objects of triples for words and the names of nodes for
+// prefixes. A view restricted to some labels or sources finds its nodes
+// among its triples, so it leaves completing their names to the fallback.
+func (qs *TripleStore) Capabilities() graph.Capabilities {
+	c := graph.CapCount | graph.CapDistinct | graph.CapTextSearch
+	if qs.labelHashes == nil && qs.sourceFilter == "" {
+		c |= graph.CapComplete
+	}
+	return c
 }
 
 func (qs *TripleStore) Size() int64 {
-	count, err := qs.db.C("triples").Count()
+	count, err := qs.db.C("triples").Find(qs.live(nil)).Count()
 	if err != nil {
 		glog.Errorf("Error: %v", err)
 		return 0
@@ -269,33 +755,25 @@ func (qs *TripleStore) Size() int64 {
 	return int64(count)
 }
 
-func compareStrings(a, b graph.Value) bool {
-	return a.(string) == b.(string)
-}
-
 func (qs *TripleStore) FixedIterator() graph.FixedIterator {
-	return iterator.NewFixedIteratorWithCompare(compareStrings)
+	return iterator.NewFixedIteratorWithCompare(iterator.BasicEquality)
 }
 
 func (qs *TripleStore) Close() {
+	if qs.isView {
+		// Views share the session of their store.
+		return
+	}
+	qs.stopStatsRefresh()
+	if qs.primary != nil {
+		qs.primary.Session.Close()
+	}
+	qs.names.close()
 	qs.db.Session.Close()
 }
 
 func (qs *TripleStore) TripleDirection(in graph.Value, d quad.Direction) graph.Value {
-	// Maybe do the trick here
-	var offset int
-	switch d {
-	case quad.Subject:
-		offset = 0
-	case quad.Predicate:
-		offset = (qs.hasher.Size() * 2)
-	case quad.Object:
-		offset = (qs.hasher.Size() * 2) * 2
-	case quad.Label:
-		offset = (qs.hasher.Size() * 2) * 3
-	}
-	val := in.(string)[offset : qs.hasher.Size()*2+offset]
-	return val
+	return in.(tripleValue).hashes[d]
 }
 
 func (qs *TripleStore) BulkLoad(dec quad.Unmarshaler) error {
@@ -303,6 +781,7 @@ func (qs *TripleStore) BulkLoad(dec quad.Unmarshaler) error {
 		return graph.ErrCannotBulkLoad
 	}
 
+	safe := qs.session.Safe()
 	qs.session.SetSafe(nil)
 	for {
 		q, err := dec.Unmarshal()
@@ -315,15 +794,31 @@ func (qs *TripleStore) BulkLoad(dec quad.Unmarshaler) error {
 		qs.writeTriple(q)
 	}
 
+	err := qs.RebuildNodes()
+	qs.session.SetSafe(safe)
+	return err
+}
+
+// RebuildNodes replaces the nodes collection with one derived from the
+// triples collection, restoring every node's name and reference count.
+func (qs *TripleStore) RebuildNodes() error {
 	outputTo := bson.M{"replace": "nodes", "sharded": true}
 	glog.Infoln("Mapreducing")
-	job := mgo.MapReduce{
-		Map: `function() {
+	keys := `
       var len = this["_id"].length
       var s_key = this["_id"].slice(0, len / 4)
       var p_key = this["_id"].slice(len / 4, 2 * len / 4)
       var o_key = this["_id"].slice(2 * len / 4, 3 * len / 4)
-      var c_key = this["_id"].slice(3 * len / 4)
+      var c_key = this["_id"].slice(3 * len / 4)`
+	if qs.ids == hashedIDs {
+		keys = `
+      var s_key = this["SubjectHash"]
+      var p_key = this["PredicateHash"]
+      var o_key = this["ObjectHash"]
+      var c_key = this["LabelHash"]`
+	}
+	job := mgo.MapReduce{
+		Map: `function() {` + keys + `
       emit(s_key, {"_id": s_key, "Name" : this.Subject, "Size" : 1})
       emit(p_key, {"_id": p_key, "Name" : this.Predicate, "Size" : 1})
       emit(o_key, {"_id": o_key, "Name" : this.Object, "Size" : 1})
@@ -346,13 +841,17 @@ func (qs *TripleStore) BulkLoad(dec quad.Unmarshaler) error {
     `,
 		Out: outputTo,
 	}
-	qs.db.C("triples").Find(nil).MapReduce(&job, nil)
+	_, err := qs.db.C("triples").Find(qs.live(nil)).MapReduce(&job, nil)
+	if err != nil {
+		return fmt.Errorf("mongo: could not rebuild nodes: %v", err)
+	}
 	glog.Infoln("Fixing")
-	qs.db.Run(bson.D{{"eval", `function() { db.nodes.find().forEach(function (result) {
+	err = qs.db.Run(bson.D{{"eval", `function() { db.nodes.find().forEach(function (result) {
     db.nodes.update({"_id": result._id}, result.value)
   }) }`}, {"args", bson.D{}}}, nil)
-
-	qs.session.SetSafe(&mgo.Safe{})
-
+	if err != nil {
+		return fmt.Errorf("mongo: could not rebuild nodes: %v", err)
+	}
+	qs.idCache = NewIDLru(1 << 16)
 	return nil
 }
@@ -15,14 +15,33 @@
 package mongo
 
 import (
+	"github.com/barakmich/glog"
+
 	"github.com/google/cayley/graph"
 	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
 )
 
 func (ts *TripleStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
 	switch it.Type() {
 	case graph.LinksTo:
 		return ts.optimizeLinksTo(it.(*iterator.LinksTo))
+	case graph.HasA:
+		return ts.optimizeHasA(it.(*iterator.HasA))
+	case graph.Skip:
+		return ts.optimizeSkip(it.(*iterator.Skip))
+	case graph.Limit:
+		return ts.optimizeLimit(it.(*iterator.Limit))
+	case graph.Or:
+		return ts.optimizeOr(it.(*iterator.Or))
+	case graph.LeftJoin:
+		return ts.optimizeLeftJoin(it.(*iterator.LeftJoin))
+	case graph.Pluck:
+		return ts.optimizePluck(it.(*iterator.Pluck))
+	case graph.LangMatch:
+		return ts.optimizeLangMatch(it.(*iterator.LangMatch))
+	case graph.Not:
+		return ts.optimizeNot(it.(*iterator.Not))
 
 	}
 	return it, false
@@ -50,6 +69,54 @@ func (ts *TripleStore) optimizeLinksTo(it *iterator.LinksTo) (graph.Iterator, bo
 			it.Close()
 			return newIt, true
 		}
+		// Several labels can be found with one query, so long as the
+		// labels need not be tagged.
+		if size > 1 && it.Direction() == quad.Label && len(primary.Tagger().Tags()) == 0 && len(primary.Tagger().Fixed()) == 0 {
+			var labels []graph.Value
+			for graph.Next(primary) {
+				labels = append(labels, primary.Result())
+			}
+			newIt, err := NewLabelsIterator(ts, labels)
+			if err != nil {
+				glog.Errorf("Error: %v for labels %v", err, labels)
+				primary.Reset()
+				return it, false
+			}
+			newIt.tags.CopyFrom(it)
+			it.Close()
+			return newIt, true
+		}
 	}
 	return it, false
 }
+
+// optimizeSkip pushes a Skip over a single Mongo iterator down into its
+// query.
+func (ts *TripleStore) optimizeSkip(it *iterator.Skip) (graph.Iterator, bool) {
+	m, ok := it.SubIterators()[0].(*Iterator)
+	if !ok || m.scan {
+		// The window of a scan would count the triples it passes over.
+		return it, false
+	}
+	newIt := m.Clone().(*Iterator)
+	newIt.skipBy(it.Offset())
+	newIt.Reset()
+	newIt.tags.CopyFrom(it)
+	it.Close()
+	return newIt, true
+}
+
+// optimizeLimit pushes a Limit over a single Mongo iterator down into its
+// query.
+func (ts *TripleStore) optimizeLimit(it *iterator.Limit) (graph.Iterator, bool) {
+	m, ok := it.SubIterators()[0].(*Iterator)
+	if !ok || m.scan {
+		return it, false
+	}
+	newIt := m.Clone().(*Iterator)
+	newIt.limitTo(it.Max())
+	newIt.Reset()
+	newIt.tags.CopyFrom(it)
+	it.Close()
+	return newIt, true
+}
@@ -0,0 +1,98 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/quad"
+)
+
+func TestRestoreNodes(t *testing.T) {
+	defer func(c func(*TripleStore, string, bson.M) (int, error), r func(*TripleStore) error, f func(*TripleStore, string) (MongoNode, error)) {
+		countQuery, rebuildNodes, findNode = c, r, f
+	}(countQuery, rebuildNodes, findNode)
+
+	triples := []quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"bob", "follows", "charlie", "smart"},
+	}
+
+	// The fake server holds the triples, and the nodes once rebuilt.
+	var nodes map[string]MongoNode
+	var rebuilds int
+	countQuery = func(_ *TripleStore, collection string, _ bson.M) (int, error) {
+		if collection == "nodes" {
+			return len(nodes), nil
+		}
+		return len(triples), nil
+	}
+	rebuildNodes = func(qs *TripleStore) error {
+		rebuilds++
+		nodes = make(map[string]MongoNode)
+		for _, q := range triples {
+			for _, name := range []string{q.Subject, q.Predicate, q.Object, q.Label} {
+				if name == "" {
+					continue
+				}
+				id := qs.ValueOf(name).(string)
+				node := nodes[id]
+				node.Id, node.Name, node.Size = id, name, node.Size+1
+				nodes[id] = node
+			}
+		}
+		return nil
+	}
+	findNode = func(_ *TripleStore, id string) (MongoNode, error) {
+		node, ok := nodes[id]
+		if !ok {
+			return MongoNode{}, mgo.ErrNotFound
+		}
+		return node, nil
+	}
+
+	qs := &TripleStore{hasher: sha1.New(), idCache: NewIDLru(100)}
+	if err := qs.restoreNodes(true); err == nil {
+		t.Error("Unexpected rebuild of the nodes of a read-only store")
+	}
+	if rebuilds != 0 {
+		t.Errorf("Unexpected number of rebuilds of a read-only store, got:%d expect:0", rebuilds)
+	}
+
+	if err := qs.restoreNodes(false); err != nil {
+		t.Fatalf("Failed to restore nodes: %v", err)
+	}
+	if rebuilds != 1 {
+		t.Errorf("Unexpected number of rebuilds, got:%d expect:1", rebuilds)
+	}
+	for _, name := range []string{"alice", "follows", "charlie", "smart"} {
+		if got := qs.NameOf(qs.ValueOf(name)); got != name {
+			t.Errorf("Unexpected name of a rebuilt node, got:%q expect:%q", got, name)
+		}
+	}
+
+	// Neither a store with its nodes, nor an empty one, is rebuilt.
+	if err := qs.restoreNodes(false); err != nil || rebuilds != 1 {
+		t.Errorf("Unexpected rebuild of a store with its nodes, got:%d rebuilds, %v", rebuilds, err)
+	}
+	nodes, triples = nil, nil
+	if err := qs.restoreNodes(false); err != nil || rebuilds != 1 {
+		t.Errorf("Unexpected rebuild of an empty store, got:%d rebuilds, %v", rebuilds, err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"github.com/barakmich/glog"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/quad"
+)
+
+// verifyBatch is the most node ids looked up with each query.
+const verifyBatch = 1000
+
+// A Verification is what VerifyNodes found wrong with a store.
+type Verification struct {
+	// The number of triples checked for dangling references.
+	Triples int
+
+	// The names of triples for which there is no node.
+	Dangling []DanglingRef
+
+	// The nodes that no live triple names.
+	Orphans []MongoNode
+}
+
+// OK returns whether nothing was found wrong.
+func (v *Verification) OK() bool {
+	return len(v.Dangling) == 0 && len(v.Orphans) == 0
+}
+
+// A DanglingRef is a triple naming a node in some direction that has no
+// document in the nodes collection.
+type DanglingRef struct {
+	Triple    string
+	Direction quad.Direction
+	Name      string
+}
+
+// tripleNames is the _id and names of a triple document.
+type tripleNames struct {
+	Id        string `bson:"_id"`
+	Subject   string `bson:"Subject"`
+	Predicate string `bson:"Predicate"`
+	Object    string `bson:"Object"`
+	Label     string `bson:"Label"`
+}
+
+func (t tripleNames) get(d quad.Direction) string {
+	switch d {
+	case quad.Subject:
+		return t.Subject
+	case quad.Predicate:
+		return t.Predicate
+	case quad.Object:
+		return t.Object
+	case quad.Label:
+		return t.Label
+	}
+	return ""
+}
+
+var namesSelector = bson.M{"_id": 1, "Subject": 1, "Predicate": 1, "Object": 1, "Label": 1}
+
+// scanTriples returns a cursor over the names of the live triples, or of a
+// random sample of n of them if n is positive.
+var scanTriples = func(qs *TripleStore, n int) cursor {
+	c := qs.db.C("triples")
+	if n <= 0 {
+		return c.Find(qs.live(nil)).Select(namesSelector).Iter()
+	}
+	return c.Pipe([]bson.M{
+		{"$match": qs.live(bson.M{})},
+		{"$sample": bson.M{"size": n}},
+		{"$project": namesSelector},
+	}).AllowDiskUse().Iter()
+}
+
+// knownNodes returns which of the node ids have a document in the nodes
+// collection.
+var knownNodes = func(qs *TripleStore, ids []string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	it := qs.db.C("nodes").Find(bson.M{"_id": bson.M{"$in": ids}}).Select(bson.M{"_id": 1}).Iter()
+	var doc struct {
+		ID string `bson:"_id"`
+	}
+	for it.Next(&doc) {
+		known[doc.ID] = true
+	}
+	return known, it.Close()
+}
+
+// sampledOrphans returns the nodes no live triple names among a random
+// sample of n nodes.
+var sampledOrphans = func(qs *TripleStore, n int) ([]MongoNode, error) {
+	pipeline := append([]bson.M{{"$sample": bson.M{"size": n}}}, qs.orphanPipeline()...)
+	var nodes []MongoNode
+	err := qs.db.C("nodes").Pipe(pipeline).AllowDiskUse().All(&nodes)
+	return nodes, err
+}
+
+// VerifyNodes cross-checks the triples and nodes collections, as an
+// interrupted load may leave them disagreeing: it finds the names of live
+// triples that have no node, and the nodes that no live triple names.
+//
+// For a graph too large to check in full, a positive sample checks a
+// random sample of that many triples, and of that many nodes, instead.
+// Nothing is repaired; CompactNodes removes orphaned nodes.
+func (qs *TripleStore) VerifyNodes(sample int) (*Verification, error) {
+	v := &Verification{}
+	var (
+		batch []tripleNames
+		ids   = make(map[string]bool)
+	)
+	check := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		list := make([]string, 0, len(ids))
+		for id := range ids {
+			list = append(list, id)
+		}
+		known, err := knownNodes(qs, list)
+		if err != nil {
+			return err
+		}
+		for _, t := range batch {
+			for d := quad.Subject; d <= quad.Label; d++ {
+				name := t.get(d)
+				if name == "" {
+					continue
+				}
+				if !known[qs.hashOfStored(name)] {
+					v.Dangling = append(v.Dangling, DanglingRef{Triple: t.Id, Direction: d, Name: name})
+				}
+			}
+		}
+		batch, ids = batch[:0], make(map[string]bool)
+		return nil
+	}
+
+	it := scanTriples(qs, sample)
+	var t tripleNames
+	for it.Next(&t) {
+		v.Triples++
+		batch = append(batch, t)
+		for d := quad.Subject; d <= quad.Label; d++ {
+			if name := t.get(d); name != "" {
+				ids[qs.hashOfStored(name)] = true
+			}
+		}
+		if len(ids) >= verifyBatch {
+			if err := check(); err != nil {
+				it.Close()
+				return nil, err
+			}
+		}
+		t = tripleNames{}
+	}
+	if err := it.Close(); err != nil {
+		return nil, err
+	}
+	if err := check(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if sample > 0 {
+		v.Orphans, err = sampledOrphans(qs, sample)
+	} else {
+		v.Orphans, err = orphanedNodes(qs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("Verified %d triples: %d dangling references, %d orphaned nodes", v.Triples, len(v.Dangling), len(v.Orphans))
+	return v, nil
+}
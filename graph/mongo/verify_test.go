@@ -0,0 +1,132 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/google/cayley/quad"
+)
+
+// namesCursor yields the names of triple documents.
+type namesCursor struct {
+	docs []bson.M
+}
+
+func (c *namesCursor) Next(result interface{}) bool {
+	if len(c.docs) == 0 {
+		return false
+	}
+	doc := c.docs[0]
+	c.docs = c.docs[1:]
+	t := result.(*tripleNames)
+	t.Id = doc["_id"].(string)
+	t.Subject, t.Predicate, t.Object, t.Label = doc["Subject"].(string), doc["Predicate"].(string), doc["Object"].(string), doc["Label"].(string)
+	return true
+}
+
+func (c *namesCursor) Err() error   { return nil }
+func (c *namesCursor) Close() error { return nil }
+
+// verifyWith points the verifier at f, sampling the first n triples and
+// nodes when asked to sample. It returns a function restoring the store.
+func verifyWith(f *fakeNodes) func() {
+	scan, known, sampled, orphaned := scanTriples, knownNodes, sampledOrphans, orphanedNodes
+	scanTriples = func(qs *TripleStore, n int) cursor {
+		var live []bson.M
+		for _, doc := range f.triples {
+			if deleted, _ := doc[deletedField].(bool); !deleted {
+				live = append(live, doc)
+			}
+		}
+		if n > 0 && n < len(live) {
+			live = live[:n]
+		}
+		return &namesCursor{docs: live}
+	}
+	knownNodes = func(qs *TripleStore, ids []string) (map[string]bool, error) {
+		known := make(map[string]bool)
+		for _, id := range ids {
+			_, known[id] = f.nodes[id]
+		}
+		return known, nil
+	}
+	sampledOrphans = func(qs *TripleStore, n int) ([]MongoNode, error) {
+		orphans, err := f.orphans(qs)
+		if n < len(orphans) {
+			orphans = orphans[:n]
+		}
+		return orphans, err
+	}
+	orphanedNodes = f.orphans
+	return func() {
+		scanTriples, knownNodes, sampledOrphans, orphanedNodes = scan, known, sampled, orphaned
+	}
+}
+
+func TestVerifyNodes(t *testing.T) {
+	qs := &TripleStore{hasher: sha1.New(), ids: compositeIDs}
+	f := &fakeNodes{qs: qs, nodes: make(map[string]MongoNode)}
+	defer verifyWith(f)()
+	for _, q := range []quad.Quad{
+		{"A", "follows", "B", ""},
+		{"C", "follows", "B", ""},
+		{"B", "status", "cool", "status_graph"},
+	} {
+		f.add(q)
+	}
+
+	v, err := qs.VerifyNodes(0)
+	if err != nil {
+		t.Fatalf("Unexpected error verifying nodes: %v", err)
+	}
+	if !v.OK() || v.Triples != 3 {
+		t.Errorf("Unexpected verification of a consistent store, got:%+v", v)
+	}
+
+	// An interrupted load writes a triple without all of its nodes, and
+	// a node without its triple.
+	f.add(quad.Quad{"D", "follows", "E", ""})
+	delete(f.nodes, qs.ConvertStringToByteHash("E"))
+	f.add(quad.Quad{"F", "follows", "A", ""})
+	f.delete(quad.Quad{"F", "follows", "A", ""})
+
+	v, err = qs.VerifyNodes(0)
+	if err != nil {
+		t.Fatalf("Unexpected error verifying nodes: %v", err)
+	}
+	expect := []DanglingRef{{Triple: qs.getIdForTriple(quad.Quad{"D", "follows", "E", ""}), Direction: quad.Object, Name: "E"}}
+	if !reflect.DeepEqual(v.Dangling, expect) {
+		t.Errorf("Unexpected dangling references, got:%v expect:%v", v.Dangling, expect)
+	}
+	if len(v.Orphans) != 1 || v.Orphans[0].Name != "F" {
+		t.Errorf("Unexpected orphaned nodes, got:%v expect:[F]", v.Orphans)
+	}
+	if v.OK() {
+		t.Error("Unexpected verification of an inconsistent store as OK")
+	}
+
+	v, err = qs.VerifyNodes(3)
+	if err != nil {
+		t.Fatalf("Unexpected error verifying a sample of nodes: %v", err)
+	}
+	if v.Triples != 3 || len(v.Dangling) != 0 {
+		t.Errorf("Unexpected verification of a sample missing the dangling reference, got:%+v", v)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+)
+
+// A window step, as a Gremlin .Skip() or .Limit().
+type step struct {
+	skip bool
+	n    int64
+}
+
+var windowTests = [][]step{
+	{{skip: true, n: 3}},
+	{{n: 3}},
+	{{skip: true, n: 2}, {n: 5}},
+	{{n: 5}, {skip: true, n: 2}},
+	{{n: 5}, {skip: true, n: 7}},
+	{{skip: true, n: 1}, {n: 6}, {skip: true, n: 2}, {n: 3}},
+	{{n: 6}, {n: 2}, {n: 4}},
+	{{n: 0}, {skip: true, n: 1}},
+}
+
+// TestWindowPushdown checks that a window pushed down to a Mongo query,
+// which always skips before it limits, selects the same results as the
+// Skip and Limit iterators do in any other store.
+func TestWindowPushdown(t *testing.T) {
+	const n = 10
+	for _, steps := range windowTests {
+		fixed := iterator.NewFixedIteratorWithCompare(iterator.BasicEquality)
+		for i := 0; i < n; i++ {
+			fixed.Add(i)
+		}
+		var emulated graph.Iterator = fixed
+		pushed := &Iterator{limit: -1}
+		for _, s := range steps {
+			if s.skip {
+				emulated = iterator.NewSkip(nil, emulated, s.n)
+				pushed.skipBy(s.n)
+			} else {
+				emulated = iterator.NewLimit(nil, emulated, s.n)
+				pushed.limitTo(s.n)
+			}
+		}
+
+		var expect []int
+		for graph.Next(emulated) {
+			expect = append(expect, emulated.Result().(int))
+		}
+
+		// Apply the window as Mongo would, where a limit of zero
+		// yields nothing.
+		var got []int
+		if pushed.limit != 0 {
+			for i := int(pushed.skip); i < n; i++ {
+				if pushed.limit > 0 && int64(len(got)) == pushed.limit {
+					break
+				}
+				got = append(got, i)
+			}
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected pushed down window for %+v, got:%v expect:%v", steps, got, expect)
+		}
+
+		pushed.size = n
+		if size, _ := pushed.Size(); size != int64(len(expect)) {
+			t.Errorf("Unexpected pushed down size for %+v, got:%d expect:%d", steps, size, len(expect))
+		}
+	}
+}
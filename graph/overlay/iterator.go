@@ -0,0 +1,188 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+// Defines the filter iterator, which stands between an iterator over the
+// base of an overlay and the iterators of the overlay that use it.
+//
+// The base knows nothing of the values the overlay gives to added triples
+// and to nodes only they have, so a filter answers for them itself: it
+// contains none of them. It also passes over the triples of the base that
+// have been removed from the overlay.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+type filter struct {
+	uid     uint64
+	tags    graph.Tagger
+	base    graph.TripleStore
+	subIt   graph.Iterator
+	removed map[quad.Quad]struct{}
+	result  graph.Value
+}
+
+// newFilter returns an iterator over the results of subIt, an iterator over
+// base, that are not the triples in removed.
+func newFilter(base graph.TripleStore, subIt graph.Iterator, removed map[quad.Quad]struct{}) *filter {
+	return &filter{
+		uid:     iterator.NextUID(),
+		base:    base,
+		subIt:   subIt,
+		removed: removed,
+	}
+}
+
+func (it *filter) UID() uint64 {
+	return it.uid
+}
+
+func (it *filter) Reset() {
+	it.subIt.Reset()
+	it.result = nil
+}
+
+func (it *filter) Close() {
+	it.subIt.Close()
+}
+
+func (it *filter) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *filter) TagResults(dst map[string]graph.Value) {
+	for _, tag := range it.tags.Tags() {
+		dst[tag] = it.Result()
+	}
+
+	for tag, value := range it.tags.Fixed() {
+		dst[tag] = value
+	}
+
+	it.subIt.TagResults(dst)
+}
+
+func (it *filter) Clone() graph.Iterator {
+	out := newFilter(it.base, it.subIt.Clone(), it.removed)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+// SubIterators returns a slice of the sub iterators.
+func (it *filter) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+// isRemoved returns whether v, a value of the base, is a removed triple.
+func (it *filter) isRemoved(v graph.Value) bool {
+	if len(it.removed) == 0 {
+		return false
+	}
+	_, ok := it.removed[it.base.Quad(v)]
+	return ok
+}
+
+// Next advances the subiterator to its next result that is not removed.
+func (it *filter) Next() bool {
+	graph.NextLogIn(it)
+	for graph.Next(it.subIt) {
+		if v := it.subIt.Result(); !it.isRemoved(v) {
+			it.result = v
+			return graph.NextLogOut(it, v, true)
+		}
+	}
+	return graph.NextLogOut(it, nil, false)
+}
+
+// DEPRECATED
+func (it *filter) ResultTree() *graph.ResultTree {
+	tree := graph.NewResultTree(it.Result())
+	tree.AddSubtree(it.subIt.ResultTree())
+	return tree
+}
+
+func (it *filter) Result() graph.Value {
+	return it.result
+}
+
+// Contains checks whether the subiterator contains val, if val is a value
+// of the base that is not removed.
+func (it *filter) Contains(val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	switch val.(type) {
+	case addedTriple, addedNode:
+		return graph.ContainsLogOut(it, val, false)
+	}
+	if it.isRemoved(val) || !it.subIt.Contains(val) {
+		return graph.ContainsLogOut(it, val, false)
+	}
+	it.result = val
+	return graph.ContainsLogOut(it, val, true)
+}
+
+func (it *filter) NextPath() bool {
+	return it.subIt.NextPath()
+}
+
+// Optimize optimizes the subiterator, which the base may replace.
+func (it *filter) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+// A filter costs as much as its subiterator, and a lookup of each triple
+// if any are removed.
+func (it *filter) Stats() graph.IteratorStats {
+	stats := it.subIt.Stats()
+	if len(it.removed) != 0 {
+		stats.ContainsCost++
+		stats.NextCost++
+	}
+	return stats
+}
+
+// Size returns the size of the subiterator, an upper bound if any triples
+// are removed.
+func (it *filter) Size() (int64, bool) {
+	size, exact := it.subIt.Size()
+	return size, exact && len(it.removed) == 0
+}
+
+var filterType graph.Type
+
+func init() {
+	filterType = graph.RegisterIterator("overlay_filter")
+}
+
+func (it *filter) Type() graph.Type { return filterType }
+
+func (it *filter) DebugString(indent int) string {
+	return fmt.Sprintf("%s(%s tags:%s removed:%d\n%s)",
+		strings.Repeat(" ", indent),
+		it.Type(),
+		it.tags.Tags(),
+		len(it.removed),
+		it.subIt.DebugString(indent+4))
+}
@@ -0,0 +1,316 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package overlay stacks changes that are not yet written over a base
+// store, so that queries can see the store as it would be with them
+// without the base being touched.
+//
+// Triples added to an overlay are held in memory, and triples removed are
+// remembered and hidden from the iterators over the base. Values of the
+// base are values of the overlay, so the iterators over the base can be
+// joined with those over the added triples; a node that only added triples
+// have is given a value of the overlay's own.
+package overlay
+
+import (
+	"sync"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+)
+
+// An addedTriple is the value of a triple added to an overlay.
+type addedTriple quad.Quad
+
+// An addedNode is the value of a node that only added triples have.
+type addedNode string
+
+// A node is a node of the added triples, with its value and the number of
+// added triples that have it.
+type node struct {
+	val  graph.Value
+	refs int
+}
+
+// TripleStore is a graph.TripleStore that shows its base with the triples
+// added to it and without those removed from it.
+type TripleStore struct {
+	base graph.TripleStore
+
+	mu      sync.RWMutex
+	added   map[quad.Quad]struct{}
+	removed map[quad.Quad]struct{}
+	nodes   map[string]*node
+}
+
+// New returns an overlay over base with no changes. The base is only
+// written by Commit.
+func New(base graph.TripleStore) *TripleStore {
+	ts := &TripleStore{base: base}
+	ts.reset()
+	return ts
+}
+
+func (ts *TripleStore) reset() {
+	ts.added = make(map[quad.Quad]struct{})
+	ts.removed = make(map[quad.Quad]struct{})
+	ts.nodes = make(map[string]*node)
+}
+
+// Base returns the store under the overlay.
+func (ts *TripleStore) Base() graph.TripleStore {
+	return ts.base
+}
+
+// Commit writes the changes held by the overlay to its base, which then
+// shows what the overlay did, and leaves the overlay with no changes.
+func (ts *TripleStore) Commit() error {
+	if graph.IsReadOnly(ts.base) {
+		return graph.ErrReadOnly
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for q := range ts.removed {
+		ts.base.RemoveTriple(q)
+	}
+	added := make([]quad.Quad, 0, len(ts.added))
+	for q := range ts.added {
+		added = append(added, q)
+	}
+	if len(added) != 0 {
+		ts.base.AddTripleSet(added)
+	}
+	ts.reset()
+	return nil
+}
+
+// Discard drops the changes held by the overlay.
+func (ts *TripleStore) Discard() {
+	ts.mu.Lock()
+	ts.reset()
+	ts.mu.Unlock()
+}
+
+func (ts *TripleStore) AddTriple(q quad.Quad) {
+	ts.mu.Lock()
+	ts.add(q)
+	ts.mu.Unlock()
+}
+
+func (ts *TripleStore) AddTripleSet(set []quad.Quad) {
+	ts.mu.Lock()
+	for _, q := range set {
+		ts.add(q)
+	}
+	ts.mu.Unlock()
+}
+
+// add adds q to the overlay, unless the base has it, bringing it back if
+// it was removed. ts.mu must be held.
+func (ts *TripleStore) add(q quad.Quad) {
+	if _, ok := ts.removed[q]; ok {
+		delete(ts.removed, q)
+		return
+	}
+	if _, ok := ts.added[q]; ok {
+		return
+	}
+	if ok, _ := ts.base.QuadExists(q); ok {
+		return
+	}
+	ts.added[q] = struct{}{}
+	for d := quad.Subject; d <= quad.Label; d++ {
+		name := q.Get(d)
+		if name == "" {
+			continue
+		}
+		if n, ok := ts.nodes[name]; ok {
+			n.refs++
+			continue
+		}
+		// The node keeps the value the base gives it, if the base
+		// knows it, so that it joins with the results of the base.
+		var val graph.Value = addedNode(name)
+		if v := ts.base.ValueOf(name); v != nil && ts.base.NameOf(v) == name {
+			val = v
+		}
+		ts.nodes[name] = &node{val: val, refs: 1}
+	}
+}
+
+func (ts *TripleStore) RemoveTriple(q quad.Quad) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if _, ok := ts.added[q]; ok {
+		delete(ts.added, q)
+		for d := quad.Subject; d <= quad.Label; d++ {
+			if n, ok := ts.nodes[q.Get(d)]; ok {
+				if n.refs--; n.refs == 0 {
+					delete(ts.nodes, q.Get(d))
+				}
+			}
+		}
+		return
+	}
+	if ok, _ := ts.base.QuadExists(q); ok {
+		ts.removed[q] = struct{}{}
+	}
+}
+
+func (ts *TripleStore) Quad(v graph.Value) quad.Quad {
+	if q, ok := v.(addedTriple); ok {
+		return quad.Quad(q)
+	}
+	return ts.base.Quad(v)
+}
+
+func (ts *TripleStore) QuadExists(q quad.Quad) (bool, error) {
+	ts.mu.RLock()
+	_, added := ts.added[q]
+	_, removed := ts.removed[q]
+	ts.mu.RUnlock()
+	switch {
+	case added:
+		return true, nil
+	case removed:
+		return false, nil
+	}
+	return ts.base.QuadExists(q)
+}
+
+// TripleIterator returns the triples of the base with v in direction d
+// that have not been removed, and the added triples with it.
+func (ts *TripleStore) TripleIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	k := key(v)
+	fixed := ts.FixedIterator()
+	for q := range ts.added {
+		if n, ok := ts.nodes[q.Get(d)]; ok && key(n.val) == k {
+			fixed.Add(addedTriple(q))
+		}
+	}
+	if _, ok := v.(addedNode); ok {
+		return fixed
+	}
+	return union(ts.hide(ts.base.TripleIterator(d, v)), fixed)
+}
+
+// NodesAllIterator returns the nodes of the base and those only added
+// triples have. The nodes of removed triples are still found, as the base
+// is not asked whether it has others with them.
+func (ts *TripleStore) NodesAllIterator() graph.Iterator {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	fixed := ts.FixedIterator()
+	for _, n := range ts.nodes {
+		if _, ok := n.val.(addedNode); ok {
+			fixed.Add(n.val)
+		}
+	}
+	return union(ts.hide(ts.base.NodesAllIterator()), fixed)
+}
+
+func (ts *TripleStore) TriplesAllIterator() graph.Iterator {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	fixed := ts.FixedIterator()
+	for q := range ts.added {
+		fixed.Add(addedTriple(q))
+	}
+	return union(ts.hide(ts.base.TriplesAllIterator()), fixed)
+}
+
+// hide returns it, an iterator over the base, without the triples removed
+// so far. Unless the overlay has no changes, it is wrapped so that it is
+// never asked about values it does not know. ts.mu must be held.
+func (ts *TripleStore) hide(it graph.Iterator) graph.Iterator {
+	if len(ts.added) == 0 && len(ts.removed) == 0 {
+		return it
+	}
+	removed := make(map[quad.Quad]struct{}, len(ts.removed))
+	for q := range ts.removed {
+		removed[q] = struct{}{}
+	}
+	return newFilter(ts.base, it, removed)
+}
+
+// union returns the results of base and of added, which have none in
+// common.
+func union(base graph.Iterator, added graph.FixedIterator) graph.Iterator {
+	if size, _ := added.Size(); size == 0 {
+		return base
+	}
+	or := iterator.NewOr()
+	or.AddSubIterator(base)
+	or.AddSubIterator(added)
+	return or
+}
+
+func (ts *TripleStore) ValueOf(name string) graph.Value {
+	ts.mu.RLock()
+	n, ok := ts.nodes[name]
+	ts.mu.RUnlock()
+	if ok {
+		return n.val
+	}
+	return ts.base.ValueOf(name)
+}
+
+func (ts *TripleStore) NameOf(v graph.Value) string {
+	if n, ok := v.(addedNode); ok {
+		return string(n)
+	}
+	return ts.base.NameOf(v)
+}
+
+func (ts *TripleStore) Size() int64 {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.base.Size() + int64(len(ts.added)) - int64(len(ts.removed))
+}
+
+// FixedIterator returns a fixed iterator that compares values of the base
+// and of the overlay alike.
+func (ts *TripleStore) FixedIterator() graph.FixedIterator {
+	return iterator.NewFixedIteratorWithCompare(func(a, b graph.Value) bool {
+		return key(a) == key(b)
+	})
+}
+
+// key returns v in a form that can be compared with ==.
+func key(v graph.Value) interface{} {
+	if k, ok := v.(iterator.Keyer); ok {
+		return k.Key()
+	}
+	return v
+}
+
+func (ts *TripleStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return it, false
+}
+
+// Close drops the changes held by the overlay. The base is left open, as
+// it is not the overlay's to close.
+func (ts *TripleStore) Close() {
+	ts.Discard()
+}
+
+func (ts *TripleStore) TripleDirection(v graph.Value, d quad.Direction) graph.Value {
+	if q, ok := v.(addedTriple); ok {
+		return ts.ValueOf(quad.Quad(q).Get(d))
+	}
+	return ts.base.TripleDirection(v, d)
+}
@@ -0,0 +1,145 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/graphtest"
+	"github.com/google/cayley/graph/iterator"
+	_ "github.com/google/cayley/graph/memstore"
+	"github.com/google/cayley/quad"
+)
+
+// This is a simple test graph.
+//
+//    +---+                        +---+
+//    | A |-------               ->| F |<--
+//    +---+       \------>+---+-/  +---+   \--+---+
+//                 ------>|#B#|      |        | E |
+//    +---+-------/      >+---+      |        +---+
+//    | C |             /            v
+//    +---+           -/           +---+
+//      ----    +---+/             |#G#|
+//          \-->|#D#|------------->+---+
+//              +---+
+//
+var simpleGraph = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"C", "follows", "B", ""},
+	{"C", "follows", "D", ""},
+	{"D", "follows", "B", ""},
+	{"B", "follows", "F", ""},
+	{"F", "follows", "G", ""},
+	{"D", "follows", "G", ""},
+	{"E", "follows", "F", ""},
+	{"B", "status", "cool", "status_graph"},
+	{"D", "status", "cool", "status_graph"},
+	{"G", "status", "cool", "status_graph"},
+}
+
+func newBase(t *testing.T, data []quad.Quad) graph.TripleStore {
+	ts, err := graph.NewTripleStore("memstore", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to open memstore: %v", err)
+	}
+	ts.AddTripleSet(data)
+	return ts
+}
+
+func TestBackend(t *testing.T) {
+	// Every triple is added to the overlay.
+	graphtest.BackendTestSuite(t, func() graph.TripleStore {
+		return New(newBase(t, nil))
+	})
+	// Every triple is in the base already, so the overlay only hides
+	// those removed.
+	graphtest.BackendTestSuite(t, func() graph.TripleStore {
+		return New(newBase(t, simpleGraph))
+	})
+	// The triples are split between the two.
+	graphtest.BackendTestSuite(t, func() graph.TripleStore {
+		return New(newBase(t, simpleGraph[:5]))
+	})
+}
+
+// followersOf returns the names of the nodes that follow name in ts.
+func followersOf(ts graph.TripleStore, name string) []string {
+	fixed := ts.FixedIterator()
+	fixed.Add(ts.ValueOf(name))
+	and := iterator.NewAnd()
+	and.AddSubIterator(iterator.NewLinksTo(ts, fixed, quad.Object))
+	pred := ts.FixedIterator()
+	pred.Add(ts.ValueOf("follows"))
+	and.AddSubIterator(iterator.NewLinksTo(ts, pred, quad.Predicate))
+	it, _ := iterator.NewHasA(ts, and, quad.Subject).Optimize()
+	var out []string
+	for graph.Next(it) {
+		out = append(out, ts.NameOf(it.Result()))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestPending(t *testing.T) {
+	base := newBase(t, simpleGraph)
+	ts := New(base)
+	ts.AddTriple(quad.Quad{"E", "follows", "B", ""})
+	ts.AddTriple(quad.Quad{"H", "follows", "B", ""})
+	ts.RemoveTriple(quad.Quad{"A", "follows", "B", ""})
+
+	expect := []string{"C", "D", "E", "H"}
+	if got := followersOf(ts, "B"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected followers of B in the overlay, got:%q expect:%q", got, expect)
+	}
+	if got, expect := followersOf(base, "B"), []string{"A", "C", "D"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected followers of B in the base, got:%q expect:%q", got, expect)
+	}
+	if got, expect := ts.Size(), int64(len(simpleGraph)+1); got != expect {
+		t.Errorf("Unexpected size of the overlay, got:%d expect:%d", got, expect)
+	}
+	if ok, _ := ts.QuadExists(quad.Quad{"A", "follows", "B", ""}); ok {
+		t.Error("Removed triple still exists in the overlay")
+	}
+
+	// Adding a removed triple back undoes its removal.
+	ts.AddTriple(quad.Quad{"A", "follows", "B", ""})
+	expect = []string{"A", "C", "D", "E", "H"}
+	if got := followersOf(ts, "B"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected followers of B after adding back, got:%q expect:%q", got, expect)
+	}
+	ts.RemoveTriple(quad.Quad{"A", "follows", "B", ""})
+
+	if err := ts.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	expect = []string{"C", "D", "E", "H"}
+	if got := followersOf(base, "B"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected followers of B in the base after commit, got:%q expect:%q", got, expect)
+	}
+	if got := followersOf(ts, "B"); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected followers of B in the overlay after commit, got:%q expect:%q", got, expect)
+	}
+	if got, expect := base.Size(), int64(len(simpleGraph)+1); got != expect {
+		t.Errorf("Unexpected size of the base after commit, got:%d expect:%d", got, expect)
+	}
+
+	if err := New(graph.ReadOnly(base)).Commit(); err != graph.ErrReadOnly {
+		t.Errorf("Unexpected error committing to a read-only base, got:%v expect:%v", err, graph.ErrReadOnly)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/cayley/quad"
+)
+
+// A QuadKeyer names each of its triples by a key of its own, such as the
+// _id of the document holding it, by which the triple can be found again.
+type QuadKeyer interface {
+	// QuadKey returns the key of the triple v.
+	QuadKey(v Value) string
+
+	// QuadOfKey returns the triple with the given key.
+	QuadOfKey(key string) (quad.Quad, error)
+}
+
+// QuadKey returns a key for the triple v of ts, which QuadOfKey gives the
+// triple back for, so that a traversal can give the triples it crosses.
+// Stores that are not QuadKeyers key a triple by its nodes, as a JSON
+// array of its subject, predicate, object and label.
+func QuadKey(ts TripleStore, v Value) string {
+	ts = unwrap(ts)
+	if k, ok := ts.(QuadKeyer); ok {
+		return k.QuadKey(v)
+	}
+	q := ts.Quad(v)
+	b, _ := json.Marshal([]string{q.Subject, q.Predicate, q.Object, q.Label})
+	return string(b)
+}
+
+// QuadOfKey returns the triple of ts that QuadKey gave key for.
+func QuadOfKey(ts TripleStore, key string) (quad.Quad, error) {
+	ts = unwrap(ts)
+	if k, ok := ts.(QuadKeyer); ok {
+		return k.QuadOfKey(key)
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(key), &names); err != nil || len(names) != 4 {
+		return quad.Quad{}, fmt.Errorf("triplestore: malformed quad key %q", key)
+	}
+	return quad.Quad{Subject: names[0], Predicate: names[1], Object: names[2], Label: names[3]}, nil
+}
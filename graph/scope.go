@@ -0,0 +1,135 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// A query can be given a view of the store of its own, through which the
+// store counts the round trips the query makes to the backend, and stops
+// making them once the query is cancelled.
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrQueryCancelled is the error of an iterator stopped by the cancellation
+// of its query.
+var ErrQueryCancelled = errors.New("triplestore: query cancelled")
+
+// A QueryScope follows a single query as it runs.
+type QueryScope struct {
+	trips int64
+	done  chan struct{}
+	once  sync.Once
+
+	// The functions to call once the query is cancelled, by the ids
+	// OnCancel gave them.
+	mu     sync.Mutex
+	hooks  map[int]func()
+	nextID int
+}
+
+func NewQueryScope() *QueryScope {
+	return &QueryScope{done: make(chan struct{})}
+}
+
+// RoundTrip counts a round trip to the backend.
+func (s *QueryScope) RoundTrip() {
+	atomic.AddInt64(&s.trips, 1)
+}
+
+// RoundTrips returns the number of round trips counted so far.
+func (s *QueryScope) RoundTrips() int64 {
+	return atomic.LoadInt64(&s.trips)
+}
+
+// Cancel cancels the query, calling the functions given to OnCancel. It
+// may be called more than once.
+func (s *QueryScope) Cancel() {
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		hooks := s.hooks
+		s.hooks = nil
+		s.mu.Unlock()
+		for _, f := range hooks {
+			f()
+		}
+	})
+}
+
+// OnCancel arranges for f to be called once the query is cancelled, from
+// the goroutine that cancels it, or at once if it already has been. This
+// lets a backend break off work in flight, such as by closing a cursor
+// blocked on the server, for every iterator of the query, clones
+// included, without waiting for each to be read from again. The function
+// returned stops f being called, and should be called once it is no longer
+// needed.
+func (s *QueryScope) OnCancel(f func()) (stop func()) {
+	s.mu.Lock()
+	if s.Cancelled() {
+		s.mu.Unlock()
+		f()
+		return func() {}
+	}
+	if s.hooks == nil {
+		s.hooks = make(map[int]func())
+	}
+	id := s.nextID
+	s.nextID++
+	s.hooks[id] = f
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		delete(s.hooks, id)
+		s.mu.Unlock()
+	}
+}
+
+// Done returns a channel that is closed once the query is cancelled.
+func (s *QueryScope) Done() <-chan struct{} {
+	return s.done
+}
+
+// Cancelled returns whether the query has been cancelled.
+func (s *QueryScope) Cancelled() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// A Scoper can give a query a view of the store bound to its scope.
+type Scoper interface {
+	// Scope returns a view of the store that counts the round trips it
+	// makes in s, and whose iterators stop once s is cancelled.
+	Scope(s *QueryScope) TripleStore
+}
+
+// Scope returns a view of ts bound to s if ts is a Scoper, keeping it
+// read-only if it was. Other stores make no round trips worth counting, and
+// are returned as they are.
+func Scope(ts TripleStore, s *QueryScope) TripleStore {
+	if ro, ok := ts.(readOnly); ok {
+		return ReadOnly(Scope(ro.TripleStore, s))
+	}
+	sc, ok := ts.(Scoper)
+	if !ok {
+		return ts
+	}
+	return sc.Scope(s)
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"github.com/google/cayley/quad"
+)
+
+// A Summary gives the size of a store at a glance.
+type Summary struct {
+	// The number of triples, and of distinct nodes in each direction of
+	// them. The empty label of unlabeled triples is not counted.
+	Triples    int64 `json:"triples"`
+	Subjects   int64 `json:"subjects"`
+	Predicates int64 `json:"predicates"`
+	Objects    int64 `json:"objects"`
+	Labels     int64 `json:"labels"`
+
+	// The approximate number of bytes the store takes on disk, or 0 if
+	// the store does not know.
+	DiskSize int64 `json:"disk_size"`
+}
+
+// A Summarizer can summarize itself, such as by counting in the backend.
+type Summarizer interface {
+	Summarize() (Summary, error)
+}
+
+// Summarize returns a Summary of ts. A store that is not a Summarizer, or
+// does not have CapCount, has every triple read, holding the names of its
+// nodes in memory, which suits only small stores.
+func Summarize(ts TripleStore) (Summary, error) {
+	ts = unwrap(ts)
+	if s, ok := ts.(Summarizer); ok && CapabilitiesOf(ts).Has(CapCount) {
+		return s.Summarize()
+	}
+	var sum Summary
+	var seen [quad.Label + 1]map[string]bool
+	for d := quad.Subject; d <= quad.Label; d++ {
+		seen[d] = make(map[string]bool)
+	}
+	it := ts.TriplesAllIterator()
+	for Next(it) {
+		t := ts.Quad(it.Result())
+		sum.Triples++
+		for d := quad.Subject; d <= quad.Label; d++ {
+			if n := t.Get(d); n != "" {
+				seen[d][n] = true
+			}
+		}
+	}
+	it.Close()
+	sum.Subjects = int64(len(seen[quad.Subject]))
+	sum.Predicates = int64(len(seen[quad.Predicate]))
+	sum.Objects = int64(len(seen[quad.Object]))
+	sum.Labels = int64(len(seen[quad.Label]))
+	return sum, nil
+}
@@ -23,6 +23,7 @@ package graph
 
 import (
 	"errors"
+	"time"
 
 	"github.com/barakmich/glog"
 	"github.com/google/cayley/quad"
@@ -55,6 +56,10 @@ type TripleStore interface {
 	// Given an opaque token, returns the triple for that token from the store.
 	Quad(Value) quad.Quad
 
+	// Returns whether a triple matching the given one in all four
+	// directions, including the label, is in the store.
+	QuadExists(quad.Quad) (bool, error)
+
 	// Given a direction and a token, creates an iterator of links which have
 	// that node token in that directional field.
 	TripleIterator(quad.Direction, Value) Iterator
@@ -112,6 +117,18 @@ func (d Options) IntKey(key string) (int, bool) {
 	return 0, false
 }
 
+func (d Options) BoolKey(key string) (bool, bool) {
+	if val, ok := d[key]; ok {
+		switch vv := val.(type) {
+		case bool:
+			return vv, true
+		default:
+			glog.Fatalln("Invalid", key, "parameter type from config.")
+		}
+	}
+	return false, false
+}
+
 func (d Options) StringKey(key string) (string, bool) {
 	if val, ok := d[key]; ok {
 		switch vv := val.(type) {
@@ -133,6 +150,462 @@ type BulkLoader interface {
 	BulkLoad(quad.Unmarshaler) error
 }
 
+// A BulkNamer can look up the names of many values at once.
+type BulkNamer interface {
+	// NamesOf returns the names of vals, in order, finding those it does not
+	// hold in memory in as few round trips to the backend as it can.
+	NamesOf(vals []Value) ([]string, error)
+}
+
+// WarmNames looks up the names of vals in one pass if ts is a BulkNamer, so
+// that the NameOf calls that follow are answered from its cache. Stores that
+// are not BulkNamers are left to resolve names as they are asked.
+func WarmNames(ts TripleStore, vals []Value) error {
+	ts = unwrap(ts)
+	bn, ok := ts.(BulkNamer)
+	if !ok || len(vals) == 0 {
+		return nil
+	}
+	_, err := bn.NamesOf(vals)
+	return err
+}
+
+var ErrCannotBulkName = errors.New("triplestore: database cannot look up the names of values in bulk")
+
+// NamesOf returns the names of vals, in order, looked up at once, or
+// ErrCannotBulkName if ts is not a BulkNamer. A value that names no node
+// has the empty name.
+func NamesOf(ts TripleStore, vals []Value) ([]string, error) {
+	ts = unwrap(ts)
+	bn, ok := ts.(BulkNamer)
+	if !ok {
+		return nil, ErrCannotBulkName
+	}
+	return bn.NamesOf(vals)
+}
+
+// A NamePinner keeps the names of chosen values in memory for good, so that
+// looking them up never goes to the backend once they are pinned.
+type NamePinner interface {
+	// PinNames looks up the names of vals and keeps them, however many
+	// other names are looked up after them.
+	PinNames(vals []Value) error
+}
+
+// PinNames pins the names of the nodes with the given names in ts if it is a
+// NamePinner. Other stores hold every name in memory already, or have no
+// cache to pin them in, so are left alone.
+func PinNames(ts TripleStore, names []string) error {
+	ts = unwrap(ts)
+	np, ok := ts.(NamePinner)
+	if !ok || len(names) == 0 {
+		return nil
+	}
+	vals := make([]Value, len(names))
+	for i, name := range names {
+		vals[i] = ts.ValueOf(name)
+	}
+	return np.PinNames(vals)
+}
+
+// An IndexSuggestion is an index a store would answer the queries it has
+// made faster with.
+type IndexSuggestion struct {
+	// The fields of the index, in order.
+	Keys []string `json:"keys"`
+
+	// The number of queries seen that the index would serve.
+	Queries int `json:"queries"`
+}
+
+// An IndexAdvisor watches the queries it makes for indexes it lacks.
+type IndexAdvisor interface {
+	SuggestIndexes() []IndexSuggestion
+}
+
+// SuggestIndexes returns the indexes ts suggests for the queries it has
+// made, if it is an IndexAdvisor, most used first. Other stores suggest
+// none.
+func SuggestIndexes(ts TripleStore) []IndexSuggestion {
+	ts = unwrap(ts)
+	if a, ok := ts.(IndexAdvisor); ok {
+		return a.SuggestIndexes()
+	}
+	return nil
+}
+
+var ErrCannotTimeTravel = errors.New("triplestore: cannot view the database as of a time")
+
+// A TimeTraveler can present the store as it was at an earlier time.
+type TimeTraveler interface {
+	// AsOf returns a read-only view of the store as it was at t.
+	AsOf(t time.Time) TripleStore
+}
+
+// AsOf returns a read-only view of ts as it was at t, or ErrCannotTimeTravel
+// if ts is not a TimeTraveler.
+func AsOf(ts TripleStore, t time.Time) (TripleStore, error) {
+	ts = unwrap(ts)
+	tt, ok := ts.(TimeTraveler)
+	if !ok {
+		return nil, ErrCannotTimeTravel
+	}
+	return tt.AsOf(t), nil
+}
+
+// A LabelRestricter can present the store with only the triples of some
+// labels, for serving clients that may see no others.
+type LabelRestricter interface {
+	// RestrictLabels returns a read-only view of the store in which only
+	// the triples with one of labels are found. The empty label is that of
+	// triples without one.
+	RestrictLabels(labels []string) TripleStore
+}
+
+// AsLabelRestricter returns ts as a LabelRestricter, looking through a
+// read-only wrapper, and whether it is one.
+func AsLabelRestricter(ts TripleStore) (LabelRestricter, bool) {
+	ts = unwrap(ts)
+	lr, ok := ts.(LabelRestricter)
+	return lr, ok
+}
+
+var ErrNoProvenance = errors.New("triplestore: database does not record the sources of triples")
+
+// A Sourcer records the source of each triple written, such as the user
+// that wrote it, and can present the store by source.
+type Sourcer interface {
+	// WithSource returns a view of the store that records source as the
+	// source of the triples written through it.
+	WithSource(source string) TripleStore
+
+	// BySource returns a read-only view of the store in which only the
+	// triples written from source are found, if source is not empty, and
+	// whose iterators over triples tag the source of each with tag, if tag
+	// is not empty.
+	BySource(source, tag string) TripleStore
+}
+
+// WithSource returns a view of ts that records source as the source of the
+// triples written through it, keeping it read-only if it was, or
+// ErrNoProvenance if ts is not a Sourcer.
+func WithSource(ts TripleStore, source string) (TripleStore, error) {
+	if ro, ok := ts.(readOnly); ok {
+		view, err := WithSource(ro.TripleStore, source)
+		if err != nil {
+			return nil, err
+		}
+		return ReadOnly(view), nil
+	}
+	s, ok := ts.(Sourcer)
+	if !ok {
+		return nil, ErrNoProvenance
+	}
+	return s.WithSource(source), nil
+}
+
+// BySource returns a read-only view of ts by source, as a Sourcer's
+// BySource does, or ErrNoProvenance if ts is not a Sourcer.
+func BySource(ts TripleStore, source, tag string) (TripleStore, error) {
+	ts = unwrap(ts)
+	s, ok := ts.(Sourcer)
+	if !ok {
+		return nil, ErrNoProvenance
+	}
+	return s.BySource(source, tag), nil
+}
+
+var ErrNoWriteLimit = errors.New("triplestore: database cannot limit the rate of writes")
+
+// A WriteLimit is the most a store may write a second. A zero rate is no
+// limit.
+type WriteLimit struct {
+	// QuadsPerSec is the most quads written or removed a second.
+	QuadsPerSec int64 `json:"quads_per_sec"`
+
+	// BytesPerSec is the most bytes of node names written or removed a
+	// second.
+	BytesPerSec int64 `json:"bytes_per_sec"`
+}
+
+// A WriteLimiter throttles its writes to a WriteLimit, so that a runaway
+// load cannot overwhelm a backend shared with others. Writes beyond the
+// limit wait for their turn rather than fail.
+type WriteLimiter interface {
+	WriteLimit() WriteLimit
+	SetWriteLimit(WriteLimit)
+}
+
+// WriteLimitOf returns the write limit of ts, or ErrNoWriteLimit if ts is
+// not a WriteLimiter.
+func WriteLimitOf(ts TripleStore) (WriteLimit, error) {
+	ts = unwrap(ts)
+	wl, ok := ts.(WriteLimiter)
+	if !ok {
+		return WriteLimit{}, ErrNoWriteLimit
+	}
+	return wl.WriteLimit(), nil
+}
+
+// SetWriteLimit changes the write limit of ts from now on, or returns
+// ErrNoWriteLimit if ts is not a WriteLimiter.
+func SetWriteLimit(ts TripleStore, limit WriteLimit) error {
+	ts = unwrap(ts)
+	wl, ok := ts.(WriteLimiter)
+	if !ok {
+		return ErrNoWriteLimit
+	}
+	wl.SetWriteLimit(limit)
+	return nil
+}
+
+var ErrCannotFlush = errors.New("triplestore: database cannot flush writes to disk")
+
+// A Flusher can make everything written to it so far durable on demand,
+// so that a snapshot of its disks taken afterwards holds it all.
+type Flusher interface {
+	// Flush returns once the writes made before it are on disk.
+	Flush() error
+}
+
+// Flush makes the writes made to ts so far durable, or returns
+// ErrCannotFlush if ts is not a Flusher.
+func Flush(ts TripleStore) error {
+	ts = unwrap(ts)
+	f, ok := ts.(Flusher)
+	if !ok {
+		return ErrCannotFlush
+	}
+	return f.Flush()
+}
+
+// An Identified store has an identifier of its own, so that clients of
+// several stores can tell which one they reached.
+type Identified interface {
+	StoreID() string
+}
+
+// StoreID returns the identifier of ts, or "" if ts is not Identified.
+func StoreID(ts TripleStore) string {
+	ts = unwrap(ts)
+	if id, ok := ts.(Identified); ok {
+		return id.StoreID()
+	}
+	return ""
+}
+
+var ErrReadOnly = errors.New("triplestore: database is read-only")
+
+type readOnly struct {
+	TripleStore
+}
+
+// ReadOnly returns a TripleStore that serves reads from ts but refuses all
+// writes, logging ErrReadOnly instead.
+func ReadOnly(ts TripleStore) TripleStore {
+	if IsReadOnly(ts) {
+		return ts
+	}
+	return readOnly{ts}
+}
+
+// unwrap returns the store that ts serves reads from if it was returned by
+// ReadOnly, so that the optional interfaces of the store are found, or ts
+// itself otherwise.
+func unwrap(ts TripleStore) TripleStore {
+	if ro, ok := ts.(readOnly); ok {
+		return ro.TripleStore
+	}
+	return ts
+}
+
+// IsReadOnly returns whether ts was returned by ReadOnly.
+func IsReadOnly(ts TripleStore) bool {
+	_, ok := ts.(readOnly)
+	return ok
+}
+
+func (ts readOnly) AddTriple(t quad.Quad) {
+	glog.Errorf("Error: %v while adding triple %v", ErrReadOnly, t)
+}
+
+func (ts readOnly) AddTripleSet(in []quad.Quad) {
+	glog.Errorf("Error: %v while adding %d triples", ErrReadOnly, len(in))
+}
+
+func (ts readOnly) RemoveTriple(t quad.Quad) {
+	glog.Errorf("Error: %v while removing triple %v", ErrReadOnly, t)
+}
+
+// MergeNodes rewrites every triple that refers to the node from, in any
+// direction, to refer to the node into instead. Once no triples refer to from,
+// the store no longer holds it.
+//
+// Triples made identical by the rewrite are only added once. Backends derive
+// triple identity from their contents, so the rewrite is done by removing the
+// old triples and adding the new ones. This holds for Mongo too, where the
+// _id of a triple is made from its nodes and cannot be updated in place.
+//
+// The rewrite is not atomic, on any backend. Each old triple is removed on
+// its own before the new ones are added together, so queries made meanwhile
+// may find neither, and a merge that fails part way leaves the removed
+// triples lost. Merge nodes while nothing else reads or writes them.
+//
+// MergeNodes returns ErrReadOnly for a read-only store, and ErrMergeEmpty if
+// either node is empty, which would rewrite triples into invalid ones.
+func MergeNodes(ts TripleStore, from, into string) error {
+	if IsReadOnly(ts) {
+		return ErrReadOnly
+	}
+	if from == "" || into == "" {
+		return ErrMergeEmpty
+	}
+	if from == into {
+		return nil
+	}
+	var old []quad.Quad
+	seen := make(map[quad.Quad]struct{})
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+		it := ts.TripleIterator(d, ts.ValueOf(from))
+		for Next(it) {
+			t := ts.Quad(it.Result())
+			// A triple may refer to from in more than one direction.
+			if _, ok := seen[t]; ok || t.Get(d) != from {
+				continue
+			}
+			seen[t] = struct{}{}
+			old = append(old, t)
+		}
+		it.Close()
+	}
+	if len(old) == 0 {
+		return nil
+	}
+
+	merged := make([]quad.Quad, 0, len(old))
+	added := make(map[quad.Quad]struct{})
+	for _, t := range old {
+		ts.RemoveTriple(t)
+		if t.Subject == from {
+			t.Subject = into
+		}
+		if t.Predicate == from {
+			t.Predicate = into
+		}
+		if t.Object == from {
+			t.Object = into
+		}
+		if t.Label == from {
+			t.Label = into
+		}
+		if _, ok := added[t]; ok {
+			continue
+		}
+		added[t] = struct{}{}
+		merged = append(merged, t)
+	}
+	ts.AddTripleSet(merged)
+	return nil
+}
+
+var ErrMergeEmpty = errors.New("triplestore: cannot merge the empty node")
+
+var ErrDeleteAll = errors.New("triplestore: deletion would remove every triple")
+
+// A ConstraintDeleter can remove every triple with a node in a direction at
+// once, in the backend, rather than one by one.
+type ConstraintDeleter interface {
+	// DeleteBy removes every triple with the node name in direction d,
+	// or every triple if d is quad.Any, and returns how many it removed.
+	// Unless all is true, it removes nothing and returns ErrDeleteAll if
+	// that would empty the store.
+	DeleteBy(d quad.Direction, name string, all bool) (int64, error)
+}
+
+// DeleteBy removes every triple in ts with the node name in direction d, or
+// every triple if d is quad.Any, such as to retire a predicate, and returns
+// how many it removed. Emptying the store must be asked for by all being
+// true; otherwise nothing is removed and ErrDeleteAll is returned. A store
+// that is not a ConstraintDeleter has each triple removed in turn.
+func DeleteBy(ts TripleStore, d quad.Direction, name string, all bool) (int64, error) {
+	if IsReadOnly(ts) {
+		return 0, ErrReadOnly
+	}
+	if d == quad.Any && !all {
+		return 0, ErrDeleteAll
+	}
+	if cd, ok := ts.(ConstraintDeleter); ok {
+		return cd.DeleteBy(d, name, all)
+	}
+
+	var it Iterator
+	if d == quad.Any {
+		it = ts.TriplesAllIterator()
+	} else {
+		it = ts.TripleIterator(d, ts.ValueOf(name))
+	}
+	// Triples are gathered before any is removed, as removing them may
+	// disturb the iterator.
+	var old []quad.Quad
+	for Next(it) {
+		if t := ts.Quad(it.Result()); t.IsValid() {
+			old = append(old, t)
+		}
+	}
+	it.Close()
+	if !all && len(old) != 0 && int64(len(old)) == ts.Size() {
+		return 0, ErrDeleteAll
+	}
+	for _, t := range old {
+		ts.RemoveTriple(t)
+	}
+	return int64(len(old)), nil
+}
+
+// DistinctLister is implemented by TripleStores that can directly list the
+// nodes found in a direction of their triples.
+type DistinctLister interface {
+	// DistinctIterator returns an iterator over every node that is in
+	// direction d of some triple, yielding each node once.
+	DistinctIterator(d quad.Direction) Iterator
+}
+
+// RangeLister is implemented by TripleStores that can list the nodes found
+// in a direction of their triples whose names fall in a range.
+type RangeLister interface {
+	// RangeIterator returns an iterator over every node in direction d of
+	// some triple whose name is at least lo and, unless hi is empty, less
+	// than hi, yielding each node once, in order of name.
+	RangeIterator(d quad.Direction, lo, hi string) Iterator
+}
+
+// TextSearcher is implemented by TripleStores that can search the names of
+// the objects of their triples for words.
+type TextSearcher interface {
+	// TextSearch returns an iterator over the triples whose objects
+	// match any of the words of text, the best matches first. If
+	// scoreTag is not empty, and the store ranks its matches, each
+	// result is tagged with its score under scoreTag.
+	TextSearch(text, scoreTag string) Iterator
+}
+
+// Completer is implemented by TripleStores that can find the nodes whose
+// names start with a prefix without reading every node.
+type Completer interface {
+	// Complete returns an iterator over the nodes whose names start
+	// with prefix, in order of name, yielding at most limit of them
+	// unless limit is negative.
+	Complete(prefix string, limit int) Iterator
+}
+
+// AsCompleter returns ts as a Completer, looking through a read-only
+// wrapper, and whether it is one.
+func AsCompleter(ts TripleStore) (Completer, bool) {
+	ts = unwrap(ts)
+	c, ok := ts.(Completer)
+	return c, ok
+}
+
 type NewStoreFunc func(string, Options) (TripleStore, error)
 type InitStoreFunc func(string, Options) error
 
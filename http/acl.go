@@ -0,0 +1,109 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query"
+)
+
+// defaultACLHeader is the request header naming the client, set by an
+// authenticating proxy in front of the server, if acl_header is not given.
+const defaultACLHeader = "X-Remote-User"
+
+// aclLabels returns the name of the client of r and the labels the
+// label_acl permits it, which are nil if it is permitted every label.
+// Clients that are not in the label_acl are forbidden. Those whose requests
+// do not name them are permitted the labels of the empty name, if it is in
+// the label_acl.
+func (api *Api) aclLabels(r *http.Request) (string, []string, error) {
+	header := api.config.ACLHeader
+	if header == "" {
+		header = defaultACLHeader
+	}
+	client := r.Header.Get(header)
+	labels, ok := api.config.LabelACL[client]
+	if !ok {
+		return client, nil, &query.ForbiddenError{Err: fmt.Errorf("client %q is not permitted any labels", client)}
+	}
+	return client, labels, nil
+}
+
+// restrictLabels returns ts restricted to the labels the label_acl permits
+// the client of r, or ts itself if there is no label_acl or the client is
+// given null rather than a list of labels.
+func (api *Api) restrictLabels(r *http.Request, ts graph.TripleStore) (graph.TripleStore, error) {
+	if api.config.LabelACL == nil {
+		return ts, nil
+	}
+	_, labels, err := api.aclLabels(r)
+	if err != nil {
+		return nil, err
+	}
+	if labels == nil {
+		return ts, nil
+	}
+	return iterator.RestrictLabels(ts, labels), nil
+}
+
+// writeLabels returns the labels the client of r may write triples to and
+// delete them from, which are nil if it may write to any, as under no
+// label_acl. Clients that are not in the label_acl are forbidden.
+func (api *Api) writeLabels(r *http.Request) ([]string, error) {
+	if api.config.LabelACL == nil {
+		return nil, nil
+	}
+	_, labels, err := api.aclLabels(r)
+	return labels, err
+}
+
+// checkLabel returns a ForbiddenError if labels, as given by writeLabels,
+// do not hold the label of t.
+func checkLabel(labels []string, t quad.Quad) error {
+	if labels == nil {
+		return nil
+	}
+	for _, l := range labels {
+		if l == t.Label {
+			return nil
+		}
+	}
+	return &query.ForbiddenError{Err: fmt.Errorf("label %q of triple %s is not permitted", t.Label, t)}
+}
+
+// adminOnly wraps a handler of the admin API so that, under a label_acl, only
+// clients permitted every label reach it, as the rest could otherwise list
+// and cancel each other's queries, or change the store for everyone.
+func (api *Api) adminOnly(handler ResponseHandler) ResponseHandler {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+		if api.config.LabelACL != nil {
+			client, labels, err := api.aclLabels(r)
+			if err == nil && labels != nil {
+				err = &query.ForbiddenError{Err: fmt.Errorf("client %q is not permitted every label", client)}
+			}
+			if err != nil {
+				return FormatQueryError(w, err)
+			}
+		}
+		return handler(w, r, params)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query"
+)
+
+// ServeV1Pin pins the names of the nodes named in the JSON list in the
+// request body in the store's cache.
+func (api *Api) ServeV1Pin(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	var names []string
+	if err := json.Unmarshal(bodyBytes, &names); err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	if err := graph.PinNames(api.ts, names); err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully pinned %d nodes.\"}", len(names))
+	return 200
+}
+
+// ServeV1Indexes lists the indexes the store suggests for the queries it
+// has made.
+func (api *Api) ServeV1Indexes(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	suggested := graph.SuggestIndexes(api.ts)
+	if suggested == nil {
+		suggested = []graph.IndexSuggestion{}
+	}
+	bytes, err := WrapResult(suggested)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
+
+// ServeV1Queries lists the queries the server is running, oldest first.
+func (api *Api) ServeV1Queries(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	bytes, err := WrapResult(api.queries.list())
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
+
+// ServeV1CancelQuery cancels the running query with the id in the path.
+func (api *Api) ServeV1CancelQuery(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	what := fmt.Sprintf("running query %q", params.ByName("id"))
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	if err != nil {
+		return FormatQueryError(w, &query.NotFound{What: what})
+	}
+	if !api.queries.cancel(id) {
+		return FormatQueryError(w, &query.NotFound{What: what})
+	}
+	fmt.Fprintf(w, "{\"result\": \"Cancelled query %d.\"}", id)
+	return 200
+}
+
+// ServeV1WriteLimit returns the write limit of the store.
+func (api *Api) ServeV1WriteLimit(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	limit, err := graph.WriteLimitOf(api.ts)
+	if err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	bytes, err := WrapResult(limit)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
+
+// ServeV1SetWriteLimit changes the write limit of the store to the one in
+// the request body, which takes effect on writes already under way.
+func (api *Api) ServeV1SetWriteLimit(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	var limit graph.WriteLimit
+	if err := json.Unmarshal(bodyBytes, &limit); err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	if limit.QuadsPerSec < 0 || limit.BytesPerSec < 0 {
+		return FormatQueryError(w, &query.ParseError{Err: fmt.Errorf("write limit must not be negative")})
+	}
+	if err := graph.SetWriteLimit(api.ts, limit); err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	fmt.Fprint(w, "{\"result\": \"Successfully set the write limit.\"}")
+	return 200
+}
+
+// ServeV1Flush returns once the store has made every write before the
+// request durable, so that a backup of its disks taken afterwards holds
+// them.
+func (api *Api) ServeV1Flush(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	err := graph.Flush(api.ts)
+	if err == graph.ErrCannotFlush {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, "{\"result\": \"Successfully flushed writes to disk.\"}")
+	return 200
+}
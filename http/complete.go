@@ -0,0 +1,63 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/query"
+)
+
+// defaultCompletions is the number of completions given without a limit
+// parameter.
+const defaultCompletions = 10
+
+// ServeV1Autocomplete writes the names of the nodes that start with the
+// prefix query parameter, in order, at most as many as the limit parameter
+// gives. Clients under a label_acl are given only the nodes of their
+// labels.
+func (api *Api) ServeV1Autocomplete(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	limit := defaultCompletions
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return FormatQueryError(w, &query.ParseError{Err: errors.New("limit must be a positive number")})
+		}
+		limit = n
+	}
+	ts, err := api.restrictLabels(r, api.ts)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	it := iterator.Complete(ts, r.URL.Query().Get("prefix"), limit)
+	defer it.Close()
+	names := []string{}
+	for graph.Next(it) {
+		names = append(names, ts.NameOf(it.Result()))
+	}
+	bytes, err := WrapResult(names)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
@@ -0,0 +1,52 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query"
+)
+
+var errNoNode = errors.New("no node to describe, give one with the id query parameter")
+
+// ServeV1Describe writes everything about the node given by the id query
+// parameter, keyed by predicate: the objects of the triples it is the
+// subject of, and, with in=true, the subjects of those it is the object of.
+func (api *Api) ServeV1Describe(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	node := r.URL.Query().Get("id")
+	if node == "" {
+		return FormatQueryError(w, &query.ParseError{Err: errNoNode})
+	}
+	ts, err := api.restrictLabels(r, api.ts)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	desc, err := graph.Describe(ts, node, r.URL.Query().Get("in") == "true")
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	bytes, err := WrapResult(desc)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
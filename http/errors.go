@@ -0,0 +1,78 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query"
+	"github.com/google/cayley/query/gremlin"
+)
+
+// asQueryError classifies err. Errors that are not known to be anything
+// else are taken to be faults in the request.
+func asQueryError(err error) query.Error {
+	if qerr, ok := err.(query.Error); ok {
+		return qerr
+	}
+	switch err {
+	case gremlin.ErrKillTimeout:
+		return &query.TimeoutError{Err: err}
+	case gremlin.ErrKilled, graph.ErrQueryCancelled:
+		return &query.CancelledError{Err: err}
+	case graph.ErrReadOnly, graph.ErrUnavailable:
+		return &query.BackendError{Err: err}
+	}
+	return &query.ParseError{Err: err}
+}
+
+// statusOf returns the HTTP status for err.
+func statusOf(err query.Error) int {
+	switch err.Code() {
+	case query.CodeParse:
+		return http.StatusBadRequest
+	case query.CodeNotFound:
+		return http.StatusNotFound
+	case query.CodeTimeout:
+		return http.StatusRequestTimeout
+	case query.CodeForbidden:
+		return http.StatusForbidden
+	case query.CodeBackend:
+		if berr, ok := err.(*query.BackendError); ok {
+			switch berr.Err {
+			case graph.ErrReadOnly:
+				return http.StatusForbidden
+			case graph.ErrUnavailable:
+				return http.StatusServiceUnavailable
+			}
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// FormatQueryError writes err, with its code, in the error envelope, with
+// the status for its code, and returns that status.
+func FormatQueryError(w http.ResponseWriter, err error) int {
+	qerr := asQueryError(err)
+	status := statusOf(qerr)
+	body, _ := json.MarshalIndent(ErrorQueryWrapper{
+		Error: qerr.Error(),
+		Code:  qerr.Code(),
+	}, "", " ")
+	http.Error(w, string(body), status)
+	return status
+}
@@ -0,0 +1,198 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query"
+	"github.com/google/cayley/query/gremlin"
+)
+
+var errorTests = []struct {
+	message string
+	err     error
+	status  int
+	expect  ErrorQueryWrapper
+}{
+	{
+		message: "report a parse error",
+		err:     &query.ParseError{Err: errors.New("unexpected token")},
+		status:  http.StatusBadRequest,
+		expect:  ErrorQueryWrapper{Error: "unexpected token", Code: query.CodeParse},
+	},
+	{
+		message: "report a backend error",
+		err:     &query.BackendError{Err: errors.New("connection refused")},
+		status:  http.StatusInternalServerError,
+		expect:  ErrorQueryWrapper{Error: "connection refused", Code: query.CodeBackend},
+	},
+	{
+		message: "report a read-only backend",
+		err:     &query.BackendError{Err: graph.ErrReadOnly},
+		status:  http.StatusForbidden,
+		expect:  ErrorQueryWrapper{Error: graph.ErrReadOnly.Error(), Code: query.CodeBackend},
+	},
+	{
+		message: "report an unavailable backend",
+		err:     graph.ErrUnavailable,
+		status:  http.StatusServiceUnavailable,
+		expect:  ErrorQueryWrapper{Error: graph.ErrUnavailable.Error(), Code: query.CodeBackend},
+	},
+	{
+		message: "report a timeout",
+		err:     &query.TimeoutError{Err: errors.New("too slow")},
+		status:  http.StatusRequestTimeout,
+		expect:  ErrorQueryWrapper{Error: "too slow", Code: query.CodeTimeout},
+	},
+	{
+		message: "report a Gremlin timeout",
+		err:     gremlin.ErrKillTimeout,
+		status:  http.StatusRequestTimeout,
+		expect:  ErrorQueryWrapper{Error: gremlin.ErrKillTimeout.Error(), Code: query.CodeTimeout},
+	},
+	{
+		message: "report a cancelled query",
+		err:     graph.ErrQueryCancelled,
+		status:  http.StatusInternalServerError,
+		expect:  ErrorQueryWrapper{Error: graph.ErrQueryCancelled.Error(), Code: query.CodeCancelled},
+	},
+	{
+		message: "report a killed Gremlin query",
+		err:     gremlin.ErrKilled,
+		status:  http.StatusInternalServerError,
+		expect:  ErrorQueryWrapper{Error: gremlin.ErrKilled.Error(), Code: query.CodeCancelled},
+	},
+	{
+		message: "report something not found",
+		err:     &query.NotFound{What: "thing"},
+		status:  http.StatusNotFound,
+		expect:  ErrorQueryWrapper{Error: "thing not found", Code: query.CodeNotFound},
+	},
+	{
+		message: "report a forbidden request",
+		err:     &query.ForbiddenError{Err: errors.New("no labels")},
+		status:  http.StatusForbidden,
+		expect:  ErrorQueryWrapper{Error: "no labels", Code: query.CodeForbidden},
+	},
+	{
+		message: "report an unclassified error as a fault in the request",
+		err:     errors.New("bad query"),
+		status:  http.StatusBadRequest,
+		expect:  ErrorQueryWrapper{Error: "bad query", Code: query.CodeParse},
+	},
+}
+
+func TestFormatQueryError(t *testing.T) {
+	for _, test := range errorTests {
+		w := httptest.NewRecorder()
+		code := FormatQueryError(w, test.err)
+		if code != test.status || w.Code != test.status {
+			t.Errorf("Unexpected status to %s, got:%d (recorded %d) expect:%d", test.message, code, w.Code, test.status)
+		}
+		var got ErrorQueryWrapper
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Errorf("Failed to %s with a JSON body, got:%q: %v", test.message, w.Body.String(), err)
+			continue
+		}
+		if got != test.expect {
+			t.Errorf("Unexpected body to %s, got:%+v expect:%+v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	ts, err := graph.NewTripleStore("memstore", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to open memstore: %v", err)
+	}
+	api := &Api{config: &config.Config{}, ts: ts}
+	roApi := &Api{config: &config.Config{}, ts: graph.ReadOnly(ts)}
+
+	for _, test := range []struct {
+		message string
+		handler ResponseHandler
+		lang    string
+		body    string
+		status  int
+		code    query.Code
+	}{
+		{
+			message: "query an unknown language",
+			handler: api.ServeV1Query,
+			lang:    "sparql",
+			body:    `SELECT ?s WHERE {}`,
+			status:  http.StatusNotFound,
+			code:    query.CodeNotFound,
+		},
+		{
+			message: "query with invalid MQL",
+			handler: api.ServeV1Query,
+			lang:    "mql",
+			body:    `[{"id": `,
+			status:  http.StatusBadRequest,
+			code:    query.CodeParse,
+		},
+		{
+			message: "shape an unknown language",
+			handler: api.ServeV1Shape,
+			lang:    "sparql",
+			body:    `SELECT ?s WHERE {}`,
+			status:  http.StatusNotFound,
+			code:    query.CodeNotFound,
+		},
+		{
+			message: "write invalid triples",
+			handler: api.ServeV1Write,
+			body:    `[{"subject": "foo"}]`,
+			status:  http.StatusBadRequest,
+			code:    query.CodeParse,
+		},
+		{
+			message: "write to a read-only store",
+			handler: roApi.ServeV1Write,
+			body:    `[{"subject": "foo", "predicate": "bar", "object": "baz"}]`,
+			status:  http.StatusForbidden,
+			code:    query.CodeBackend,
+		},
+	} {
+		req, err := http.NewRequest("POST", "/api/v1/", bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		code := test.handler(w, req, httprouter.Params{{Key: "query_lang", Value: test.lang}})
+		if code != test.status || w.Code != test.status {
+			t.Errorf("Unexpected status to %s, got:%d (recorded %d) expect:%d", test.message, code, w.Code, test.status)
+		}
+		var got ErrorQueryWrapper
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Errorf("Failed to %s with a JSON body, got:%q: %v", test.message, w.Body.String(), err)
+			continue
+		}
+		if got.Code != test.code || got.Error == "" {
+			t.Errorf("Unexpected body to %s, got:%+v expect code:%q", test.message, got, test.code)
+		}
+	}
+}
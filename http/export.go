@@ -0,0 +1,216 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+// Query results can be streamed as CSV, with a column for each tag, or as a
+// JSON array of rows, rather than wrapped in a single JSON object once they
+// are all in. Each row is written as soon as the query finds it.
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/barakmich/glog"
+
+	"github.com/google/cayley/query"
+)
+
+var errCannotStream = errors.New("query language cannot stream results")
+
+// exportFormat returns the format results are to be streamed in, given by
+// the format parameter or else an Accept header of text/csv, or "" if they
+// are to be returned whole.
+func exportFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "csv", "json":
+		return format, nil
+	case "":
+		if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			return "csv", nil
+		}
+		return "", nil
+	default:
+		return "", &query.ParseError{Err: fmt.Errorf("unknown format %q", format)}
+	}
+}
+
+// A resultWriter writes rows of tag names as they are found.
+type resultWriter interface {
+	WriteRow(map[string]string) error
+	// Close finishes the results once every row is written.
+	Close() error
+}
+
+// csvResults writes rows as CSV records, beneath a header of the columns.
+// Unless they are given, the columns are the tags of the first row, in
+// order. A tag a row lacks is an empty cell, and tags with no column are
+// left out.
+type csvResults struct {
+	w       *csv.Writer
+	columns []string
+	header  bool
+}
+
+func newCSVResults(w io.Writer, columns []string) *csvResults {
+	return &csvResults{w: csv.NewWriter(w), columns: columns}
+}
+
+func (r *csvResults) writeHeader() error {
+	r.header = true
+	return r.w.Write(r.columns)
+}
+
+func (r *csvResults) WriteRow(row map[string]string) error {
+	if !r.header {
+		if r.columns == nil {
+			for tag := range row {
+				r.columns = append(r.columns, tag)
+			}
+			sort.Strings(r.columns)
+		}
+		if err := r.writeHeader(); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(r.columns))
+	for i, tag := range r.columns {
+		record[i] = row[tag]
+	}
+	if err := r.w.Write(record); err != nil {
+		return err
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
+
+func (r *csvResults) Close() error {
+	if !r.header && r.columns != nil {
+		if err := r.writeHeader(); err != nil {
+			return err
+		}
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
+
+// jsonResults writes rows as the objects of a JSON array, a line each.
+type jsonResults struct {
+	w    io.Writer
+	rows int
+}
+
+func (r *jsonResults) WriteRow(row map[string]string) error {
+	b, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if r.rows == 0 {
+		sep = "[\n"
+	}
+	r.rows++
+	_, err = fmt.Fprintf(r.w, "%s%s", sep, b)
+	return err
+}
+
+func (r *jsonResults) Close() error {
+	end := "\n]\n"
+	if r.rows == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(r.w, end)
+	return err
+}
+
+// newResultWriter sets the content type of w for format, and returns a
+// writer of rows to it.
+func newResultWriter(w http.ResponseWriter, format string, columns []string) resultWriter {
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		return newCSVResults(w, columns)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return &jsonResults{w: w}
+}
+
+// StreamResults runs input, writing each row of tags it finds to w in
+// format as soon as it is found, at most max of them if max is positive.
+// Errors found before the first row is written are reported as usual;
+// those found after are logged, and the results end where they were cut
+// short.
+func StreamResults(w http.ResponseWriter, input string, ses query.HttpSession, max int, format string, columns []string) int {
+	code, _ := streamResults(w, input, ses, max, format, columns)
+	return code
+}
+
+// streamResults is StreamResults, also returning the number of rows
+// written.
+func streamResults(w http.ResponseWriter, input string, ses query.HttpSession, max int, format string, columns []string) (int, int) {
+	streamer, ok := ses.(query.TagStreamer)
+	if !ok {
+		return FormatQueryError(w, &query.ParseError{Err: errCannotStream}), 0
+	}
+	limit := -1
+	if max > 0 {
+		limit = max
+	}
+	c := make(chan interface{}, 5)
+	go ses.ExecInput(input, c, limit)
+	var out resultWriter
+	var failed error
+	var rows int
+	for res := range c {
+		if failed != nil {
+			// The query is left to finish, so it is not blocked.
+			continue
+		}
+		row, ok := streamer.ResultTags(res)
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = newResultWriter(w, format, columns)
+		}
+		if failed = out.WriteRow(row); failed != nil {
+			glog.Errorln("Error writing results: ", failed)
+			continue
+		}
+		rows++
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	_, err := ses.GetJson()
+	if out == nil {
+		if err != nil {
+			return FormatQueryError(w, err), 0
+		}
+		out = newResultWriter(w, format, columns)
+	} else if err != nil {
+		glog.Errorln("Error after streaming results: ", err)
+	}
+	if failed == nil {
+		if err := out.Close(); err != nil {
+			glog.Errorln("Error writing results: ", err)
+		}
+	}
+	return 200, rows
+}
@@ -0,0 +1,296 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/db"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query"
+)
+
+func TestCSVResults(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		columns []string
+		rows    []map[string]string
+		expect  string
+	}{
+		{
+			message: "quote values with commas and quotes",
+			rows: []map[string]string{
+				{"id": "alice", "name": "Smith, Alice"},
+				{"id": "bob", "name": `Bob "the builder"`},
+			},
+			expect: "id,name\nalice,\"Smith, Alice\"\nbob,\"Bob \"\"the builder\"\"\"\n",
+		},
+		{
+			message: "leave missing tags empty",
+			rows: []map[string]string{
+				{"id": "alice", "follows": "bob"},
+				{"id": "carol"},
+			},
+			expect: "follows,id\nbob,alice\n,carol\n",
+		},
+		{
+			message: "keep to the given columns",
+			columns: []string{"id", "status"},
+			rows: []map[string]string{
+				{"id": "alice", "follows": "bob"},
+			},
+			expect: "id,status\nalice,\n",
+		},
+		{
+			message: "write the header of given columns without rows",
+			columns: []string{"id"},
+			expect:  "id\n",
+		},
+	} {
+		var buf bytes.Buffer
+		out := newCSVResults(&buf, test.columns)
+		for _, row := range test.rows {
+			if err := out.WriteRow(row); err != nil {
+				t.Fatalf("Failed to write row to %s: %v", test.message, err)
+			}
+		}
+		if err := out.Close(); err != nil {
+			t.Fatalf("Failed to close results to %s: %v", test.message, err)
+		}
+		if buf.String() != test.expect {
+			t.Errorf("Failed to %s, got:%q expect:%q", test.message, buf.String(), test.expect)
+		}
+	}
+}
+
+func TestJSONResults(t *testing.T) {
+	for _, rows := range [][]map[string]string{
+		nil,
+		{{"id": "alice"}},
+		{{"id": "alice", "follows": "bob"}, {"id": `"quoted", ]`}, {}},
+	} {
+		var buf bytes.Buffer
+		out := &jsonResults{w: &buf}
+		for i, row := range rows {
+			if err := out.WriteRow(row); err != nil {
+				t.Fatalf("Failed to write row: %v", err)
+			}
+			// Each row is written whole as it comes, on its own line.
+			lines := bytes.Split(bytes.TrimPrefix(buf.Bytes(), []byte("[\n")), []byte(",\n"))
+			if len(lines) != i+1 {
+				t.Fatalf("Unexpected framing after %d rows: %q", i+1, buf.String())
+			}
+			var got map[string]string
+			if err := json.Unmarshal(lines[i], &got); err != nil || !reflect.DeepEqual(got, row) {
+				t.Errorf("Unexpected row %d as written, got:%s expect:%v", i, lines[i], row)
+			}
+		}
+		if err := out.Close(); err != nil {
+			t.Fatalf("Failed to close results: %v", err)
+		}
+		var got []map[string]string
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to parse streamed array %q: %v", buf.String(), err)
+		}
+		if len(got) != len(rows) || len(rows) != 0 && !reflect.DeepEqual(got, rows) {
+			t.Errorf("Unexpected streamed array, got:%v expect:%v", got, rows)
+		}
+	}
+}
+
+// tagSession sends rows of tags, ending with err.
+type tagSession struct {
+	rows []map[string]string
+	err  error
+}
+
+func (s *tagSession) InputParses(string) (query.ParseResult, error) { return query.Parsed, nil }
+func (s *tagSession) GetQuery(string, chan map[string]interface{})  {}
+func (s *tagSession) BuildJson(interface{})                         {}
+func (s *tagSession) GetJson() ([]interface{}, error)               { return nil, s.err }
+func (s *tagSession) ClearJson()                                    {}
+func (s *tagSession) ToggleDebug()                                  {}
+
+func (s *tagSession) ExecInput(input string, out chan interface{}, limit int) {
+	defer close(out)
+	for i, row := range s.rows {
+		if limit >= 0 && i == limit {
+			return
+		}
+		out <- row
+	}
+	// A result that is not a row.
+	out <- "done"
+}
+
+func (s *tagSession) ResultTags(result interface{}) (map[string]string, bool) {
+	row, ok := result.(map[string]string)
+	return row, ok
+}
+
+func TestStreamResults(t *testing.T) {
+	rows := []map[string]string{{"id": "A", "follows": "B"}, {"id": "C"}, {"id": "D"}}
+	for _, test := range []struct {
+		message string
+		ses     *tagSession
+		max     int
+		format  string
+		code    int
+		rows    int
+		expect  string
+	}{
+		{
+			message: "stream CSV",
+			ses:     &tagSession{rows: rows},
+			format:  "csv",
+			code:    http.StatusOK,
+			rows:    3,
+			expect:  "follows,id\nB,A\n,C\n,D\n",
+		},
+		{
+			message: "stream at most max rows",
+			ses:     &tagSession{rows: rows},
+			max:     2,
+			format:  "json",
+			code:    http.StatusOK,
+			rows:    2,
+			expect:  "[\n{\"follows\":\"B\",\"id\":\"A\"},\n{\"id\":\"C\"}\n]\n",
+		},
+		{
+			message: "report an error before any row",
+			ses:     &tagSession{err: &query.ParseError{Err: errIncomplete}},
+			format:  "csv",
+			code:    http.StatusBadRequest,
+		},
+		{
+			message: "end rows cut short by an error",
+			ses:     &tagSession{rows: rows[:1], err: &query.BackendError{Err: errIncomplete}},
+			format:  "json",
+			code:    http.StatusOK,
+			rows:    1,
+			expect:  "[\n{\"follows\":\"B\",\"id\":\"A\"}\n]\n",
+		},
+	} {
+		w := httptest.NewRecorder()
+		code, n := streamResults(w, "", test.ses, test.max, test.format, nil)
+		if code != test.code {
+			t.Errorf("Failed to %s, unexpected status got:%d expect:%d", test.message, code, test.code)
+			continue
+		}
+		if n != test.rows {
+			t.Errorf("Failed to %s, unexpected number of rows got:%d expect:%d", test.message, n, test.rows)
+		}
+		if test.expect != "" && w.Body.String() != test.expect {
+			t.Errorf("Failed to %s, got:%q expect:%q", test.message, w.Body.String(), test.expect)
+		}
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		accept string
+		expect string
+		err    bool
+	}{
+		{expect: ""},
+		{accept: "application/json", expect: ""},
+		{accept: "text/csv", expect: "csv"},
+		{format: "json", accept: "text/csv", expect: "json"},
+		{format: "csv", expect: "csv"},
+		{format: "xml", err: true},
+	} {
+		r, _ := http.NewRequest("POST", "/api/v1/query/gremlin?format="+url.QueryEscape(test.format), nil)
+		r.Header.Set("Accept", test.accept)
+		got, err := exportFormat(r)
+		if got != test.expect || (err != nil) != test.err {
+			t.Errorf("Unexpected format for format=%q Accept=%q, got:%q (error %v) expect:%q", test.format, test.accept, got, err, test.expect)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src, _ := graph.NewTripleStore("memstore", "", nil)
+	src.AddTripleSet([]quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"bob", "follows", "carol", ""},
+		{"carol", "name", "Carol \"C\" Smith", ""},
+		{"alice", "owns", "doc:1", "tenant:a"},
+		{"bob", "owns", "doc:2", "tenant:b"},
+	})
+	api := &Api{config: &config.Config{
+		LabelACL: map[string][]string{"replica": {"", "tenant:a", "tenant:b"}},
+	}, ts: src}
+	// The second page fails once, as a source that goes away would.
+	var pages int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if pages++; pages == 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if req.URL.Path != "/api/v1/export" {
+			http.NotFound(w, req)
+			return
+		}
+		api.ServeV1Export(w, req, nil)
+	}))
+	defer server.Close()
+
+	dst, _ := graph.NewTripleStore("memstore", "", nil)
+	cfg := &config.Config{LoadSize: 2}
+	remote := db.Remote{URL: server.URL, PageSize: 2}
+	if _, err := db.Import(dst, cfg, remote, ""); err == nil {
+		t.Error("Expected an error importing without permission")
+	}
+	if dst.Size() != 0 {
+		t.Errorf("Unexpected triples imported without permission, got:%d", dst.Size())
+	}
+
+	pages = 0
+	remote.Header = http.Header{defaultACLHeader: {"replica"}}
+	resume, err := db.Import(dst, cfg, remote, "")
+	if err == nil || resume == "" {
+		t.Fatalf("Expected an import to stop with a resume token, got:%q %v", resume, err)
+	}
+	if dst.Size() != 2 {
+		t.Errorf("Unexpected triples imported before the failure, got:%d expect:2", dst.Size())
+	}
+	if resume, err = db.Import(dst, cfg, remote, resume); err != nil || resume != "" {
+		t.Fatalf("Failed to resume the import, got:%q %v", resume, err)
+	}
+
+	added, removed, err := db.Diff(db.NewStoreDecoder(src), db.NewStoreDecoder(dst))
+	if err != nil {
+		t.Fatalf("Failed to compare stores: %v", err)
+	}
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("Unexpected difference after import, added:%v removed:%v", added, removed)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/export?resume=soon", nil)
+	req.Header.Set(defaultACLHeader, "replica")
+	if code := api.ServeV1Export(w, req, nil); code != http.StatusBadRequest {
+		t.Errorf("Unexpected status for a bad resume token, got:%d expect:%d", code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query"
+)
+
+// ServeV1Health reports how the backend of the store is faring, with
+// Service Unavailable while the store is refusing queries.
+func (api *Api) ServeV1Health(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	h := graph.HealthOf(api.ts)
+	bytes, err := WrapResult(h)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	status := http.StatusOK
+	if !h.OK {
+		status = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(status)
+	fmt.Fprint(w, string(bytes))
+	return status
+}
@@ -15,6 +15,7 @@
 package http
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"html/template"
@@ -86,7 +87,8 @@ func FormatJson400(w http.ResponseWriter, err interface{}) int {
 }
 
 func FormatJsonError(w http.ResponseWriter, code int, err interface{}) int {
-	http.Error(w, fmt.Sprintf("{\"error\" : \"%s\"}", err), code)
+	body, _ := json.Marshal(ErrorQueryWrapper{Error: fmt.Sprint(err)})
+	http.Error(w, string(body), code)
 	return code
 }
 
@@ -106,8 +108,12 @@ func (h *TemplateRequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 }
 
 type Api struct {
-	config *config.Config
-	ts     graph.TripleStore
+	config  *config.Config
+	ts      graph.TripleStore
+	queries queryRegistry
+
+	// The slow query threshold in nanoseconds, accessed atomically.
+	slowQuery int64
 }
 
 func (api *Api) ApiV1(r *httprouter.Router) {
@@ -117,6 +123,24 @@ func (api *Api) ApiV1(r *httprouter.Router) {
 	r.POST("/api/v1/write/file/nquad", LogRequest(api.ServeV1WriteNQuad))
 	//TODO(barakmich): /write/text/nquad, which reads from request.body instead of HTML5 file form?
 	r.POST("/api/v1/delete", LogRequest(api.ServeV1Delete))
+	r.POST("/api/v1/delete/keys", LogRequest(api.ServeV1DeleteKeys))
+	r.GET("/api/v1/stats", LogRequest(api.ServeV1Stats))
+	r.GET("/api/v1/stats/predicates", LogRequest(api.ServeV1PredicateStats))
+	r.GET("/api/v1/describe", LogRequest(api.ServeV1Describe))
+	r.GET("/api/v1/info", LogRequest(api.ServeV1Info))
+	r.GET("/api/v1/health", LogRequest(api.ServeV1Health))
+	r.GET("/api/v1/autocomplete", LogRequest(api.ServeV1Autocomplete))
+	r.GET("/api/v1/export", LogRequest(api.ServeV1Export))
+	r.POST("/api/v1/names", LogRequest(api.ServeV1Names))
+	r.POST("/api/v1/admin/pin", LogRequest(api.adminOnly(api.ServeV1Pin)))
+	r.GET("/api/v1/admin/indexes", LogRequest(api.adminOnly(api.ServeV1Indexes)))
+	r.GET("/api/v1/admin/write_limit", LogRequest(api.adminOnly(api.ServeV1WriteLimit)))
+	r.POST("/api/v1/admin/write_limit", LogRequest(api.adminOnly(api.ServeV1SetWriteLimit)))
+	r.POST("/api/v1/admin/flush", LogRequest(api.adminOnly(api.ServeV1Flush)))
+	r.GET("/api/v1/admin/slow_query", LogRequest(api.adminOnly(api.ServeV1SlowQuery)))
+	r.POST("/api/v1/admin/slow_query", LogRequest(api.adminOnly(api.ServeV1SetSlowQuery)))
+	r.GET("/api/v1/admin/queries", LogRequest(api.adminOnly(api.ServeV1Queries)))
+	r.DELETE("/api/v1/admin/queries/:id", LogRequest(api.adminOnly(api.ServeV1CancelQuery)))
 }
 
 func SetupRoutes(ts graph.TripleStore, cfg *config.Config) {
@@ -129,7 +153,7 @@ func SetupRoutes(ts graph.TripleStore, cfg *config.Config) {
 	templates.ParseGlob(fmt.Sprint(assets, "/templates/*.html"))
 	root := &TemplateRequestHandler{templates: templates}
 	docs := &DocRequestHandler{assets: assets}
-	api := &Api{config: cfg, ts: ts}
+	api := &Api{config: cfg, ts: ts, slowQuery: int64(cfg.SlowQuery)}
 	api.ApiV1(r)
 
 	//m.Use(martini.Static("static", martini.StaticOptions{Prefix: "/static", SkipLogging: true}))
@@ -138,10 +162,13 @@ func SetupRoutes(ts graph.TripleStore, cfg *config.Config) {
 	r.GET("/ui/:ui_type", root.ServeHTTP)
 	r.GET("/", root.ServeHTTP)
 	http.Handle("/static/", http.StripPrefix("/static", http.FileServer(http.Dir(fmt.Sprint(assets, "/static/")))))
-	http.Handle("/", r)
+	http.Handle("/", api.withStoreID(r))
 }
 
 func Serve(ts graph.TripleStore, cfg *config.Config) {
+	if err := graph.PinNames(ts, cfg.PinnedNodes); err != nil {
+		glog.Errorln("Failed to pin nodes: ", err)
+	}
 	SetupRoutes(ts, cfg)
 	glog.Infof("Cayley now listening on %s:%s\n", cfg.ListenHost, cfg.ListenPort)
 	fmt.Printf("Cayley now listening on %s:%s\n", cfg.ListenHost, cfg.ListenPort)
@@ -15,11 +15,27 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/config"
+	"github.com/google/cayley/graph"
 	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query"
+	"github.com/google/cayley/query/mql"
+
+	_ "github.com/google/cayley/graph/memstore"
 )
 
 var parseTests = []struct {
@@ -71,3 +87,1228 @@ func TestParseJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestReadOnlyWrite(t *testing.T) {
+	ts, err := graph.NewTripleStore("memstore", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to open memstore: %v", err)
+	}
+	ts.AddTriple(quad.Quad{"foo", "bar", "baz", ""})
+	api := &Api{config: &config.Config{}, ts: graph.ReadOnly(ts)}
+
+	body := `[{"subject": "foo", "predicate": "bar", "object": "qux"}]`
+	for _, test := range []struct {
+		message string
+		handler ResponseHandler
+	}{
+		{message: "write", handler: api.ServeV1Write},
+		{message: "delete", handler: api.ServeV1Delete},
+	} {
+		req, err := http.NewRequest("POST", "/api/v1/write", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		code := test.handler(w, req, httprouter.Params{})
+		if code != http.StatusForbidden || w.Code != http.StatusForbidden {
+			t.Errorf("Unexpected status for read-only %s, got:%d (recorded %d) expect:%d", test.message, code, w.Code, http.StatusForbidden)
+		}
+	}
+	if size := ts.Size(); size != 1 {
+		t.Errorf("Read-only store was written to, got size:%d expect:1", size)
+	}
+}
+
+func TestDeleteKeys(t *testing.T) {
+	ts, err := graph.NewTripleStore("memstore", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to open memstore: %v", err)
+	}
+	quads := []quad.Quad{
+		{"alice", "follows", "bob", ""},
+		{"alice", "follows", "bob", "work"},
+		{"alice", "follows", "carol", ""},
+	}
+	for _, q := range quads {
+		ts.AddTriple(q)
+	}
+	api := &Api{config: &config.Config{}, ts: ts}
+
+	// Find the key of the triple in the work graph, as an .OutE() would.
+	var key string
+	it := ts.TriplesAllIterator()
+	for graph.Next(it) {
+		if ts.Quad(it.Result()) == quads[1] {
+			key = graph.QuadKey(ts, it.Result())
+		}
+	}
+	it.Close()
+	if key == "" {
+		t.Fatal("Failed to find the triple to delete")
+	}
+
+	for _, test := range []struct {
+		body   string
+		code   int
+		expect []quad.Quad
+	}{
+		{body: `["not a key"]`, code: http.StatusBadRequest, expect: quads},
+		{body: fmt.Sprintf("[%q]", key), code: http.StatusOK, expect: []quad.Quad{quads[0], quads[2]}},
+	} {
+		req, err := http.NewRequest("POST", "/api/v1/delete/keys", bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		if code := api.ServeV1DeleteKeys(w, req, httprouter.Params{}); code != test.code {
+			t.Errorf("Unexpected status deleting %s, got:%d expect:%d body:%s", test.body, code, test.code, w.Body)
+		}
+		for _, q := range quads {
+			var want bool
+			for _, e := range test.expect {
+				want = want || e == q
+			}
+			if got, _ := ts.QuadExists(q); got != want {
+				t.Errorf("Unexpected presence of %v after deleting %s, got:%t expect:%t", q, test.body, got, want)
+			}
+		}
+	}
+}
+
+// nquadRequest returns a request writing the N-Quads of body as a file.
+func nquadRequest(t *testing.T, body string) *http.Request {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("NQuadFile", "quads.nq")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	fmt.Fprint(fw, body)
+	mw.Close()
+	req, err := http.NewRequest("POST", "/api/v1/write/file/nquad", &buf)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestWriteLabelACL(t *testing.T) {
+	own := quad.Quad{"alice", "owns", "doc:1", "tenant:a"}
+	other := quad.Quad{"bob", "owns", "doc:2", "tenant:b"}
+	jsonRequest := func(path string, quads ...quad.Quad) *http.Request {
+		b, _ := json.Marshal(quads)
+		req, err := http.NewRequest("POST", path, bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		return req
+	}
+	for _, test := range []struct {
+		message string
+		client  string
+		handler func(*Api) ResponseHandler
+		req     *http.Request
+		code    int
+		expect  []quad.Quad
+	}{
+		{
+			message: "write a permitted triple",
+			client:  "alice",
+			handler: func(api *Api) ResponseHandler { return api.ServeV1Write },
+			req:     jsonRequest("/api/v1/write", own),
+			code:    http.StatusOK,
+			expect:  []quad.Quad{other, own},
+		},
+		{
+			message: "write a triple of another label",
+			client:  "alice",
+			handler: func(api *Api) ResponseHandler { return api.ServeV1Write },
+			req:     jsonRequest("/api/v1/write", own, quad.Quad{"alice", "owns", "doc:3", "tenant:b"}),
+			code:    http.StatusForbidden,
+			expect:  []quad.Quad{other},
+		},
+		{
+			message: "write as a client not in the label_acl",
+			client:  "mallory",
+			handler: func(api *Api) ResponseHandler { return api.ServeV1Write },
+			req:     jsonRequest("/api/v1/write", own),
+			code:    http.StatusForbidden,
+			expect:  []quad.Quad{other},
+		},
+		{
+			message: "write a permitted file",
+			client:  "alice",
+			handler: func(api *Api) ResponseHandler { return api.ServeV1WriteNQuad },
+			req:     nquadRequest(t, "<alice> <owns> <doc:1> <tenant:a> .\n"),
+			code:    http.StatusOK,
+			expect:  []quad.Quad{other, own},
+		},
+		{
+			message: "write a file into another label",
+			client:  "alice",
+			handler: func(api *Api) ResponseHandler { return api.ServeV1WriteNQuad },
+			req:     nquadRequest(t, "<alice> <owns> <doc:3> <tenant:b> .\n"),
+			code:    http.StatusForbidden,
+			expect:  []quad.Quad{other},
+		},
+		{
+			message: "write a file as a client not in the label_acl",
+			client:  "mallory",
+			handler: func(api *Api) ResponseHandler { return api.ServeV1WriteNQuad },
+			req:     nquadRequest(t, "<alice> <owns> <doc:1> <tenant:a> .\n"),
+			code:    http.StatusForbidden,
+			expect:  []quad.Quad{other},
+		},
+		{
+			message: "delete a triple of another label",
+			client:  "alice",
+			handler: func(api *Api) ResponseHandler { return api.ServeV1Delete },
+			req:     jsonRequest("/api/v1/delete", other),
+			code:    http.StatusForbidden,
+			expect:  []quad.Quad{other},
+		},
+		{
+			message: "delete as a client not in the label_acl",
+			client:  "mallory",
+			handler: func(api *Api) ResponseHandler { return api.ServeV1Delete },
+			req:     jsonRequest("/api/v1/delete", other),
+			code:    http.StatusForbidden,
+			expect:  []quad.Quad{other},
+		},
+		{
+			message: "delete as a client permitted every label",
+			client:  "ops",
+			handler: func(api *Api) ResponseHandler { return api.ServeV1Delete },
+			req:     jsonRequest("/api/v1/delete", other),
+			code:    http.StatusOK,
+		},
+	} {
+		ts, _ := graph.NewTripleStore("memstore", "", nil)
+		ts.AddTriple(other)
+		api := &Api{config: &config.Config{
+			LabelACL: map[string][]string{"alice": {"tenant:a"}, "ops": nil},
+		}, ts: ts}
+		test.req.Header.Set(defaultACLHeader, test.client)
+		w := httptest.NewRecorder()
+		if code := test.handler(api)(w, test.req, httprouter.Params{}); code != test.code {
+			t.Errorf("Failed to %s, unexpected status got:%d expect:%d body:%s", test.message, code, test.code, w.Body)
+		}
+		var got []quad.Quad
+		it := ts.TriplesAllIterator()
+		for graph.Next(it) {
+			if q := ts.Quad(it.Result()); q.IsValid() {
+				got = append(got, q)
+			}
+		}
+		it.Close()
+		if len(got) != len(test.expect) || (len(got) > 0 && !reflect.DeepEqual(got, test.expect)) {
+			t.Errorf("Failed to %s, unexpected triples got:%v expect:%v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestDeleteKeysLabelACL(t *testing.T) {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	quads := []quad.Quad{
+		{"alice", "owns", "doc:1", "tenant:a"},
+		{"bob", "owns", "doc:2", "tenant:b"},
+	}
+	ts.AddTripleSet(quads)
+	api := &Api{config: &config.Config{
+		LabelACL: map[string][]string{"alice": {"tenant:a"}},
+	}, ts: ts}
+
+	keys := make(map[quad.Quad]string)
+	it := ts.TriplesAllIterator()
+	for graph.Next(it) {
+		keys[ts.Quad(it.Result())] = graph.QuadKey(ts, it.Result())
+	}
+	it.Close()
+
+	// Alice may not delete bob's triple, nor her own along with it.
+	body := fmt.Sprintf("[%q, %q]", keys[quads[0]], keys[quads[1]])
+	req, _ := http.NewRequest("POST", "/api/v1/delete/keys", bytes.NewBufferString(body))
+	req.Header.Set(defaultACLHeader, "alice")
+	w := httptest.NewRecorder()
+	if code := api.ServeV1DeleteKeys(w, req, httprouter.Params{}); code != http.StatusForbidden {
+		t.Errorf("Unexpected status deleting another label's triple, got:%d expect:%d body:%s", code, http.StatusForbidden, w.Body)
+	}
+	for _, q := range quads {
+		if ok, _ := ts.QuadExists(q); !ok {
+			t.Errorf("Triple %v was deleted by a forbidden request", q)
+		}
+	}
+
+	body = fmt.Sprintf("[%q]", keys[quads[0]])
+	req, _ = http.NewRequest("POST", "/api/v1/delete/keys", bytes.NewBufferString(body))
+	req.Header.Set(defaultACLHeader, "alice")
+	w = httptest.NewRecorder()
+	if code := api.ServeV1DeleteKeys(w, req, httprouter.Params{}); code != http.StatusOK {
+		t.Errorf("Unexpected status deleting a permitted triple, got:%d expect:%d body:%s", code, http.StatusOK, w.Body)
+	}
+	if ok, _ := ts.QuadExists(quads[0]); ok {
+		t.Errorf("Permitted triple %v was not deleted", quads[0])
+	}
+	if ok, _ := ts.QuadExists(quads[1]); !ok {
+		t.Errorf("Triple %v of another label was deleted", quads[1])
+	}
+}
+
+// roundTripStore counts the lookups of names that miss its cache, as a
+// remote backend would make a round trip for each, and waits latency for
+// every one.
+type roundTripStore struct {
+	graph.TripleStore
+	latency time.Duration
+	trips   int
+	cache   map[graph.Value]string
+}
+
+func (ts *roundTripStore) NameOf(v graph.Value) string {
+	if name, ok := ts.cache[v]; ok {
+		return name
+	}
+	ts.trips++
+	time.Sleep(ts.latency)
+	ts.cache[v] = ts.TripleStore.NameOf(v)
+	return ts.cache[v]
+}
+
+// bulkRoundTripStore also looks up a set of names in a single round trip.
+type bulkRoundTripStore struct {
+	*roundTripStore
+}
+
+func (ts bulkRoundTripStore) NamesOf(vals []graph.Value) ([]string, error) {
+	ts.trips++
+	time.Sleep(ts.latency)
+	names := make([]string, len(vals))
+	for i, v := range vals {
+		if _, ok := ts.cache[v]; !ok {
+			ts.cache[v] = ts.TripleStore.NameOf(v)
+		}
+		names[i] = ts.cache[v]
+	}
+	return names, nil
+}
+
+const pageQuery = `[{"id": null, "follows": "target"}]`
+
+// newPageStores returns stores holding a page of 100 results for pageQuery,
+// one looking up names one at a time, and one looking them up in bulk.
+func newPageStores(latency time.Duration) (*roundTripStore, bulkRoundTripStore) {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	for i := 0; i < 100; i++ {
+		ts.AddTriple(quad.Quad{fmt.Sprintf("node%d", i), "follows", "target", ""})
+	}
+	lazy := &roundTripStore{TripleStore: ts, latency: latency, cache: make(map[graph.Value]string)}
+	bulk := bulkRoundTripStore{&roundTripStore{TripleStore: ts, latency: latency, cache: make(map[graph.Value]string)}}
+	return lazy, bulk
+}
+
+func TestWarmNames(t *testing.T) {
+	lazy, bulk := newPageStores(0)
+	lazyResult, _, err := RunJsonQuery(pageQuery, mql.NewSession(lazy), 0)
+	if err != nil {
+		t.Fatalf("Failed to run query one name at a time: %v", err)
+	}
+	bulkResult, _, err := RunJsonQuery(pageQuery, mql.NewSession(bulk), 0)
+	if err != nil {
+		t.Fatalf("Failed to run query with names in bulk: %v", err)
+	}
+	if !reflect.DeepEqual(lazyResult, bulkResult) {
+		t.Errorf("Bulk name lookup changed the results, got:%v expect:%v", bulkResult, lazyResult)
+	}
+	if lazy.trips < 100 {
+		t.Errorf("Unexpected round trips one name at a time, got:%d expect at least 100", lazy.trips)
+	}
+	if bulk.trips != 1 {
+		t.Errorf("Unexpected round trips with names in bulk, got:%d expect:1", bulk.trips)
+	}
+}
+
+func TestMaxResults(t *testing.T) {
+	ts, _ := newPageStores(0)
+	for _, test := range []struct {
+		max       int
+		expect    int
+		truncated bool
+	}{
+		{max: 0, expect: 100},
+		{max: 10, expect: 10, truncated: true},
+		{max: 99, expect: 99, truncated: true},
+		{max: 100, expect: 100},
+		{max: 200, expect: 100},
+	} {
+		api := &Api{config: &config.Config{MaxResults: test.max}, ts: ts}
+		req, err := http.NewRequest("POST", "/api/v1/query/mql", bytes.NewBufferString(pageQuery))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		code := api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "mql"}})
+		if code != http.StatusOK {
+			t.Fatalf("Unexpected status with a maximum of %d, got:%d body:%s", test.max, code, w.Body)
+		}
+		var got struct {
+			Result    []interface{} `json:"result"`
+			Truncated bool          `json:"truncated"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to decode results with a maximum of %d: %v", test.max, err)
+		}
+		if len(got.Result) != test.expect || got.Truncated != test.truncated {
+			t.Errorf("Unexpected results with a maximum of %d, got:%d (truncated %t) expect:%d (truncated %t)",
+				test.max, len(got.Result), got.Truncated, test.expect, test.truncated)
+		}
+	}
+}
+
+// The page benchmarks wait 100µs for each round trip to the store.
+func benchmarkPage(b *testing.B, bulk bool) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		var ts graph.TripleStore
+		lazy, bs := newPageStores(100 * time.Microsecond)
+		ts = lazy
+		if bulk {
+			ts = bs
+		}
+		b.StartTimer()
+		RunJsonQuery(pageQuery, mql.NewSession(ts), 0)
+	}
+}
+
+func BenchmarkPageNamesOneByOne(b *testing.B) {
+	benchmarkPage(b, false)
+}
+
+func BenchmarkPageNamesInBulk(b *testing.B) {
+	benchmarkPage(b, true)
+}
+
+func TestPredicateStats(t *testing.T) {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	ts.AddTripleSet([]quad.Quad{
+		{"A", "follows", "B", ""},
+		{"B", "follows", "C", ""},
+		{"A", "status", "cool", ""},
+	})
+	api := &Api{config: &config.Config{}, ts: ts}
+	req, err := http.NewRequest("GET", "/api/v1/stats/predicates", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	if code := api.ServeV1PredicateStats(w, req, nil); code != http.StatusOK {
+		t.Fatalf("Unexpected status, got:%d body:%s", code, w.Body)
+	}
+	var got struct {
+		Result []graph.PredicateCount `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	want := []graph.PredicateCount{{"follows", 2}, {"status", 1}}
+	if !reflect.DeepEqual(got.Result, want) {
+		t.Errorf("Unexpected histogram, got:%v expect:%v", got.Result, want)
+	}
+}
+
+func TestStats(t *testing.T) {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	ts.AddTripleSet([]quad.Quad{
+		{"A", "follows", "B", ""},
+		{"B", "follows", "C", "social"},
+		{"A", "status", "cool", "social"},
+	})
+	api := &Api{config: &config.Config{}, ts: ts}
+	req, err := http.NewRequest("GET", "/api/v1/stats", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	if code := api.ServeV1Stats(w, req, nil); code != http.StatusOK {
+		t.Fatalf("Unexpected status, got:%d body:%s", code, w.Body)
+	}
+	var got struct {
+		Result graph.Summary `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	want := graph.Summary{Triples: 3, Subjects: 2, Predicates: 2, Objects: 3, Labels: 1}
+	if got.Result != want {
+		t.Errorf("Unexpected stats, got:%+v expect:%+v", got.Result, want)
+	}
+}
+
+func TestQueryParams(t *testing.T) {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	ts.AddTripleSet([]quad.Quad{
+		{"A", "follows", "B", ""},
+		{`A"}]`, "follows", "C", ""},
+	})
+	api := &Api{config: &config.Config{}, ts: ts}
+	for _, test := range []struct {
+		params string
+		code   int
+		expect string
+	}{
+		{params: `{"who": "A"}`, code: http.StatusOK, expect: `[{"follows":"B","id":"A"}]`},
+		{params: `{"who": "A\"}]"}`, code: http.StatusOK, expect: `[{"follows":"C","id":"A\"}]"}]`},
+		{params: `{"who": 1}`, code: http.StatusBadRequest},
+		{params: `{"who; x": "A"}`, code: http.StatusBadRequest},
+		{params: `{"other": "A"}`, code: http.StatusBadRequest},
+	} {
+		target := "/api/v1/query/mql?params=" + url.QueryEscape(test.params)
+		req, err := http.NewRequest("POST", target, bytes.NewBufferString(`[{"id": "$who", "follows": null}]`))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		code := api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "mql"}})
+		if code != test.code {
+			t.Errorf("Unexpected status with params %s, got:%d expect:%d body:%s", test.params, code, test.code, w.Body)
+			continue
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		var got struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to decode results with params %s: %v", test.params, err)
+		}
+		var compact bytes.Buffer
+		json.Compact(&compact, got.Result)
+		if compact.String() != test.expect {
+			t.Errorf("Unexpected results with params %s, got:%s expect:%s", test.params, compact.String(), test.expect)
+		}
+	}
+}
+
+// scopedStore looks up each name in a round trip taking latency, counted
+// against the query it is scoped to, and stops looking names up once that
+// query is cancelled, as a remote backend would.
+type scopedStore struct {
+	graph.TripleStore
+	latency time.Duration
+	scope   *graph.QueryScope
+}
+
+func (ts scopedStore) Scope(s *graph.QueryScope) graph.TripleStore {
+	ts.scope = s
+	return ts
+}
+
+func (ts scopedStore) NameOf(v graph.Value) string {
+	if ts.scope != nil {
+		if ts.scope.Cancelled() {
+			return ""
+		}
+		ts.scope.RoundTrip()
+	}
+	time.Sleep(ts.latency)
+	return ts.TripleStore.NameOf(v)
+}
+
+func runningQueries(t *testing.T, api *Api) []QueryStatus {
+	req, err := http.NewRequest("GET", "/api/v1/admin/queries", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	if code := api.ServeV1Queries(w, req, nil); code != http.StatusOK {
+		t.Fatalf("Unexpected status listing queries, got:%d body:%s", code, w.Body)
+	}
+	var got struct {
+		Result []QueryStatus `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode running queries: %v", err)
+	}
+	return got.Result
+}
+
+func cancelQuery(t *testing.T, api *Api, id string) int {
+	req, err := http.NewRequest("DELETE", "/api/v1/admin/queries/"+id, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	return api.ServeV1CancelQuery(httptest.NewRecorder(), req, httprouter.Params{{Key: "id", Value: id}})
+}
+
+func TestParseSample(t *testing.T) {
+	for _, test := range []struct {
+		sample   string
+		n        int64
+		fraction float64
+		err      bool
+	}{
+		{sample: "100", n: 100},
+		{sample: "0.25", fraction: 0.25},
+		{sample: "0", err: true},
+		{sample: "1.5", err: true},
+		{sample: "-3", err: true},
+		{sample: "some", err: true},
+	} {
+		n, fraction, err := parseSample(test.sample)
+		if n != test.n || fraction != test.fraction || (err != nil) != test.err {
+			t.Errorf("Unexpected parse of sample %q, got:%d %v %v expect:%d %v error:%t", test.sample, n, fraction, err, test.n, test.fraction, test.err)
+		}
+	}
+}
+
+func TestCancelQuery(t *testing.T) {
+	ts, _ := newPageStores(0)
+	// The page takes at least five seconds to name in full.
+	api := &Api{config: &config.Config{}, ts: scopedStore{TripleStore: ts.TripleStore, latency: 50 * time.Millisecond}}
+
+	type response struct {
+		code int
+		body []byte
+	}
+	done := make(chan response, 1)
+	go func() {
+		req, _ := http.NewRequest("POST", "/api/v1/query/mql", bytes.NewBufferString(pageQuery))
+		w := httptest.NewRecorder()
+		code := api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "mql"}})
+		done <- response{code, w.Body.Bytes()}
+	}()
+
+	var running []QueryStatus
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		running = runningQueries(t, api)
+		if len(running) == 1 && running[0].RoundTrips > 0 {
+			break
+		}
+	}
+	if len(running) != 1 {
+		t.Fatalf("Unexpected running queries, got:%v expect one", running)
+	}
+	if q := running[0]; q.Lang != "mql" || q.Query != pageQuery || q.RoundTrips == 0 || q.Started.IsZero() {
+		t.Errorf("Unexpected status of the running query, got:%+v", q)
+	}
+
+	if code := cancelQuery(t, api, fmt.Sprint(running[0].ID)); code != http.StatusOK {
+		t.Fatalf("Unexpected status cancelling the query, got:%d", code)
+	}
+	select {
+	case r := <-done:
+		var got ErrorQueryWrapper
+		if err := json.Unmarshal(r.body, &got); err != nil {
+			t.Fatalf("Failed to decode the error of the cancelled query: %v", err)
+		}
+		if got.Code != query.CodeCancelled {
+			t.Errorf("Unexpected response to the cancelled query, got:%d %s", r.code, r.body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Cancelled query did not stop")
+	}
+	if running := runningQueries(t, api); len(running) != 0 {
+		t.Errorf("Unexpected running queries once cancelled, got:%v", running)
+	}
+	if code := cancelQuery(t, api, fmt.Sprint(running[0].ID)); code != http.StatusNotFound {
+		t.Errorf("Unexpected status cancelling a finished query, got:%d expect:%d", code, http.StatusNotFound)
+	}
+}
+
+func TestLabelACL(t *testing.T) {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	ts.AddTripleSet([]quad.Quad{
+		{"alice", "owns", "doc:1", "tenant:a"},
+		{"alice", "owns", "doc:2", "tenant:b"},
+		{"bob", "owns", "doc:3", "tenant:b"},
+	})
+	api := &Api{config: &config.Config{
+		LabelACL: map[string][]string{
+			"alice": {"tenant:a"},
+			"bob":   {"tenant:b"},
+		},
+	}, ts: ts}
+	for _, test := range []struct {
+		client string
+		code   int
+		expect string
+	}{
+		// Nodes are listed only if they are in a permitted triple.
+		{
+			client: "alice",
+			code:   http.StatusOK,
+			expect: `[{"id":"alice","owns":"doc:1"},{"id":"owns","owns":null},{"id":"doc:1","owns":null},{"id":"tenant:a","owns":null}]`,
+		},
+		{
+			client: "bob",
+			code:   http.StatusOK,
+			expect: `[{"id":"alice","owns":"doc:2"},{"id":"bob","owns":"doc:3"},{"id":"owns","owns":null},{"id":"doc:2","owns":null},{"id":"doc:3","owns":null},{"id":"tenant:b","owns":null}]`,
+		},
+		{client: "mallory", code: http.StatusForbidden},
+		{code: http.StatusForbidden},
+	} {
+		req, err := http.NewRequest("POST", "/api/v1/query/mql", bytes.NewBufferString(`[{"id": null, "owns": null}]`))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if test.client != "" {
+			req.Header.Set(defaultACLHeader, test.client)
+		}
+		w := httptest.NewRecorder()
+		code := api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "mql"}})
+		if code != test.code {
+			t.Errorf("Unexpected status for %q, got:%d expect:%d body:%s", test.client, code, test.code, w.Body)
+			continue
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		var got struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to decode results for %q: %v", test.client, err)
+		}
+		var compact bytes.Buffer
+		json.Compact(&compact, got.Result)
+		if compact.String() != test.expect {
+			t.Errorf("Unexpected results for %q, got:%s expect:%s", test.client, compact.String(), test.expect)
+		}
+	}
+}
+
+func TestAdminLabelACL(t *testing.T) {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	api := &Api{config: &config.Config{
+		LabelACL: map[string][]string{
+			"alice": {"tenant:a"},
+			"ops":   nil,
+		},
+	}, ts: ts}
+	var reached int
+	handler := api.adminOnly(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+		reached++
+		return http.StatusOK
+	})
+	for _, test := range []struct {
+		client string
+		code   int
+	}{
+		{client: "ops", code: http.StatusOK},
+		{client: "alice", code: http.StatusForbidden},
+		{client: "mallory", code: http.StatusForbidden},
+	} {
+		req, err := http.NewRequest("GET", "/api/v1/admin/queries", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set(defaultACLHeader, test.client)
+		if code := handler(httptest.NewRecorder(), req, nil); code != test.code {
+			t.Errorf("Unexpected status for %q, got:%d expect:%d", test.client, code, test.code)
+		}
+	}
+	if reached != 1 {
+		t.Errorf("Unexpected number of requests reaching the admin API, got:%d expect:1", reached)
+	}
+
+	// A client permitted every label sees the whole store.
+	req, _ := http.NewRequest("GET", "/api/v1/stats", nil)
+	req.Header.Set(defaultACLHeader, "ops")
+	if view, err := api.restrictLabels(req, ts); err != nil || view != ts {
+		t.Errorf("Unexpected view for a client permitted every label, got:%v err:%v", view, err)
+	}
+}
+
+// sourcedStore records the source of each triple first written through it,
+// as a graph.Sourcer does, and finds a source's triples by copying them to
+// a store of their own.
+type sourcedStore struct {
+	graph.TripleStore
+	source  string
+	sources map[quad.Quad]string
+}
+
+func (ts *sourcedStore) AddTripleSet(set []quad.Quad) {
+	for _, q := range set {
+		if _, ok := ts.sources[q]; !ok {
+			ts.sources[q] = ts.source
+		}
+	}
+	ts.TripleStore.AddTripleSet(set)
+}
+
+func (ts *sourcedStore) WithSource(source string) graph.TripleStore {
+	return &sourcedStore{TripleStore: ts.TripleStore, source: source, sources: ts.sources}
+}
+
+func (ts *sourcedStore) BySource(source, _ string) graph.TripleStore {
+	view, _ := graph.NewTripleStore("memstore", "", nil)
+	for q, s := range ts.sources {
+		if s == source {
+			view.AddTriple(q)
+		}
+	}
+	return graph.ReadOnly(view)
+}
+
+func TestProvenance(t *testing.T) {
+	mem, _ := graph.NewTripleStore("memstore", "", nil)
+	ts := &sourcedStore{TripleStore: mem, sources: make(map[quad.Quad]string)}
+	api := &Api{config: &config.Config{}, ts: ts}
+	for _, write := range []struct {
+		source string
+		body   string
+	}{
+		{source: "alice", body: `[{"subject": "alice", "predicate": "owns", "object": "doc:1"}]`},
+		{source: "bob", body: `[{"subject": "bob", "predicate": "owns", "object": "doc:2"}]`},
+	} {
+		req, err := http.NewRequest("POST", "/api/v1/write?source="+write.source, bytes.NewBufferString(write.body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		if code := api.ServeV1Write(w, req, httprouter.Params{}); code != http.StatusOK {
+			t.Fatalf("Failed to write from %s, got:%d body:%s", write.source, code, w.Body)
+		}
+	}
+	if mem.Size() != 2 {
+		t.Errorf("Unexpected number of triples written, got:%d expect:2", mem.Size())
+	}
+
+	req, err := http.NewRequest("POST", "/api/v1/query/mql?source=alice", bytes.NewBufferString(`[{"id": null, "owns": null}]`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	if code := api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "mql"}}); code != http.StatusOK {
+		t.Fatalf("Failed to query the triples of a source, got:%d body:%s", code, w.Body)
+	}
+	var got struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode results: %v", err)
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, got.Result)
+	expect := `[{"id":"alice","owns":"doc:1"},{"id":"owns","owns":null},{"id":"doc:1","owns":null}]`
+	if compact.String() != expect {
+		t.Errorf("Unexpected results for a source, got:%s expect:%s", compact.String(), expect)
+	}
+
+	// A store that does not record sources refuses writes from one.
+	api.ts = mem
+	req, err = http.NewRequest("POST", "/api/v1/write?source=alice", bytes.NewBufferString(`[{"subject": "alice", "predicate": "owns", "object": "doc:3"}]`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if code := api.ServeV1Write(httptest.NewRecorder(), req, httprouter.Params{}); code != http.StatusBadRequest {
+		t.Errorf("Unexpected status for a write from a source, got:%d expect:%d", code, http.StatusBadRequest)
+	}
+}
+
+// limitedStore holds a write limit, as a graph.WriteLimiter does.
+type limitedStore struct {
+	graph.TripleStore
+	limit graph.WriteLimit
+}
+
+func (ts *limitedStore) WriteLimit() graph.WriteLimit         { return ts.limit }
+func (ts *limitedStore) SetWriteLimit(limit graph.WriteLimit) { ts.limit = limit }
+
+func TestWriteLimit(t *testing.T) {
+	mem, _ := graph.NewTripleStore("memstore", "", nil)
+	ts := &limitedStore{TripleStore: mem, limit: graph.WriteLimit{QuadsPerSec: 100}}
+	api := &Api{config: &config.Config{}, ts: ts}
+
+	req, err := http.NewRequest("POST", "/api/v1/admin/write_limit", bytes.NewBufferString(`{"quads_per_sec": 10, "bytes_per_sec": 4096}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	if code := api.ServeV1SetWriteLimit(w, req, nil); code != http.StatusOK {
+		t.Fatalf("Failed to set the write limit, got:%d body:%s", code, w.Body)
+	}
+	if expect := (graph.WriteLimit{QuadsPerSec: 10, BytesPerSec: 4096}); ts.limit != expect {
+		t.Errorf("Unexpected write limit, got:%+v expect:%+v", ts.limit, expect)
+	}
+
+	req, err = http.NewRequest("GET", "/api/v1/admin/write_limit", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w = httptest.NewRecorder()
+	if code := api.ServeV1WriteLimit(w, req, nil); code != http.StatusOK {
+		t.Fatalf("Failed to get the write limit, got:%d body:%s", code, w.Body)
+	}
+	var got struct {
+		Result graph.WriteLimit `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode write limit: %v", err)
+	}
+	if got.Result != ts.limit {
+		t.Errorf("Unexpected write limit returned, got:%+v expect:%+v", got.Result, ts.limit)
+	}
+
+	// A store that cannot limit its writes says so.
+	api.ts = mem
+	req, err = http.NewRequest("POST", "/api/v1/admin/write_limit", bytes.NewBufferString(`{"quads_per_sec": 10}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if code := api.ServeV1SetWriteLimit(httptest.NewRecorder(), req, nil); code != http.StatusBadRequest {
+		t.Errorf("Unexpected status setting a write limit, got:%d expect:%d", code, http.StatusBadRequest)
+	}
+}
+
+// flushingStore counts its flushes, failing them with err, as a
+// graph.Flusher does.
+type flushingStore struct {
+	graph.TripleStore
+	flushes int
+	err     error
+}
+
+func (ts *flushingStore) Flush() error {
+	ts.flushes++
+	return ts.err
+}
+
+func TestFlush(t *testing.T) {
+	mem, _ := graph.NewTripleStore("memstore", "", nil)
+	ts := &flushingStore{TripleStore: mem}
+	api := &Api{config: &config.Config{}, ts: graph.ReadOnly(ts)}
+
+	for _, test := range []struct {
+		err    error
+		expect int
+	}{
+		{expect: http.StatusOK},
+		{err: errors.New("disk full"), expect: http.StatusInternalServerError},
+	} {
+		ts.err = test.err
+		req, err := http.NewRequest("POST", "/api/v1/admin/flush", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		if code := api.ServeV1Flush(w, req, nil); code != test.expect {
+			t.Errorf("Unexpected status flushing with error %v, got:%d expect:%d body:%s", test.err, code, test.expect, w.Body)
+		}
+	}
+	if ts.flushes != 2 {
+		t.Errorf("Unexpected number of flushes, got:%d expect:2", ts.flushes)
+	}
+
+	// A store that cannot flush says so.
+	api.ts = mem
+	req, err := http.NewRequest("POST", "/api/v1/admin/flush", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if code := api.ServeV1Flush(httptest.NewRecorder(), req, nil); code != http.StatusBadRequest {
+		t.Errorf("Unexpected status flushing a memstore, got:%d expect:%d", code, http.StatusBadRequest)
+	}
+}
+
+func TestSlowQuery(t *testing.T) {
+	defer func(l func(SlowQuery)) { logSlowQuery = l }(logSlowQuery)
+	var logged []SlowQuery
+	logSlowQuery = func(q SlowQuery) { logged = append(logged, q) }
+
+	ts, _ := newPageStores(0)
+	// The page takes at least 100ms to name in full.
+	api := &Api{config: &config.Config{}, ts: scopedStore{TripleStore: ts.TripleStore, latency: time.Millisecond}}
+	run := func() {
+		req, _ := http.NewRequest("POST", "/api/v1/query/mql", bytes.NewBufferString(pageQuery))
+		w := httptest.NewRecorder()
+		if code := api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "mql"}}); code != http.StatusOK {
+			t.Fatalf("Unexpected status running the query, got:%d body:%s", code, w.Body)
+		}
+	}
+
+	run()
+	if len(logged) != 0 {
+		t.Errorf("Unexpected slow query without a threshold, got:%+v", logged)
+	}
+
+	req, _ := http.NewRequest("POST", "/api/v1/admin/slow_query", bytes.NewBufferString(`{"threshold": "50ms"}`))
+	if code := api.ServeV1SetSlowQuery(httptest.NewRecorder(), req, nil); code != http.StatusOK {
+		t.Fatalf("Unexpected status setting the slow query threshold, got:%d", code)
+	}
+	w := httptest.NewRecorder()
+	api.ServeV1SlowQuery(w, nil, nil)
+	var got struct {
+		Result slowQueryThreshold `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Result.Threshold != "50ms" {
+		t.Errorf("Unexpected slow query threshold, got:%s", w.Body)
+	}
+
+	run()
+	if len(logged) != 1 {
+		t.Fatalf("Unexpected slow queries logged, got:%d expect:1", len(logged))
+	}
+	q := logged[0]
+	if q.Lang != "mql" || q.Query != pageQuery || q.Results != 100 || q.RoundTrips < 100 {
+		t.Errorf("Unexpected slow query entry, got:%+v", q)
+	}
+	if d, err := time.ParseDuration(q.Duration); err != nil || d < 50*time.Millisecond {
+		t.Errorf("Unexpected duration of slow query, got:%q", q.Duration)
+	}
+	if len(q.Plans) != 1 || q.Plans[0] == "" {
+		t.Errorf("Unexpected plans of slow query, got:%q", q.Plans)
+	}
+
+	api.setSlowQueryThreshold(time.Hour)
+	run()
+	if len(logged) != 1 {
+		t.Errorf("Unexpected slow query under the threshold, got:%+v", logged[1:])
+	}
+}
+
+// hashStore names nodes by hash, looking them all up in one round trip, as
+// MongoDB does.
+type hashStore struct {
+	graph.TripleStore
+	names map[string]string
+	trips int
+}
+
+func (ts *hashStore) NamesOf(vals []graph.Value) ([]string, error) {
+	ts.trips++
+	names := make([]string, len(vals))
+	for i, v := range vals {
+		names[i] = ts.names[v.(string)]
+	}
+	return names, nil
+}
+
+func TestNames(t *testing.T) {
+	mem, _ := graph.NewTripleStore("memstore", "", nil)
+	ts := &hashStore{TripleStore: mem, names: map[string]string{"a1": "alice", "b2": "bob"}}
+	api := &Api{config: &config.Config{}, ts: ts}
+
+	req, err := http.NewRequest("POST", "/api/v1/names", bytes.NewBufferString(`["a1", "ff", "b2"]`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	if code := api.ServeV1Names(w, req, nil); code != http.StatusOK {
+		t.Fatalf("Failed to look up names, got:%d body:%s", code, w.Body)
+	}
+	var got struct {
+		Result map[string]*string `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode names: %v", err)
+	}
+	alice, bob := "alice", "bob"
+	if expect := map[string]*string{"a1": &alice, "ff": nil, "b2": &bob}; !reflect.DeepEqual(got.Result, expect) {
+		t.Errorf("Unexpected names, got:%s", w.Body)
+	}
+	if ts.trips != 1 {
+		t.Errorf("Unexpected number of round trips, got:%d expect:1", ts.trips)
+	}
+
+	// A store that cannot name hashes in bulk says so.
+	api.ts = mem
+	req, err = http.NewRequest("POST", "/api/v1/names", bytes.NewBufferString(`["a1"]`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if code := api.ServeV1Names(httptest.NewRecorder(), req, nil); code != http.StatusBadRequest {
+		t.Errorf("Unexpected status looking up names, got:%d expect:%d", code, http.StatusBadRequest)
+	}
+}
+
+func TestNamesLabelACL(t *testing.T) {
+	mem, _ := graph.NewTripleStore("memstore", "", nil)
+	mem.AddTripleSet([]quad.Quad{
+		{"alice", "owns", "doc:1", "tenant:a"},
+		{"bob", "owns", "doc:2", "tenant:b"},
+	})
+	ts := &hashStore{TripleStore: mem, names: map[string]string{"a1": "alice", "b2": "bob"}}
+	api := &Api{config: &config.Config{
+		LabelACL: map[string][]string{"alice": {"tenant:a"}},
+	}, ts: ts}
+
+	alice := "alice"
+	for _, test := range []struct {
+		client string
+		code   int
+		expect map[string]*string
+	}{
+		// Bob is only in a triple of a label alice is not permitted.
+		{client: "alice", code: http.StatusOK, expect: map[string]*string{"a1": &alice, "b2": nil}},
+		{client: "mallory", code: http.StatusForbidden},
+	} {
+		req, err := http.NewRequest("POST", "/api/v1/names", bytes.NewBufferString(`["a1", "b2"]`))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set(defaultACLHeader, test.client)
+		w := httptest.NewRecorder()
+		if code := api.ServeV1Names(w, req, nil); code != test.code {
+			t.Errorf("Unexpected status for %s, got:%d expect:%d body:%s", test.client, code, test.code, w.Body)
+			continue
+		}
+		if test.expect == nil {
+			continue
+		}
+		var got struct {
+			Result map[string]*string `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to decode names: %v", err)
+		}
+		if !reflect.DeepEqual(got.Result, test.expect) {
+			t.Errorf("Unexpected names for %s, got:%s", test.client, w.Body)
+		}
+	}
+}
+
+// identifiedStore is a store with an identifier of its own, as a
+// graph.Identified is.
+type identifiedStore struct {
+	graph.TripleStore
+	id string
+}
+
+func (ts identifiedStore) StoreID() string { return ts.id }
+
+func TestInfo(t *testing.T) {
+	mem, _ := graph.NewTripleStore("memstore", "", nil)
+	for _, test := range []struct {
+		message string
+		ts      graph.TripleStore
+		options map[string]interface{}
+		expect  string
+	}{
+		{message: "a configured store", ts: mem, options: map[string]interface{}{"store_id": "primary"}, expect: "primary"},
+		{message: "an identified store", ts: graph.ReadOnly(identifiedStore{TripleStore: mem, id: "recorded"}), options: map[string]interface{}{"store_id": "primary"}, expect: "recorded"},
+		{message: "an unidentified store", ts: mem, expect: "memstore:"},
+	} {
+		api := &Api{config: &config.Config{DatabaseType: "memstore", DatabaseOptions: test.options}, ts: test.ts}
+		req, err := http.NewRequest("GET", "/api/v1/info", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		api.withStoreID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			api.ServeV1Info(w, r, nil)
+		})).ServeHTTP(w, req)
+		var got struct {
+			Result storeInfo `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to decode info of %s: %v", test.message, err)
+		}
+		if got.Result.StoreID != test.expect {
+			t.Errorf("Unexpected store_id of %s, got:%q expect:%q", test.message, got.Result.StoreID, test.expect)
+		}
+		if h := w.Header().Get(StoreIDHeader); h != test.expect {
+			t.Errorf("Unexpected %s header of %s, got:%q expect:%q", StoreIDHeader, test.message, h, test.expect)
+		}
+	}
+}
+
+func TestAutocomplete(t *testing.T) {
+	ts, _ := graph.NewTripleStore("memstore", "", nil)
+	for _, q := range []quad.Quad{
+		{"alice", "follows", "alan", ""},
+		{"albert", "follows", "alice", ""},
+		{"bob", "follows", "al", ""},
+	} {
+		ts.AddTriple(q)
+	}
+	api := &Api{config: &config.Config{}, ts: ts}
+
+	for _, test := range []struct {
+		query  string
+		code   int
+		expect []string
+	}{
+		{query: "prefix=al", code: http.StatusOK, expect: []string{"al", "alan", "albert", "alice"}},
+		{query: "prefix=al&limit=2", code: http.StatusOK, expect: []string{"al", "alan"}},
+		{query: "prefix=z", code: http.StatusOK, expect: []string{}},
+		{query: "prefix=al&limit=0", code: http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest("GET", "/api/v1/autocomplete?"+test.query, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		if code := api.ServeV1Autocomplete(w, req, nil); code != test.code {
+			t.Errorf("Unexpected status completing %q, got:%d expect:%d body:%s", test.query, code, test.code, w.Body)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		var got struct {
+			Result []string `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to decode completions: %v", err)
+		}
+		if !reflect.DeepEqual(got.Result, test.expect) {
+			t.Errorf("Unexpected completions of %q, got:%q expect:%q", test.query, got.Result, test.expect)
+		}
+	}
+}
+
+// failingStore is a store whose backend is down, as a graph.HealthReporter
+// with an open breaker tells.
+type failingStore struct {
+	graph.TripleStore
+}
+
+func (failingStore) Health() graph.Health {
+	return graph.Health{Breaker: "open", Failures: 5, RetryInSecs: 10}
+}
+
+func TestHealth(t *testing.T) {
+	mem, _ := graph.NewTripleStore("memstore", "", nil)
+	for _, test := range []struct {
+		message string
+		ts      graph.TripleStore
+		code    int
+		expect  graph.Health
+	}{
+		{message: "a store without a breaker", ts: mem, code: http.StatusOK, expect: graph.Health{OK: true}},
+		{message: "a failing store", ts: graph.ReadOnly(failingStore{mem}), code: http.StatusServiceUnavailable, expect: graph.Health{Breaker: "open", Failures: 5, RetryInSecs: 10}},
+	} {
+		api := &Api{config: &config.Config{}, ts: test.ts}
+		req, err := http.NewRequest("GET", "/api/v1/health", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		if code := api.ServeV1Health(w, req, nil); code != test.code || w.Code != test.code {
+			t.Errorf("Unexpected status of %s, got:%d (recorded %d) expect:%d", test.message, code, w.Code, test.code)
+		}
+		var got struct {
+			Result graph.Health `json:"result"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Failed to decode health of %s: %v", test.message, err)
+		}
+		if got.Result != test.expect {
+			t.Errorf("Unexpected health of %s, got:%+v expect:%+v", test.message, got.Result, test.expect)
+		}
+	}
+
+	// Queries are turned away while the backend is failing.
+	api := &Api{config: &config.Config{}, ts: failingStore{mem}}
+	req, err := http.NewRequest("POST", "/api/v1/query/mql", bytes.NewBufferString(`[{"id": null}]`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	if code := api.ServeV1Query(w, req, httprouter.Params{{Key: "query_lang", Value: "mql"}}); code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status of a query to a failing store, got:%d expect:%d", code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query"
+)
+
+// StoreIDHeader is the response header that carries the identifier of the
+// store that served the request.
+const StoreIDHeader = "X-Cayley-Store"
+
+// storeID returns the identifier of the store: its own, if it has one, or
+// else the store_id database option, or else its type and path.
+func (api *Api) storeID() string {
+	if id := graph.StoreID(api.ts); id != "" {
+		return id
+	}
+	if id, ok := graph.Options(api.config.DatabaseOptions).StringKey("store_id"); ok && id != "" {
+		return id
+	}
+	return api.config.DatabaseType + ":" + api.config.DatabasePath
+}
+
+// withStoreID sets the StoreIDHeader on every response served by h.
+func (api *Api) withStoreID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(StoreIDHeader, api.storeID())
+		h.ServeHTTP(w, r)
+	})
+}
+
+type storeInfo struct {
+	StoreID  string `json:"store_id"`
+	Database string `json:"database"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// ServeV1Info describes the store the server is serving.
+func (api *Api) ServeV1Info(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	bytes, err := WrapResult(storeInfo{
+		StoreID:  api.storeID(),
+		Database: api.config.DatabaseType,
+		ReadOnly: api.config.ReadOnly,
+	})
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
@@ -0,0 +1,88 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/query"
+)
+
+// ServeV1Names writes the names of the hashes in the JSON array of the
+// request body, looked up together, keyed by hash. Hashes that name no node
+// are given a null name, as are those of nodes in none of the triples the
+// client's labels permit.
+func (api *Api) ServeV1Names(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	var hashes []string
+	if err := json.Unmarshal(bodyBytes, &hashes); err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	vals := make([]graph.Value, len(hashes))
+	for i, h := range hashes {
+		vals[i] = h
+	}
+	ts, err := api.restrictLabels(r, api.ts)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	// The names are looked up in the store itself, which a view may not be
+	// able to do in bulk, and are then given only for the view's nodes.
+	names, err := graph.NamesOf(api.ts, vals)
+	if err == graph.ErrCannotBulkName {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	} else if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	result := make(map[string]*string, len(hashes))
+	for i, h := range hashes {
+		if names[i] == "" || (ts != api.ts && !inView(ts, names[i])) {
+			result[h] = nil
+			continue
+		}
+		result[h] = &names[i]
+	}
+	bytes, err := WrapResult(result)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
+
+// inView returns whether the node named name is in a triple of view, in any
+// direction.
+func inView(view graph.TripleStore, name string) bool {
+	v := view.ValueOf(name)
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Object, quad.Label} {
+		it := view.TripleIterator(d, v)
+		found := graph.Next(it)
+		it.Close()
+		if found {
+			return true
+		}
+	}
+	return false
+}
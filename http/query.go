@@ -16,23 +16,34 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/google/cayley/graph"
 	"github.com/google/cayley/query"
 	"github.com/google/cayley/query/gremlin"
 	"github.com/google/cayley/query/mql"
 )
 
 type SuccessQueryWrapper struct {
-	Result interface{} `json:"result"`
+	Result    interface{} `json:"result"`
+	Truncated bool        `json:"truncated,omitempty"`
+
+	// The analysis of each query run for the result, if the request
+	// asked for them to be analyzed.
+	Analyze []graph.IteratorAnalysis `json:"analyze,omitempty"`
 }
 
 type ErrorQueryWrapper struct {
-	Error string `json:"error"`
+	Error string     `json:"error"`
+	Code  query.Code `json:"code,omitempty"`
 }
 
 func WrapErrResult(err error) ([]byte, error) {
@@ -42,18 +53,50 @@ func WrapErrResult(err error) ([]byte, error) {
 }
 
 func WrapResult(result interface{}) ([]byte, error) {
+	return WrapTruncatedResult(result, false)
+}
+
+// WrapTruncatedResult wraps result, marking it as truncated if results
+// were left out of it.
+func WrapTruncatedResult(result interface{}, truncated bool) ([]byte, error) {
 	var wrap SuccessQueryWrapper
 	wrap.Result = result
+	wrap.Truncated = truncated
 	return json.MarshalIndent(wrap, "", " ")
 }
 
-func RunJsonQuery(query string, ses query.HttpSession) (interface{}, error) {
+// RunJsonQuery runs input and returns its results, and whether there were
+// more than max of them, in which case only the first max are returned. If
+// max is not positive, every result is returned.
+func RunJsonQuery(input string, ses query.HttpSession, max int) ([]interface{}, bool, error) {
+	limit := -1
+	if max > 0 {
+		// One more result than can be returned shows whether there are
+		// more.
+		limit = max + 1
+	}
 	c := make(chan interface{}, 5)
-	go ses.ExecInput(query, c, 100)
+	go ses.ExecInput(input, c, limit)
+	var results []interface{}
 	for res := range c {
+		results = append(results, res)
+	}
+	// Look up all the names in the page at once, rather than one by one
+	// as each result is built.
+	if w, ok := ses.(query.NameWarmer); ok {
+		w.WarmNames(results)
+	}
+	for _, res := range results {
 		ses.BuildJson(res)
 	}
-	return ses.GetJson()
+	output, err := ses.GetJson()
+	if err != nil {
+		return nil, false, err
+	}
+	if max > 0 && len(output) > max {
+		return output[:max], true, nil
+	}
+	return output, false, nil
 }
 
 func GetQueryShape(query string, ses query.HttpSession) ([]byte, error) {
@@ -68,84 +111,189 @@ func GetQueryShape(query string, ses query.HttpSession) ([]byte, error) {
 
 // TODO(barakmich): Turn this into proper middleware.
 func (api *Api) ServeV1Query(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
-	var ses query.HttpSession
-	switch params.ByName("query_lang") {
-	case "gremlin":
-		ses = gremlin.NewSession(api.ts, api.config.Timeout, false)
-	case "mql":
-		ses = mql.NewSession(api.ts)
-	default:
-		return FormatJson400(w, "Need a query language.")
+	if !graph.HealthOf(api.ts).OK {
+		// The backend is failing, so the query is turned away rather
+		// than left to add to its load.
+		return FormatQueryError(w, graph.ErrUnavailable)
+	}
+	scope := graph.NewQueryScope()
+	ses, err := api.newHttpSession(r, params, scope)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		return FormatQueryError(w, err)
 	}
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return FormatJson400(w, err)
+		return FormatQueryError(w, &query.ParseError{Err: err})
 	}
 	code := string(bodyBytes)
 	result, err := ses.InputParses(code)
 	switch result {
 	case query.Parsed:
-		var output interface{}
-		var bytes []byte
-		var err error
-		output, err = RunJsonQuery(code, ses)
+		id := api.queries.add(params.ByName("query_lang"), code, ses, scope)
+		start := time.Now()
+		if format != "" {
+			var columns []string
+			if c := r.URL.Query().Get("columns"); c != "" {
+				columns = strings.Split(c, ",")
+			}
+			status, rows := streamResults(w, code, ses, api.config.MaxResults, format, columns)
+			api.queries.remove(id)
+			api.checkSlowQuery(SlowQuery{
+				Lang:       params.ByName("query_lang"),
+				Query:      code,
+				RoundTrips: scope.RoundTrips(),
+				Results:    rows,
+			}, time.Since(start), ses)
+			return status
+		}
+		output, truncated, err := RunJsonQuery(code, ses, api.config.MaxResults)
+		api.queries.remove(id)
+		api.checkSlowQuery(SlowQuery{
+			Lang:       params.ByName("query_lang"),
+			Query:      code,
+			RoundTrips: scope.RoundTrips(),
+			Results:    len(output),
+		}, time.Since(start), ses)
+		if err == nil && scope.Cancelled() {
+			// The results of a cancelled query may be cut short anywhere.
+			err = graph.ErrQueryCancelled
+		}
 		if err != nil {
-			bytes, err = WrapErrResult(err)
-			http.Error(w, string(bytes), 400)
-			ses = nil
-			return 400
+			return FormatQueryError(w, err)
 		}
-		bytes, err = WrapResult(output)
+		wrap := SuccessQueryWrapper{Result: output, Truncated: truncated}
+		if a, ok := ses.(query.Analyzer); ok {
+			wrap.Analyze = a.Analyses()
+		}
+		bytes, err := json.MarshalIndent(wrap, "", " ")
 		if err != nil {
-			ses = nil
-			return FormatJson400(w, err)
+			return FormatQueryError(w, &query.BackendError{Err: err})
 		}
 		fmt.Fprint(w, string(bytes))
-		ses = nil
 		return 200
 	case query.ParseFail:
-		ses = nil
-		return FormatJson400(w, err)
+		return FormatQueryError(w, &query.ParseError{Err: err})
 	default:
-		ses = nil
-		return FormatJsonError(w, 500, "Incomplete data?")
+		return FormatQueryError(w, &query.ParseError{Err: errIncomplete})
 	}
-	http.Error(w, "", http.StatusNotFound)
-	ses = nil
-	return http.StatusNotFound
 }
 
 func (api *Api) ServeV1Shape(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
-	var ses query.HttpSession
-	switch params.ByName("query_lang") {
-	case "gremlin":
-		ses = gremlin.NewSession(api.ts, api.config.Timeout, false)
-	case "mql":
-		ses = mql.NewSession(api.ts)
-	default:
-		return FormatJson400(w, "Need a query language.")
+	ses, err := api.newHttpSession(r, params, nil)
+	if err != nil {
+		return FormatQueryError(w, err)
 	}
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return FormatJson400(w, err)
+		return FormatQueryError(w, &query.ParseError{Err: err})
 	}
 	code := string(bodyBytes)
 	result, err := ses.InputParses(code)
 	switch result {
 	case query.Parsed:
-		var output []byte
-		var err error
-		output, err = GetQueryShape(code, ses)
+		output, err := GetQueryShape(code, ses)
 		if err != nil {
-			return FormatJson400(w, err)
+			return FormatQueryError(w, err)
 		}
 		fmt.Fprint(w, string(output))
 		return 200
 	case query.ParseFail:
-		return FormatJson400(w, err)
+		return FormatQueryError(w, &query.ParseError{Err: err})
 	default:
-		return FormatJsonError(w, 500, "Incomplete data?")
+		return FormatQueryError(w, &query.ParseError{Err: errIncomplete})
+	}
+}
+
+var errIncomplete = errors.New("incomplete query")
+
+// newHttpSession returns a session for the query language of the request,
+// with the values of its params query parameter bound, or NotFound if there
+// is no such language. If scope is not nil, the session's store is bound to
+// it.
+func (api *Api) newHttpSession(r *http.Request, params httprouter.Params, scope *graph.QueryScope) (query.HttpSession, error) {
+	ts := api.ts
+	if asOf := r.URL.Query().Get("as_of"); asOf != "" {
+		t, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			return nil, &query.ParseError{Err: err}
+		}
+		ts, err = graph.AsOf(ts, t)
+		if err != nil {
+			return nil, &query.ParseError{Err: err}
+		}
+	}
+	if source, tag := r.URL.Query().Get("source"), r.URL.Query().Get("source_tag"); source != "" || tag != "" {
+		var err error
+		ts, err = graph.BySource(ts, source, tag)
+		if err != nil {
+			return nil, &query.ParseError{Err: err}
+		}
+	}
+	ts, err := api.restrictLabels(r, ts)
+	if err != nil {
+		return nil, err
+	}
+	if scope != nil {
+		ts = graph.Scope(ts, scope)
+	}
+	var ses query.HttpSession
+	switch lang := params.ByName("query_lang"); lang {
+	case "gremlin":
+		gs := gremlin.NewSession(ts, api.config.Timeout, false)
+		gs.SetLabelScope(r.URL.Query()["label"])
+		ses = gs
+	case "mql":
+		ses = mql.NewSession(ts)
+	default:
+		return nil, &query.NotFound{What: fmt.Sprintf("query language %q", lang)}
+	}
+	if p := r.URL.Query().Get("params"); p != "" {
+		var values map[string]string
+		if err := json.Unmarshal([]byte(p), &values); err != nil {
+			return nil, &query.ParseError{Err: fmt.Errorf("params: %v", err)}
+		}
+		binder, ok := ses.(query.ParamBinder)
+		if !ok {
+			return nil, &query.ParseError{Err: errors.New("query language does not take params")}
+		}
+		if err := binder.BindParams(values); err != nil {
+			return nil, err
+		}
+	}
+	if r.URL.Query().Get("analyze") == "true" {
+		a, ok := ses.(query.Analyzer)
+		if !ok {
+			return nil, &query.ParseError{Err: errors.New("query language does not analyze queries")}
+		}
+		a.SetAnalyze(true)
+	}
+	if sample := r.URL.Query().Get("sample"); sample != "" {
+		n, fraction, err := parseSample(sample)
+		if err != nil {
+			return nil, &query.ParseError{Err: err}
+		}
+		s, ok := ses.(query.Sampler)
+		if !ok {
+			return nil, &query.ParseError{Err: errors.New("query language does not sample results")}
+		}
+		s.SetSample(n, fraction)
+	}
+	return ses, nil
+}
+
+// parseSample parses the value of a sample query parameter: a number of
+// results, or a fraction of them between 0 and 1.
+func parseSample(s string) (n int64, fraction float64, err error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+		return n, 0, nil
+	}
+	fraction, err = strconv.ParseFloat(s, 64)
+	if err != nil || fraction <= 0 || fraction >= 1 {
+		return 0, 0, fmt.Errorf("sample must be a number of results or a fraction between 0 and 1, got %q", s)
 	}
-	http.Error(w, "", http.StatusNotFound)
-	return http.StatusNotFound
+	return 0, fraction, nil
 }
@@ -0,0 +1,106 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/db"
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+	"github.com/google/cayley/quad"
+	"github.com/google/cayley/quad/cquads"
+	"github.com/google/cayley/query"
+)
+
+// defaultExportPage is the most triples in a page of an export that does not
+// give a limit.
+const defaultExportPage = 10000
+
+var errBadResume = errors.New("bad resume token")
+
+// exportPage writes the triples of ts to enc, at most limit of them,
+// starting offset results into its all iterator. It returns the offset the
+// next page starts at, and whether there are more triples after the page.
+func exportPage(ts graph.TripleStore, enc quad.Marshaler, offset, limit int64) (int64, bool, error) {
+	var it graph.Iterator = ts.TriplesAllIterator()
+	if offset > 0 {
+		it, _ = iterator.NewSkip(ts, it, offset).Optimize()
+	}
+	defer it.Close()
+	var n int64
+	for graph.Next(it) {
+		if n == limit {
+			return offset, true, nil
+		}
+		offset++
+		t := ts.Quad(it.Result())
+		if !t.IsValid() {
+			// Removed triples may leave holes in the all iterator.
+			continue
+		}
+		if err := enc.Marshal(t); err != nil {
+			return 0, false, err
+		}
+		n++
+	}
+	return offset, false, nil
+}
+
+// ServeV1Export writes a page of the triples of the graph as N-Quads, at
+// most as many as the limit parameter gives. Pages other than the last have
+// the header db.ExportResumeHeader, whose token is given as the resume
+// parameter for the next page. Clients under a label_acl export only the
+// triples of their labels.
+func (api *Api) ServeV1Export(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	limit := int64(defaultExportPage)
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n <= 0 {
+			return FormatQueryError(w, &query.ParseError{Err: errors.New("limit must be a positive number")})
+		}
+		limit = n
+	}
+	var offset int64
+	if s := r.URL.Query().Get("resume"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return FormatQueryError(w, &query.ParseError{Err: errBadResume})
+		}
+		offset = n
+	}
+	ts, err := api.restrictLabels(r, api.ts)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	// The page is held until it is whole, as the resume token of the next
+	// is known only then.
+	var buf bytes.Buffer
+	next, more, err := exportPage(ts, cquads.NewEncoder(&buf), offset, limit)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	w.Header().Set("Content-Type", "application/n-quads")
+	if more {
+		w.Header().Set(db.ExportResumeHeader, strconv.FormatInt(next, 10))
+	}
+	w.Write(buf.Bytes())
+	return 200
+}
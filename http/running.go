@@ -0,0 +1,107 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query"
+)
+
+// QueryStatus describes a query the server is running.
+type QueryStatus struct {
+	ID         int64     `json:"id"`
+	Lang       string    `json:"lang"`
+	Query      string    `json:"query"`
+	Started    time.Time `json:"started"`
+	RoundTrips int64     `json:"round_trips"`
+}
+
+type runningQuery struct {
+	status QueryStatus
+	ses    query.HttpSession
+	scope  *graph.QueryScope
+}
+
+// A queryRegistry holds the queries the server is running, so that they can
+// be listed and cancelled. The zero value is empty and ready to use.
+type queryRegistry struct {
+	mu      sync.Mutex
+	last    int64
+	running map[int64]*runningQuery
+}
+
+// add registers a query as it starts, returning its id.
+func (r *queryRegistry) add(lang, text string, ses query.HttpSession, scope *graph.QueryScope) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running == nil {
+		r.running = make(map[int64]*runningQuery)
+	}
+	r.last++
+	r.running[r.last] = &runningQuery{
+		status: QueryStatus{ID: r.last, Lang: lang, Query: text, Started: time.Now()},
+		ses:    ses,
+		scope:  scope,
+	}
+	return r.last
+}
+
+// remove forgets the query with the given id once it is done.
+func (r *queryRegistry) remove(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, id)
+}
+
+type byID []QueryStatus
+
+func (s byID) Len() int           { return len(s) }
+func (s byID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+func (s byID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// list returns the status of each running query, oldest first.
+func (r *queryRegistry) list() []QueryStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queries := make([]QueryStatus, 0, len(r.running))
+	for _, q := range r.running {
+		status := q.status
+		status.RoundTrips = q.scope.RoundTrips()
+		queries = append(queries, status)
+	}
+	sort.Sort(byID(queries))
+	return queries
+}
+
+// cancel cancels the query with the given id, returning whether it was
+// running. The query's store stops making round trips for it, and a session
+// that is a query.Killer is killed as well.
+func (r *queryRegistry) cancel(id int64) bool {
+	r.mu.Lock()
+	q, ok := r.running[id]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	q.scope.Cancel()
+	if k, ok := q.ses.(query.Killer); ok {
+		k.Kill()
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/barakmich/glog"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/query"
+)
+
+// SlowQuery describes a query that took longer than the slow query
+// threshold.
+type SlowQuery struct {
+	Lang       string   `json:"lang"`
+	Query      string   `json:"query"`
+	Duration   string   `json:"duration"`
+	RoundTrips int64    `json:"round_trips"`
+	Results    int      `json:"results"`
+	Plans      []string `json:"plans,omitempty"`
+}
+
+// logSlowQuery records a slow query. It is a variable so that tests can see
+// what is logged.
+var logSlowQuery = func(q SlowQuery) {
+	b, err := json.Marshal(q)
+	if err != nil {
+		glog.Errorln("Error logging slow query: ", err)
+		return
+	}
+	glog.Warningf("Slow query: %s", b)
+}
+
+// slowQueryThreshold returns how long a query may take before it is logged
+// as slow, or 0 if none is.
+func (api *Api) slowQueryThreshold() time.Duration {
+	return time.Duration(atomic.LoadInt64(&api.slowQuery))
+}
+
+func (api *Api) setSlowQueryThreshold(d time.Duration) {
+	atomic.StoreInt64(&api.slowQuery, int64(d))
+}
+
+// checkSlowQuery logs q if it took longer than the slow query threshold,
+// along with the plans ses ran it with.
+func (api *Api) checkSlowQuery(q SlowQuery, elapsed time.Duration, ses query.HttpSession) {
+	threshold := api.slowQueryThreshold()
+	if threshold <= 0 || elapsed <= threshold {
+		return
+	}
+	q.Duration = elapsed.String()
+	if e, ok := ses.(query.Explainer); ok {
+		q.Plans = e.Plans()
+	}
+	logSlowQuery(q)
+}
+
+type slowQueryThreshold struct {
+	Threshold string `json:"threshold"`
+}
+
+// ServeV1SlowQuery returns the slow query threshold.
+func (api *Api) ServeV1SlowQuery(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	bytes, err := WrapResult(slowQueryThreshold{api.slowQueryThreshold().String()})
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
+
+// ServeV1SetSlowQuery changes the slow query threshold to the one in the
+// request body.
+func (api *Api) ServeV1SetSlowQuery(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	var body slowQueryThreshold
+	if err := json.Unmarshal(bodyBytes, &body); err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	d, err := time.ParseDuration(body.Threshold)
+	if err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	if d < 0 {
+		return FormatQueryError(w, &query.ParseError{Err: fmt.Errorf("slow query threshold must not be negative")})
+	}
+	api.setSlowQueryThreshold(d)
+	fmt.Fprint(w, "{\"result\": \"Successfully set the slow query threshold.\"}")
+	return 200
+}
@@ -0,0 +1,63 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/query"
+)
+
+// ServeV1PredicateStats writes the number of triples with each predicate,
+// most common first.
+func (api *Api) ServeV1PredicateStats(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	ts, err := api.restrictLabels(r, api.ts)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	hist, err := graph.PredicateHistogram(ts)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	bytes, err := WrapResult(hist)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
+
+// ServeV1Stats writes a summary of the store: the number of triples, of
+// distinct nodes in each direction, and the bytes the store takes on disk.
+func (api *Api) ServeV1Stats(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	ts, err := api.restrictLabels(r, api.ts)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	sum, err := graph.Summarize(ts)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	bytes, err := WrapResult(sum)
+	if err != nil {
+		return FormatQueryError(w, &query.BackendError{Err: err})
+	}
+	fmt.Fprint(w, string(bytes))
+	return 200
+}
@@ -25,8 +25,11 @@ import (
 	"github.com/barakmich/glog"
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/google/cayley/db"
+	"github.com/google/cayley/graph"
 	"github.com/google/cayley/quad"
 	"github.com/google/cayley/quad/cquads"
+	"github.com/google/cayley/query"
 )
 
 func ParseJsonToTripleList(jsonBody []byte) ([]quad.Quad, error) {
@@ -44,42 +47,67 @@ func ParseJsonToTripleList(jsonBody []byte) ([]quad.Quad, error) {
 }
 
 func (api *Api) ServeV1Write(w http.ResponseWriter, r *http.Request, _ httprouter.Params) int {
-	if api.config.ReadOnly {
-		return FormatJson400(w, "Database is read-only.")
+	if api.config.ReadOnly || graph.IsReadOnly(api.ts) {
+		return FormatQueryError(w, &query.BackendError{Err: graph.ErrReadOnly})
 	}
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return FormatJson400(w, err)
+		return FormatQueryError(w, &query.ParseError{Err: err})
 	}
 	tripleList, terr := ParseJsonToTripleList(bodyBytes)
 	if terr != nil {
-		return FormatJson400(w, terr)
+		return FormatQueryError(w, &query.ParseError{Err: terr})
 	}
-	api.ts.AddTripleSet(tripleList)
+	labels, err := api.writeLabels(r)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	for _, t := range tripleList {
+		if err := checkLabel(labels, t); err != nil {
+			return FormatQueryError(w, err)
+		}
+	}
+	ts, err := api.writer(r)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	ts.AddTripleSet(tripleList)
 	fmt.Fprintf(w, "{\"result\": \"Successfully wrote %d triples.\"}", len(tripleList))
 	return 200
 }
 
 func (api *Api) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
-	if api.config.ReadOnly {
-		return FormatJson400(w, "Database is read-only.")
+	if api.config.ReadOnly || graph.IsReadOnly(api.ts) {
+		return FormatQueryError(w, &query.BackendError{Err: graph.ErrReadOnly})
 	}
 
 	formFile, _, err := r.FormFile("NQuadFile")
 	if err != nil {
 		glog.Errorln(err)
-		return FormatJsonError(w, 500, "Couldn't read file: "+err.Error())
+		return FormatQueryError(w, &query.ParseError{Err: fmt.Errorf("Couldn't read file: %v", err)})
 	}
 
 	defer formFile.Close()
 
+	labels, err := api.writeLabels(r)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	ts, err := api.writer(r)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+
 	blockSize, blockErr := strconv.ParseInt(r.URL.Query().Get("block_size"), 10, 64)
 	if blockErr != nil {
 		blockSize = int64(api.config.LoadSize)
 	}
 
 	// TODO(kortschak) Make this configurable from the web UI.
-	dec := cquads.NewDecoder(formFile)
+	dec := db.WithLabel(cquads.NewDecoder(formFile), api.config.LoadLabel)
+	if api.config.LoadStableBlanks {
+		dec = db.WithStableBlanks(dec)
+	}
 
 	var (
 		n int
@@ -92,33 +120,59 @@ func (api *Api) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params
 			if err == io.EOF {
 				break
 			}
-			panic("what can do this here?") // FIXME(kortschak)
+			return FormatQueryError(w, &query.ParseError{Err: fmt.Errorf("Invalid quad after %d quads: %v", n, err)})
+		}
+		if err := checkLabel(labels, t); err != nil {
+			return FormatQueryError(w, err)
 		}
 		block = append(block, t)
 		n++
 		if len(block) == cap(block) {
-			api.ts.AddTripleSet(block)
+			ts.AddTripleSet(block)
 			block = block[:0]
 		}
 	}
-	api.ts.AddTripleSet(block)
+	ts.AddTripleSet(block)
 
 	fmt.Fprintf(w, "{\"result\": \"Successfully wrote %d triples.\"}", n)
 
 	return 200
 }
 
+// writer returns the store to write the triples of the request to: a view
+// recording the source given by its source query parameter, if there is one.
+func (api *Api) writer(r *http.Request) (graph.TripleStore, error) {
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		return api.ts, nil
+	}
+	ts, err := graph.WithSource(api.ts, source)
+	if err != nil {
+		return nil, &query.ParseError{Err: err}
+	}
+	return ts, nil
+}
+
 func (api *Api) ServeV1Delete(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
-	if api.config.ReadOnly {
-		return FormatJson400(w, "Database is read-only.")
+	if api.config.ReadOnly || graph.IsReadOnly(api.ts) {
+		return FormatQueryError(w, &query.BackendError{Err: graph.ErrReadOnly})
 	}
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return FormatJson400(w, err)
+		return FormatQueryError(w, &query.ParseError{Err: err})
 	}
 	tripleList, terr := ParseJsonToTripleList(bodyBytes)
 	if terr != nil {
-		return FormatJson400(w, terr)
+		return FormatQueryError(w, &query.ParseError{Err: terr})
+	}
+	labels, err := api.writeLabels(r)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	for _, t := range tripleList {
+		if err := checkLabel(labels, t); err != nil {
+			return FormatQueryError(w, err)
+		}
 	}
 	count := 0
 	for _, triple := range tripleList {
@@ -128,3 +182,48 @@ func (api *Api) ServeV1Delete(w http.ResponseWriter, r *http.Request, params htt
 	fmt.Fprintf(w, "{\"result\": \"Successfully deleted %d triples.\"}", count)
 	return 200
 }
+
+// ServeV1DeleteKeys deletes the triples with the keys given in the body, as
+// tagged by a Gremlin .OutE() or .InE(), so that exactly the triples a
+// query found are deleted. Under a label_acl, keys of triples outside the
+// client's labels are forbidden, and nothing is deleted.
+func (api *Api) ServeV1DeleteKeys(w http.ResponseWriter, r *http.Request, params httprouter.Params) int {
+	if api.config.ReadOnly || graph.IsReadOnly(api.ts) {
+		return FormatQueryError(w, &query.BackendError{Err: graph.ErrReadOnly})
+	}
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	var keys []string
+	err = json.Unmarshal(bodyBytes, &keys)
+	if err != nil {
+		return FormatQueryError(w, &query.ParseError{Err: err})
+	}
+	view, err := api.restrictLabels(r, api.ts)
+	if err != nil {
+		return FormatQueryError(w, err)
+	}
+	tripleList := make([]quad.Quad, 0, len(keys))
+	for _, key := range keys {
+		triple, err := graph.QuadOfKey(view, key)
+		if err != nil {
+			return FormatQueryError(w, &query.ParseError{Err: err})
+		}
+		// The view is read-only, so the triples are removed from the store
+		// itself, and only those the client can see.
+		ok, err := view.QuadExists(triple)
+		if err != nil {
+			return FormatQueryError(w, &query.BackendError{Err: err})
+		}
+		if !ok && api.config.LabelACL != nil {
+			return FormatQueryError(w, &query.ForbiddenError{Err: fmt.Errorf("triple of key %q is not in the permitted labels", key)})
+		}
+		tripleList = append(tripleList, triple)
+	}
+	for _, triple := range tripleList {
+		api.ts.RemoveTriple(triple)
+	}
+	fmt.Fprintf(w, "{\"result\": \"Successfully deleted %d triples.\"}", len(tripleList))
+	return 200
+}
@@ -0,0 +1,192 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+// Builds quads from N-Quad terms, checking that each term is of a kind
+// allowed where it is put, as the N-Quads grammar has it: a subject is an
+// IRI or a blank node, a predicate an IRI, an object any term and a label,
+// if there is one, an IRI or a blank node. Quads loaded from N-Quads files
+// keep the N-Quad form of their terms, so built quads sit beside them.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kind is the kind of an N-Quad term.
+type Kind int
+
+const (
+	// Unknown is the kind of a string that is not an N-Quad term, such
+	// as a bare name.
+	Unknown Kind = iota
+	IRI
+	Blank
+	Literal
+)
+
+func (k Kind) String() string {
+	switch k {
+	case IRI:
+		return "an IRI"
+	case Blank:
+		return "a blank node"
+	case Literal:
+		return "a literal"
+	default:
+		return "not an N-Quad term"
+	}
+}
+
+var (
+	iriTerm   = regexp.MustCompile(`^<[^\x00-\x20<>"{}|^` + "`" + `\\]+>$`)
+	blankTerm = regexp.MustCompile(`^_:[^\s<>"]+$`)
+	langTag   = regexp.MustCompile(`^@[a-zA-Z]+(-[a-zA-Z0-9]+)*$`)
+)
+
+// KindOf returns the kind of the N-Quad term s.
+func KindOf(s string) Kind {
+	switch {
+	case iriTerm.MatchString(s):
+		return IRI
+	case blankTerm.MatchString(s):
+		return Blank
+	case isLiteral(s):
+		return Literal
+	}
+	return Unknown
+}
+
+// isLiteral returns whether s is a quoted string, with an optional
+// language tag or datatype IRI after it.
+func isLiteral(s string) bool {
+	if !strings.HasPrefix(s, `"`) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\n', '\r':
+			return false
+		case '"':
+			rest := s[i+1:]
+			return rest == "" || langTag.MatchString(rest) ||
+				strings.HasPrefix(rest, "^^") && iriTerm.MatchString(rest[2:])
+		}
+	}
+	return false
+}
+
+// LangOf returns the language tag of the N-Quad literal s, in lower case,
+// or "" if s is not a literal with a language tag.
+func LangOf(s string) string {
+	if !isLiteral(s) {
+		return ""
+	}
+	i := strings.LastIndex(s, `"@`)
+	if i < 0 || !langTag.MatchString(s[i+1:]) {
+		return ""
+	}
+	return strings.ToLower(s[i+2:])
+}
+
+// A TermError is returned by Build for a term of a kind that is not
+// allowed in its direction of a quad.
+type TermError struct {
+	Dir  Direction
+	Term string
+	Kind Kind
+}
+
+func (e *TermError) Error() string {
+	var want string
+	switch e.Dir {
+	case Predicate:
+		want = "an IRI"
+	case Object:
+		want = "an IRI, blank node or literal"
+	default:
+		want = "an IRI or blank node"
+	}
+	return fmt.Sprintf("quad: %s %q is %s, not %s", e.Dir, e.Term, e.Kind, want)
+}
+
+// allowed returns whether a term of kind k may be in direction d.
+func allowed(d Direction, k Kind) bool {
+	switch d {
+	case Predicate:
+		return k == IRI
+	case Object:
+		return k != Unknown
+	default:
+		return k == IRI || k == Blank
+	}
+}
+
+// A Builder builds a Quad, checking its terms. Its methods return the
+// Builder, so that calls may be chained:
+//
+//	q, err := new(quad.Builder).
+//		Subject("<http://example.org/alice>").
+//		Predicate("<http://xmlns.com/foaf/0.1/name>").
+//		Object(`"Alice"@en`).
+//		Build()
+//
+// The zero Builder is empty and ready to use.
+type Builder struct {
+	q Quad
+}
+
+func (b *Builder) Subject(s string) *Builder {
+	b.q.Subject = s
+	return b
+}
+
+func (b *Builder) Predicate(p string) *Builder {
+	b.q.Predicate = p
+	return b
+}
+
+func (b *Builder) Object(o string) *Builder {
+	b.q.Object = o
+	return b
+}
+
+// Label sets the label of the quad. Quads without one are in the
+// default graph.
+func (b *Builder) Label(l string) *Builder {
+	b.q.Label = l
+	return b
+}
+
+// Build returns the quad, or ErrIncomplete if it has no subject, predicate
+// or object, or a *TermError for the first term not allowed where it is.
+func (b *Builder) Build() (Quad, error) {
+	if !b.q.IsValid() {
+		return Quad{}, ErrIncomplete
+	}
+	for d := Subject; d <= Label; d++ {
+		t := b.q.Get(d)
+		if d == Label && t == "" {
+			continue
+		}
+		if k := KindOf(t); !allowed(d, k) {
+			return Quad{}, &TermError{Dir: d, Term: t, Kind: k}
+		}
+	}
+	return b.q, nil
+}
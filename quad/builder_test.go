@@ -0,0 +1,134 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quad
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	for _, test := range []struct {
+		term   string
+		expect Kind
+	}{
+		{term: "<http://example.org/alice>", expect: IRI},
+		{term: "_:b0", expect: Blank},
+		{term: `"Alice"`, expect: Literal},
+		{term: `"Alice"@en-GB`, expect: Literal},
+		{term: `"42"^^<http://www.w3.org/2001/XMLSchema#integer>`, expect: Literal},
+		{term: `"say \"hi\""`, expect: Literal},
+		{term: "alice", expect: Unknown},
+		{term: "<>", expect: Unknown},
+		{term: "<http://example.org/a b>", expect: Unknown},
+		{term: "_:", expect: Unknown},
+		{term: `"unterminated`, expect: Unknown},
+		{term: `"Alice"en`, expect: Unknown},
+		{term: `"42"^^integer`, expect: Unknown},
+	} {
+		if got := KindOf(test.term); got != test.expect {
+			t.Errorf("Unexpected kind of %s, got:%v expect:%v", test.term, got, test.expect)
+		}
+	}
+}
+
+func TestLangOf(t *testing.T) {
+	for _, test := range []struct {
+		term   string
+		expect string
+	}{
+		{term: `"Alice"@en`, expect: "en"},
+		{term: `"Alice"@en-GB`, expect: "en-gb"},
+		{term: `"say \"hi\"@fr"@de`, expect: "de"},
+		{term: `"say \"hi\"@fr"`},
+		{term: `"Alice"`},
+		{term: `"42"^^<http://www.w3.org/2001/XMLSchema#integer>`},
+		{term: "<http://example.org/alice@en>"},
+		{term: "Alice@en"},
+	} {
+		if got := LangOf(test.term); got != test.expect {
+			t.Errorf("Unexpected language of %s, got:%q expect:%q", test.term, got, test.expect)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	const (
+		alice = "<http://example.org/alice>"
+		knows = "<http://xmlns.com/foaf/0.1/knows>"
+		name  = `"Alice"@en`
+		graph = "<http://example.org/graph>"
+	)
+	for _, test := range []struct {
+		message string
+		build   *Builder
+		expect  Quad
+		err     error
+	}{
+		{
+			message: "build a quad",
+			build:   new(Builder).Subject(alice).Predicate(knows).Object("_:bob").Label(graph),
+			expect:  Quad{alice, knows, "_:bob", graph},
+		},
+		{
+			message: "build a triple with a literal object and a blank subject",
+			build:   new(Builder).Subject("_:a").Predicate(knows).Object(name),
+			expect:  Quad{"_:a", knows, name, ""},
+		},
+		{
+			message: "refuse a quad without an object",
+			build:   new(Builder).Subject(alice).Predicate(knows),
+			err:     ErrIncomplete,
+		},
+		{
+			message: "refuse a literal subject",
+			build:   new(Builder).Subject(name).Predicate(knows).Object(alice),
+			err:     &TermError{Dir: Subject, Term: name, Kind: Literal},
+		},
+		{
+			message: "refuse a bare subject",
+			build:   new(Builder).Subject("alice").Predicate(knows).Object(alice),
+			err:     &TermError{Dir: Subject, Term: "alice", Kind: Unknown},
+		},
+		{
+			message: "refuse a blank predicate",
+			build:   new(Builder).Subject(alice).Predicate("_:p").Object(alice),
+			err:     &TermError{Dir: Predicate, Term: "_:p", Kind: Blank},
+		},
+		{
+			message: "refuse a literal predicate",
+			build:   new(Builder).Subject(alice).Predicate(name).Object(alice),
+			err:     &TermError{Dir: Predicate, Term: name, Kind: Literal},
+		},
+		{
+			message: "refuse an object that is not a term",
+			build:   new(Builder).Subject(alice).Predicate(knows).Object("Alice"),
+			err:     &TermError{Dir: Object, Term: "Alice", Kind: Unknown},
+		},
+		{
+			message: "refuse a literal label",
+			build:   new(Builder).Subject(alice).Predicate(knows).Object(alice).Label(name),
+			err:     &TermError{Dir: Label, Term: name, Kind: Literal},
+		},
+	} {
+		got, err := test.build.Build()
+		if !reflect.DeepEqual(err, test.err) {
+			t.Errorf("Unexpected error when asked to %s, got:%v expect:%v", test.message, err, test.err)
+		}
+		if got != test.expect {
+			t.Errorf("Unexpected quad when asked to %s, got:%v expect:%v", test.message, got, test.expect)
+		}
+	}
+}
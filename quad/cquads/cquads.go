@@ -19,6 +19,10 @@
 // the N-Quads grammar defined by http://www.w3.org/TR/n-quads/.
 //
 // For a complete definition of the grammar, see cquads.rl.
+//
+// The brackets of IRIs and the quotes of literals are dropped, so an IRI and
+// a literal of the same text, such as <http://x> and "http://x", are read as
+// the same node. Use the nquads package to keep them apart.
 package cquads
 
 import (
@@ -33,14 +37,16 @@ import (
 
 // Decoder implements simplified N-Quad document parsing.
 type Decoder struct {
+	src  io.Reader
 	r    *bufio.Reader
 	line []byte
+	pos  quad.Position
 }
 
 // NewDecoder returns an N-Quad decoder that takes its input from the
 // provided io.Reader.
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r: bufio.NewReader(r)}
+	return &Decoder{src: r, r: bufio.NewReader(r)}
 }
 
 // Unmarshal returns the next valid N-Quad as a quad.Quad, or an error.
@@ -48,15 +54,8 @@ func (dec *Decoder) Unmarshal() (quad.Quad, error) {
 	dec.line = dec.line[:0]
 	var line []byte
 	for {
-		for {
-			l, pre, err := dec.r.ReadLine()
-			if err != nil {
-				return quad.Quad{}, err
-			}
-			dec.line = append(dec.line, l...)
-			if !pre {
-				break
-			}
+		if err := dec.readLine(); err != nil {
+			return quad.Quad{}, err
 		}
 		if line = bytes.TrimSpace(dec.line); len(line) != 0 && line[0] != '#' {
 			break
@@ -73,6 +72,112 @@ func (dec *Decoder) Unmarshal() (quad.Quad, error) {
 	return triple, nil
 }
 
+// readLine appends the next line of input to dec.line, without its line
+// ending.
+func (dec *Decoder) readLine() error {
+	for {
+		l, err := dec.r.ReadSlice('\n')
+		dec.pos.Offset += int64(len(l))
+		dec.line = append(dec.line, l...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || len(dec.line) == 0) {
+			return err
+		}
+		break
+	}
+	dec.pos.Line++
+	dec.line = bytes.TrimSuffix(dec.line, []byte("\n"))
+	dec.line = bytes.TrimSuffix(dec.line, []byte("\r"))
+	return nil
+}
+
+// Position returns the Position in the input after the last quad returned.
+func (dec *Decoder) Position() quad.Position {
+	return dec.pos
+}
+
+// SkipTo goes on decoding from p, a Position returned for the same input.
+// If the input is an io.Seeker it is seeked to p, otherwise the lines
+// up to p are read and discarded.
+func (dec *Decoder) SkipTo(p quad.Position) error {
+	if s, ok := dec.src.(io.Seeker); ok {
+		// The input is ahead of dec.pos by what has been buffered.
+		_, err := s.Seek(p.Offset-dec.pos.Offset-int64(dec.r.Buffered()), 1)
+		if err != nil {
+			return err
+		}
+		dec.r.Reset(dec.src)
+		dec.pos = p
+		return nil
+	}
+	if p.Offset < dec.pos.Offset {
+		return fmt.Errorf("cquads: cannot skip back to offset %d from %d", p.Offset, dec.pos.Offset)
+	}
+	for dec.pos.Offset < p.Offset {
+		dec.line = dec.line[:0]
+		if err := dec.readLine(); err != nil {
+			return err
+		}
+	}
+	if dec.pos.Offset != p.Offset {
+		return fmt.Errorf("cquads: offset %d is not at the start of a line", p.Offset)
+	}
+	return nil
+}
+
+// Encoder implements simplified N-Quad document writing.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewEncoder returns an N-Quad encoder that writes its output to the
+// provided io.Writer.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Marshal writes q as a single line. Every term is written as a quoted
+// string so that the line can be read back by a Decoder unchanged.
+func (enc *Encoder) Marshal(q quad.Quad) error {
+	enc.buf = enc.buf[:0]
+	for _, term := range []string{q.Subject, q.Predicate, q.Object, q.Label} {
+		if term == "" {
+			continue
+		}
+		enc.buf = appendQuoted(enc.buf, term)
+		enc.buf = append(enc.buf, ' ')
+	}
+	enc.buf = append(enc.buf, ".\n"...)
+	_, err := enc.w.Write(enc.buf)
+	return err
+}
+
+func appendQuoted(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			buf = append(buf, '\\', byte(r))
+		case '\t':
+			buf = append(buf, `\t`...)
+		case '\n':
+			buf = append(buf, `\n`...)
+		case '\r':
+			buf = append(buf, `\r`...)
+		case '\b':
+			buf = append(buf, `\b`...)
+		case '\f':
+			buf = append(buf, `\f`...)
+		default:
+			buf = append(buf, string(r)...)
+		}
+	}
+	return append(buf, '"')
+}
+
 func unEscape(r []rune, isQuoted, isEscaped bool) string {
 	if isQuoted {
 		r = r[1 : len(r)-1]
@@ -16,6 +16,7 @@ package cquads
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -634,6 +635,78 @@ func TestDecoder(t *testing.T) {
 	}
 }
 
+func TestDecoderSkipTo(t *testing.T) {
+	var (
+		quads     []quad.Quad
+		positions []quad.Position
+	)
+	dec := NewDecoder(strings.NewReader(document))
+	for {
+		triple, err := dec.Unmarshal()
+		if err != nil {
+			break
+		}
+		quads = append(quads, triple)
+		positions = append(positions, dec.Position())
+	}
+
+	for _, test := range []struct {
+		message string
+		input   io.Reader
+	}{
+		{message: "seekable input", input: strings.NewReader(document)},
+		{message: "unseekable input", input: struct{ io.Reader }{strings.NewReader(document)}},
+	} {
+		dec := NewDecoder(test.input)
+		if err := dec.SkipTo(positions[9]); err != nil {
+			t.Fatalf("Failed to skip %s: %v", test.message, err)
+		}
+		for i := 10; i < len(quads); i++ {
+			triple, err := dec.Unmarshal()
+			if err != nil {
+				t.Fatalf("Failed to read %s after skipping: %v", test.message, err)
+			}
+			if triple != quads[i] || dec.Position() != positions[i] {
+				t.Errorf("Unexpected triple of %s after skipping, got:%v at %v expect:%v at %v",
+					test.message, triple, dec.Position(), quads[i], positions[i])
+			}
+		}
+		if _, err := dec.Unmarshal(); err != io.EOF {
+			t.Errorf("Unexpected error at the end of %s, got:%v expect:%v", test.message, err, io.EOF)
+		}
+	}
+}
+
+var testEncoderQuads = []quad.Quad{
+	{"A", "follows", "B", ""},
+	{"Humphrey Bogart", "name", "/en/humphrey_bogart", ""},
+	{"_:alice", "says", `"hello"\tworld\n`, "C:\\quotes"},
+	{"http://example.org/bob#me", "http://xmlns.com/foaf/0.1/knows", "\u00e9t\u00e9", "status_graph"},
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, q := range testEncoderQuads {
+		if err := enc.Marshal(q); err != nil {
+			t.Fatalf("Failed to write quad %v: %v", q, err)
+		}
+	}
+	dec := NewDecoder(&buf)
+	for _, expect := range testEncoderQuads {
+		got, err := dec.Unmarshal()
+		if err != nil {
+			t.Fatalf("Failed to read back quad %v: %v", expect, err)
+		}
+		if got != expect {
+			t.Errorf("Unexpected round trip result, got:%#v expect:%#v", got, expect)
+		}
+	}
+	if _, err := dec.Unmarshal(); err != io.EOF {
+		t.Errorf("Unexpected trailing input, got error:%v", err)
+	}
+}
+
 func TestRDFWorkingGroupSuit(t *testing.T) {
 	// Tests that are not passable by cquads parsing from the RDF
 	// Working Group Suite:
@@ -33,14 +33,16 @@ import (
 // Decoder implements N-Quad document parsing according to the RDF
 // 1.1 N-Quads specification.
 type Decoder struct {
+	src  io.Reader
 	r    *bufio.Reader
 	line []byte
+	pos  quad.Position
 }
 
 // NewDecoder returns an N-Quad decoder that takes its input from the
 // provided io.Reader.
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r: bufio.NewReader(r)}
+	return &Decoder{src: r, r: bufio.NewReader(r)}
 }
 
 // Unmarshal returns the next valid N-Quad as a quad.Quad, or an error.
@@ -48,15 +50,8 @@ func (dec *Decoder) Unmarshal() (quad.Quad, error) {
 	dec.line = dec.line[:0]
 	var line []byte
 	for {
-		for {
-			l, pre, err := dec.r.ReadLine()
-			if err != nil {
-				return quad.Quad{}, err
-			}
-			dec.line = append(dec.line, l...)
-			if !pre {
-				break
-			}
+		if err := dec.readLine(); err != nil {
+			return quad.Quad{}, err
 		}
 		if line = bytes.TrimSpace(dec.line); len(line) != 0 && line[0] != '#' {
 			break
@@ -73,6 +68,61 @@ func (dec *Decoder) Unmarshal() (quad.Quad, error) {
 	return triple, nil
 }
 
+// readLine appends the next line of input to dec.line, without its line
+// ending.
+func (dec *Decoder) readLine() error {
+	for {
+		l, err := dec.r.ReadSlice('\n')
+		dec.pos.Offset += int64(len(l))
+		dec.line = append(dec.line, l...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || len(dec.line) == 0) {
+			return err
+		}
+		break
+	}
+	dec.pos.Line++
+	dec.line = bytes.TrimSuffix(dec.line, []byte("\n"))
+	dec.line = bytes.TrimSuffix(dec.line, []byte("\r"))
+	return nil
+}
+
+// Position returns the Position in the input after the last quad returned.
+func (dec *Decoder) Position() quad.Position {
+	return dec.pos
+}
+
+// SkipTo goes on decoding from p, a Position returned for the same input.
+// If the input is an io.Seeker it is seeked to p, otherwise the lines
+// up to p are read and discarded.
+func (dec *Decoder) SkipTo(p quad.Position) error {
+	if s, ok := dec.src.(io.Seeker); ok {
+		// The input is ahead of dec.pos by what has been buffered.
+		_, err := s.Seek(p.Offset-dec.pos.Offset-int64(dec.r.Buffered()), 1)
+		if err != nil {
+			return err
+		}
+		dec.r.Reset(dec.src)
+		dec.pos = p
+		return nil
+	}
+	if p.Offset < dec.pos.Offset {
+		return fmt.Errorf("nquads: cannot skip back to offset %d from %d", p.Offset, dec.pos.Offset)
+	}
+	for dec.pos.Offset < p.Offset {
+		dec.line = dec.line[:0]
+		if err := dec.readLine(); err != nil {
+			return err
+		}
+	}
+	if dec.pos.Offset != p.Offset {
+		return fmt.Errorf("nquads: offset %d is not at the start of a line", p.Offset)
+	}
+	return nil
+}
+
 func unEscape(r []rune, isEscaped bool) string {
 	if !isEscaped {
 		return string(r)
@@ -484,6 +484,26 @@ func TestDecoder(t *testing.T) {
 	}
 }
 
+// Quads checked by a quad.Builder are written and read back as they were.
+func TestBuilderRoundTrip(t *testing.T) {
+	built, err := new(quad.Builder).
+		Subject("_:alice").
+		Predicate("<http://xmlns.com/foaf/0.1/name>").
+		Object(`"Alice"@en`).
+		Label("<http://example.org/graph>").
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to build quad: %v", err)
+	}
+	got, err := Parse(built.NTriple())
+	if err != nil {
+		t.Fatalf("Failed to parse built quad: %v", err)
+	}
+	if got != built {
+		t.Errorf("Unexpected quad read back, got:%v expect:%v", got, built)
+	}
+}
+
 func TestRDFWorkingGroupSuit(t *testing.T) {
 	// These tests erroneously pass because the parser does not
 	// perform semantic testing on the URI in the IRIRef as required
@@ -138,3 +138,22 @@ func (q Quad) NTriple() string {
 type Unmarshaler interface {
 	Unmarshal() (Quad, error)
 }
+
+// Position is a place in a quad document, as the number of lines and of
+// bytes before it.
+type Position struct {
+	Line   int64
+	Offset int64
+}
+
+// Positioner is implemented by Unmarshalers that can report the Position
+// after the last quad they returned, and can go on from a Position that
+// one of them reported for the same document.
+type Positioner interface {
+	Position() Position
+	SkipTo(Position) error
+}
+
+type Marshaler interface {
+	Marshal(Quad) error
+}
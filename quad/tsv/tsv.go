@@ -0,0 +1,228 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tsv implements parsing the tab-separated "spog" format written
+// by some dump tools, with the subject, predicate, object and, optionally,
+// label of a quad on each line, and no escaping of any kind.
+//
+// A term may be marked with the N-Quads syntax: <...> for an IRI, _: for a
+// blank node and "..." for a literal, with an optional language tag or
+// datatype IRI after the closing quote. An unmarked subject, predicate or
+// label is read as an IRI. Whether an unmarked object is an IRI or a
+// literal is decided by the IsIRI field of the Decoder.
+//
+// Terms are returned in their N-Quad form, without decoding escapes, as
+// the nquads package returns them, so an unmarked literal a b is read as
+// "a b" and an unmarked IRI http://x as <http://x>.
+//
+// Since a column may not hold a tab, an object literal with tabs in it
+// must be marked. The columns from the opening quote up to the closing
+// one are then read as the one literal.
+package tsv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/google/cayley/quad"
+)
+
+var (
+	markedLiteral = regexp.MustCompile(`(?s)^".*"(@[a-zA-Z]+(-[a-zA-Z0-9]+)*|\^\^<[^>]*>)?$`)
+	absoluteIRI   = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:[^\x00-\x20<>"{}|^` + "`" + `\\]+$`)
+)
+
+// LooksLikeIRI returns whether s is an absolute IRI, with a scheme and
+// none of the characters not allowed in an IRI. It is the default IsIRI
+// of a Decoder.
+func LooksLikeIRI(s string) bool {
+	return absoluteIRI.MatchString(s)
+}
+
+// Decoder implements spog document parsing.
+type Decoder struct {
+	// IsIRI returns whether an unmarked object is an IRI rather than a
+	// literal. If it is nil, LooksLikeIRI is used.
+	IsIRI func(string) bool
+
+	src  io.Reader
+	r    *bufio.Reader
+	line []byte
+	pos  quad.Position
+}
+
+// NewDecoder returns a spog decoder that takes its input from the
+// provided io.Reader.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{src: r, r: bufio.NewReader(r)}
+}
+
+// Unmarshal returns the next quad, or an error. Blank lines and lines
+// starting with '#' are skipped.
+func (dec *Decoder) Unmarshal() (quad.Quad, error) {
+	for {
+		dec.line = dec.line[:0]
+		if err := dec.readLine(); err != nil {
+			return quad.Quad{}, err
+		}
+		if line := bytes.TrimSpace(dec.line); len(line) != 0 && line[0] != '#' {
+			break
+		}
+	}
+	q, err := dec.parse(string(dec.line))
+	if err != nil {
+		return quad.Quad{}, fmt.Errorf("tsv: line %d: %v", dec.pos.Line, err)
+	}
+	return q, nil
+}
+
+// parse returns the quad of a line of input.
+func (dec *Decoder) parse(line string) (quad.Quad, error) {
+	cols := strings.Split(line, "\t")
+	if len(cols) < 3 {
+		return quad.Quad{}, fmt.Errorf("expected 3 or 4 columns, got %d", len(cols))
+	}
+	var (
+		q   quad.Quad
+		err error
+	)
+	if q.Subject, err = resource(cols[0]); err != nil {
+		return quad.Quad{}, fmt.Errorf("subject: %v", err)
+	}
+	if q.Predicate, err = resource(cols[1]); err != nil {
+		return quad.Quad{}, fmt.Errorf("predicate: %v", err)
+	}
+
+	rest := cols[2:]
+	var label string
+	switch {
+	case len(rest) == 1:
+		q.Object = dec.object(rest[0])
+	case strings.HasPrefix(rest[0], `"`):
+		// A marked literal may run over several columns, with a label
+		// after it or not.
+		last := len(rest) - 1
+		if o := strings.Join(rest[:last], "\t"); markedLiteral.MatchString(o) && !strings.HasPrefix(rest[last], `"`) {
+			q.Object, label = o, rest[last]
+		} else if o = strings.Join(rest, "\t"); markedLiteral.MatchString(o) {
+			q.Object = o
+		} else {
+			return quad.Quad{}, fmt.Errorf("unterminated literal %q", o)
+		}
+	case len(rest) == 2:
+		q.Object, label = dec.object(rest[0]), rest[1]
+	default:
+		return quad.Quad{}, fmt.Errorf("expected 3 or 4 columns, got %d; an object with tabs must be quoted", len(cols))
+	}
+	if label = strings.TrimSpace(label); label != "" {
+		if q.Label, err = resource(label); err != nil {
+			return quad.Quad{}, fmt.Errorf("label: %v", err)
+		}
+	}
+	if q.Subject == "" || q.Predicate == "" || q.Object == "" {
+		return quad.Quad{}, quad.ErrIncomplete
+	}
+	return q, nil
+}
+
+// resource returns the N-Quad form of a subject, predicate or label term,
+// which may not be a literal.
+func resource(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", nil
+	case strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">"), strings.HasPrefix(s, "_:"):
+		return s, nil
+	case strings.HasPrefix(s, `"`):
+		return "", fmt.Errorf("unexpected literal %q", s)
+	}
+	return "<" + s + ">", nil
+}
+
+// object returns the N-Quad form of the object term s.
+func (dec *Decoder) object(s string) string {
+	switch {
+	case s == "":
+		return ""
+	case strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">"), strings.HasPrefix(s, "_:"), markedLiteral.MatchString(s):
+		return s
+	}
+	isIRI := dec.IsIRI
+	if isIRI == nil {
+		isIRI = LooksLikeIRI
+	}
+	if isIRI(s) {
+		return "<" + s + ">"
+	}
+	return `"` + s + `"`
+}
+
+// readLine appends the next line of input to dec.line, without its line
+// ending.
+func (dec *Decoder) readLine() error {
+	for {
+		l, err := dec.r.ReadSlice('\n')
+		dec.pos.Offset += int64(len(l))
+		dec.line = append(dec.line, l...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (err != io.EOF || len(dec.line) == 0) {
+			return err
+		}
+		break
+	}
+	dec.pos.Line++
+	dec.line = bytes.TrimSuffix(dec.line, []byte("\n"))
+	dec.line = bytes.TrimSuffix(dec.line, []byte("\r"))
+	return nil
+}
+
+// Position returns the Position in the input after the last quad returned.
+func (dec *Decoder) Position() quad.Position {
+	return dec.pos
+}
+
+// SkipTo goes on decoding from p, a Position returned for the same input.
+// If the input is an io.Seeker it is seeked to p, otherwise the lines
+// up to p are read and discarded.
+func (dec *Decoder) SkipTo(p quad.Position) error {
+	if s, ok := dec.src.(io.Seeker); ok {
+		// The input is ahead of dec.pos by what has been buffered.
+		_, err := s.Seek(p.Offset-dec.pos.Offset-int64(dec.r.Buffered()), 1)
+		if err != nil {
+			return err
+		}
+		dec.r.Reset(dec.src)
+		dec.pos = p
+		return nil
+	}
+	if p.Offset < dec.pos.Offset {
+		return fmt.Errorf("tsv: cannot skip back to offset %d from %d", p.Offset, dec.pos.Offset)
+	}
+	for dec.pos.Offset < p.Offset {
+		dec.line = dec.line[:0]
+		if err := dec.readLine(); err != nil {
+			return err
+		}
+	}
+	if dec.pos.Offset != p.Offset {
+		return fmt.Errorf("tsv: offset %d is not at the start of a line", p.Offset)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsv
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/cayley/quad"
+)
+
+var testSPOG = []struct {
+	message string
+	input   string
+	isIRI   func(string) bool
+	expect  quad.Quad
+	err     bool
+}{
+	{
+		message: "parse a three column line",
+		input:   "alice\tfollows\tbob",
+		expect:  quad.Quad{"<alice>", "<follows>", `"bob"`, ""},
+	},
+	{
+		message: "parse a four column line",
+		input:   "alice\tfollows\thttp://example.org/bob\tsocial",
+		expect:  quad.Quad{"<alice>", "<follows>", "<http://example.org/bob>", "<social>"},
+	},
+	{
+		message: "parse an empty fourth column",
+		input:   "alice\tfollows\tbob\t",
+		expect:  quad.Quad{"<alice>", "<follows>", `"bob"`, ""},
+	},
+	{
+		message: "parse marked terms",
+		input:   "_:alice\t<http://xmlns.com/foaf/0.1/name>\t\"Alice\"@en\t<http://example.org/graph>",
+		expect:  quad.Quad{"_:alice", "<http://xmlns.com/foaf/0.1/name>", `"Alice"@en`, "<http://example.org/graph>"},
+	},
+	{
+		message: "parse a marked IRI object",
+		input:   "alice\tfollows\t<bob>",
+		expect:  quad.Quad{"<alice>", "<follows>", "<bob>", ""},
+	},
+	{
+		message: "parse a literal with quotes",
+		input:   "alice\tsays\t\"Say \"hi\" \\n\"",
+		expect:  quad.Quad{"<alice>", "<says>", `"Say "hi" \n"`, ""},
+	},
+	{
+		message: "parse a literal containing a tab",
+		input:   "alice\tsays\t\"a\tb\"",
+		expect:  quad.Quad{"<alice>", "<says>", "\"a\tb\"", ""},
+	},
+	{
+		message: "parse a literal containing a tab with a label",
+		input:   "alice\tsays\t\"a\tb\tc\"^^<http://www.w3.org/2001/XMLSchema#string>\tsocial",
+		expect:  quad.Quad{"<alice>", "<says>", "\"a\tb\tc\"^^<http://www.w3.org/2001/XMLSchema#string>", "<social>"},
+	},
+	{
+		message: "parse a literal containing a tab and a quoted column",
+		input:   "alice\tsays\t\"a\t\"b\"",
+		expect:  quad.Quad{"<alice>", "<says>", "\"a\t\"b\"", ""},
+	},
+	{
+		message: "parse an object with a configured heuristic",
+		input:   "alice\tfollows\tbob",
+		isIRI:   func(string) bool { return true },
+		expect:  quad.Quad{"<alice>", "<follows>", "<bob>", ""},
+	},
+	{
+		message: "parse an IRI-like object as a literal",
+		input:   "alice\thomepage\thttp://example.org/alice",
+		isIRI:   func(string) bool { return false },
+		expect:  quad.Quad{"<alice>", "<homepage>", `"http://example.org/alice"`, ""},
+	},
+	{
+		message: "reject an unquoted literal containing a tab",
+		input:   "alice\tsays\ta\tb\tc",
+		err:     true,
+	},
+	{
+		message: "reject an unterminated literal",
+		input:   "alice\tsays\t\"a\tb",
+		err:     true,
+	},
+	{
+		message: "reject a two column line",
+		input:   "alice\tfollows",
+		err:     true,
+	},
+	{
+		message: "reject a literal subject",
+		input:   "\"alice\"\tfollows\tbob",
+		err:     true,
+	},
+	{
+		message: "reject an empty predicate",
+		input:   "alice\t\tbob",
+		err:     true,
+	},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range testSPOG {
+		dec := NewDecoder(strings.NewReader(test.input))
+		dec.IsIRI = test.isIRI
+		got, err := dec.Unmarshal()
+		if test.err {
+			if err == nil {
+				t.Errorf("Expected error when %s, got:%v", test.message, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error when %s: %v", test.message, err)
+			continue
+		}
+		if got != test.expect {
+			t.Errorf("Failed to %s, got:%q expect:%q", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestLooksLikeIRI(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		expect bool
+	}{
+		{input: "http://example.org/bob#me", expect: true},
+		{input: "urn:isbn:0451450523", expect: true},
+		{input: "bob"},
+		{input: "12:30"},
+		{input: "note: a b"},
+		{input: "http://example.org/<bob>"},
+	} {
+		if got := LooksLikeIRI(test.input); got != test.expect {
+			t.Errorf("Unexpected result for %q, got:%t expect:%t", test.input, got, test.expect)
+		}
+	}
+}
+
+const document = `# A dump.
+alice	follows	bob
+bob	follows	alice	social
+
+alice	says	"hello	world"	social
+bob	score	42
+`
+
+func TestDecoder(t *testing.T) {
+	expect := []quad.Quad{
+		{"<alice>", "<follows>", `"bob"`, ""},
+		{"<bob>", "<follows>", `"alice"`, "<social>"},
+		{"<alice>", "<says>", "\"hello\tworld\"", "<social>"},
+		{"<bob>", "<score>", `"42"`, ""},
+	}
+	dec := NewDecoder(strings.NewReader(document))
+	var (
+		got       []quad.Quad
+		positions []quad.Position
+	)
+	for {
+		q, err := dec.Unmarshal()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("Failed to read document: %v", err)
+			}
+			break
+		}
+		got = append(got, q)
+		positions = append(positions, dec.Position())
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("Unexpected quads, got:%q expect:%q", got, expect)
+	}
+
+	dec = NewDecoder(struct{ io.Reader }{strings.NewReader(document)})
+	if err := dec.SkipTo(positions[1]); err != nil {
+		t.Fatalf("Failed to skip: %v", err)
+	}
+	if q, err := dec.Unmarshal(); err != nil || q != expect[2] {
+		t.Errorf("Unexpected quad after skipping, got:%q (%v) expect:%q", q, err, expect[2])
+	}
+}
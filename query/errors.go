@@ -0,0 +1,104 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+// Defines the errors a query or write can fail with, classified so that
+// clients, such as those of the HTTP API, can tell them apart.
+
+// Code classifies an Error.
+type Code string
+
+const (
+	// CodeParse is the code of a query or request body that could not be
+	// understood.
+	CodeParse Code = "parse_error"
+
+	// CodeBackend is the code of a failure of the triple store.
+	CodeBackend Code = "backend_error"
+
+	// CodeTimeout is the code of a query that ran out of time.
+	CodeTimeout Code = "timeout"
+
+	// CodeCancelled is the code of a query that was cancelled while it
+	// ran.
+	CodeCancelled Code = "cancelled"
+
+	// CodeNotFound is the code of a request for something that does not
+	// exist, such as an unknown query language.
+	CodeNotFound Code = "not_found"
+
+	// CodeForbidden is the code of a request the client may not make.
+	CodeForbidden Code = "forbidden"
+)
+
+// An Error is an error with a Code.
+type Error interface {
+	error
+	Code() Code
+}
+
+// A ParseError is returned for a query or request that could not be
+// understood.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string { return e.Err.Error() }
+func (e *ParseError) Code() Code    { return CodeParse }
+
+// A BackendError is returned when the triple store fails to carry out a
+// query or write.
+type BackendError struct {
+	Err error
+}
+
+func (e *BackendError) Error() string { return e.Err.Error() }
+func (e *BackendError) Code() Code    { return CodeBackend }
+
+// A TimeoutError is returned for a query that was stopped for running too
+// long.
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string { return e.Err.Error() }
+func (e *TimeoutError) Code() Code    { return CodeTimeout }
+
+// A CancelledError is returned for a query that was cancelled before it
+// finished.
+type CancelledError struct {
+	Err error
+}
+
+func (e *CancelledError) Error() string { return e.Err.Error() }
+func (e *CancelledError) Code() Code    { return CodeCancelled }
+
+// A NotFound error is returned for a request for something that does not
+// exist. What names it.
+type NotFound struct {
+	What string
+}
+
+func (e *NotFound) Error() string { return e.What + " not found" }
+func (e *NotFound) Code() Code    { return CodeNotFound }
+
+// A ForbiddenError is returned for a request the client may not make, such
+// as a query by a client that is not permitted any labels.
+type ForbiddenError struct {
+	Err error
+}
+
+func (e *ForbiddenError) Error() string { return e.Err.Error() }
+func (e *ForbiddenError) Code() Code    { return CodeForbidden }
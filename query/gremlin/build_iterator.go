@@ -40,6 +40,28 @@ func getStrings(obj *otto.Object, field string) []string {
 
 func getStringArgs(obj *otto.Object) []string { return getStrings(obj, "string_args") }
 
+// getIntArg returns the first argument of a step as an integer, if it is
+// a number.
+func getIntArg(obj *otto.Object) (int64, bool) { return getIntArgAt(obj, 0) }
+
+// getIntArgAt returns the i'th argument of a step as an integer, if it is
+// a number.
+func getIntArgAt(obj *otto.Object, i int) (int64, bool) {
+	arg, _ := obj.Get("_gremlin_values")
+	if !arg.IsObject() {
+		return 0, false
+	}
+	val, _ := arg.Object().Get(strconv.Itoa(i))
+	if !val.IsNumber() {
+		return 0, false
+	}
+	n, err := val.ToInteger()
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
 func buildIteratorTree(obj *otto.Object, ts graph.TripleStore) graph.Iterator {
 	if !isVertexChain(obj) {
 		return iterator.NewNull()
@@ -120,23 +142,23 @@ func buildInOutIterator(obj *otto.Object, ts graph.TripleStore, base graph.Itera
 	lengthVal, _ := argArray.Get("length")
 	length, _ := lengthVal.ToInteger()
 	var predicateNodeIterator graph.Iterator
-	if length == 0 {
-		predicateNodeIterator = ts.NodesAllIterator()
-	} else {
-		zero, _ := argArray.Get("0")
-		predicateNodeIterator = buildIteratorFromValue(zero, ts)
+	if length > 0 {
+		if zero, _ := argArray.Get("0"); !zero.IsNull() && !zero.IsUndefined() {
+			predicateNodeIterator = buildIteratorFromValue(zero, ts)
+		}
 	}
+	// The second argument of .OutE() and .InE() tags the triples crossed,
+	// rather than their predicates.
+	kindVal, _ := obj.Get("_gremlin_type")
+	kind, _ := kindVal.ToString()
+	edges := kind == "oute" || kind == "ine"
+	var predicateTags, edgeTags []string
 	if length >= 2 {
-		var tags []string
 		one, _ := argArray.Get("1")
-		if one.IsString() {
-			s, _ := one.ToString()
-			tags = append(tags, s)
-		} else if one.Class() == "Array" {
-			tags = makeListOfStringsFromArrayValue(one.Object())
-		}
-		for _, tag := range tags {
-			predicateNodeIterator.Tagger().Add(tag)
+		if edges {
+			edgeTags = tagsFromValue(one)
+		} else {
+			predicateTags = tagsFromValue(one)
 		}
 	}
 
@@ -146,26 +168,101 @@ func buildInOutIterator(obj *otto.Object, ts graph.TripleStore, base graph.Itera
 	}
 	lto := iterator.NewLinksTo(ts, base, in)
 	and := iterator.NewAnd()
-	and.AddSubIterator(iterator.NewLinksTo(ts, predicateNodeIterator, quad.Predicate))
+	if predicateNodeIterator != nil {
+		// Without a predicate, any will do.
+		and.AddSubIterator(iterator.NewLinksTo(ts, predicateNodeIterator, quad.Predicate))
+	}
 	and.AddSubIterator(lto)
+	if labels := labelScope(ts); len(labels) > 0 {
+		labelIterator := ts.FixedIterator()
+		for _, l := range labels {
+			labelIterator.Add(ts.ValueOf(l))
+		}
+		and.AddSubIterator(iterator.NewLinksTo(ts, labelIterator, quad.Label))
+	}
+	for _, tag := range edgeTags {
+		and.Tagger().Add(edgeTagPrefix + tag)
+	}
+	if length >= 3 && !edges {
+		two, _ := argArray.Get("2")
+		if labelTags := tagsFromValue(two); len(labelTags) > 0 {
+			// The label is optional, so that unlabeled triples are still
+			// traversed; they simply don't carry the label tags.
+			labelNodeIterator := ts.NodesAllIterator()
+			for _, tag := range labelTags {
+				labelNodeIterator.Tagger().Add(tag)
+			}
+			and.AddSubIterator(iterator.NewOptional(iterator.NewLinksTo(ts, labelNodeIterator, quad.Label)))
+		}
+	}
+	if tagsDedupLabel(obj) {
+		labelNodeIterator := ts.NodesAllIterator()
+		labelNodeIterator.Tagger().Add(dedupLabelTag)
+		and.AddSubIterator(iterator.NewOptional(iterator.NewLinksTo(ts, labelNodeIterator, quad.Label)))
+	}
+	if len(predicateTags) > 0 {
+		// The predicate is read from each triple crossed.
+		return iterator.NewHasA(ts, iterator.NewSave(ts, and, quad.Predicate, predicateTags...), out)
+	}
 	return iterator.NewHasA(ts, and, out)
 }
 
+// tagsFromValue returns the tags held in a tag argument, which may be
+// either a single string or an array of strings.
+func tagsFromValue(val otto.Value) []string {
+	if val.IsString() {
+		s, _ := val.ToString()
+		return []string{s}
+	}
+	if val.Class() == "Array" {
+		return makeListOfStringsFromArrayValue(val.Object())
+	}
+	return nil
+}
+
+// taggedBefore returns whether tag is given by a .Tag() or .As() in the
+// chain ending at obj.
+func taggedBefore(obj *otto.Object, tag string) bool {
+	for {
+		kindVal, _ := obj.Get("_gremlin_type")
+		if kind, _ := kindVal.ToString(); kind == "tag" {
+			for _, t := range getStringArgs(obj) {
+				if t == tag {
+					return true
+				}
+			}
+		}
+		prevVal, _ := obj.Get("_gremlin_prev")
+		if !prevVal.IsObject() {
+			return false
+		}
+		obj = prevVal.Object()
+	}
+}
+
 func buildIteratorTreeHelper(obj *otto.Object, ts graph.TripleStore, base graph.Iterator) graph.Iterator {
 	var it graph.Iterator
 	it = base
 	// TODO: Better error handling
 	kindVal, _ := obj.Get("_gremlin_type")
 	stringArgs := getStringArgs(obj)
+	kind, _ := kindVal.ToString()
 	var subIt graph.Iterator
 	prevVal, _ := obj.Get("_gremlin_prev")
 	if !prevVal.IsObject() {
 		subIt = base
 	} else {
+		if kind == "path" {
+			setPathTags(prevVal.Object(), true)
+			defer setPathTags(prevVal.Object(), false)
+		}
+		if byLabel, _ := dedupByLabel(stringArgs); kind == "dedup" && byLabel {
+			setDedupLabel(prevVal.Object(), true)
+			defer setDedupLabel(prevVal.Object(), false)
+		}
 		subIt = buildIteratorTreeHelper(prevVal.Object(), ts, base)
 	}
 
-	kind, _ := kindVal.ToString()
 	switch kind {
 	case "vertex":
 		if len(stringArgs) == 0 {
@@ -180,6 +277,12 @@ func buildIteratorTreeHelper(obj *otto.Object, ts graph.TripleStore, base graph.
 	case "tag":
 		it = subIt
 		for _, tag := range stringArgs {
+			// A tag already given earlier in the chain holds each path
+			// to the node it tagged there, rather than tagging again.
+			if prevVal.IsObject() && taggedBefore(prevVal.Object(), tag) {
+				it = iterator.NewBound(it, tag)
+				continue
+			}
 			it.Tagger().Add(tag)
 		}
 	case "save":
@@ -282,6 +385,8 @@ func buildIteratorTreeHelper(obj *otto.Object, ts graph.TripleStore, base graph.
 		or.AddSubIterator(subIt)
 		or.AddSubIterator(argIt)
 		it = or
+	case "union":
+		it = buildUnionIterator(obj, ts, subIt)
 	case "both":
 		// Hardly the most efficient pattern, but the most general.
 		// Worth looking into an Optimize() optimization here.
@@ -293,7 +398,7 @@ func buildIteratorTreeHelper(obj *otto.Object, ts graph.TripleStore, base graph.
 		or.AddSubIterator(it1)
 		or.AddSubIterator(it2)
 		it = or
-	case "out":
+	case "out", "oute":
 		it = buildInOutIterator(obj, ts, subIt, false)
 	case "follow":
 		// Follow a morphism
@@ -310,8 +415,112 @@ func buildIteratorTreeHelper(obj *otto.Object, ts graph.TripleStore, base graph.
 			return iterator.NewNull()
 		}
 		it = buildIteratorTreeHelper(arg.Object(), ts, subIt)
-	case "in":
+	case "in", "ine":
 		it = buildInOutIterator(obj, ts, subIt, true)
+	case "skip":
+		n, ok := getIntArg(obj)
+		if !ok {
+			return iterator.NewNull()
+		}
+		it = iterator.NewSkip(ts, subIt, n)
+	case "limit":
+		n, ok := getIntArg(obj)
+		if !ok {
+			return iterator.NewNull()
+		}
+		it = iterator.NewLimit(ts, subIt, n)
+	case "path":
+		it = subIt
+	case "outcount", "incount":
+		d := quad.Subject
+		if kind == "incount" {
+			d = quad.Object
+		}
+		it = buildFanOutIterator(obj, ts, subIt, d, stringArgs)
+	case "dedup":
+		byLabel, ok := dedupByLabel(stringArgs)
+		if !ok {
+			glog.Errorln("Unknown dedup key", stringArgs[0])
+			return iterator.NewNull()
+		}
+		it = buildDedupIterator(subIt, byLabel)
 	}
+	tagPathStep(obj, it)
 	return it
 }
+
+// buildFanOutIterator returns an iterator over the nodes of subIt that are
+// the node in direction d of a number of triples with a predicate, given by
+// a step such as .OutCount("follows", ">", 5).
+func buildFanOutIterator(obj *otto.Object, ts graph.TripleStore, subIt graph.Iterator, d quad.Direction, stringArgs []string) graph.Iterator {
+	n, ok := getIntArgAt(obj, 2)
+	if len(stringArgs) != 2 || !ok {
+		return iterator.NewNull()
+	}
+	nodes, err := graph.FanOutNodes(ts, graph.FanOut{Direction: d, Predicate: stringArgs[0], Op: stringArgs[1], N: n})
+	if err != nil {
+		glog.Errorln("Error counting triples: ", err)
+		return iterator.NewNull()
+	}
+	fixed := ts.FixedIterator()
+	for _, node := range nodes {
+		fixed.Add(node)
+	}
+	and := iterator.NewAnd()
+	and.AddSubIterator(subIt)
+	and.AddSubIterator(fixed)
+	return and
+}
+
+// buildUnionIterator returns an iterator over each node reached by any of
+// the arguments of the union in obj, once. A morphism is followed from the
+// nodes of subIt, while a path is taken as it is, alongside subIt itself,
+// as with Or.
+func buildUnionIterator(obj *otto.Object, ts graph.TripleStore, subIt graph.Iterator) graph.Iterator {
+	argList, _ := obj.Get("_gremlin_values")
+	if argList.Class() != "GoArray" {
+		glog.Errorln("How is arglist not an array? Return nothing.", argList.Class())
+		return iterator.NewNull()
+	}
+	argArray := argList.Object()
+	lengthVal, _ := argArray.Get("length")
+	length, _ := lengthVal.ToInteger()
+	var (
+		args     []*otto.Object
+		withPath bool
+	)
+	for i := int64(0); i < length; i++ {
+		arg, _ := argArray.Get(strconv.FormatInt(i, 10))
+		if !arg.IsObject() {
+			glog.Errorln("Union of something other than a path or morphism. Return nothing.")
+			return iterator.NewNull()
+		}
+		args = append(args, arg.Object())
+		withPath = withPath || isVertexChain(arg.Object())
+	}
+	if len(args) == 0 {
+		return subIt
+	}
+
+	// Each branch but the first starts from a clone of subIt.
+	var used bool
+	from := func() graph.Iterator {
+		if used {
+			return subIt.Clone()
+		}
+		used = true
+		return subIt
+	}
+	var its []graph.Iterator
+	if withPath {
+		its = append(its, from())
+	}
+	for _, arg := range args {
+		if isVertexChain(arg) {
+			its = append(its, buildIteratorTree(arg, ts))
+		} else {
+			its = append(its, buildIteratorTreeHelper(arg, ts, from()))
+		}
+	}
+	return iterator.NewUnion(ts, its...)
+}
@@ -0,0 +1,85 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gremlin
+
+// Implements .Dedup(), which passes along each node the first time it is
+// reached.
+//
+// By default nodes are told apart by themselves alone. With the "label"
+// key, a node reached through triples with different labels is passed
+// along once for each label. While the iterator for the step before the
+// .Dedup() is built, the label of each triple it traverses is tagged, and
+// the Unique iterator keys its results by that tag as well.
+
+import (
+	"strings"
+
+	"github.com/robertkrimen/otto"
+
+	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
+)
+
+// internalTagPrefix begins the tags that are put on iterators for the
+// query's own use, and left out of its results.
+const internalTagPrefix = "_gremlin_"
+
+// dedupLabelTag is put on the labels of the triples traversed by the step
+// before a .Dedup("label").
+const dedupLabelTag = internalTagPrefix + "dedup_label"
+
+func isInternalTag(tag string) bool {
+	return strings.HasPrefix(tag, internalTagPrefix)
+}
+
+// dedupByLabel returns whether a .Dedup() with the given arguments keys by
+// label, and whether the arguments are valid.
+func dedupByLabel(args []string) (byLabel, ok bool) {
+	if len(args) == 0 {
+		return false, true
+	}
+	switch args[0] {
+	case "node":
+		return false, true
+	case "label":
+		return true, true
+	}
+	return false, false
+}
+
+// setDedupLabel marks obj, the step before a .Dedup("label"), to tag the
+// labels it traverses, or, if mark is false, clears the mark.
+func setDedupLabel(obj *otto.Object, mark bool) {
+	obj.Set("_gremlin_dedup_label", mark)
+}
+
+// tagsDedupLabel returns whether obj was marked by setDedupLabel.
+func tagsDedupLabel(obj *otto.Object) bool {
+	val, _ := obj.Get("_gremlin_dedup_label")
+	if !val.IsBoolean() {
+		return false
+	}
+	mark, _ := val.ToBoolean()
+	return mark
+}
+
+// buildDedupIterator returns an iterator over the results of subIt, each
+// passed along once.
+func buildDedupIterator(subIt graph.Iterator, byLabel bool) graph.Iterator {
+	if byLabel {
+		return iterator.NewUniqueBy(subIt, iterator.TagKey(dedupLabelTag))
+	}
+	return iterator.NewUnique(subIt)
+}
@@ -0,0 +1,52 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gremlin
+
+// Implements .OutE() and .InE(), which move along triples as .Out() and
+// .In() do, and also give the key of each triple crossed, so that a client
+// can address that very triple, such as to delete it.
+//
+// While the query runs, the triples are tagged with internal tags. When the
+// results are output, each is given under the tag asked for, by its key
+// rather than by a name.
+
+import (
+	"strings"
+
+	"github.com/google/cayley/graph"
+)
+
+// edgeTagPrefix is followed by the tag asked for the triples crossed by an
+// .OutE() or .InE().
+const edgeTagPrefix = internalTagPrefix + "edge_"
+
+// isEdgeTag returns whether tag is put on the triples of an .OutE() or
+// .InE().
+func isEdgeTag(tag string) bool {
+	return strings.HasPrefix(tag, edgeTagPrefix)
+}
+
+// outputTag returns the tag under which the value tagged tag is output, and
+// its name, or false if it is not output. Triples crossed by an .OutE() or
+// .InE() are named by their keys.
+func outputTag(tag string, v graph.Value, ses *Session) (string, string, bool) {
+	if isEdgeTag(tag) {
+		return tag[len(edgeTagPrefix):], graph.QuadKey(ses.ts, v), true
+	}
+	if isInternalTag(tag) {
+		return "", "", false
+	}
+	return tag, ses.ts.NameOf(v), true
+}
@@ -33,11 +33,12 @@ func embedFinals(env *otto.Otto, ses *Session, obj *otto.Object) {
 	obj.Set("TagValue", toValueFunc(env, ses, obj, true))
 	obj.Set("Map", mapFunc(env, ses, obj))
 	obj.Set("ForEach", mapFunc(env, ses, obj))
+	obj.Set("Count", countFunc(env, ses, obj))
 }
 
 func allFunc(env *otto.Otto, ses *Session, obj *otto.Object) func(otto.FunctionCall) otto.Value {
 	return func(call otto.FunctionCall) otto.Value {
-		it := buildIteratorTree(obj, ses.ts)
+		it := buildIteratorTree(obj, ses.store())
 		it.Tagger().Add(TopResultTag)
 		ses.limit = -1
 		ses.count = 0
@@ -50,7 +51,7 @@ func limitFunc(env *otto.Otto, ses *Session, obj *otto.Object) func(otto.Functio
 	return func(call otto.FunctionCall) otto.Value {
 		if len(call.ArgumentList) > 0 {
 			limitVal, _ := call.Argument(0).ToInteger()
-			it := buildIteratorTree(obj, ses.ts)
+			it := buildIteratorTree(obj, ses.store())
 			it.Tagger().Add(TopResultTag)
 			ses.limit = int(limitVal)
 			ses.count = 0
@@ -62,7 +63,7 @@ func limitFunc(env *otto.Otto, ses *Session, obj *otto.Object) func(otto.Functio
 
 func toArrayFunc(env *otto.Otto, ses *Session, obj *otto.Object, withTags bool) func(otto.FunctionCall) otto.Value {
 	return func(call otto.FunctionCall) otto.Value {
-		it := buildIteratorTree(obj, ses.ts)
+		it := buildIteratorTree(obj, ses.store())
 		it.Tagger().Add(TopResultTag)
 		limit := -1
 		if len(call.ArgumentList) > 0 {
@@ -89,7 +90,7 @@ func toArrayFunc(env *otto.Otto, ses *Session, obj *otto.Object, withTags bool)
 
 func toValueFunc(env *otto.Otto, ses *Session, obj *otto.Object, withTags bool) func(otto.FunctionCall) otto.Value {
 	return func(call otto.FunctionCall) otto.Value {
-		it := buildIteratorTree(obj, ses.ts)
+		it := buildIteratorTree(obj, ses.store())
 		it.Tagger().Add(TopResultTag)
 		limit := 1
 		var val otto.Value
@@ -119,7 +120,7 @@ func toValueFunc(env *otto.Otto, ses *Session, obj *otto.Object, withTags bool)
 
 func mapFunc(env *otto.Otto, ses *Session, obj *otto.Object) func(otto.FunctionCall) otto.Value {
 	return func(call otto.FunctionCall) otto.Value {
-		it := buildIteratorTree(obj, ses.ts)
+		it := buildIteratorTree(obj, ses.store())
 		it.Tagger().Add(TopResultTag)
 		limit := -1
 		if len(call.ArgumentList) == 0 {
@@ -135,18 +136,54 @@ func mapFunc(env *otto.Otto, ses *Session, obj *otto.Object) func(otto.FunctionC
 	}
 }
 
+// countFunc returns the number of results as an object holding the count
+// and whether it is exact. Passing "approximate" returns the store's
+// estimate where it has one, rather than running the query.
+func countFunc(env *otto.Otto, ses *Session, obj *otto.Object) func(otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		exact := true
+		if len(call.ArgumentList) > 0 {
+			switch mode, _ := call.Argument(0).ToString(); mode {
+			case "exact":
+			case "approximate":
+				exact = false
+			default:
+				glog.Errorf("Unknown count mode %q", mode)
+				return otto.NullValue()
+			}
+		}
+		it := buildIteratorTree(obj, ses.store())
+		if ses.wantShape {
+			iterator.OutputQueryShapeForIterator(it, ses.ts, ses.shape)
+			return otto.NullValue()
+		}
+		n, isExact := iterator.Count(it, exact)
+		val, err := call.Otto.ToValue(map[string]interface{}{
+			"count": n,
+			"exact": isExact,
+		})
+		if err != nil {
+			glog.Error(err)
+			return otto.NullValue()
+		}
+		return val
+	}
+}
+
 func tagsToValueMap(m map[string]graph.Value, ses *Session) map[string]string {
 	outputMap := make(map[string]string)
 	for k, v := range m {
-		outputMap[k] = ses.ts.NameOf(v)
+		if tag, name, ok := outputTag(k, v, ses); ok {
+			outputMap[tag] = name
+		}
 	}
 	return outputMap
 }
 
-func runIteratorToArray(it graph.Iterator, ses *Session, limit int) []map[string]string {
-	output := make([]map[string]string, 0)
+func runIteratorToArray(it graph.Iterator, ses *Session, limit int) []interface{} {
+	output := make([]interface{}, 0)
 	count := 0
-	it, _ = it.Optimize()
+	it = ses.optimize(it)
 	for {
 		select {
 		case <-ses.kill:
@@ -158,7 +195,7 @@ func runIteratorToArray(it graph.Iterator, ses *Session, limit int) []map[string
 		}
 		tags := make(map[string]graph.Value)
 		it.TagResults(tags)
-		output = append(output, tagsToValueMap(tags, ses))
+		output = append(output, tagsToOutput(tags, ses))
 		count++
 		if limit >= 0 && count >= limit {
 			break
@@ -171,7 +208,7 @@ func runIteratorToArray(it graph.Iterator, ses *Session, limit int) []map[string
 			}
 			tags := make(map[string]graph.Value)
 			it.TagResults(tags)
-			output = append(output, tagsToValueMap(tags, ses))
+			output = append(output, tagsToOutput(tags, ses))
 			count++
 			if limit >= 0 && count >= limit {
 				break
@@ -185,7 +222,7 @@ func runIteratorToArray(it graph.Iterator, ses *Session, limit int) []map[string
 func runIteratorToArrayNoTags(it graph.Iterator, ses *Session, limit int) []string {
 	output := make([]string, 0)
 	count := 0
-	it, _ = it.Optimize()
+	it = ses.optimize(it)
 	for {
 		select {
 		case <-ses.kill:
@@ -207,7 +244,7 @@ func runIteratorToArrayNoTags(it graph.Iterator, ses *Session, limit int) []stri
 
 func runIteratorWithCallback(it graph.Iterator, ses *Session, callback otto.Value, this otto.FunctionCall, limit int) {
 	count := 0
-	it, _ = it.Optimize()
+	it = ses.optimize(it)
 	for {
 		select {
 		case <-ses.kill:
@@ -219,7 +256,7 @@ func runIteratorWithCallback(it graph.Iterator, ses *Session, callback otto.Valu
 		}
 		tags := make(map[string]graph.Value)
 		it.TagResults(tags)
-		val, _ := this.Otto.ToValue(tagsToValueMap(tags, ses))
+		val, _ := this.Otto.ToValue(tagsToOutput(tags, ses))
 		val, _ = callback.Call(this.This, val)
 		count++
 		if limit >= 0 && count >= limit {
@@ -233,7 +270,7 @@ func runIteratorWithCallback(it graph.Iterator, ses *Session, callback otto.Valu
 			}
 			tags := make(map[string]graph.Value)
 			it.TagResults(tags)
-			val, _ := this.Otto.ToValue(tagsToValueMap(tags, ses))
+			val, _ := this.Otto.ToValue(tagsToOutput(tags, ses))
 			val, _ = callback.Call(this.This, val)
 			count++
 			if limit >= 0 && count >= limit {
@@ -249,8 +286,18 @@ func runIteratorOnSession(it graph.Iterator, ses *Session) {
 		iterator.OutputQueryShapeForIterator(it, ses.ts, ses.shape)
 		return
 	}
-	it, _ = it.Optimize()
+	if ses.max >= 0 {
+		// Each result that the iterator yields makes at least one path, so
+		// no more than the results left to send are needed. A store may
+		// push the limit down to its own query.
+		it = iterator.NewLimit(ses.store(), it, int64(ses.max-ses.sent))
+	}
+	it = ses.optimize(it)
 	glog.V(2).Infoln(it.DebugString(0))
+	if ses.wantPlan {
+		ses.plan, ses.err = iterator.NewPlan(it, ses.ts)
+		return
+	}
 	for {
 		select {
 		case <-ses.kill:
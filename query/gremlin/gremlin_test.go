@@ -15,11 +15,14 @@
 package gremlin
 
 import (
+	"encoding/json"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/quad"
 
 	_ "github.com/google/cayley/graph/memstore"
@@ -95,6 +98,20 @@ var testQueries = []struct {
 		`,
 		expect: []string{"B", "G", "E"},
 	},
+	{
+		message: "use .OutCount()",
+		query: `
+			g.V().OutCount("follows", ">", 1).All()
+		`,
+		expect: []string{"C", "D"},
+	},
+	{
+		message: "use .InCount()",
+		query: `
+			g.V("B", "D", "F").InCount("follows", ">=", 2).All()
+		`,
+		expect: []string{"B", "F"},
+	},
 	{
 		message: "use .Tag()-.Is()-.Back()",
 		query: `
@@ -244,6 +261,60 @@ var testQueries = []struct {
 		`,
 		expect: []string{"B", "G"},
 	},
+	{
+		message: "show an out label save",
+		query: `
+			g.V("D").Out("status", null, "label").All()
+		`,
+		tag:    "label",
+		expect: []string{"status_graph"},
+	},
+	{
+		message: "show an in label save",
+		query: `
+			g.V("cool").In("status", null, ["where", "label"]).All()
+		`,
+		tag:    "label",
+		expect: []string{"status_graph", "status_graph", "status_graph"},
+	},
+	{
+		message: "show an unlabeled label save",
+		query: `
+			g.V("D").Out(null, null, "label").All()
+		`,
+		tag:    "label",
+		expect: []string{"status_graph"},
+	},
+
+	// Window tests.
+	{
+		message: "use .Skip() then .Limit()",
+		query: `
+			g.V().Skip(2).Limit(3).All()
+		`,
+		expect: []string{"B", "C", "D"},
+	},
+	{
+		message: "use .Limit() then .Skip()",
+		query: `
+			g.V().Limit(4).Skip(2).All()
+		`,
+		expect: []string{"B", "C"},
+	},
+	{
+		message: "use .Skip() past the end",
+		query: `
+			g.V("A", "B").Skip(5).All()
+		`,
+		expect: nil,
+	},
+	{
+		message: "use .Limit() before a traversal",
+		query: `
+			g.V("C", "D").Limit(1).Out("follows").All()
+		`,
+		expect: []string{"B", "D"},
+	},
 }
 
 func runQueryGetTag(g []quad.Quad, query string, tag string) []string {
@@ -278,3 +349,510 @@ func TestGremlin(t *testing.T) {
 		}
 	}
 }
+
+func TestBoundTag(t *testing.T) {
+	g := []quad.Quad{
+		{"A", "follows", "B", ""},
+		{"B", "follows", "A", ""},
+		{"B", "follows", "C", ""},
+		{"C", "follows", "B", ""},
+		{"C", "follows", "D", ""},
+	}
+	for _, test := range []struct {
+		message string
+		query   string
+		tag     string
+		expect  []string
+	}{
+		{
+			message: "find people who follow someone who follows them back",
+			query: `
+				g.V().As("person").Out("follows").As("friend").Out("follows").As("person").All()
+			`,
+			tag:    "friend",
+			expect: []string{"A", "B", "B", "C"},
+		},
+		{
+			message: "find people who follow B and are followed back",
+			query: `
+				g.V().As("person").Out("follows").Is("B").Out("follows").As("person").All()
+			`,
+			tag:    "person",
+			expect: []string{"A", "C"},
+		},
+	} {
+		if test.tag == "" {
+			test.tag = TopResultTag
+		}
+		got := runQueryGetTag(g, test.query, test.tag)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+var labeledGraph = []quad.Quad{
+	{"A", "follows", "B", "2012"},
+	{"A", "follows", "C", "2013"},
+	{"A", "follows", "D", "2014"},
+	{"B", "follows", "C", "2013"},
+	{"B", "follows", "D", "2014"},
+	{"C", "follows", "D", ""},
+}
+
+func TestLabelScope(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		labels  []string
+		query   string
+		expect  []string
+	}{
+		{
+			message: "traverse every label without a scope",
+			query:   `g.V("A", "B").Out("follows").All()`,
+			expect:  []string{"B", "C", "C", "D", "D"},
+		},
+		{
+			message: "traverse two of three labels",
+			labels:  []string{"2012", "2014"},
+			query:   `g.V("A", "B").Out("follows").All()`,
+			expect:  []string{"B", "D", "D"},
+		},
+		{
+			message: "traverse two of three labels in reverse",
+			labels:  []string{"2013", "2014"},
+			query:   `g.V("D").In("follows").All()`,
+			expect:  []string{"A", "B"},
+		},
+	} {
+		ses := makeTestSession(labeledGraph)
+		ses.SetLabelScope(test.labels)
+		c := make(chan interface{}, 5)
+		go ses.ExecInput(test.query, c, -1)
+		var got []string
+		for res := range c {
+			data := res.(*Result)
+			if data.val == nil {
+				got = append(got, ses.ts.NameOf((*data.actualResults)[TopResultTag]))
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+// multiLabelGraph has B followed under two labels, and twice under one.
+var multiLabelGraph = []quad.Quad{
+	{"A", "follows", "B", "2012"},
+	{"A", "follows", "B", "2013"},
+	{"C", "follows", "B", "2013"},
+	{"A", "follows", "D", ""},
+}
+
+func TestUnion(t *testing.T) {
+	for _, test := range []struct {
+		message  string
+		query    string
+		separate []string
+	}{
+		{
+			message: "union two predicate traversals",
+			query:   `g.V("D", "B").Union(g.M().Out("follows"), g.M().Out("status")).All()`,
+			separate: []string{
+				`g.V("D", "B").Out("follows").All()`,
+				`g.V("D", "B").Out("status").All()`,
+			},
+		},
+		{
+			message: "union two paths",
+			query:   `g.V("C").Out("follows").Union(g.V("D").Out("follows")).All()`,
+			separate: []string{
+				`g.V("C").Out("follows").All()`,
+				`g.V("D").Out("follows").All()`,
+			},
+		},
+	} {
+		// Each node found by any of the separate queries is expected once.
+		seen := make(map[string]bool)
+		var expect []string
+		for _, query := range test.separate {
+			for _, node := range runQueryGetTag(simpleGraph, query, TopResultTag) {
+				if !seen[node] {
+					seen[node] = true
+					expect = append(expect, node)
+				}
+			}
+		}
+		got := runQueryGetTag(simpleGraph, test.query, TopResultTag)
+		sort.Strings(got)
+		sort.Strings(expect)
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, expect)
+		}
+	}
+}
+
+func TestBothPredicateTag(t *testing.T) {
+	js := makeTestSession(simpleGraph)
+	c := make(chan interface{}, 5)
+	go js.ExecInput(`g.V("B").Both(null, "pred").All()`, c, -1)
+
+	var got []string
+	for res := range c {
+		data := res.(*Result)
+		if data.val != nil {
+			continue
+		}
+		tags := *data.actualResults
+		got = append(got, js.ts.NameOf(tags[TopResultTag])+" "+js.ts.NameOf(tags["pred"]))
+	}
+	sort.Strings(got)
+	expect := []string{"A follows", "C follows", "D follows", "F follows", "cool status"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Unexpected predicates crossed, got: %v expected: %v", got, expect)
+	}
+}
+
+func TestEdgeKey(t *testing.T) {
+	ses := makeTestSession(multiLabelGraph)
+	c := make(chan interface{}, 5)
+	ses.ExecInput(`g.V("A").OutE("follows", "edge").Is("B").All()`, c, -1)
+
+	var keys []string
+	for res := range c {
+		tags, ok := ses.ResultTags(res)
+		if !ok {
+			continue
+		}
+		if _, ok := tags["_gremlin_edge_edge"]; ok {
+			t.Errorf("Unexpected internal tag in results: %v", tags)
+		}
+		keys = append(keys, tags["edge"])
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Unexpected number of edges crossed, got: %v expected two", keys)
+	}
+
+	// Deleting by the key of the first edge removes exactly that triple.
+	q, err := graph.QuadOfKey(ses.ts, keys[0])
+	if err != nil {
+		t.Fatalf("Failed to find the triple of key %q: %v", keys[0], err)
+	}
+	ses.ts.RemoveTriple(q)
+	for _, e := range multiLabelGraph {
+		want := e != q
+		if got, _ := ses.ts.QuadExists(e); got != want {
+			t.Errorf("Unexpected presence of %v after deleting %v, got: %t expected: %t", e, q, got, want)
+		}
+	}
+	if q.Subject != "A" || q.Object != "B" {
+		t.Errorf("Unexpected triple for an edge from A to B: %v", q)
+	}
+}
+
+// crossedKeys returns the keys that outputTag gives for the triples of
+// predicate from node, in direction d, tagged as an .OutE() or .InE() tags
+// them, without running a query.
+func crossedKeys(ts graph.TripleStore, node, predicate string, d quad.Direction) []string {
+	base := ts.FixedIterator()
+	base.Add(ts.ValueOf(node))
+	pred := ts.FixedIterator()
+	pred.Add(ts.ValueOf(predicate))
+	and := iterator.NewAnd()
+	and.AddSubIterator(iterator.NewLinksTo(ts, pred, quad.Predicate))
+	and.AddSubIterator(iterator.NewLinksTo(ts, base, d))
+	and.Tagger().Add(edgeTagPrefix + "edge")
+	out := quad.Object
+	if d == quad.Object {
+		out = quad.Subject
+	}
+	it := iterator.NewHasA(ts, and, out)
+	defer it.Close()
+
+	ses := &Session{ts: ts}
+	var keys []string
+	for graph.Next(it) {
+		tags := make(map[string]graph.Value)
+		it.TagResults(tags)
+		for tag, v := range tags {
+			if name, key, ok := outputTag(tag, v, ses); ok && name == "edge" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDeleteCrossedEdge(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		node    string
+		dir     quad.Direction
+		edges   int
+	}{
+		{message: "out of A", node: "A", dir: quad.Subject, edges: 3},
+		{message: "into D", node: "D", dir: quad.Object, edges: 1},
+	} {
+		ts, _ := graph.NewTripleStore("memstore", "", nil)
+		ts.AddTripleSet(multiLabelGraph)
+		keys := crossedKeys(ts, test.node, "follows", test.dir)
+		if len(keys) != test.edges {
+			t.Fatalf("Unexpected edges crossed %s, got: %v expected %d", test.message, keys, test.edges)
+		}
+
+		// Deleting by the key of one edge removes exactly that triple.
+		q, err := graph.QuadOfKey(ts, keys[0])
+		if err != nil {
+			t.Fatalf("Failed to find the triple of key %q: %v", keys[0], err)
+		}
+		if q.Get(test.dir) != test.node {
+			t.Errorf("Unexpected triple crossed %s: %v", test.message, q)
+		}
+		ts.RemoveTriple(q)
+		for _, e := range multiLabelGraph {
+			want := e != q
+			if got, _ := ts.QuadExists(e); got != want {
+				t.Errorf("Unexpected presence of %v after deleting %v, got: %t expected: %t", e, q, got, want)
+			}
+		}
+		if got := crossedKeys(ts, test.node, "follows", test.dir); len(got) != test.edges-1 {
+			t.Errorf("Unexpected edges crossed %s after deleting %v, got: %v", test.message, q, got)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		who     string
+		expect  []string
+	}{
+		{
+			message: "bind a node",
+			who:     "A",
+			expect:  []string{"B"},
+		},
+		{
+			message: "bind a query as data",
+			who:     `A").Out("follows").All(); g.V("B`,
+			expect:  nil,
+		},
+	} {
+		js := makeTestSession(simpleGraph)
+		if err := js.BindParams(map[string]string{"who": test.who}); err != nil {
+			t.Fatalf("Failed to %s: %v", test.message, err)
+		}
+		c := make(chan interface{}, 5)
+		js.ExecInput(`g.V($who).Out("follows").All()`, c, -1)
+		var got []string
+		for res := range c {
+			data := res.(*Result)
+			if data.val == nil {
+				got = append(got, js.ts.NameOf((*data.actualResults)[TopResultTag]))
+			}
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestDedup(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		query   string
+		expect  []string
+	}{
+		{
+			message: "keep every path without dedup",
+			query:   `g.V("A", "C").Out("follows").All()`,
+			expect:  []string{"B", "B", "B", "D"},
+		},
+		{
+			message: "dedup by node",
+			query:   `g.V("A", "C").Out("follows").Dedup().All()`,
+			expect:  []string{"B", "D"},
+		},
+		{
+			message: "dedup by node explicitly",
+			query:   `g.V("A", "C").Out("follows").Dedup("node").All()`,
+			expect:  []string{"B", "D"},
+		},
+		{
+			message: "dedup by node and label",
+			query:   `g.V("A", "C").Out("follows").Dedup("label").All()`,
+			expect:  []string{"B", "B", "D"},
+		},
+		{
+			message: "dedup by node and label in reverse",
+			query:   `g.V("B").In("follows").Dedup("label").All()`,
+			expect:  []string{"A", "A", "C"},
+		},
+	} {
+		got := runQueryGetTag(multiLabelGraph, test.query, TopResultTag)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		query   string
+		expect  int64
+	}{
+		{
+			message: "count the nodes following others",
+			query:   `g.Emit(g.V("A", "B", "C").Out("follows").Count())`,
+			expect:  3,
+		},
+		{
+			message: "count exactly",
+			query:   `g.Emit(g.V("A", "B", "C").Out("follows").Count("exact"))`,
+			expect:  3,
+		},
+		{
+			message: "count every node approximately",
+			query:   `g.Emit(g.V().Count("approximate"))`,
+			expect:  11, // Including the predicates and the label.
+		},
+	} {
+		ses := makeTestSession(simpleGraph)
+		c := make(chan interface{}, 5)
+		go ses.ExecInput(test.query, c, -1)
+		var got []int64
+		for res := range c {
+			data := res.(*Result)
+			if data.metaresult || data.val == nil {
+				continue
+			}
+			count, _ := data.val.Object().Get("count")
+			n, _ := count.ToInteger()
+			got = append(got, n)
+		}
+		if len(got) != 1 || got[0] != test.expect {
+			t.Errorf("Failed to %s, got: %v expected: [%d]", test.message, got, test.expect)
+		}
+	}
+}
+
+func TestMaxResults(t *testing.T) {
+	ses := makeTestSession(simpleGraph)
+	c := make(chan interface{}, 5)
+	ses.results = c
+	ses.max = 3
+	var carryOn []bool
+	for i := 0; i < 5; i++ {
+		carryOn = append(carryOn, ses.SendResult(&Result{}))
+	}
+	if expect := []bool{true, true, false, false, false}; !reflect.DeepEqual(carryOn, expect) {
+		t.Errorf("Unexpected results of sending past the maximum, got:%v expect:%v", carryOn, expect)
+	}
+	if len(c) != 3 {
+		t.Errorf("Unexpected number of results sent, got:%d expect:3", len(c))
+	}
+}
+
+func TestPath(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		query   string
+		expect  [][]string
+	}{
+		{
+			message: "return the path of a two-hop traversal",
+			query:   `g.V("A").Out("follows").Out("follows").Path().All()`,
+			expect:  [][]string{{"A", "B", "F"}},
+		},
+		{
+			message: "return every path of a two-hop traversal",
+			query:   `g.V("C").Out("follows").Out("follows").Path().All()`,
+			expect:  [][]string{{"C", "B", "F"}, {"C", "D", "B"}, {"C", "D", "G"}},
+		},
+		{
+			message: "leave out the steps that stay put",
+			query:   `g.V("C").Tag("start").Out("follows").Has("status", "cool").Out("follows").Path().All()`,
+			expect:  [][]string{{"C", "B", "F"}, {"C", "D", "B"}, {"C", "D", "G"}},
+		},
+	} {
+		ses := makeTestSession(simpleGraph)
+		c := make(chan interface{}, 5)
+		go ses.ExecInput(test.query, c, -1)
+		var got [][]string
+		for res := range c {
+			data := res.(*Result)
+			if data.val != nil || data.actualResults == nil {
+				continue
+			}
+			var names []string
+			for _, v := range pathOf(*data.actualResults) {
+				names = append(names, ses.ts.NameOf(v))
+			}
+			got = append(got, names)
+		}
+		sort.Sort(byPath(got))
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, got: %v expected: %v", test.message, got, test.expect)
+		}
+	}
+}
+
+type byPath [][]string
+
+func (p byPath) Len() int      { return len(p) }
+func (p byPath) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byPath) Less(i, j int) bool {
+	return strings.Join(p[i], " ") < strings.Join(p[j], " ")
+}
+
+// runPlanGetResults plans query, and runs the plan built against a store of
+// its own holding the same graph, returning the results by name.
+func runPlanGetResults(t *testing.T, g []quad.Quad, query string) []string {
+	plan, err := makeTestSession(g).GetPlan(query)
+	if err != nil {
+		return nil
+	}
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("Failed to marshal plan of %s: %v", query, err)
+	}
+	var loaded iterator.Plan
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		t.Fatalf("Failed to unmarshal plan of %s: %v", query, err)
+	}
+	ts := makeTestSession(g).ts
+	it, err := loaded.Build(ts)
+	if err != nil {
+		t.Fatalf("Failed to build plan of %s: %v", query, err)
+	}
+	var results []string
+	for graph.Next(it) {
+		results = append(results, ts.NameOf(it.Result()))
+		for it.NextPath() {
+			results = append(results, ts.NameOf(it.Result()))
+		}
+	}
+	return results
+}
+
+func TestPlan(t *testing.T) {
+	for _, query := range []string{
+		`g.V("C").Out("follows").All()`,
+		`g.V().Has("status", "cool").Tag("cool").Out("follows").All()`,
+		`g.V("D", "B").Union(g.M().Out("follows"), g.M().Out("status")).All()`,
+	} {
+		got := runPlanGetResults(t, simpleGraph, query)
+		expect := runQueryGetTag(simpleGraph, query, TopResultTag)
+		sort.Strings(got)
+		sort.Strings(expect)
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Unexpected results of replayed plan of %s, got:%v expect:%v", query, got, expect)
+		}
+	}
+}
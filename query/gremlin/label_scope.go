@@ -0,0 +1,51 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gremlin
+
+import (
+	"github.com/google/cayley/graph"
+)
+
+// A scopedStore is the triple store of a session with a label scope. The
+// iterator trees built over it only traverse triples with one of its
+// labels.
+type scopedStore struct {
+	graph.TripleStore
+	labels []string
+}
+
+// SetLabelScope limits the traversals of the queries the session runs to
+// the triples with any of the given labels. With no labels, every triple is
+// traversed.
+func (s *Session) SetLabelScope(labels []string) {
+	s.labels = labels
+}
+
+// store returns the triple store to build the iterator trees of the
+// session's queries over.
+func (s *Session) store() graph.TripleStore {
+	if len(s.labels) == 0 {
+		return s.ts
+	}
+	return scopedStore{TripleStore: s.ts, labels: s.labels}
+}
+
+// labelScope returns the labels traversals over ts are limited to, if any.
+func labelScope(ts graph.TripleStore) []string {
+	if s, ok := ts.(scopedStore); ok {
+		return s.labels
+	}
+	return nil
+}
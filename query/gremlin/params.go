@@ -0,0 +1,39 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gremlin
+
+import (
+	"github.com/google/cayley/query"
+)
+
+// BindParams makes each of params a Javascript variable of the queries the
+// session runs, named by "$" and the parameter's name, so that a query
+// such as
+//
+//	g.V($user).Out("follows").All()
+//
+// starts from the node named by the user parameter, whatever the name
+// holds. The value is a string of the environment, never more of the query.
+func (s *Session) BindParams(params map[string]string) error {
+	if err := query.CheckParams(params); err != nil {
+		return err
+	}
+	for name, value := range params {
+		if err := s.env.Set("$"+name, value); err != nil {
+			return &query.ParseError{Err: err}
+		}
+	}
+	return nil
+}
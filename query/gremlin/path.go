@@ -0,0 +1,140 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gremlin
+
+// Implements .Path(), which returns the nodes a traversal passed through.
+//
+// While the iterators for the steps before a .Path() are built, each step
+// that moves to new nodes is tagged with its place along the path. Every
+// path a query takes, as NextPath finds them, then carries the node of each
+// step in its tags, and these are gathered into an ordered array of names
+// when the results are output.
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/robertkrimen/otto"
+
+	"github.com/google/cayley/graph"
+)
+
+// pathTagPrefix is followed by the place along the path of the step that a
+// tag is put on.
+const pathTagPrefix = "_gremlin_path_"
+
+// PathKey is the key of the array of nodes in a result of a .Path().
+const PathKey = "path"
+
+// pathKinds are the steps that move to new nodes.
+var pathKinds = map[string]bool{
+	"vertex":  true,
+	"in":      true,
+	"out":     true,
+	"ine":     true,
+	"oute":    true,
+	"both":    true,
+	"follow":  true,
+	"followr": true,
+}
+
+// setPathTags marks each step of the chain ending at obj that moves to new
+// nodes with the tag for its place along the path, or, if mark is false,
+// clears the marks so that the chain can be reused without a path.
+func setPathTags(obj *otto.Object, mark bool) {
+	var steps []*otto.Object
+	for {
+		kindVal, _ := obj.Get("_gremlin_type")
+		if kind, _ := kindVal.ToString(); pathKinds[kind] {
+			steps = append(steps, obj)
+		}
+		prevVal, _ := obj.Get("_gremlin_prev")
+		if !prevVal.IsObject() {
+			break
+		}
+		obj = prevVal.Object()
+	}
+	for i, step := range steps {
+		tag := ""
+		if mark {
+			tag = pathTagPrefix + strconv.Itoa(len(steps)-1-i)
+		}
+		step.Set("_gremlin_path_tag", tag)
+	}
+}
+
+// tagPathStep tags it if obj was marked by setPathTags.
+func tagPathStep(obj *otto.Object, it graph.Iterator) {
+	val, _ := obj.Get("_gremlin_path_tag")
+	if !val.IsString() {
+		return
+	}
+	if tag, _ := val.ToString(); tag != "" {
+		it.Tagger().Add(tag)
+	}
+}
+
+func isPathTag(tag string) bool {
+	return strings.HasPrefix(tag, pathTagPrefix)
+}
+
+// pathOf returns the nodes of the path tags in tags in order along the
+// path, or nil if there are none.
+func pathOf(tags map[string]graph.Value) []graph.Value {
+	var places []int
+	byPlace := make(map[int]graph.Value)
+	for tag, v := range tags {
+		if !isPathTag(tag) {
+			continue
+		}
+		place, err := strconv.Atoi(tag[len(pathTagPrefix):])
+		if err != nil {
+			continue
+		}
+		places = append(places, place)
+		byPlace[place] = v
+	}
+	if len(places) == 0 {
+		return nil
+	}
+	sort.Ints(places)
+	path := make([]graph.Value, len(places))
+	for i, place := range places {
+		path[i] = byPlace[place]
+	}
+	return path
+}
+
+// tagsToOutput returns the names of the nodes in tags, keyed by tag, with
+// the nodes of a path, if there is one, as an array under PathKey.
+func tagsToOutput(tags map[string]graph.Value, ses *Session) interface{} {
+	path := pathOf(tags)
+	if path == nil {
+		return tagsToValueMap(tags, ses)
+	}
+	out := make(map[string]interface{})
+	for k, v := range tags {
+		if tag, name, ok := outputTag(k, v, ses); ok {
+			out[tag] = name
+		}
+	}
+	names := make([]string, len(path))
+	for i, v := range path {
+		names[i] = ses.ts.NameOf(v)
+	}
+	out[PathKey] = names
+	return out
+}
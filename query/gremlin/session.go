@@ -18,17 +18,23 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/barakmich/glog"
 	"github.com/robertkrimen/otto"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/query"
 )
 
 var ErrKillTimeout = errors.New("query timed out")
 
+// ErrKilled is the error of a query stopped by Kill.
+var ErrKilled = errors.New("query killed")
+
 type Session struct {
 	ts         graph.TripleStore
 	results    chan interface{}
@@ -37,20 +43,33 @@ type Session struct {
 	debug      bool
 	limit      int
 	count      int
+	max        int
+	sent       int
 	dataOutput []interface{}
 	wantShape  bool
 	shape      map[string]interface{}
+	wantPlan   bool
+	plan       *iterator.Plan
+	plans      []string
+	analyze    bool
+	running    []*graph.Analysis
+	analyses   []graph.IteratorAnalysis
+	sampleN    int64
+	sampleFrac float64
 	err        error
 	script     *otto.Script
 	kill       chan struct{}
+	killed     error
 	timeout    time.Duration
 	emptyEnv   *otto.Otto
+	labels     []string
 }
 
 func NewSession(ts graph.TripleStore, timeout time.Duration, persist bool) *Session {
 	g := Session{
 		ts:      ts,
 		limit:   -1,
+		max:     -1,
 		timeout: timeout,
 	}
 	g.env = BuildEnviron(&g)
@@ -80,6 +99,24 @@ func (s *Session) GetQuery(input string, out chan map[string]interface{}) {
 	s.shape = nil
 }
 
+// GetPlan runs input only to plan the optimized iterator tree of its
+// query, returning the plan rather than the results.
+func (s *Session) GetPlan(input string) (*iterator.Plan, error) {
+	s.wantPlan = true
+	s.plan, s.err = nil, nil
+	defer func() { s.wantPlan, s.plan = false, nil }()
+	if _, err := s.env.Run(input); err != nil {
+		return nil, err
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.plan == nil {
+		return nil, errors.New("gremlin: no query to plan")
+	}
+	return s.plan, nil
+}
+
 func (s *Session) InputParses(input string) (query.ParseResult, error) {
 	script, err := s.env.Compile("", input)
 	if err != nil {
@@ -89,10 +126,16 @@ func (s *Session) InputParses(input string) (query.ParseResult, error) {
 	return query.Parsed, nil
 }
 
+// SendResult sends r to the results of the running query, returning
+// whether the query should carry on. Results beyond the limit of the final
+// being run, or beyond the maximum given to ExecInput, are not sent.
 func (s *Session) SendResult(r *Result) bool {
 	if s.limit >= 0 && s.limit == s.count {
 		return false
 	}
+	if s.max >= 0 && s.max == s.sent {
+		return false
+	}
 	select {
 	case <-s.kill:
 		return false
@@ -101,8 +144,11 @@ func (s *Session) SendResult(r *Result) bool {
 	if s.results != nil {
 		s.results <- r
 		s.count++
+		s.sent++
 		if s.limit >= 0 && s.limit == s.count {
 			return false
+		} else if s.max >= 0 && s.max == s.sent {
+			return false
 		} else {
 			return true
 		}
@@ -111,11 +157,15 @@ func (s *Session) SendResult(r *Result) bool {
 }
 
 func (s *Session) runUnsafe(input interface{}) (otto.Value, error) {
+	s.envLock.Lock()
 	s.kill = make(chan struct{})
+	s.killed = nil
+	kill := s.kill
+	s.envLock.Unlock()
 	defer func() {
 		if r := recover(); r != nil {
-			if r == ErrKillTimeout {
-				s.err = ErrKillTimeout
+			if r == ErrKillTimeout || r == ErrKilled {
+				s.err = r.(error)
 				return
 			}
 			panic(r)
@@ -128,15 +178,7 @@ func (s *Session) runUnsafe(input interface{}) (otto.Value, error) {
 	if s.timeout >= 0 {
 		go func() {
 			time.Sleep(s.timeout)
-			close(s.kill)
-			s.envLock.Lock()
-			defer s.envLock.Unlock()
-			if s.env != nil {
-				s.env.Interrupt <- func() {
-					panic(ErrKillTimeout)
-				}
-				s.env = s.emptyEnv
-			}
+			s.stop(kill, ErrKillTimeout)
 		}()
 	}
 
@@ -146,10 +188,43 @@ func (s *Session) runUnsafe(input interface{}) (otto.Value, error) {
 	return env.Run(input)
 }
 
+// stop interrupts the run that kill belongs to with err, unless it has
+// already been stopped, or another run has started since.
+func (s *Session) stop(kill chan struct{}, err error) {
+	s.envLock.Lock()
+	defer s.envLock.Unlock()
+	if kill == nil || kill != s.kill || s.killed != nil {
+		return
+	}
+	s.killed = err
+	close(kill)
+	if s.env != nil {
+		s.env.Interrupt <- func() {
+			panic(err)
+		}
+		s.env = s.emptyEnv
+	}
+}
+
+// Kill stops the query the session is running, which then fails with
+// ErrKilled.
+func (s *Session) Kill() {
+	s.envLock.Lock()
+	kill := s.kill
+	s.envLock.Unlock()
+	s.stop(kill, ErrKilled)
+}
+
+// ExecInput runs input, sending at most limit results to out, or every
+// result if limit is negative.
 func (s *Session) ExecInput(input string, out chan interface{}, limit int) {
 	defer close(out)
 	s.err = nil
 	s.results = out
+	s.max = limit
+	s.sent = 0
+	s.plans = nil
+	s.analyses = nil
 	var err error
 	var value otto.Value
 	if s.script == nil {
@@ -157,6 +232,10 @@ func (s *Session) ExecInput(input string, out chan interface{}, limit int) {
 	} else {
 		value, err = s.runUnsafe(s.script)
 	}
+	for _, a := range s.running {
+		s.analyses = append(s.analyses, a.Stop())
+	}
+	s.running = nil
 	out <- &Result{
 		metaresult: true,
 		err:        err,
@@ -169,6 +248,46 @@ func (s *Session) ExecInput(input string, out chan interface{}, limit int) {
 	s.envLock.Unlock()
 }
 
+// optimize returns it optimized, keeping its plan for Plans.
+func (s *Session) optimize(it graph.Iterator) graph.Iterator {
+	if s.sampleN > 0 {
+		it = iterator.NewSample(s.ts, it, s.sampleN)
+	} else if s.sampleFrac > 0 {
+		it = iterator.NewSampleFraction(s.ts, it, s.sampleFrac)
+	}
+	it, _ = it.Optimize()
+	iterator.UseSpill(s.ts, it)
+	s.plans = append(s.plans, it.DebugString(0))
+	if s.analyze {
+		s.running = append(s.running, graph.Analyze(it))
+	}
+	return it
+}
+
+// Plans returns the optimized iterator tree of each query run by the last
+// ExecInput, in the order they were run.
+func (s *Session) Plans() []string {
+	return s.plans
+}
+
+// SetAnalyze sets whether ExecInput runs its queries in analyze mode.
+func (s *Session) SetAnalyze(analyze bool) {
+	s.analyze = analyze
+}
+
+// SetSample sets ExecInput to run its queries over a random sample of
+// their results, of at most n if n is positive, or else of each with
+// probability fraction.
+func (s *Session) SetSample(n int64, fraction float64) {
+	s.sampleN, s.sampleFrac = n, fraction
+}
+
+// Analyses returns the analysis of each query run by the last ExecInput,
+// in the order they were run, if they were run in analyze mode.
+func (s *Session) Analyses() []graph.IteratorAnalysis {
+	return s.analyses
+}
+
 func (s *Session) ToText(result interface{}) string {
 	data := result.(*Result)
 	if data.metaresult {
@@ -202,7 +321,16 @@ func (s *Session) ToText(result interface{}) string {
 			if k == "$_" {
 				continue
 			}
-			out += fmt.Sprintf("%s : %s\n", k, s.ts.NameOf((*tags)[k]))
+			if tag, name, ok := outputTag(k, (*tags)[k], s); ok {
+				out += fmt.Sprintf("%s : %s\n", tag, name)
+			}
+		}
+		if path := pathOf(*tags); path != nil {
+			names := make([]string, len(path))
+			for i, v := range path {
+				names[i] = s.ts.NameOf(v)
+			}
+			out += fmt.Sprintf("%s : %s\n", PathKey, strings.Join(names, " -> "))
 		}
 	} else {
 		if data.val.IsObject() {
@@ -224,19 +352,7 @@ func (s *Session) BuildJson(result interface{}) {
 	data := result.(*Result)
 	if !data.metaresult {
 		if data.val == nil {
-			obj := make(map[string]string)
-			tags := data.actualResults
-			tagKeys := make([]string, len(*tags))
-			i := 0
-			for k, _ := range *tags {
-				tagKeys[i] = k
-				i++
-			}
-			sort.Strings(tagKeys)
-			for _, k := range tagKeys {
-				obj[k] = s.ts.NameOf((*tags)[k])
-			}
-			s.dataOutput = append(s.dataOutput, obj)
+			s.dataOutput = append(s.dataOutput, tagsToOutput(*data.actualResults, s))
 		} else {
 			if data.val.IsObject() {
 				export, _ := data.val.Export()
@@ -249,6 +365,43 @@ func (s *Session) BuildJson(result interface{}) {
 	}
 }
 
+// ResultTags returns the names of the tags of a result sent by ExecInput, or
+// false if it is not a row of tags, as the meta result and emitted values
+// are not. The nodes of a path are joined by arrows under PathKey.
+func (s *Session) ResultTags(result interface{}) (map[string]string, bool) {
+	data := result.(*Result)
+	if data.metaresult || data.val != nil {
+		return nil, false
+	}
+	tags := tagsToValueMap(*data.actualResults, s)
+	if path := pathOf(*data.actualResults); path != nil {
+		names := make([]string, len(path))
+		for i, v := range path {
+			names[i] = s.ts.NameOf(v)
+		}
+		tags[PathKey] = strings.Join(names, " -> ")
+	}
+	return tags, true
+}
+
+func (s *Session) WarmNames(results []interface{}) {
+	var vals []graph.Value
+	for _, r := range results {
+		data := r.(*Result)
+		if data.metaresult || data.val != nil {
+			continue
+		}
+		for k, v := range *data.actualResults {
+			if !isEdgeTag(k) {
+				vals = append(vals, v)
+			}
+		}
+	}
+	if err := graph.WarmNames(s.ts, vals); err != nil {
+		glog.Errorln("Error looking up result names: ", err)
+	}
+}
+
 func (s *Session) GetJson() ([]interface{}, error) {
 	defer s.ClearJson()
 	if s.err != nil {
@@ -256,7 +409,7 @@ func (s *Session) GetJson() ([]interface{}, error) {
 	}
 	select {
 	case <-s.kill:
-		return nil, ErrKillTimeout
+		return nil, s.killed
 	default:
 		return s.dataOutput, nil
 	}
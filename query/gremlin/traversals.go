@@ -24,13 +24,15 @@ import (
 func embedTraversals(env *otto.Otto, ses *Session, obj *otto.Object) {
 	obj.Set("In", gremlinFunc("in", obj, env, ses))
 	obj.Set("Out", gremlinFunc("out", obj, env, ses))
+	obj.Set("InE", gremlinFunc("ine", obj, env, ses))
+	obj.Set("OutE", gremlinFunc("oute", obj, env, ses))
 	obj.Set("Is", gremlinFunc("is", obj, env, ses))
 	obj.Set("Both", gremlinFunc("both", obj, env, ses))
 	obj.Set("Follow", gremlinFunc("follow", obj, env, ses))
 	obj.Set("FollowR", gremlinFollowR("followr", obj, env, ses))
 	obj.Set("And", gremlinFunc("and", obj, env, ses))
 	obj.Set("Intersect", gremlinFunc("and", obj, env, ses))
-	obj.Set("Union", gremlinFunc("or", obj, env, ses))
+	obj.Set("Union", gremlinFunc("union", obj, env, ses))
 	obj.Set("Or", gremlinFunc("or", obj, env, ses))
 	obj.Set("Back", gremlinBack("back", obj, env, ses))
 	obj.Set("Tag", gremlinFunc("tag", obj, env, ses))
@@ -38,6 +40,12 @@ func embedTraversals(env *otto.Otto, ses *Session, obj *otto.Object) {
 	obj.Set("Has", gremlinFunc("has", obj, env, ses))
 	obj.Set("Save", gremlinFunc("save", obj, env, ses))
 	obj.Set("SaveR", gremlinFunc("saver", obj, env, ses))
+	obj.Set("Skip", gremlinFunc("skip", obj, env, ses))
+	obj.Set("Limit", gremlinFunc("limit", obj, env, ses))
+	obj.Set("Path", gremlinFunc("path", obj, env, ses))
+	obj.Set("Dedup", gremlinFunc("dedup", obj, env, ses))
+	obj.Set("OutCount", gremlinFunc("outcount", obj, env, ses))
+	obj.Set("InCount", gremlinFunc("incount", obj, env, ses))
 }
 
 func gremlinFunc(kind string, prevObj *otto.Object, env *otto.Otto, ses *Session) func(otto.FunctionCall) otto.Value {
@@ -155,6 +163,10 @@ func reverseGremlinChainHelper(env *otto.Otto, chain *otto.Object, newBase *otto
 		newKind = "out"
 	case "out":
 		newKind = "in"
+	case "ine":
+		newKind = "oute"
+	case "oute":
+		newKind = "ine"
 	default:
 		newKind = kind
 	}
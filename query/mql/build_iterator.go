@@ -105,6 +105,7 @@ func (q *Query) buildIteratorTreeInternal(query interface{}, path Path) (it grap
 func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path Path) (graph.Iterator, error) {
 	it := iterator.NewAnd()
 	it.AddSubIterator(q.ses.ts.NodesAllIterator())
+	var optionals []graph.Iterator
 	var err error
 	err = nil
 	outputStructure := make(map[string]interface{})
@@ -154,7 +155,7 @@ func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path
 			}
 		}
 		if optional {
-			it.AddSubIterator(iterator.NewOptional(subit))
+			optionals = append(optionals, subit)
 		} else {
 			it.AddSubIterator(subit)
 		}
@@ -163,7 +164,13 @@ func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path
 		return nil, err
 	}
 	q.queryStructure[path] = outputStructure
-	return it, nil
+	// Optional subqueries are left joined to the required ones, so each
+	// result is found once rather than checked against every optional.
+	var out graph.Iterator = it
+	for _, subit := range optionals {
+		out = iterator.NewLeftJoin(q.ses.ts, out, subit)
+	}
+	return out, nil
 }
 
 type ResultPathSlice []ResultPath
@@ -190,3 +190,116 @@ func TestMQL(t *testing.T) {
 		}
 	}
 }
+
+func TestBindParams(t *testing.T) {
+	// The name of this node would end the query early, were it written
+	// into the query.
+	const odd = `x"}, {"id": null`
+	g := append([]quad.Quad{{odd, "follows", "B", ""}}, simpleGraph...)
+	query := `[{"id": "$who", "follows": null}]`
+
+	for _, test := range []struct {
+		message string
+		params  map[string]string
+		expect  string
+	}{
+		{
+			message: "bind a node",
+			params:  map[string]string{"who": "A"},
+			expect:  `[{"id": "A", "follows": "B"}]`,
+		},
+		{
+			message: "bind a name with quotes as data",
+			params:  map[string]string{"who": odd},
+			expect:  `[{"id": "x\"}, {\"id\": null", "follows": "B"}]`,
+		},
+		{
+			message: "bind a query as data",
+			params:  map[string]string{"who": `A", "follows": null}, {"id": null`},
+			expect:  `null`,
+		},
+	} {
+		s := makeTestSession(g)
+		if err := s.BindParams(test.params); err != nil {
+			t.Fatalf("Failed to %s: %v", test.message, err)
+		}
+		c := make(chan interface{}, 5)
+		go s.ExecInput(query, c, -1)
+		for result := range c {
+			s.BuildJson(result)
+		}
+		got, err := s.GetJson()
+		if err != nil {
+			t.Errorf("Failed to %s: %v", test.message, err)
+			continue
+		}
+		var expect interface{}
+		json.Unmarshal([]byte(test.expect), &expect)
+		if !reflect.DeepEqual(got, expect) && !(len(got) == 0 && expect == nil) {
+			t.Errorf("Failed to %s, got: %v expected: %s", test.message, got, test.expect)
+		}
+	}
+
+	s := makeTestSession(g)
+	if err := s.BindParams(map[string]string{"who; drop": "A"}); err == nil {
+		t.Error("Expected invalid parameter name to be rejected")
+	}
+	s.BindParams(map[string]string{"other": "A"})
+	c := make(chan interface{}, 5)
+	go s.ExecInput(query, c, -1)
+	for range c {
+	}
+	if _, err := s.GetJson(); err == nil {
+		t.Error("Expected placeholder without a value to fail")
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	s := makeTestSession(simpleGraph)
+	s.SetAnalyze(true)
+	c := make(chan interface{}, 5)
+	go s.ExecInput(`[{"id": null, "status": "cool"}]`, c, -1)
+	var results int64
+	for range c {
+		results++
+	}
+	analyses := s.Analyses()
+	if len(analyses) != 1 {
+		t.Fatalf("Unexpected number of analyses, got:%d expect:1", len(analyses))
+	}
+	root := analyses[0]
+	if root.Actual != results || results != 3 {
+		t.Errorf("Unexpected actual count of the root, got:%d expect:%d results", root.Actual, results)
+	}
+	var nodes, counted int
+	var walk func(a graph.IteratorAnalysis)
+	walk = func(a graph.IteratorAnalysis) {
+		nodes++
+		if a.Type == "" || a.UID == 0 {
+			t.Errorf("Unidentified iterator in analysis: %+v", a)
+		}
+		if a.Estimated <= 0 {
+			t.Errorf("Missing estimate for %s %d, got:%d", a.Type, a.UID, a.Estimated)
+		}
+		if a.Actual > 0 {
+			counted++
+		}
+		for _, sub := range a.SubIterators {
+			walk(sub)
+		}
+	}
+	walk(root)
+	if nodes < 2 || counted < 2 {
+		t.Errorf("Unexpected analysis of %d iterators with %d counted, analysis:%+v", nodes, counted, root)
+	}
+
+	// Without analyze mode, nothing is counted.
+	s.SetAnalyze(false)
+	c = make(chan interface{}, 5)
+	go s.ExecInput(`[{"id": null}]`, c, -1)
+	for range c {
+	}
+	if got := s.Analyses(); got != nil {
+		t.Errorf("Unexpected analyses outside analyze mode, got:%+v", got)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mql
+
+import (
+	"fmt"
+
+	"github.com/google/cayley/query"
+)
+
+// BindParams binds params to the placeholders of the queries the session
+// runs: string values, not keys, that are "$" and the name of a parameter,
+// such as
+//
+//	[{"id": "$user", "follows": []}]
+//
+// Once parameters are bound, a placeholder of a parameter that has none is
+// an error.
+func (s *Session) BindParams(params map[string]string) error {
+	if err := query.CheckParams(params); err != nil {
+		return err
+	}
+	s.params = params
+	return nil
+}
+
+// bind returns the query q with its placeholders replaced by the bound
+// values. The values are put in place of the placeholders in the decoded
+// query, so that they are only ever names of nodes.
+func (s *Session) bind(q interface{}) (interface{}, error) {
+	if s.params == nil {
+		return q, nil
+	}
+	switch t := q.(type) {
+	case string:
+		name, ok := query.Placeholder(t)
+		if !ok {
+			return t, nil
+		}
+		value, ok := s.params[name]
+		if !ok {
+			return nil, &query.ParseError{Err: fmt.Errorf("no value for parameter %q", name)}
+		}
+		return value, nil
+	case []interface{}:
+		for i, v := range t {
+			b, err := s.bind(v)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = b
+		}
+	case map[string]interface{}:
+		for k, v := range t {
+			b, err := s.bind(v)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = b
+		}
+	}
+	return q, nil
+}
@@ -30,6 +30,22 @@ type Session struct {
 	ts           graph.TripleStore
 	currentQuery *Query
 	debug        bool
+
+	// Values bound to placeholders, or nil.
+	params map[string]string
+
+	// The optimized iterator tree of the last query run, or empty.
+	plan string
+
+	// Whether queries are run in analyze mode, and the analysis of the
+	// last query run in it, if any.
+	analyze  bool
+	analysis *graph.IteratorAnalysis
+
+	// The size or fraction of the random sample queries are run over, if
+	// any.
+	sampleN    int64
+	sampleFrac float64
 }
 
 func NewSession(ts graph.TripleStore) *Session {
@@ -50,6 +66,10 @@ func (m *Session) GetQuery(input string, output_struct chan map[string]interface
 		return
 	}
 	m.currentQuery = NewQuery(m)
+	if mqlQuery, err = m.bind(mqlQuery); err != nil {
+		m.currentQuery.err = err
+		return
+	}
 	m.currentQuery.BuildIteratorTree(mqlQuery)
 	output := make(map[string]interface{})
 	iterator.OutputQueryShapeForIterator(m.currentQuery.it, m.ts, output)
@@ -72,21 +92,70 @@ func (s *Session) InputParses(input string) (query.ParseResult, error) {
 	return query.Parsed, nil
 }
 
+// Plans returns the optimized iterator tree of the query run by the last
+// ExecInput, if it got as far as running one.
+func (s *Session) Plans() []string {
+	if s.plan == "" {
+		return nil
+	}
+	return []string{s.plan}
+}
+
+// SetAnalyze sets whether ExecInput runs its query in analyze mode.
+func (s *Session) SetAnalyze(analyze bool) {
+	s.analyze = analyze
+}
+
+// SetSample sets ExecInput to run its query over a random sample of its
+// results, of at most n if n is positive, or else of each with probability
+// fraction.
+func (s *Session) SetSample(n int64, fraction float64) {
+	s.sampleN, s.sampleFrac = n, fraction
+}
+
+// Analyses returns the analysis of the query run by the last ExecInput, if
+// it was run in analyze mode.
+func (s *Session) Analyses() []graph.IteratorAnalysis {
+	if s.analysis == nil {
+		return nil
+	}
+	return []graph.IteratorAnalysis{*s.analysis}
+}
+
 func (s *Session) ExecInput(input string, c chan interface{}, limit int) {
 	defer close(c)
+	s.plan = ""
+	s.analysis = nil
 	var mqlQuery interface{}
 	err := json.Unmarshal([]byte(input), &mqlQuery)
 	if err != nil {
 		return
 	}
 	s.currentQuery = NewQuery(s)
+	if mqlQuery, err = s.bind(mqlQuery); err != nil {
+		s.currentQuery.err = err
+		return
+	}
 	s.currentQuery.BuildIteratorTree(mqlQuery)
 	if s.currentQuery.isError() {
 		return
 	}
-	it, _ := s.currentQuery.it.Optimize()
-	if glog.V(2) {
-		glog.V(2).Infoln(it.DebugString(0))
+	it := s.currentQuery.it
+	if s.sampleN > 0 {
+		it = iterator.NewSample(s.ts, it, s.sampleN)
+	} else if s.sampleFrac > 0 {
+		it = iterator.NewSampleFraction(s.ts, it, s.sampleFrac)
+	}
+	it, _ = it.Optimize()
+	iterator.UseSpill(s.ts, it)
+	s.plan = it.DebugString(0)
+	glog.V(2).Infoln(s.plan)
+	if s.analyze {
+		a := graph.Analyze(it)
+		defer func() {
+			r := a.Stop()
+			s.analysis = &r
+		}()
 	}
 	for graph.Next(it) {
 		tags := make(map[string]graph.Value)
@@ -127,6 +196,20 @@ func (s *Session) BuildJson(result interface{}) {
 	s.currentQuery.treeifyResult(result.(map[string]graph.Value))
 }
 
+func (s *Session) WarmNames(results []interface{}) {
+	var vals []graph.Value
+	for _, r := range results {
+		for _, v := range r.(map[string]graph.Value) {
+			if v != nil {
+				vals = append(vals, v)
+			}
+		}
+	}
+	if err := graph.WarmNames(s.ts, vals); err != nil {
+		glog.Errorln("Error looking up result names: ", err)
+	}
+}
+
 func (s *Session) GetJson() ([]interface{}, error) {
 	s.currentQuery.buildResults()
 	if s.currentQuery.isError() {
@@ -0,0 +1,44 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// paramName matches the names of parameters, which are identifiers in each
+// query language.
+var paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// CheckParams returns a ParseError if any of params has a name that no
+// placeholder could have.
+func CheckParams(params map[string]string) error {
+	for name := range params {
+		if !paramName.MatchString(name) {
+			return &ParseError{Err: fmt.Errorf("invalid parameter name %q", name)}
+		}
+	}
+	return nil
+}
+
+// Placeholder returns the name of the parameter that s stands for, if it
+// is a placeholder: "$" followed by the name, such as "$user".
+func Placeholder(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '$' || !paramName.MatchString(s[1:]) {
+		return "", false
+	}
+	return s[1:], true
+}
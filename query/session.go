@@ -16,6 +16,10 @@ package query
 
 // Defines the graph session interface general to all query languages.
 
+import (
+	"github.com/google/cayley/graph"
+)
+
 type ParseResult int
 
 const (
@@ -32,6 +36,56 @@ type Session interface {
 	ToggleDebug()
 }
 
+// A NameWarmer can look up the names in a page of results, as sent by
+// ExecInput, all at once before the results are built, rather than one at a
+// time as each is built.
+type NameWarmer interface {
+	WarmNames([]interface{})
+}
+
+// A ParamBinder binds values to the named placeholders of the queries it
+// runs, so that values, such as those given by users, are never written
+// into the text of a query, where they could be taken for more of it.
+type ParamBinder interface {
+	BindParams(map[string]string) error
+}
+
+// A TagStreamer can give the tags of each result ExecInput sends by name,
+// so that results can be written out as they are found, rather than once
+// they are all in. Results that are not rows of tags are reported as such.
+type TagStreamer interface {
+	ResultTags(interface{}) (map[string]string, bool)
+}
+
+// An Explainer can give the optimized iterator tree of each query run by
+// its last ExecInput, as DebugString gives them, once ExecInput is done.
+type Explainer interface {
+	Plans() []string
+}
+
+// An Analyzer can run the queries of its ExecInput in analyze mode,
+// counting the results yielded by each iterator of their optimized trees,
+// so that the counts can be set against the planner's estimates.
+type Analyzer interface {
+	SetAnalyze(bool)
+
+	// Analyses returns the analysis of each query run by the last
+	// ExecInput in analyze mode, once ExecInput is done.
+	Analyses() []graph.IteratorAnalysis
+}
+
+// A Sampler can run the queries of its ExecInput over a random sample of
+// their results: at most n of them if n is positive, or else each with
+// probability fraction. A sampler given neither gives every result.
+type Sampler interface {
+	SetSample(n int64, fraction float64)
+}
+
+// A Killer can stop the query it is running from another goroutine.
+type Killer interface {
+	Kill()
+}
+
 type HttpSession interface {
 	// Return whether the string is a valid expression.
 	InputParses(string) (ParseResult, error)
@@ -22,6 +22,7 @@ import (
 	"sort"
 
 	"github.com/google/cayley/graph"
+	"github.com/google/cayley/graph/iterator"
 	"github.com/google/cayley/query"
 )
 
@@ -72,6 +73,7 @@ func (s *Session) ExecInput(input string, out chan interface{}, limit int) {
 	if changed {
 		it = newIt
 	}
+	iterator.UseSpill(s.ts, it)
 
 	if s.debug {
 		fmt.Println(it.DebugString(0))